@@ -1,23 +1,9 @@
 import { useState, useEffect } from 'react'
 import { format } from 'date-fns'
-
-interface Log {
-  time: string
-  device_id: string
-  log_type: string
-  message: string
-}
-
-interface WebSocketMessage {
-  type?: string
-  data?: Log
-  success?: boolean
-  message?: string
-  error?: string
-}
+import type { FeedEvent, LogMessage, LogResponse } from '@edge-insights/client'
 
 export default function LogFeed() {
-  const [logs, setLogs] = useState<Log[]>([])
+  const [logs, setLogs] = useState<LogMessage[]>([])
   const [connected, setConnected] = useState(false)
 
   useEffect(() => {
@@ -36,14 +22,15 @@ export default function LogFeed() {
     
     ws.onmessage = (event) => {
       try {
-        const data: WebSocketMessage = JSON.parse(event.data)
+        const data: FeedEvent | LogResponse = JSON.parse(event.data)
         
         // Handle log entry broadcasts
-        if (data.type === 'log_entry' && data.data) {
-          setLogs(prev => [data.data!, ...prev.slice(0, 49)]) // Keep last 50 logs
+        if ('type' in data && data.type === 'log_entry') {
+          const entry = data.data
+          setLogs(prev => [entry, ...prev.slice(0, 49)]) // Keep last 50 logs
         }
         // Handle success/error responses (for debugging)
-        else if (data.success !== undefined) {
+        else if ('success' in data) {
           console.log('Server response:', data.message)
         }
       } catch (error) {
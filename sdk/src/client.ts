@@ -0,0 +1,305 @@
+import type {
+  AnomalyResponse,
+  APIError,
+  IngestResponse,
+  LogMessage,
+  QueryResponse,
+  SearchResponse,
+  Subscription,
+  SummaryResponse,
+} from "./types.js"
+import { LiveFeed, type FeedOptions } from "./feed.js"
+
+export interface ClientOptions {
+  /** Server base URL, e.g. http://localhost:8080 */
+  baseUrl: string
+  /** Headers sent with every request */
+  headers?: Record<string, string>
+  /** fetch implementation; defaults to the global fetch */
+  fetch?: typeof fetch
+}
+
+/** Per-call options for requests the server can cancel */
+export interface RequestOptions {
+  /** Aborting the signal cancels the query in Postgres */
+  signal?: AbortSignal
+  /** Sent as X-Request-ID so the request can also be cancelled with cancelRequest */
+  requestId?: string
+}
+
+/** A QueryResponse whose result has a known shape */
+export type QueryResult<T> = Omit<QueryResponse, "result"> & { result: T }
+
+/** Filters for logs(); start is inclusive and end exclusive, on the device time */
+export interface LogsParams {
+  limit?: number
+  start?: Date | string
+  end?: Date | string
+  log_type?: string[]
+  device_type?: string
+  location?: string
+  metadata?: Record<string, unknown>
+}
+
+/** Filters for search(); range is a duration ending now ("7d") or an ISO 8601 interval */
+export interface SearchFilters {
+  device_type?: string
+  location?: string
+  log_type?: string
+  range?: string
+}
+
+export interface LogsResponse {
+  logs: LogMessage[]
+  count: number
+}
+
+export interface DeviceLogsResponse extends LogsResponse {
+  device_id: string
+}
+
+/** Filters for messageTemplates(); start and end are UTC dates (YYYY-MM-DD), both inclusive */
+export interface MessageTemplatesParams {
+  device_id?: string
+  log_type?: string[]
+  start?: string
+  end?: string
+  /** Templates per device and day, default 10 */
+  k?: number
+}
+
+/** How often a message template (values replaced by placeholders such as <num>) was logged */
+export interface TemplateCount {
+  log_type: string
+  template: string
+  count: number
+  /** The latest message with this template */
+  example: string
+  first_seen: string
+  last_seen: string
+}
+
+export interface MessageTemplatesResponse {
+  days: { day: string; device_id: string; templates: TemplateCount[] }[]
+  count: number
+  start: string
+  end: string
+}
+
+/**
+ * Error thrown for a non-2xx response; message, code, details and requestId come from the
+ * server's error envelope (code is e.g. "validation_failed", "not_found" or "ai_unavailable")
+ */
+export class ApiError extends Error {
+  constructor(
+    readonly status: number,
+    message: string,
+    readonly code: string = "",
+    readonly details?: unknown,
+    readonly requestId?: string,
+  ) {
+    super(message)
+    this.name = "ApiError"
+  }
+}
+
+/** Builds the ApiError of a failed response from its error envelope, or from its text */
+async function apiError(response: Response): Promise<ApiError> {
+  const text = (await response.text()).trim()
+  try {
+    const body = JSON.parse(text) as APIError
+    if (body && typeof body.code === "string") {
+      return new ApiError(response.status, body.message, body.code, body.details, body.request_id)
+    }
+  } catch {
+    // not an envelope, e.g. from a proxy
+  }
+  return new ApiError(response.status, text || response.statusText)
+}
+
+/** REST client for the Edge Insights server */
+export class EdgeInsightsClient {
+  private readonly baseUrl: string
+  private readonly headers: Record<string, string>
+  private readonly fetchImpl: typeof fetch
+
+  constructor(options: ClientOptions) {
+    this.baseUrl = options.baseUrl.replace(/\/+$/, "")
+    this.headers = options.headers ?? {}
+    this.fetchImpl = options.fetch ?? globalThis.fetch.bind(globalThis)
+  }
+
+  health(): Promise<{ status: string; service: string }> {
+    return this.request("GET", "/health")
+  }
+
+  /** Recent readings, newest first; metadata keeps readings whose metadata contains every key/value given */
+  logs(params: LogsParams = {}): Promise<LogsResponse> {
+    const query = new URLSearchParams()
+    if (params.limit !== undefined) query.set("limit", String(params.limit))
+    if (params.start) query.set("start", toRFC3339(params.start))
+    if (params.end) query.set("end", toRFC3339(params.end))
+    if (params.log_type?.length) query.set("log_type", params.log_type.join(","))
+    if (params.device_type) query.set("device_type", params.device_type)
+    if (params.location) query.set("location", params.location)
+    if (params.metadata) query.set("metadata", JSON.stringify(params.metadata))
+    return this.request("GET", withQuery("/api/logs", query))
+  }
+
+  deviceLogs(deviceId: string, params: { limit?: number } = {}): Promise<DeviceLogsResponse> {
+    const query = new URLSearchParams()
+    if (params.limit !== undefined) query.set("limit", String(params.limit))
+    return this.request("GET", withQuery(`/api/logs/device/${encodeURIComponent(deviceId)}`, query))
+  }
+
+  /** The most frequent message templates of each device per day, newest day first */
+  messageTemplates(params: MessageTemplatesParams = {}, options: RequestOptions = {}): Promise<MessageTemplatesResponse> {
+    const query = new URLSearchParams()
+    if (params.device_id) query.set("device_id", params.device_id)
+    if (params.log_type?.length) query.set("log_type", params.log_type.join(","))
+    if (params.start) query.set("start", params.start)
+    if (params.end) query.set("end", params.end)
+    if (params.k !== undefined) query.set("k", String(params.k))
+    return this.request("GET", withQuery("/api/logs/templates", query), undefined, options)
+  }
+
+  /**
+   * Uploads buffered readings in one request; rejected readings are listed in results by index.
+   * Throws ApiError (503) when the server is busy; nothing is stored then
+   */
+  ingest(readings: LogMessage[]): Promise<IngestResponse> {
+    return this.request("POST", "/api/ingest", readings)
+  }
+
+  /** Answers a natural-language question with semantic search or text-to-SQL, as the caller's role allows */
+  query(query: string, options: RequestOptions = {}): Promise<QueryResponse> {
+    return this.request("POST", "/api/ai/query", { query }, options)
+  }
+
+  /**
+   * Drafts the SQL for a data question, calling onToken with each piece as the model writes it.
+   * Resolves with the draft for review (nothing is executed); aborting options.signal or
+   * cancelRequest(options.requestId) stops the generation and rejects with ApiError 499
+   */
+  streamSQL(query: string, onToken: (text: string) => void, options: RequestOptions = {}): Promise<QueryResponse> {
+    return this.stream("/api/ai/sql/stream", { query }, (event, data) => {
+      if (event === "token") onToken(data.text)
+    }, options)
+  }
+
+  /**
+   * Answers a question like query(), calling onEvent with its progress while the answer is built:
+   * "route" {query_type}, "token" {text} for each piece of generated SQL, "sql" {sql, query_type,
+   * explanation} before the SQL runs and "results" {relevant_logs, related_knowledge, log_count}
+   * before a pattern search's answer is written. Resolves with the same response as query()
+   */
+  streamQuery(query: string, onEvent: (event: string, data: any) => void, options: RequestOptions = {}): Promise<QueryResponse> {
+    return this.stream("/api/ai/query", { query }, onEvent, options)
+  }
+
+  /** Finds logs similar to the text in meaning or keywords, optionally narrowed by filters */
+  search(searchText: string, limit?: number, options: RequestOptions = {}, filters: SearchFilters = {}): Promise<QueryResult<SearchResponse>> {
+    return this.request("POST", "/api/ai/search", { search_text: searchText, limit, ...filters }, options)
+  }
+
+  /**
+   * Summarises the logs of a range: a duration ending now ("1h", "7d", "P1DT12H"; default 1h) or an
+   * ISO 8601 interval ("2024-05-01T00:00:00Z/PT6H")
+   */
+  summarize(range?: string, options: RequestOptions = {}): Promise<QueryResult<SummaryResponse>> {
+    const query = new URLSearchParams()
+    if (range) query.set("range", range)
+    return this.request("POST", withQuery("/api/ai/summarize", query), undefined, options)
+  }
+
+  /** Detects anomalies in the readings of a range, written as for summarize (default 24h) */
+  anomalies(range?: string, options: RequestOptions = {}): Promise<QueryResult<AnomalyResponse>> {
+    const query = new URLSearchParams()
+    if (range) query.set("range", range)
+    return this.request("GET", withQuery("/api/ai/anomalies", query), undefined, options)
+  }
+
+  /** Cancels a running request started with requestId */
+  async cancelRequest(requestId: string): Promise<void> {
+    await this.request("POST", `/api/requests/${encodeURIComponent(requestId)}/cancel`)
+  }
+
+  /** Opens the read-only live feed (/ws/subscribe), narrowed by subscription */
+  feed(subscription: Subscription = {}, options: FeedOptions = {}): LiveFeed {
+    const url = this.baseUrl.replace(/^http/, "ws") + "/ws/subscribe"
+    return new LiveFeed(url, subscription, options)
+  }
+
+  /** Posts body and reads the Server-Sent Events of the response until "result", "error" or "cancelled" */
+  private async stream(path: string, body: unknown, onEvent: (event: string, data: any) => void, options: RequestOptions): Promise<QueryResponse> {
+    const headers: Record<string, string> = { ...this.headers, "Content-Type": "application/json", Accept: "text/event-stream" }
+    if (options.requestId) headers["X-Request-ID"] = options.requestId
+
+    const response = await this.fetchImpl(this.baseUrl + path, {
+      method: "POST",
+      headers,
+      body: JSON.stringify(body),
+      signal: options.signal,
+    })
+    if (!response.ok || !response.body) {
+      throw await apiError(response)
+    }
+
+    const reader = response.body.pipeThrough(new TextDecoderStream()).getReader()
+    let buffered = ""
+    for (;;) {
+      const { value, done } = await reader.read()
+      if (done) break
+      buffered += value
+      let end: number
+      while ((end = buffered.indexOf("\n\n")) >= 0) {
+        const block = buffered.slice(0, end)
+        buffered = buffered.slice(end + 2)
+        const event = /^event: (.*)$/m.exec(block)?.[1]
+        const data = JSON.parse(/^data: (.*)$/m.exec(block)?.[1] ?? "null")
+        switch (event) {
+          case "result":
+            return data as QueryResponse
+          case "error":
+            throw new ApiError(500, data.message, data.code, data.details, data.request_id)
+          case "cancelled":
+            throw new ApiError(499, "Request cancelled")
+          case undefined:
+            break
+          default:
+            onEvent(event, data)
+        }
+      }
+    }
+    throw new ApiError(499, "Request cancelled")
+  }
+
+  private async request<T>(method: string, path: string, body?: unknown, options: RequestOptions = {}): Promise<T> {
+    const headers: Record<string, string> = { ...this.headers }
+    if (body !== undefined) headers["Content-Type"] = "application/json"
+    if (options.requestId) headers["X-Request-ID"] = options.requestId
+
+    const response = await this.fetchImpl(this.baseUrl + path, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+      signal: options.signal,
+    })
+    if (!response.ok) {
+      throw await apiError(response)
+    }
+    if (response.status === 204) {
+      return undefined as T
+    }
+    return (await response.json()) as T
+  }
+}
+
+function toRFC3339(value: Date | string): string {
+  return value instanceof Date ? value.toISOString() : value
+}
+
+function withQuery(path: string, query: URLSearchParams): string {
+  const encoded = query.toString()
+  return encoded ? `${path}?${encoded}` : path
+}
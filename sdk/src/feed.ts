@@ -0,0 +1,133 @@
+import type { EventPayloads, FeedEvent, LogResponse, Subscription } from "./types.js"
+
+export interface FeedOptions {
+  /** Reconnect after the connection drops (default true), backing off from 1s to 30s */
+  reconnect?: boolean
+  /** WebSocket implementation; defaults to the global WebSocket (pass the ws package in Node < 22) */
+  WebSocket?: typeof WebSocket
+}
+
+type Handler<K extends keyof EventPayloads> = (data: EventPayloads[K], event: FeedEvent) => void
+type AnyHandler = (data: unknown, event: FeedEvent) => void
+
+/**
+ * A live-feed connection. Events are delivered to handlers registered with on(); event types
+ * the SDK does not know are ignored, so newer servers do not break older clients
+ */
+export class LiveFeed {
+  private socket?: WebSocket
+  private subscription: Subscription
+  private handlers = new Map<string, Set<AnyHandler>>()
+  private errorHandlers = new Set<(response: LogResponse) => void>()
+  private statusHandlers = new Set<(connected: boolean) => void>()
+  private closed = false
+  private backoff = 1000
+  private readonly reconnect: boolean
+  private readonly WebSocketImpl: typeof WebSocket
+
+  constructor(
+    private readonly url: string,
+    subscription: Subscription,
+    options: FeedOptions = {},
+  ) {
+    this.subscription = subscription
+    this.reconnect = options.reconnect ?? true
+    this.WebSocketImpl = options.WebSocket ?? globalThis.WebSocket
+    this.connect()
+  }
+
+  /** Registers a handler for one event type; returns a function that removes it */
+  on<K extends keyof EventPayloads>(type: K, handler: Handler<K>): () => void {
+    const set = this.handlers.get(type) ?? new Set<AnyHandler>()
+    this.handlers.set(type, set)
+    const stored = handler as AnyHandler
+    set.add(stored)
+    return () => {
+      set.delete(stored)
+    }
+  }
+
+  /** Registers a handler for error responses (e.g. UNSUPPORTED); returns a function that removes it */
+  onError(handler: (response: LogResponse) => void): () => void {
+    this.errorHandlers.add(handler)
+    return () => {
+      this.errorHandlers.delete(handler)
+    }
+  }
+
+  /** Registers a handler called when the connection opens (true) or drops (false) */
+  onStatus(handler: (connected: boolean) => void): () => void {
+    this.statusHandlers.add(handler)
+    return () => {
+      this.statusHandlers.delete(handler)
+    }
+  }
+
+  /** Replaces the subscription; it is kept across reconnects */
+  subscribe(subscription: Subscription): void {
+    this.subscription = subscription
+    this.send({ type: "subscribe", ...subscription })
+  }
+
+  /** Removes the subscription and receives the whole feed */
+  unsubscribe(): void {
+    this.subscription = {}
+    this.send({ type: "unsubscribe" })
+  }
+
+  close(): void {
+    this.closed = true
+    this.socket?.close()
+  }
+
+  private connect(): void {
+    const socket = new this.WebSocketImpl(this.url + subscriptionQuery(this.subscription))
+    this.socket = socket
+
+    socket.onopen = () => {
+      this.backoff = 1000
+      this.statusHandlers.forEach((handler) => handler(true))
+    }
+    socket.onmessage = (message) => this.dispatch(String(message.data))
+    socket.onclose = () => {
+      this.statusHandlers.forEach((handler) => handler(false))
+      if (this.closed || !this.reconnect) return
+      setTimeout(() => this.connect(), this.backoff)
+      this.backoff = Math.min(this.backoff * 2, 30000)
+    }
+  }
+
+  private dispatch(raw: string): void {
+    let parsed: unknown
+    try {
+      parsed = JSON.parse(raw)
+    } catch {
+      return
+    }
+    if (typeof parsed !== "object" || parsed === null) return
+
+    if ("success" in parsed) {
+      const response = parsed as LogResponse
+      if (!response.success) this.errorHandlers.forEach((handler) => handler(response))
+      return
+    }
+
+    const event = parsed as FeedEvent
+    this.handlers.get(event.type)?.forEach((handler) => handler(event.data, event))
+  }
+
+  private send(frame: object): void {
+    if (this.socket?.readyState === this.WebSocketImpl.OPEN) {
+      this.socket.send(JSON.stringify(frame))
+    }
+  }
+}
+
+function subscriptionQuery(subscription: Subscription): string {
+  const query = new URLSearchParams()
+  for (const [key, values] of Object.entries(subscription)) {
+    if (Array.isArray(values) && values.length > 0) query.set(key, values.join(","))
+  }
+  const encoded = query.toString()
+  return encoded ? `?${encoded}` : ""
+}
@@ -0,0 +1,363 @@
+// Code generated by go run ./cmd/tsgen from server/internal/types; DO NOT EDIT.
+
+/**
+ * EventVersion is the version of the live-feed envelope and payloads
+ * Fields may be added within a version; it is bumped only when a field is removed or changes meaning
+ */
+export const EventVersion = 1
+
+/** EventType identifies the payload carried by an Event */
+export type EventType = "log_entry" | "realtime_metrics" | "anomaly" | "alert" | "device_status" | "heartbeat" | "incident" | "subscribed" | "command" | "log_rollup"
+
+export const EventLogEntry: EventType = "log_entry" // Data is a LogMessage
+export const EventRealtimeMetrics: EventType = "realtime_metrics" // Data is the latest completed realtime bucket of every series
+export const EventAnomaly: EventType = "anomaly" // Data is an Anomaly
+export const EventAlert: EventType = "alert" // Data is an AlertEvent
+export const EventDeviceStatus: EventType = "device_status" // Data is a DeviceStatusEvent
+export const EventHeartbeat: EventType = "heartbeat" // Data is a HeartbeatEvent
+export const EventIncident: EventType = "incident" // Data is an IncidentEvent
+export const EventSubscribed: EventType = "subscribed" // Data is the Subscription now in effect, or null
+export const EventCommand: EventType = "command" // Data is a CommandEvent; sent only to the device it is for
+export const EventLogRollup: EventType = "log_rollup" // Data is a LogRollup; stands in for log entries while the feed is sampled
+
+/**
+ * Event is the envelope of everything pushed on the live feed; consumers switch on Type
+ * and should ignore types they do not know
+ */
+export interface Event {
+  type: EventType
+  version: number
+  /** when the server emitted the event */
+  time: string
+  data: unknown
+}
+
+/** AlertEvent reports an alert rule firing or resolving for a device */
+export interface AlertEvent {
+  /** subsystem that raised it, e.g. "vitals" */
+  source: string
+  rule: string
+  /** rule type within the source, e.g. "low_battery" */
+  kind: string
+  severity: string
+  device_id: string
+  device_type?: string
+  location?: string
+  message: string
+  value?: number
+  threshold?: number
+  since: string
+  /** set when the alert resolved */
+  resolved_at?: string
+}
+
+/**
+ * CommandEvent delivers a command to the device connection it is for
+ * The device answers with {"type": "command_status", "device_id": ..., "id": ..., "status": ...}:
+ * "acknowledged" on receipt, then "succeeded" or "failed" with an optional result or error
+ */
+export interface CommandEvent {
+  id: string
+  device_id: string
+  command: string
+  params?: Record<string, unknown>
+  expires_at: string
+}
+
+/** DeviceStatus values carried by DeviceStatusEvent */
+export const DeviceRegistered = "registered"
+export const DeviceUpdated = "updated"
+export const DeviceDecommissioned = "decommissioned"
+
+/** DeviceStatusEvent reports a change to a device's registration */
+export interface DeviceStatusEvent {
+  device_id: string
+  device_type?: string
+  location?: string
+  status: string
+  last_seen?: string
+}
+
+/** HeartbeatEvent is sent periodically so clients can detect a stalled connection */
+export interface HeartbeatEvent {
+  server_time: string
+  /** connected live-feed clients */
+  clients: number
+  /** "sample" or "rollup" while log entries are being thinned */
+  sampling?: string
+}
+
+/**
+ * LogRollup summarizes one second of a device's log entries of one type that the live feed did
+ * not forward one by one because it was busier than FEED_SAMPLE_THRESHOLD
+ */
+export interface LogRollup {
+  device_id: string
+  device_type: string
+  location: string
+  log_type: string
+  unit?: string
+  count: number
+  /** over the entries with a raw_value */
+  min?: number
+  max?: number
+  avg?: number
+  /** time of the first and the last entry */
+  start: string
+  end: string
+  /** of the last entry */
+  message: string
+}
+
+/** IncidentEvent reports an incident being opened or changed (a new signal, a status or a title) */
+export interface IncidentEvent {
+  id: string
+  title: string
+  /** open, investigating or resolved */
+  status: string
+  severity: string
+  device_ids: string[]
+  locations: string[]
+  signal_count: number
+  first_seen: string
+  last_seen: string
+  resolved_at?: string
+}
+
+/**
+ * LogMessage represents an IoT device log entry
+ * Update LogMessage struct
+ */
+export interface LogMessage {
+  time: string
+  device_id: string
+  device_type: string
+  location: string
+  /** Pointer so it can be nil */
+  raw_value?: number
+  unit?: string
+  log_type: string
+  message: string
+  /**
+   * IngestedAt is when the server received the reading (Time is the device-reported time)
+   * It is set by the server; values sent by devices are ignored
+   */
+  ingested_at?: string
+  /** Metadata holds device-specific extras (battery %, RSSI, firmware build) stored as JSONB */
+  metadata?: Record<string, unknown>
+}
+
+/**
+ * LogResponse represents the response after processing a log
+ * Code classifies failures; RetryAfterMs is set when the server is saturated and clients should
+ * wait that long before resending. Queued logs were accepted while the database was failing and
+ * are stored from the dead-letter queue later; they must not be resent. MsgID echoes the msg_id of
+ * the log acknowledged, and Duplicate marks a resent msg_id that was not stored again
+ */
+export interface LogResponse {
+  success: boolean
+  msg_id?: string
+  duplicate?: boolean
+  queued?: boolean
+  message: string
+  error?: string
+  code?: ErrorCode
+  /** every field problem when Code is VALIDATION_FAILED */
+  details?: FieldError[]
+  retry_after_ms?: number
+}
+
+/** FieldError is one problem with one field of a log message */
+export interface FieldError {
+  field: string
+  /** "required" or "invalid" */
+  code: string
+  message: string
+}
+
+/** IngestResult is the outcome of one reading in a POST /api/ingest batch, in request order */
+export interface IngestResult {
+  index: number
+  device_id?: string
+  success: boolean
+  /** accepted into the dead-letter queue, stored later */
+  queued?: boolean
+  error?: string
+  code?: ErrorCode
+  /** every field problem when Code is VALIDATION_FAILED */
+  details?: FieldError[]
+}
+
+/**
+ * IngestResponse reports a POST /api/ingest batch; the accepted readings were stored together
+ * (or, when Queued is set, queued together in the dead-letter queue to be stored later)
+ * RetryAfterMs is set when the server was saturated and nothing was stored
+ */
+export interface IngestResponse {
+  accepted: number
+  rejected: number
+  queued?: number
+  results: IngestResult[]
+  retry_after_ms?: number
+}
+
+/** ErrorCode tells device firmware why a log was not stored without parsing the error text */
+export type ErrorCode = "INVALID_JSON" | "VALIDATION_FAILED" | "RATE_LIMITED" | "UNAUTHORIZED" | "DEVICE_REJECTED" | "STORE_FAILED" | "UNSUPPORTED" | "UNKNOWN_COMMAND"
+
+export const CodeInvalidJSON: ErrorCode = "INVALID_JSON" // frame is not valid JSON; do not resend unchanged
+export const CodeValidationFailed: ErrorCode = "VALIDATION_FAILED" // required fields missing or invalid; do not resend unchanged
+export const CodeRateLimited: ErrorCode = "RATE_LIMITED" // server busy; resend after retry_after_ms
+export const CodeUnauthorized: ErrorCode = "UNAUTHORIZED" // API key missing, invalid, revoked or not valid for the device
+export const CodeDeviceRejected: ErrorCode = "DEVICE_REJECTED" // device unregistered or decommissioned
+export const CodeStoreFailed: ErrorCode = "STORE_FAILED" // storage error; resend with back-off
+export const CodeUnsupported: ErrorCode = "UNSUPPORTED" // frame not accepted on this endpoint (e.g. a log sent to /ws/subscribe)
+export const CodeUnknownCommand: ErrorCode = "UNKNOWN_COMMAND" // command_status for a command the device was not sent
+
+/** WebSocket close codes sent before the server closes a device connection (4000-4999 are application-defined) */
+export const CloseUnauthorized = 4001 // follows an UNAUTHORIZED response; reconnect only with a valid key
+
+/**
+ * APIError is the body of every failed HTTP API request. Code is a stable snake_case identifier
+ * to branch on (validation_failed, not_found, ai_unavailable...), Message is meant for people,
+ * Details carries structured context such as the field problems of a validation failure, and
+ * RequestID is the X-Request-ID of the request, to quote when reporting a problem
+ */
+export interface APIError {
+  code: string
+  message: string
+  details?: unknown
+  request_id?: string
+}
+
+/**
+ * Subscription narrows the live feed a dashboard connection receives
+ * Each list matches any of its values; empty lists match everything
+ */
+export interface Subscription {
+  device_id?: string[]
+  device_type?: string[]
+  location?: string[]
+  log_type?: string[]
+}
+
+/** QueryRequest represents a natural language query request */
+export interface QueryRequest {
+  query: string
+}
+
+/** QueryResponse represents the AI query response */
+export interface QueryResponse {
+  success: boolean
+  result: unknown
+  error?: string
+  /** set when the answer was limited by the caller's role */
+  notice?: string
+  query: string
+  time: string
+}
+
+/** SearchResult represents a single search result with distance score */
+export interface SearchResult {
+  embedding_uuid: string
+  time: string
+  device_id: string
+  device_type: string
+  location: string
+  log_type: string
+  chunk_seq: number
+  chunk: string
+  /** cosine distance of the embeddings */
+  distance: number
+  /** how well the message matches the search text's keywords, 0 to 1 */
+  keyword_score: number
+  /** the blend both are ranked by, SEARCH_KEYWORD_WEIGHT of it keywords */
+  score: number
+  raw_value?: number
+  unit?: string
+}
+
+export interface SearchResponse {
+  results: SearchResult[]
+  count: number
+  query: string
+  /** earlier conclusions similar to the query */
+  knowledge: KnowledgeResult[]
+}
+
+/**
+ * KnowledgeResult is an earlier conclusion found by semantic search: a scheduled summary, an
+ * incident's narrative and note, an anomaly explanation or a suggested remediation
+ */
+export interface KnowledgeResult {
+  /** summary, incident, anomaly or remediation */
+  kind: string
+  /** the summary, incident, incident signal or alert it came from */
+  source_id: string
+  time: string
+  device_ids: string[]
+  locations: string[]
+  title?: string
+  content: string
+  distance: number
+}
+
+export interface SummaryResponse {
+  summary: string
+  time_range: string
+  log_count: number
+  key_insights: string[]
+}
+
+/** AnomalyResponse represents detected anomalies */
+export interface AnomalyResponse {
+  anomalies: Anomaly[]
+  total_found: number
+  time_range: string
+}
+
+/** Anomaly represents a single detected anomaly */
+export interface Anomaly {
+  time: string
+  device_id: string
+  type: string
+  severity: string
+  message: string
+  confidence: number
+  context?: AlertContext
+}
+
+/** AlertContext is recent surrounding data attached to an alert or anomaly so responders can triage without querying */
+export interface AlertContext {
+  recent_readings: LogMessage[]
+  related_logs: LogMessage[]
+  aggregate_window: AggregateWindow
+}
+
+/** AggregateWindow points at the continuous-aggregate bucket covering an event */
+export interface AggregateWindow {
+  view: string
+  device_type: string
+  location: string
+  start: string
+  end: string
+  url: string
+}
+
+/** Type of each live-feed event's data */
+export interface EventPayloads {
+  log_entry: LogMessage
+  realtime_metrics: unknown
+  anomaly: Anomaly
+  alert: AlertEvent
+  device_status: DeviceStatusEvent
+  heartbeat: HeartbeatEvent
+  incident: IncidentEvent
+  subscribed: Subscription | null
+  command: CommandEvent
+  log_rollup: LogRollup
+}
+
+/** A live-feed event whose data is typed by its type */
+export type FeedEvent = {
+  [K in keyof EventPayloads]: Omit<Event, "type" | "data"> & { type: K; data: EventPayloads[K] }
+}[keyof EventPayloads]
@@ -123,9 +123,13 @@ VERSION: 1.0
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
 
 	"edge-insights/internal/db"
+	"edge-insights/internal/devicetypes"
+	"edge-insights/internal/logging"
 	"edge-insights/internal/ws"
 
 	"edge-insights/internal/ai"
@@ -135,48 +139,66 @@ import (
 
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+	envErr := godotenv.Load()
+
+	// Structured logging is configured from the environment, so it is set up after .env is loaded
+	logging.Setup()
+	if envErr != nil {
+		slog.Info("No .env file found, using environment variables")
+	}
+
+	// Device types beyond the built-in ones are described in DEVICE_TYPES_FILE
+	if err := devicetypes.LoadFile(os.Getenv("DEVICE_TYPES_FILE")); err != nil {
+		slog.Error("Failed to load device types", "error", err)
+		os.Exit(1)
 	}
 
 	// Load database configuration
 	config := db.LoadConfig()
 
 	// Connect to database
-	database, err := db.Connect(config)
+	database, pool, err := db.Connect(config)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
 	}
+	defer pool.Close()
 	defer database.Close()
+	go db.WatchPool(context.Background(), pool, config.Pool.HealthCheckPeriod)
 
 	// Run migrations
 	if err := db.RunMigrations(database); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+		slog.Error("Failed to run migrations", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Testing database connection...")
+	slog.Info("Testing database connection")
 	var count int
-	err = database.QueryRow("SELECT COUNT(*) FROM device_logs").Scan(&count)
+	err = database.QueryRow("SELECT COUNT(*) FROM sensor_readings").Scan(&count)
 	if err != nil {
-		log.Printf("Error querying device_logs table: %v", err)
+		slog.Warn("Error querying sensor_readings table", "error", err)
 	} else {
-		log.Printf("Current log count in database: %d", count)
+		slog.Info("Current reading count in database", "count", count)
 	}
 
-	// Test OpenAI embedding generation
-	log.Println("Testing OpenAI embedding generation...")
-	aiService := ai.NewAIService(database)
-	if err := aiService.TestEmbeddingGeneration(); err != nil {
-		log.Printf("OpenAI embedding test failed: %v", err)
-	} else {
-		log.Println("✅ OpenAI embedding generation test passed!")
+	// Test OpenAI embedding generation (a public demo never calls OpenAI)
+	if os.Getenv("DEMO_MODE") != "true" {
+		slog.Info("Testing OpenAI embedding generation")
+		aiService := ai.NewAIService(database)
+		if err := aiService.TestEmbeddingGeneration(); err != nil {
+			slog.Warn("OpenAI embedding test failed", "error", err)
+		} else {
+			slog.Info("OpenAI embedding generation test passed")
+		}
 	}
 
-	log.Println("Edge Insights server initialized successfully")
+	slog.Info("Edge Insights server initialized successfully")
 
 	// Start WebSocket server
 	server := ws.NewServer(database)
+	server.UsePool(pool)
 	if err := server.Start(); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,336 @@
+// TypeScript generator: writes the SDK's types.ts from the Go wire types in internal/types
+// Run with go generate ./internal/types (or npm run generate in sdk/); -check fails when the file is stale
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"edge-insights/internal/types"
+)
+
+func main() {
+	dir := flag.String("types", "internal/types", "directory of the Go package to translate")
+	out := flag.String("out", "../sdk/src/types.ts", "TypeScript file to write")
+	check := flag.Bool("check", false, "fail if the output file is out of date instead of writing it")
+	flag.Parse()
+
+	source, err := generate(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *check {
+		current, err := os.ReadFile(*out)
+		if err != nil || !bytes.Equal(current, source) {
+			log.Fatalf("%s is out of date; run go generate ./internal/types", *out)
+		}
+		return
+	}
+	if err := os.WriteFile(*out, source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate translates every exported type and constant of the package in dir, in source order
+func generate(dir string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, f)
+	}
+
+	g := &generator{enums: make(map[string][]string)}
+	for _, f := range parsed {
+		g.collectEnums(f)
+	}
+
+	g.printf("// Code generated by go run ./cmd/tsgen from server/internal/types; DO NOT EDIT.\n")
+	for _, f := range parsed {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			switch gen.Tok {
+			case token.TYPE:
+				for _, spec := range gen.Specs {
+					g.typeSpec(gen, spec.(*ast.TypeSpec))
+				}
+			case token.CONST:
+				g.constDecl(gen)
+			}
+		}
+	}
+	g.eventPayloads()
+	return g.buf.Bytes(), nil
+}
+
+type generator struct {
+	buf   bytes.Buffer
+	enums map[string][]string // string type name -> its constant values, in declaration order
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// collectEnums records the values of typed string constants so their type becomes a union
+func (g *generator) collectEnums(f *ast.File) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			typeName, ok := vs.Type.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			for _, value := range vs.Values {
+				if lit, ok := value.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					g.enums[typeName.Name] = append(g.enums[typeName.Name], lit.Value)
+				}
+			}
+		}
+	}
+}
+
+func (g *generator) typeSpec(gen *ast.GenDecl, spec *ast.TypeSpec) {
+	if !spec.Name.IsExported() {
+		return
+	}
+	doc := spec.Doc
+	if doc == nil && len(gen.Specs) == 1 {
+		doc = gen.Doc
+	}
+
+	g.printf("\n")
+	g.printf("%s", docComment("", doc))
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		g.structType(spec.Name.Name, t)
+	default:
+		if values, ok := g.enums[spec.Name.Name]; ok {
+			g.printf("export type %s = %s\n", spec.Name.Name, strings.Join(values, " | "))
+			return
+		}
+		g.printf("export type %s = %s\n", spec.Name.Name, tsType(spec.Type))
+	}
+}
+
+func (g *generator) structType(name string, st *ast.StructType) {
+	var extends []string
+	var fields bytes.Buffer
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			// Embedded structs are flattened by encoding/json
+			extends = append(extends, tsType(field.Type))
+			continue
+		}
+		jsonName, omitempty, skip := jsonTag(field)
+		if skip || !field.Names[0].IsExported() {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = field.Names[0].Name
+		}
+
+		fieldType := tsType(field.Type)
+		optional := ""
+		if omitempty {
+			optional = "?"
+		} else if _, pointer := field.Type.(*ast.StarExpr); pointer {
+			fieldType += " | null"
+		}
+
+		comment := field.Doc
+		if comment == nil {
+			comment = field.Comment
+		}
+		fields.WriteString(docComment("  ", comment))
+		fmt.Fprintf(&fields, "  %s%s: %s\n", jsonName, optional, fieldType)
+	}
+
+	header := "export interface " + name
+	if len(extends) > 0 {
+		header += " extends " + strings.Join(extends, ", ")
+	}
+	g.printf("%s {\n%s}\n", header, fields.String())
+}
+
+// constDecl writes exported constants; string constants of a named type keep that type
+func (g *generator) constDecl(gen *ast.GenDecl) {
+	var lines []string
+	for _, spec := range gen.Specs {
+		vs := spec.(*ast.ValueSpec)
+		for i, name := range vs.Names {
+			if !name.IsExported() || i >= len(vs.Values) {
+				continue
+			}
+			lit, ok := vs.Values[i].(*ast.BasicLit)
+			if !ok {
+				continue
+			}
+			annotation := ""
+			if typeName, ok := vs.Type.(*ast.Ident); ok {
+				annotation = ": " + typeName.Name
+			}
+			line := fmt.Sprintf("export const %s%s = %s", name.Name, annotation, lit.Value)
+			if vs.Comment != nil {
+				line += " // " + strings.TrimSpace(vs.Comment.Text())
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	g.printf("\n")
+	g.printf("%s", docComment("", gen.Doc))
+	g.printf("%s\n", strings.Join(lines, "\n"))
+}
+
+// eventPayloads types each live-feed event's data from types.EventPayloads
+func (g *generator) eventPayloads() {
+	var order []types.EventType
+	for _, value := range g.enums["EventType"] {
+		v, err := strconv.Unquote(value)
+		if err == nil {
+			order = append(order, types.EventType(v))
+		}
+	}
+
+	g.printf("\n/** Type of each live-feed event's data */\nexport interface EventPayloads {\n")
+	for _, eventType := range order {
+		payload, ok := types.EventPayloads[eventType]
+		if !ok {
+			continue
+		}
+		g.printf("  %s: %s\n", eventType, reflectType(reflect.TypeOf(payload)))
+	}
+	g.printf("}\n")
+	g.printf("\n/** A live-feed event whose data is typed by its type */\n" +
+		"export type FeedEvent = {\n" +
+		"  [K in keyof EventPayloads]: Omit<Event, \"type\" | \"data\"> & { type: K; data: EventPayloads[K] }\n" +
+		"}[keyof EventPayloads]\n")
+}
+
+// docComment turns a Go doc comment into a JSDoc comment
+func docComment(indent string, doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	text := strings.TrimSpace(doc.Text())
+	if text == "" {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) == 1 {
+		return indent + "/** " + lines[0] + " */\n"
+	}
+	var b strings.Builder
+	b.WriteString(indent + "/**\n")
+	for _, line := range lines {
+		b.WriteString(indent + " * " + line + "\n")
+	}
+	b.WriteString(indent + " */\n")
+	return b.String()
+}
+
+// jsonTag returns a field's JSON name, whether it is omitempty and whether it is skipped
+func jsonTag(field *ast.Field) (string, bool, bool) {
+	if field.Tag == nil {
+		return "", false, false
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return "", false, false
+	}
+	value, ok := reflect.StructTag(tag).Lookup("json")
+	if !ok {
+		return "", false, false
+	}
+	if value == "-" {
+		return "", false, true
+	}
+	name, options, _ := strings.Cut(value, ",")
+	return name, strings.Contains(","+options+",", ",omitempty,"), false
+}
+
+// tsType translates a Go type expression; times are RFC3339 strings
+func tsType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return "string"
+		case "bool":
+			return "boolean"
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "byte":
+			return "number"
+		case "any":
+			return "unknown"
+		}
+		return t.Name
+	case *ast.StarExpr:
+		return tsType(t.X)
+	case *ast.ArrayType:
+		elem := tsType(t.Elt)
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case *ast.MapType:
+		return "Record<string, " + tsType(t.Value) + ">"
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" {
+			switch t.Sel.Name {
+			case "Time":
+				return "string"
+			case "Duration":
+				return "number" // nanoseconds
+			}
+		}
+	}
+	return "unknown"
+}
+
+// reflectType names a payload type registered in types.EventPayloads
+func reflectType(t reflect.Type) string {
+	if t == nil {
+		return "unknown"
+	}
+	if t.Kind() == reflect.Pointer {
+		return reflectType(t.Elem()) + " | null"
+	}
+	if t.PkgPath() == reflect.TypeOf(types.Event{}).PkgPath() && t.Name() != "" {
+		return t.Name()
+	}
+	return "unknown"
+}
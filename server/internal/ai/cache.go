@@ -0,0 +1,116 @@
+package ai
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EmbeddingCache is an LRU of query embeddings keyed by model and normalized text,
+// so repeated dashboard searches do not call the embeddings API again
+type EmbeddingCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type cacheEntry struct {
+	key       string
+	embedding []float64
+	stored    time.Time
+}
+
+// EmbeddingCacheStats reports the cache counters since startup
+type EmbeddingCacheStats struct {
+	Size      int     `json:"size"`
+	Capacity  int     `json:"capacity"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+// NewEmbeddingCache creates a cache of EMBEDDING_CACHE_SIZE entries (default 1000) that expire after
+// EMBEDDING_CACHE_TTL (default 24h)
+func NewEmbeddingCache() *EmbeddingCache {
+	return &EmbeddingCache{
+		size:    envInt("EMBEDDING_CACHE_SIZE", 1000),
+		ttl:     envDuration("EMBEDDING_CACHE_TTL", 24*time.Hour),
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached embedding of text for model and counts the hit or miss
+// The slice is shared; callers must not modify it
+func (c *EmbeddingCache) Get(model, text string) ([]float64, bool) {
+	key := cacheKey(model, text)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok && time.Since(element.Value.(*cacheEntry).stored) > c.ttl {
+		c.removeLocked(element)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).embedding, true
+}
+
+// Put stores the embedding of text for model, evicting the least recently used entry when full
+func (c *EmbeddingCache) Put(model, text string, embedding []float64) {
+	key := cacheKey(model, text)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.embedding, entry.stored = embedding, time.Now()
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, embedding: embedding, stored: time.Now()})
+	for c.order.Len() > c.size {
+		c.removeLocked(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Stats returns the cache counters
+func (c *EmbeddingCache) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := EmbeddingCacheStats{
+		Size:      c.order.Len(),
+		Capacity:  c.size,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+func (c *EmbeddingCache) removeLocked(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+// cacheKey normalizes text so queries differing only in case or spacing share an entry
+func cacheKey(model, text string) string {
+	return model + "\x00" + strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
@@ -0,0 +1,34 @@
+package ai
+
+import "edge-insights/internal/roles"
+
+// Capability is an AI feature that can be granted to a role
+type Capability string
+
+const (
+	CapabilitySummary Capability = "summary"         // summaries and anomaly reports
+	CapabilitySearch  Capability = "semantic_search" // vector search over log embeddings
+	CapabilitySQL     Capability = "text_to_sql"     // executing generated SQL
+)
+
+// roleCapabilities grants each role its AI features; higher roles include the lower ones
+var roleCapabilities = map[roles.Role][]Capability{
+	roles.Viewer:   {CapabilitySummary},
+	roles.Operator: {CapabilitySummary, CapabilitySearch},
+	roles.Admin:    {CapabilitySummary, CapabilitySearch, CapabilitySQL},
+}
+
+// Capabilities returns the AI features available to a role
+func Capabilities(role roles.Role) []Capability {
+	return roleCapabilities[role]
+}
+
+// Allowed reports whether a role may use an AI feature
+func Allowed(role roles.Role, capability Capability) bool {
+	for _, c := range roleCapabilities[role] {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
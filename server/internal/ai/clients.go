@@ -0,0 +1,48 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	apperrors "edge-insights/internal/errors"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ChatClient is the subset of the OpenAI client used for chat completions
+// *openai.Client satisfies it for every LLMProvider; tests inject fakes from internal/testutil
+type ChatClient interface {
+	CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// ChatStreamClient is a ChatClient that can also stream completions token by token
+// *openai.Client satisfies it; clients without it answer streamed requests in one piece
+type ChatStreamClient interface {
+	CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error)
+}
+
+// EmbeddingClient is the subset of the OpenAI client used to create embeddings
+type EmbeddingClient interface {
+	CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+}
+
+// errNoChatClient is returned by the features that need a chat model when none is configured
+var errNoChatClient = apperrors.Mark(errors.New("no chat client configured"), apperrors.ErrAIUnavailable)
+
+// providerError describes a failed provider request as ErrRateLimited when the API throttled it and
+// ErrAIUnavailable otherwise; a request cancelled by the caller is only described
+func providerError(message string, err error) error {
+	wrapped := fmt.Errorf("%s: %w", message, err)
+	if errors.Is(err, context.Canceled) {
+		return wrapped
+	}
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	if (errors.As(err, &apiErr) && apiErr.HTTPStatusCode == http.StatusTooManyRequests) ||
+		(errors.As(err, &reqErr) && reqErr.HTTPStatusCode == http.StatusTooManyRequests) {
+		return apperrors.Mark(wrapped, apperrors.ErrRateLimited)
+	}
+	return apperrors.Mark(wrapped, apperrors.ErrAIUnavailable)
+}
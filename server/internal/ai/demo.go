@@ -0,0 +1,182 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+var (
+	// ErrDemoQuestion is returned in demo mode for questions without a prepared answer
+	ErrDemoQuestion = errors.New("the demo only answers its example questions")
+	// ErrDemoUnavailable is returned in demo mode by features that would call OpenAI
+	ErrDemoUnavailable = errors.New("not available in the demo")
+)
+
+// DemoAnswer is a question a public demo answers without calling OpenAI: its SQL was written
+// ahead of time and runs against the demo's simulated readings, so the figures are live
+type DemoAnswer struct {
+	Question    string `json:"question"`
+	SQL         string `json:"sql"`
+	Explanation string `json:"explanation"`
+}
+
+// DefaultDemoAnswers fit the simulator's default fleet (see simdevice.DefaultProfiles)
+var DefaultDemoAnswers = []DemoAnswer{
+	{
+		Question: "What is the average temperature by location over the last 24 hours?",
+		SQL: `SELECT location, round(avg(raw_value)::numeric, 2) AS avg_temperature, count(*) AS readings
+FROM sensor_readings
+WHERE device_type = 'temperature_sensor' AND time > NOW() - INTERVAL '24 hours'
+GROUP BY location
+ORDER BY avg_temperature DESC`,
+		Explanation: "Averages the temperature sensor readings of the last 24 hours per location, warmest first.",
+	},
+	{
+		Question: "How many errors did each device log in the last hour?",
+		SQL: `SELECT device_id, device_type, location, count(*) AS errors
+FROM sensor_readings
+WHERE log_type = 'ERROR' AND time > NOW() - INTERVAL '1 hour'
+GROUP BY device_id, device_type, location
+ORDER BY errors DESC`,
+		Explanation: "Counts the ERROR logs of the last hour per device, noisiest first.",
+	},
+	{
+		Question: "What is the hourly error rate over the last day?",
+		SQL: `SELECT time_bucket('1 hour', time) AS hour,
+       count(*) FILTER (WHERE log_type = 'ERROR') AS errors,
+       count(*) AS readings,
+       round(100.0 * count(*) FILTER (WHERE log_type = 'ERROR') / count(*), 2) AS error_rate_percent
+FROM sensor_readings
+WHERE time > NOW() - INTERVAL '24 hours'
+GROUP BY hour
+ORDER BY hour`,
+		Explanation: "Buckets the last 24 hours by hour and gives the share of readings logged as ERROR in each.",
+	},
+	{
+		Question: "Show the highest humidity readings today",
+		SQL: `SELECT time, device_id, location, raw_value AS humidity
+FROM sensor_readings
+WHERE device_type = 'humidity_sensor' AND time >= date_trunc('day', NOW())
+ORDER BY raw_value DESC
+LIMIT 10`,
+		Explanation: "Lists the 10 highest humidity readings since midnight (UTC).",
+	},
+	{
+		Question: "Which devices have not reported in the last 10 minutes?",
+		SQL: `SELECT device_id, device_type, location, max(time) AS last_seen
+FROM sensor_readings
+WHERE time > NOW() - INTERVAL '24 hours'
+GROUP BY device_id, device_type, location
+HAVING max(time) < NOW() - INTERVAL '10 minutes'
+ORDER BY last_seen`,
+		Explanation: "Finds the devices seen in the last day whose latest reading is more than 10 minutes old.",
+	},
+	{
+		Question: "How many readings of each log type were stored in the last 24 hours?",
+		SQL: `SELECT log_type, count(*) AS readings
+FROM sensor_readings
+WHERE time > NOW() - INTERVAL '24 hours'
+GROUP BY log_type
+ORDER BY readings DESC`,
+		Explanation: "Counts the readings of the last 24 hours by log level.",
+	},
+}
+
+// LoadDemoAnswers reads the demo answers from the JSON array in the file at DEMO_AI_ANSWERS, or
+// returns DefaultDemoAnswers when it is not set
+func LoadDemoAnswers() ([]DemoAnswer, error) {
+	path := os.Getenv("DEMO_AI_ANSWERS")
+	if path == "" {
+		return DefaultDemoAnswers, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var answers []DemoAnswer
+	if err := json.Unmarshal(data, &answers); err != nil {
+		return nil, fmt.Errorf("invalid DEMO_AI_ANSWERS: %w", err)
+	}
+	for i, a := range answers {
+		if strings.TrimSpace(a.Question) == "" || strings.TrimSpace(a.SQL) == "" {
+			return nil, fmt.Errorf("DEMO_AI_ANSWERS[%d]: question and sql are required", i)
+		}
+	}
+	return answers, nil
+}
+
+// NewDemoAIService creates an AI service that never calls OpenAI, for a public demo: data
+// questions are answered from answers, summaries from the counts, anomaly detection is statistical
+// only and semantic search is unavailable
+func NewDemoAIService(db *sql.DB, answers []DemoAnswer) *AIService {
+	s := NewAIServiceWithClients(db, NewTextToSQLServiceWithClient(db, nil), nil)
+	s.demo = make(map[string]DemoAnswer, len(answers))
+	for _, a := range answers {
+		s.demo[demoKey(a.Question)] = a
+		s.demoQuestions = append(s.demoQuestions, a.Question)
+	}
+	return s
+}
+
+// DemoQuestions returns the questions a demo service answers, or nil outside demo mode
+func (s *AIService) DemoQuestions() []string {
+	return s.demoQuestions
+}
+
+// demoKey normalizes a question so case, spacing and a trailing question mark do not matter
+func demoKey(question string) string {
+	return strings.TrimRight(strings.Join(strings.Fields(strings.ToLower(question)), " "), "?. ")
+}
+
+// demoAnswer runs the prepared SQL of a demo question through the same guardrails and read-only
+// transaction as approved SQL
+func (s *AIService) demoAnswer(ctx context.Context, query string) (*types.QueryResponse, error) {
+	answer, ok := s.demo[demoKey(query)]
+	if !ok {
+		return nil, ErrDemoQuestion
+	}
+	response, err := s.textToSQL.ExecuteApproved(ctx, query, answer.SQL, false)
+	if err != nil {
+		return nil, err
+	}
+	if result, ok := response.Result.(SQLQueryResponse); ok {
+		result.Explanation = answer.Explanation
+		response.Result = result
+	}
+	response.Notice = "Demo: the SQL for this question was prepared ahead of time"
+	return response, nil
+}
+
+// demoDraft returns the prepared SQL of a demo question unexecuted, as StreamSQL does
+func (s *AIService) demoDraft(query string, onToken func(string) error) (*types.QueryResponse, error) {
+	answer, ok := s.demo[demoKey(query)]
+	if !ok {
+		return nil, ErrDemoQuestion
+	}
+	if onToken != nil {
+		if err := onToken(answer.SQL); err != nil {
+			return nil, err
+		}
+	}
+	return &types.QueryResponse{
+		Success: true,
+		Result: SQLQueryResponse{
+			SQL:              answer.SQL,
+			Result:           []interface{}{},
+			QueryType:        s.textToSQL.determineQueryType(answer.SQL),
+			Explanation:      answer.Explanation,
+			RequiresApproval: true,
+		},
+		Query:  query,
+		Time:   time.Now(),
+		Notice: "Demo: the SQL for this question was prepared ahead of time",
+	}, nil
+}
@@ -0,0 +1,269 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"edge-insights/internal/types"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/sashabaranov/go-openai"
+)
+
+// embeddingModel is the model behind both stored and query embeddings; they must match to be comparable
+const embeddingModel = openai.SmallEmbedding3
+
+// EmbeddingWriter embeds stored readings in the background and writes them to sensor_readings_embeddings,
+// which semantic search reads. Readings are queued without blocking ingestion and sent to the
+// embeddings API in batches; when the queue is full readings are dropped and picked up by the next backfill
+type EmbeddingWriter struct {
+	db        *sql.DB
+	client    EmbeddingClient
+	queue     chan types.LogMessage
+	batchSize int
+	interval  time.Duration
+	retries   int
+	startOnce sync.Once
+
+	written atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+	batches atomic.Int64
+}
+
+// EmbeddingStats reports the pipeline's progress since startup
+type EmbeddingStats struct {
+	Queued  int   `json:"queued"`
+	Written int64 `json:"written"`
+	Dropped int64 `json:"dropped"` // queue full; embedded by the next backfill
+	Failed  int64 `json:"failed"`  // the API or the insert failed after retries
+	Batches int64 `json:"batches"`
+}
+
+// NewEmbeddingWriter creates a writer configured by EMBEDDING_QUEUE_SIZE (default 10000),
+// EMBEDDING_BATCH_SIZE (default 100) and EMBEDDING_FLUSH_INTERVAL (default 2s)
+func NewEmbeddingWriter(db *sql.DB, client EmbeddingClient) *EmbeddingWriter {
+	return &EmbeddingWriter{
+		db:        db,
+		client:    client,
+		queue:     make(chan types.LogMessage, envInt("EMBEDDING_QUEUE_SIZE", 10000)),
+		batchSize: envInt("EMBEDDING_BATCH_SIZE", 100),
+		interval:  envDuration("EMBEDDING_FLUSH_INTERVAL", 2*time.Second),
+		retries:   3,
+	}
+}
+
+// Enqueue queues a stored reading for embedding; it never blocks
+// Readings without a message have nothing to search and are skipped
+func (w *EmbeddingWriter) Enqueue(msg types.LogMessage) {
+	if strings.TrimSpace(msg.Message) == "" {
+		return
+	}
+	select {
+	case w.queue <- msg:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// Stats returns the pipeline counters
+func (w *EmbeddingWriter) Stats() EmbeddingStats {
+	return EmbeddingStats{
+		Queued:  len(w.queue),
+		Written: w.written.Load(),
+		Dropped: w.dropped.Load(),
+		Failed:  w.failed.Load(),
+		Batches: w.batches.Load(),
+	}
+}
+
+// Start runs the batching worker, after queueing the readings of the last backfill window
+// that have no embedding yet (those stored while the server was down or dropped from the queue)
+func (w *EmbeddingWriter) Start(backfill time.Duration) {
+	w.startOnce.Do(func() {
+		go w.run()
+		if backfill > 0 {
+			go func() {
+				n, err := w.Backfill(context.Background(), time.Now().Add(-backfill))
+				if err != nil {
+					slog.Error("Embedding backfill failed", "error", err)
+					return
+				}
+				slog.Info("Embedding backfill queued", "readings", n)
+			}()
+		}
+	})
+}
+
+// Backfill queues readings stored since the given time that have no embedding, blocking while the queue is full
+func (w *EmbeddingWriter) Backfill(ctx context.Context, since time.Time) (int, error) {
+	rows, err := w.db.QueryContext(ctx, `
+        SELECT r.time, r.device_id, r.device_type, COALESCE(r.location, ''), r.raw_value,
+               COALESCE(r.unit, ''), r.log_type, r.message
+        FROM sensor_readings r
+        WHERE r.time >= $1 AND COALESCE(r.message, '') <> ''
+          AND NOT EXISTS (
+              SELECT 1 FROM sensor_readings_embeddings e
+              WHERE e.time = r.time AND e.device_id = r.device_id
+          )
+        ORDER BY r.time
+    `, since)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var msg types.LogMessage
+		if err := rows.Scan(&msg.Time, &msg.DeviceID, &msg.DeviceType, &msg.Location, &msg.RawValue,
+			&msg.Unit, &msg.LogType, &msg.Message); err != nil {
+			return n, err
+		}
+		select {
+		case w.queue <- msg:
+			n++
+		case <-ctx.Done():
+			return n, ctx.Err()
+		}
+	}
+	return n, rows.Err()
+}
+
+// run collects readings into batches, flushing when a batch is full or the interval passes
+func (w *EmbeddingWriter) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]types.LogMessage, 0, w.batchSize)
+	for {
+		select {
+		case msg := <-w.queue:
+			batch = append(batch, msg)
+			if len(batch) < w.batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		w.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush embeds one batch and writes it, retrying with backoff when the API or database fails
+func (w *EmbeddingWriter) flush(batch []types.LogMessage) {
+	w.batches.Add(1)
+	var err error
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err = w.write(context.Background(), batch); err == nil {
+			w.written.Add(int64(len(batch)))
+			return
+		}
+	}
+	w.failed.Add(int64(len(batch)))
+	slog.Error("Failed to write reading embeddings", "readings", len(batch), "error", err)
+}
+
+// write sends the batch to the embeddings API in one request and inserts the vectors
+// Identical texts (common for repeated status messages) are sent once
+func (w *EmbeddingWriter) write(ctx context.Context, batch []types.LogMessage) error {
+	var inputs []string
+	index := make(map[string]int)
+	positions := make([]int, len(batch))
+	for i, msg := range batch {
+		text := embeddingText(msg)
+		pos, ok := index[text]
+		if !ok {
+			pos = len(inputs)
+			index[text] = pos
+			inputs = append(inputs, text)
+		}
+		positions[i] = pos
+	}
+
+	resp, err := w.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: inputs,
+		Model: embeddingModel,
+	})
+	if err != nil {
+		return providerError("failed to create embeddings", err)
+	}
+	if len(resp.Data) != len(inputs) {
+		return fmt.Errorf("embeddings API returned %d vectors for %d inputs", len(resp.Data), len(inputs))
+	}
+	vectors := make([]pgvector.Vector, len(inputs))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(inputs) {
+			return fmt.Errorf("embeddings API returned index %d for %d inputs", d.Index, len(inputs))
+		}
+		vectors[d.Index] = pgvector.NewVector(d.Embedding)
+	}
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+        INSERT INTO sensor_readings_embeddings (time, device_id, device_type, location, raw_value, unit, log_type, message, model, embedding)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        ON CONFLICT (time, device_id) DO NOTHING
+    `)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, msg := range batch {
+		if _, err := stmt.ExecContext(ctx, msg.Time, msg.DeviceID, msg.DeviceType, msg.Location, msg.RawValue,
+			msg.Unit, msg.LogType, msg.Message, string(embeddingModel), vectors[positions[i]]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// embeddingText is what gets embedded for a reading: its message with the context a search might name
+// e.g. "ERROR temperature freezer-1 (kitchen): Compressor failure"
+func embeddingText(msg types.LogMessage) string {
+	var b strings.Builder
+	b.WriteString(msg.LogType)
+	if msg.DeviceType != "" {
+		b.WriteString(" " + msg.DeviceType)
+	}
+	b.WriteString(" " + msg.DeviceID)
+	if msg.Location != "" {
+		b.WriteString(" (" + msg.Location + ")")
+	}
+	b.WriteString(": " + msg.Message)
+	return b.String()
+}
+
+func envInt(key string, defaultValue int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return defaultValue
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return defaultValue
+}
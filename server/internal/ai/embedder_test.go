@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/testutil"
+	"edge-insights/internal/types"
+)
+
+func TestEmbeddingWriter(t *testing.T) {
+	database := testutil.NewTimescaleDB(t)
+	embedder := testutil.NewFakeEmbedder(1536)
+	w := NewEmbeddingWriter(database, embedder)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	readings := []types.LogMessage{
+		{Time: now.Add(-2 * time.Minute), DeviceID: "pump-1", DeviceType: "pump", Location: "plant_a", LogType: "ERROR", Message: "Bearing overheating"},
+		{Time: now.Add(-time.Minute), DeviceID: "pump-1", DeviceType: "pump", Location: "plant_a", LogType: "ERROR", Message: "Bearing overheating"},
+		{Time: now, DeviceID: "pump-2", DeviceType: "pump", Location: "plant_a", LogType: "INFO", Message: "Started"},
+		{Time: now, DeviceID: "pump-3", DeviceType: "pump", Location: "plant_a", LogType: "INFO"},
+	}
+	for _, r := range readings {
+		if err := db.StoreSensorReading(database, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Readings without a message are not embedded
+	ctx := context.Background()
+	n, err := w.Backfill(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("backfill queued %d readings, want 3", n)
+	}
+	batch := make([]types.LogMessage, 0, n)
+	for range n {
+		batch = append(batch, <-w.queue)
+	}
+	if err := w.write(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Identical texts are embedded once
+	if len(embedder.Inputs) != 2 {
+		t.Errorf("embedded %d texts, want 2: %q", len(embedder.Inputs), embedder.Inputs)
+	}
+	var stored int
+	if err := database.QueryRow(`SELECT count(*) FROM sensor_readings_embeddings`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 3 {
+		t.Errorf("stored %d embeddings, want 3", stored)
+	}
+
+	// Embedded readings are not queued again
+	if n, err := w.Backfill(ctx, now.Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("second backfill queued %d readings (%v), want 0", n, err)
+	}
+}
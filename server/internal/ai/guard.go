@@ -0,0 +1,75 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// PlanEstimate is the planner's estimate for a query, taken from EXPLAIN
+type PlanEstimate struct {
+	Cost float64 `json:"cost"` // total cost of the top plan node, in planner units
+	Rows float64 `json:"rows"` // rows the query is expected to return
+}
+
+// CostGuard stops generated SQL whose plan is too expensive or returns too many rows
+// In confirm mode the caller can re-submit the SQL with confirmation; in reject mode it never runs
+type CostGuard struct {
+	MaxCost float64
+	MaxRows float64
+	Reject  bool
+}
+
+// LoadCostGuard reads AI_SQL_MAX_COST, AI_SQL_MAX_ROWS and AI_SQL_GUARD_MODE (confirm or reject)
+func LoadCostGuard() CostGuard {
+	return CostGuard{
+		MaxCost: envFloat("AI_SQL_MAX_COST", 1000000),
+		MaxRows: envFloat("AI_SQL_MAX_ROWS", 10000),
+		Reject:  os.Getenv("AI_SQL_GUARD_MODE") == "reject",
+	}
+}
+
+func envFloat(key string, defaultValue float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultValue
+}
+
+// Exceeded returns why an estimate is over the limits, or "" if it is within them
+func (g CostGuard) Exceeded(est PlanEstimate) string {
+	if g.MaxCost > 0 && est.Cost > g.MaxCost {
+		return fmt.Sprintf("estimated cost %.0f exceeds the limit of %.0f", est.Cost, g.MaxCost)
+	}
+	if g.MaxRows > 0 && est.Rows > g.MaxRows {
+		return fmt.Sprintf("estimated %.0f rows exceeds the limit of %.0f", est.Rows, g.MaxRows)
+	}
+	return ""
+}
+
+// rowQuerier is satisfied by *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// explain asks the planner for a query's estimate without running it
+func explain(ctx context.Context, db rowQuerier, sqlQuery string) (*PlanEstimate, error) {
+	var raw []byte
+	if err := db.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+sqlQuery).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("EXPLAIN failed: %w", err)
+	}
+
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+			PlanRows  float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plans); err != nil || len(plans) == 0 {
+		return nil, fmt.Errorf("unexpected EXPLAIN output")
+	}
+	return &PlanEstimate{Cost: plans[0].Plan.TotalCost, Rows: plans[0].Plan.PlanRows}, nil
+}
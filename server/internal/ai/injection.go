@@ -0,0 +1,131 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	apperrors "edge-insights/internal/errors"
+)
+
+// ErrPromptInjection is returned for questions refused by AI_INJECTION_GUARD=reject
+var ErrPromptInjection = apperrors.Mark(errors.New("the question looks like an attempt to override the assistant's instructions"), apperrors.ErrValidation)
+
+// injectionPatterns match text that tries to talk to the model instead of describing data:
+// instruction overrides, role changes, fake chat markup and requests for the prompt itself
+var injectionPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"override", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override|bypass)\b[^.\n]{0,40}\b(previous|prior|above|earlier|all|any|your|the|system)\b[^.\n]{0,20}\b(instructions?|prompts?|rules?|guidelines|context|messages?)`)},
+	{"new_instructions", regexp.MustCompile(`(?i)\b(new|updated|real|actual)\s+(instructions?|system\s+prompt|rules)\s*[:-]`)},
+	{"role_change", regexp.MustCompile(`(?i)\b(you\s+are\s+now|from\s+now\s+on\s+you|act\s+as\s+(an?\s+)?(unrestricted|different|new)|pretend\s+(to\s+be|you\s+are)|developer\s+mode|jailbreak|\bDAN\b)`)},
+	{"chat_markup", regexp.MustCompile(`(?im)(<\|?/?\s*(system|assistant|user|im_start|im_end)\s*\|?>|\[/?(INST|SYS)\]|^\s*#{2,}\s*(system|instruction)s?\b|^\s*(system|assistant)\s*:)`)},
+	{"prompt_leak", regexp.MustCompile(`(?i)\b(reveal|print|show|repeat|output|leak)\b[^.\n]{0,30}\b(system\s+prompt|your\s+(instructions|prompt|rules))`)},
+}
+
+// InjectionGuard screens text from users and devices before it is put in a prompt
+// Log messages, device IDs and locations come from devices, so anyone who controls a device can
+// write text that ends up in front of the model
+type InjectionGuard struct {
+	// Mode is off, neutralize (default: suspicious spans are replaced and logged) or reject
+	// (questions are also refused; device text can only be neutralized)
+	Mode string
+}
+
+// LoadInjectionGuard reads AI_INJECTION_GUARD
+func LoadInjectionGuard() InjectionGuard {
+	switch mode := strings.ToLower(os.Getenv("AI_INJECTION_GUARD")); mode {
+	case "off", "reject":
+		return InjectionGuard{Mode: mode}
+	case "", "neutralize":
+	default:
+		slog.Warn("Invalid AI_INJECTION_GUARD, using neutralize", "value", mode)
+	}
+	return InjectionGuard{Mode: "neutralize"}
+}
+
+var injectionGuard = sync.OnceValue(LoadInjectionGuard)
+
+// Scan returns the names of the patterns text matches
+func (g InjectionGuard) Scan(text string) []string {
+	var matched []string
+	for _, p := range injectionPatterns {
+		if p.re.MatchString(text) {
+			matched = append(matched, p.name)
+		}
+	}
+	return matched
+}
+
+// neutralize replaces every suspicious span with a marker the model sees as plain data
+func neutralize(text string) string {
+	for _, p := range injectionPatterns {
+		text = p.re.ReplaceAllString(text, "[filtered]")
+	}
+	return text
+}
+
+// screenQuestion checks a user's question before it is put in a prompt; source names where it
+// is used for the log. It returns the text to use, or ErrPromptInjection in reject mode
+func screenQuestion(ctx context.Context, source, text string) (string, error) {
+	guard := injectionGuard()
+	if guard.Mode == "off" {
+		return text, nil
+	}
+	matched := guard.Scan(text)
+	if len(matched) == 0 {
+		return text, nil
+	}
+	slog.WarnContext(ctx, "Possible prompt injection in question", "source", source, "patterns", matched,
+		"excerpt", excerpt(text), "action", guard.Mode)
+	if guard.Mode == "reject" {
+		return "", ErrPromptInjection
+	}
+	return neutralize(text), nil
+}
+
+// screenData neutralizes and logs suspicious spans in device-supplied text (log messages, device
+// IDs, locations) before it is quoted in a prompt
+func screenData(ctx context.Context, source, text string) string {
+	guard := injectionGuard()
+	if guard.Mode == "off" {
+		return text
+	}
+	matched := guard.Scan(text)
+	if len(matched) == 0 {
+		return text
+	}
+	slog.WarnContext(ctx, "Possible prompt injection in device data", "source", source, "patterns", matched,
+		"excerpt", excerpt(text))
+	return neutralize(text)
+}
+
+// singleLine flattens line breaks and control characters so a quoted field cannot start prompt
+// lines of its own (e.g. a fake "Signals:" section)
+func singleLine(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// promptField screens a device-supplied field and keeps it to one line
+func promptField(ctx context.Context, source, text string) string {
+	return singleLine(screenData(ctx, source, text))
+}
+
+// excerpt shortens text for logs
+func excerpt(text string) string {
+	if runes := []rune(text); len(runes) > 200 {
+		return string(runes[:200]) + "..."
+	}
+	return text
+}
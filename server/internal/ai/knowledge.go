@@ -0,0 +1,374 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"edge-insights/internal/types"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Kinds of knowledge entries
+const (
+	KnowledgeSummary     = "summary"
+	KnowledgeIncident    = "incident"
+	KnowledgeAnomaly     = "anomaly"
+	KnowledgeRemediation = "remediation"
+)
+
+// KnowledgeEntry is a conclusion worth finding again: what a summary, an incident or an anomaly
+// said the last time something similar happened
+type KnowledgeEntry struct {
+	Kind      string
+	SourceID  string // unique per kind; a newer text for the same source replaces the old one
+	Time      time.Time
+	DeviceIDs []string
+	Locations []string
+	Title     string
+	Content   string
+}
+
+// KnowledgeWriter embeds knowledge entries in the background and writes them to ai_knowledge, which
+// semantic search reads alongside the readings. Entries are few (a summary per schedule run, an
+// incident description per few signals), so they are embedded one at a time; when the queue is
+// full they are dropped and picked up by the next backfill
+type KnowledgeWriter struct {
+	db        *sql.DB
+	client    EmbeddingClient
+	queue     chan KnowledgeEntry
+	retries   int
+	startOnce sync.Once
+
+	written   atomic.Int64
+	unchanged atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+}
+
+// KnowledgeStats reports the knowledge writer's progress since startup
+type KnowledgeStats struct {
+	Queued    int   `json:"queued"`
+	Written   int64 `json:"written"`
+	Unchanged int64 `json:"unchanged"` // already embedded with the same content
+	Dropped   int64 `json:"dropped"`   // queue full; embedded by the next backfill
+	Failed    int64 `json:"failed"`    // the API or the insert failed after retries
+}
+
+// NewKnowledgeWriter creates a writer configured by KNOWLEDGE_QUEUE_SIZE (default 1000)
+func NewKnowledgeWriter(db *sql.DB, client EmbeddingClient) *KnowledgeWriter {
+	return &KnowledgeWriter{
+		db:      db,
+		client:  client,
+		queue:   make(chan KnowledgeEntry, envInt("KNOWLEDGE_QUEUE_SIZE", 1000)),
+		retries: 3,
+	}
+}
+
+// Remember queues an entry for embedding; it never blocks. Entries without content are skipped
+func (w *KnowledgeWriter) Remember(entry KnowledgeEntry) {
+	if strings.TrimSpace(entry.Content) == "" {
+		return
+	}
+	select {
+	case w.queue <- entry:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// Stats returns the writer's counters
+func (w *KnowledgeWriter) Stats() KnowledgeStats {
+	return KnowledgeStats{
+		Queued:    len(w.queue),
+		Written:   w.written.Load(),
+		Unchanged: w.unchanged.Load(),
+		Dropped:   w.dropped.Load(),
+		Failed:    w.failed.Load(),
+	}
+}
+
+// Start runs the worker, after queueing the stored summaries and described incidents of the last
+// backfill window that have no knowledge entry yet
+func (w *KnowledgeWriter) Start(backfill time.Duration) {
+	w.startOnce.Do(func() {
+		go w.run()
+		if backfill > 0 {
+			go func() {
+				n, err := w.Backfill(context.Background(), time.Now().Add(-backfill))
+				if err != nil {
+					slog.Error("Knowledge backfill failed", "error", err)
+					return
+				}
+				slog.Info("Knowledge backfill queued", "entries", n)
+			}()
+		}
+	})
+}
+
+// Backfill queues the summaries stored and the incidents described or annotated since the given
+// time that have no knowledge entry, blocking while the queue is full
+func (w *KnowledgeWriter) Backfill(ctx context.Context, since time.Time) (int, error) {
+	var entries []KnowledgeEntry
+
+	rows, err := w.db.QueryContext(ctx, `
+        SELECT s.id, s.time, s.schedule, s.time_range, s.summary, s.key_insights
+        FROM ai_summaries s
+        WHERE s.time >= $1
+          AND NOT EXISTS (SELECT 1 FROM ai_knowledge k WHERE k.kind = 'summary' AND k.source_id = s.id::text)
+        ORDER BY s.time
+    `, since)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var summary StoredSummary
+		var insights []byte
+		if err := rows.Scan(&summary.ID, &summary.Time, &summary.Schedule, &summary.TimeRange, &summary.Summary, &insights); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := json.Unmarshal(insights, &summary.KeyInsights); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, SummaryKnowledge(summary))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rows, err = w.db.QueryContext(ctx, `
+        SELECT i.id, i.updated_at, i.device_ids, i.locations, i.title, i.summary, i.note
+        FROM incidents i
+        WHERE i.updated_at >= $1 AND (i.summary <> '' OR i.note <> '')
+          AND NOT EXISTS (SELECT 1 FROM ai_knowledge k WHERE k.kind = 'incident' AND k.source_id = i.id)
+        ORDER BY i.updated_at
+    `, since)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var entry KnowledgeEntry
+		var deviceIDs, locations []byte
+		var summary, note string
+		if err := rows.Scan(&entry.SourceID, &entry.Time, &deviceIDs, &locations, &entry.Title, &summary, &note); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := errors.Join(json.Unmarshal(deviceIDs, &entry.DeviceIDs), json.Unmarshal(locations, &entry.Locations)); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entry.Kind = KnowledgeIncident
+		entry.Content = incidentNarrative(summary, note)
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, entry := range entries {
+		select {
+		case w.queue <- entry:
+		case <-ctx.Done():
+			return i, ctx.Err()
+		}
+	}
+	return len(entries), nil
+}
+
+// SummaryKnowledge is the knowledge entry of a stored summary
+func SummaryKnowledge(summary StoredSummary) KnowledgeEntry {
+	content := summary.Summary
+	if len(summary.KeyInsights) > 0 {
+		content += "\n- " + strings.Join(summary.KeyInsights, "\n- ")
+	}
+	return KnowledgeEntry{
+		Kind:     KnowledgeSummary,
+		SourceID: fmt.Sprint(summary.ID),
+		Time:     summary.Time,
+		Title:    fmt.Sprintf("%s summary of %s", summary.Schedule, summary.TimeRange),
+		Content:  content,
+	}
+}
+
+// incidentNarrative joins an incident's AI summary and the note its responders left
+func incidentNarrative(summary, note string) string {
+	summary, note = strings.TrimSpace(summary), strings.TrimSpace(note)
+	if note == "" {
+		return summary
+	}
+	if summary == "" {
+		return "Note: " + note
+	}
+	return summary + "\nNote: " + note
+}
+
+// IncidentKnowledge is the knowledge entry of an incident, empty until it has a summary or a note
+func IncidentKnowledge(id, title, summary, note string, deviceIDs, locations []string, at time.Time) KnowledgeEntry {
+	return KnowledgeEntry{
+		Kind:      KnowledgeIncident,
+		SourceID:  id,
+		Time:      at,
+		DeviceIDs: deviceIDs,
+		Locations: locations,
+		Title:     title,
+		Content:   incidentNarrative(summary, note),
+	}
+}
+
+func (w *KnowledgeWriter) run() {
+	for entry := range w.queue {
+		var err error
+		for attempt := 0; attempt <= w.retries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+			if err = w.write(context.Background(), entry); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			w.failed.Add(1)
+			slog.Error("Failed to write knowledge embedding", "kind", entry.Kind, "source_id", entry.SourceID, "error", err)
+		}
+	}
+}
+
+// write embeds an entry and upserts it, unless it is already stored with the same content
+// Titles are not compared: an incident's generated title changes with every signal
+func (w *KnowledgeWriter) write(ctx context.Context, entry KnowledgeEntry) error {
+	var stored string
+	err := w.db.QueryRowContext(ctx, `SELECT content FROM ai_knowledge WHERE kind = $1 AND source_id = $2`,
+		entry.Kind, entry.SourceID).Scan(&stored)
+	if err == nil && stored == entry.Content {
+		w.unchanged.Add(1)
+		return nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	resp, err := w.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: []string{knowledgeText(entry)},
+		Model: embeddingModel,
+	})
+	if err != nil {
+		return providerError("failed to create embedding", err)
+	}
+	if len(resp.Data) == 0 {
+		return fmt.Errorf("no embedding returned from API")
+	}
+
+	if entry.DeviceIDs == nil {
+		entry.DeviceIDs = []string{}
+	}
+	if entry.Locations == nil {
+		entry.Locations = []string{}
+	}
+	deviceIDs, err := json.Marshal(entry.DeviceIDs)
+	if err != nil {
+		return err
+	}
+	locations, err := json.Marshal(entry.Locations)
+	if err != nil {
+		return err
+	}
+	_, err = w.db.ExecContext(ctx, `
+        INSERT INTO ai_knowledge (kind, source_id, time, device_ids, locations, title, content, model, embedding)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (kind, source_id) DO UPDATE SET
+            time = EXCLUDED.time,
+            device_ids = EXCLUDED.device_ids,
+            locations = EXCLUDED.locations,
+            title = EXCLUDED.title,
+            content = EXCLUDED.content,
+            model = EXCLUDED.model,
+            embedding = EXCLUDED.embedding,
+            updated_at = NOW()
+    `, entry.Kind, entry.SourceID, entry.Time, deviceIDs, locations, entry.Title, entry.Content,
+		string(embeddingModel), pgvector.NewVector(resp.Data[0].Embedding))
+	if err != nil {
+		return err
+	}
+	w.written.Add(1)
+	return nil
+}
+
+// knowledgeText is what gets embedded for an entry: its text with the kind, devices and locations a
+// search might name, e.g. "incident freezer-1 (kitchen) Compressor failure: The compressor ..."
+func knowledgeText(entry KnowledgeEntry) string {
+	var b strings.Builder
+	b.WriteString(entry.Kind)
+	if len(entry.DeviceIDs) > 0 {
+		b.WriteString(" " + strings.Join(entry.DeviceIDs, ", "))
+	}
+	if len(entry.Locations) > 0 {
+		b.WriteString(" (" + strings.Join(entry.Locations, ", ") + ")")
+	}
+	if entry.Title != "" {
+		b.WriteString(" " + entry.Title)
+	}
+	b.WriteString(": " + entry.Content)
+	return b.String()
+}
+
+// searchKnowledge returns the knowledge entries closest to an embedded query, within the filter's
+// location and time range
+func (s *AIService) searchKnowledge(ctx context.Context, embedding pgvector.Vector, limit int, filter SearchFilter) ([]types.KnowledgeResult, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT kind, source_id, time, device_ids, locations, title, content, embedding <=> $1 AS distance
+        FROM ai_knowledge
+        WHERE ($3 = '' OR locations @> jsonb_build_array($3::text))
+          AND ($4::timestamptz IS NULL OR time >= $4)
+          AND ($5::timestamptz IS NULL OR time < $5)
+        ORDER BY distance ASC
+        LIMIT $2
+    `, embedding, limit, filter.Location, filter.Start, filter.End)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []types.KnowledgeResult{}
+	for rows.Next() {
+		var result types.KnowledgeResult
+		var at time.Time
+		var deviceIDs, locations []byte
+		if err := rows.Scan(&result.Kind, &result.SourceID, &at, &deviceIDs, &locations,
+			&result.Title, &result.Content, &result.Distance); err != nil {
+			return nil, err
+		}
+		if err := errors.Join(json.Unmarshal(deviceIDs, &result.DeviceIDs), json.Unmarshal(locations, &result.Locations)); err != nil {
+			return nil, err
+		}
+		result.Time = at.Format(time.RFC3339)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// KnowledgeWriter returns the writer that embeds conclusions for search, or nil without an
+// embeddings client or with KNOWLEDGE_EMBEDDINGS=false
+func (s *AIService) KnowledgeWriter() *KnowledgeWriter {
+	return s.knowledge
+}
+
+// Remember queues a conclusion for search; it is a no-op without a knowledge writer
+func (s *AIService) Remember(entry KnowledgeEntry) {
+	if s.knowledge != nil {
+		s.knowledge.Remember(entry)
+	}
+}
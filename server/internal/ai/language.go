@@ -0,0 +1,130 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+type languageKey struct{}
+
+// DefaultLanguage is the language AI text is written in when the caller does not ask for one:
+// AI_LANGUAGE (a tag such as es or es-MX), else English
+// Incident narratives and remediation steps are written without a caller, so they always use it
+func DefaultLanguage() language.Tag {
+	if tag, err := language.Parse(os.Getenv("AI_LANGUAGE")); err == nil {
+		return tag
+	}
+	return language.English
+}
+
+// WithLanguage returns a copy of ctx asking for AI text in the given language
+func WithLanguage(ctx context.Context, tag language.Tag) context.Context {
+	return context.WithValue(ctx, languageKey{}, tag)
+}
+
+// LanguageFromContext returns the language requested on ctx, or DefaultLanguage
+func LanguageFromContext(ctx context.Context) language.Tag {
+	if tag, ok := ctx.Value(languageKey{}).(language.Tag); ok {
+		return tag
+	}
+	return DefaultLanguage()
+}
+
+// ParseLanguage picks a language from an explicit tag (a lang parameter) or, without one, the
+// caller's most preferred Accept-Language entry; false when neither names a language
+func ParseLanguage(tag, acceptLanguage string) (language.Tag, bool, error) {
+	if tag != "" {
+		parsed, err := language.Parse(tag)
+		if err != nil {
+			return language.Und, false, fmt.Errorf("lang must be a language tag like es or es-MX")
+		}
+		return parsed, true, nil
+	}
+	if acceptLanguage == "" {
+		return language.Und, false, nil
+	}
+	// An unparseable header is ignored like a missing one
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return language.Und, false, nil
+	}
+	// "*" (any language) is parsed as mul and leaves the choice to AI_LANGUAGE
+	for _, t := range tags {
+		if t != language.Und && t != language.Make("mul") {
+			return t, true, nil
+		}
+	}
+	return language.Und, false, nil
+}
+
+// isEnglish reports whether text generated in English needs no translation for tag
+func isEnglish(tag language.Tag) bool {
+	base, _ := tag.Base()
+	english, _ := language.English.Base()
+	return base == english
+}
+
+// languageName names tag in English for prompts, e.g. "Mexican Spanish (es-MX)"
+func languageName(tag language.Tag) string {
+	return fmt.Sprintf("%s (%s)", display.English.Tags().Name(tag), tag)
+}
+
+// languageInstruction is appended to system prompts so the model writes in the requested language
+func languageInstruction(ctx context.Context) string {
+	tag := LanguageFromContext(ctx)
+	if isEnglish(tag) {
+		return ""
+	}
+	return "\nWrite every human-readable sentence in " + languageName(tag) + ". Keep JSON keys, device IDs, " +
+		"locations, log levels, units and numbers exactly as given."
+}
+
+// localize translates texts built from English templates into the language requested on ctx
+// Translation failures are logged and leave the texts in English rather than failing the request
+func localize(ctx context.Context, llm *LLMRouter, texts ...string) []string {
+	tag := LanguageFromContext(ctx)
+	if isEnglish(tag) || !llm.Has(UseCaseTranslation) || len(texts) == 0 {
+		return texts
+	}
+
+	// Texts may quote device logs, so they are screened like any other prompt input
+	screened := make([]string, len(texts))
+	for i, text := range texts {
+		screened[i] = screenData(ctx, "translation", text)
+	}
+	data, err := json.Marshal(screened)
+	if err != nil {
+		return texts
+	}
+	systemPrompt := `You translate short texts shown in an IoT monitoring dashboard into ` + languageName(tag) + `.
+You are given a JSON array of strings. Respond with a JSON object {"texts": [...]} holding the translations
+in the same order. Keep device IDs, locations, log levels (INFO, WARN, ERROR), units, numbers,
+line breaks and bullet characters exactly as given.`
+
+	resp, err := llm.Complete(ctx, UseCaseTranslation, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: string(data)},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to translate AI text", "language", tag.String(), "error", err)
+		return texts
+	}
+	var translated struct {
+		Texts []string `json:"texts"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &translated); err != nil || len(translated.Texts) != len(texts) {
+		slog.WarnContext(ctx, "Invalid AI translation", "language", tag.String(), "error", err)
+		return texts
+	}
+	return translated.Texts
+}
@@ -0,0 +1,290 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Chat-completion providers (LLM_PROVIDER, LLM_<USE CASE>_PROVIDER)
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAzure     = "azure"     // Azure OpenAI; the model is the deployment name
+	ProviderAnthropic = "anthropic" // through Anthropic's OpenAI-compatible endpoint
+	ProviderVLLM      = "vllm"      // any OpenAI-compatible server, e.g. a local vLLM
+)
+
+// LLMProvider is a chat-completion backend. Every provider takes the OpenAI request and response
+// shapes, so the features need not know which one answers; providers that can stream also
+// implement ChatStreamClient
+type LLMProvider interface {
+	ChatClient
+}
+
+// NewLLMProvider creates a provider from its environment:
+//   - openai: OPENAI_API_KEY, optionally OPENAI_BASE_URL
+//   - azure: AZURE_OPENAI_API_KEY and AZURE_OPENAI_ENDPOINT, optionally AZURE_OPENAI_API_VERSION
+//   - anthropic: ANTHROPIC_API_KEY, optionally ANTHROPIC_BASE_URL
+//   - vllm: VLLM_BASE_URL (e.g. http://localhost:8000/v1), optionally VLLM_API_KEY
+func NewLLMProvider(name string) (LLMProvider, error) {
+	var config openai.ClientConfig
+	switch name {
+	case ProviderOpenAI:
+		key := os.Getenv("OPENAI_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+		}
+		config = openai.DefaultConfig(key)
+		if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+			config.BaseURL = baseURL
+		}
+	case ProviderAzure:
+		key, endpoint := os.Getenv("AZURE_OPENAI_API_KEY"), os.Getenv("AZURE_OPENAI_ENDPOINT")
+		if key == "" || endpoint == "" {
+			return nil, fmt.Errorf("AZURE_OPENAI_API_KEY and AZURE_OPENAI_ENDPOINT are required for the azure provider")
+		}
+		config = openai.DefaultAzureConfig(key, endpoint)
+		if version := os.Getenv("AZURE_OPENAI_API_VERSION"); version != "" {
+			config.APIVersion = version
+		}
+	case ProviderAnthropic:
+		key := os.Getenv("ANTHROPIC_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
+		}
+		config = openai.DefaultAnthropicConfig(key, os.Getenv("ANTHROPIC_BASE_URL"))
+	case ProviderVLLM:
+		baseURL := os.Getenv("VLLM_BASE_URL")
+		if baseURL == "" {
+			return nil, fmt.Errorf("VLLM_BASE_URL is required for the vllm provider")
+		}
+		config = openai.DefaultConfig(os.Getenv("VLLM_API_KEY"))
+		config.BaseURL = baseURL
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q (openai, azure, anthropic or vllm)", name)
+	}
+	return openai.NewClientWithConfig(config), nil
+}
+
+// UseCase names the chat completions of one feature; each use case has its own provider and
+// model settings, so simple tasks can run on a cheaper model
+type UseCase string
+
+const (
+	UseCaseSQL         UseCase = "sql"         // writing SQL for questions
+	UseCaseSummary     UseCase = "summary"     // narrating log summaries
+	UseCaseIncident    UseCase = "incident"    // incident titles and summaries
+	UseCaseRemediation UseCase = "remediation" // suggested remediation steps
+	UseCaseMaintenance UseCase = "maintenance" // maintenance rationales
+	UseCaseTranslation UseCase = "translation" // translating text built from English templates
+)
+
+// ModelConfig is how the completions of a use case are requested
+type ModelConfig struct {
+	Provider    string  `json:"provider"`
+	Model       string  `json:"model"`
+	Temperature float32 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens,omitempty"` // 0 leaves the limit to the provider
+}
+
+// defaultModels are the settings of each use case; the models apply to the openai and azure
+// providers, the others need LLM_MODEL or LLM_<USE CASE>_MODEL
+var defaultModels = map[UseCase]ModelConfig{
+	UseCaseSQL:         {Model: "gpt-4", Temperature: 0.1}, // Low temperature for consistent SQL generation
+	UseCaseSummary:     {Model: "gpt-4o-mini", Temperature: 0.2},
+	UseCaseIncident:    {Model: "gpt-4o-mini", Temperature: 0.2},
+	UseCaseRemediation: {Model: "gpt-4o-mini", Temperature: 0.2},
+	UseCaseMaintenance: {Model: "gpt-4o-mini", Temperature: 0.2},
+	UseCaseTranslation: {Model: "gpt-4o-mini", Temperature: 0.2},
+}
+
+// LLMRouter sends the chat completions of each use case to its provider with its model settings
+// A nil router, or a use case without a provider, answers errNoChatClient
+type LLMRouter struct {
+	configs   map[UseCase]ModelConfig
+	providers map[UseCase]LLMProvider
+}
+
+// NewLLMRouter runs every use case on one client with the default settings (used by tests)
+// A nil client leaves the chat features unavailable
+func NewLLMRouter(client ChatClient) *LLMRouter {
+	r := &LLMRouter{configs: make(map[UseCase]ModelConfig), providers: make(map[UseCase]LLMProvider)}
+	for use, config := range defaultModels {
+		config.Provider = ProviderOpenAI
+		r.configs[use] = config
+		if client != nil {
+			r.providers[use] = client
+		}
+	}
+	return r
+}
+
+// LoadLLMRouter reads each use case's settings from the environment: LLM_<USE CASE>_PROVIDER,
+// _MODEL, _TEMPERATURE and _MAX_TOKENS (e.g. LLM_SQL_MODEL), falling back to LLM_PROVIDER
+// (default openai), LLM_MODEL, LLM_TEMPERATURE and LLM_MAX_TOKENS, then to defaultModels
+// Use cases on the same provider share its client
+func LoadLLMRouter() (*LLMRouter, error) {
+	r := &LLMRouter{configs: make(map[UseCase]ModelConfig), providers: make(map[UseCase]LLMProvider)}
+	clients := make(map[string]LLMProvider)
+	for use, defaults := range defaultModels {
+		config, err := loadModelConfig(use, defaults)
+		if err != nil {
+			return nil, err
+		}
+		provider, ok := clients[config.Provider]
+		if !ok {
+			if provider, err = NewLLMProvider(config.Provider); err != nil {
+				return nil, err
+			}
+			clients[config.Provider] = provider
+		}
+		r.configs[use], r.providers[use] = config, provider
+		slog.Debug("Chat model configured", "use_case", use, "provider", config.Provider, "model", config.Model)
+	}
+	return r, nil
+}
+
+// loadModelConfig reads the settings of one use case
+func loadModelConfig(use UseCase, defaults ModelConfig) (ModelConfig, error) {
+	prefix := "LLM_" + strings.ToUpper(string(use)) + "_"
+	setting := func(name string) (string, string) {
+		if v := os.Getenv(prefix + name); v != "" {
+			return prefix + name, v
+		}
+		return "LLM_" + name, os.Getenv("LLM_" + name)
+	}
+
+	config := ModelConfig{Provider: ProviderOpenAI, Temperature: defaults.Temperature, MaxTokens: defaults.MaxTokens}
+	if _, provider := setting("PROVIDER"); provider != "" {
+		config.Provider = strings.ToLower(provider)
+	}
+	if _, model := setting("MODEL"); model != "" {
+		config.Model = model
+	} else if config.Provider == ProviderOpenAI || config.Provider == ProviderAzure {
+		config.Model = defaults.Model
+	} else {
+		return config, fmt.Errorf("%sMODEL or LLM_MODEL is required for the %s provider", prefix, config.Provider)
+	}
+	if key, v := setting("TEMPERATURE"); v != "" {
+		t, err := strconv.ParseFloat(v, 32)
+		if err != nil || t < 0 || t > 2 {
+			return config, fmt.Errorf("%s must be a number between 0 and 2", key)
+		}
+		config.Temperature = float32(t)
+	}
+	if key, v := setting("MAX_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			config.MaxTokens = n
+		} else {
+			slog.Warn("Invalid "+key+", using the default token limit", "value", v)
+		}
+	}
+	return config, nil
+}
+
+// Config returns the settings of a use case
+func (r *LLMRouter) Config(use UseCase) ModelConfig {
+	if r == nil {
+		return ModelConfig{}
+	}
+	return r.configs[use]
+}
+
+// Has reports whether a use case has a provider
+func (r *LLMRouter) Has(use UseCase) bool {
+	return r != nil && r.providers[use] != nil
+}
+
+// prepare applies a use case's settings to request; a model already set on it (a shadow run's
+// candidate) is kept
+func (r *LLMRouter) prepare(use UseCase, request openai.ChatCompletionRequest) (LLMProvider, ModelConfig, openai.ChatCompletionRequest) {
+	config := r.configs[use]
+	if request.Model == "" {
+		request.Model = config.Model
+	}
+	request.Temperature = config.Temperature
+	if config.MaxTokens > 0 {
+		request.MaxTokens = config.MaxTokens
+	}
+	return r.providers[use], config, request
+}
+
+// Complete sends a use case's request to its provider. Failures are classified by providerError,
+// and a response without choices is an error too
+func (r *LLMRouter) Complete(ctx context.Context, use UseCase, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if !r.Has(use) {
+		return openai.ChatCompletionResponse{}, errNoChatClient
+	}
+	provider, config, request := r.prepare(use, request)
+	resp, err := provider.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return resp, providerError(config.Provider+" API error", err)
+	}
+	if len(resp.Choices) == 0 {
+		return resp, fmt.Errorf("no response from %s", config.Provider)
+	}
+	return resp, nil
+}
+
+// Stream is Complete passing the content to onToken piece by piece while the model writes it,
+// and returns the whole content trimmed. Providers that cannot stream answer in one piece
+// Returning early closes the stream, which stops the model generating (and billing) the rest
+func (r *LLMRouter) Stream(ctx context.Context, use UseCase, request openai.ChatCompletionRequest, onToken func(string) error) (string, error) {
+	if !r.Has(use) {
+		return "", errNoChatClient
+	}
+	provider, config, request := r.prepare(use, request)
+	streamer, ok := provider.(ChatStreamClient)
+	if !ok {
+		resp, err := r.Complete(ctx, use, request)
+		if err != nil {
+			return "", err
+		}
+		content := strings.TrimSpace(resp.Choices[0].Message.Content)
+		if err := onToken(content); err != nil {
+			return "", err
+		}
+		return content, nil
+	}
+
+	request.Stream = true
+	stream, err := streamer.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return "", providerError(config.Provider+" API error", err)
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", providerError(config.Provider+" API error", err)
+		}
+		for _, choice := range resp.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if err := onToken(choice.Delta.Content); err != nil {
+				return "", err
+			}
+		}
+	}
+	if content.Len() == 0 {
+		return "", fmt.Errorf("no response from %s", config.Provider)
+	}
+	return strings.TrimSpace(content.String()), nil
+}
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"edge-insights/internal/maintenance"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ExplainMaintenance writes a short rationale for each scored device, keyed by device ID
+// Devices the model leaves out are missing from the map
+func (s *AIService) ExplainMaintenance(ctx context.Context, scores []maintenance.Score) (map[string]string, error) {
+	if s.textToSQL == nil || !s.textToSQL.llm.Has(UseCaseMaintenance) {
+		return nil, errNoChatClient
+	}
+
+	systemPrompt, _ := s.textToSQL.prompts.Render(PromptMaintenance, nil)
+	systemPrompt += languageInstruction(ctx)
+
+	data, err := json.Marshal(scores)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.textToSQL.llm.Complete(ctx, UseCaseMaintenance, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: "Devices:\n" + string(data)},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rationales map[string]string
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &rationales); err != nil {
+		return nil, fmt.Errorf("invalid maintenance rationale: %w", err)
+	}
+	for id, text := range rationales {
+		rationales[id] = strings.TrimSpace(text)
+	}
+	return rationales, nil
+}
+
+// maintenancePrompt is the built-in maintenance explanation system prompt
+const maintenancePrompt = `You are a maintenance planner for an IoT monitoring platform.
+You are given devices ranked by a maintenance-priority score (0-100) with the measurements behind it:
+recent error rate and its trend, anomaly count, drift from the device's learned baseline and age.
+Respond with a JSON object mapping each device_id to 1-2 sentences explaining why it may fail soon
+and what a technician should inspect first. Low scores may be explained as no action needed.
+Do not invent measurements or causes that the data does not support.`
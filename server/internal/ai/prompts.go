@@ -0,0 +1,363 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Names of the system prompts kept as templates
+const (
+	PromptTextToSQL       = "text_to_sql"
+	PromptIncidentSummary = "incident_summary"
+	PromptMaintenance     = "maintenance"
+	PromptRemediation     = "remediation"
+	PromptLogSummary      = "log_summary"
+)
+
+// builtinPrompt is the prompt shipped with the code, version 0 of its template
+type builtinPrompt struct {
+	content string
+	vars    []string // fields the template may use, e.g. {{.Schema}}
+}
+
+var builtinPrompts = map[string]builtinPrompt{
+	PromptTextToSQL:       {content: textToSQLPrompt, vars: []string{"Schema"}},
+	PromptIncidentSummary: {content: incidentSummaryPrompt},
+	PromptMaintenance:     {content: maintenancePrompt},
+	PromptRemediation:     {content: remediationPrompt},
+	PromptLogSummary:      {content: logSummaryPrompt},
+}
+
+// KnownPrompt reports whether name is one of the prompts kept as templates
+func KnownPrompt(name string) bool {
+	_, ok := builtinPrompts[name]
+	return ok
+}
+
+// PromptTemplate is one version of a system prompt, written with text/template
+// Version 0 is the built-in prompt; stored versions start at 1
+type PromptTemplate struct {
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	Content   string    `json:"content"`
+	Note      string    `json:"note,omitempty"`
+	Vars      []string  `json:"vars"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// parsePrompt parses a template for the named prompt and checks that it renders with the
+// prompt's fields, so a bad edit is refused instead of breaking every later request
+func parsePrompt(name, content string) (*template.Template, error) {
+	builtin, ok := builtinPrompts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt %s", name)
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("content is required")
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	sample := make(map[string]string, len(builtin.vars))
+	for _, v := range builtin.vars {
+		sample[v] = v
+	}
+	if err := tmpl.Execute(new(strings.Builder), sample); err != nil {
+		return nil, fmt.Errorf("invalid template (fields: %s): %w", strings.Join(builtin.vars, ", "), err)
+	}
+	return tmpl, nil
+}
+
+// PromptStore keeps versioned prompt templates in the prompt_templates table, with the active
+// version of each prompt in memory; prompts without an active stored version use the built-in one
+// A nil store renders the built-in prompts
+type PromptStore struct {
+	db     *sql.DB
+	mu     sync.RWMutex
+	active map[string]activePrompt
+}
+
+type activePrompt struct {
+	version int
+	tmpl    *template.Template
+}
+
+// NewPromptStore creates a store and loads the active versions
+func NewPromptStore(db *sql.DB) (*PromptStore, error) {
+	s := &PromptStore{db: db, active: make(map[string]activePrompt)}
+	return s, s.Load()
+}
+
+// Load (re)reads the active version of every prompt from the database
+func (s *PromptStore) Load() error {
+	rows, err := s.db.Query(`SELECT name, version, content FROM prompt_templates WHERE active`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	active := make(map[string]activePrompt)
+	for rows.Next() {
+		var name, content string
+		var version int
+		if err := rows.Scan(&name, &version, &content); err != nil {
+			return err
+		}
+		tmpl, err := parsePrompt(name, content)
+		if err != nil {
+			slog.Warn("Ignoring stored prompt template", "name", name, "version", version, "error", err)
+			continue
+		}
+		active[name] = activePrompt{version: version, tmpl: tmpl}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.active = active
+	s.mu.Unlock()
+	return nil
+}
+
+// Render returns the active version of the named prompt filled in with vars, and its version
+func (s *PromptStore) Render(name string, vars map[string]string) (string, int) {
+	if s != nil {
+		s.mu.RLock()
+		active, ok := s.active[name]
+		s.mu.RUnlock()
+		if ok {
+			var out strings.Builder
+			err := active.tmpl.Execute(&out, vars)
+			if err == nil {
+				return out.String(), active.version
+			}
+			slog.Warn("Prompt template failed, using the built-in prompt", "name", name, "version", active.version, "error", err)
+		}
+	}
+	return renderBuiltin(name, vars), 0
+}
+
+// RenderVersion fills in a given version of the named prompt, 0 being the built-in one, whether
+// or not it is active (used to try out candidate prompts)
+func (s *PromptStore) RenderVersion(ctx context.Context, name string, version int, vars map[string]string) (string, error) {
+	if !KnownPrompt(name) {
+		return "", fmt.Errorf("unknown prompt %s", name)
+	}
+	if version == 0 {
+		return renderBuiltin(name, vars), nil
+	}
+	if s == nil {
+		return "", fmt.Errorf("prompt templates are not loaded")
+	}
+	var content string
+	err := s.db.QueryRowContext(ctx, `SELECT content FROM prompt_templates WHERE name = $1 AND version = $2`, name, version).Scan(&content)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%s has no version %d", name, version)
+	}
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := parsePrompt(name, content)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// renderBuiltin fills in a built-in prompt; callers always pass its fields
+func renderBuiltin(name string, vars map[string]string) string {
+	tmpl := template.Must(template.New(name).Option("missingkey=error").Parse(builtinPrompts[name].content))
+	var out strings.Builder
+	tmpl.Execute(&out, vars)
+	return out.String()
+}
+
+// ActiveVersion returns the version of the named prompt requests currently use
+func (s *PromptStore) ActiveVersion(name string) int {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active[name].version
+}
+
+// List returns the active version of every prompt sorted by name
+func (s *PromptStore) List(ctx context.Context) ([]PromptTemplate, error) {
+	names := make([]string, 0, len(builtinPrompts))
+	for name := range builtinPrompts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]PromptTemplate, 0, len(names))
+	for _, name := range names {
+		versions, err := s.Versions(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			if v.Active {
+				list = append(list, v)
+			}
+		}
+	}
+	return list, nil
+}
+
+// Versions returns every version of the named prompt, oldest first, starting with the built-in one
+func (s *PromptStore) Versions(ctx context.Context, name string) ([]PromptTemplate, error) {
+	builtin, ok := builtinPrompts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt %s", name)
+	}
+	versions := []PromptTemplate{{Name: name, Version: 0, Content: builtin.content, Note: "built-in", Vars: builtin.vars, Active: true}}
+
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT version, content, note, active, created_at
+        FROM prompt_templates
+        WHERE name = $1
+        ORDER BY version
+    `, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v := PromptTemplate{Name: name, Vars: builtin.vars}
+		if err := rows.Scan(&v.Version, &v.Content, &v.Note, &v.Active, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		if v.Active {
+			versions[0].Active = false
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// Create stores content as the next version of the named prompt, making it the active one
+// unless activate is false
+func (s *PromptStore) Create(ctx context.Context, name, content, note string, activate bool) (*PromptTemplate, error) {
+	tmpl, err := parsePrompt(name, content)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if activate {
+		if _, err := tx.ExecContext(ctx, `UPDATE prompt_templates SET active = FALSE WHERE name = $1 AND active`, name); err != nil {
+			return nil, err
+		}
+	}
+	created := PromptTemplate{Name: name, Content: content, Note: note, Vars: builtinPrompts[name].vars, Active: activate}
+	// Concurrent creates of the same prompt collide on the primary key instead of sharing a version
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO prompt_templates (name, version, content, note, active)
+        SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4
+        FROM prompt_templates
+        WHERE name = $1
+        RETURNING version, created_at
+    `, name, content, note, activate).Scan(&created.Version, &created.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save prompt template: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if activate {
+		s.mu.Lock()
+		s.active[name] = activePrompt{version: created.Version, tmpl: tmpl}
+		s.mu.Unlock()
+	}
+	return &created, nil
+}
+
+// Activate makes a stored version of the named prompt the active one; version 0 goes back to
+// the built-in prompt. It reports false if the version does not exist
+func (s *PromptStore) Activate(ctx context.Context, name string, version int) (bool, error) {
+	if _, ok := builtinPrompts[name]; !ok {
+		return false, fmt.Errorf("unknown prompt %s", name)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var tmpl *template.Template
+	if version != 0 {
+		var content string
+		err := tx.QueryRowContext(ctx, `SELECT content FROM prompt_templates WHERE name = $1 AND version = $2`, name, version).Scan(&content)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if tmpl, err = parsePrompt(name, content); err != nil {
+			return false, err
+		}
+	}
+	// Deactivating first keeps the one-active-version index satisfied row by row
+	if _, err := tx.ExecContext(ctx, `UPDATE prompt_templates SET active = FALSE WHERE name = $1 AND active`, name); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE prompt_templates SET active = TRUE WHERE name = $1 AND version = $2`, name, version); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if tmpl == nil {
+		delete(s.active, name)
+	} else {
+		s.active[name] = activePrompt{version: version, tmpl: tmpl}
+	}
+	s.mu.Unlock()
+	return true, nil
+}
+
+// Rollback activates the newest version of the named prompt older than the active one (the
+// built-in prompt when there is none) and returns it
+func (s *PromptStore) Rollback(ctx context.Context, name string) (int, error) {
+	current := s.ActiveVersion(name)
+	if current == 0 {
+		return 0, fmt.Errorf("%s already uses the built-in prompt", name)
+	}
+	var previous int
+	err := s.db.QueryRowContext(ctx, `
+        SELECT COALESCE(MAX(version), 0) FROM prompt_templates WHERE name = $1 AND version < $2
+    `, name, current).Scan(&previous)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.Activate(ctx, name, previous); err != nil {
+		return 0, err
+	}
+	return previous, nil
+}
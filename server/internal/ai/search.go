@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/types"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// SearchFilter narrows semantic search to some devices and a time range; empty fields match
+// everything. Knowledge entries are narrowed by location and time only
+type SearchFilter struct {
+	DeviceType string
+	Location   string
+	LogType    string
+	Start      *time.Time // inclusive
+	End        *time.Time // exclusive
+}
+
+// hybridCandidates is how many times the limit each of the vector and the keyword search
+// contribute before the blended ranking
+const hybridCandidates = 10
+
+// loadKeywordWeight reads SEARCH_KEYWORD_WEIGHT, the share of the keyword score in the search
+// ranking between 0 (embedding distance only) and 1 (keywords only); default 0.3
+func loadKeywordWeight() float64 {
+	v := os.Getenv("SEARCH_KEYWORD_WEIGHT")
+	if v == "" {
+		return 0.3
+	}
+	weight, err := strconv.ParseFloat(v, 64)
+	if err != nil || weight < 0 || weight > 1 {
+		slog.Warn("Invalid SEARCH_KEYWORD_WEIGHT, using 0.3", "value", v)
+		return 0.3
+	}
+	return weight
+}
+
+// readingFilter is the SearchFilter condition on sensor_readings_embeddings, with the filter's
+// fields in $3 to $7 (see filterArgs)
+const readingFilter = `($3 = '' OR device_type = $3)
+          AND ($4 = '' OR location = $4)
+          AND ($5 = '' OR log_type = $5)
+          AND ($6::timestamptz IS NULL OR time >= $6)
+          AND ($7::timestamptz IS NULL OR time < $7)`
+
+// searchReadings returns the embedded readings closest to the search text. The candidates are the
+// closest embeddings and the best keyword matches (ts_rank_cd of the message against the search
+// text as a web search query, scaled to [0, 1)); they are ranked by
+// (1 - w) * (1 - distance) + w * keyword_score, w being SEARCH_KEYWORD_WEIGHT
+func (s *AIService) searchReadings(ctx context.Context, embedding pgvector.Vector, searchText string, limit int, filter SearchFilter) ([]types.SearchResult, error) {
+	query := `
+        WITH search AS (SELECT websearch_to_tsquery('english', $2) AS q),
+        vector_hits AS (
+            SELECT time, device_id
+            FROM sensor_readings_embeddings
+            WHERE ` + readingFilter + `
+            ORDER BY embedding <=> $1
+            LIMIT $8
+        ),
+        keyword_hits AS (
+            SELECT time, device_id
+            FROM sensor_readings_embeddings, search
+            WHERE message_tsv @@ search.q
+              AND ` + readingFilter + `
+            ORDER BY ts_rank_cd(message_tsv, search.q, 32) DESC
+            LIMIT $8
+        ),
+        scored AS (
+            SELECT e.time, e.device_id, e.device_type, e.location, e.raw_value, e.unit, e.log_type,
+                   COALESCE(e.message, '') AS message,
+                   e.embedding <=> $1 AS distance,
+                   ts_rank_cd(e.message_tsv, search.q, 32) AS keyword_score
+            FROM sensor_readings_embeddings e
+            JOIN (SELECT time, device_id FROM vector_hits
+                  UNION
+                  SELECT time, device_id FROM keyword_hits) hits USING (time, device_id)
+            CROSS JOIN search
+        )
+        SELECT time, device_id, device_type, location, raw_value, unit, log_type, message, distance, keyword_score
+        FROM scored
+        ORDER BY (1 - $10::float8) * (1 - distance) + $10::float8 * keyword_score DESC
+        LIMIT $9
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, embedding, searchText,
+		filter.DeviceType, filter.Location, filter.LogType, filter.Start, filter.End,
+		limit*hybridCandidates, limit, s.keywordWeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []types.SearchResult
+	for rows.Next() {
+		var result types.SearchResult
+		var at time.Time
+		if err := rows.Scan(&at, &result.DeviceID, &result.DeviceType, &result.Location, &result.RawValue,
+			&result.Unit, &result.LogType, &result.Chunk, &result.Distance, &result.KeywordScore); err != nil {
+			continue
+		}
+		result.Time = at.Format("2006-01-02T15:04:05Z07:00")
+		result.Score = (1-s.keywordWeight)*(1-result.Distance) + s.keywordWeight*result.KeywordScore
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
@@ -28,12 +28,20 @@ package ai
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
 	"time"
 
+	"edge-insights/internal/alerts"
+	"edge-insights/internal/anomaly"
+	"edge-insights/internal/db"
+	"edge-insights/internal/devicetypes"
+	apperrors "edge-insights/internal/errors"
+	"edge-insights/internal/roles"
+	"edge-insights/internal/timerange"
 	"edge-insights/internal/types"
 
 	"github.com/pgvector/pgvector-go"
@@ -45,36 +53,118 @@ import (
 type AIService struct {
 	db        *sql.DB
 	textToSQL *TextToSQLService
+	enricher  *alerts.Enricher
+	// enrichLimit is how many of the newest detected anomalies get context (ANOMALY_CONTEXT_LIMIT)
+	enrichLimit int
+	embeddings  EmbeddingClient
+	detector    anomaly.Config
+	baselines   *anomaly.Learner
+	writer      *EmbeddingWriter
+	knowledge   *KnowledgeWriter
+	cache       *EmbeddingCache
+	// keywordWeight is the share of the keyword score in the search ranking (SEARCH_KEYWORD_WEIGHT)
+	keywordWeight float64
+	// demo holds the prepared answers of a demo service (NewDemoAIService), keyed by demoKey
+	demo          map[string]DemoAnswer
+	demoQuestions []string
 }
 
 // NewAIService creates a new AI service instance
 // Initializes the service with a database connection for log analysis
 func NewAIService(db *sql.DB) *AIService {
-	return &AIService{
-		db:        db,
-		textToSQL: NewTextToSQLService(db),
+	var embeddings EmbeddingClient
+	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+		embeddings = openai.NewClient(apiKey)
 	}
+	return NewAIServiceWithClients(db, NewTextToSQLService(db), embeddings)
 }
 
-// generateEmbedding creates a vector embedding for the given text using OpenAI API
-func (s *AIService) generateEmbedding(text string) ([]float64, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+// NewAIServiceWithClients creates an AI service with explicit dependencies (used by tests)
+func NewAIServiceWithClients(db *sql.DB, textToSQL *TextToSQLService, embeddings EmbeddingClient) *AIService {
+	s := &AIService{
+		db:          db,
+		textToSQL:   textToSQL,
+		enricher:    alerts.NewEnricher(db),
+		enrichLimit: envInt("ANOMALY_CONTEXT_LIMIT", 20),
+		embeddings:  embeddings,
+		detector:    anomaly.LoadConfig(),
+		baselines:   anomaly.NewLearner(db),
+		cache:       NewEmbeddingCache(),
+
+		keywordWeight: loadKeywordWeight(),
+	}
+	if embeddings != nil {
+		s.writer = NewEmbeddingWriter(db, embeddings)
+		if os.Getenv("KNOWLEDGE_EMBEDDINGS") != "false" {
+			s.knowledge = NewKnowledgeWriter(db, embeddings)
+		}
+	}
+	return s
+}
+
+// EmbeddingCache returns the cache of query embeddings
+func (s *AIService) EmbeddingCache() *EmbeddingCache {
+	return s.cache
+}
+
+// EmbeddingWriter returns the pipeline that embeds stored readings for search, or nil without an embeddings client
+func (s *AIService) EmbeddingWriter() *EmbeddingWriter {
+	return s.writer
+}
+
+// AnomalyConfig returns the detector configuration DetectAnomalies runs with
+func (s *AIService) AnomalyConfig() anomaly.Config {
+	return s.detector
+}
+
+// UsePrompts makes the AI endpoints render their system prompts from the given template store
+func (s *AIService) UsePrompts(prompts *PromptStore) {
+	if s.textToSQL != nil {
+		s.textToSQL.prompts = prompts
+	}
+}
+
+// Prompts returns the template store system prompts are rendered from, or nil when they are built in
+func (s *AIService) Prompts() *PromptStore {
+	if s.textToSQL == nil {
+		return nil
+	}
+	return s.textToSQL.prompts
+}
+
+// Shadow returns the runner comparing text-to-SQL requests against the candidate prompt and model
+func (s *AIService) Shadow() *Shadow {
+	if s.textToSQL == nil {
+		return nil
 	}
+	return s.textToSQL.shadow
+}
+
+// Baselines returns the learner whose per-device baselines DetectAnomalies scores against
+func (s *AIService) Baselines() *anomaly.Learner {
+	return s.baselines
+}
 
-	client := openai.NewClient(apiKey)
+// generateEmbedding creates a vector embedding for the given text using OpenAI API
+// Embeddings are cached by normalized text, so repeated queries do not call the API again
+func (s *AIService) generateEmbedding(ctx context.Context, text string) ([]float64, error) {
+	if s.embeddings == nil {
+		return nil, apperrors.Mark(errors.New("OPENAI_API_KEY environment variable not set"), apperrors.ErrAIUnavailable)
+	}
+	if embedding, ok := s.cache.Get(string(embeddingModel), text); ok {
+		return embedding, nil
+	}
 
-	resp, err := client.CreateEmbeddings(
-		context.Background(),
+	resp, err := s.embeddings.CreateEmbeddings(
+		ctx,
 		openai.EmbeddingRequest{
 			Input: []string{text},
-			Model: openai.SmallEmbedding3,
+			Model: embeddingModel,
 		},
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding: %w", err)
+		return nil, providerError("failed to create embedding", err)
 	}
 
 	if len(resp.Data) == 0 {
@@ -86,15 +176,21 @@ func (s *AIService) generateEmbedding(text string) ([]float64, error) {
 	for i, v := range resp.Data[0].Embedding {
 		embedding[i] = float64(v)
 	}
+	s.cache.Put(string(embeddingModel), text, embedding)
 	return embedding, nil
 }
 
-// SearchSimilarLogs performs semantic search using vector embeddings
-// This function finds logs with similar meaning using the embeddings we generated
-func (s *AIService) SearchSimilarLogs(searchText string, limit int) (*types.QueryResponse, error) {
+// SearchSimilarLogs performs hybrid search: logs with a similar meaning, using the embeddings we
+// generated, or sharing keywords with the search text, ranked by a blend of both (see
+// searchReadings). The filter is applied in the query, so it does not thin out the closest matches
+// Cancelling ctx aborts the embedding request and cancels the vector search on the server
+func (s *AIService) SearchSimilarLogs(ctx context.Context, searchText string, limit int, filter SearchFilter) (*types.QueryResponse, error) {
+	if s.demo != nil {
+		return nil, ErrDemoUnavailable
+	}
 
 	// Step 1: Generate embedding for the search query
-	queryEmbedding, err := s.generateEmbedding(searchText)
+	queryEmbedding, err := s.generateEmbedding(ctx, searchText)
 	if err != nil {
 
 		return nil, fmt.Errorf("failed to generate embedding: %w", err)
@@ -109,82 +205,29 @@ func (s *AIService) SearchSimilarLogs(searchText string, limit int) (*types.Quer
 	// Step 3: Create pgvector vector
 	embeddingVec := pgvector.NewVector(embedding32)
 
-	// Step 4: Perform vector similarity search using pgvector on sensor_readings_embeddings
-	searchQuery := `
-		SELECT 
-			time,
-			device_id,
-			device_type,
-			location,
-			raw_value,
-			unit,
-			log_type,
-			COALESCE(message, '') as message,
-			embedding <=> $1 as distance
-		FROM sensor_readings_embeddings
-		WHERE embedding IS NOT NULL
-		ORDER BY distance ASC
-		LIMIT $2
-	`
-
-	// Log the semantic search query
-	log.Printf("🔍 SEMANTIC SEARCH:")
-	log.Printf("   Table Used: sensor_readings_embeddings (EMBEDDINGS)")
-	log.Printf("   Reason: Vector similarity search now uses the new embeddings table")
-	log.Printf("   ---")
-
-	rows, err := s.db.Query(searchQuery, embeddingVec, limit)
+	// Step 4: Search sensor_readings_embeddings by embedding distance and keywords
+	slog.DebugContext(ctx, "Semantic search", "table", "sensor_readings_embeddings", "limit", limit,
+		"keyword_weight", s.keywordWeight)
+	results, err := s.searchReadings(ctx, embeddingVec, searchText, limit, filter)
 	if err != nil {
-
 		return nil, fmt.Errorf("vector search failed: %w", err)
 	}
-	defer rows.Close()
-
-	// Step 5: Collect results with distance scores
-	var results []types.SearchResult
-	for rows.Next() {
-		var result types.SearchResult
-		var time time.Time
-		var deviceType, location, unit, logType, message string
-		var rawValue *float64
-
-		err := rows.Scan(
-			&time,
-			&result.DeviceID,
-			&deviceType,
-			&location,
-			&rawValue,
-			&unit,
-			&logType,
-			&message,
-			&result.Distance,
-		)
-		if err != nil {
-			continue
-		}
-
-		result.Time = time.Format("2006-01-02T15:04:05Z07:00")
-		result.DeviceType = deviceType
-		result.Location = location
-		result.LogType = logType
-		result.Chunk = message
-		result.ChunkSeq = 0
-		result.EmbeddingUUID = ""
-		result.RawValue = rawValue
-		result.Unit = unit
-
-		results = append(results, result)
-	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating results: %w", err)
+	// Step 5: Find earlier conclusions about similar situations; readings are still returned when this fails
+	knowledge := []types.KnowledgeResult{}
+	if s.knowledge != nil {
+		if knowledge, err = s.searchKnowledge(ctx, embeddingVec, limit, filter); err != nil {
+			slog.WarnContext(ctx, "Knowledge search failed", "error", err)
+			knowledge = []types.KnowledgeResult{}
+		}
 	}
 
 	// Step 6: Format results as JSON string for the response
 	searchResponse := types.SearchResponse{
-		Results: results,
-		Count:   len(results),
-		Query:   searchText,
+		Results:   results,
+		Count:     len(results),
+		Query:     searchText,
+		Knowledge: knowledge,
 	}
 
 	return &types.QueryResponse{
@@ -197,9 +240,9 @@ func (s *AIService) SearchSimilarLogs(searchText string, limit int) (*types.Quer
 
 // TestEmbeddingGeneration tests the OpenAI embedding generation
 func (s *AIService) TestEmbeddingGeneration() error {
-	log.Println("Testing OpenAI embedding generation...")
+	slog.Info("Testing OpenAI embedding generation")
 
-	_, err := s.generateEmbedding("test message for embedding generation")
+	_, err := s.generateEmbedding(context.Background(), "test message for embedding generation")
 	if err != nil {
 		return fmt.Errorf("embedding generation failed: %w", err)
 	}
@@ -207,18 +250,109 @@ func (s *AIService) TestEmbeddingGeneration() error {
 	return nil
 }
 
+// QueryEmitter receives the progress of a streamed query as named events (see StreamQuery)
+// An error it returns stops the query
+type QueryEmitter func(event string, data interface{}) error
+
+// emit sends an event when the query is streamed
+func (e QueryEmitter) emit(event string, data interface{}) error {
+	if e == nil {
+		return nil
+	}
+	return e(event, data)
+}
+
+// tokens passes generated SQL on as "token" events; nil when the query is not streamed
+func (e QueryEmitter) tokens() func(string) error {
+	if e == nil {
+		return nil
+	}
+	return func(text string) error {
+		return e("token", map[string]string{"text": text})
+	}
+}
+
 // QueryLogs performs intelligent query routing between semantic search and text-to-SQL
-func (s *AIService) QueryLogs(query string) (*types.QueryResponse, error) {
+// The route is limited by the caller's role: data questions from operators return the generated
+// SQL for an admin to approve instead of executing it, and viewers get a summary of recent logs
+// Cancelling ctx (client disconnect or explicit cancel) stops the LLM call and cancels running SQL
+func (s *AIService) QueryLogs(ctx context.Context, query string, role roles.Role) (*types.QueryResponse, error) {
+	return s.StreamQuery(ctx, query, role, nil)
+}
+
+// StreamQuery is QueryLogs reporting its progress to emit as it goes, so a client can show the
+// answer taking shape instead of waiting for the whole model round trip. Events: "route"
+// {"query_type"} once the question is routed, "token" {"text"} for each piece of SQL as the model
+// writes it, "sql" {"sql", "query_type", "explanation"} once the SQL passed the guardrails and
+// before it runs, and "results" {"relevant_logs", "related_knowledge", "log_count"} when a pattern
+// search found its logs, before the answer is written. The complete response is returned as usual
+func (s *AIService) StreamQuery(ctx context.Context, query string, role roles.Role, emit QueryEmitter) (*types.QueryResponse, error) {
+	if s.demo != nil {
+		return s.demoAnswer(ctx, query)
+	}
+
 	// Determine if this is a data query (text-to-SQL) or pattern search (semantic search)
 	queryType := s.determineQueryType(query)
+	route := "summary"
+	switch {
+	case queryType == "data_query" && Allowed(role, CapabilitySQL):
+		route = "data_query"
+	case queryType == "data_query" && Allowed(role, CapabilitySearch):
+		route = "sql_draft"
+	case Allowed(role, CapabilitySearch):
+		route = "pattern_search"
+	}
+	if err := emit.emit("route", map[string]string{"query_type": route}); err != nil {
+		return nil, err
+	}
 
-	if queryType == "data_query" {
+	switch route {
+	case "data_query":
 		// Use text-to-SQL for specific data queries
-		return s.textToSQL.ConvertToSQL(query)
-	} else {
+		return s.textToSQL.convertToSQL(ctx, query, emit)
+
+	case "sql_draft":
+		response, err := s.textToSQL.StreamDraftSQL(ctx, query, emit.tokens())
+		if err != nil {
+			return nil, err
+		}
+		response.Notice = fmt.Sprintf("SQL execution requires the %s role; the generated query was returned for approval", roles.Admin)
+		return response, nil
+
+	case "pattern_search":
 		// Use semantic search for pattern discovery and insights
-		return s.performSemanticSearch(query)
+		return s.performSemanticSearch(ctx, query, emit)
+	}
+
+	response, err := s.SummarizeLogsContext(ctx, "24h")
+	if err != nil {
+		return nil, err
+	}
+	response.Query = query
+	response.Notice = fmt.Sprintf("The %s role can only use summaries; showing a summary of the last 24h", role)
+	return response, nil
+}
+
+// StreamSQL drafts the SQL answering a data question, passing it to onToken as the model writes it
+// Nothing is executed: the draft is checked by the guardrails and returned for review, to be run
+// through ExecuteApprovedSQL by a role that may execute SQL
+func (s *AIService) StreamSQL(ctx context.Context, query string, role roles.Role, onToken func(string) error) (*types.QueryResponse, error) {
+	if s.demo != nil {
+		return s.demoDraft(query, onToken)
+	}
+	response, err := s.textToSQL.StreamDraftSQL(ctx, query, onToken)
+	if err != nil {
+		return nil, err
 	}
+	if !Allowed(role, CapabilitySQL) {
+		response.Notice = fmt.Sprintf("SQL execution requires the %s role; the generated query was returned for approval", roles.Admin)
+	}
+	return response, nil
+}
+
+// ExecuteApprovedSQL runs SQL that was returned for approval or confirmation (see QueryLogs)
+func (s *AIService) ExecuteApprovedSQL(ctx context.Context, query, sqlQuery string, confirmed bool) (*types.QueryResponse, error) {
+	return s.textToSQL.ExecuteApproved(ctx, query, sqlQuery, confirmed)
 }
 
 // determineQueryType decides whether to use text-to-SQL or semantic search
@@ -227,12 +361,15 @@ func (s *AIService) determineQueryType(query string) string {
 
 	// Keywords that suggest specific data queries (use text-to-SQL)
 	dataKeywords := []string{
-		"show me", "what is", "how many", "average", "count", "temperature",
-		"humidity", "motion", "camera", "controller", "device", "location",
+		"show me", "what is", "how many", "average", "count", "device", "location",
 		"last hour", "last 24 hours", "yesterday", "today", "this week",
 		"above", "below", "between", "greater than", "less than",
 		"raw_value", "unit", "time", "hour", "day", "week", "month",
 	}
+	// and the names of the registered device types, e.g. "temperature"
+	for _, t := range devicetypes.All() {
+		dataKeywords = append(dataKeywords, strings.ToLower(t.Label))
+	}
 
 	// Keywords that suggest pattern discovery (use semantic search)
 	patternKeywords := []string{
@@ -267,9 +404,9 @@ func (s *AIService) determineQueryType(query string) string {
 }
 
 // performSemanticSearch handles pattern discovery queries
-func (s *AIService) performSemanticSearch(query string) (*types.QueryResponse, error) {
+func (s *AIService) performSemanticSearch(ctx context.Context, query string, emit QueryEmitter) (*types.QueryResponse, error) {
 	// Use existing semantic search functionality but updated for sensor_readings
-	searchResults, err := s.SearchSimilarLogs(query, 10)
+	searchResults, err := s.SearchSimilarLogs(ctx, query, 10, SearchFilter{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to perform semantic search: %w", err)
 	}
@@ -279,17 +416,28 @@ func (s *AIService) performSemanticSearch(query string) (*types.QueryResponse, e
 	if !ok {
 		return nil, fmt.Errorf("unexpected result type from search")
 	}
+	if err := emit.emit("results", map[string]interface{}{
+		"relevant_logs":     searchResponse.Results,
+		"log_count":         searchResponse.Count,
+		"related_knowledge": searchResponse.Knowledge,
+	}); err != nil {
+		return nil, err
+	}
 
 	// Generate a natural language answer based on the results
-	answer := s.generateAnswerFromResults(query, searchResponse.Results)
+	answer := s.generateAnswerFromResults(query, searchResponse.Results, searchResponse.Knowledge)
+	if s.textToSQL != nil {
+		answer = localize(ctx, s.textToSQL.llm, answer)[0]
+	}
 
 	return &types.QueryResponse{
 		Success: true,
 		Result: map[string]interface{}{
-			"answer":        answer,
-			"relevant_logs": searchResponse.Results,
-			"log_count":     searchResponse.Count,
-			"query_type":    "pattern_search",
+			"answer":            answer,
+			"relevant_logs":     searchResponse.Results,
+			"log_count":         searchResponse.Count,
+			"related_knowledge": searchResponse.Knowledge,
+			"query_type":        "pattern_search",
 		},
 		Query: query,
 		Time:  time.Now(),
@@ -298,23 +446,22 @@ func (s *AIService) performSemanticSearch(query string) (*types.QueryResponse, e
 
 // SummarizeLogs generates AI-powered summaries of recent logs
 func (s *AIService) SummarizeLogs(timeRange string) (*types.QueryResponse, error) {
+	return s.SummarizeLogsContext(context.Background(), timeRange)
+}
 
-	// Step 1: Get recent logs from the database
-	logs, err := s.getRecentLogs(timeRange)
+// SummarizeLogsContext is SummarizeLogs written in the language requested on ctx
+// The chat model narrates the range from its aggregate statistics and distinct WARN/ERROR
+// messages; without it (or when it fails) the summary falls back to the counts
+func (s *AIService) SummarizeLogsContext(ctx context.Context, timeRange string) (*types.QueryResponse, error) {
+	summary, insights, count, err := s.summarizeRange(ctx, timeRange)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get recent logs: %w", err)
+		return nil, err
 	}
 
-	// Step 2: Generate summary
-	summary := s.generateSummary(logs, timeRange)
-
-	// Step 3: Extract key insights
-	insights := s.extractKeyInsights(logs)
-
 	summaryResponse := types.SummaryResponse{
 		Summary:     summary,
 		TimeRange:   timeRange,
-		LogCount:    len(logs),
+		LogCount:    count,
 		KeyInsights: insights,
 	}
 
@@ -326,37 +473,70 @@ func (s *AIService) SummarizeLogs(timeRange string) (*types.QueryResponse, error
 	}, nil
 }
 
-// DetectAnomalies uses AI to identify unusual patterns in device logs
+// DetectAnomalies flags outliers, rate-of-change spikes and silent devices in the last 24h of readings
 func (s *AIService) DetectAnomalies() (*types.QueryResponse, error) {
+	return s.DetectAnomaliesContext(context.Background(), "24h")
+}
+
+// DetectAnomaliesContext flags anomalies in the readings of a range (see timerange.Parse)
+// Readings are read page by page, so the whole range is scanned however many readings it holds
+func (s *AIService) DetectAnomaliesContext(ctx context.Context, timeRange string) (*types.QueryResponse, error) {
+	r, err := timerange.Parse(timeRange, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRange, err)
+	}
 
-	// Step 1: Get recent logs
-	logs, err := s.getRecentLogs("24h")
+	// Step 1: Feed the range's readings to the detector oldest first, so each device's history builds up in order
+	var baselines map[string]anomaly.Baseline
+	if s.detector.Baselines {
+		baselines = s.baselines.Baselines()
+	}
+	detector := anomaly.NewDetector(s.detector, baselines)
+	var anomalies []types.Anomaly
+	err = db.EachReadingBetween(ctx, s.db, db.ReadingFilter{}, r.Start, r.End, func(reading types.LogMessage) error {
+		anomalies = append(anomalies, detector.Observe(reading)...)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get recent logs: %w", err)
+		return nil, fmt.Errorf("failed to read readings: %w", err)
 	}
 
-	// Step 2: Detect anomalies
-	anomalies := s.detectAnomalies(logs)
+	// Step 2: Flag the devices still silent at the end of the range
+	anomalies = append(anomalies, detector.Silent(r.End)...)
+
+	// Step 3: Attach recent readings, related logs and the aggregate window to the newest anomalies
+	// (two queries each, so older ones go without)
+	for i := max(len(anomalies)-s.enrichLimit, 0); i < len(anomalies); i++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err := s.enricher.Enrich(&anomalies[i]); err != nil {
+			slog.Warn("Failed to enrich anomaly", "device_id", anomalies[i].DeviceID, "error", err)
+		}
+	}
 
 	anomalyResponse := types.AnomalyResponse{
 		Anomalies:  anomalies,
 		TotalFound: len(anomalies),
-		TimeRange:  "24h",
+		TimeRange:  timeRange,
 	}
 
 	return &types.QueryResponse{
 		Success: true,
 		Result:  anomalyResponse,
-		Query:   "Detect anomalies in recent logs",
+		Query:   "Detect anomalies in " + r.String(),
 		Time:    time.Now(),
 	}, nil
 }
 
 // Helper functions for the AI endpoints
-func (s *AIService) generateAnswerFromResults(query string, results []types.SearchResult) string {
-	if len(results) == 0 {
+func (s *AIService) generateAnswerFromResults(query string, results []types.SearchResult, knowledge []types.KnowledgeResult) string {
+	if len(results) == 0 && len(knowledge) == 0 {
 		return "I couldn't find any relevant logs to answer your question."
 	}
+	if len(results) == 0 {
+		return "I couldn't find any relevant logs, but this came up before:\n\n" + knowledgeAnswer(knowledge)
+	}
 
 	// Simple answer generation based on search results
 	answer := fmt.Sprintf("Based on %d relevant logs, here's what I found:\n\n", len(results))
@@ -368,116 +548,25 @@ func (s *AIService) generateAnswerFromResults(query string, results []types.Sear
 		answer += fmt.Sprintf("• %s (Device: %s, Similarity: %.2f)\n",
 			result.Chunk, result.DeviceID, result.Distance)
 	}
-
-	return answer
-}
-
-func (s *AIService) getRecentLogs(timeRange string) ([]types.LogMessage, error) {
-	// Parse time range and get logs from database
-	// This is a simplified version - you'd implement proper time parsing
-	query := `
-		SELECT time, device_id, log_type, message 
-		FROM device_logs 
-		WHERE time > NOW() - INTERVAL '1 hour'
-		ORDER BY time DESC 
-		LIMIT 100
-	`
-
-	rows, err := s.db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var logs []types.LogMessage
-	for rows.Next() {
-		var log types.LogMessage
-		if err := rows.Scan(&log.Time, &log.DeviceID, &log.LogType); err != nil {
-			return nil, err
-		}
-		logs = append(logs, log)
+	if len(knowledge) > 0 {
+		answer += "\nThis came up before:\n\n" + knowledgeAnswer(knowledge)
 	}
 
-	return logs, nil
-}
-
-func (s *AIService) generateSummary(logs []types.LogMessage, timeRange string) string {
-	if len(logs) == 0 {
-		return fmt.Sprintf("No logs found in the last %s.", timeRange)
-	}
-
-	// Count log types
-	infoCount := 0
-	warnCount := 0
-	errorCount := 0
-	deviceCount := make(map[string]bool)
-
-	for _, log := range logs {
-		switch log.LogType {
-		case "INFO":
-			infoCount++
-		case "WARN":
-			warnCount++
-		case "ERROR":
-			errorCount++
-		}
-		deviceCount[log.DeviceID] = true
-	}
-
-	summary := fmt.Sprintf("In the last %s, %d logs were generated across %d devices:\n",
-		timeRange, len(logs), len(deviceCount))
-	summary += fmt.Sprintf("• %d INFO logs\n", infoCount)
-	summary += fmt.Sprintf("• %d WARN logs\n", warnCount)
-	summary += fmt.Sprintf("• %d ERROR logs\n", errorCount)
-
-	return summary
+	return answer
 }
 
-func (s *AIService) extractKeyInsights(logs []types.LogMessage) []string {
-	var insights []string
-
-	if len(logs) == 0 {
-		return insights
-	}
-
-	// Simple insight extraction
-	errorCount := 0
-	for _, log := range logs {
-		if log.LogType == "ERROR" {
-			errorCount++
+// knowledgeAnswer lists the closest earlier conclusions, e.g. "• incident Compressor failure (2024-05-01T10:00:00Z): ..."
+func knowledgeAnswer(knowledge []types.KnowledgeResult) string {
+	var b strings.Builder
+	for i, k := range knowledge {
+		if i >= 2 {
+			break
 		}
-	}
-
-	if errorCount > 0 {
-		insights = append(insights, fmt.Sprintf("Found %d error logs that may need attention", errorCount))
-	}
-
-	if len(logs) > 50 {
-		insights = append(insights, "High log volume detected - consider reviewing system health")
-	}
-
-	return insights
-}
-
-func (s *AIService) detectAnomalies(logs []types.LogMessage) []types.Anomaly {
-	var anomalies []types.Anomaly
-
-	// Simple anomaly detection
-	for _, log := range logs {
-		// Detect error spikes
-		if log.LogType == "ERROR" {
-			anomaly := types.Anomaly{
-				Time:     log.Time,
-				DeviceID: log.DeviceID,
-				Type:     "Error",
-				Severity: "High",
-
-				Confidence: 0.8,
-			}
-			anomalies = append(anomalies, anomaly)
+		title := k.Title
+		if title == "" {
+			title = k.SourceID
 		}
-
+		fmt.Fprintf(&b, "• %s %s (%s): %s\n", k.Kind, title, k.Time, k.Content)
 	}
-
-	return anomalies
+	return b.String()
 }
@@ -0,0 +1,241 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ShadowConfig picks the candidate a share of text-to-SQL requests are also run against
+type ShadowConfig struct {
+	Percent       float64       `json:"percent"`        // share of requests shadowed, 0-100; 0 disables (AI_SHADOW_PERCENT)
+	Model         string        `json:"model"`          // candidate chat model (AI_SHADOW_MODEL, default the live one)
+	PromptVersion int           `json:"prompt_version"` // candidate text_to_sql version, 0 being the built-in one; -1 uses the active one (AI_SHADOW_PROMPT_VERSION)
+	Timeout       time.Duration `json:"-"`              // bound on one shadow run (AI_SHADOW_TIMEOUT, default 1m)
+	Concurrency   int           `json:"-"`              // shadow runs in flight; requests past it are not shadowed (AI_SHADOW_CONCURRENCY, default 2)
+}
+
+// LoadShadowConfig reads the shadow configuration from the environment; liveModel is the sql use
+// case's model, which the candidate runs on the same provider as
+func LoadShadowConfig(liveModel string) ShadowConfig {
+	config := ShadowConfig{Model: liveModel, PromptVersion: -1, Timeout: time.Minute, Concurrency: 2}
+	if f, err := strconv.ParseFloat(os.Getenv("AI_SHADOW_PERCENT"), 64); err == nil && f > 0 {
+		config.Percent = min(f, 100)
+	}
+	if model := os.Getenv("AI_SHADOW_MODEL"); model != "" {
+		config.Model = model
+	}
+	if n, err := strconv.Atoi(os.Getenv("AI_SHADOW_PROMPT_VERSION")); err == nil && n >= 0 {
+		config.PromptVersion = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("AI_SHADOW_TIMEOUT")); err == nil && d > 0 {
+		config.Timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("AI_SHADOW_CONCURRENCY")); err == nil && n > 0 {
+		config.Concurrency = n
+	}
+	return config
+}
+
+// ShadowRun is what one side of a shadowed request produced
+type ShadowRun struct {
+	Model         string   `json:"model"`
+	PromptVersion int      `json:"prompt_version"`
+	SQL           string   `json:"sql,omitempty"`
+	LatencyMs     float64  `json:"latency_ms"`
+	Valid         bool     `json:"valid"`          // the SQL passed the guardrails
+	Cost          *float64 `json:"cost,omitempty"` // planner estimate of valid SQL
+	Error         string   `json:"error,omitempty"`
+}
+
+// ShadowResult is a recorded comparison of the live and candidate runs of one request
+type ShadowResult struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Query      string    `json:"query"`
+	Primary    ShadowRun `json:"primary"`
+	Candidate  ShadowRun `json:"candidate"`
+	SameOutput bool      `json:"same_output"`
+}
+
+// ShadowSummary aggregates the recorded comparisons of a period
+type ShadowSummary struct {
+	Runs                  int     `json:"runs"`
+	SameOutput            int     `json:"same_output"`
+	PrimaryValid          int     `json:"primary_valid"`
+	CandidateValid        int     `json:"candidate_valid"`
+	CandidateErrors       int     `json:"candidate_errors"`
+	AvgPrimaryLatencyMs   float64 `json:"avg_primary_latency_ms"`
+	AvgCandidateLatencyMs float64 `json:"avg_candidate_latency_ms"`
+}
+
+// Shadow runs a sample of text-to-SQL requests a second time against the candidate prompt and
+// model in the background and records both results in ai_shadow_runs; the caller only ever sees
+// the live result. A nil Shadow never runs
+type Shadow struct {
+	db     *sql.DB
+	config ShadowConfig
+	slots  chan struct{}
+}
+
+// NewShadow creates a shadow runner; it is disabled while config.Percent is 0
+func NewShadow(db *sql.DB, config ShadowConfig) *Shadow {
+	return &Shadow{db: db, config: config, slots: make(chan struct{}, max(config.Concurrency, 1))}
+}
+
+// Config returns the candidate configuration
+func (sh *Shadow) Config() ShadowConfig {
+	if sh == nil {
+		return ShadowConfig{}
+	}
+	return sh.config
+}
+
+// maybeRun samples a request that produced primary and, if chosen, runs the candidate in the background
+func (sh *Shadow) maybeRun(ctx context.Context, svc *TextToSQLService, query string, primary ShadowRun) {
+	if sh == nil || sh.db == nil || sh.config.Percent <= 0 || rand.Float64()*100 >= sh.config.Percent {
+		return
+	}
+	select {
+	case sh.slots <- struct{}{}:
+	default:
+		slog.DebugContext(ctx, "Shadow runs busy, skipping request")
+		return
+	}
+
+	// The run outlives the request, so it gets a context of its own: cancelling the request or
+	// tracing it with debug=true must not reach the candidate
+	go func() {
+		defer func() { <-sh.slots }()
+		ctx, cancel := context.WithTimeout(context.Background(), sh.config.Timeout)
+		defer cancel()
+		if err := sh.run(ctx, svc, query, primary); err != nil {
+			slog.Warn("Shadow run failed", "error", err)
+		}
+	}()
+}
+
+// run generates the candidate SQL, checks both sides and records the comparison
+func (sh *Shadow) run(ctx context.Context, svc *TextToSQLService, query string, primary ShadowRun) error {
+	vars := map[string]string{"Schema": textToSQLSchema()}
+	candidate := ShadowRun{Model: sh.config.Model, PromptVersion: sh.config.PromptVersion}
+
+	var systemPrompt string
+	if candidate.PromptVersion < 0 {
+		systemPrompt, candidate.PromptVersion = svc.prompts.Render(PromptTextToSQL, vars)
+	} else {
+		var err error
+		if systemPrompt, err = svc.prompts.RenderVersion(ctx, PromptTextToSQL, candidate.PromptVersion, vars); err != nil {
+			return err
+		}
+	}
+
+	started := time.Now()
+	sqlQuery, err := svc.completeSQL(ctx, candidate.Model, systemPrompt, query, nil)
+	candidate.LatencyMs = msSince(started)
+	if err != nil {
+		candidate.Error = err.Error()
+	} else {
+		candidate.SQL = sqlQuery
+		sh.check(ctx, svc, &candidate)
+	}
+	sh.check(ctx, svc, &primary)
+
+	primaryJSON, err := json.Marshal(primary)
+	if err != nil {
+		return err
+	}
+	candidateJSON, err := json.Marshal(candidate)
+	if err != nil {
+		return err
+	}
+	_, err = sh.db.ExecContext(ctx, `
+        INSERT INTO ai_shadow_runs (kind, query, primary_run, candidate_run, same_output)
+        VALUES ($1, $2, $3, $4, $5)
+    `, PromptTextToSQL, query, primaryJSON, candidateJSON, candidate.Error == "" && candidate.SQL == primary.SQL)
+	if err != nil {
+		return fmt.Errorf("failed to record shadow run: %w", err)
+	}
+	return nil
+}
+
+// check runs the SQL of a side through the guardrails and, if it passes, the planner
+// Neither side's SQL is executed
+func (sh *Shadow) check(ctx context.Context, svc *TextToSQLService, run *ShadowRun) {
+	checked, err := svc.guardrails.Check(run.SQL)
+	if err != nil {
+		run.Error = "query rejected: " + err.Error()
+		return
+	}
+	run.Valid = true
+
+	tx, err := sh.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if estimate, err := explain(ctx, tx, checked); err == nil {
+		run.Cost = &estimate.Cost
+	}
+}
+
+// Results returns the comparisons recorded since a time, newest first, with a summary of all of them
+func (sh *Shadow) Results(ctx context.Context, since time.Time, limit int) ([]ShadowResult, ShadowSummary, error) {
+	var summary ShadowSummary
+	err := sh.db.QueryRowContext(ctx, `
+        SELECT count(*),
+               count(*) FILTER (WHERE same_output),
+               count(*) FILTER (WHERE (primary_run->>'valid')::boolean),
+               count(*) FILTER (WHERE (candidate_run->>'valid')::boolean),
+               count(*) FILTER (WHERE candidate_run ? 'error'),
+               COALESCE(avg((primary_run->>'latency_ms')::float8), 0),
+               COALESCE(avg((candidate_run->>'latency_ms')::float8), 0)
+        FROM ai_shadow_runs
+        WHERE time >= $1
+    `, since).Scan(&summary.Runs, &summary.SameOutput, &summary.PrimaryValid, &summary.CandidateValid,
+		&summary.CandidateErrors, &summary.AvgPrimaryLatencyMs, &summary.AvgCandidateLatencyMs)
+	if err != nil {
+		return nil, summary, err
+	}
+
+	rows, err := sh.db.QueryContext(ctx, `
+        SELECT id, time, kind, query, primary_run, candidate_run, same_output
+        FROM ai_shadow_runs
+        WHERE time >= $1
+        ORDER BY time DESC
+        LIMIT $2
+    `, since, limit)
+	if err != nil {
+		return nil, summary, err
+	}
+	defer rows.Close()
+
+	results := []ShadowResult{}
+	for rows.Next() {
+		var r ShadowResult
+		var primary, candidate []byte
+		if err := rows.Scan(&r.ID, &r.Time, &r.Kind, &r.Query, &primary, &candidate, &r.SameOutput); err != nil {
+			return nil, summary, err
+		}
+		if err := json.Unmarshal(primary, &r.Primary); err != nil {
+			return nil, summary, err
+		}
+		if err := json.Unmarshal(candidate, &r.Candidate); err != nil {
+			return nil, summary, err
+		}
+		results = append(results, r)
+	}
+	return results, summary, rows.Err()
+}
+
+// msSince returns the milliseconds elapsed since start
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
@@ -0,0 +1,496 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultSQLTables are the relations generated SQL may read: the raw readings and their aggregates
+var DefaultSQLTables = []string{
+	"sensor_readings",
+	"five_min_sensor_averages",
+	"hourly_sensor_averages",
+	"daily_sensor_averages",
+	"daily_device_activity",
+}
+
+// forbiddenKeywords can never appear in generated SQL, even inside a CTE or subquery
+var forbiddenKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "RENAME": true,
+	"GRANT": true, "REVOKE": true, "COPY": true, "CALL": true, "DO": true,
+	"EXECUTE": true, "PREPARE": true, "DEALLOCATE": true, "VACUUM": true, "ANALYZE": true,
+	"CLUSTER": true, "REINDEX": true, "LOCK": true, "SET": true, "RESET": true,
+	"LISTEN": true, "NOTIFY": true, "LOAD": true, "INTO": true, "REFRESH": true,
+	"COMMENT": true, "SECURITY": true, "DISCARD": true, "CHECKPOINT": true,
+}
+
+// forbiddenFunctions reach outside the query (files, sessions, other servers) or stall the database
+var forbiddenFunctions = map[string]bool{
+	"pg_sleep": true, "pg_sleep_for": true, "pg_sleep_until": true,
+	"pg_read_file": true, "pg_read_binary_file": true, "pg_ls_dir": true, "pg_stat_file": true,
+	"lo_import": true, "lo_export": true, "lo_get": true,
+	"dblink": true, "dblink_exec": true, "set_config": true, "current_setting": true,
+	"pg_terminate_backend": true, "pg_cancel_backend": true, "pg_reload_conf": true,
+	"query_to_xml": true, "query_to_json": true,
+	"pg_current_logfile": true, "pg_show_all_settings": true, "inet_server_addr": true, "inet_server_port": true,
+}
+
+// forbiddenFunctionPrefixes are families of functions that introspect the server: listing its
+// directories (pg_ls_logdir, pg_ls_waldir, pg_ls_tmpdir...), reading its files, its settings and
+// large objects. A read-only transaction does not stop them
+var forbiddenFunctionPrefixes = []string{"pg_ls_", "pg_read_", "pg_stat_file", "pg_file_", "current_setting", "lo_"}
+
+// isCall reports whether the tokens after a name open its argument list
+func isCall(rest []sqlToken) bool {
+	return len(rest) > 0 && rest[0].text == "("
+}
+
+// hasForbiddenPrefix reports whether a function name is in one of forbiddenFunctionPrefixes
+func hasForbiddenPrefix(name string) bool {
+	for _, prefix := range forbiddenFunctionPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromFunctions take FROM inside their parentheses without it introducing a table
+var fromFunctions = map[string]bool{
+	"EXTRACT": true, "SUBSTRING": true, "TRIM": true, "OVERLAY": true, "POSITION": true,
+}
+
+// SQLGuardrails restricts what generated SQL may do before it reaches the database:
+// a single SELECT (or WITH ... SELECT) reading only whitelisted tables, returning at most MaxRows rows
+type SQLGuardrails struct {
+	Tables  map[string]bool
+	MaxRows int
+}
+
+// LoadSQLGuardrails reads AI_SQL_ALLOWED_TABLES (comma-separated, default DefaultSQLTables)
+// and AI_SQL_ROW_LIMIT (default 1000)
+func LoadSQLGuardrails() SQLGuardrails {
+	tables := DefaultSQLTables
+	if v := os.Getenv("AI_SQL_ALLOWED_TABLES"); v != "" {
+		tables = strings.Split(v, ",")
+	}
+	maxRows := 1000
+	if n, err := strconv.Atoi(os.Getenv("AI_SQL_ROW_LIMIT")); err == nil && n > 0 {
+		maxRows = n
+	}
+	return NewSQLGuardrails(tables, maxRows)
+}
+
+// NewSQLGuardrails builds guardrails for the given tables; maxRows <= 0 disables the row cap
+func NewSQLGuardrails(tables []string, maxRows int) SQLGuardrails {
+	g := SQLGuardrails{Tables: make(map[string]bool), MaxRows: maxRows}
+	for _, t := range tables {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			g.Tables[t] = true
+		}
+	}
+	return g
+}
+
+// Check validates sqlQuery and returns the SQL to run, with the row cap applied
+// A top-level LIMIT within the cap is kept; anything else is wrapped in an outer LIMIT
+func (g SQLGuardrails) Check(sqlQuery string) (string, error) {
+	tokens, err := lexSQL(sqlQuery)
+	if err != nil {
+		return "", err
+	}
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("sql is required")
+	}
+
+	if first := tokens[0].upper(); first != "SELECT" && first != "WITH" {
+		return "", fmt.Errorf("only SELECT queries can be executed")
+	}
+
+	ctes := make(map[string]bool)
+	for i, t := range tokens {
+		// Quoted names are checked too, lower-cased, so "pg_sleep"(30) cannot slip through
+		ident := ""
+		if t.kind == tokenWord || t.kind == tokenQuoted {
+			ident = strings.ToLower(t.name())
+		}
+		switch {
+		case t.text == ";":
+			return "", fmt.Errorf("only a single statement is allowed")
+		case forbiddenKeywords[strings.ToUpper(ident)]:
+			return "", fmt.Errorf("%s is not allowed in generated SQL", strings.ToUpper(ident))
+		case forbiddenFunctions[ident] || (isCall(tokens[i+1:]) && hasForbiddenPrefix(ident)):
+			return "", fmt.Errorf("function %s is not allowed in generated SQL", ident)
+		case t.kind == tokenWord && t.upper() == "AS" && i > 0 && isCTEBody(tokens[i+1:]):
+			ctes[cteName(tokens[:i])] = true
+		}
+	}
+
+	for _, table := range referencedTables(tokens) {
+		if !ctes[table] && !g.Tables[table] {
+			return "", fmt.Errorf("table %s is not allowed in generated SQL", table)
+		}
+	}
+
+	trimmed := strings.TrimSpace(sqlQuery[:tokens[len(tokens)-1].end])
+	if g.MaxRows <= 0 {
+		return trimmed, nil
+	}
+	if limit, ok := topLevelLimit(tokens); ok && limit <= g.MaxRows {
+		return trimmed, nil
+	}
+	return fmt.Sprintf("SELECT * FROM (\n%s\n) AS capped LIMIT %d", trimmed, g.MaxRows), nil
+}
+
+// QueryTables lists the tables and views a statement reads, without CTE names or repeats; nil when
+// the statement cannot be lexed
+func QueryTables(sqlQuery string) []string {
+	tokens, err := lexSQL(sqlQuery)
+	if err != nil {
+		return nil
+	}
+	ctes := make(map[string]bool)
+	for i, t := range tokens {
+		if t.kind == tokenWord && t.upper() == "AS" && i > 0 && isCTEBody(tokens[i+1:]) {
+			ctes[cteName(tokens[:i])] = true
+		}
+	}
+
+	tables := []string{}
+	seen := make(map[string]bool)
+	for _, table := range referencedTables(tokens) {
+		if !ctes[table] && !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// isCTEBody reports whether the tokens after an AS open a CTE body: ( or [NOT] MATERIALIZED (
+func isCTEBody(rest []sqlToken) bool {
+	for _, t := range rest {
+		switch t.upper() {
+		case "NOT", "MATERIALIZED":
+			continue
+		case "(":
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// cteName returns the name a CTE definition ending just before AS declares, skipping a column list
+func cteName(tokens []sqlToken) string {
+	i := len(tokens) - 1
+	if tokens[i].text == ")" {
+		for depth := 0; i >= 0; i-- {
+			if tokens[i].text == ")" {
+				depth++
+			} else if tokens[i].text == "(" {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		i--
+	}
+	if i < 0 {
+		return ""
+	}
+	return tokens[i].name()
+}
+
+// referencedTables lists the relations named after FROM and JOIN, lower-cased and schema-qualified as written
+func referencedTables(tokens []sqlToken) []string {
+	var tables []string
+	// openers holds, for every open parenthesis, the word right before it (a function name or "")
+	var openers []string
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.text {
+		case "(":
+			opener := ""
+			if i > 0 && tokens[i-1].kind == tokenWord {
+				opener = tokens[i-1].upper()
+			}
+			openers = append(openers, opener)
+			continue
+		case ")":
+			if len(openers) > 0 {
+				openers = openers[:len(openers)-1]
+			}
+			continue
+		}
+		if t.kind != tokenWord {
+			continue
+		}
+
+		switch t.upper() {
+		case "FROM":
+			if len(openers) > 0 && fromFunctions[openers[len(openers)-1]] || i > 0 && tokens[i-1].upper() == "DISTINCT" {
+				continue
+			}
+			var list []string
+			list, i = fromList(tokens, i+1, true)
+			tables = append(tables, list...)
+		case "JOIN":
+			var list []string
+			list, i = fromList(tokens, i+1, false)
+			tables = append(tables, list...)
+		}
+	}
+	return tables
+}
+
+// fromList reads table references starting at i, following commas when multi is set
+// It returns the position of the last token consumed
+func fromList(tokens []sqlToken, i int, multi bool) ([]string, int) {
+	var tables []string
+	for i < len(tokens) {
+		if tokens[i].upper() == "LATERAL" || tokens[i].upper() == "ONLY" {
+			i++
+			continue
+		}
+		if tokens[i].kind != tokenWord && tokens[i].kind != tokenQuoted {
+			// A subquery or anything else: let the main loop walk into it
+			return tables, i - 1
+		}
+
+		name := tokens[i].name()
+		for i+2 < len(tokens) && tokens[i+1].text == "." && tokens[i+2].kind != tokenSymbol {
+			name += "." + tokens[i+2].name()
+			i += 2
+		}
+		i++
+		// A function in FROM (generate_series(...)) is not a table
+		if i < len(tokens) && tokens[i].text == "(" {
+			return tables, i - 1
+		}
+		tables = append(tables, name)
+
+		// Skip an optional alias
+		if i < len(tokens) && tokens[i].upper() == "AS" {
+			i++
+		}
+		if i < len(tokens) && (tokens[i].kind == tokenQuoted || tokens[i].kind == tokenWord && !clauseKeyword(tokens[i].upper())) {
+			i++
+		}
+		if !multi || i >= len(tokens) || tokens[i].text != "," {
+			return tables, i - 1
+		}
+		i++
+	}
+	return tables, i - 1
+}
+
+// clauseKeyword reports whether a word ends a FROM item rather than aliasing it
+func clauseKeyword(word string) bool {
+	switch word {
+	case "WHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "OFFSET", "FETCH", "WINDOW", "UNION",
+		"INTERSECT", "EXCEPT", "JOIN", "INNER", "LEFT", "RIGHT", "FULL", "CROSS", "NATURAL",
+		"ON", "USING", "FOR", "TABLESAMPLE", "WITH", "SELECT":
+		return true
+	}
+	return false
+}
+
+// topLevelLimit returns the numeric LIMIT of the outermost query, if it has one
+func topLevelLimit(tokens []sqlToken) (int, bool) {
+	depth := 0
+	limit, found := 0, false
+	for i, t := range tokens {
+		switch t.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth != 0 || t.kind != tokenWord {
+			continue
+		}
+		switch t.upper() {
+		case "LIMIT":
+			if i+1 >= len(tokens) || tokens[i+1].kind != tokenNumber {
+				return 0, false
+			}
+			n, err := strconv.Atoi(tokens[i+1].text)
+			if err != nil {
+				return 0, false
+			}
+			limit, found = n, true
+		case "FETCH", "UNION", "INTERSECT", "EXCEPT":
+			// A later set operation or FETCH clause makes an earlier LIMIT apply to one branch only
+			found = false
+		}
+	}
+	return limit, found
+}
+
+type tokenKind int
+
+const (
+	tokenWord   tokenKind = iota // keywords and unquoted identifiers
+	tokenQuoted                  // "quoted identifiers"
+	tokenString                  // 'literals', E'...', $$dollar quoted$$
+	tokenNumber
+	tokenSymbol
+)
+
+type sqlToken struct {
+	kind tokenKind
+	text string
+	end  int // byte offset just past the token
+}
+
+func (t sqlToken) upper() string {
+	if t.kind != tokenWord && t.kind != tokenSymbol {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+// name is the identifier a word or quoted token refers to, as Postgres folds it
+func (t sqlToken) name() string {
+	if t.kind == tokenQuoted {
+		return strings.ReplaceAll(strings.Trim(t.text, `"`), `""`, `"`)
+	}
+	return strings.ToLower(t.text)
+}
+
+// lexSQL splits SQL into tokens, dropping comments and keeping literals opaque
+// so keywords hidden in strings or comments neither trip nor evade the checks
+func lexSQL(s string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+
+		case strings.HasPrefix(s[i:], "--"):
+			if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(s)
+			}
+
+		case strings.HasPrefix(s[i:], "/*"):
+			// Postgres block comments nest
+			depth, j := 0, i
+			for j < len(s) {
+				if strings.HasPrefix(s[j:], "/*") {
+					depth++
+					j += 2
+				} else if strings.HasPrefix(s[j:], "*/") {
+					depth--
+					j += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					j++
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i = j
+
+		case c == '\'' || (c == 'E' || c == 'e') && i+1 < len(s) && s[i+1] == '\'':
+			start := i
+			if c != '\'' {
+				i++
+			}
+			end, err := quotedEnd(s, i, '\'', c != '\'')
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, sqlToken{kind: tokenString, text: s[start:i], end: i})
+
+		case c == '"':
+			end, err := quotedEnd(s, i, '"', false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{kind: tokenQuoted, text: s[i:end], end: end})
+			i = end
+
+		case c == '$' && dollarTag(s[i:]) != "":
+			tag := dollarTag(s[i:])
+			end := strings.Index(s[i+len(tag):], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated dollar-quoted string")
+			}
+			start := i
+			i += len(tag) + end + len(tag)
+			tokens = append(tokens, sqlToken{kind: tokenString, text: s[start:i], end: i})
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			start := i
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.' || s[i] == 'e' || s[i] == 'E') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenNumber, text: s[start:i], end: i})
+
+		case isWordStart(rune(c)):
+			start := i
+			for i < len(s) && isWordPart(rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenWord, text: s[start:i], end: i})
+
+		default:
+			tokens = append(tokens, sqlToken{kind: tokenSymbol, text: s[i : i+1], end: i + 1})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// quotedEnd returns the offset just past the quote opened at s[i], treating doubled quotes
+// (and backslash escapes when escapes is set) as part of the literal
+func quotedEnd(s string, i int, quote byte, escapes bool) (int, error) {
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case escapes && s[j] == '\\':
+			j++
+		case s[j] == quote && j+1 < len(s) && s[j+1] == quote:
+			j++
+		case s[j] == quote:
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quoted string")
+}
+
+// dollarTag returns the $tag$ opening a dollar-quoted string at the start of s, or ""
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		if s[j] == '$' {
+			return s[:j+1]
+		}
+		if !isWordPart(rune(s[j])) || j == 1 && s[j] >= '0' && s[j] <= '9' {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isWordStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || r >= 0x80
+}
+
+func isWordPart(r rune) bool {
+	return isWordStart(r) || r == '$' || r >= '0' && r <= '9'
+}
@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSQLGuardrailsCheck(t *testing.T) {
+	g := NewSQLGuardrails(DefaultSQLTables, 100)
+	tests := []struct {
+		sql, want string
+	}{
+		{"SELECT * FROM sensor_readings LIMIT 10", "SELECT * FROM sensor_readings LIMIT 10"},
+		{"SELECT * FROM sensor_readings LIMIT 10;", "SELECT * FROM sensor_readings LIMIT 10"},
+		{"SELECT device_id FROM sensor_readings", "SELECT * FROM (\nSELECT device_id FROM sensor_readings\n) AS capped LIMIT 100"},
+		{"SELECT * FROM sensor_readings LIMIT 5000", "SELECT * FROM (\nSELECT * FROM sensor_readings LIMIT 5000\n) AS capped LIMIT 100"},
+		{"WITH recent AS (SELECT * FROM sensor_readings) SELECT * FROM recent LIMIT 1", "WITH recent AS (SELECT * FROM sensor_readings) SELECT * FROM recent LIMIT 1"},
+		{"SELECT extract(hour FROM time) FROM hourly_sensor_averages LIMIT 1", "SELECT extract(hour FROM time) FROM hourly_sensor_averages LIMIT 1"},
+		{"SELECT 'drop table' AS note FROM sensor_readings LIMIT 1", "SELECT 'drop table' AS note FROM sensor_readings LIMIT 1"},
+	}
+	for _, tt := range tests {
+		got, err := g.Check(tt.sql)
+		if err != nil {
+			t.Errorf("Check(%q): %v", tt.sql, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Check(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestSQLGuardrailsReject(t *testing.T) {
+	g := NewSQLGuardrails(DefaultSQLTables, 100)
+	for _, sql := range []string{
+		"",
+		"DELETE FROM sensor_readings",
+		"SELECT 1; DROP TABLE sensor_readings",
+		"SELECT * INTO copy FROM sensor_readings",
+		"WITH gone AS (DELETE FROM sensor_readings RETURNING *) SELECT * FROM gone",
+		"SELECT * FROM device_api_keys",
+		"SELECT * FROM sensor_readings, pg_shadow",
+		"SELECT pg_sleep(30)",
+		`SELECT "pg_sleep"(30)`,
+		`SELECT "PG_READ_FILE"('/etc/passwd')`,
+		"SELECT * FROM pg_ls_logdir()",
+		"SELECT pg_ls_waldir()",
+		`SELECT * FROM "pg_ls_tmpdir"()`,
+		"SELECT pg_stat_file('postgresql.conf')",
+		"SELECT current_setting('data_directory')",
+		"SELECT current_setting ('config_file', true)",
+		"SELECT pg_current_logfile()",
+		"SELECT lo_from_bytea(0, 'x')",
+		"SELECT * FROM sensor_readings WHERE message = 'unterminated",
+	} {
+		if got, err := g.Check(sql); err == nil {
+			t.Errorf("Check(%q) = %q, want an error", sql, got)
+		}
+	}
+}
+
+func TestQueryTables(t *testing.T) {
+	got := QueryTables("WITH r AS (SELECT * FROM sensor_readings) SELECT * FROM r JOIN daily_sensor_averages d ON true")
+	slices.Sort(got)
+	want := []string{"daily_sensor_averages", "sensor_readings"}
+	if !slices.Equal(got, want) {
+		t.Errorf("QueryTables = %v, want %v", got, want)
+	}
+}
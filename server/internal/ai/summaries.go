@@ -0,0 +1,195 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"edge-insights/internal/cron"
+	"edge-insights/internal/timerange"
+	"edge-insights/internal/types"
+)
+
+// SummarySchedule writes a log summary at the times of a cron expression
+type SummarySchedule struct {
+	Name      string    `json:"name"`
+	Cron      string    `json:"cron"`
+	TimeRange string    `json:"time_range"` // the window each summary covers, e.g. 24h
+	NextRun   time.Time `json:"next_run,omitempty"`
+	schedule  *cron.Schedule
+}
+
+// ParseSummarySchedules parses AI_SUMMARY_SCHEDULES: semicolon-separated name=cron[=range]
+// entries, e.g. "morning=0 7 * * *=24h;weekly=@weekly=7d"; the range is a duration such as 1h,
+// 7d or P1W and defaults to 24h
+func ParseSummarySchedules(spec string) ([]SummarySchedule, error) {
+	var schedules []SummarySchedule
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, "=")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("schedule %q must be name=cron[=range]", entry)
+		}
+		s := SummarySchedule{Name: strings.TrimSpace(parts[0]), Cron: strings.TrimSpace(parts[1]), TimeRange: "24h"}
+		if s.Name == "" || seen[s.Name] {
+			return nil, fmt.Errorf("schedule %q needs a unique name", entry)
+		}
+		seen[s.Name] = true
+		parsed, err := cron.Parse(s.Cron)
+		if err != nil {
+			return nil, err
+		}
+		s.schedule = parsed
+		if len(parts) == 3 {
+			s.TimeRange = strings.TrimSpace(parts[2])
+			// Every run summarizes the window before it, so fixed intervals make no sense here
+			if r, err := timerange.Parse(s.TimeRange, time.Now()); err != nil || !r.Relative {
+				return nil, fmt.Errorf("schedule %q has invalid range %q", entry, s.TimeRange)
+			}
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// StoredSummary is a summary written by a schedule
+type StoredSummary struct {
+	ID       int64     `json:"id"`
+	Schedule string    `json:"schedule"`
+	Time     time.Time `json:"time"`
+	Language string    `json:"language"`
+	types.SummaryResponse
+}
+
+// SummaryScheduler runs SummarizeLogs on its schedules and keeps the results in ai_summaries,
+// so digests are ready without a client polling /api/ai/summarize
+type SummaryScheduler struct {
+	ai        *AIService
+	db        *sql.DB
+	schedules []SummarySchedule
+	location  *time.Location
+}
+
+// NewSummaryScheduler reads AI_SUMMARY_SCHEDULES and AI_SUMMARY_TIMEZONE (an IANA zone the cron
+// times are in, default UTC); invalid settings are logged and leave the scheduler without schedules
+func NewSummaryScheduler(ai *AIService, db *sql.DB) *SummaryScheduler {
+	s := &SummaryScheduler{ai: ai, db: db, location: time.UTC}
+	if zone := os.Getenv("AI_SUMMARY_TIMEZONE"); zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			slog.Error("Invalid AI_SUMMARY_TIMEZONE, using UTC", "error", err)
+		} else {
+			s.location = location
+		}
+	}
+	schedules, err := ParseSummarySchedules(os.Getenv("AI_SUMMARY_SCHEDULES"))
+	if err != nil {
+		slog.Error("Invalid AI_SUMMARY_SCHEDULES, no summaries will be scheduled", "error", err)
+	}
+	s.schedules = schedules
+	return s
+}
+
+// Schedules returns the configured schedules with their next run
+func (s *SummaryScheduler) Schedules() []SummarySchedule {
+	list := make([]SummarySchedule, len(s.schedules))
+	now := time.Now().In(s.location)
+	for i, schedule := range s.schedules {
+		list[i] = schedule
+		list[i].NextRun = schedule.schedule.Next(now)
+	}
+	return list
+}
+
+// Start runs every schedule in the background
+func (s *SummaryScheduler) Start() {
+	for _, schedule := range s.schedules {
+		slog.Info("Scheduling AI summaries", "schedule", schedule.Name, "cron", schedule.Cron, "range", schedule.TimeRange, "timezone", s.location.String())
+		go s.run(schedule)
+	}
+}
+
+func (s *SummaryScheduler) run(schedule SummarySchedule) {
+	for {
+		next := schedule.schedule.Next(time.Now().In(s.location))
+		if next.IsZero() {
+			slog.Warn("AI summary schedule never fires", "schedule", schedule.Name, "cron", schedule.Cron)
+			return
+		}
+		time.Sleep(time.Until(next))
+
+		if err := s.Summarize(context.Background(), schedule); err != nil {
+			slog.Error("Scheduled AI summary failed", "schedule", schedule.Name, "error", err)
+		}
+	}
+}
+
+// Summarize writes one summary for a schedule now, stores it and queues it for semantic search
+func (s *SummaryScheduler) Summarize(ctx context.Context, schedule SummarySchedule) error {
+	response, err := s.ai.SummarizeLogsContext(ctx, schedule.TimeRange)
+	if err != nil {
+		return err
+	}
+	summary, ok := response.Result.(types.SummaryResponse)
+	if !ok {
+		return fmt.Errorf("unexpected summary result %T", response.Result)
+	}
+	if summary.KeyInsights == nil {
+		summary.KeyInsights = []string{}
+	}
+	insights, err := json.Marshal(summary.KeyInsights)
+	if err != nil {
+		return err
+	}
+
+	stored := StoredSummary{Schedule: schedule.Name, Language: LanguageFromContext(ctx).String(), SummaryResponse: summary}
+	err = s.db.QueryRowContext(ctx, `
+        INSERT INTO ai_summaries (schedule, time_range, language, summary, key_insights, log_count)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, time
+    `, schedule.Name, summary.TimeRange, stored.Language, summary.Summary, insights, summary.LogCount).Scan(&stored.ID, &stored.Time)
+	if err != nil {
+		return fmt.Errorf("failed to store summary: %w", err)
+	}
+	s.ai.Remember(SummaryKnowledge(stored))
+	return nil
+}
+
+// History returns stored summaries newer than since, newest first; an empty schedule matches all
+func (s *SummaryScheduler) History(ctx context.Context, schedule string, since time.Time, limit int) ([]StoredSummary, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT id, schedule, time, language, time_range, summary, key_insights, log_count
+        FROM ai_summaries
+        WHERE time >= $1 AND ($2 = '' OR schedule = $2)
+        ORDER BY time DESC
+        LIMIT $3
+    `, since, schedule, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []StoredSummary{}
+	for rows.Next() {
+		var summary StoredSummary
+		var insights []byte
+		if err := rows.Scan(&summary.ID, &summary.Schedule, &summary.Time, &summary.Language,
+			&summary.TimeRange, &summary.Summary, &insights, &summary.LogCount); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(insights, &summary.KeyInsights); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
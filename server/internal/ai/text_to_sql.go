@@ -3,13 +3,15 @@ package ai
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"edge-insights/internal/devicetypes"
 	"edge-insights/internal/types"
 
 	"github.com/sashabaranov/go-openai"
@@ -17,20 +19,40 @@ import (
 
 // TextToSQLService handles natural language to SQL conversion
 type TextToSQLService struct {
-	db     *sql.DB
-	openai *openai.Client
+	db         *sql.DB
+	llm        *LLMRouter
+	guard      CostGuard
+	guardrails SQLGuardrails
+	prompts    *PromptStore
+	shadow     *Shadow
 }
 
-// NewTextToSQLService creates a new text-to-SQL service
+// NewTextToSQLService creates a new text-to-SQL service with the chat models configured in the
+// environment (see LoadLLMRouter)
 func NewTextToSQLService(db *sql.DB) *TextToSQLService {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable not set")
+	llm, err := LoadLLMRouter()
+	if err != nil {
+		slog.Error("Failed to configure the chat models", "error", err)
+		os.Exit(1)
 	}
 
+	return NewTextToSQLServiceWithLLM(db, llm)
+}
+
+// NewTextToSQLServiceWithClient creates a text-to-SQL service using the given chat client for
+// every use case (used by tests)
+func NewTextToSQLServiceWithClient(db *sql.DB, client ChatClient) *TextToSQLService {
+	return NewTextToSQLServiceWithLLM(db, NewLLMRouter(client))
+}
+
+// NewTextToSQLServiceWithLLM creates a text-to-SQL service whose chat completions go through llm
+func NewTextToSQLServiceWithLLM(db *sql.DB, llm *LLMRouter) *TextToSQLService {
 	return &TextToSQLService{
-		db:     db,
-		openai: openai.NewClient(apiKey),
+		db:         db,
+		llm:        llm,
+		guard:      LoadCostGuard(),
+		guardrails: LoadSQLGuardrails(),
+		shadow:     NewShadow(db, LoadShadowConfig(llm.Config(UseCaseSQL).Model)),
 	}
 }
 
@@ -47,31 +69,73 @@ type SQLQueryResponse struct {
 	QueryType   string        `json:"query_type"`
 	Explanation string        `json:"explanation"`
 	Error       string        `json:"error,omitempty"`
+	// RequiresApproval is set when the SQL was generated but not executed
+	RequiresApproval bool `json:"requires_approval,omitempty"`
+	// RequiresConfirmation is set when the plan estimate exceeded the cost guard
+	RequiresConfirmation bool          `json:"requires_confirmation,omitempty"`
+	Estimate             *PlanEstimate `json:"estimate,omitempty"`
 }
 
 // ConvertToSQL converts natural language to SQL and executes it
-func (s *TextToSQLService) ConvertToSQL(query string) (*types.QueryResponse, error) {
+// Generated SQL that fails the guardrails is rejected; SQL whose plan estimate exceeds the
+// cost guard is returned unexecuted (or rejected)
+func (s *TextToSQLService) ConvertToSQL(ctx context.Context, query string) (*types.QueryResponse, error) {
+	return s.convertToSQL(ctx, query, nil)
+}
 
+// convertToSQL is ConvertToSQL streaming the SQL to emit as it is written, then the checked SQL
+// before it runs
+func (s *TextToSQLService) convertToSQL(ctx context.Context, query string, emit QueryEmitter) (*types.QueryResponse, error) {
 	// Step 1: Generate SQL from natural language
-	sqlQuery, queryType, explanation, err := s.generateSQL(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate SQL: %w", err)
+	sqlQuery, queryType, explanation, err := s.generateSQL(ctx, query, emit.tokens())
+	if errors.Is(err, ErrPromptInjection) {
+		return rejectedResponse(query, SQLQueryResponse{Result: []interface{}{}}, err), nil
 	}
-
-	// Step 2: Execute the SQL query
-	results, rowCount, err := s.executeSQL(sqlQuery)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute SQL: %w", err)
+		return nil, fmt.Errorf("failed to generate SQL: %w", err)
 	}
-
 	sqlResponse := SQLQueryResponse{
 		SQL:         sqlQuery,
-		Result:      results,
-		RowCount:    rowCount,
+		Result:      []interface{}{},
 		QueryType:   queryType,
 		Explanation: explanation,
 	}
 
+	// Step 2: Only a capped SELECT over the allowed tables may run
+	checked, err := s.guardrails.Check(sqlQuery)
+	if err != nil {
+		return rejectedResponse(query, sqlResponse, err), nil
+	}
+	sqlResponse.SQL = checked
+	if err := emit.emit("sql", map[string]string{"sql": checked, "query_type": queryType, "explanation": explanation}); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start read-only transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Step 3: Check the plan estimate before touching any data
+	estimate, err := explain(ctx, tx, checked)
+	if err != nil {
+		return nil, err
+	}
+	sqlResponse.Estimate = estimate
+	if reason := s.guard.Exceeded(*estimate); reason != "" {
+		return s.guardedResponse(query, sqlResponse, reason), nil
+	}
+
+	// Step 4: Execute the SQL query
+	s.logQueryAnalysis(checked)
+	results, rowCount, err := s.scanRows(tx.QueryContext(ctx, checked))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute SQL: %w", err)
+	}
+	sqlResponse.Result = results
+	sqlResponse.RowCount = rowCount
+
 	return &types.QueryResponse{
 		Success: true,
 		Result:  sqlResponse,
@@ -80,160 +144,175 @@ func (s *TextToSQLService) ConvertToSQL(query string) (*types.QueryResponse, err
 	}, nil
 }
 
-// generateSQL uses OpenAI to convert natural language to SQL
-func (s *TextToSQLService) generateSQL(query string) (string, string, string, error) {
-	// Define the database schema for the AI
-	schema := `
-		Tables:
-		
-		sensor_readings (raw data):
-		- time (TIMESTAMPTZ): When the reading was taken
-		- device_id (TEXT): Unique device identifier
-		- device_type (TEXT): Type of sensor (temperature_sensor, humidity_sensor, motion_detector, camera, controller)
-		- location (TEXT): Location of the device (warehouse_a, warehouse_b, office_floor_1, parking_lot, server_room)
-		- raw_value (NUMERIC): The sensor reading value
-		- unit (TEXT): Unit of measurement (celsius, percent, boolean)
-		- log_type (TEXT): Log level (INFO, WARNING, ERROR, CRITICAL, SECURITY)
-		- message (TEXT): Human-readable log message
+// guardedResponse reports SQL held back by the cost guard, asking for confirmation unless the guard rejects outright
+func (s *TextToSQLService) guardedResponse(query string, sqlResponse SQLQueryResponse, reason string) *types.QueryResponse {
+	response := &types.QueryResponse{
+		Query: query,
+		Time:  time.Now(),
+	}
+	if s.guard.Reject {
+		sqlResponse.Error = "query rejected: " + reason
+		response.Error = sqlResponse.Error
+	} else {
+		sqlResponse.RequiresConfirmation = true
+		sqlResponse.Error = reason + "; re-submit with confirmation to run it"
+		response.Success = true
+	}
+	response.Result = sqlResponse
+	return response
+}
 
-		five_min_sensor_averages (continuous aggregate - Level 1):
-		- five_min_bucket (TIMESTAMPTZ): 5-minute bucket
-		- device_type (TEXT): Type of sensor
-		- location (TEXT): Location of device
-		- avg_value (NUMERIC): Average reading for 5 minutes
-		- min_value (NUMERIC): Minimum reading for 5 minutes
-		- max_value (NUMERIC): Maximum reading for 5 minutes
-		- reading_count (INTEGER): Number of readings in 5 minutes
+// rejectedResponse reports generated SQL that failed the guardrails without running it
+func rejectedResponse(query string, sqlResponse SQLQueryResponse, err error) *types.QueryResponse {
+	sqlResponse.Error = "query rejected: " + err.Error()
+	return &types.QueryResponse{
+		Result: sqlResponse,
+		Query:  query,
+		Error:  sqlResponse.Error,
+		Time:   time.Now(),
+	}
+}
 
-		hourly_sensor_averages (continuous aggregate - Level 2):
-		- hour (TIMESTAMPTZ): Hour bucket (built on five_min_sensor_averages)
-		- device_type (TEXT): Type of sensor
-		- location (TEXT): Location of device
-		- avg_value (NUMERIC): Average of 5-min averages for the hour
-		- min_value (NUMERIC): Minimum of 5-min minimums for the hour
-		- max_value (NUMERIC): Maximum of 5-min maximums for the hour
-		- reading_count (INTEGER): Sum of 5-min reading counts for the hour
+// DraftSQL generates SQL for a question without executing it, so an admin can review and run it
+func (s *TextToSQLService) DraftSQL(ctx context.Context, query string) (*types.QueryResponse, error) {
+	return s.StreamDraftSQL(ctx, query, nil)
+}
 
-		daily_sensor_averages (continuous aggregate - Level 3):
-		- day (TIMESTAMPTZ): Day bucket (built on hourly_sensor_averages)
-		- device_type (TEXT): Type of sensor
-		- location (TEXT): Location of device
-		- avg_value (NUMERIC): Average of hourly averages for the day
-		- min_value (NUMERIC): Minimum of hourly minimums for the day
-		- max_value (NUMERIC): Maximum of hourly maximums for the day
-		- reading_count (INTEGER): Sum of hourly reading counts for the day
+// StreamDraftSQL is DraftSQL passing the SQL to onToken piece by piece while the model writes it,
+// so a client can watch it and cancel ctx to stop the generation early. An error from onToken
+// stops the generation too
+func (s *TextToSQLService) StreamDraftSQL(ctx context.Context, query string, onToken func(string) error) (*types.QueryResponse, error) {
+	sqlQuery, queryType, explanation, err := s.generateSQL(ctx, query, onToken)
+	if errors.Is(err, ErrPromptInjection) {
+		return rejectedResponse(query, SQLQueryResponse{Result: []interface{}{}}, err), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SQL: %w", err)
+	}
+	sqlResponse := SQLQueryResponse{
+		SQL:         sqlQuery,
+		Result:      []interface{}{},
+		QueryType:   queryType,
+		Explanation: explanation,
+	}
 
-		daily_device_activity (continuous aggregate):
-		- day (TIMESTAMPTZ): Day bucket
-		- device_type (TEXT): Type of sensor
-		- location (TEXT): Location of device
-		- total_readings (INTEGER): Total readings for the day
-		- error_count (INTEGER): Number of errors for the day
-		- warning_count (INTEGER): Number of warnings for the day
-		- info_count (INTEGER): Number of info logs for the day
+	// Drafts go through the same guardrails, so an admin only reviews SQL that could run
+	checked, err := s.guardrails.Check(sqlQuery)
+	if err != nil {
+		return rejectedResponse(query, sqlResponse, err), nil
+	}
+	sqlResponse.SQL = checked
+	sqlResponse.RequiresApproval = true
 
-		TimescaleDB Functions Available:
-		- time_bucket(interval, time_column): Group by time intervals
-		- NOW(): Current timestamp
-		- INTERVAL: Time intervals like '1 hour', '24 hours', '7 days'
-	`
+	return &types.QueryResponse{
+		Success: true,
+		Result:  sqlResponse,
+		Query:   query,
+		Time:    time.Now(),
+	}, nil
+}
 
-	systemPrompt := fmt.Sprintf(`You are a SQL expert for a TimescaleDB database containing IoT sensor data with continuous aggregates for optimal performance. 
-	
-	Database Schema:
-	%s
-	
-	Rules:
-	1. PREFER hierarchical continuous aggregates for optimal performance:
-	   - Use five_min_sensor_averages for real-time monitoring (5-min intervals)
-	   - Use hourly_sensor_averages for hourly trends (built on 5-min data)
-	   - Use daily_sensor_averages for daily summaries (built on hourly data)
-	   - Use daily_device_activity for log analysis and error counts
-	   - Only use sensor_readings for specific data or when aggregates don't fit
-	
-	2. Hierarchical Query Optimization Guidelines:
-	   - For "recent 5-minute trends" → use five_min_sensor_averages (fastest)
-	   - For "hourly averages" → use hourly_sensor_averages (reuses 5-min calculations)
-	   - For "daily averages" → use daily_sensor_averages (reuses hourly calculations)
-	   - For "daily error counts" → use daily_device_activity
-	   - For "specific device readings" → use sensor_readings
-	   
-	3. Time-Series Query Rules:
-	   - ALWAYS include time column (five_min_bucket, hour, day) for charting
-	   - NEVER return just a single average without time buckets
-	   - For "over last X hours" → use hourly_sensor_averages with time filter
-	   - For "over last X days" → use daily_sensor_averages with time filter
-	   - For "recent trends" → use five_min_sensor_averages
-	
-	4. Return only the SQL query, no explanations
-	5. Use proper PostgreSQL syntax
-	6. For time ranges, use NOW() - INTERVAL 'X hours/days'
-	7. Always include ORDER BY time DESC for recent data
-	8. Limit results to reasonable amounts (max 100 rows unless specifically asked for more)
-	9. For filtering by temperature/humidity values, use raw_value column (sensor_readings) or avg_value (aggregates)
-	10. For device filtering, use device_id or device_type columns
-	11. For date filtering, use time::date = CURRENT_DATE for today
-	
-	Common query patterns:
-	- "Show me temperature readings" → SELECT * FROM sensor_readings WHERE device_type = 'temperature_sensor' ORDER BY time DESC LIMIT 50
-	- "Recent 5-minute trends" → SELECT five_min_bucket, avg_value, min_value, max_value FROM five_min_sensor_averages WHERE device_type = 'temperature_sensor' ORDER BY five_min_bucket DESC LIMIT 12
-	- "Hourly averages" → SELECT hour, avg_value, min_value, max_value FROM hourly_sensor_averages WHERE device_type = 'temperature_sensor' ORDER BY hour DESC LIMIT 24
-	- "Daily averages" → SELECT day, avg_value, min_value, max_value FROM daily_sensor_averages WHERE device_type = 'temperature_sensor' ORDER BY day DESC LIMIT 7
-	- "Daily error summary" → SELECT day, device_type, location, error_count, warning_count FROM daily_device_activity ORDER BY day DESC LIMIT 7
-	- "Today's readings" → SELECT * FROM sensor_readings WHERE time::date = CURRENT_DATE ORDER BY time DESC LIMIT 50
-	
-	IMPORTANT: For time-series queries like "average over last 24 hours", ALWAYS use time buckets:
-	- "What's the average humidity over the last 24 hours?" → SELECT hour, avg_value FROM hourly_sensor_averages WHERE device_type = 'humidity_sensor' AND hour >= NOW() - INTERVAL '24 hours' ORDER BY hour DESC
-	- "Average humidity over last 24 hours" → SELECT hour, avg_value FROM hourly_sensor_averages WHERE device_type = 'humidity_sensor' AND hour >= NOW() - INTERVAL '24 hours' ORDER BY hour DESC
-	- "Temperature trends last week" → SELECT day, avg_value FROM daily_sensor_averages WHERE device_type = 'temperature_sensor' AND day >= NOW() - INTERVAL '7 days' ORDER BY day DESC
-	- "Recent humidity data" → SELECT five_min_bucket, avg_value FROM five_min_sensor_averages WHERE device_type = 'humidity_sensor' AND five_min_bucket >= NOW() - INTERVAL '1 hour' ORDER BY five_min_bucket DESC
-	`, schema)
+// ExecuteApproved runs reviewed SQL (typically from DraftSQL) in a read-only transaction
+// The SQL must pass the same guardrails as generated SQL
+// confirmed acknowledges a cost guard warning; it has no effect when the guard rejects
+func (s *TextToSQLService) ExecuteApproved(ctx context.Context, query, sqlQuery string, confirmed bool) (*types.QueryResponse, error) {
+	sqlQuery, err := s.guardrails.Check(sqlQuery)
+	if err != nil {
+		return nil, err
+	}
 
-	userPrompt := fmt.Sprintf("Convert this natural language query to SQL: %s", query)
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start read-only transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	resp, err := s.openai.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "gpt-4",
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    "system",
-					Content: systemPrompt,
-				},
-				{
-					Role:    "user",
-					Content: userPrompt,
-				},
-			},
-			Temperature: 0.1, // Low temperature for consistent SQL generation
-		},
-	)
+	estimate, err := explain(ctx, tx, sqlQuery)
+	if err != nil {
+		return nil, err
+	}
+	sqlResponse := SQLQueryResponse{
+		SQL:       sqlQuery,
+		Result:    []interface{}{},
+		QueryType: s.determineQueryType(sqlQuery),
+		Estimate:  estimate,
+	}
+	if reason := s.guard.Exceeded(*estimate); reason != "" && (s.guard.Reject || !confirmed) {
+		return s.guardedResponse(query, sqlResponse, reason), nil
+	}
 
+	s.logQueryAnalysis(sqlQuery)
+	results, rowCount, err := s.scanRows(tx.QueryContext(ctx, sqlQuery))
 	if err != nil {
-		return "", "", "", fmt.Errorf("OpenAI API error: %w", err)
+		return nil, fmt.Errorf("failed to execute SQL: %w", err)
 	}
+	sqlResponse.Result = results
+	sqlResponse.RowCount = rowCount
+
+	return &types.QueryResponse{
+		Success: true,
+		Result:  sqlResponse,
+		Query:   query,
+		Time:    time.Now(),
+	}, nil
+}
 
-	if len(resp.Choices) == 0 {
-		return "", "", "", fmt.Errorf("no response from OpenAI")
+// generateSQL uses the sql use case's chat model to convert natural language to SQL
+// The question is screened for prompt injection first; onToken, when set, receives the SQL as it is written
+func (s *TextToSQLService) generateSQL(ctx context.Context, query string, onToken func(string) error) (string, string, string, error) {
+	query, err := screenQuestion(ctx, PromptTextToSQL, query)
+	if err != nil {
+		return "", "", "", err
 	}
+	systemPrompt, version := s.prompts.Render(PromptTextToSQL, map[string]string{"Schema": textToSQLSchema()})
 
-	sqlQuery := strings.TrimSpace(resp.Choices[0].Message.Content)
+	started := time.Now()
+	sqlQuery, err := s.completeSQL(ctx, "", systemPrompt, query, onToken)
+	if err != nil {
+		return "", "", "", err
+	}
+	s.shadow.maybeRun(ctx, s, query, ShadowRun{Model: s.llm.Config(UseCaseSQL).Model, PromptVersion: version, SQL: sqlQuery, LatencyMs: msSince(started)})
 
 	// Determine query type
 	queryType := s.determineQueryType(sqlQuery)
 
 	// Generate explanation
-	explanation := s.generateExplanation(query, sqlQuery, queryType)
+	explanation := localize(ctx, s.llm, s.generateExplanation(query, sqlQuery, queryType))[0]
 
 	return sqlQuery, queryType, explanation, nil
 }
 
-// executeSQL executes the generated SQL query
-func (s *TextToSQLService) executeSQL(sqlQuery string) ([]interface{}, int, error) {
-	// Log the SQL query and analyze which tables are being used
-	s.logQueryAnalysis(sqlQuery)
+// completeSQL asks model (the sql use case's when empty) for the SQL answering query under
+// systemPrompt, streaming it to onToken when set
+func (s *TextToSQLService) completeSQL(ctx context.Context, model, systemPrompt, query string, onToken func(string) error) (string, error) {
+	userPrompt := fmt.Sprintf("Convert this natural language query to SQL: %s", query)
 
-	rows, err := s.db.Query(sqlQuery)
+	request := openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    "system",
+				Content: systemPrompt,
+			},
+			{
+				Role:    "user",
+				Content: userPrompt,
+			},
+		},
+	}
+	if onToken != nil {
+		return s.llm.Stream(ctx, UseCaseSQL, request, onToken)
+	}
+
+	resp, err := s.llm.Complete(ctx, UseCaseSQL, request)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// scanRows converts query results into JSON-friendly row maps
+func (s *TextToSQLService) scanRows(rows *sql.Rows, err error) ([]interface{}, int, error) {
 	if err != nil {
 		return nil, 0, fmt.Errorf("SQL execution error: %w", err)
 	}
@@ -245,21 +324,14 @@ func (s *TextToSQLService) executeSQL(sqlQuery string) ([]interface{}, int, erro
 		return nil, 0, fmt.Errorf("failed to get columns: %w", err)
 	}
 
-	// Filter out embeddings and message columns
-	var filteredColumns []string
-	var columnIndexes []int
-	for i, col := range columns {
-		if col != "embedding" && col != "message" {
-			filteredColumns = append(filteredColumns, col)
-			columnIndexes = append(columnIndexes, i)
-		}
-	}
+	// Column redaction (embeddings, messages for viewers) is applied by the API layer
+	// through the shared redaction policy, so every column is returned here
 
 	var results []interface{}
 	rowCount := 0
 
 	for rows.Next() {
-		// Create a slice to hold all the values (including filtered ones)
+		// Create a slice to hold all the values
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
 
@@ -272,11 +344,10 @@ func (s *TextToSQLService) executeSQL(sqlQuery string) ([]interface{}, int, erro
 			continue
 		}
 
-		// Create a map for this row, excluding embeddings and message
+		// Create a map for this row
 		row := make(map[string]interface{})
-		for i, colIndex := range columnIndexes {
-			col := filteredColumns[i]
-			val := values[colIndex]
+		for i, col := range columns {
+			val := values[i]
 
 			// Handle time.Time conversion
 			if timestamp, ok := val.(time.Time); ok {
@@ -366,14 +437,8 @@ func (s *TextToSQLService) logQueryAnalysis(sqlQuery string) {
 		queryType = "SIMPLE_SELECT"
 	}
 
-	// Log the analysis
-	log.Printf("🔍 QUERY ANALYSIS:")
-	log.Printf("   SQL Query: %s", sqlQuery)
-	log.Printf("   Query Type: %s", queryType)
-	log.Printf("   Tables Used: %v", tablesUsed)
-	log.Printf("   Table Types: %v", tableTypes)
-
 	// Performance recommendations
+	performance := ""
 	if len(tablesUsed) > 0 {
 		hasRawData := false
 		hasAggregates := false
@@ -387,13 +452,20 @@ func (s *TextToSQLService) logQueryAnalysis(sqlQuery string) {
 		}
 
 		if hasRawData && !hasAggregates {
-			log.Printf("   ⚠️  PERFORMANCE: Query uses raw data - consider using continuous aggregates for better performance")
+			performance = "raw data - consider using continuous aggregates for better performance"
 		} else if hasAggregates {
-			log.Printf("   ✅ PERFORMANCE: Query uses continuous aggregates - optimal performance")
+			performance = "continuous aggregates - optimal performance"
 		}
 	}
 
-	log.Printf("   ---")
+	// Log the analysis
+	slog.Debug("Query analysis",
+		"sql", sqlQuery,
+		"query_type", queryType,
+		"tables", tablesUsed,
+		"table_types", tableTypes,
+		"performance", performance,
+	)
 }
 
 // determineQueryType categorizes the SQL query
@@ -431,3 +503,155 @@ func (s *TextToSQLService) generateExplanation(query, sqlQuery, queryType string
 		return fmt.Sprintf("This query retrieves specific sensor data based on: '%s'", query)
 	}
 }
+
+// textToSQLPrompt is the built-in text-to-SQL system prompt; {{.Schema}} is the schema description
+const textToSQLPrompt = `You are a SQL expert for a TimescaleDB database containing IoT sensor data with continuous aggregates for optimal performance. 
+	
+	Database Schema:
+	{{.Schema}}
+	
+	Rules:
+	1. PREFER hierarchical continuous aggregates for optimal performance:
+	   - Use five_min_sensor_averages for real-time monitoring (5-min intervals)
+	   - Use hourly_sensor_averages for hourly trends (built on 5-min data)
+	   - Use daily_sensor_averages for daily summaries (built on hourly data)
+	   - Use daily_device_activity for log analysis and error counts
+	   - Only use sensor_readings for specific data or when aggregates don't fit
+	
+	2. Hierarchical Query Optimization Guidelines:
+	   - For "recent 5-minute trends" → use five_min_sensor_averages (fastest)
+	   - For "hourly averages" → use hourly_sensor_averages (reuses 5-min calculations)
+	   - For "daily averages" → use daily_sensor_averages (reuses hourly calculations)
+	   - For "daily error counts" → use daily_device_activity
+	   - For "specific device readings" → use sensor_readings
+	   
+	3. Time-Series Query Rules:
+	   - ALWAYS include time column (five_min_bucket, hour, day) for charting
+	   - NEVER return just a single average without time buckets
+	   - For "over last X hours" → use hourly_sensor_averages with time filter
+	   - For "over last X days" → use daily_sensor_averages with time filter
+	   - For "recent trends" → use five_min_sensor_averages
+	
+	4. Return only the SQL query, no explanations
+	5. Use proper PostgreSQL syntax
+	6. For time ranges, use NOW() - INTERVAL 'X hours/days'
+	7. Always include ORDER BY time DESC for recent data
+	8. Limit results to reasonable amounts (max 100 rows unless specifically asked for more)
+	9. For filtering by temperature/humidity values, use raw_value column (sensor_readings) or avg_value (aggregates)
+	10. For device filtering, use device_id or device_type columns
+	11. For date filtering, use time::date = CURRENT_DATE for today
+	
+	Common query patterns:
+	- "Show me temperature readings" → SELECT * FROM sensor_readings WHERE device_type = 'temperature_sensor' ORDER BY time DESC LIMIT 50
+	- "Recent 5-minute trends" → SELECT five_min_bucket, avg_value, min_value, max_value FROM five_min_sensor_averages WHERE device_type = 'temperature_sensor' ORDER BY five_min_bucket DESC LIMIT 12
+	- "Hourly averages" → SELECT hour, avg_value, min_value, max_value FROM hourly_sensor_averages WHERE device_type = 'temperature_sensor' ORDER BY hour DESC LIMIT 24
+	- "Daily averages" → SELECT day, avg_value, min_value, max_value FROM daily_sensor_averages WHERE device_type = 'temperature_sensor' ORDER BY day DESC LIMIT 7
+	- "Daily error summary" → SELECT day, device_type, location, error_count, warning_count FROM daily_device_activity ORDER BY day DESC LIMIT 7
+	- "Today's readings" → SELECT * FROM sensor_readings WHERE time::date = CURRENT_DATE ORDER BY time DESC LIMIT 50
+	
+	IMPORTANT: For time-series queries like "average over last 24 hours", ALWAYS use time buckets:
+	- "What's the average humidity over the last 24 hours?" → SELECT hour, avg_value FROM hourly_sensor_averages WHERE device_type = 'humidity_sensor' AND hour >= NOW() - INTERVAL '24 hours' ORDER BY hour DESC
+	- "Average humidity over last 24 hours" → SELECT hour, avg_value FROM hourly_sensor_averages WHERE device_type = 'humidity_sensor' AND hour >= NOW() - INTERVAL '24 hours' ORDER BY hour DESC
+	- "Temperature trends last week" → SELECT day, avg_value FROM daily_sensor_averages WHERE device_type = 'temperature_sensor' AND day >= NOW() - INTERVAL '7 days' ORDER BY day DESC
+	- "Recent humidity data" → SELECT five_min_bucket, avg_value FROM five_min_sensor_averages WHERE device_type = 'humidity_sensor' AND five_min_bucket >= NOW() - INTERVAL '1 hour' ORDER BY five_min_bucket DESC
+
+	TIME-WEIGHTED AVERAGES: devices report at irregular intervals, so AVG(raw_value) and the aggregate avg_value over-weight bursts of readings.
+	When the question asks for a "time-weighted" or "accurate" average, compute it from sensor_readings, weighting each reading by the time until the device's next reading (clipped to the bucket end):
+	- "Time-weighted average temperature per hour today" → WITH r AS (SELECT time, raw_value, time_bucket('1 hour', time) AS hour, LEAD(time) OVER (PARTITION BY device_id ORDER BY time) AS next_time FROM sensor_readings WHERE device_type = 'temperature_sensor' AND raw_value IS NOT NULL AND time >= date_trunc('day', NOW())) SELECT hour, SUM(raw_value * EXTRACT(EPOCH FROM (LEAST(COALESCE(next_time, NOW()), hour + INTERVAL '1 hour') - time))) / NULLIF(SUM(EXTRACT(EPOCH FROM (LEAST(COALESCE(next_time, NOW()), hour + INTERVAL '1 hour') - time))), 0) AS time_weighted_avg FROM r GROUP BY hour ORDER BY hour DESC
+
+	COUNTERS: cumulative metrics (energy meters in kwh, event/pulse counters) only ever grow until they reset, so never average them.
+	Use the increase between consecutive readings per device; a value lower than the previous one is a reset, and the increase is then the new value:
+	- "Energy used per hour today" → WITH r AS (SELECT device_id, time, raw_value, LAG(raw_value) OVER (PARTITION BY device_id ORDER BY time) AS prev FROM sensor_readings WHERE device_type = 'energy_meter' AND raw_value IS NOT NULL AND time >= date_trunc('day', NOW())) SELECT time_bucket('1 hour', time) AS hour, SUM(CASE WHEN raw_value >= prev THEN raw_value - prev ELSE raw_value END) AS increase FROM r WHERE prev IS NOT NULL GROUP BY hour ORDER BY hour DESC
+
+	BOOLEAN SERIES: motion detectors and door/contact sensors report raw_value 1 (on/occupied/open) or 0 (unit 'boolean'). Their averages are only meaningful as time-weighted occupancy.
+	For occupancy, state durations or how often something opens/triggers, use readings ordered per device:
+	- "Occupancy percentage per hour in warehouse_a today" → WITH r AS (SELECT time, raw_value > 0.5 AS state, time_bucket('1 hour', time) AS hour, LEAD(time) OVER (PARTITION BY device_id ORDER BY time) AS next_time FROM sensor_readings WHERE device_type = 'motion_detector' AND location = 'warehouse_a' AND raw_value IS NOT NULL AND time >= date_trunc('day', NOW())), w AS (SELECT hour, state, EXTRACT(EPOCH FROM (LEAST(COALESCE(next_time, NOW()), hour + INTERVAL '1 hour') - time)) AS seconds FROM r) SELECT hour, 100 * SUM(seconds) FILTER (WHERE state) / NULLIF(SUM(seconds), 0) AS occupancy_pct FROM w GROUP BY hour ORDER BY hour DESC
+	- "How many times did motion trigger per hour" → WITH r AS (SELECT time, raw_value > 0.5 AS state, LAG(raw_value > 0.5) OVER (PARTITION BY device_id ORDER BY time) AS prev_state FROM sensor_readings WHERE device_type = 'motion_detector' AND raw_value IS NOT NULL AND time >= NOW() - INTERVAL '24 hours') SELECT time_bucket('1 hour', time) AS hour, COUNT(*) FILTER (WHERE state AND prev_state = false) AS activations FROM r GROUP BY hour ORDER BY hour DESC
+	`
+
+// textToSQLSchema describes the database and the registered device types to the model; it fills
+// {{.Schema}} in the text-to-SQL prompt
+func textToSQLSchema() string {
+	var b strings.Builder
+	b.WriteString(textToSQLTables)
+	b.WriteString("\n\t\tDevice types (device_type: unit, valid values, usual reporting interval):\n")
+	for _, t := range devicetypes.All() {
+		fmt.Fprintf(&b, "\t\t- %s (%s): ", t.Name, t.Label)
+		switch {
+		case t.Silent:
+			b.WriteString("log lines without raw_value")
+		case t.Boolean:
+			fmt.Fprintf(&b, "unit '%s', raw_value 1 (on) or 0 (off)", t.Unit)
+		case t.Unit != "":
+			fmt.Fprintf(&b, "unit '%s', raw_value %s", t.Unit, t.Range())
+		default:
+			fmt.Fprintf(&b, "raw_value %s", t.Range())
+		}
+		if t.Interval() > 0 {
+			fmt.Fprintf(&b, ", every %s", t.Interval())
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\t\tOther device types may appear; list them with SELECT DISTINCT device_type FROM sensor_readings\n\t")
+	return b.String()
+}
+
+// textToSQLTables describes the tables and functions the generated SQL may use
+const textToSQLTables = `
+		Tables:
+		
+		sensor_readings (raw data):
+		- time (TIMESTAMPTZ): When the reading was taken
+		- device_id (TEXT): Unique device identifier
+		- device_type (TEXT): Type of sensor (see Device types below)
+		  Derived metrics (e.g. dew_point) are stored with device_type = metric name and device_id = 'derived:<name>'
+		- location (TEXT): Location of the device (warehouse_a, warehouse_b, office_floor_1, parking_lot, server_room)
+		- raw_value (NUMERIC): The sensor reading value
+		- unit (TEXT): Unit of measurement (see Device types below)
+		- log_type (TEXT): Log level (INFO, WARNING, ERROR, CRITICAL, SECURITY)
+		- message (TEXT): Human-readable log message
+		- ingested_at (TIMESTAMPTZ): When the server received the reading (NULL for old readings); use ingested_at - time for delivery delays
+		- metadata (JSONB): Optional device-specific extras, e.g. {"battery": 87, "rssi": -71, "firmware": "1.4.2"}; keys vary by device and may be missing
+		  Read values with metadata->>'key' (cast numbers, e.g. (metadata->>'battery')::numeric) and filter with metadata @> '{"firmware": "1.4.2"}'
+
+		five_min_sensor_averages (continuous aggregate - Level 1):
+		- five_min_bucket (TIMESTAMPTZ): 5-minute bucket
+		- device_type (TEXT): Type of sensor
+		- location (TEXT): Location of device
+		- avg_value (NUMERIC): Average reading for 5 minutes
+		- min_value (NUMERIC): Minimum reading for 5 minutes
+		- max_value (NUMERIC): Maximum reading for 5 minutes
+		- reading_count (INTEGER): Number of readings in 5 minutes
+
+		hourly_sensor_averages (continuous aggregate - Level 2):
+		- hour (TIMESTAMPTZ): Hour bucket (built on five_min_sensor_averages)
+		- device_type (TEXT): Type of sensor
+		- location (TEXT): Location of device
+		- avg_value (NUMERIC): Average of 5-min averages for the hour
+		- min_value (NUMERIC): Minimum of 5-min minimums for the hour
+		- max_value (NUMERIC): Maximum of 5-min maximums for the hour
+		- reading_count (INTEGER): Sum of 5-min reading counts for the hour
+
+		daily_sensor_averages (continuous aggregate - Level 3):
+		- day (TIMESTAMPTZ): Day bucket (built on hourly_sensor_averages)
+		- device_type (TEXT): Type of sensor
+		- location (TEXT): Location of device
+		- avg_value (NUMERIC): Average of hourly averages for the day
+		- min_value (NUMERIC): Minimum of hourly minimums for the day
+		- max_value (NUMERIC): Maximum of hourly maximums for the day
+		- reading_count (INTEGER): Sum of hourly reading counts for the day
+
+		daily_device_activity (continuous aggregate):
+		- day (TIMESTAMPTZ): Day bucket
+		- device_type (TEXT): Type of sensor
+		- location (TEXT): Location of device
+		- total_readings (INTEGER): Total readings for the day
+		- error_count (INTEGER): Number of errors for the day
+		- warning_count (INTEGER): Number of warnings for the day
+		- info_count (INTEGER): Number of info logs for the day
+
+		TimescaleDB Functions Available:
+		- time_bucket(interval, time_column): Group by time intervals
+		- NOW(): Current timestamp
+		- INTERVAL: Time intervals like '1 hour', '24 hours', '7 days'
+`
@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"edge-insights/internal/testutil"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestDraftSQL(t *testing.T) {
+	chat := testutil.NewFakeChat("SELECT device_id, avg(raw_value) FROM sensor_readings GROUP BY device_id LIMIT 10")
+	service := NewTextToSQLServiceWithClient(nil, chat)
+
+	resp, err := service.DraftSQL(context.Background(), "average value per device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, ok := resp.Result.(SQLQueryResponse)
+	if !ok {
+		t.Fatalf("Result is %T, want SQLQueryResponse", resp.Result)
+	}
+	if want := "SELECT device_id, avg(raw_value) FROM sensor_readings GROUP BY device_id LIMIT 10"; result.SQL != want {
+		t.Errorf("SQL = %q, want %q", result.SQL, want)
+	}
+	if !resp.Success || !result.RequiresApproval || result.Error != "" {
+		t.Errorf("response = %+v, want an approvable draft", result)
+	}
+
+	if len(chat.Requests) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(chat.Requests))
+	}
+	request, config := chat.Requests[0], defaultModels[UseCaseSQL]
+	if request.Model != config.Model || request.Temperature != config.Temperature {
+		t.Errorf("request used %s at %v, want %s at %v", request.Model, request.Temperature, config.Model, config.Temperature)
+	}
+}
+
+func TestDraftSQLRejectsUnsafeSQL(t *testing.T) {
+	service := NewTextToSQLServiceWithClient(nil, testutil.NewFakeChat("DELETE FROM sensor_readings"))
+
+	resp, err := service.DraftSQL(context.Background(), "remove everything")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := resp.Result.(SQLQueryResponse)
+	if resp.Success || result.RequiresApproval || result.Error == "" {
+		t.Errorf("response = %+v, want a rejected draft", result)
+	}
+}
+
+func TestDraftSQLProviderError(t *testing.T) {
+	chat := testutil.NewFakeChat()
+	chat.Err = errors.New("rate limited")
+	service := NewTextToSQLServiceWithClient(nil, chat)
+
+	if _, err := service.DraftSQL(context.Background(), "how many readings"); err == nil {
+		t.Error("DraftSQL succeeded, want the provider error")
+	}
+}
+
+func TestLLMRouterWithoutClient(t *testing.T) {
+	router := NewLLMRouter(nil)
+	if router.Has(UseCaseSQL) {
+		t.Error("a router without a client has a provider")
+	}
+	if _, err := router.Complete(context.Background(), UseCaseSQL, openai.ChatCompletionRequest{}); !errors.Is(err, errNoChatClient) {
+		t.Errorf("Complete error = %v, want errNoChatClient", err)
+	}
+}
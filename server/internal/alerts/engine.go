@@ -0,0 +1,460 @@
+// evaluates threshold rules against readings as they are stored, so alerts such as
+// "temperature > 35 for 5 minutes in server_room" fire without polling the AI endpoints
+// every fire and resolve is recorded in the alerts table
+
+package alerts
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+)
+
+// Engine holds the rules in alert_rules, the breaches waiting out a rule's duration and the
+// alerts currently firing
+// Pending breaches live in memory only; after a restart their duration starts again
+type Engine struct {
+	db        *sql.DB
+	mu        sync.RWMutex
+	rules     []*Rule
+	pending   map[alertKey]time.Time // when each ongoing breach that has not fired yet started
+	active    map[alertKey]*Alert
+	listeners []func(Alert)
+	advise    Advisor
+	enricher  *Enricher // attaches recent readings and related logs to fired alerts
+}
+
+// Advisor suggests remediation steps for a firing alert from its rule's runbook, e.g. with a language model
+type Advisor func(ctx context.Context, alert Alert, runbook *Runbook) (string, error)
+
+type alertKey struct {
+	rule   string
+	device string
+}
+
+// event is an alert change with what its rule says to do about it
+type event struct {
+	alert     Alert
+	notify    []notify.Config
+	runbook   *Runbook
+	remediate bool
+}
+
+// NewEngine creates an engine and loads the rules and the alerts still firing
+func NewEngine(db *sql.DB) (*Engine, error) {
+	e := &Engine{
+		db:       db,
+		pending:  make(map[alertKey]time.Time),
+		active:   make(map[alertKey]*Alert),
+		enricher: NewEnricher(db),
+	}
+	return e, e.Load()
+}
+
+// Load (re)reads the rules and the unresolved alerts from the database
+func (e *Engine) Load() error {
+	rules, err := e.loadRules()
+	if err != nil {
+		return err
+	}
+
+	rows, err := e.db.Query(`
+        SELECT id, rule, severity, device_id, device_type, location, metric, comparator,
+               threshold, value, unit, since, fired_at
+        FROM alerts
+        WHERE resolved_at IS NULL
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	active := make(map[alertKey]*Alert)
+	for rows.Next() {
+		var a Alert
+		if err := rows.Scan(&a.ID, &a.Rule, &a.Severity, &a.DeviceID, &a.DeviceType, &a.Location, &a.Metric,
+			&a.Comparator, &a.Threshold, &a.Value, &a.Unit, &a.Since, &a.FiredAt); err != nil {
+			return err
+		}
+		active[alertKey{rule: a.Rule, device: a.DeviceID}] = &a
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.active = active
+	e.pending = make(map[alertKey]time.Time)
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Engine) loadRules() ([]*Rule, error) {
+	rows, err := e.db.Query(`SELECT name, settings, updated_at FROM alert_rules ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*Rule
+	for rows.Next() {
+		var rule Rule
+		var name string
+		var settings []byte
+		if err := rows.Scan(&name, &settings, &rule.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(settings, &rule); err != nil {
+			return nil, fmt.Errorf("invalid settings for %s: %w", name, err)
+		}
+		rule.Name = name
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		rules = append(rules, &rule)
+	}
+	return rules, rows.Err()
+}
+
+// SetAdvisor sets what suggests remediation for rules with suggest_remediation; without one
+// their notifications carry only the runbook
+func (e *Engine) SetAdvisor(a Advisor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.advise = a
+}
+
+// OnAlert registers fn to be called whenever an alert fires or resolves
+// Listeners must be registered before readings are observed and must not block
+func (e *Engine) OnAlert(fn func(Alert)) {
+	e.listeners = append(e.listeners, fn)
+}
+
+// Observe evaluates the rules matching a stored reading
+// A breach fires once it has lasted the rule's duration, measured by reading time, and the
+// alert resolves on the device's first reading that no longer breaches the threshold
+func (e *Engine) Observe(msg types.LogMessage) {
+	at := msg.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	e.mu.Lock()
+	var events []event
+	for _, rule := range e.rules {
+		if !rule.Matches(msg) {
+			continue
+		}
+		value, ok := rule.value(msg)
+		if !ok {
+			continue
+		}
+
+		key := alertKey{rule: rule.Name, device: msg.DeviceID}
+		breach := rule.Comparator.Compare(value, rule.Threshold)
+		alert, firing := e.active[key]
+		switch {
+		case firing && breach:
+			alert.Value = value
+		case firing:
+			delete(e.active, key)
+			alert.Value = value
+			alert.ResolvedAt = &at
+			events = append(events, event{alert: *alert, notify: rule.Notify, runbook: rule.Runbook})
+		case breach:
+			since, ok := e.pending[key]
+			if !ok || at.Before(since) {
+				since = at
+				e.pending[key] = since
+			}
+			if at.Sub(since) < rule.hold {
+				continue
+			}
+			id, err := newID()
+			if err != nil {
+				slog.Error("Failed to create alert", "rule", rule.Name, "error", err)
+				continue
+			}
+			delete(e.pending, key)
+			alert = &Alert{
+				ID:         id,
+				Rule:       rule.Name,
+				Severity:   rule.Severity,
+				DeviceID:   msg.DeviceID,
+				DeviceType: msg.DeviceType,
+				Location:   msg.Location,
+				Metric:     rule.Metric,
+				Comparator: rule.Comparator,
+				Threshold:  rule.Threshold,
+				Value:      value,
+				Unit:       rule.unit(msg),
+				Since:      since,
+				FiredAt:    at,
+			}
+			e.active[key] = alert
+			events = append(events, event{alert: *alert, notify: rule.Notify, runbook: rule.Runbook,
+				remediate: rule.SuggestRemediation && e.advise != nil})
+		default:
+			delete(e.pending, key)
+		}
+	}
+	advise := e.advise
+	e.mu.Unlock()
+
+	for _, ev := range events {
+		if ev.alert.ResolvedAt == nil {
+			if alertContext, err := e.enricher.ForDevice(ev.alert.DeviceID, ev.alert.FiredAt); err != nil {
+				slog.Warn("Failed to gather alert context", "alert_id", ev.alert.ID, "device_id", ev.alert.DeviceID, "error", err)
+			} else {
+				ev.alert.Context = alertContext
+			}
+		}
+		if err := e.save(ev.alert); err != nil {
+			slog.Error("Failed to record alert", "alert_id", ev.alert.ID, "rule", ev.alert.Rule, "error", err)
+		}
+		e.dispatch(ev, advise)
+	}
+}
+
+// save inserts a fired alert or records its resolution
+func (e *Engine) save(a Alert) error {
+	_, err := e.db.Exec(`
+        INSERT INTO alerts (id, rule, severity, device_id, device_type, location, metric, comparator,
+                            threshold, value, unit, since, fired_at, resolved_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+        ON CONFLICT (id) DO UPDATE SET
+            value = EXCLUDED.value,
+            resolved_at = EXCLUDED.resolved_at
+    `, a.ID, a.Rule, a.Severity, a.DeviceID, a.DeviceType, a.Location, a.Metric, string(a.Comparator),
+		a.Threshold, a.Value, a.Unit, a.Since, a.FiredAt, a.ResolvedAt)
+	return err
+}
+
+// dispatch tells listeners about an alert change and sends it to the rule's notifiers
+// Listeners run first so the advisor can see the alert in its incident
+func (e *Engine) dispatch(ev event, advise Advisor) {
+	for _, fn := range e.listeners {
+		fn(ev.alert)
+	}
+	if !ev.remediate {
+		e.send(ev)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		remediation, err := advise(ctx, ev.alert, ev.runbook)
+		if err != nil {
+			slog.Warn("Failed to suggest remediation", "alert_id", ev.alert.ID, "rule", ev.alert.Rule, "error", err)
+		} else if remediation != "" {
+			ev.alert.Remediation = remediation
+			if _, err := e.db.Exec(`UPDATE alerts SET remediation = $2 WHERE id = $1`, ev.alert.ID, remediation); err != nil {
+				slog.Error("Failed to record remediation", "alert_id", ev.alert.ID, "error", err)
+			}
+		}
+		e.send(ev)
+	}()
+}
+
+// send delivers an alert change to the rule's notifiers
+func (e *Engine) send(ev event) {
+	if len(ev.notify) == 0 {
+		return
+	}
+
+	n := ev.alert.notification(ev.runbook)
+	n.Remediation = ev.alert.Remediation
+	for _, config := range ev.notify {
+		notifier, err := notify.Channel(config)
+		if err != nil {
+			slog.Error("Invalid notifier on alert rule", "rule", ev.alert.Rule, "error", err)
+			continue
+		}
+		go func(config notify.Config) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := notifier.Notify(ctx, n); err != nil {
+				slog.Error("Failed to send alert notification", "channel", config.Type, "rule", ev.alert.Rule, "error", err)
+			}
+		}(config)
+	}
+}
+
+// Filter narrows Alerts; Firing limits the list to unresolved alerts
+type Filter struct {
+	Rule     string
+	DeviceID string
+	Location string
+	Severity string
+	Firing   bool
+	Limit    int // default 100
+}
+
+// Alerts returns recorded alerts matching f, most recently fired first
+func (e *Engine) Alerts(ctx context.Context, f Filter) ([]Alert, error) {
+	var conditions []string
+	var args []interface{}
+	for _, c := range []struct{ column, value string }{
+		{"rule", f.Rule}, {"device_id", f.DeviceID}, {"location", f.Location}, {"severity", f.Severity},
+	} {
+		if c.value != "" {
+			args = append(args, c.value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", c.column, len(args)))
+		}
+	}
+	if f.Firing {
+		conditions = append(conditions, "resolved_at IS NULL")
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	args = append(args, f.Limit)
+
+	rows, err := e.db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT id, rule, severity, device_id, device_type, location, metric, comparator,
+               threshold, value, unit, since, fired_at, resolved_at, remediation
+        FROM alerts
+        %s
+        ORDER BY fired_at DESC
+        LIMIT $%d
+    `, where, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Alert{}
+	for rows.Next() {
+		var a Alert
+		if err := rows.Scan(&a.ID, &a.Rule, &a.Severity, &a.DeviceID, &a.DeviceType, &a.Location, &a.Metric,
+			&a.Comparator, &a.Threshold, &a.Value, &a.Unit, &a.Since, &a.FiredAt, &a.ResolvedAt, &a.Remediation); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// Rules returns every alert rule sorted by name
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	list := make([]Rule, 0, len(e.rules))
+	for _, rule := range e.rules {
+		list = append(list, *rule)
+	}
+	return list
+}
+
+// SaveRule validates and creates or replaces a rule; alerts it was firing are closed without
+// notification and re-evaluated against the new rule on each device's next reading
+func (e *Engine) SaveRule(rule Rule) (*Rule, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	settings, err := json.Marshal(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO alert_rules (name, settings, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (name) DO UPDATE SET
+            settings = EXCLUDED.settings,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := e.db.QueryRow(query, rule.Name, settings).Scan(&rule.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save alert rule: %w", err)
+	}
+	if err := e.closeAlerts(rule.Name); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.removeRuleLocked(rule.Name)
+	e.rules = append(e.rules, &rule)
+	sort.Slice(e.rules, func(i, j int) bool { return e.rules[i].Name < e.rules[j].Name })
+	return &rule, nil
+}
+
+// DeleteRule removes a rule and closes its firing alerts; it reports false if it did not exist
+func (e *Engine) DeleteRule(name string) (bool, error) {
+	result, err := e.db.Exec(`DELETE FROM alert_rules WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	if err := e.closeAlerts(name); err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.removeRuleLocked(name)
+	return n > 0, nil
+}
+
+// closeAlerts marks the unresolved alerts of a rule resolved so they are not reloaded as firing
+func (e *Engine) closeAlerts(rule string) error {
+	_, err := e.db.Exec(`UPDATE alerts SET resolved_at = NOW() WHERE rule = $1 AND resolved_at IS NULL`, rule)
+	return err
+}
+
+func (e *Engine) removeRuleLocked(name string) {
+	for i, existing := range e.rules {
+		if existing.Name == name {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			break
+		}
+	}
+	for key := range e.active {
+		if key.rule == name {
+			delete(e.active, key)
+		}
+	}
+	for key := range e.pending {
+		if key.rule == name {
+			delete(e.pending, key)
+		}
+	}
+}
+
+// ImportRules saves a batch of rules (used by configuration bundles)
+func (e *Engine) ImportRules(rules []Rule) (int, error) {
+	for i, rule := range rules {
+		if _, err := e.SaveRule(rule); err != nil {
+			return i, fmt.Errorf("%s: %w", rule.Name, err)
+		}
+	}
+	return len(rules), nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
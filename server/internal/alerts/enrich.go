@@ -0,0 +1,97 @@
+package alerts
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/types"
+)
+
+// Enricher gathers the recent context attached to fired alerts and anomalies
+type Enricher struct {
+	db          *sql.DB
+	readings    int           // how many of the device's own readings to attach
+	relatedLogs int           // how many related logs from the same location to attach
+	window      time.Duration // how far around the event to look for related logs
+	baseURL     string        // prefix for aggregate window links
+}
+
+// NewEnricher creates an enricher configured from ALERT_CONTEXT_* environment variables
+func NewEnricher(database *sql.DB) *Enricher {
+	return &Enricher{
+		db:          database,
+		readings:    db.GetIntEnv("ALERT_CONTEXT_READINGS", 10),
+		relatedLogs: db.GetIntEnv("ALERT_CONTEXT_LOGS", 10),
+		window:      db.GetDurationEnv("ALERT_CONTEXT_WINDOW", 15*time.Minute),
+		baseURL:     os.Getenv("PUBLIC_BASE_URL"),
+	}
+}
+
+// ForDevice builds the context for an event raised on deviceID at the given time
+func (e *Enricher) ForDevice(deviceID string, at time.Time) (*types.AlertContext, error) {
+	// Step 1: The device's own recent readings leading up to the event
+	readings, err := db.GetReadingsBefore(e.db, deviceID, at, e.readings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent readings: %w", err)
+	}
+
+	ctx := &types.AlertContext{
+		RecentReadings: readings,
+	}
+
+	// The device type and location come from its latest reading; without one there is nothing to correlate
+	if len(readings) == 0 {
+		return ctx, nil
+	}
+	deviceType := readings[0].DeviceType
+	location := readings[0].Location
+
+	// Step 2: Warnings and errors from neighbouring devices around the same time
+	related, err := db.GetRelatedLogs(e.db, location, deviceID, at.Add(-e.window), at.Add(e.window), e.relatedLogs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get related logs: %w", err)
+	}
+	ctx.RelatedLogs = related
+
+	// Step 3: Link to the 5-minute aggregate bucket covering the event
+	ctx.AggregateWindow = e.aggregateWindow(deviceType, location, at)
+
+	return ctx, nil
+}
+
+// Enrich attaches context to a detected anomaly, leaving it untouched if the lookup fails
+func (e *Enricher) Enrich(anomaly *types.Anomaly) error {
+	ctx, err := e.ForDevice(anomaly.DeviceID, anomaly.Time)
+	if err != nil {
+		return err
+	}
+	anomaly.Context = ctx
+	return nil
+}
+
+// aggregateWindow describes the five_min aggregate bucket that contains the event time
+func (e *Enricher) aggregateWindow(deviceType, location string, at time.Time) types.AggregateWindow {
+	width, _ := db.AggregateBucketWidth("five_min")
+	start := at.Truncate(width)
+	end := start.Add(width)
+
+	params := url.Values{}
+	params.Set("view", "five_min")
+	params.Set("device_type", deviceType)
+	params.Set("location", location)
+	params.Set("start", start.Format(time.RFC3339))
+	params.Set("end", end.Format(time.RFC3339))
+
+	return types.AggregateWindow{
+		View:       "five_min",
+		DeviceType: deviceType,
+		Location:   location,
+		Start:      start,
+		End:        end,
+		URL:        e.baseURL + "/api/aggregates?" + params.Encode(),
+	}
+}
@@ -0,0 +1,305 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+)
+
+// Comparator compares a reading's value with a rule's threshold
+type Comparator string
+
+const (
+	Above    Comparator = ">"
+	AtLeast  Comparator = ">="
+	Below    Comparator = "<"
+	AtMost   Comparator = "<="
+	Equal    Comparator = "=="
+	NotEqual Comparator = "!="
+)
+
+// Metrics a rule can watch: the reading's raw_value or a numeric field of its metadata
+const (
+	metricValue  = "value"
+	metadataPath = "metadata."
+)
+
+// Compare reports whether value breaches threshold
+func (c Comparator) Compare(value, threshold float64) bool {
+	switch c {
+	case Above:
+		return value > threshold
+	case AtLeast:
+		return value >= threshold
+	case Below:
+		return value < threshold
+	case AtMost:
+		return value <= threshold
+	case Equal:
+		return value == threshold
+	case NotEqual:
+		return value != threshold
+	}
+	return false
+}
+
+// Rule raises an alert for a device whose readings breach Threshold continuously for Duration,
+// e.g. temperature > 35 for 5m in server_room; it resolves on the first reading that does not breach it
+type Rule struct {
+	Name       string `json:"name"`
+	DeviceType string `json:"device_type"`
+	Location   string `json:"location,omitempty"`
+	DeviceID   string `json:"device_id,omitempty"`
+	// Metric is "value" (default, the reading's raw_value) or "metadata.<key>" for a numeric metadata field
+	Metric     string          `json:"metric,omitempty"`
+	Comparator Comparator      `json:"comparator"`
+	Threshold  float64         `json:"threshold"`
+	Duration   string          `json:"duration,omitempty"` // how long the breach must last, e.g. "5m"; empty fires at once
+	Severity   string          `json:"severity,omitempty"` // info, warning (default) or critical
+	Notify     []notify.Config `json:"notify,omitempty"`
+	Runbook    *Runbook        `json:"runbook,omitempty"`
+	// SuggestRemediation has the language model propose remediation steps from the rule's runbook and
+	// the timeline of the alert's incident; they are added to the fire notification and the alert record
+	SuggestRemediation bool      `json:"suggest_remediation,omitempty"`
+	UpdatedAt          time.Time `json:"updated_at"`
+
+	hold time.Duration
+}
+
+// Runbook is what responders should know or do when a rule fires, sent along with its notifications
+type Runbook struct {
+	Text  string   `json:"text,omitempty"`
+	Links []string `json:"links,omitempty"` // absolute http(s) URLs, e.g. to a wiki page
+}
+
+// Validate checks the links
+func (r *Runbook) Validate() error {
+	for _, link := range r.Links {
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("runbook link %q must be an absolute http(s) URL", link)
+		}
+	}
+	return nil
+}
+
+// String renders the runbook for prompts; it is empty for a nil runbook
+func (r *Runbook) String() string {
+	if r == nil {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(r.Text))
+	for _, link := range r.Links {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("See: " + link)
+	}
+	return b.String()
+}
+
+// Validate checks the rule and fills in defaults
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.DeviceType == "" {
+		return fmt.Errorf("device_type is required")
+	}
+	if r.Metric == "" {
+		r.Metric = metricValue
+	}
+	if r.Metric != metricValue && (!strings.HasPrefix(r.Metric, metadataPath) || r.Metric == metadataPath) {
+		return fmt.Errorf("metric must be %q or %q followed by a metadata key", metricValue, metadataPath)
+	}
+	switch r.Comparator {
+	case Above, AtLeast, Below, AtMost, Equal, NotEqual:
+	default:
+		return fmt.Errorf("comparator must be one of >, >=, <, <=, ==, !=")
+	}
+	r.hold = 0
+	if r.Duration != "" {
+		hold, err := time.ParseDuration(r.Duration)
+		if err != nil {
+			return fmt.Errorf("invalid duration: %w", err)
+		}
+		if hold < 0 {
+			return fmt.Errorf("duration cannot be negative")
+		}
+		r.hold = hold
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = notify.SeverityWarning
+	case notify.SeverityInfo, notify.SeverityWarning, notify.SeverityCritical:
+	default:
+		return fmt.Errorf("severity must be info, warning or critical")
+	}
+	for i, config := range r.Notify {
+		if _, err := notify.New(config); err != nil {
+			return fmt.Errorf("notify[%d]: %w", i, err)
+		}
+	}
+	if r.Runbook != nil {
+		if err := r.Runbook.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the rule applies to a reading
+func (r *Rule) Matches(msg types.LogMessage) bool {
+	return r.DeviceType == msg.DeviceType &&
+		(r.Location == "" || r.Location == msg.Location) &&
+		(r.DeviceID == "" || r.DeviceID == msg.DeviceID)
+}
+
+// value returns the metric the rule watches, or false if the reading does not carry it
+func (r *Rule) value(msg types.LogMessage) (float64, bool) {
+	if r.Metric == metricValue {
+		if msg.RawValue == nil {
+			return 0, false
+		}
+		return *msg.RawValue, true
+	}
+	raw, ok := msg.Metadata[strings.TrimPrefix(r.Metric, metadataPath)]
+	if !ok {
+		return 0, false
+	}
+	return number(raw)
+}
+
+// unit is the unit of the watched metric; metadata fields carry none
+func (r *Rule) unit(msg types.LogMessage) string {
+	if r.Metric == metricValue {
+		return msg.Unit
+	}
+	return ""
+}
+
+// number accepts JSON numbers and numeric strings such as "36.5"
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Alert is a rule firing for one device
+type Alert struct {
+	ID         string     `json:"id"`
+	Rule       string     `json:"rule"`
+	Severity   string     `json:"severity"`
+	DeviceID   string     `json:"device_id"`
+	DeviceType string     `json:"device_type"`
+	Location   string     `json:"location"`
+	Metric     string     `json:"metric"`
+	Comparator Comparator `json:"comparator"`
+	Threshold  float64    `json:"threshold"`
+	Value      float64    `json:"value"` // the latest breaching value, or the value that resolved it
+	Unit       string     `json:"unit,omitempty"`
+	Since      time.Time  `json:"since"`    // when the breach started
+	FiredAt    time.Time  `json:"fired_at"` // when it had lasted the rule's duration
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	// Remediation is the suggested remediation of rules with suggest_remediation
+	Remediation string `json:"remediation,omitempty"`
+	// Context is what was happening around the device when the alert fired (not stored)
+	Context *types.AlertContext `json:"context,omitempty"`
+}
+
+// describe returns a title and message for the alert
+func (a Alert) describe() (string, string) {
+	title := fmt.Sprintf("%s on %s", a.Rule, a.DeviceID)
+	if a.ResolvedAt != nil {
+		title += " resolved"
+	}
+	metric := a.DeviceType
+	if a.Metric != metricValue {
+		metric = strings.TrimPrefix(a.Metric, metadataPath)
+	}
+	message := fmt.Sprintf("%s %g%s %s %g since %s", metric, a.Value, unitSuffix(a.Unit), a.Comparator,
+		a.Threshold, a.Since.UTC().Format(time.RFC3339))
+	if a.ResolvedAt != nil {
+		message = fmt.Sprintf("%s back at %g%s (threshold %s %g)", metric, a.Value, unitSuffix(a.Unit),
+			a.Comparator, a.Threshold)
+	}
+	return title, message
+}
+
+// Event converts the alert into the live-feed alert payload
+func (a Alert) Event() types.AlertEvent {
+	_, message := a.describe()
+	value, threshold := a.Value, a.Threshold
+	return types.AlertEvent{
+		Source:     "rules",
+		Rule:       a.Rule,
+		Kind:       a.Metric,
+		Severity:   a.Severity,
+		DeviceID:   a.DeviceID,
+		DeviceType: a.DeviceType,
+		Location:   a.Location,
+		Message:    message,
+		Value:      &value,
+		Threshold:  &threshold,
+		Since:      a.Since,
+		ResolvedAt: a.ResolvedAt,
+	}
+}
+
+// Notification describes the alert for notifiers outside its rule's notify list, e.g. outgoing webhooks
+func (a Alert) Notification() notify.Notification {
+	return a.notification(nil)
+}
+
+// notification describes the alert and its rule's runbook for notifiers
+func (a Alert) notification(runbook *Runbook) notify.Notification {
+	title, message := a.describe()
+	at := a.FiredAt
+	if a.ResolvedAt != nil {
+		at = *a.ResolvedAt
+	}
+
+	value := a.Value
+	n := notify.Notification{
+		Title:      title,
+		Message:    message,
+		Severity:   a.Severity,
+		Source:     a.Rule,
+		DedupKey:   fmt.Sprintf("rules:%s:%s", a.Rule, a.DeviceID),
+		Resolved:   a.ResolvedAt != nil,
+		DeviceID:   a.DeviceID,
+		DeviceType: a.DeviceType,
+		Location:   a.Location,
+		Value:      &value,
+		Unit:       a.Unit,
+		Time:       at,
+		Context:    a.Context,
+	}
+	if runbook != nil && a.ResolvedAt == nil {
+		n.Runbook = strings.TrimSpace(runbook.Text)
+		n.RunbookLinks = runbook.Links
+	}
+	return n
+}
+
+func unitSuffix(unit string) string {
+	if unit == "" {
+		return ""
+	}
+	return " " + unit
+}
@@ -0,0 +1,115 @@
+package anomaly
+
+import (
+	"fmt"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// Incident is a known past problem a backtest should detect
+// An empty DeviceID matches anomalies on any device
+type Incident struct {
+	Label    string    `json:"label,omitempty"`
+	DeviceID string    `json:"device_id,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// Validate checks the incident's time range
+func (i Incident) Validate() error {
+	if i.Start.IsZero() || i.End.IsZero() {
+		return fmt.Errorf("incident start and end are required")
+	}
+	if !i.End.After(i.Start) {
+		return fmt.Errorf("incident end must be after start")
+	}
+	return nil
+}
+
+// covers reports whether an anomaly falls inside the incident
+func (i Incident) covers(a types.Anomaly) bool {
+	return (i.DeviceID == "" || i.DeviceID == a.DeviceID) && !a.Time.Before(i.Start) && a.Time.Before(i.End)
+}
+
+// IncidentResult reports whether a known incident was detected
+type IncidentResult struct {
+	Incident
+	Detected      bool       `json:"detected"`
+	FirstDetected *time.Time `json:"first_detected,omitempty"`
+	Anomalies     int        `json:"anomalies"`
+}
+
+// Report is what a detector configuration would have found in a past range
+type Report struct {
+	Config    Config           `json:"config"`
+	Readings  int              `json:"readings"`
+	Baselines int              `json:"baselines"` // devices scored against a learned baseline
+	Anomalies []types.Anomaly  `json:"anomalies"`
+	Count     int              `json:"count"`
+	ByDevice  map[string]int   `json:"by_device"`
+	ByType    map[string]int   `json:"by_type"`
+	Incidents []IncidentResult `json:"incidents,omitempty"`
+	// Recall is the share of incidents with at least one anomaly (set when incidents are given)
+	Recall *float64 `json:"recall,omitempty"`
+	// OutsideIncidents counts anomalies in no incident, a proxy for false positives (set when incidents are given)
+	OutsideIncidents *int `json:"outside_incidents,omitempty"`
+}
+
+// Backtest runs a fresh detector over readings sorted oldest first, up to end, and scores it against incidents
+func Backtest(config Config, baselines map[string]Baseline, readings []types.LogMessage, end time.Time, incidents []Incident) Report {
+	found := Detect(config, baselines, readings, end)
+	if found == nil {
+		found = []types.Anomaly{}
+	}
+
+	report := Report{
+		Config:    config,
+		Readings:  len(readings),
+		Baselines: len(baselines),
+		Anomalies: found,
+		Count:     len(found),
+		ByDevice:  make(map[string]int),
+		ByType:    make(map[string]int),
+	}
+	for _, a := range found {
+		report.ByDevice[a.DeviceID]++
+		report.ByType[a.Type]++
+	}
+	if len(incidents) == 0 {
+		return report
+	}
+
+	inIncident := make([]bool, len(found))
+	detected := 0
+	for _, incident := range incidents {
+		result := IncidentResult{Incident: incident}
+		for i, a := range found {
+			if !incident.covers(a) {
+				continue
+			}
+			inIncident[i] = true
+			result.Anomalies++
+			if result.FirstDetected == nil {
+				at := a.Time
+				result.FirstDetected = &at
+			}
+		}
+		result.Detected = result.Anomalies > 0
+		if result.Detected {
+			detected++
+		}
+		report.Incidents = append(report.Incidents, result)
+	}
+
+	recall := float64(detected) / float64(len(incidents))
+	outside := 0
+	for _, in := range inIncident {
+		if !in {
+			outside++
+		}
+	}
+	report.Recall = &recall
+	report.OutsideIncidents = &outside
+	return report
+}
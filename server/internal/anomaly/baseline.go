@@ -0,0 +1,299 @@
+package anomaly
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Baseline is what a device's values normally look like, learned from a window of its readings
+// A freezer and a server room get their own mean and spread instead of sharing one threshold
+type Baseline struct {
+	DeviceID    string    `json:"device_id"`
+	DeviceType  string    `json:"device_type"`
+	Location    string    `json:"location"`
+	Samples     int64     `json:"samples"`
+	Mean        float64   `json:"mean"`
+	Variance    float64   `json:"variance"`
+	Hourly      []Profile `json:"hourly"` // seasonal profile by UTC hour of day, hours without readings left out
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Profile is the statistics of one hour of day
+type Profile struct {
+	Hour     int     `json:"hour"`
+	Samples  int64   `json:"samples"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+}
+
+// Expected returns the mean and standard deviation a value at the given time should be scored against:
+// the profile of its hour when that hour has minSamples readings, otherwise the whole baseline
+func (b Baseline) Expected(at time.Time, minSamples int) (float64, float64, bool) {
+	hour := at.UTC().Hour()
+	for _, p := range b.Hourly {
+		if p.Hour == hour && p.Samples >= int64(minSamples) {
+			return p.Mean, math.Sqrt(p.Variance), true
+		}
+	}
+	if b.Samples >= int64(minSamples) {
+		return b.Mean, math.Sqrt(b.Variance), true
+	}
+	return 0, 0, false
+}
+
+// Learner periodically recomputes the baselines of every device into device_baselines
+// and keeps the latest set in memory for detectors
+type Learner struct {
+	db        *sql.DB
+	window    time.Duration
+	mu        sync.RWMutex
+	baselines map[string]Baseline
+}
+
+// NewLearner creates a learner over the last ANOMALY_BASELINE_WINDOW of readings (default 7 days)
+// Nothing is loaded until Start or Load
+func NewLearner(db *sql.DB) *Learner {
+	return &Learner{
+		db:        db,
+		window:    getDurationEnv("ANOMALY_BASELINE_WINDOW", 7*24*time.Hour),
+		baselines: make(map[string]Baseline),
+	}
+}
+
+// Window is how much history each baseline is learned from
+func (l *Learner) Window() time.Duration {
+	return l.window
+}
+
+// Baselines returns the current baselines by device ID; the map must not be modified
+func (l *Learner) Baselines() map[string]Baseline {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.baselines
+}
+
+// Get returns one device's baseline
+func (l *Learner) Get(deviceID string) (Baseline, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	b, ok := l.baselines[deviceID]
+	return b, ok
+}
+
+// List returns the baselines sorted by device ID
+func (l *Learner) List() []Baseline {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	list := make([]Baseline, 0, len(l.baselines))
+	for _, b := range l.baselines {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// Load (re)reads the stored baselines
+func (l *Learner) Load() error {
+	rows, err := l.db.Query(`
+        SELECT device_id, device_type, location, samples, mean, variance, hourly, window_start, window_end, updated_at
+        FROM device_baselines
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	baselines := make(map[string]Baseline)
+	for rows.Next() {
+		var b Baseline
+		var hourly []byte
+		if err := rows.Scan(&b.DeviceID, &b.DeviceType, &b.Location, &b.Samples, &b.Mean, &b.Variance,
+			&hourly, &b.WindowStart, &b.WindowEnd, &b.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(hourly, &b.Hourly); err != nil {
+			return err
+		}
+		baselines[b.DeviceID] = b
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.baselines = baselines
+	l.mu.Unlock()
+	return nil
+}
+
+// Start loads the stored baselines, then recomputes them every interval
+// The first recompute runs as soon as the stored set is older than interval
+func (l *Learner) Start(interval time.Duration) {
+	if err := l.Load(); err != nil {
+		slog.Error("Failed to load device baselines", "error", err)
+	}
+
+	var latest time.Time
+	for _, b := range l.Baselines() {
+		if b.UpdatedAt.After(latest) {
+			latest = b.UpdatedAt
+		}
+	}
+	first := interval - time.Since(latest)
+	if first < 0 {
+		first = 0
+	}
+
+	go func() {
+		timer := time.NewTimer(first)
+		defer timer.Stop()
+		for range timer.C {
+			if n, err := l.Recompute(context.Background()); err != nil {
+				slog.Error("Failed to recompute device baselines", "error", err)
+			} else {
+				slog.Info("Recomputed device baselines", "devices", n)
+			}
+			timer.Reset(interval)
+		}
+	}()
+}
+
+// Recompute learns every device's baseline from the last window of readings and stores them
+// Devices without readings in the window keep their previous baseline
+func (l *Learner) Recompute(ctx context.Context) (int, error) {
+	end := time.Now()
+	learned, err := l.Compute(ctx, end.Add(-l.window), end)
+	if err != nil {
+		return 0, err
+	}
+	if len(learned) == 0 {
+		return 0, nil
+	}
+
+	var (
+		ids, deviceTypes, locations, hourlies []string
+		samples                               []int64
+		means, variances                      []float64
+	)
+	for _, b := range learned {
+		hourly, err := json.Marshal(b.Hourly)
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, b.DeviceID)
+		deviceTypes = append(deviceTypes, b.DeviceType)
+		locations = append(locations, b.Location)
+		samples = append(samples, b.Samples)
+		means = append(means, b.Mean)
+		variances = append(variances, b.Variance)
+		hourlies = append(hourlies, string(hourly))
+	}
+
+	_, err = l.db.ExecContext(ctx, `
+        INSERT INTO device_baselines (device_id, device_type, location, samples, mean, variance, hourly, window_start, window_end, updated_at)
+        SELECT v.device_id, v.device_type, v.location, v.samples, v.mean, v.variance, v.hourly::jsonb, $8::timestamptz, $9::timestamptz, NOW()
+        FROM unnest($1::text[], $2::text[], $3::text[], $4::bigint[], $5::float8[], $6::float8[], $7::text[])
+            AS v(device_id, device_type, location, samples, mean, variance, hourly)
+        ON CONFLICT (device_id) DO UPDATE SET
+            device_type = EXCLUDED.device_type,
+            location = EXCLUDED.location,
+            samples = EXCLUDED.samples,
+            mean = EXCLUDED.mean,
+            variance = EXCLUDED.variance,
+            hourly = EXCLUDED.hourly,
+            window_start = EXCLUDED.window_start,
+            window_end = EXCLUDED.window_end,
+            updated_at = NOW()
+    `, ids, deviceTypes, locations, samples, means, variances, hourlies, end.Add(-l.window), end)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	merged := make(map[string]Baseline, len(l.baselines)+len(learned))
+	for id, b := range l.baselines {
+		merged[id] = b
+	}
+	for id, b := range learned {
+		b.UpdatedAt = end
+		merged[id] = b
+	}
+	l.baselines = merged
+	l.mu.Unlock()
+	return len(learned), nil
+}
+
+// Compute learns baselines from the readings in [start, end) without storing them
+// Backtests use it to learn from the history before their range, as live detection would have
+func (l *Learner) Compute(ctx context.Context, start, end time.Time) (map[string]Baseline, error) {
+	rows, err := l.db.QueryContext(ctx, `
+        SELECT device_id, MAX(device_type), MAX(location),
+               EXTRACT(HOUR FROM time AT TIME ZONE 'UTC')::int AS hour,
+               COUNT(*), AVG(raw_value), COALESCE(VAR_SAMP(raw_value), 0)
+        FROM sensor_readings
+        WHERE time >= $1 AND time < $2
+          AND raw_value IS NOT NULL AND raw_value <> 'NaN'::float8
+          AND raw_value <> 'Infinity'::float8 AND raw_value <> '-Infinity'::float8
+        GROUP BY device_id, hour
+        ORDER BY device_id, hour
+    `, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	learned := make(map[string]Baseline)
+	for rows.Next() {
+		var deviceID, deviceType, location string
+		var p Profile
+		if err := rows.Scan(&deviceID, &deviceType, &location, &p.Hour, &p.Samples, &p.Mean, &p.Variance); err != nil {
+			return nil, err
+		}
+		b, ok := learned[deviceID]
+		if !ok {
+			b = Baseline{DeviceID: deviceID, DeviceType: deviceType, Location: location, WindowStart: start, WindowEnd: end}
+		}
+		b.Hourly = append(b.Hourly, p)
+		learned[deviceID] = b
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for id, b := range learned {
+		b.Samples, b.Mean, b.Variance = pool(b.Hourly)
+		learned[id] = b
+	}
+	return learned, nil
+}
+
+// pool combines the hourly statistics into the device's overall count, mean and sample variance
+func pool(hourly []Profile) (int64, float64, float64) {
+	var n int64
+	var sum float64
+	for _, p := range hourly {
+		n += p.Samples
+		sum += float64(p.Samples) * p.Mean
+	}
+	if n == 0 {
+		return 0, 0, 0
+	}
+	mean := sum / float64(n)
+	if n < 2 {
+		return n, mean, 0
+	}
+	var squares float64
+	for _, p := range hourly {
+		d := p.Mean - mean
+		squares += float64(p.Samples-1)*p.Variance + float64(p.Samples)*d*d
+	}
+	return n, mean, squares / float64(n-1)
+}
@@ -0,0 +1,363 @@
+// detects anomalies in a stream of readings: values that stray too far from the device's normal or
+// outside the valid range of its device type, values that change much faster than the device's
+// readings usually do, and devices that go silent. The same detector serves live detection and backtests
+
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/devicetypes"
+	"edge-insights/internal/types"
+)
+
+// Config tunes the detector; every field has a default from ANOMALY_* environment variables
+type Config struct {
+	ErrorLogs     bool    `json:"error_logs"`     // flag every ERROR log (ANOMALY_ERROR_LOGS, default false)
+	ZScore        float64 `json:"z_score"`        // flag values this many standard deviations from the device's mean; 0 disables (ANOMALY_Z_SCORE, default 3)
+	RateZScore    float64 `json:"rate_z_score"`   // flag changes this many standard deviations faster than the device's recent rate of change; 0 disables (ANOMALY_RATE_Z_SCORE, default 4)
+	SilenceFactor float64 `json:"silence_factor"` // flag devices quiet for this many times their usual reading interval; 0 disables (ANOMALY_SILENCE_FACTOR, default 5)
+	Window        int     `json:"window"`         // readings of each device the rolling statistics cover (ANOMALY_WINDOW, default 100)
+	MinSamples    int     `json:"min_samples"`    // readings a device (or baseline hour) needs before it is scored (ANOMALY_MIN_SAMPLES, default 20)
+	Baselines     bool    `json:"baselines"`      // score values against the device's learned baseline when it has one (ANOMALY_BASELINES, default true)
+}
+
+// LoadConfig reads the detector configuration from the environment
+func LoadConfig() Config {
+	return Config{
+		ErrorLogs:     os.Getenv("ANOMALY_ERROR_LOGS") == "true",
+		ZScore:        getFloatEnv("ANOMALY_Z_SCORE", 3),
+		RateZScore:    getFloatEnv("ANOMALY_RATE_Z_SCORE", 4),
+		SilenceFactor: getFloatEnv("ANOMALY_SILENCE_FACTOR", 5),
+		Window:        getIntEnv("ANOMALY_WINDOW", 100),
+		MinSamples:    getIntEnv("ANOMALY_MIN_SAMPLES", 20),
+		Baselines:     os.Getenv("ANOMALY_BASELINES") != "false",
+	}
+}
+
+// Validate checks a configuration, e.g. one sent to the backtest endpoint
+func (c Config) Validate() error {
+	if c.ZScore < 0 {
+		return fmt.Errorf("z_score cannot be negative")
+	}
+	if c.RateZScore < 0 {
+		return fmt.Errorf("rate_z_score cannot be negative")
+	}
+	if c.SilenceFactor != 0 && c.SilenceFactor < 1 {
+		return fmt.Errorf("silence_factor must be 0 or at least 1")
+	}
+	if c.MinSamples < 2 {
+		return fmt.Errorf("min_samples must be at least 2")
+	}
+	if c.Window < c.MinSamples {
+		return fmt.Errorf("window must be at least min_samples")
+	}
+	return nil
+}
+
+// Detector finds anomalies in readings fed to it oldest first
+// Values are scored against the device's learned baseline, or against a rolling window of its
+// recent values when it has none yet; rates of change and reading intervals are always scored
+// against rolling windows. The windows make it unsafe for concurrent use
+type Detector struct {
+	config    Config
+	baselines map[string]Baseline
+	devices   map[string]*history
+}
+
+// history is what the detector remembers of one device
+type history struct {
+	values    *window // latest values
+	rates     *window // latest changes per second between consecutive values
+	gaps      *window // latest intervals between readings, in seconds
+	last      types.LogMessage
+	lastValue *float64 // latest usable value, the start of the next rate
+	lastAt    time.Time
+}
+
+// NewDetector creates a detector with empty device history; baselines may be nil
+func NewDetector(config Config, baselines map[string]Baseline) *Detector {
+	return &Detector{config: config, baselines: baselines, devices: make(map[string]*history)}
+}
+
+// Observe scores one reading against the device's history, then adds it to that history
+func (d *Detector) Observe(reading types.LogMessage) []types.Anomaly {
+	var found []types.Anomaly
+
+	h, ok := d.devices[reading.DeviceID]
+	if !ok {
+		h = &history{values: newWindow(d.config.Window), rates: newWindow(d.config.Window), gaps: newWindow(d.config.Window)}
+		d.devices[reading.DeviceID] = h
+	} else if gap := reading.Time.Sub(h.last.Time); gap > 0 {
+		if a, ok := d.silence(h, reading.Time); ok {
+			found = append(found, a)
+		}
+		h.gaps.add(gap.Seconds())
+	}
+	h.last = reading
+
+	if d.config.ErrorLogs && reading.LogType == "ERROR" {
+		found = append(found, types.Anomaly{
+			Time:       reading.Time,
+			DeviceID:   reading.DeviceID,
+			Type:       "Error",
+			Severity:   "High",
+			Message:    reading.Message,
+			Confidence: 0.8,
+		})
+	}
+
+	if reading.RawValue == nil || math.IsNaN(*reading.RawValue) || math.IsInf(*reading.RawValue, 0) {
+		return found
+	}
+	value := *reading.RawValue
+
+	// Readings stored before their type's range was registered, or replayed in a backtest
+	if t, ok := devicetypes.Lookup(reading.DeviceType); ok && !t.InRange(value) {
+		found = append(found, outOfRange(reading, value, t))
+	}
+
+	if d.config.ZScore > 0 {
+		if mean, std, source, ok := d.expected(reading, h.values); ok && std > 0 {
+			z := (value - mean) / std
+			if math.Abs(z) >= d.config.ZScore {
+				found = append(found, outlier(reading, value, mean, z, d.config.ZScore, source))
+			}
+		}
+	}
+	h.values.add(value)
+
+	// Readings with the same timestamp have no rate; the later one starts the next
+	if h.lastValue != nil && reading.Time.After(h.lastAt) {
+		elapsed := reading.Time.Sub(h.lastAt)
+		rate := (value - *h.lastValue) / elapsed.Seconds()
+		if d.config.RateZScore > 0 && len(h.rates.values) >= d.config.MinSamples {
+			if mean, std := h.rates.stats(); std > 0 {
+				z := (rate - mean) / std
+				if math.Abs(z) >= d.config.RateZScore {
+					found = append(found, spike(reading, value-*h.lastValue, elapsed, z, d.config.RateZScore))
+				}
+			}
+		}
+		h.rates.add(rate)
+	}
+	h.lastValue = &value
+	h.lastAt = reading.Time
+	return found
+}
+
+// Silent reports every device whose last reading is overdue at the given time
+// Called once the readings up to now have been observed, so a stream that ends in silence is caught
+func (d *Detector) Silent(now time.Time) []types.Anomaly {
+	var found []types.Anomaly
+	for _, h := range d.devices {
+		if a, ok := d.silence(h, now); ok {
+			found = append(found, a)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].DeviceID < found[j].DeviceID })
+	return found
+}
+
+// silence describes the device's quiet spell up to the given time when it lasted at least
+// SilenceFactor times the device's mean interval between readings. Until that mean is known, the
+// reporting interval of its device type stands in, except for types that report only events
+func (d *Detector) silence(h *history, until time.Time) (types.Anomaly, bool) {
+	if d.config.SilenceFactor <= 0 {
+		return types.Anomaly{}, false
+	}
+	var usual float64
+	basis := "the device's usual interval"
+	if len(h.gaps.values) >= d.config.MinSamples {
+		usual, _ = h.gaps.stats()
+	} else if t, ok := devicetypes.Lookup(h.last.DeviceType); ok && !t.Silent && t.Interval() > 0 {
+		usual = t.Interval().Seconds()
+		basis = "the reporting interval of " + t.Name
+	} else {
+		return types.Anomaly{}, false
+	}
+	quiet := until.Sub(h.last.Time).Seconds()
+	if usual <= 0 || quiet < d.config.SilenceFactor*usual {
+		return types.Anomaly{}, false
+	}
+	severity := "Medium"
+	if quiet >= 2*d.config.SilenceFactor*usual {
+		severity = "High"
+	}
+	usualInterval := time.Duration(usual * float64(time.Second)).Round(time.Second)
+	return types.Anomaly{
+		Time:       h.last.Time,
+		DeviceID:   h.last.DeviceID,
+		Type:       "Silent",
+		Severity:   severity,
+		Message:    fmt.Sprintf("no readings for %s after the last one, %.1f× %s (%s)", time.Duration(quiet*float64(time.Second)).Round(time.Second), quiet/usual, basis, usualInterval),
+		Confidence: math.Round((1-usual/quiet)*1000) / 1000,
+	}, true
+}
+
+// expected picks what a value is scored against: the learned baseline, else the rolling window
+func (d *Detector) expected(reading types.LogMessage, w *window) (float64, float64, string, bool) {
+	if d.config.Baselines {
+		if b, ok := d.baselines[reading.DeviceID]; ok {
+			if mean, std, ok := b.Expected(reading.Time, d.config.MinSamples); ok {
+				return mean, std, "baseline", true
+			}
+		}
+	}
+	if len(w.values) < d.config.MinSamples {
+		return 0, 0, "", false
+	}
+	mean, std := w.stats()
+	return mean, std, "recent", true
+}
+
+// Detect runs a fresh detector over readings sorted oldest first that cover a range ending at end,
+// then flags the devices silent at end
+func Detect(config Config, baselines map[string]Baseline, readings []types.LogMessage, end time.Time) []types.Anomaly {
+	d := NewDetector(config, baselines)
+	var found []types.Anomaly
+	for _, reading := range readings {
+		found = append(found, d.Observe(reading)...)
+	}
+	return append(found, d.Silent(end)...)
+}
+
+// outlier describes a value z standard deviations from the expected mean
+// Confidence is Chebyshev's bound 1 - 1/z², which holds whatever the value distribution
+func outlier(reading types.LogMessage, value, mean, z, threshold float64, source string) types.Anomaly {
+	severity := "Medium"
+	if math.Abs(z) >= 2*threshold {
+		severity = "High"
+	}
+	direction := "above"
+	if z < 0 {
+		direction = "below"
+	}
+	shown := strconv.FormatFloat(value, 'g', 4, 64)
+	if reading.Unit != "" {
+		shown += " " + reading.Unit
+	}
+	return types.Anomaly{
+		Time:       reading.Time,
+		DeviceID:   reading.DeviceID,
+		Type:       "Outlier",
+		Severity:   severity,
+		Message:    fmt.Sprintf("%s is %.1fσ %s the device's %s mean (%.4g)", shown, math.Abs(z), direction, source, mean),
+		Confidence: math.Round((1-1/(z*z))*1000) / 1000,
+	}
+}
+
+// outOfRange describes a value its device type does not allow, e.g. a humidity above 100%
+func outOfRange(reading types.LogMessage, value float64, t devicetypes.Type) types.Anomaly {
+	shown := strconv.FormatFloat(value, 'g', 4, 64)
+	if reading.Unit != "" {
+		shown += " " + reading.Unit
+	}
+	return types.Anomaly{
+		Time:       reading.Time,
+		DeviceID:   reading.DeviceID,
+		Type:       "OutOfRange",
+		Severity:   "High",
+		Message:    fmt.Sprintf("%s is outside the valid range of %s readings (%s)", shown, t.Name, t.Range()),
+		Confidence: 1,
+	}
+}
+
+// spike describes a change of delta over elapsed, z standard deviations from the device's recent rate
+func spike(reading types.LogMessage, delta float64, elapsed time.Duration, z, threshold float64) types.Anomaly {
+	severity := "Medium"
+	if math.Abs(z) >= 2*threshold {
+		severity = "High"
+	}
+	direction := "rose"
+	if delta < 0 {
+		direction = "fell"
+	}
+	shown := strconv.FormatFloat(math.Abs(delta), 'g', 4, 64)
+	if reading.Unit != "" {
+		shown += " " + reading.Unit
+	}
+	return types.Anomaly{
+		Time:       reading.Time,
+		DeviceID:   reading.DeviceID,
+		Type:       "RateSpike",
+		Severity:   severity,
+		Message:    fmt.Sprintf("value %s %s in %s, %.1fσ from the device's recent rate of change", direction, shown, elapsed, math.Abs(z)),
+		Confidence: math.Round((1-1/(z*z))*1000) / 1000,
+	}
+}
+
+// window is a ring of a device's latest values with running sums for O(1) statistics
+type window struct {
+	values []float64
+	size   int
+	next   int
+	sum    float64
+	sumSq  float64
+}
+
+func newWindow(size int) *window {
+	return &window{values: make([]float64, 0, size), size: size}
+}
+
+func (w *window) add(v float64) {
+	if len(w.values) < w.size {
+		w.values = append(w.values, v)
+	} else {
+		old := w.values[w.next]
+		w.sum -= old
+		w.sumSq -= old * old
+		w.values[w.next] = v
+		w.next = (w.next + 1) % w.size
+	}
+	w.sum += v
+	w.sumSq += v * v
+}
+
+// stats returns the sample mean and standard deviation of the window
+func (w *window) stats() (float64, float64) {
+	n := float64(len(w.values))
+	mean := w.sum / n
+	variance := (w.sumSq - n*mean*mean) / (n - 1)
+	if variance < 0 {
+		variance = 0 // rounding
+	}
+	return mean, math.Sqrt(variance)
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil && f >= 0 {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+// MaxReadings caps the readings one detection or backtest run loads (ANOMALY_MAX_READINGS, default 200000)
+func MaxReadings() int {
+	return getIntEnv("ANOMALY_MAX_READINGS", 200000)
+}
@@ -0,0 +1,133 @@
+// export/import of platform configuration as a single JSON bundle
+// each configurable subsystem registers a Section; the bundle carries one entry per section
+
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BundleVersion is bumped when the bundle layout changes incompatibly
+const BundleVersion = 1
+
+// Bundle is the exported configuration document
+type Bundle struct {
+	Version    int                        `json:"version"`
+	ExportedAt time.Time                  `json:"exported_at"`
+	Sections   map[string]json.RawMessage `json:"sections"`
+}
+
+// Section is one kind of configuration object (derived metrics, alert rules, ...)
+type Section struct {
+	Name string
+	// Export returns the section's objects; the value is encoded as JSON
+	Export func() (interface{}, error)
+	// Import creates or replaces the objects in data and returns how many were applied
+	Import func(data json.RawMessage) (int, error)
+}
+
+// Registry holds the sections that take part in export/import
+type Registry struct {
+	mu       sync.RWMutex
+	sections map[string]Section
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{sections: make(map[string]Section)}
+}
+
+// Register adds a section, replacing any section with the same name
+func (r *Registry) Register(section Section) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sections[section.Name] = section
+}
+
+// Names lists the registered sections in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.sections))
+	for name := range r.sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export builds a bundle from the named sections (all sections when names is empty)
+func (r *Registry) Export(names []string) (*Bundle, error) {
+	if len(names) == 0 {
+		names = r.Names()
+	}
+
+	bundle := &Bundle{
+		Version:    BundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Sections:   make(map[string]json.RawMessage),
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, name := range names {
+		section, ok := r.sections[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown section %q", name)
+		}
+
+		objects, err := section.Export()
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", name, err)
+		}
+		data, err := json.Marshal(objects)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		bundle.Sections[name] = data
+	}
+	return bundle, nil
+}
+
+// Import applies the sections of a bundle (all of them when names is empty) in alphabetical order
+// It stops at the first failing section and returns the counts applied so far
+func (r *Registry) Import(bundle *Bundle, names []string) (map[string]int, error) {
+	if bundle.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d (expected %d)", bundle.Version, BundleVersion)
+	}
+
+	if len(names) == 0 {
+		for name := range bundle.Sections {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	applied := make(map[string]int)
+	for _, name := range names {
+		data, ok := bundle.Sections[name]
+		if !ok {
+			continue
+		}
+		section, ok := r.sections[name]
+		if !ok {
+			return applied, fmt.Errorf("unknown section %q", name)
+		}
+
+		n, err := section.Import(data)
+		applied[name] = n
+		if err != nil {
+			return applied, fmt.Errorf("failed to import %s: %w", name, err)
+		}
+	}
+	return applied, nil
+}
@@ -0,0 +1,16 @@
+package auth
+
+import "context"
+
+type subjectKey struct{}
+
+// WithSubject returns a copy of ctx that carries the subject (sub claim) of the caller's token
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext returns the subject stored in ctx, if the caller presented a token with one
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(string)
+	return subject, ok && subject != ""
+}
@@ -0,0 +1,274 @@
+// auth verifies the bearer tokens (JWTs) API callers present: the signature with a shared HMAC
+// secret or an RSA/ECDSA public key, the expiry and, when configured, the issuer and audience.
+// The caller's role is read from a claim
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"edge-insights/internal/roles"
+)
+
+// Config configures token verification
+type Config struct {
+	Secret    []byte           // HMAC key for HS256/384/512 (AUTH_JWT_SECRET)
+	PublicKey crypto.PublicKey // RSA key for RS256/384/512 or ECDSA key for ES256/384/512 (PEM file at AUTH_JWT_PUBLIC_KEY_FILE)
+	Issuer    string           // required iss, when set (AUTH_JWT_ISSUER)
+	Audience  string           // required aud, when set (AUTH_JWT_AUDIENCE)
+	RoleClaim string           // claim holding the role (AUTH_JWT_ROLE_CLAIM, default role)
+	Leeway    time.Duration    // clock skew allowed on exp and nbf (AUTH_JWT_LEEWAY, default 1m)
+}
+
+// LoadConfig reads the token configuration from the environment; without a secret or public key
+// authentication is disabled
+func LoadConfig() (Config, error) {
+	config := Config{
+		Secret:    []byte(os.Getenv("AUTH_JWT_SECRET")),
+		Issuer:    os.Getenv("AUTH_JWT_ISSUER"),
+		Audience:  os.Getenv("AUTH_JWT_AUDIENCE"),
+		RoleClaim: os.Getenv("AUTH_JWT_ROLE_CLAIM"),
+		Leeway:    time.Minute,
+	}
+	if config.RoleClaim == "" {
+		config.RoleClaim = "role"
+	}
+	if v := os.Getenv("AUTH_JWT_LEEWAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return config, fmt.Errorf("AUTH_JWT_LEEWAY must be a duration like 1m")
+		}
+		config.Leeway = d
+	}
+	if path := os.Getenv("AUTH_JWT_PUBLIC_KEY_FILE"); path != "" {
+		key, err := readPublicKey(path)
+		if err != nil {
+			return config, fmt.Errorf("AUTH_JWT_PUBLIC_KEY_FILE: %w", err)
+		}
+		config.PublicKey = key
+	}
+	if len(config.Secret) > 0 && len(config.Secret) < 32 {
+		return config, fmt.Errorf("AUTH_JWT_SECRET must be at least 32 bytes")
+	}
+	return config, nil
+}
+
+// Enabled reports whether tokens are verified at all
+func (c Config) Enabled() bool {
+	return len(c.Secret) > 0 || c.PublicKey != nil
+}
+
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %s", path)
+	}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", key)
+}
+
+// Error is a rejected token; Code is the RFC 6750 error code for the WWW-Authenticate header
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func invalid(format string, args ...interface{}) *Error {
+	return &Error{Code: "invalid_token", Message: fmt.Sprintf(format, args...)}
+}
+
+// Claims are the verified claims of a token
+type Claims struct {
+	Subject   string
+	Role      roles.Role
+	ExpiresAt time.Time
+}
+
+// Verifier checks tokens against a Config
+type Verifier struct {
+	config Config
+}
+
+// NewVerifier creates a verifier
+func NewVerifier(config Config) *Verifier {
+	return &Verifier{config: config}
+}
+
+// Verify checks a compact JWT at now and returns its claims; a token without the role claim gets
+// the viewer role
+func (v *Verifier) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("token is not a JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalid("malformed token header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("malformed token signature")
+	}
+	// The algorithm must match the configured key, so an HMAC token can never be checked
+	// against a public key used as a secret (or "none" accepted)
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalid("malformed token claims")
+	}
+	return v.checkClaims(claims, now)
+}
+
+func (v *Verifier) checkClaims(claims map[string]interface{}, now time.Time) (*Claims, error) {
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, invalid("token has no expiry")
+	}
+	if now.After(exp.Add(v.config.Leeway)) {
+		return nil, invalid("token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.config.Leeway).Before(nbf) {
+		return nil, invalid("token is not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+	if v.config.Issuer != "" && claims["iss"] != v.config.Issuer {
+		return nil, invalid("token issuer is not accepted")
+	}
+	if v.config.Audience != "" && !hasAudience(claims["aud"], v.config.Audience) {
+		return nil, invalid("token audience is not accepted")
+	}
+
+	result := &Claims{ExpiresAt: exp, Role: roles.Viewer}
+	result.Subject, _ = claims["sub"].(string)
+	if raw, ok := claims[v.config.RoleClaim]; ok {
+		name, _ := raw.(string)
+		role, ok := roles.Parse(name)
+		if !ok {
+			return nil, invalid("token has an unknown %s %q", v.config.RoleClaim, name)
+		}
+		result.Role = role
+	}
+	return result, nil
+}
+
+func (v *Verifier) verifySignature(alg, signed string, signature []byte) error {
+	var hashFunc crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hashFunc = crypto.SHA256
+	case "384":
+		hashFunc = crypto.SHA384
+	case "512":
+		hashFunc = crypto.SHA512
+	default:
+		return invalid("unsupported token algorithm %q", alg)
+	}
+
+	// The key is chosen by the algorithm family and must be of its type
+	rsaKey, _ := v.config.PublicKey.(*rsa.PublicKey)
+	ecKey, _ := v.config.PublicKey.(*ecdsa.PublicKey)
+	switch {
+	case strings.HasPrefix(alg, "RS") && rsaKey != nil:
+		if rsa.VerifyPKCS1v15(rsaKey, hashFunc, digest(hashFunc, signed), signature) != nil {
+			return invalid("token signature is invalid")
+		}
+	case strings.HasPrefix(alg, "ES") && ecKey != nil:
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return invalid("token signature is invalid")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest(hashFunc, signed), r, s) {
+			return invalid("token signature is invalid")
+		}
+	case strings.HasPrefix(alg, "HS") && len(v.config.Secret) > 0:
+		mac := hmac.New(hashFunc.New, v.config.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalid("token signature is invalid")
+		}
+	default:
+		return invalid("token algorithm %s does not match a configured key", alg)
+	}
+	return nil
+}
+
+func digest(h crypto.Hash, signed string) []byte {
+	d := h.New()
+	d.Write([]byte(signed))
+	return d.Sum(nil)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate reads a JWT NumericDate (seconds since the epoch)
+func numericDate(v interface{}) (time.Time, bool) {
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// hasAudience reports whether aud (a string or a list of strings) contains want
+func hasAudience(aud interface{}, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []interface{}:
+		for _, a := range aud {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+// Package commands is the downlink to devices and its audit trail
+// A command issued through the API waits until its device next sends a frame over /ws and is
+// delivered on that connection (devices are not reachable otherwise); the device then acknowledges
+// it and reports its result. Every step is stored on the command along with who issued it
+// Rollouts send one command to a group of devices in stages (see Rollouts)
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	apperrors "edge-insights/internal/errors"
+)
+
+// Status is where a command is in its lifecycle
+type Status string
+
+const (
+	StatusQueued       Status = "queued"       // waiting for the device to connect
+	StatusDelivered    Status = "delivered"    // written to the device's connection
+	StatusAcknowledged Status = "acknowledged" // the device received it and is executing it
+	StatusSucceeded    Status = "succeeded"    // the device reported success
+	StatusFailed       Status = "failed"       // the device reported failure
+	StatusExpired      Status = "expired"      // not delivered before expires_at
+	StatusCancelled    Status = "cancelled"    // withdrawn before delivery, with its rollout
+)
+
+const (
+	// DefaultTTL is how long a command waits for its device when no ttl is given
+	DefaultTTL = 24 * time.Hour
+	// MaxTTL bounds ttl so a forgotten command is not delivered weeks later
+	MaxTTL = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrNotFound is returned for a command that does not exist for the device
+	ErrNotFound = fmt.Errorf("command %w", apperrors.ErrNotFound)
+	// ErrTransition is returned for a status report the command's current status does not allow
+	ErrTransition = apperrors.Mark(errors.New("invalid status transition"), apperrors.ErrConflict)
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+
+// Command is one instruction to one device and what became of it
+type Command struct {
+	ID             string                 `json:"id"`
+	DeviceID       string                 `json:"device_id"`
+	Command        string                 `json:"command"`
+	Params         map[string]interface{} `json:"params,omitempty"`
+	IssuedBy       string                 `json:"issued_by"`   // token subject, or "anonymous" without authentication
+	IssuerRole     string                 `json:"issuer_role"` // role the command was issued with
+	RolloutID      string                 `json:"rollout_id,omitempty"`
+	Stage          int                    `json:"stage,omitempty"` // rollout stage, from 1
+	Status         Status                 `json:"status"`
+	IssuedAt       time.Time              `json:"issued_at"`
+	ExpiresAt      time.Time              `json:"expires_at"`
+	DeliveredAt    *time.Time             `json:"delivered_at,omitempty"`
+	AcknowledgedAt *time.Time             `json:"acknowledged_at,omitempty"`
+	CompletedAt    *time.Time             `json:"completed_at,omitempty"` // succeeded, failed, expired or cancelled
+	Result         json.RawMessage        `json:"result,omitempty"`       // as reported by the device
+	Error          string                 `json:"error,omitempty"`
+}
+
+// Validate checks the fields set by the caller of Store.Issue
+func (c *Command) Validate() error {
+	if c.DeviceID == "" {
+		return fmt.Errorf("device_id is required")
+	}
+	if !namePattern.MatchString(c.Command) {
+		return fmt.Errorf("command must be lowercase letters, digits, '_', '.' or '-', starting with a letter (at most 64)")
+	}
+	return nil
+}
+
+// Report is a device's update on a delivered command:
+// {"type": "command_status", "device_id": "...", "id": "...", "status": "acknowledged" | "succeeded" | "failed", "result": ..., "error": "..."}
+type Report struct {
+	DeviceID string          `json:"device_id"`
+	ID       string          `json:"id"`
+	Status   Status          `json:"status"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Validate checks that a report carries a status a device may set
+func (r *Report) Validate() error {
+	if r.DeviceID == "" || r.ID == "" {
+		return fmt.Errorf("device_id and id are required")
+	}
+	switch r.Status {
+	case StatusAcknowledged, StatusSucceeded, StatusFailed:
+		return nil
+	}
+	return fmt.Errorf("status must be %q, %q or %q", StatusAcknowledged, StatusSucceeded, StatusFailed)
+}
+
+// ParseStatus checks a status filter
+func ParseStatus(s string) (Status, bool) {
+	switch Status(s) {
+	case StatusQueued, StatusDelivered, StatusAcknowledged, StatusSucceeded, StatusFailed, StatusExpired, StatusCancelled:
+		return Status(s), true
+	}
+	return "", false
+}
+
+// Finished reports whether a command with status s can no longer change
+func (s Status) Finished() bool {
+	switch s {
+	case StatusSucceeded, StatusFailed, StatusExpired, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,456 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	apperrors "edge-insights/internal/errors"
+)
+
+// RolloutStatus is where a rollout is in its lifecycle
+type RolloutStatus string
+
+const (
+	RolloutRunning   RolloutStatus = "running"   // issuing stages as the previous ones finish
+	RolloutPaused    RolloutStatus = "paused"    // no further stage is issued until it is resumed
+	RolloutCompleted RolloutStatus = "completed" // every stage finished
+	RolloutCancelled RolloutStatus = "cancelled" // stopped; its undelivered commands were withdrawn
+)
+
+const (
+	// DefaultFailureThreshold pauses a rollout when more than 10% of a stage's commands fail
+	DefaultFailureThreshold = 0.1
+	// DefaultStageTimeout is how long a stage may take when no stage_timeout is given
+	DefaultStageTimeout = time.Hour
+	// MaxRolloutDevices bounds the devices one rollout targets
+	MaxRolloutDevices = 10000
+)
+
+// DefaultStages reach 10%, then 50%, then all of the devices
+var DefaultStages = []int{10, 50, 100}
+
+var (
+	// ErrRolloutNotFound is returned for a rollout that does not exist
+	ErrRolloutNotFound = fmt.Errorf("rollout %w", apperrors.ErrNotFound)
+	// ErrRolloutState is returned when a rollout's status does not allow the change
+	ErrRolloutState = apperrors.Mark(errors.New("rollout cannot be changed in its current status"), apperrors.ErrConflict)
+)
+
+// Target selects the devices of a rollout: the listed IDs, or the registered devices of a type
+// and/or location
+type Target struct {
+	DeviceIDs  []string `json:"device_ids,omitempty"`
+	DeviceType string   `json:"device_type,omitempty"`
+	Location   string   `json:"location,omitempty"`
+}
+
+// Rollout sends one command to a group of devices in stages, each reaching a larger share of the
+// group once the previous stage has finished, and pauses when too many of a stage's commands fail
+type Rollout struct {
+	ID               string                 `json:"id"`
+	Command          string                 `json:"command"`
+	Params           map[string]interface{} `json:"params,omitempty"`
+	Target           Target                 `json:"target"`
+	Devices          []string               `json:"devices"`           // the group, in rollout order
+	Stages           []int                  `json:"stages"`            // share of the group reached by each stage, in percent
+	FailureThreshold float64                `json:"failure_threshold"` // share of a stage's commands that may fail
+	StageTimeout     string                 `json:"stage_timeout"`     // after it, a stage's unfinished commands count as failed
+	Status           RolloutStatus          `json:"status"`
+	Stage            int                    `json:"stage"` // current stage, from 1
+	StageStartedAt   time.Time              `json:"stage_started_at"`
+	WaivedStage      int                    `json:"waived_stage,omitempty"` // stage resumed despite its failures
+	PausedReason     string                 `json:"paused_reason,omitempty"`
+	IssuedBy         string                 `json:"issued_by"`
+	IssuerRole       string                 `json:"issuer_role"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+	Progress         []StageProgress        `json:"progress,omitempty"`
+}
+
+// StageProgress counts the commands of one stage
+type StageProgress struct {
+	Stage    int            `json:"stage"`
+	Percent  int            `json:"percent"`
+	Devices  int            `json:"devices"`
+	Statuses map[Status]int `json:"statuses"`
+	Failed   int            `json:"failed"`   // failed, expired or cancelled, and unfinished after stage_timeout
+	Finished bool           `json:"finished"` // every command finished, or stage_timeout passed
+}
+
+// Validate checks a new rollout and fills in the default stages and timeout
+func (r *Rollout) Validate() error {
+	if !namePattern.MatchString(r.Command) {
+		return fmt.Errorf("command must be lowercase letters, digits, '_', '.' or '-', starting with a letter (at most 64)")
+	}
+	if len(r.Devices) == 0 {
+		return fmt.Errorf("the target matches no devices")
+	}
+	if len(r.Devices) > MaxRolloutDevices {
+		return fmt.Errorf("the target matches %d devices; a rollout may target at most %d", len(r.Devices), MaxRolloutDevices)
+	}
+	if len(r.Stages) == 0 {
+		r.Stages = DefaultStages
+	}
+	for i, pct := range r.Stages {
+		if pct < 1 || pct > 100 || i > 0 && pct <= r.Stages[i-1] {
+			return fmt.Errorf("stages must be increasing percentages between 1 and 100")
+		}
+	}
+	if r.Stages[len(r.Stages)-1] != 100 {
+		return fmt.Errorf("the last stage must be 100")
+	}
+	if r.FailureThreshold < 0 || r.FailureThreshold > 1 {
+		return fmt.Errorf("failure_threshold must be between 0 and 1")
+	}
+	if r.StageTimeout == "" {
+		r.StageTimeout = DefaultStageTimeout.String()
+	}
+	if d, err := time.ParseDuration(r.StageTimeout); err != nil || d <= 0 || d > MaxTTL {
+		return fmt.Errorf("stage_timeout must be a positive duration up to %s, like 1h", MaxTTL)
+	}
+	return nil
+}
+
+func (r *Rollout) stageTimeout() time.Duration {
+	d, _ := time.ParseDuration(r.StageTimeout)
+	return d
+}
+
+// stageDevices returns the devices of stage n (from 1): those up to its share of the group that
+// earlier stages did not reach
+func (r *Rollout) stageDevices(n int) []string {
+	end := func(i int) int {
+		if i == 0 {
+			return 0
+		}
+		return int(math.Ceil(float64(r.Stages[i-1]) * float64(len(r.Devices)) / 100))
+	}
+	return r.Devices[end(n-1):end(n)]
+}
+
+// Rollouts keeps rollouts in the command_rollouts table and advances the running ones
+type Rollouts struct {
+	db       *sql.DB
+	commands *Store
+	mu       sync.Mutex // serializes changes to rollouts
+}
+
+// NewRollouts creates a rollout manager issuing through commands
+func NewRollouts(db *sql.DB, commands *Store) *Rollouts {
+	return &Rollouts{db: db, commands: commands}
+}
+
+// Create validates r, shuffles its devices so every stage samples the whole group, stores it and
+// issues its first stage
+func (m *Rollouts) Create(ctx context.Context, r Rollout) (*Rollout, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	r.Devices = append([]string(nil), r.Devices...)
+	rand.Shuffle(len(r.Devices), func(i, j int) { r.Devices[i], r.Devices[j] = r.Devices[j], r.Devices[i] })
+
+	params, err := json.Marshal(r.Params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	target, _ := json.Marshal(r.Target)
+	devices, _ := json.Marshal(r.Devices)
+	stages, _ := json.Marshal(r.Stages)
+
+	r.ID = id
+	r.Status = RolloutRunning
+	r.Stage = 1
+	r.CreatedAt = time.Now().UTC()
+	r.UpdatedAt, r.StageStartedAt = r.CreatedAt, r.CreatedAt
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.db.ExecContext(ctx, `
+        INSERT INTO command_rollouts (id, command, params, target, devices, stages, failure_threshold, stage_timeout,
+                                      status, stage, stage_started_at, issued_by, issuer_role, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $14)
+    `, r.ID, r.Command, params, target, devices, stages, r.FailureThreshold, r.StageTimeout,
+		r.Status, r.Stage, r.StageStartedAt, r.IssuedBy, r.IssuerRole, r.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := m.issueStage(ctx, &r); err != nil {
+		return nil, err
+	}
+	return m.withProgress(ctx, &r)
+}
+
+// issueStage queues the command for the devices of r's current stage
+// A command waits for its device no longer than the stage may take
+func (m *Rollouts) issueStage(ctx context.Context, r *Rollout) error {
+	for _, deviceID := range r.stageDevices(r.Stage) {
+		if _, err := m.commands.Issue(ctx, Command{
+			DeviceID:   deviceID,
+			Command:    r.Command,
+			Params:     r.Params,
+			IssuedBy:   r.IssuedBy,
+			IssuerRole: r.IssuerRole,
+			RolloutID:  r.ID,
+			Stage:      r.Stage,
+		}, r.stageTimeout()); err != nil {
+			return fmt.Errorf("failed to issue stage %d of rollout %s to %s: %w", r.Stage, r.ID, deviceID, err)
+		}
+	}
+	return nil
+}
+
+// Get returns a rollout with the progress of its stages so far
+func (m *Rollouts) Get(ctx context.Context, id string) (*Rollout, error) {
+	found, err := m.query(ctx, `WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrRolloutNotFound
+	}
+	return m.withProgress(ctx, &found[0])
+}
+
+// List returns the rollouts, newest first, optionally only those with status, without progress
+func (m *Rollouts) List(ctx context.Context, status RolloutStatus, limit int) ([]Rollout, error) {
+	return m.query(ctx, `WHERE ($1 = '' OR status = $1) ORDER BY created_at DESC LIMIT $2`, string(status), limit)
+}
+
+// Pause stops a running rollout from issuing further stages; issued commands run their course
+func (m *Rollouts) Pause(ctx context.Context, id, reason string) (*Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.transition(ctx, id, RolloutRunning, RolloutPaused, reason, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.withProgress(ctx, r)
+}
+
+// Resume runs a paused rollout again; the failures of its current stage no longer pause it
+func (m *Rollouts) Resume(ctx context.Context, id string) (*Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.transition(ctx, id, RolloutPaused, RolloutRunning, "", true)
+	if err != nil {
+		return nil, err
+	}
+	return m.withProgress(ctx, r)
+}
+
+// Cancel stops a running or paused rollout and withdraws its commands not yet delivered
+func (m *Rollouts) Cancel(ctx context.Context, id string) (*Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.transition(ctx, id, "", RolloutCancelled, "", false)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.db.ExecContext(ctx, `
+        UPDATE device_commands SET status = 'cancelled', completed_at = NOW()
+        WHERE rollout_id = $1 AND status = 'queued'
+    `, id); err != nil {
+		return nil, err
+	}
+	return m.withProgress(ctx, r)
+}
+
+// transition moves a rollout from status from (empty: running or paused) to status to
+func (m *Rollouts) transition(ctx context.Context, id string, from, to RolloutStatus, reason string, waive bool) (*Rollout, error) {
+	found, err := m.query(ctx, `WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrRolloutNotFound
+	}
+	r := &found[0]
+	if from != "" && r.Status != from || from == "" && r.Status != RolloutRunning && r.Status != RolloutPaused {
+		return nil, fmt.Errorf("%w: the rollout is %s", ErrRolloutState, r.Status)
+	}
+	r.Status, r.PausedReason = to, reason
+	if waive {
+		r.WaivedStage = r.Stage
+	}
+	if err := m.save(ctx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// save writes the mutable state of a rollout
+func (m *Rollouts) save(ctx context.Context, r *Rollout) error {
+	r.UpdatedAt = time.Now().UTC()
+	_, err := m.db.ExecContext(ctx, `
+        UPDATE command_rollouts
+        SET status = $2, stage = $3, stage_started_at = $4, waived_stage = $5, paused_reason = NULLIF($6, ''), updated_at = $7
+        WHERE id = $1
+    `, r.ID, r.Status, r.Stage, r.StageStartedAt, r.WaivedStage, r.PausedReason, r.UpdatedAt)
+	return err
+}
+
+// Start advances the running rollouts every interval
+func (m *Rollouts) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := m.Advance(context.Background(), time.Now()); err != nil {
+				slog.Error("Failed to advance command rollouts", "error", err)
+			}
+		}
+	}()
+}
+
+// Advance checks every running rollout's current stage: too many failures pause the rollout,
+// and a finished stage starts the next one or completes the rollout
+func (m *Rollouts) Advance(ctx context.Context, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running, err := m.query(ctx, `WHERE status = 'running'`)
+	if err != nil {
+		return err
+	}
+	for i := range running {
+		r := &running[i]
+		if err := m.advance(ctx, r, now); err != nil {
+			return fmt.Errorf("rollout %s: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+func (m *Rollouts) advance(ctx context.Context, r *Rollout, now time.Time) error {
+	if _, err := m.withProgressAt(ctx, r, now); err != nil {
+		return err
+	}
+	current := r.Progress[r.Stage-1]
+
+	if r.Stage != r.WaivedStage && current.Devices > 0 &&
+		float64(current.Failed) > r.FailureThreshold*float64(current.Devices) {
+		r.Status = RolloutPaused
+		r.PausedReason = fmt.Sprintf("%d of %d commands failed in stage %d (threshold %.0f%%)",
+			current.Failed, current.Devices, r.Stage, r.FailureThreshold*100)
+		slog.Warn("Rollout paused", "rollout_id", r.ID, "command", r.Command, "reason", r.PausedReason)
+		return m.save(ctx, r)
+	}
+	if !current.Finished {
+		return nil
+	}
+
+	if r.Stage == len(r.Stages) {
+		r.Status = RolloutCompleted
+		slog.Info("Rollout completed", "rollout_id", r.ID, "command", r.Command, "devices", len(r.Devices))
+		return m.save(ctx, r)
+	}
+	r.Stage++
+	r.StageStartedAt = now.UTC()
+	if err := m.save(ctx, r); err != nil {
+		return err
+	}
+	slog.Info("Rollout stage started", "rollout_id", r.ID, "command", r.Command, "stage", r.Stage, "percent", r.Stages[r.Stage-1], "devices", len(r.Devices))
+	return m.issueStage(ctx, r)
+}
+
+func (m *Rollouts) withProgress(ctx context.Context, r *Rollout) (*Rollout, error) {
+	return m.withProgressAt(ctx, r, time.Now())
+}
+
+// withProgressAt counts the commands of each stage of r issued so far
+func (m *Rollouts) withProgressAt(ctx context.Context, r *Rollout, now time.Time) (*Rollout, error) {
+	rows, err := m.db.QueryContext(ctx, `
+        SELECT stage, status, count(*) FROM device_commands WHERE rollout_id = $1 GROUP BY stage, status
+    `, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r.Progress = make([]StageProgress, r.Stage)
+	for i := range r.Progress {
+		r.Progress[i] = StageProgress{Stage: i + 1, Percent: r.Stages[i], Statuses: map[Status]int{}}
+	}
+	for rows.Next() {
+		var stage, n int
+		var status Status
+		if err := rows.Scan(&stage, &status, &n); err != nil {
+			return nil, err
+		}
+		if stage < 1 || stage > len(r.Progress) {
+			continue
+		}
+		p := &r.Progress[stage-1]
+		p.Statuses[status] += n
+		p.Devices += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range r.Progress {
+		p := &r.Progress[i]
+		unfinished := 0
+		for status, n := range p.Statuses {
+			switch {
+			case status == StatusFailed, status == StatusExpired, status == StatusCancelled:
+				p.Failed += n
+			case !status.Finished():
+				unfinished += n
+			}
+		}
+		// Earlier stages finished when the next one started
+		timedOut := i+1 < r.Stage || !now.Before(r.StageStartedAt.Add(r.stageTimeout()))
+		if timedOut {
+			p.Failed += unfinished
+		}
+		p.Finished = unfinished == 0 || timedOut
+	}
+	return r, nil
+}
+
+const rolloutColumns = `id, command, params, target, devices, stages, failure_threshold, stage_timeout, status, stage,
+        stage_started_at, waived_stage, COALESCE(paused_reason, ''), issued_by, issuer_role, created_at, updated_at`
+
+func (m *Rollouts) query(ctx context.Context, where string, args ...interface{}) ([]Rollout, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT `+rolloutColumns+` FROM command_rollouts `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Rollout{}
+	for rows.Next() {
+		var r Rollout
+		var params, target, devices, stages []byte
+		if err := rows.Scan(&r.ID, &r.Command, &params, &target, &devices, &stages, &r.FailureThreshold, &r.StageTimeout,
+			&r.Status, &r.Stage, &r.StageStartedAt, &r.WaivedStage, &r.PausedReason, &r.IssuedBy, &r.IssuerRole,
+			&r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		for _, field := range []struct {
+			data   []byte
+			target interface{}
+		}{{params, &r.Params}, {target, &r.Target}, {devices, &r.Devices}, {stages, &r.Stages}} {
+			if len(field.data) == 0 {
+				continue
+			}
+			if err := json.Unmarshal(field.data, field.target); err != nil {
+				return nil, fmt.Errorf("invalid rollout %s: %w", r.ID, err)
+			}
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,246 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const columns = `id, device_id, command, params, issued_by, issuer_role, COALESCE(rollout_id, ''), COALESCE(stage, 0),
+        status, issued_at, expires_at, delivered_at, acknowledged_at, completed_at, result, COALESCE(error, '')`
+
+// Store keeps commands in the device_commands table and counts the queued ones per device in
+// memory, so a device's frames only cost a query when something is waiting for it
+type Store struct {
+	db      *sql.DB
+	mu      sync.Mutex
+	pending map[string]int // device ID -> queued commands
+}
+
+// NewStore creates a store and counts the queued commands
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, pending: make(map[string]int)}
+	return s, s.Load()
+}
+
+// Load (re)counts the queued commands of every device
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`SELECT device_id, count(*) FROM device_commands WHERE status = 'queued' GROUP BY device_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	pending := make(map[string]int)
+	for rows.Next() {
+		var deviceID string
+		var n int
+		if err := rows.Scan(&deviceID, &n); err != nil {
+			return err
+		}
+		pending[deviceID] = n
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.pending = pending
+	s.mu.Unlock()
+	return nil
+}
+
+// Issue queues c for its device; ttl is how long it may wait (0: DefaultTTL, at most MaxTTL)
+func (s *Store) Issue(ctx context.Context, c Command, ttl time.Duration) (*Command, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if ttl > MaxTTL {
+		return nil, fmt.Errorf("ttl must be at most %s", MaxTTL)
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	var params []byte
+	if c.Params != nil {
+		if params, err = json.Marshal(c.Params); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	c.ID = id
+	c.Status = StatusQueued
+	c.IssuedAt = time.Now().UTC()
+	c.ExpiresAt = c.IssuedAt.Add(ttl)
+	if _, err := s.db.ExecContext(ctx, `
+        INSERT INTO device_commands (id, device_id, command, params, issued_by, issuer_role, rollout_id, stage,
+                                     status, issued_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, 0), $9, $10, $11)
+    `, c.ID, c.DeviceID, c.Command, params, c.IssuedBy, c.IssuerRole, c.RolloutID, c.Stage,
+		c.Status, c.IssuedAt, c.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.pending[c.DeviceID]++
+	s.mu.Unlock()
+	return &c, nil
+}
+
+// HasPending reports whether commands may be waiting for deviceID
+func (s *Store) HasPending(deviceID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending[deviceID] > 0
+}
+
+// Pending expires the device's overdue commands and returns the queued ones, oldest first
+func (s *Store) Pending(ctx context.Context, deviceID string) ([]Command, error) {
+	if _, err := s.db.ExecContext(ctx, `
+        UPDATE device_commands SET status = 'expired', completed_at = NOW()
+        WHERE device_id = $1 AND status = 'queued' AND expires_at <= NOW()
+    `, deviceID); err != nil {
+		return nil, err
+	}
+	queued, err := s.query(ctx, `SELECT `+columns+` FROM device_commands
+        WHERE device_id = $1 AND status = 'queued' ORDER BY issued_at`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.setPendingLocked(deviceID, len(queued))
+	s.mu.Unlock()
+	return queued, nil
+}
+
+// Delivered records that a queued command was written to its device; it reports false when
+// the command was no longer queued (delivered on another connection meanwhile)
+func (s *Store) Delivered(ctx context.Context, c Command) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE device_commands SET status = 'delivered', delivered_at = NOW()
+        WHERE id = $1 AND status = 'queued'
+    `, c.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	s.setPendingLocked(c.DeviceID, s.pending[c.DeviceID]-1)
+	s.mu.Unlock()
+	return true, nil
+}
+
+func (s *Store) setPendingLocked(deviceID string, n int) {
+	if n > 0 {
+		s.pending[deviceID] = n
+	} else {
+		delete(s.pending, deviceID)
+	}
+}
+
+// Report applies a device's status report to one of its delivered commands
+// Acknowledgements follow delivery and results follow delivery or acknowledgement; a report
+// repeating the current status is accepted unchanged so devices can resend after a reconnect
+func (s *Store) Report(ctx context.Context, r Report) (*Command, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	from := []string{string(StatusDelivered)}
+	if r.Status != StatusAcknowledged {
+		from = append(from, string(StatusAcknowledged))
+	}
+	var result []byte
+	if len(r.Result) > 0 {
+		if !json.Valid(r.Result) {
+			return nil, fmt.Errorf("result must be JSON")
+		}
+		result = r.Result
+	}
+
+	updated, err := s.query(ctx, `
+        UPDATE device_commands SET
+            status = $3,
+            acknowledged_at = CASE WHEN $3 = 'acknowledged' THEN NOW() ELSE acknowledged_at END,
+            completed_at = CASE WHEN $3 = 'acknowledged' THEN completed_at ELSE NOW() END,
+            result = COALESCE($4, result),
+            error = NULLIF($5, '')
+        WHERE device_id = $1 AND id = $2 AND status = ANY($6::text[])
+        RETURNING `+columns, r.DeviceID, r.ID, string(r.Status), result, r.Error, from)
+	if err != nil {
+		return nil, err
+	}
+	if len(updated) == 1 {
+		return &updated[0], nil
+	}
+
+	current, err := s.Get(ctx, r.DeviceID, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status == r.Status {
+		return current, nil
+	}
+	return nil, fmt.Errorf("%w: %s command cannot become %s", ErrTransition, current.Status, r.Status)
+}
+
+// Get returns one command of a device
+func (s *Store) Get(ctx context.Context, deviceID, id string) (*Command, error) {
+	found, err := s.query(ctx, `SELECT `+columns+` FROM device_commands WHERE device_id = $1 AND id = $2`, deviceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+	return &found[0], nil
+}
+
+// List returns a device's commands, newest first, optionally only those with status
+func (s *Store) List(ctx context.Context, deviceID string, status Status, limit int) ([]Command, error) {
+	return s.query(ctx, `SELECT `+columns+` FROM device_commands
+        WHERE device_id = $1 AND ($2 = '' OR status = $2)
+        ORDER BY issued_at DESC LIMIT $3`, deviceID, string(status), limit)
+}
+
+func (s *Store) query(ctx context.Context, query string, args ...interface{}) ([]Command, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Command{}
+	for rows.Next() {
+		var c Command
+		var params, result []byte
+		if err := rows.Scan(&c.ID, &c.DeviceID, &c.Command, &params, &c.IssuedBy, &c.IssuerRole, &c.RolloutID, &c.Stage,
+			&c.Status, &c.IssuedAt, &c.ExpiresAt, &c.DeliveredAt, &c.AcknowledgedAt, &c.CompletedAt, &result, &c.Error); err != nil {
+			return nil, err
+		}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &c.Params); err != nil {
+				return nil, fmt.Errorf("invalid params for command %s: %w", c.ID, err)
+			}
+		}
+		if len(result) > 0 {
+			c.Result = result
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
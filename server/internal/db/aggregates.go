@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// aggregateViews maps the public view names onto continuous aggregates and their bucket column
+var aggregateViews = map[string]struct {
+	table  string
+	bucket string
+	width  time.Duration
+}{
+	"five_min": {table: "five_min_sensor_averages", bucket: "five_min_bucket", width: 5 * time.Minute},
+	"hourly":   {table: "hourly_sensor_averages", bucket: "hour", width: time.Hour},
+	"daily":    {table: "daily_sensor_averages", bucket: "day", width: 24 * time.Hour},
+}
+
+// AggregateBucket is one row of a sensor-average continuous aggregate
+type AggregateBucket struct {
+	Bucket       time.Time `json:"bucket"`
+	DeviceType   string    `json:"device_type"`
+	Location     string    `json:"location"`
+	AvgValue     float64   `json:"avg_value"`
+	MinValue     float64   `json:"min_value"`
+	MaxValue     float64   `json:"max_value"`
+	ReadingCount int64     `json:"reading_count"`
+}
+
+// AggregateBucketWidth returns the bucket width of a view name (five_min, hourly, daily)
+func AggregateBucketWidth(view string) (time.Duration, bool) {
+	v, ok := aggregateViews[view]
+	return v.width, ok
+}
+
+// GetAggregateWindow retrieves aggregate buckets for a device type/location between start and end
+func GetAggregateWindow(db *sql.DB, view, deviceType, location string, start, end time.Time) ([]AggregateBucket, error) {
+	return GetAggregateWindowContext(context.Background(), db, view, deviceType, location, start, end)
+}
+
+// GetAggregateWindowContext is GetAggregateWindow bound to ctx; cancelling ctx cancels the query
+func GetAggregateWindowContext(ctx context.Context, db *sql.DB, view, deviceType, location string, start, end time.Time) ([]AggregateBucket, error) {
+	v, ok := aggregateViews[view]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregate view %q", view)
+	}
+
+	// Table and column names come from the fixed map above, never from user input
+	query := fmt.Sprintf(`
+        SELECT %[2]s, device_type, COALESCE(location, ''), avg_value, min_value, max_value, reading_count
+        FROM %[1]s
+        WHERE device_type = $1
+          AND ($2 = '' OR location = $2)
+          AND %[2]s >= $3 AND %[2]s < $4
+        ORDER BY %[2]s ASC
+    `, v.table, v.bucket)
+
+	rows, err := db.QueryContext(ctx, query, deviceType, location, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []AggregateBucket
+	for rows.Next() {
+		var b AggregateBucket
+		if err := rows.Scan(&b.Bucket, &b.DeviceType, &b.Location,
+			&b.AvgValue, &b.MinValue, &b.MaxValue, &b.ReadingCount); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
+
+// GetDeviceBuckets averages a single device's raw readings into fixed-width time buckets
+// Used where continuous aggregates (keyed by device type/location) are too coarse
+func GetDeviceBuckets(db *sql.DB, deviceID string, width time.Duration, start, end time.Time) ([]AggregateBucket, error) {
+	return GetDeviceBucketsContext(context.Background(), db, deviceID, width, start, end)
+}
+
+// GetDeviceBucketsContext is GetDeviceBuckets bound to ctx; cancelling ctx cancels the query
+func GetDeviceBucketsContext(ctx context.Context, db *sql.DB, deviceID string, width time.Duration, start, end time.Time) ([]AggregateBucket, error) {
+	query := `
+        SELECT time_bucket($1::interval, time) AS bucket, device_type, COALESCE(location, ''),
+               avg(raw_value), min(raw_value), max(raw_value), count(*)
+        FROM sensor_readings
+        WHERE device_id = $2 AND raw_value IS NOT NULL
+          AND time >= $3 AND time < $4
+        GROUP BY bucket, device_type, location
+        ORDER BY bucket ASC
+    `
+
+	interval := fmt.Sprintf("%d seconds", int64(width.Seconds()))
+	rows, err := db.QueryContext(ctx, query, interval, deviceID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []AggregateBucket
+	for rows.Next() {
+		var b AggregateBucket
+		if err := rows.Scan(&b.Bucket, &b.DeviceType, &b.Location,
+			&b.AvgValue, &b.MinValue, &b.MaxValue, &b.ReadingCount); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
+
+// GetLocationBucketsContext buckets the values of every device at a location over [start, end),
+// keyed by device ID, each device's buckets ordered by bucket
+func GetLocationBucketsContext(ctx context.Context, db *sql.DB, location string, width time.Duration, start, end time.Time) (map[string][]AggregateBucket, error) {
+	query := `
+        SELECT device_id, time_bucket($1::interval, time) AS bucket, device_type, COALESCE(location, ''),
+               avg(raw_value), min(raw_value), max(raw_value), count(*)
+        FROM sensor_readings
+        WHERE location = $2 AND raw_value IS NOT NULL
+          AND time >= $3 AND time < $4
+        GROUP BY device_id, bucket, device_type, location
+        ORDER BY device_id, bucket ASC
+    `
+
+	interval := fmt.Sprintf("%d seconds", int64(width.Seconds()))
+	rows, err := db.QueryContext(ctx, query, interval, location, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := make(map[string][]AggregateBucket)
+	for rows.Next() {
+		var deviceID string
+		var b AggregateBucket
+		if err := rows.Scan(&deviceID, &b.Bucket, &b.DeviceType, &b.Location,
+			&b.AvgValue, &b.MinValue, &b.MaxValue, &b.ReadingCount); err != nil {
+			return nil, err
+		}
+		series[deviceID] = append(series[deviceID], b)
+	}
+
+	return series, rows.Err()
+}
+
+// GetAggregatesBetween retrieves every device type/location bucket of a view with bucket start in [start, end)
+func GetAggregatesBetween(db *sql.DB, view string, start, end time.Time) ([]AggregateBucket, error) {
+	v, ok := aggregateViews[view]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregate view %q", view)
+	}
+
+	query := fmt.Sprintf(`
+        SELECT %[2]s, device_type, COALESCE(location, ''), avg_value, min_value, max_value, reading_count
+        FROM %[1]s
+        WHERE %[2]s >= $1 AND %[2]s < $2
+        ORDER BY %[2]s ASC, device_type, location
+    `, v.table, v.bucket)
+
+	rows, err := db.Query(query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []AggregateBucket
+	for rows.Next() {
+		var b AggregateBucket
+		if err := rows.Scan(&b.Bucket, &b.DeviceType, &b.Location,
+			&b.AvgValue, &b.MinValue, &b.MaxValue, &b.ReadingCount); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TimeWeightedBucket is one bucket of a time-weighted average
+// Naive averages over irregularly sampled series over-weight bursts of readings;
+// here each reading counts for as long as it was the latest value (last observation carried forward)
+type TimeWeightedBucket struct {
+	Bucket          time.Time `json:"bucket"`
+	TimeWeightedAvg *float64  `json:"time_weighted_avg"`
+	Avg             float64   `json:"avg_value"`
+	Min             float64   `json:"min_value"`
+	Max             float64   `json:"max_value"`
+	ReadingCount    int64     `json:"reading_count"`
+	CoveredSeconds  float64   `json:"covered_seconds"` // time the bucket was covered by readings
+}
+
+// GetTimeWeightedBuckets computes time-weighted averages of raw readings in fixed-width buckets
+// Each reading is weighted by the time until the next reading of the same device, clipped to the
+// bucket end and to maxGap so a device that stopped reporting does not dominate the bucket
+func GetTimeWeightedBuckets(ctx context.Context, db *sql.DB, filter ReadingFilter, width, maxGap time.Duration, start, end time.Time) ([]TimeWeightedBucket, error) {
+	if filter.DeviceID == "" && filter.DeviceType == "" {
+		return nil, fmt.Errorf("device_id or device_type is required")
+	}
+
+	query := fmt.Sprintf(`
+        WITH ordered AS (
+            SELECT time, raw_value,
+                   time_bucket($1::interval, time) AS bucket,
+                   LEAD(time) OVER (PARTITION BY device_id ORDER BY time) AS next_time
+            FROM %s
+            WHERE raw_value IS NOT NULL
+              AND time >= $2 AND time < $3
+              AND ($4 = '' OR device_id = $4)
+              AND ($5 = '' OR device_type = $5)
+              AND ($6 = '' OR location = $6)
+        ),
+        weighted AS (
+            SELECT bucket, raw_value,
+                   EXTRACT(EPOCH FROM (
+                       LEAST(COALESCE(next_time, $3), bucket + $1::interval, time + $7::interval) - time
+                   )) AS weight
+            FROM ordered
+        )
+        SELECT bucket,
+               SUM(raw_value * weight) / NULLIF(SUM(weight), 0),
+               AVG(raw_value), MIN(raw_value), MAX(raw_value), COUNT(*),
+               COALESCE(SUM(weight), 0)
+        FROM weighted
+        GROUP BY bucket
+        ORDER BY bucket ASC
+    `, filter.source())
+
+	rows, err := db.QueryContext(ctx, query, intervalString(width), start, end,
+		filter.DeviceID, filter.DeviceType, filter.Location, intervalString(maxGap))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []TimeWeightedBucket
+	for rows.Next() {
+		var b TimeWeightedBucket
+		if err := rows.Scan(&b.Bucket, &b.TimeWeightedAvg, &b.Avg, &b.Min, &b.Max,
+			&b.ReadingCount, &b.CoveredSeconds); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
+
+// intervalString formats a duration as a Postgres interval literal
+func intervalString(d time.Duration) string {
+	return fmt.Sprintf("%d seconds", int64(d.Seconds()))
+}
+
+// CounterBucket is the increase of a cumulative metric (energy meter, event counter) over one bucket
+type CounterBucket struct {
+	Bucket        time.Time `json:"bucket"`
+	Increase      float64   `json:"increase"`
+	RatePerSecond float64   `json:"rate_per_second"`
+	Resets        int64     `json:"resets"`  // counter resets detected (value went down)
+	Devices       int64     `json:"devices"` // devices contributing to the bucket
+}
+
+// GetCounterBuckets sums the per-device increases of a cumulative metric in fixed-width buckets
+// A value lower than the previous one is treated as a reset to zero, so the increase after a
+// reset is the new value itself instead of a large negative delta
+func GetCounterBuckets(ctx context.Context, db *sql.DB, filter ReadingFilter, width time.Duration, start, end time.Time) ([]CounterBucket, error) {
+	if filter.DeviceID == "" && filter.DeviceType == "" {
+		return nil, fmt.Errorf("device_id or device_type is required")
+	}
+
+	query := fmt.Sprintf(`
+        WITH ordered AS (
+            SELECT device_id, time, raw_value,
+                   LAG(raw_value) OVER (PARTITION BY device_id ORDER BY time) AS prev
+            FROM %s
+            WHERE raw_value IS NOT NULL
+              AND time >= $2 AND time < $3
+              AND ($4 = '' OR device_id = $4)
+              AND ($5 = '' OR device_type = $5)
+              AND ($6 = '' OR location = $6)
+        )
+        SELECT time_bucket($1::interval, time) AS bucket,
+               SUM(CASE WHEN raw_value >= prev THEN raw_value - prev ELSE raw_value END),
+               COUNT(*) FILTER (WHERE raw_value < prev),
+               COUNT(DISTINCT device_id)
+        FROM ordered
+        WHERE prev IS NOT NULL
+        GROUP BY bucket
+        ORDER BY bucket ASC
+    `, filter.source())
+
+	rows, err := db.QueryContext(ctx, query, intervalString(width), start, end,
+		filter.DeviceID, filter.DeviceType, filter.Location)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []CounterBucket
+	for rows.Next() {
+		var b CounterBucket
+		if err := rows.Scan(&b.Bucket, &b.Increase, &b.Resets, &b.Devices); err != nil {
+			return nil, err
+		}
+		b.RatePerSecond = b.Increase / width.Seconds()
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
+
+// StateBucket summarises a boolean series (motion, door contact) over one bucket
+// Values above 0.5 count as "on" (occupied, open)
+type StateBucket struct {
+	Bucket             time.Time `json:"bucket"`
+	OnSeconds          float64   `json:"on_seconds"`
+	OffSeconds         float64   `json:"off_seconds"`
+	OccupancyPct       *float64  `json:"occupancy_pct"` // share of covered time spent on; null when nothing was covered
+	Transitions        int64     `json:"transitions"`   // state changes in either direction
+	Activations        int64     `json:"activations"`   // off → on changes
+	TransitionsPerHour float64   `json:"transitions_per_hour"`
+}
+
+// GetStateBuckets computes state durations and transitions of a boolean series in fixed-width buckets
+// Durations use the same carry-forward weighting as GetTimeWeightedBuckets
+func GetStateBuckets(ctx context.Context, db *sql.DB, filter ReadingFilter, width, maxGap time.Duration, start, end time.Time) ([]StateBucket, error) {
+	if filter.DeviceID == "" && filter.DeviceType == "" {
+		return nil, fmt.Errorf("device_id or device_type is required")
+	}
+
+	query := fmt.Sprintf(`
+        WITH ordered AS (
+            SELECT time,
+                   raw_value > 0.5 AS state,
+                   time_bucket($1::interval, time) AS bucket,
+                   LAG(raw_value > 0.5) OVER (PARTITION BY device_id ORDER BY time) AS prev_state,
+                   LEAD(time) OVER (PARTITION BY device_id ORDER BY time) AS next_time
+            FROM %s
+            WHERE raw_value IS NOT NULL
+              AND time >= $2 AND time < $3
+              AND ($4 = '' OR device_id = $4)
+              AND ($5 = '' OR device_type = $5)
+              AND ($6 = '' OR location = $6)
+        ),
+        weighted AS (
+            SELECT bucket, state, prev_state,
+                   EXTRACT(EPOCH FROM (
+                       LEAST(COALESCE(next_time, $3), bucket + $1::interval, time + $7::interval) - time
+                   )) AS weight
+            FROM ordered
+        )
+        SELECT bucket,
+               COALESCE(SUM(weight) FILTER (WHERE state), 0),
+               COALESCE(SUM(weight) FILTER (WHERE NOT state), 0),
+               COUNT(*) FILTER (WHERE prev_state IS NOT NULL AND state <> prev_state),
+               COUNT(*) FILTER (WHERE state AND prev_state = false)
+        FROM weighted
+        GROUP BY bucket
+        ORDER BY bucket ASC
+    `, filter.source())
+
+	rows, err := db.QueryContext(ctx, query, intervalString(width), start, end,
+		filter.DeviceID, filter.DeviceType, filter.Location, intervalString(maxGap))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []StateBucket
+	for rows.Next() {
+		var b StateBucket
+		if err := rows.Scan(&b.Bucket, &b.OnSeconds, &b.OffSeconds, &b.Transitions, &b.Activations); err != nil {
+			return nil, err
+		}
+		if covered := b.OnSeconds + b.OffSeconds; covered > 0 {
+			pct := 100 * b.OnSeconds / covered
+			b.OccupancyPct = &pct
+		}
+		b.TransitionsPerHour = float64(b.Transitions) / width.Hours()
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
+
+// IngestDelay summarises how late a device's readings arrive (ingested_at - time)
+// Large positive delays point at buffering gateways; negative ones at device clocks running ahead
+type IngestDelay struct {
+	DeviceID   string  `json:"device_id"`
+	Readings   int64   `json:"readings"`
+	AvgSeconds float64 `json:"avg_delay_seconds"`
+	P95Seconds float64 `json:"p95_delay_seconds"`
+	MaxSeconds float64 `json:"max_delay_seconds"`
+	MinSeconds float64 `json:"min_delay_seconds"`
+}
+
+// GetIngestDelays returns the delay distribution of every device with readings received in [start, end),
+// most delayed first
+func GetIngestDelays(ctx context.Context, db *sql.DB, filter ReadingFilter, start, end time.Time) ([]IngestDelay, error) {
+	query := `
+        WITH delays AS (
+            SELECT device_id, EXTRACT(EPOCH FROM (ingested_at - time)) AS delay
+            FROM sensor_readings
+            WHERE ingested_at >= $1 AND ingested_at < $2
+              AND ($3 = '' OR device_id = $3)
+              AND ($4 = '' OR device_type = $4)
+              AND ($5 = '' OR location = $5)
+        )
+        SELECT device_id, COUNT(*), AVG(delay),
+               percentile_cont(0.95) WITHIN GROUP (ORDER BY delay),
+               MAX(delay), MIN(delay)
+        FROM delays
+        GROUP BY device_id
+        ORDER BY 4 DESC
+    `
+
+	rows, err := db.QueryContext(ctx, query, start, end, filter.DeviceID, filter.DeviceType, filter.Location)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var delays []IngestDelay
+	for rows.Next() {
+		var d IngestDelay
+		if err := rows.Scan(&d.DeviceID, &d.Readings, &d.AvgSeconds, &d.P95Seconds, &d.MaxSeconds, &d.MinSeconds); err != nil {
+			return nil, err
+		}
+		delays = append(delays, d)
+	}
+
+	return delays, rows.Err()
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"edge-insights/internal/types"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// sensorReadingColumns is the column order used by CopySensorReadings
+var sensorReadingColumns = []string{"time", "device_id", "device_type", "location", "raw_value", "unit", "log_type", "message", "ingested_at", "metadata"}
+
+// CopySensorReadings inserts readings in one round trip with COPY
+// The batch is all-or-nothing: one invalid row fails every row
+func CopySensorReadings(ctx context.Context, db *sql.DB, readings []types.LogMessage) (err error) {
+	// Timed from before a connection is acquired, so waits on a saturated pool show too
+	start := time.Now()
+	defer func() { observeWrite("sensor_readings", OpCopy, len(readings), start, err) }()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows := make([][]interface{}, len(readings))
+	for i, r := range readings {
+		rows[i] = []interface{}{r.Time, r.DeviceID, r.DeviceType, r.Location, r.RawValue, r.Unit, r.LogType, r.Message, ingestedAt(r), metadataJSON(r)}
+	}
+
+	return conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("COPY needs the pgx driver, got %T", driverConn)
+		}
+		_, err := c.Conn().CopyFrom(ctx, pgx.Identifier{"sensor_readings"}, sensorReadingColumns, pgx.CopyFromRows(rows))
+		return err
+	})
+}
+
+// BatchConfig controls a BatchWriter
+type BatchConfig struct {
+	Size     int           // flush once this many readings are buffered (default 500)
+	Interval time.Duration // flush at most this long after the first buffered reading (default 20ms)
+	Workers  int           // concurrent flushes (default 4)
+}
+
+// BatchWriter buffers readings from concurrent callers and writes them with COPY,
+// flushing by size or interval. Write blocks until the caller's reading is stored
+type BatchWriter struct {
+	db    *sql.DB
+	cfg   BatchConfig
+	queue chan pendingReading
+	done  chan struct{}
+}
+
+type pendingReading struct {
+	reading types.LogMessage
+	result  chan error
+}
+
+// NewBatchWriter starts the flush workers
+func NewBatchWriter(db *sql.DB, cfg BatchConfig) *BatchWriter {
+	if cfg.Size <= 0 {
+		cfg.Size = 500
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 20 * time.Millisecond
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+
+	w := &BatchWriter{
+		db:    db,
+		cfg:   cfg,
+		queue: make(chan pendingReading, cfg.Size*cfg.Workers),
+		done:  make(chan struct{}),
+	}
+	finished := make(chan struct{}, cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go func() {
+			w.work()
+			finished <- struct{}{}
+		}()
+	}
+	go func() {
+		for i := 0; i < cfg.Workers; i++ {
+			<-finished
+		}
+		close(w.done)
+	}()
+	return w
+}
+
+// Write queues a reading and waits for the batch containing it to be stored
+func (w *BatchWriter) Write(reading types.LogMessage) error {
+	result := make(chan error, 1)
+	w.queue <- pendingReading{reading: reading, result: result}
+	return <-result
+}
+
+// Close flushes buffered readings and stops the workers; Write must not be called afterwards
+func (w *BatchWriter) Close() {
+	close(w.queue)
+	<-w.done
+}
+
+// work collects readings into batches until the queue is closed
+func (w *BatchWriter) work() {
+	batch := make([]pendingReading, 0, w.cfg.Size)
+	timer := time.NewTimer(w.cfg.Interval)
+	timer.Stop()
+
+	for {
+		// Block for the first reading of a batch, then fill until size or interval
+		p, ok := <-w.queue
+		if !ok {
+			return
+		}
+		batch = append(batch, p)
+		timer.Reset(w.cfg.Interval)
+
+	fill:
+		for len(batch) < w.cfg.Size {
+			select {
+			case p, ok := <-w.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, p)
+			case <-timer.C:
+				break fill
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		w.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes a batch with COPY; if that fails the rows are retried one by one
+// so a single bad reading only fails its own caller
+func (w *BatchWriter) flush(batch []pendingReading) {
+	readings := make([]types.LogMessage, len(batch))
+	for i, p := range batch {
+		readings[i] = p.reading
+	}
+
+	err := CopySensorReadings(context.Background(), w.db, readings)
+	if err == nil || len(batch) == 1 {
+		for _, p := range batch {
+			p.result <- err
+		}
+		return
+	}
+
+	slog.Warn("Batch insert failed, retrying readings individually", "readings", len(batch), "error", err)
+	for _, p := range batch {
+		p.result <- StoreSensorReading(w.db, p.reading)
+	}
+}
@@ -6,11 +6,14 @@ import (
     "context"
     "database/sql"
     "fmt"
-    "log"
+    "log/slog"
     "os"
     "time"
 
-    _ "github.com/jackc/pgx/v5/stdlib"
+    "edge-insights/internal/querytrace"
+
+    "github.com/jackc/pgx/v5/pgxpool"
+    "github.com/jackc/pgx/v5/stdlib"
 )
 
 type Config struct {
@@ -20,6 +23,7 @@ type Config struct {
     User     string
     Password string
     SSLMode  string
+    Pool     PoolConfig
 }
 
 func LoadConfig() *Config {
@@ -30,6 +34,7 @@ func LoadConfig() *Config {
         User:     getEnv("TIMESCALE_USER", "postgres"),
         Password: getEnv("TIMESCALE_PASSWORD", ""),
         SSLMode:  getEnv("TIMESCALE_SSL_MODE", "require"),
+        Pool:     LoadPoolConfig(),
     }
 }
 
@@ -40,23 +45,38 @@ func getEnv(key, defaultValue string) string {
     return defaultValue
 }
 
-func Connect(config *Config) (*sql.DB, error) {
+// Connect opens a pgxpool connection pool and a *sql.DB that borrows its connections from it
+// Queries keep going through database/sql; the pool is returned for its stats and must be closed
+// after the *sql.DB
+func Connect(config *Config) (*sql.DB, *pgxpool.Pool, error) {
     dsn := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
         config.Host, config.Port, config.Database, config.User, config.Password, config.SSLMode)
-    
-    db, err := sql.Open("pgx", dsn)
+
+    poolConfig, err := pgxpool.ParseConfig(dsn)
     if err != nil {
-        return nil, fmt.Errorf("failed to open database: %w", err)
+        return nil, nil, fmt.Errorf("invalid database config: %w", err)
     }
+    config.Pool.apply(poolConfig)
+    // Requests asking for debug output see the statements run on their behalf
+    poolConfig.ConnConfig.Tracer = querytrace.Tracer{}
 
-    // Test the connection
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
-    
-    if err := db.PingContext(ctx); err != nil {
-        return nil, fmt.Errorf("failed to ping database: %w", err)
+
+    pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to open database: %w", err)
     }
 
-    log.Println("Successfully connected to TimescaleDB")
-    return db, nil
-}
\ No newline at end of file
+    // Test the connection
+    if err := pool.Ping(ctx); err != nil {
+        pool.Close()
+        return nil, nil, fmt.Errorf("failed to ping database: %w", err)
+    }
+
+    slog.Info("Successfully connected to TimescaleDB",
+        "max_conns", poolConfig.MaxConns,
+        "min_conns", poolConfig.MinConns,
+        "min_idle_conns", poolConfig.MinIdleConns)
+    return stdlib.OpenDBFromPool(pool), pool, nil
+}
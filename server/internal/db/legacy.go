@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LegacyBackfill is one window of device_logs copied into sensor_readings
+type LegacyBackfill struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Copied int64     `json:"copied"` // rows copied, or rows that would be copied in a dry run
+	Error  string    `json:"error,omitempty"`
+}
+
+// legacyUncopied restricts device_logs (as l) to rows without a copy in sensor_readings; a copy
+// is a reading of the same device at the same time with the same message
+const legacyUncopied = `NOT EXISTS (
+            SELECT 1 FROM sensor_readings r
+            WHERE r.device_id = l.device_id AND r.time = l.time AND r.message IS NOT DISTINCT FROM l.message
+        )`
+
+// PendingDeviceLogs counts the device_logs rows not yet copied into sensor_readings
+func PendingDeviceLogs(ctx context.Context, db *sql.DB) (int64, error) {
+	var n int64
+	err := db.QueryRowContext(ctx, `SELECT count(*) FROM device_logs l WHERE `+legacyUncopied).Scan(&n)
+	return n, err
+}
+
+// BackfillDeviceLogs copies the history of the legacy device_logs table into sensor_readings, one
+// window of device time per statement so an interrupted run keeps what it copied. Rows already
+// copied are skipped, so it can run again at any time (and while ingestion still writes)
+// Copies take the device's registered type and location ("unknown" and none otherwise), have no
+// raw_value or unit, and carry {"source": "device_logs"} in their metadata
+func BackfillDeviceLogs(ctx context.Context, db *sql.DB, window time.Duration, dryRun bool) ([]LegacyBackfill, error) {
+	backfills := []LegacyBackfill{}
+	var first, last sql.NullTime
+	if err := db.QueryRowContext(ctx, `SELECT min(time), max(time) FROM device_logs`).Scan(&first, &last); err != nil {
+		return backfills, err
+	}
+	if !first.Valid {
+		return backfills, nil
+	}
+
+	for start := first.Time.UTC().Truncate(window); !start.After(last.Time); start = start.Add(window) {
+		b := LegacyBackfill{Start: start, End: start.Add(window)}
+		var err error
+		if dryRun {
+			err = db.QueryRowContext(ctx, `
+                SELECT count(*) FROM device_logs l
+                WHERE l.time >= $1 AND l.time < $2 AND `+legacyUncopied, b.Start, b.End).Scan(&b.Copied)
+		} else {
+			var result sql.Result
+			result, err = db.ExecContext(ctx, `
+                INSERT INTO sensor_readings (time, device_id, device_type, location, log_type, message, metadata)
+                SELECT l.time, l.device_id, COALESCE(d.device_type, 'unknown'), NULLIF(d.location, ''), l.log_type, l.message,
+                       '{"source": "device_logs"}'::jsonb
+                FROM device_logs l
+                LEFT JOIN devices d ON d.id = l.device_id
+                WHERE l.time >= $1 AND l.time < $2 AND `+legacyUncopied, b.Start, b.End)
+			if err == nil {
+				b.Copied, err = result.RowsAffected()
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return backfills, ctx.Err()
+			}
+			b.Error = err.Error()
+		}
+		if b.Copied > 0 || b.Error != "" {
+			backfills = append(backfills, b)
+		}
+	}
+	return backfills, nil
+}
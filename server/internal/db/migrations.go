@@ -5,50 +5,264 @@
 package db
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
+// migrationLockKey is the Postgres advisory lock held while migrations run, so replicas starting
+// together apply them once ("edge-insights:migrations" as the lock's 64-bit key)
+const migrationLockKey int64 = 0x65646765_6d696772
+
+// migrationFile matches versioned migrations, e.g. 021_add_ingested_at_to_sensor_readings.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.sql$`)
+
+// Header directives a migration can carry in its leading comments
+const (
+	manualDirective        = "-- migrate: manual"         // never run automatically (destructive or one-off)
+	noTransactionDirective = "-- migrate: no-transaction" // statements that cannot run inside a transaction
+)
+
+// Migration is one versioned SQL file
+type Migration struct {
+	Version  string
+	Path     string
+	Checksum string
+
+	content       string
+	manual        bool
+	noTransaction bool
+}
+
 func RunMigrations(db *sql.DB) error {
-	log.Println("Running database migrations...")
+	return RunMigrationsFrom(db, "migrations")
+}
 
-	// List of migration files in order
-	migrations := []string{
-		"migrations/001_create_device_logs_table.sql",
-		"migrations/002_create_embeddings_table.sql",
-		"migrations/003_create_sensor_readings_table.sql",
-		"migrations/005_add_log_type_to_sensor_readings.sql",
-		"migrations/008_add_message_to_sensor_readings.sql",
+// RunMigrationsFrom applies every migration in dir that is not yet recorded in schema_migrations
+// (tests point this at the repo's migrations folder regardless of working directory)
+// Applied files whose checksum changed are reported as drift; set MIGRATIONS_STRICT=true to fail instead
+// Instances starting together take turns under an advisory lock: the first applies the migrations
+// and the others wait for it, then find nothing left to apply
+func RunMigrationsFrom(db *sql.DB, dir string) error {
+	unlock, err := lockMigrations(db, GetDurationEnv("MIGRATIONS_LOCK_TIMEOUT", 10*time.Minute))
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	for _, migrationPath := range migrations {
-		log.Printf("Running migration: %s", migrationPath)
+	slog.Info("Running database migrations")
 
-		content, err := os.ReadFile(migrationPath)
+	if _, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version TEXT PRIMARY KEY,
+            checksum TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	migrations, err := DiscoverMigrations(dir)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	strict := os.Getenv("MIGRATIONS_STRICT") == "true"
+	ran := 0
+	for _, m := range migrations {
+		if checksum, ok := applied[m.Version]; ok {
+			if checksum != m.Checksum {
+				if strict {
+					return fmt.Errorf("migration %s changed after it was applied (checksum %s, recorded %s)", m.Path, m.Checksum, checksum)
+				}
+				slog.Warn("Migration changed after it was applied", "path", m.Path, "checksum", m.Checksum, "recorded", checksum)
+			}
+			continue
+		}
+		if m.manual {
+			slog.Info("Skipping manual migration", "path", m.Path)
+			continue
+		}
+
+		slog.Info("Running migration", "path", m.Path)
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+		slog.Info("Migration completed", "path", m.Path)
+		ran++
+	}
+
+	slog.Info("All database migrations completed successfully", "applied", ran)
+	return nil
+}
+
+// DiscoverMigrations lists the versioned migrations in dir ordered by version
+func DiscoverMigrations(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory %s: %w", dir, err)
+	}
+
+	var migrations []Migration
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		if other, ok := seen[match[1]]; ok {
+			return nil, fmt.Errorf("duplicate migration version %s: %s and %s", match[1], other, entry.Name())
+		}
+		seen[match[1]] = entry.Name()
+
+		path := filepath.Join(dir, entry.Name())
+		content, err := os.ReadFile(path)
 		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %w", migrationPath, err)
+			return nil, fmt.Errorf("failed to read migration file %s: %w", path, err)
 		}
+		sum := sha256.Sum256(content)
+		m := Migration{
+			Version:  match[1],
+			Path:     path,
+			Checksum: hex.EncodeToString(sum[:]),
+			content:  string(content),
+		}
+		m.manual, m.noTransaction = directives(m.content)
+		migrations = append(migrations, m)
+	}
 
-		// Split by semicolon and execute each statement
-		statements := strings.Split(string(content), ";")
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
 
-		for _, statement := range statements {
-			statement = strings.TrimSpace(statement)
-			if statement == "" {
-				continue
-			}
+// directives reads the header comments of a migration up to its first statement
+func directives(content string) (manual, noTransaction bool) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		switch line {
+		case manualDirective:
+			manual = true
+		case noTransactionDirective:
+			noTransaction = true
+		}
+	}
+	return manual, noTransaction
+}
+
+// lockMigrations takes the migration lock on a connection of its own, waiting up to timeout for
+// another instance to release it. The lock is released by unlock or when the connection drops, so
+// an instance that crashes mid-migration does not block the others
+func lockMigrations(db *sql.DB, timeout time.Duration) (unlock func(), err error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	unlock = func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			slog.Warn("Failed to release the migration lock", "error", err)
+		}
+		conn.Close()
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(context.Background(), `SELECT pg_try_advisory_lock($1)`, migrationLockKey).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	if locked {
+		return unlock, nil
+	}
+
+	slog.Info("Waiting for another instance to finish migrations", "timeout", timeout)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out after %s waiting for another instance to finish migrations (MIGRATIONS_LOCK_TIMEOUT)", timeout)
+		}
+		return nil, fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	slog.Info("Migration lock acquired", "waited", time.Since(start).Round(time.Millisecond))
+	return unlock, nil
+}
 
+func appliedMigrations(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query(`SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]string)
+	for rows.Next() {
+		var version, checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		applied[version] = checksum
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration runs a migration's statements and records it, atomically unless it opts out
+func applyMigration(db *sql.DB, m Migration) error {
+	// Split by semicolon and execute each statement
+	var statements []string
+	for _, statement := range strings.Split(m.content, ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	record := `INSERT INTO schema_migrations (version, checksum) VALUES ($1, $2)`
+
+	if m.noTransaction {
+		for _, statement := range statements {
 			if _, err := db.Exec(statement); err != nil {
-				return fmt.Errorf("failed to execute migration %s: %w", migrationPath, err)
+				return fmt.Errorf("failed to execute migration %s: %w", m.Path, err)
 			}
 		}
+		if _, err := db.Exec(record, m.Version, m.Checksum); err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", m.Path, err)
+		}
+		return nil
+	}
 
-		log.Printf("Migration %s completed", migrationPath)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	log.Println("All database migrations completed successfully")
-	return nil
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to execute migration %s: %w", m.Path, err)
+		}
+	}
+	if _, err := tx.Exec(record, m.Version, m.Checksum); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", m.Path, err)
+	}
+	return tx.Commit()
 }
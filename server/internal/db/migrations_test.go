@@ -0,0 +1,52 @@
+package db_test
+
+import (
+	"testing"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/testutil"
+)
+
+func TestMigrations(t *testing.T) {
+	database := testutil.NewTimescaleDB(t)
+
+	// Migration 009 runs on a fresh database; 004, 006 and 040 are manual
+	var exists bool
+	if err := database.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'sensor_readings_pkey')`).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("sensor_readings has a primary key, but 006 is manual")
+	}
+	for _, view := range []string{"five_min_sensor_averages", "hourly_sensor_averages", "daily_sensor_averages", "daily_device_activity"} {
+		if err := database.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, view).Scan(&exists); err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("continuous aggregate %s is missing", view)
+		}
+	}
+	var policies int
+	if err := database.QueryRow(`SELECT count(*) FROM timescaledb_information.jobs WHERE proc_name = 'policy_retention'`).Scan(&policies); err != nil {
+		t.Fatal(err)
+	}
+	if policies != 0 {
+		t.Errorf("%d retention policies were set, want none", policies)
+	}
+
+	// A second run finds every migration applied
+	if err := db.RunMigrationsFrom(database, testutil.MigrationsDir()); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	migrations, err := db.DiscoverMigrations(testutil.MigrationsDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded int
+	if err := database.QueryRow(`SELECT count(*) FROM schema_migrations`).Scan(&recorded); err != nil {
+		t.Fatal(err)
+	}
+	if want := len(migrations) - 3; recorded != want {
+		t.Errorf("%d migrations recorded, want %d", recorded, want)
+	}
+}
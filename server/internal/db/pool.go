@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolConfig sizes the pgxpool connection pool shared by every query
+type PoolConfig struct {
+	MaxConns          int32         // DB_POOL_MAX_CONNS (default 20)
+	MinConns          int32         // DB_POOL_MIN_CONNS, kept open even when idle (default 2)
+	MinIdleConns      int32         // DB_POOL_MIN_IDLE_CONNS, idle connections kept ready for bursts (default 2)
+	MaxConnLifetime   time.Duration // DB_POOL_MAX_CONN_LIFETIME (default 1h)
+	MaxConnIdleTime   time.Duration // DB_POOL_MAX_CONN_IDLE_TIME (default 30m)
+	HealthCheckPeriod time.Duration // DB_POOL_HEALTH_CHECK_PERIOD (default 1m)
+}
+
+// LoadPoolConfig reads the pool settings from the environment
+func LoadPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxConns:          int32(GetIntEnv("DB_POOL_MAX_CONNS", 20)),
+		MinConns:          int32(GetIntEnv("DB_POOL_MIN_CONNS", 2)),
+		MinIdleConns:      int32(GetIntEnv("DB_POOL_MIN_IDLE_CONNS", 2)),
+		MaxConnLifetime:   GetDurationEnv("DB_POOL_MAX_CONN_LIFETIME", time.Hour),
+		MaxConnIdleTime:   GetDurationEnv("DB_POOL_MAX_CONN_IDLE_TIME", 30*time.Minute),
+		HealthCheckPeriod: GetDurationEnv("DB_POOL_HEALTH_CHECK_PERIOD", time.Minute),
+	}
+}
+
+// apply copies the settings onto a parsed pgxpool config, keeping pgx's defaults for unset values
+func (c PoolConfig) apply(config *pgxpool.Config) {
+	if c.MaxConns > 0 {
+		config.MaxConns = c.MaxConns
+	}
+	if c.MinConns > 0 {
+		config.MinConns = min(c.MinConns, config.MaxConns)
+	}
+	if c.MinIdleConns > 0 {
+		config.MinIdleConns = min(c.MinIdleConns, config.MaxConns)
+	}
+	if c.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = c.MaxConnLifetime
+		// Spread reconnects so the whole pool does not recycle at once
+		config.MaxConnLifetimeJitter = c.MaxConnLifetime / 10
+	}
+	if c.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if c.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = c.HealthCheckPeriod
+	}
+}
+
+// WatchPool pings the database every interval until ctx is done and logs when the pool is saturated,
+// i.e. when callers had to wait for a connection or gave up waiting since the previous check
+// pgxpool's own health check only recycles broken connections; this makes exhaustion visible
+func WatchPool(ctx context.Context, pool *pgxpool.Pool, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := pool.Stat()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		start := time.Now()
+		err := pool.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			slog.Warn("Database health check failed", "error", err, "elapsed", time.Since(start))
+		}
+
+		stat := pool.Stat()
+		waited := stat.EmptyAcquireCount() - last.EmptyAcquireCount()
+		canceled := stat.CanceledAcquireCount() - last.CanceledAcquireCount()
+		if waited > 0 || canceled > 0 {
+			slog.Warn("Database pool saturated",
+				"waited_acquires", waited,
+				"canceled_acquires", canceled,
+				"acquired", stat.AcquiredConns(),
+				"max", stat.MaxConns(),
+				"wait_time", stat.EmptyAcquireWaitTime()-last.EmptyAcquireWaitTime(),
+			)
+		}
+		last = stat
+	}
+}
+
+// GetIntEnv reads an integer environment variable, or defaultValue when it is unset or invalid
+func GetIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// GetDurationEnv reads a duration environment variable, or defaultValue when it is unset or invalid
+func GetDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
@@ -1,12 +1,18 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"edge-insights/internal/types"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
 // LogEntry represents a log entry from the database
+// Entries are read from device_log_entries: sensor_readings plus the legacy device_logs rows not yet
+// copied into it (see BackfillDeviceLogs)
 type LogEntry struct {
 	Time     time.Time `json:"time"`
 	DeviceID string    `json:"device_id"`
@@ -18,7 +24,7 @@ type LogEntry struct {
 func GetRecentLogs(db *sql.DB, limit int) ([]LogEntry, error) {
 	query := `
         SELECT time, device_id, log_type, message 
-        FROM device_logs 
+        FROM device_log_entries 
         ORDER BY time DESC 
         LIMIT $1
     `
@@ -45,7 +51,7 @@ func GetRecentLogs(db *sql.DB, limit int) ([]LogEntry, error) {
 func GetLogsByDevice(db *sql.DB, deviceID string, limit int) ([]LogEntry, error) {
 	query := `
         SELECT time, device_id, log_type, message 
-        FROM device_logs 
+        FROM device_log_entries 
         WHERE device_id = $1
         ORDER BY time DESC 
         LIMIT $2
@@ -72,39 +78,346 @@ func GetLogsByDevice(db *sql.DB, deviceID string, limit int) ([]LogEntry, error)
 // Add new function for sensor readings
 func StoreSensorReading(db *sql.DB, reading types.LogMessage) error {
 	query := `
-        INSERT INTO sensor_readings (time, device_id, device_type, location, raw_value, unit, log_type, message)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        INSERT INTO sensor_readings (time, device_id, device_type, location, raw_value, unit, log_type, message, ingested_at, metadata)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
     `
 
+	start := time.Now()
 	_, err := db.Exec(query, reading.Time, reading.DeviceID, reading.DeviceType,
-		reading.Location, reading.RawValue, reading.Unit, reading.LogType, reading.Message)
+		reading.Location, reading.RawValue, reading.Unit, reading.LogType, reading.Message, ingestedAt(reading), metadataJSON(reading))
+	observeWrite("sensor_readings", OpInsert, 1, start, err)
 	return err
 }
 
 // Update GetRecentLogs to use new table
 func GetRecentSensorReadings(db *sql.DB, limit int) ([]types.LogMessage, error) {
+	return GetRecentSensorReadingsMatching(context.Background(), db, LogFilter{}, limit)
+}
+
+// LogFilter narrows GetRecentSensorReadingsMatching; zero fields match every reading
+type LogFilter struct {
+	Start      *time.Time // inclusive, on the device time
+	End        *time.Time // exclusive
+	LogTypes   []string   // any of
+	DeviceType string
+	Location   string
+	// Metadata matches readings whose metadata contains every key/value given (jsonb @>, served by the GIN index)
+	Metadata map[string]interface{}
+}
+
+// where translates the filter into a parameterized WHERE clause and its arguments
+func (f LogFilter) where() (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Start != nil {
+		add("time >= $%d", *f.Start)
+	}
+	if f.End != nil {
+		add("time < $%d", *f.End)
+	}
+	if len(f.LogTypes) > 0 {
+		add("log_type = ANY($%d::text[])", f.LogTypes)
+	}
+	if f.DeviceType != "" {
+		add("device_type = $%d", f.DeviceType)
+	}
+	if f.Location != "" {
+		add("location = $%d", f.Location)
+	}
+	if len(f.Metadata) > 0 {
+		metadata, err := containment(f.Metadata)
+		if err != nil {
+			return "", nil, err
+		}
+		add("metadata @> $%d::jsonb", metadata)
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// GetRecentSensorReadingsMatching retrieves the newest readings passing filter, newest first
+func GetRecentSensorReadingsMatching(ctx context.Context, db *sql.DB, filter LogFilter, limit int) ([]types.LogMessage, error) {
+	where, args, err := filter.where()
+	if err != nil {
+		return nil, err
+	}
+
+	// The WHERE clause holds only placeholders; every value is an argument
+	query := fmt.Sprintf(`
+        SELECT time, device_id, device_type, location, raw_value, unit, log_type, message, ingested_at, metadata
+        FROM sensor_readings
+        %s
+        ORDER BY time DESC
+        LIMIT $%d
+    `, where, len(args)+1)
+
+	rows, err := db.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSensorReadings(rows)
+}
+
+// GetReadingsBefore retrieves the most recent readings of a device at or before the given time
+func GetReadingsBefore(db *sql.DB, deviceID string, before time.Time, limit int) ([]types.LogMessage, error) {
 	query := `
-        SELECT time, device_id, device_type, location, raw_value, unit, log_type, message 
-        FROM sensor_readings 
-        ORDER BY time DESC 
-        LIMIT $1
+        SELECT time, device_id, device_type, location, raw_value, unit, log_type, message, ingested_at, metadata
+        FROM sensor_readings
+        WHERE device_id = $1 AND time <= $2
+        ORDER BY time DESC
+        LIMIT $3
     `
 
-	rows, err := db.Query(query, limit)
+	rows, err := db.Query(query, deviceID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSensorReadings(rows)
+}
+
+// GetRelatedLogs retrieves non-INFO logs from other devices at the same location within a time window
+func GetRelatedLogs(db *sql.DB, location, excludeDeviceID string, start, end time.Time, limit int) ([]types.LogMessage, error) {
+	query := `
+        SELECT time, device_id, device_type, location, raw_value, unit, log_type, message, ingested_at, metadata
+        FROM sensor_readings
+        WHERE location = $1 AND device_id <> $2
+          AND log_type <> 'INFO'
+          AND time BETWEEN $3 AND $4
+        ORDER BY time DESC
+        LIMIT $5
+    `
+
+	rows, err := db.Query(query, location, excludeDeviceID, start, end, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanSensorReadings(rows)
+}
+
+// scanSensorReadings collects sensor_readings rows selected in the standard column order
+func scanSensorReadings(rows *sql.Rows) ([]types.LogMessage, error) {
 	var readings []types.LogMessage
 	for rows.Next() {
 		var reading types.LogMessage
+		var location, unit sql.NullString
+		var metadata []byte
 		if err := rows.Scan(&reading.Time, &reading.DeviceID, &reading.DeviceType,
-			&reading.Location, &reading.RawValue, &reading.Unit, &reading.LogType, &reading.Message); err != nil {
+			&location, &reading.RawValue, &unit, &reading.LogType, &reading.Message, &reading.IngestedAt, &metadata); err != nil {
 			return nil, err
 		}
+		reading.Location = location.String
+		reading.Unit = unit.String
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &reading.Metadata); err != nil {
+				return nil, err
+			}
+		}
 		readings = append(readings, reading)
 	}
 
-	return readings, nil
+	return readings, rows.Err()
+}
+
+// ReadingFilter narrows a range query; empty fields match everything
+type ReadingFilter struct {
+	DeviceID   string   `json:"device_id,omitempty"`
+	DeviceType string   `json:"device_type,omitempty"`
+	Location   string   `json:"location,omitempty"`
+	Axis       TimeAxis `json:"axis,omitempty"` // which timestamp ranges and buckets use (default the device time)
+	// Metadata matches readings whose metadata contains every key/value given (GetReadingsBetween only)
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// TimeAxis selects the timestamp a query ranges and buckets on
+type TimeAxis string
+
+const (
+	AxisDevice TimeAxis = "time"        // device-reported time
+	AxisIngest TimeAxis = "ingested_at" // server receive time
+)
+
+// ParseTimeAxis accepts time/device or ingested_at/ingest; empty is the device time
+func ParseTimeAxis(s string) (TimeAxis, bool) {
+	switch s {
+	case "", "time", "device":
+		return AxisDevice, true
+	case "ingested_at", "ingest":
+		return AxisIngest, true
+	}
+	return "", false
+}
+
+// column returns the column name of the filter's axis
+func (f ReadingFilter) column() string {
+	if f.Axis == AxisIngest {
+		return string(AxisIngest)
+	}
+	return string(AxisDevice)
+}
+
+// source returns sensor_readings with its time column taken from the filter's axis, so analytics
+// written against "time" can bucket on either timestamp
+func (f ReadingFilter) source() string {
+	if f.Axis != AxisIngest {
+		return "sensor_readings"
+	}
+	return `(SELECT ingested_at AS time, device_id, device_type, location, raw_value, unit, log_type, message, metadata
+             FROM sensor_readings WHERE ingested_at IS NOT NULL) AS sensor_readings`
+}
+
+// metadataJSON encodes a reading's metadata for the JSONB column, nil when it has none
+func metadataJSON(reading types.LogMessage) interface{} {
+	if len(reading.Metadata) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(reading.Metadata)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// containment encodes a metadata filter for jsonb @>, "" when the filter is empty
+func containment(metadata map[string]interface{}) (string, error) {
+	if len(metadata) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(metadata)
+	return string(data), err
+}
+
+// ingestedAt is the receive time to store for a reading, now if the server did not stamp it
+func ingestedAt(reading types.LogMessage) time.Time {
+	if reading.IngestedAt != nil {
+		return *reading.IngestedAt
+	}
+	return time.Now()
+}
+
+// GetReadingsBetween retrieves raw readings in [start, end) on the filter's time axis, oldest first, up to limit rows
+func GetReadingsBetween(ctx context.Context, db *sql.DB, filter ReadingFilter, start, end time.Time, limit int) ([]types.LogMessage, error) {
+	// The column comes from ReadingFilter.column, never from user input
+	query := fmt.Sprintf(`
+        SELECT time, device_id, device_type, location, raw_value, unit, log_type, message, ingested_at, metadata
+        FROM sensor_readings
+        WHERE %[1]s >= $1 AND %[1]s < $2
+          AND ($3 = '' OR device_id = $3)
+          AND ($4 = '' OR device_type = $4)
+          AND ($5 = '' OR location = $5)
+          AND ($7 = '' OR metadata @> $7::jsonb)
+        ORDER BY %[1]s ASC
+        LIMIT $6
+    `, filter.column())
+
+	metadata, err := containment(filter.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query, start, end, filter.DeviceID, filter.DeviceType, filter.Location, limit, metadata)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSensorReadings(rows)
+}
+
+// readingPageSize is how many rows EachReadingBetween reads per query
+const readingPageSize = 5000
+
+// EachReadingBetween passes every reading in [start, end) to fn, oldest first, reading pages keyed
+// on the (time, device_id) primary key so a range of any length is covered without holding it in
+// memory. It always ranges on the device time; filter.Axis is ignored. An error from fn stops it
+func EachReadingBetween(ctx context.Context, db *sql.DB, filter ReadingFilter, start, end time.Time, fn func(types.LogMessage) error) error {
+	metadata, err := containment(filter.Metadata)
+	if err != nil {
+		return err
+	}
+
+	var afterTime *time.Time
+	var afterDevice string
+	for {
+		rows, err := db.QueryContext(ctx, `
+            SELECT time, device_id, device_type, location, raw_value, unit, log_type, message, ingested_at, metadata
+            FROM sensor_readings
+            WHERE time >= $1 AND time < $2
+              AND ($3 = '' OR device_id = $3)
+              AND ($4 = '' OR device_type = $4)
+              AND ($5 = '' OR location = $5)
+              AND ($7 = '' OR metadata @> $7::jsonb)
+              AND ($8::timestamptz IS NULL OR (time, device_id) > ($8::timestamptz, $9))
+            ORDER BY time ASC, device_id ASC
+            LIMIT $6
+        `, start, end, filter.DeviceID, filter.DeviceType, filter.Location, readingPageSize, metadata, afterTime, afterDevice)
+		if err != nil {
+			return err
+		}
+		page, err := scanSensorReadings(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, reading := range page {
+			if err := fn(reading); err != nil {
+				return err
+			}
+		}
+		if len(page) < readingPageSize {
+			return nil
+		}
+		last := page[len(page)-1]
+		afterTime, afterDevice = &last.Time, last.DeviceID
+	}
+}
+
+// GetLatestByLocationContext returns the latest reading of every device at a location that
+// reported since the given time, ordered by device ID
+func GetLatestByLocationContext(ctx context.Context, db *sql.DB, location string, since time.Time) ([]types.LogMessage, error) {
+	query := `
+        SELECT DISTINCT ON (device_id) time, device_id, device_type, location, raw_value, unit, log_type, message, ingested_at, metadata
+        FROM sensor_readings
+        WHERE location = $1 AND time >= $2
+        ORDER BY device_id, time DESC
+    `
+
+	rows, err := db.QueryContext(ctx, query, location, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSensorReadings(rows)
+}
+
+// GetKnownDevices returns the latest reading of every device that reported since the given time
+func GetKnownDevices(db *sql.DB, since time.Time) ([]types.LogMessage, error) {
+	query := `
+        SELECT DISTINCT ON (device_id) time, device_id, device_type, location, raw_value, unit, log_type, message, ingested_at, metadata
+        FROM sensor_readings
+        WHERE time >= $1
+        ORDER BY device_id, time DESC
+    `
+
+	rows, err := db.Query(query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSensorReadings(rows)
 }
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// repairLevel describes how a continuous aggregate is recomputed from its source, so that buckets
+// the refresh policy has moved past can be checked after late or backfilled inserts
+type repairLevel struct {
+	view        string
+	sourceTable string // the hypertable or aggregate the view is built on
+	width       time.Duration
+	// settle is the refresh policy's start_offset; newer buckets are still refreshed by the policy
+	settle time.Duration
+	// source yields bucket, device_type, location, count and value for [$1, $2) as the view defines them
+	source string
+	// stored yields the same columns from the view itself
+	stored string
+}
+
+// repairLevels are ordered as the hierarchy is built, so each level is checked against a source
+// that has already been repaired
+var repairLevels = []repairLevel{
+	{
+		view: "five_min_sensor_averages", sourceTable: "sensor_readings", width: 5 * time.Minute, settle: time.Hour,
+		source: `SELECT time_bucket('5 minutes', time), device_type, COALESCE(location, ''), count(*), avg(raw_value)
+                 FROM sensor_readings
+                 WHERE raw_value IS NOT NULL AND time >= $1 AND time < $2
+                 GROUP BY 1, 2, 3`,
+		stored: `SELECT five_min_bucket, device_type, COALESCE(location, ''), reading_count, avg_value
+                 FROM five_min_sensor_averages
+                 WHERE five_min_bucket >= $1 AND five_min_bucket < $2`,
+	},
+	{
+		view: "hourly_sensor_averages", sourceTable: "five_min_sensor_averages", width: time.Hour, settle: 3 * time.Hour,
+		source: `SELECT time_bucket('1 hour', five_min_bucket), device_type, COALESCE(location, ''), sum(reading_count), avg(avg_value)
+                 FROM five_min_sensor_averages
+                 WHERE five_min_bucket >= $1 AND five_min_bucket < $2
+                 GROUP BY 1, 2, 3`,
+		stored: `SELECT hour, device_type, COALESCE(location, ''), reading_count, avg_value
+                 FROM hourly_sensor_averages
+                 WHERE hour >= $1 AND hour < $2`,
+	},
+	{
+		view: "daily_sensor_averages", sourceTable: "hourly_sensor_averages", width: 24 * time.Hour, settle: 3 * 24 * time.Hour,
+		source: `SELECT time_bucket('1 day', hour), device_type, COALESCE(location, ''), sum(reading_count), avg(avg_value)
+                 FROM hourly_sensor_averages
+                 WHERE hour >= $1 AND hour < $2
+                 GROUP BY 1, 2, 3`,
+		stored: `SELECT day, device_type, COALESCE(location, ''), reading_count, avg_value
+                 FROM daily_sensor_averages
+                 WHERE day >= $1 AND day < $2`,
+	},
+	{
+		view: "daily_device_activity", sourceTable: "sensor_readings", width: 24 * time.Hour, settle: 3 * 24 * time.Hour,
+		source: `SELECT time_bucket('1 day', time), device_type, COALESCE(location, ''), count(*), NULL::float8
+                 FROM sensor_readings
+                 WHERE time >= $1 AND time < $2
+                 GROUP BY 1, 2, 3`,
+		stored: `SELECT day, device_type, COALESCE(location, ''), total_readings, NULL::float8
+                 FROM daily_device_activity
+                 WHERE day >= $1 AND day < $2`,
+	},
+}
+
+// AggregateRepair is a range of a continuous aggregate whose buckets disagreed with its source
+type AggregateRepair struct {
+	View      string    `json:"view"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Buckets   int       `json:"buckets"`   // stale buckets in the range
+	Refreshed bool      `json:"refreshed"` // false for dry runs and failed refreshes
+	Error     string    `json:"error,omitempty"`
+}
+
+// RepairAggregates compares every continuous aggregate bucket from lookback ago up to where the
+// refresh policies still reach with a recomputation from its source, and refreshes the ranges of
+// buckets whose reading count or average differ (or that are missing or left over)
+// A dry run only reports; since the levels are not refreshed in turn it can miss stale buckets of
+// a level whose source is stale too
+func RepairAggregates(ctx context.Context, db *sql.DB, lookback time.Duration, dryRun bool) ([]AggregateRepair, error) {
+	now := time.Now().UTC()
+	repairs := []AggregateRepair{}
+	for _, level := range repairLevels {
+		start := now.Add(-lookback).Truncate(level.width)
+		end := now.Add(-level.settle).Truncate(level.width)
+		// Buckets whose source chunks were dropped by a retention policy would compare as left
+		// over, and refreshing them would empty the aggregate
+		retention, err := retentionOf(ctx, db, level.sourceTable)
+		if err != nil {
+			return repairs, fmt.Errorf("%s: %w", level.view, err)
+		}
+		if horizon := now.Add(-retention).Truncate(level.width).Add(level.width); retention > 0 && start.Before(horizon) {
+			start = horizon
+		}
+		if !start.Before(end) {
+			continue
+		}
+
+		stale, err := staleBuckets(ctx, db, level, start, end)
+		if err != nil {
+			return repairs, fmt.Errorf("%s: %w", level.view, err)
+		}
+		for _, repair := range bucketRanges(level, stale) {
+			if !dryRun {
+				// refresh_continuous_aggregate cannot run inside a transaction, so it is a plain CALL
+				if _, err := db.ExecContext(ctx, `CALL refresh_continuous_aggregate($1::regclass, $2::timestamptz, $3::timestamptz)`,
+					level.view, repair.Start, repair.End); err != nil {
+					if ctx.Err() != nil {
+						return repairs, ctx.Err()
+					}
+					repair.Error = err.Error()
+				} else {
+					repair.Refreshed = true
+				}
+			}
+			repairs = append(repairs, repair)
+		}
+	}
+	return repairs, nil
+}
+
+// staleBuckets returns the start of every bucket in [start, end) that differs from its source, in order
+func staleBuckets(ctx context.Context, db *sql.DB, level repairLevel, start, end time.Time) ([]time.Time, error) {
+	rows, err := db.QueryContext(ctx, `
+        WITH source AS (`+level.source+`),
+        stored AS (`+level.stored+`)
+        SELECT bucket, n, value, stored_n, stored_value
+        FROM (
+            SELECT COALESCE(s.bucket, v.bucket) AS bucket, s.n::bigint, s.value::float8, v.n::bigint AS stored_n, v.value::float8 AS stored_value
+            FROM source AS s(bucket, device_type, location, n, value)
+            FULL JOIN stored AS v(bucket, device_type, location, n, value)
+              ON v.bucket = s.bucket AND v.device_type = s.device_type AND v.location = s.location
+        ) compared
+        WHERE n IS DISTINCT FROM stored_n OR value IS DISTINCT FROM stored_value
+        ORDER BY bucket
+    `, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []time.Time
+	for rows.Next() {
+		var bucket time.Time
+		var n, storedN sql.NullInt64
+		var value, storedValue sql.NullFloat64
+		if err := rows.Scan(&bucket, &n, &value, &storedN, &storedValue); err != nil {
+			return nil, err
+		}
+		// Averages recomputed in a different order may differ in the last bits
+		if n == storedN && value.Valid && storedValue.Valid &&
+			math.Abs(value.Float64-storedValue.Float64) <= 1e-9*math.Max(1, math.Abs(value.Float64)) {
+			continue
+		}
+		if len(buckets) > 0 && buckets[len(buckets)-1].Equal(bucket) {
+			continue
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+// bucketRanges merges consecutive stale buckets into refresh windows
+func bucketRanges(level repairLevel, buckets []time.Time) []AggregateRepair {
+	var ranges []AggregateRepair
+	for _, bucket := range buckets {
+		if n := len(ranges); n > 0 && ranges[n-1].End.Equal(bucket) {
+			ranges[n-1].End = bucket.Add(level.width)
+			ranges[n-1].Buckets++
+			continue
+		}
+		ranges = append(ranges, AggregateRepair{View: level.view, Start: bucket, End: bucket.Add(level.width), Buckets: 1})
+	}
+	return ranges
+}
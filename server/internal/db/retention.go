@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy is the TimescaleDB retention (drop_chunks) and compression policy of a hypertable
+// or continuous aggregate, with the size of its chunks
+type RetentionPolicy struct {
+	Table              string `json:"table"`
+	Aggregate          bool   `json:"aggregate"`                // a continuous aggregate
+	Retention          string `json:"retention,omitempty"`      // chunks older than this are dropped, e.g. "30 days"; empty keeps everything
+	CompressAfter      string `json:"compress_after,omitempty"` // chunks older than this are compressed; empty compresses none
+	CompressionEnabled bool   `json:"compression_enabled"`
+	Chunks             int64  `json:"chunks"`
+	CompressedChunks   int64  `json:"compressed_chunks"`
+	SizeBytes          int64  `json:"size_bytes"`
+	// MinInterval is the shortest retention or compress_after accepted: the refresh window of the
+	// continuous aggregates built on the table, or of the aggregate itself
+	MinInterval string `json:"min_interval,omitempty"`
+}
+
+// RetentionChange changes a table's policies: nil leaves a policy as it is, zero removes it
+type RetentionChange struct {
+	Retention     *time.Duration
+	CompressAfter *time.Duration
+}
+
+// policyTables lists the hypertables and continuous aggregates of the current schema with the
+// hypertable their chunks and policy jobs belong to (the materialization hypertable of an aggregate)
+const policyTables = `
+    SELECT hypertable_name AS name, hypertable_schema AS data_schema, hypertable_name AS data_name,
+           compression_enabled, false AS aggregate
+    FROM timescaledb_information.hypertables
+    WHERE hypertable_schema = current_schema()
+    UNION ALL
+    SELECT view_name, materialization_hypertable_schema, materialization_hypertable_name,
+           compression_enabled, true
+    FROM timescaledb_information.continuous_aggregates
+    WHERE view_schema = current_schema()`
+
+// policySetting reads a setting of t's policy job of the given procedure
+func policySetting(proc, setting string) string {
+	return `(SELECT (j.config->>'` + setting + `')::interval
+             FROM timescaledb_information.jobs j
+             WHERE j.proc_name = '` + proc + `' AND j.hypertable_schema = t.data_schema AND j.hypertable_name = t.data_name
+             LIMIT 1)`
+}
+
+// compressSegmentBy is how the chunks of a hypertable are segmented when compression is enabled;
+// tables not listed are compressed unsegmented
+var compressSegmentBy = map[string]string{
+	"sensor_readings": "device_id",
+}
+
+// GetRetentionPolicies returns the policies of every hypertable and continuous aggregate, raw
+// tables first
+func GetRetentionPolicies(ctx context.Context, db *sql.DB) ([]RetentionPolicy, error) {
+	rows, err := db.QueryContext(ctx, `
+        WITH t AS (`+policyTables+`)
+        SELECT t.name, t.aggregate, COALESCE(t.compression_enabled, false),
+               COALESCE(`+policySetting("policy_retention", "drop_after")+`::text, ''),
+               COALESCE(`+policySetting("policy_compression", "compress_after")+`::text, ''),
+               (SELECT count(*) FROM timescaledb_information.chunks c
+                WHERE c.hypertable_schema = t.data_schema AND c.hypertable_name = t.data_name),
+               (SELECT count(*) FROM timescaledb_information.chunks c
+                WHERE c.hypertable_schema = t.data_schema AND c.hypertable_name = t.data_name AND c.is_compressed),
+               COALESCE(hypertable_size(format('%I.%I', t.data_schema, t.data_name)::regclass), 0)
+        FROM t
+        ORDER BY t.aggregate, t.name
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []RetentionPolicy{}
+	for rows.Next() {
+		var p RetentionPolicy
+		if err := rows.Scan(&p.Table, &p.Aggregate, &p.CompressionEnabled, &p.Retention, &p.CompressAfter,
+			&p.Chunks, &p.CompressedChunks, &p.SizeBytes); err != nil {
+			return nil, err
+		}
+		if min := refreshWindow(p.Table); min > 0 {
+			p.MinInterval = policyInterval(min)
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// GetRetentionPolicy returns the policies of one table; ok is false when it is neither a
+// hypertable nor a continuous aggregate
+func GetRetentionPolicy(ctx context.Context, db *sql.DB, table string) (policy *RetentionPolicy, ok bool, err error) {
+	policies, err := GetRetentionPolicies(ctx, db)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range policies {
+		if policies[i].Table == table {
+			return &policies[i], true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// ValidateRetentionChange checks a change against the refresh windows of the continuous
+// aggregates: dropping or compressing chunks they still refresh from would empty or stall them
+func ValidateRetentionChange(table string, change RetentionChange) error {
+	min := refreshWindow(table)
+	for _, p := range []struct {
+		name  string
+		value *time.Duration
+	}{{"retention", change.Retention}, {"compress_after", change.CompressAfter}} {
+		if p.value == nil || *p.value == 0 {
+			continue
+		}
+		if *p.value < 0 {
+			return fmt.Errorf("%s must be positive", p.name)
+		}
+		if *p.value <= min {
+			return fmt.Errorf("%s of %s must be longer than %s, the refresh window of its continuous aggregates", p.name, table, policyInterval(min))
+		}
+	}
+	return nil
+}
+
+// SetRetentionPolicy replaces the policies of a hypertable or continuous aggregate in one
+// transaction. Setting compress_after enables compression first; removing it stops compressing
+// new chunks but leaves compressed ones as they are
+func SetRetentionPolicy(ctx context.Context, db *sql.DB, policy *RetentionPolicy, change RetentionChange) error {
+	if err := ValidateRetentionChange(policy.Table, change); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if change.Retention != nil {
+		if _, err := tx.ExecContext(ctx, `SELECT remove_retention_policy($1::regclass, if_exists => true)`, policy.Table); err != nil {
+			return err
+		}
+		if *change.Retention > 0 {
+			if _, err := tx.ExecContext(ctx, `SELECT add_retention_policy($1::regclass, drop_after => $2::interval)`,
+				policy.Table, policyInterval(*change.Retention)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if change.CompressAfter != nil {
+		if _, err := tx.ExecContext(ctx, `SELECT remove_compression_policy($1::regclass, if_exists => true)`, policy.Table); err != nil {
+			return err
+		}
+		if *change.CompressAfter > 0 {
+			if !policy.CompressionEnabled {
+				if _, err := tx.ExecContext(ctx, enableCompression(policy)); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.ExecContext(ctx, `SELECT add_compression_policy($1::regclass, compress_after => $2::interval)`,
+				policy.Table, policyInterval(*change.CompressAfter)); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// enableCompression turns on compression for a table; its name comes from the catalog
+func enableCompression(policy *RetentionPolicy) string {
+	name := `"` + strings.ReplaceAll(policy.Table, `"`, `""`) + `"`
+	if policy.Aggregate {
+		return `ALTER MATERIALIZED VIEW ` + name + ` SET (timescaledb.compress = true)`
+	}
+	if segmentBy, ok := compressSegmentBy[policy.Table]; ok {
+		return `ALTER TABLE ` + name + ` SET (timescaledb.compress, timescaledb.compress_segmentby = '` + segmentBy + `', timescaledb.compress_orderby = 'time DESC')`
+	}
+	return `ALTER TABLE ` + name + ` SET (timescaledb.compress)`
+}
+
+// retentionOf returns how long a table's retention policy keeps its chunks (0 without one)
+func retentionOf(ctx context.Context, db *sql.DB, table string) (time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := db.QueryRowContext(ctx, `
+        WITH t AS (`+policyTables+`)
+        SELECT EXTRACT(EPOCH FROM `+policySetting("policy_retention", "drop_after")+`)
+        FROM t WHERE t.name = $1
+    `, table).Scan(&seconds)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), err
+}
+
+// refreshWindow is the longest refresh window (start_offset) of the continuous aggregates built
+// on table or, for an aggregate, its own
+func refreshWindow(table string) time.Duration {
+	var window time.Duration
+	for _, level := range repairLevels {
+		if level.sourceTable == table || level.view == table {
+			window = max(window, level.settle)
+		}
+	}
+	return window
+}
+
+// policyInterval writes a duration as a Postgres interval, in days when it is whole days
+func policyInterval(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return fmt.Sprintf("%d seconds", d/time.Second)
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// writeLatencyBuckets are the upper bounds, in seconds, of the write latency histograms
+var writeLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Write operations
+const (
+	OpInsert = "insert" // one row per statement (StoreSensorReading)
+	OpCopy   = "copy"   // a batch with COPY (CopySensorReadings, the batch writer)
+)
+
+// WriteStats are the writes to one table with one operation since startup
+type WriteStats struct {
+	Table       string         `json:"table"`
+	Operation   string         `json:"operation"`
+	Count       int64          `json:"count"`  // statements, failed ones included
+	Errors      int64          `json:"errors"` // failed statements
+	Rows        int64          `json:"rows"`   // rows written by the statements that succeeded
+	SumSeconds  float64        `json:"sum_seconds"`
+	Buckets     []LatencyCount `json:"buckets"`              // cumulative, as in Prometheus
+	P50Ms       float64        `json:"p50_ms"`               // estimated from the buckets
+	P95Ms       float64        `json:"p95_ms"`               // estimated from the buckets
+	P99Ms       float64        `json:"p99_ms"`               // estimated from the buckets
+	LastError   string         `json:"last_error,omitempty"` // of the latest failure
+	LastErrorAt *time.Time     `json:"last_error_at,omitempty"`
+}
+
+// LatencyCount is how many statements took at most LE seconds
+type LatencyCount struct {
+	LE    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+type writeKey struct {
+	table, operation string
+}
+
+type writeSeries struct {
+	count, errors, rows int64
+	sum                 float64
+	buckets             []int64 // per bucket, not cumulative; the last one is +Inf
+	lastError           string
+	lastErrorAt         time.Time
+}
+
+// writeMetrics records the latency and outcome of every write to the hypertables, so dips in
+// ingestion acks can be matched with database maintenance (compression, retention, refreshes)
+var writeMetrics = struct {
+	mu     sync.Mutex
+	series map[writeKey]*writeSeries
+}{series: make(map[writeKey]*writeSeries)}
+
+// observeWrite records one write statement that started at start
+func observeWrite(table, operation string, rows int, start time.Time, err error) {
+	elapsed := time.Since(start).Seconds()
+	i := sort.SearchFloat64s(writeLatencyBuckets, elapsed)
+
+	writeMetrics.mu.Lock()
+	defer writeMetrics.mu.Unlock()
+	key := writeKey{table, operation}
+	s, ok := writeMetrics.series[key]
+	if !ok {
+		s = &writeSeries{buckets: make([]int64, len(writeLatencyBuckets)+1)}
+		writeMetrics.series[key] = s
+	}
+	s.count++
+	s.sum += elapsed
+	s.buckets[i]++
+	if err != nil {
+		s.errors++
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now()
+		return
+	}
+	s.rows += int64(rows)
+}
+
+// GetWriteStats returns the write statistics of every table and operation written since startup,
+// ordered by table and operation
+func GetWriteStats() []WriteStats {
+	writeMetrics.mu.Lock()
+	defer writeMetrics.mu.Unlock()
+
+	stats := []WriteStats{}
+	for key, s := range writeMetrics.series {
+		w := WriteStats{
+			Table:      key.table,
+			Operation:  key.operation,
+			Count:      s.count,
+			Errors:     s.errors,
+			Rows:       s.rows,
+			SumSeconds: s.sum,
+			LastError:  s.lastError,
+		}
+		if !s.lastErrorAt.IsZero() {
+			at := s.lastErrorAt
+			w.LastErrorAt = &at
+		}
+		var cumulative int64
+		for i, le := range writeLatencyBuckets {
+			cumulative += s.buckets[i]
+			w.Buckets = append(w.Buckets, LatencyCount{LE: le, Count: cumulative})
+		}
+		w.P50Ms = quantileMs(w.Buckets, s.count, 0.50)
+		w.P95Ms = quantileMs(w.Buckets, s.count, 0.95)
+		w.P99Ms = quantileMs(w.Buckets, s.count, 0.99)
+		stats = append(stats, w)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Table != stats[j].Table {
+			return stats[i].Table < stats[j].Table
+		}
+		return stats[i].Operation < stats[j].Operation
+	})
+	return stats
+}
+
+// quantileMs estimates a quantile from cumulative buckets by linear interpolation within the
+// bucket it falls in, as Prometheus' histogram_quantile does; beyond the last bound it is that bound
+func quantileMs(buckets []LatencyCount, total int64, q float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	lower, below := 0.0, int64(0)
+	for _, b := range buckets {
+		if float64(b.Count) >= rank {
+			inBucket := b.Count - below
+			if inBucket == 0 {
+				return b.LE * 1000
+			}
+			return (lower + (b.LE-lower)*(rank-float64(below))/float64(inBucket)) * 1000
+		}
+		lower, below = b.LE, b.Count
+	}
+	return lower * 1000
+}
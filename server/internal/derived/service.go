@@ -0,0 +1,391 @@
+// computed metrics defined as expressions over other sensor series
+// "ingest" metrics are evaluated as readings arrive and stored as regular sensor_readings rows,
+// so they show up in aggregates, text-to-SQL and alerting like native metrics
+// "query" metrics are evaluated on demand over aggregate buckets
+
+package derived
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/expr"
+	"edge-insights/internal/types"
+)
+
+// DevicePrefix marks readings produced by derived metrics so they are never fed back as inputs
+const DevicePrefix = "derived:"
+
+// Mode decides when a derived metric is evaluated
+type Mode string
+
+const (
+	ModeIngest Mode = "ingest"
+	ModeQuery  Mode = "query"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Input selects the readings an expression variable is taken from
+type Input struct {
+	DeviceID   string `json:"device_id,omitempty"`
+	DeviceType string `json:"device_type,omitempty"`
+	Location   string `json:"location,omitempty"`
+}
+
+func (in Input) matches(msg types.LogMessage) bool {
+	if in.DeviceID != "" && in.DeviceID != msg.DeviceID {
+		return false
+	}
+	if in.DeviceType != "" && in.DeviceType != msg.DeviceType {
+		return false
+	}
+	if in.Location != "" && in.Location != msg.Location {
+		return false
+	}
+	return true
+}
+
+// Definition describes one computed metric
+type Definition struct {
+	Name       string           `json:"name"`
+	Expression string           `json:"expression"`
+	Inputs     map[string]Input `json:"inputs"`
+	Mode       Mode             `json:"mode"`
+	Unit       string           `json:"unit"`
+	Location   string           `json:"location"`
+	CreatedAt  time.Time        `json:"created_at"`
+
+	compiled *expr.Expr
+}
+
+// Point is one evaluated value of a derived metric
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+type sample struct {
+	value float64
+	time  time.Time
+}
+
+// Service stores definitions and evaluates them
+type Service struct {
+	db          *sql.DB
+	mu          sync.RWMutex
+	definitions map[string]*Definition
+	latest      map[string]map[string]sample // metric name -> variable -> latest input sample
+	staleness   time.Duration                // inputs older than this are not combined at ingestion
+}
+
+// NewService creates the service and loads existing definitions
+func NewService(database *sql.DB, staleness time.Duration) *Service {
+	s := &Service{
+		db:          database,
+		definitions: make(map[string]*Definition),
+		latest:      make(map[string]map[string]sample),
+		staleness:   staleness,
+	}
+	if err := s.Load(); err != nil {
+		// Keep serving native metrics even if the table is unavailable
+		log.Printf("Failed to load derived metrics: %v", err)
+	}
+	return s
+}
+
+// Load (re)reads all definitions from the database
+func (s *Service) Load() error {
+	rows, err := s.db.Query(`SELECT name, expression, inputs, mode, unit, location, created_at FROM derived_metrics`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	definitions := make(map[string]*Definition)
+	for rows.Next() {
+		var def Definition
+		var inputs []byte
+		if err := rows.Scan(&def.Name, &def.Expression, &inputs, &def.Mode, &def.Unit, &def.Location, &def.CreatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(inputs, &def.Inputs); err != nil {
+			return fmt.Errorf("invalid inputs for %s: %w", def.Name, err)
+		}
+		if err := def.compile(); err != nil {
+			return err
+		}
+		definitions[def.Name] = &def
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.definitions = definitions
+	s.latest = make(map[string]map[string]sample)
+	s.mu.Unlock()
+	return nil
+}
+
+// compile validates the definition and prepares its expression
+func (d *Definition) compile() error {
+	if !namePattern.MatchString(d.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits and underscores")
+	}
+	if d.Mode == "" {
+		d.Mode = ModeQuery
+	}
+	if d.Mode != ModeIngest && d.Mode != ModeQuery {
+		return fmt.Errorf("mode must be %q or %q", ModeIngest, ModeQuery)
+	}
+
+	compiled, err := expr.Compile(d.Expression)
+	if err != nil {
+		return err
+	}
+	for _, v := range compiled.Vars() {
+		in, ok := d.Inputs[v]
+		if !ok {
+			return fmt.Errorf("variable %q has no input", v)
+		}
+		if in.DeviceID == "" && in.DeviceType == "" {
+			return fmt.Errorf("input %q needs a device_id or device_type", v)
+		}
+	}
+	d.compiled = compiled
+	return nil
+}
+
+// List returns all definitions sorted by name
+func (s *Service) List() []Definition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Definition, 0, len(s.definitions))
+	for _, def := range s.definitions {
+		list = append(list, *def)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get returns a single definition
+func (s *Service) Get(name string) (*Definition, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	def, ok := s.definitions[name]
+	if !ok {
+		return nil, false
+	}
+	found := *def
+	return &found, true
+}
+
+// Save validates and creates or replaces a definition
+func (s *Service) Save(def Definition) (*Definition, error) {
+	if err := def.compile(); err != nil {
+		return nil, err
+	}
+
+	inputs, err := json.Marshal(def.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO derived_metrics (name, expression, inputs, mode, unit, location)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (name) DO UPDATE SET
+            expression = EXCLUDED.expression,
+            inputs = EXCLUDED.inputs,
+            mode = EXCLUDED.mode,
+            unit = EXCLUDED.unit,
+            location = EXCLUDED.location
+        RETURNING created_at
+    `
+	if err := s.db.QueryRow(query, def.Name, def.Expression, inputs, def.Mode, def.Unit, def.Location).Scan(&def.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save derived metric: %w", err)
+	}
+
+	s.mu.Lock()
+	s.definitions[def.Name] = &def
+	delete(s.latest, def.Name)
+	s.mu.Unlock()
+
+	return &def, nil
+}
+
+// Delete removes a definition; it reports false if it did not exist
+func (s *Service) Delete(name string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM derived_metrics WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	s.mu.Lock()
+	delete(s.definitions, name)
+	delete(s.latest, name)
+	s.mu.Unlock()
+
+	return n > 0, nil
+}
+
+// Observe feeds an ingested reading to every ingest-mode metric and returns the derived readings it completes
+func (s *Service) Observe(msg types.LogMessage) []types.LogMessage {
+	if msg.RawValue == nil || strings.HasPrefix(msg.DeviceID, DevicePrefix) {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var produced []types.LogMessage
+	for name, def := range s.definitions {
+		if def.Mode != ModeIngest {
+			continue
+		}
+
+		touched := false
+		for variable, in := range def.Inputs {
+			if !in.matches(msg) {
+				continue
+			}
+			if s.latest[name] == nil {
+				s.latest[name] = make(map[string]sample)
+			}
+			s.latest[name][variable] = sample{value: *msg.RawValue, time: msg.Time}
+			touched = true
+		}
+		if !touched {
+			continue
+		}
+
+		// Only combine inputs that were all reported recently
+		vars := make(map[string]float64, len(def.Inputs))
+		complete := true
+		for variable := range def.Inputs {
+			smp, ok := s.latest[name][variable]
+			if !ok || msg.Time.Sub(smp.time) > s.staleness {
+				complete = false
+				break
+			}
+			vars[variable] = smp.value
+		}
+		if !complete {
+			continue
+		}
+
+		value, err := def.compiled.Eval(expr.Env{Vars: vars})
+		if err != nil {
+			continue
+		}
+
+		location := def.Location
+		if location == "" {
+			location = msg.Location
+		}
+		produced = append(produced, types.LogMessage{
+			Time:       msg.Time,
+			DeviceID:   DevicePrefix + name,
+			DeviceType: name,
+			Location:   location,
+			RawValue:   &value,
+			Unit:       def.Unit,
+			LogType:    "INFO",
+			Message:    fmt.Sprintf("Derived metric %s = %.2f %s", name, value, def.Unit),
+		})
+	}
+	return produced
+}
+
+// Evaluate computes a metric over aggregate buckets of the given view (five_min, hourly, daily)
+func (s *Service) Evaluate(name, view string, start, end time.Time) ([]Point, error) {
+	def, ok := s.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("derived metric %q not found", name)
+	}
+	width, ok := db.AggregateBucketWidth(view)
+	if !ok {
+		return nil, fmt.Errorf("unknown view %q", view)
+	}
+
+	// Step 1: Fetch the bucketed series behind every input variable
+	series := make(map[string]map[time.Time]float64, len(def.Inputs))
+	for variable, in := range def.Inputs {
+		var buckets []db.AggregateBucket
+		var err error
+		if in.DeviceID != "" {
+			buckets, err = db.GetDeviceBuckets(s.db, in.DeviceID, width, start, end)
+		} else {
+			buckets, err = db.GetAggregateWindow(s.db, view, in.DeviceType, in.Location, start, end)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load input %q: %w", variable, err)
+		}
+
+		// Several locations can share a bucket when no location filter is set; average them
+		sums := make(map[time.Time][2]float64)
+		for _, b := range buckets {
+			acc := sums[b.Bucket]
+			sums[b.Bucket] = [2]float64{acc[0] + b.AvgValue, acc[1] + 1}
+		}
+		values := make(map[time.Time]float64, len(sums))
+		for t, acc := range sums {
+			values[t] = acc[0] / acc[1]
+		}
+		series[variable] = values
+	}
+
+	// Step 2: Evaluate the expression on buckets where every input has a value
+	var points []Point
+	var anchor string
+	for variable := range series {
+		anchor = variable
+		break
+	}
+	for t := range series[anchor] {
+		vars := make(map[string]float64, len(series))
+		complete := true
+		for variable, values := range series {
+			v, ok := values[t]
+			if !ok {
+				complete = false
+				break
+			}
+			vars[variable] = v
+		}
+		if !complete {
+			continue
+		}
+
+		value, err := def.compiled.Eval(expr.Env{Vars: vars})
+		if err != nil {
+			continue
+		}
+		points = append(points, Point{Time: t, Value: value})
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+// Import saves a batch of definitions (used by configuration bundles) and returns how many were applied
+func (s *Service) Import(definitions []Definition) (int, error) {
+	for i, def := range definitions {
+		if _, err := s.Save(def); err != nil {
+			return i, fmt.Errorf("%s: %w", def.Name, err)
+		}
+	}
+	return len(definitions), nil
+}
@@ -0,0 +1,55 @@
+package devicekeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// keyPrefix marks Edge Insights device keys so leaked keys are easy to recognise
+const keyPrefix = "eik_"
+
+// Key is an API key a device presents when connecting to /ws
+// Only a hash is stored; Secret is set once, in the response that creates the key
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`               // first characters of the key, to tell keys apart
+	DeviceID   string     `json:"device_id,omitempty"`  // when set, the key may only send readings for this device
+	RateLimit  int        `json:"rate_limit,omitempty"` // POST /api/ingest requests a minute; 0 uses INGEST_RATE_LIMIT
+	RateBurst  int        `json:"rate_burst,omitempty"` // 0 uses INGEST_RATE_BURST
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Secret     string     `json:"key,omitempty"`
+	keyHash    string
+}
+
+// Allows reports whether the key may send readings for deviceID
+func (k *Key) Allows(deviceID string) bool {
+	return k.DeviceID == "" || k.DeviceID == deviceID
+}
+
+func newSecret() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashSecret(secret), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,206 @@
+package devicekeys
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps device API keys in the device_api_keys table with an in-memory index by key hash
+type Store struct {
+	db   *sql.DB
+	mu   sync.RWMutex
+	keys map[string]*Key // key hash -> key
+}
+
+// NewStore creates a store and loads the keys that have not been revoked
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, keys: make(map[string]*Key)}
+	return s, s.Load()
+}
+
+// Load (re)reads all active keys from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`
+        SELECT id, key_hash, prefix, name, COALESCE(device_id, ''), COALESCE(rate_limit, 0), COALESCE(rate_burst, 0),
+               created_at, last_used_at
+        FROM device_api_keys
+        WHERE revoked_at IS NULL
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]*Key)
+	for rows.Next() {
+		var k Key
+		if err := rows.Scan(&k.ID, &k.keyHash, &k.Prefix, &k.Name, &k.DeviceID, &k.RateLimit, &k.RateBurst,
+			&k.CreatedAt, &k.LastUsedAt); err != nil {
+			return err
+		}
+		keys[k.keyHash] = &k
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// Authenticate returns the active key matching secret and records its use
+func (s *Store) Authenticate(secret string) (*Key, bool) {
+	if secret == "" {
+		return nil, false
+	}
+	hash := hashSecret(secret)
+
+	s.mu.Lock()
+	k, ok := s.keys[hash]
+	if !ok {
+		s.mu.Unlock()
+		return nil, false
+	}
+	now := time.Now()
+	k.LastUsedAt = &now
+	found := *k
+	s.mu.Unlock()
+
+	// Connections authenticate once, so recording every use is cheap
+	go func() {
+		if _, err := s.db.Exec(`UPDATE device_api_keys SET last_used_at = NOW() WHERE id = $1`, found.ID); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", found.ID, err)
+		}
+	}()
+	return &found, true
+}
+
+// Active reports whether a previously authenticated key is still valid (not revoked since)
+func (s *Store) Active(k *Key) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.keys[k.keyHash]
+	return ok
+}
+
+// List returns the active keys, newest first, without their secrets
+func (s *Store) List() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, *k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Create issues a new key, optionally restricted to one device and with its own ingest rate
+// limit (0: the server default), and returns it with Secret set
+func (s *Store) Create(name, deviceID string, rateLimit, rateBurst int) (*Key, error) {
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := validateRateLimit(rateLimit, rateBurst); err != nil {
+		return nil, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	secret, hash, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	k := Key{
+		ID:        id,
+		Name:      name,
+		Prefix:    secret[:len(keyPrefix)+6],
+		DeviceID:  deviceID,
+		RateLimit: rateLimit,
+		RateBurst: rateBurst,
+		keyHash:   hash,
+	}
+
+	query := `
+        INSERT INTO device_api_keys (id, key_hash, prefix, name, device_id, rate_limit, rate_burst)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, 0))
+        RETURNING created_at
+    `
+	if err := s.db.QueryRow(query, k.ID, hash, k.Prefix, k.Name, k.DeviceID, k.RateLimit, k.RateBurst).Scan(&k.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save API key: %w", err)
+	}
+
+	s.mu.Lock()
+	stored := k
+	s.keys[hash] = &stored
+	s.mu.Unlock()
+
+	k.Secret = secret
+	return &k, nil
+}
+
+// SetRateLimit changes the ingest rate limit of an active key (0: the server default)
+// It returns the updated key and false when no active key has that id
+func (s *Store) SetRateLimit(id string, rateLimit, rateBurst int) (*Key, bool, error) {
+	if err := validateRateLimit(rateLimit, rateBurst); err != nil {
+		return nil, false, err
+	}
+	result, err := s.db.Exec(`
+        UPDATE device_api_keys SET rate_limit = NULLIF($2, 0), rate_burst = NULLIF($3, 0)
+        WHERE id = $1 AND revoked_at IS NULL
+    `, id, rateLimit, rateBurst)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.keys {
+		if k.ID == id {
+			k.RateLimit, k.RateBurst = rateLimit, rateBurst
+			updated := *k
+			return &updated, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func validateRateLimit(rateLimit, rateBurst int) error {
+	if rateLimit < 0 || rateBurst < 0 {
+		return fmt.Errorf("rate_limit and rate_burst must not be negative")
+	}
+	return nil
+}
+
+// Revoke disables a key immediately, including for connections already authenticated with it
+func (s *Store) Revoke(id string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE device_api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	for hash, k := range s.keys {
+		if k.ID == id {
+			delete(s.keys, hash)
+		}
+	}
+	s.mu.Unlock()
+	return n > 0, nil
+}
@@ -0,0 +1,64 @@
+package devices
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	apperrors "edge-insights/internal/errors"
+)
+
+// Device is a registered device
+type Device struct {
+	ID               string                 `json:"id"`
+	Type             string                 `json:"device_type"`
+	Location         string                 `json:"location"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+	LastSeen         *time.Time             `json:"last_seen,omitempty"`
+	DecommissionedAt *time.Time             `json:"decommissioned_at,omitempty"`
+}
+
+// Validate checks the fields a registration must have
+func (d *Device) Validate() error {
+	if d.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if d.Type == "" {
+		return fmt.Errorf("device_type is required")
+	}
+	return nil
+}
+
+// Active reports whether the device has not been decommissioned
+func (d *Device) Active() bool {
+	return d.DecommissionedAt == nil
+}
+
+// Policy decides what happens to readings from devices that are not registered
+type Policy string
+
+const (
+	PolicyAllow    Policy = "allow"    // store them without registering (the registry is informational)
+	PolicyRegister Policy = "register" // register the device from its first reading
+	PolicyReject   Policy = "reject"   // refuse them
+)
+
+// ParsePolicy validates an UNKNOWN_DEVICE_POLICY value
+func ParsePolicy(s string) (Policy, bool) {
+	switch p := Policy(s); p {
+	case PolicyAllow, PolicyRegister, PolicyReject:
+		return p, true
+	}
+	return "", false
+}
+
+var (
+	// ErrExists is returned when registering an ID that is already registered
+	ErrExists = apperrors.Mark(errors.New("device already registered"), apperrors.ErrConflict)
+	// ErrUnknown is returned by Admit for unregistered devices under PolicyReject
+	ErrUnknown = apperrors.Mark(errors.New("device is not registered"), apperrors.ErrNotFound)
+	// ErrDecommissioned is returned by Admit for decommissioned devices unless the policy is PolicyAllow
+	ErrDecommissioned = apperrors.Mark(errors.New("device has been decommissioned"), apperrors.ErrConflict)
+)
@@ -0,0 +1,297 @@
+package devices
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// Store keeps the device registry in the devices table with an in-memory copy for the ingestion path
+type Store struct {
+	db      *sql.DB
+	mu      sync.RWMutex
+	devices map[string]*Device
+	seen    map[string]time.Time // last_seen updates not yet written
+}
+
+// NewStore creates a store and loads the registered devices
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, devices: make(map[string]*Device), seen: make(map[string]time.Time)}
+	return s, s.Load()
+}
+
+// Load (re)reads all devices from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`
+        SELECT id, device_type, location, metadata, created_at, updated_at, last_seen, decommissioned_at
+        FROM devices
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	devices := make(map[string]*Device)
+	for rows.Next() {
+		var d Device
+		var metadata []byte
+		if err := rows.Scan(&d.ID, &d.Type, &d.Location, &metadata, &d.CreatedAt, &d.UpdatedAt,
+			&d.LastSeen, &d.DecommissionedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(metadata, &d.Metadata); err != nil {
+			return fmt.Errorf("invalid metadata for %s: %w", d.ID, err)
+		}
+		devices[d.ID] = &d
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.devices = devices
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns a registered device
+func (s *Store) Get(id string) (*Device, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.devices[id]
+	if !ok {
+		return nil, false
+	}
+	found := *d
+	return &found, true
+}
+
+// Filter narrows List
+type Filter struct {
+	Type                  string
+	Location              string
+	IncludeDecommissioned bool
+}
+
+// List returns the devices matching f sorted by ID
+func (s *Store) List(f Filter) []Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Device, 0, len(s.devices))
+	for _, d := range s.devices {
+		if (f.Type != "" && d.Type != f.Type) || (f.Location != "" && d.Location != f.Location) {
+			continue
+		}
+		if !d.Active() && !f.IncludeDecommissioned {
+			continue
+		}
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Register adds a new device; it returns ErrExists if the ID is taken (even by a decommissioned device)
+func (s *Store) Register(d Device) (*Device, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	metadata, err := marshalMetadata(d.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO devices (id, device_type, location, metadata)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (id) DO NOTHING
+        RETURNING created_at, updated_at
+    `
+	err = s.db.QueryRow(query, d.ID, d.Type, d.Location, metadata).Scan(&d.CreatedAt, &d.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to register device: %w", err)
+	}
+	d.LastSeen, d.DecommissionedAt = nil, nil
+
+	s.mu.Lock()
+	stored := d
+	s.devices[d.ID] = &stored
+	s.mu.Unlock()
+	return &d, nil
+}
+
+// Save creates or replaces a device's type, location and metadata, keeping its history fields
+// A decommissioned device saved again is recommissioned
+func (s *Store) Save(d Device) (*Device, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	metadata, err := marshalMetadata(d.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO devices (id, device_type, location, metadata)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (id) DO UPDATE SET
+            device_type = EXCLUDED.device_type,
+            location = EXCLUDED.location,
+            metadata = EXCLUDED.metadata,
+            updated_at = NOW(),
+            decommissioned_at = NULL
+        RETURNING created_at, updated_at, last_seen
+    `
+	if err := s.db.QueryRow(query, d.ID, d.Type, d.Location, metadata).
+		Scan(&d.CreatedAt, &d.UpdatedAt, &d.LastSeen); err != nil {
+		return nil, fmt.Errorf("failed to save device: %w", err)
+	}
+	d.DecommissionedAt = nil
+
+	s.mu.Lock()
+	stored := d
+	s.devices[d.ID] = &stored
+	s.mu.Unlock()
+	return &d, nil
+}
+
+// Decommission marks a device as retired; its readings are kept. It reports false if the
+// device is not registered or already decommissioned
+func (s *Store) Decommission(id string) (bool, error) {
+	var at time.Time
+	err := s.db.QueryRow(`
+        UPDATE devices SET decommissioned_at = NOW(), updated_at = NOW()
+        WHERE id = $1 AND decommissioned_at IS NULL
+        RETURNING decommissioned_at
+    `, id).Scan(&at)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if d, ok := s.devices[id]; ok {
+		d.DecommissionedAt = &at
+		d.UpdatedAt = at
+	}
+	s.mu.Unlock()
+	return true, nil
+}
+
+// Import saves a batch of devices (used by configuration bundles)
+func (s *Store) Import(devices []Device) (int, error) {
+	for i, d := range devices {
+		if _, err := s.Save(d); err != nil {
+			return i, fmt.Errorf("%s: %w", d.ID, err)
+		}
+	}
+	return len(devices), nil
+}
+
+// Admit decides whether a reading may be stored under policy, registering the device
+// from the reading under PolicyRegister
+func (s *Store) Admit(msg types.LogMessage, policy Policy) error {
+	if policy == PolicyAllow {
+		return nil
+	}
+
+	d, ok := s.Get(msg.DeviceID)
+	switch {
+	case ok && d.Active():
+		return nil
+	case ok:
+		return ErrDecommissioned
+	case policy == PolicyReject:
+		return ErrUnknown
+	}
+
+	deviceType := msg.DeviceType
+	if deviceType == "" {
+		deviceType = "unknown"
+	}
+	_, err := s.Register(Device{ID: msg.DeviceID, Type: deviceType, Location: msg.Location})
+	if err == ErrExists {
+		// Registered concurrently by another connection
+		return nil
+	}
+	if err == nil {
+		log.Printf("Auto-registered device %s (%s)", msg.DeviceID, deviceType)
+	}
+	return err
+}
+
+// Touch records that a registered device reported at t; it is written on the next flush
+func (s *Store) Touch(msg types.LogMessage) {
+	t := msg.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[msg.DeviceID]
+	if !ok {
+		return
+	}
+	if d.LastSeen == nil || t.After(*d.LastSeen) {
+		d.LastSeen = &t
+		s.seen[d.ID] = t
+	}
+}
+
+// Start writes pending last_seen updates every interval
+func (s *Store) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.Flush(); err != nil {
+				log.Printf("Failed to update device last_seen: %v", err)
+			}
+		}
+	}()
+}
+
+// Flush writes pending last_seen updates in one statement
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	if len(s.seen) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	ids := make([]string, 0, len(s.seen))
+	times := make([]time.Time, 0, len(s.seen))
+	for id, t := range s.seen {
+		ids = append(ids, id)
+		times = append(times, t)
+	}
+	s.seen = make(map[string]time.Time)
+	s.mu.Unlock()
+
+	_, err := s.db.Exec(`
+        UPDATE devices d
+        SET last_seen = GREATEST(COALESCE(d.last_seen, v.seen), v.seen)
+        FROM unnest($1::text[], $2::timestamptz[]) AS v(id, seen)
+        WHERE d.id = v.id
+    `, ids, times)
+	return err
+}
+
+func marshalMetadata(metadata map[string]interface{}) ([]byte, error) {
+	if metadata == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(metadata)
+}
@@ -0,0 +1,233 @@
+// Package devicetypes is the registry of known device types: the unit each one reports in, the
+// range its values fall in, how often it reports and how its values are displayed. The validator,
+// the simulator, the anomaly detector and the text-to-SQL prompt all read it, so a new kind of
+// device is described once, in DEVICE_TYPES_FILE, instead of in every package
+// Device types that are not registered are accepted and treated as free-form
+package devicetypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Type describes one kind of device
+type Type struct {
+	Name              string   `json:"name"`
+	Label             string   `json:"label"`                        // display name, e.g. "Temperature"
+	Unit              string   `json:"unit,omitempty"`               // the unit readings carry; readings without one get it
+	Symbol            string   `json:"symbol,omitempty"`             // displayed after values, e.g. "°C"; defaults to Unit
+	Decimals          int      `json:"decimals"`                     // decimals displayed
+	Min               *float64 `json:"min,omitempty"`                // lowest valid value
+	Max               *float64 `json:"max,omitempty"`                // highest valid value
+	Boolean           bool     `json:"boolean,omitempty"`            // reports 1 (on) or 0 (off)
+	Silent            bool     `json:"silent,omitempty"`             // reports log lines without a value (cameras, controllers)
+	ReportingInterval string   `json:"reporting_interval,omitempty"` // how often devices report by default, e.g. "10s"
+	Typical           float64  `json:"typical,omitempty"`            // typical value, for the simulator
+	Noise             float64  `json:"noise,omitempty"`              // standard deviation around Typical, for the simulator
+
+	interval time.Duration
+}
+
+func float(v float64) *float64 { return &v }
+
+// Builtin are the device types the simulator, dashboards and demo know about
+var Builtin = []Type{
+	{Name: "temperature_sensor", Label: "Temperature", Unit: "celsius", Symbol: "°C", Decimals: 1, Min: float(-50), Max: float(150), ReportingInterval: "10s", Typical: 22, Noise: 1.5},
+	{Name: "humidity_sensor", Label: "Humidity", Unit: "percent", Symbol: "%", Decimals: 0, Min: float(0), Max: float(100), ReportingInterval: "10s", Typical: 45, Noise: 4},
+	{Name: "motion_detector", Label: "Motion", Unit: "boolean", Boolean: true, Min: float(0), Max: float(1), ReportingInterval: "10s", Typical: 0.3},
+	{Name: "camera", Label: "Camera", Silent: true, ReportingInterval: "30s"},
+	{Name: "controller", Label: "Controller", Silent: true, ReportingInterval: "30s"},
+}
+
+var registry = struct {
+	sync.RWMutex
+	types map[string]Type
+}{types: mustIndex(Builtin)}
+
+func mustIndex(list []Type) map[string]Type {
+	index, err := indexTypes(nil, list)
+	if err != nil {
+		panic(err)
+	}
+	return index
+}
+
+// indexTypes validates list and adds it to base, replacing types of the same name
+func indexTypes(base map[string]Type, list []Type) (map[string]Type, error) {
+	index := make(map[string]Type, len(base)+len(list))
+	for name, t := range base {
+		index[name] = t
+	}
+	for i, t := range list {
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("device type %d (%s): %w", i, t.Name, err)
+		}
+		index[t.Name] = t
+	}
+	return index, nil
+}
+
+func (t *Type) validate() error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits and underscores")
+	}
+	if t.Label == "" {
+		t.Label = t.Name
+	}
+	if t.Min != nil && t.Max != nil && *t.Min > *t.Max {
+		return fmt.Errorf("min must not be above max")
+	}
+	if t.Decimals < 0 || t.Decimals > 6 {
+		return fmt.Errorf("decimals must be between 0 and 6")
+	}
+	if t.Boolean && t.Silent {
+		return fmt.Errorf("a type cannot be both boolean and silent")
+	}
+	t.interval = 0
+	if t.ReportingInterval != "" {
+		d, err := time.ParseDuration(t.ReportingInterval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid reporting_interval %q", t.ReportingInterval)
+		}
+		t.interval = d
+	}
+	return nil
+}
+
+// LoadFile adds the device types in the JSON array at path to the built-in ones, replacing
+// built-in types of the same name; an empty path keeps the built-in types only
+func LoadFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var list []Type
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid device types file %s: %w", path, err)
+	}
+	index, err := indexTypes(mustIndex(Builtin), list)
+	if err != nil {
+		return fmt.Errorf("invalid device types file %s: %w", path, err)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	registry.types = index
+	return nil
+}
+
+// Lookup returns a registered device type
+func Lookup(name string) (Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
+
+// All returns the registered device types ordered by name
+func All() []Type {
+	registry.RLock()
+	defer registry.RUnlock()
+	list := make([]Type, 0, len(registry.types))
+	for _, t := range registry.types {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Interval is how often devices of the type report by default (0 when unknown)
+func (t Type) Interval() time.Duration {
+	return t.interval
+}
+
+// InRange reports whether a value is valid for the type
+func (t Type) InRange(v float64) bool {
+	if t.Boolean && v != 0 && v != 1 {
+		return false
+	}
+	return (t.Min == nil || v >= *t.Min) && (t.Max == nil || v <= *t.Max)
+}
+
+// Range describes the valid values, e.g. "between 0 and 100"
+func (t Type) Range() string {
+	switch {
+	case t.Boolean:
+		return "0 or 1"
+	case t.Min != nil && t.Max != nil:
+		return fmt.Sprintf("between %g and %g", *t.Min, *t.Max)
+	case t.Min != nil:
+		return fmt.Sprintf("at least %g", *t.Min)
+	case t.Max != nil:
+		return fmt.Sprintf("at most %g", *t.Max)
+	}
+	return "any number"
+}
+
+// Format displays a value of the type, e.g. "22.5 °C" or "on"
+func (t Type) Format(v float64) string {
+	if t.Boolean {
+		if v > 0.5 {
+			return "on"
+		}
+		return "off"
+	}
+	s := strconv.FormatFloat(v, 'f', t.Decimals, 64)
+	symbol := t.Symbol
+	if symbol == "" {
+		symbol = t.Unit
+	}
+	if symbol == "" {
+		return s
+	}
+	return s + " " + symbol
+}
+
+// Check fills in a reading's unit when it has none and returns the problems of a reading of a
+// registered type: a unit other than the type's or a value out of its range
+func Check(msg *types.LogMessage) []types.FieldError {
+	t, ok := Lookup(msg.DeviceType)
+	if !ok {
+		return nil
+	}
+	var problems []types.FieldError
+	if t.Unit != "" {
+		if msg.Unit == "" && msg.RawValue != nil {
+			msg.Unit = t.Unit
+		} else if msg.Unit != "" && msg.Unit != t.Unit {
+			problems = append(problems, types.FieldError{Field: "unit", Code: "invalid",
+				Message: fmt.Sprintf("unit of %s readings must be %s", t.Name, t.Unit)})
+		}
+	}
+	if msg.RawValue != nil && !math.IsNaN(*msg.RawValue) && !t.InRange(*msg.RawValue) {
+		problems = append(problems, types.FieldError{Field: "raw_value", Code: "invalid",
+			Message: fmt.Sprintf("raw_value of %s readings must be %s", t.Name, t.Range())})
+	}
+	return problems
+}
+
+// FormatValue displays a value of the given device type, or with its unit when the type is not
+// registered
+func FormatValue(deviceType string, v float64, unit string) string {
+	if t, ok := Lookup(deviceType); ok && (unit == "" || unit == t.Unit) {
+		return t.Format(v)
+	}
+	if unit == "" {
+		return fmt.Sprintf("%.2f", v)
+	}
+	return fmt.Sprintf("%.2f %s", v, unit)
+}
@@ -0,0 +1,344 @@
+// Package dlq is a disk-backed dead-letter queue for readings the database failed to store (database
+// down, constraint violations). Each reading is one JSON file in the queue's directory, written and
+// synced before the device is answered, so queued readings survive restarts; a background worker
+// retries them in the order they failed until they are stored
+package dlq
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "edge-insights/internal/errors"
+	"edge-insights/internal/types"
+)
+
+// ErrNotFound is returned for unknown entry IDs
+var ErrNotFound = fmt.Errorf("dead letter %w", apperrors.ErrNotFound)
+
+// ErrFull is returned by Add when the queue holds its maximum number of entries
+var ErrFull = errors.New("dead-letter queue is full")
+
+// maxRetryBackoff caps how long the worker waits before retrying an entry that keeps failing
+const maxRetryBackoff = time.Hour
+
+// Entry is a reading that could not be stored
+type Entry struct {
+	ID            string           `json:"id"`
+	Reading       types.LogMessage `json:"reading"`
+	Source        string           `json:"source"` // websocket, ingest, batch or derived
+	Error         string           `json:"error"`  // why it was first not stored
+	FailedAt      time.Time        `json:"failed_at"`
+	Attempts      int              `json:"attempts"` // retries so far
+	LastAttemptAt *time.Time       `json:"last_attempt_at,omitempty"`
+	LastError     string           `json:"last_error,omitempty"`
+	// Permanent is set when the last retry failed with an error retrying cannot fix (a constraint or
+	// validation error); the worker then leaves the entry for Replay
+	Permanent bool `json:"permanent,omitempty"`
+}
+
+// ReplayResult counts the outcome of retrying entries
+type ReplayResult struct {
+	Replayed int      `json:"replayed"` // stored and removed from the queue
+	Failed   int      `json:"failed"`
+	Missing  []string `json:"missing,omitempty"` // requested IDs that are not queued
+}
+
+// Queue is the dead-letter queue in one directory
+type Queue struct {
+	dir        string
+	maxEntries int
+
+	mu  sync.Mutex
+	ids []string // oldest first; IDs sort in the order entries were added
+
+	replayMu sync.Mutex // one retry pass at a time, so an entry is not stored twice
+}
+
+// Open loads the queue in dir, creating the directory if needed; it holds at most maxEntries readings
+func Open(dir string, maxEntries int) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir, maxEntries: maxEntries}
+	for _, f := range files {
+		if id, ok := strings.CutSuffix(f.Name(), ".json"); ok && !f.IsDir() {
+			q.ids = append(q.ids, id)
+		}
+	}
+	sort.Strings(q.ids)
+	return q, nil
+}
+
+// Len returns the number of queued readings
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.ids)
+}
+
+// Add queues a reading that failed to store with cause; it returns once the entry is on disk
+func (q *Queue) Add(reading types.LogMessage, source string, cause error) (*Entry, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	entry := &Entry{
+		ID:       fmt.Sprintf("%019d-%s", time.Now().UnixNano(), hex.EncodeToString(b)),
+		Reading:  reading,
+		Source:   source,
+		Error:    cause.Error(),
+		FailedAt: time.Now(),
+	}
+
+	q.mu.Lock()
+	if len(q.ids) >= q.maxEntries {
+		q.mu.Unlock()
+		return nil, ErrFull
+	}
+	// Reserved now, so the limit holds across concurrent adds
+	i := sort.SearchStrings(q.ids, entry.ID)
+	q.ids = append(q.ids[:i], append([]string{entry.ID}, q.ids[i:]...)...)
+	q.mu.Unlock()
+
+	if err := q.write(entry); err != nil {
+		q.forget(entry.ID)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// write stores an entry through a synced temporary file, so a crash leaves the old or the new version
+func (q *Queue) write(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(q.dir, entry.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // a no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path(entry.ID))
+}
+
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *Queue) forget(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := sort.SearchStrings(q.ids, id); i < len(q.ids) && q.ids[i] == id {
+		q.ids = append(q.ids[:i], q.ids[i+1:]...)
+	}
+}
+
+func (q *Queue) has(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := sort.SearchStrings(q.ids, id)
+	return i < len(q.ids) && q.ids[i] == id
+}
+
+// Get returns a queued entry
+func (q *Queue) Get(id string) (*Entry, error) {
+	if !q.has(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(q.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("invalid dead letter %s: %w", id, err)
+	}
+	return &entry, nil
+}
+
+// List returns up to limit entries, oldest first
+func (q *Queue) List(limit int) ([]Entry, error) {
+	entries := []Entry{}
+	for _, id := range q.oldest(limit) {
+		entry, err := q.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			continue // removed meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// oldest returns the IDs of up to limit entries, oldest first (every entry when limit <= 0)
+func (q *Queue) oldest(limit int) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.ids)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	return append([]string(nil), q.ids[:n]...)
+}
+
+// Delete removes an entry without storing it
+func (q *Queue) Delete(id string) error {
+	// Not while it is retried, or a failed retry would write it back
+	q.replayMu.Lock()
+	defer q.replayMu.Unlock()
+	return q.remove(id)
+}
+
+func (q *Queue) remove(id string) error {
+	if !q.has(id) {
+		return ErrNotFound
+	}
+	if err := os.Remove(q.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	q.forget(id)
+	return nil
+}
+
+// Replay retries the given entries (every entry when ids is empty) with store, oldest first, and
+// removes those it stores; failures are recorded on the entries, which stay queued
+func (q *Queue) Replay(ids []string, store func(Entry) error) ReplayResult {
+	q.replayMu.Lock()
+	defer q.replayMu.Unlock()
+
+	var result ReplayResult
+	if len(ids) == 0 {
+		ids = q.oldest(0)
+	}
+	for _, id := range ids {
+		entry, err := q.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			result.Missing = append(result.Missing, id)
+			continue
+		}
+		if err != nil || q.retry(entry, store) != nil {
+			result.Failed++
+			continue
+		}
+		result.Replayed++
+	}
+	return result
+}
+
+// retry stores one entry and returns store's error, recorded on the entry, when it was not stored
+func (q *Queue) retry(entry *Entry, store func(Entry) error) error {
+	err := store(*entry)
+	if err == nil {
+		if err := q.remove(entry.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			// Stored but still on disk; the next retry finds it already stored
+			slog.Error("Failed to remove dead letter", "id", entry.ID, "error", err)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	entry.Attempts++
+	entry.LastAttemptAt = &now
+	entry.LastError = err.Error()
+	entry.Permanent = !apperrors.Retryable(err)
+	if err := q.write(entry); err != nil {
+		slog.Error("Failed to update dead letter", "id", entry.ID, "error", err)
+	}
+	return err
+}
+
+// Start retries the queue every interval, oldest first. A pass stops at the first retryable failure, since
+// the database is most likely still unavailable. Each failed entry then waits twice as long as
+// before its next retry (up to maxRetryBackoff), so later passes move on to the entries behind one
+// that keeps failing. Entries that failed with an error that is not retryable (apperrors.Retryable),
+// or failed maxAttempts retries, are left for Replay (0: retried until they are stored or fail
+// permanently); the pass moves past them
+func (q *Queue) Start(interval time.Duration, maxAttempts int, store func(Entry) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			q.retryPass(interval, maxAttempts, store)
+		}
+	}()
+}
+
+func (q *Queue) retryPass(interval time.Duration, maxAttempts int, store func(Entry) error) {
+	q.replayMu.Lock()
+	defer q.replayMu.Unlock()
+
+	now := time.Now()
+	stored := 0
+	for _, id := range q.oldest(0) {
+		entry, err := q.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			slog.Error("Failed to read dead letter", "id", id, "error", err)
+			continue
+		}
+		if entry.Permanent || (maxAttempts > 0 && entry.Attempts >= maxAttempts) {
+			continue
+		}
+		if entry.LastAttemptAt != nil && now.Before(entry.LastAttemptAt.Add(retryBackoff(interval, entry.Attempts))) {
+			continue
+		}
+		if err := q.retry(entry, store); err != nil {
+			if entry.Permanent {
+				slog.Warn("Dead letter cannot be stored, leaving it for replay", "id", entry.ID, "device_id", entry.Reading.DeviceID, "error", err)
+				continue
+			}
+			slog.Warn("Dead-letter retry failed", "stored", stored, "queued", q.Len(), "error", err)
+			return
+		}
+		stored++
+	}
+	if stored > 0 {
+		slog.Info("Stored dead-lettered readings", "readings", stored)
+	}
+}
+
+// retryBackoff is how long the worker leaves an entry alone after its last failed retry: nothing
+// after the first failure, so the next pass retries it, then the retry interval, doubled with each
+// further failure up to maxRetryBackoff
+func retryBackoff(interval time.Duration, attempts int) time.Duration {
+	if attempts <= 1 {
+		return 0
+	}
+	backoff := interval
+	for i := 2; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
@@ -0,0 +1,117 @@
+// Package errors is the error taxonomy of the internal packages: one sentinel per kind of failure a
+// caller reacts to differently. Packages wrap them into their own errors (ErrNotFound of incidents
+// is "incident not found" and matches both incidents.ErrNotFound and ErrNotFound) or Mark errors
+// they pass on, and the HTTP and WebSocket layers choose status codes with errors.Is instead of
+// answering every failure with a 500
+// Import it as apperrors next to the standard library's errors
+package errors
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrNotFound: the requested resource does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrValidation: the request is invalid; resending it unchanged fails again
+	ErrValidation = errors.New("validation failed")
+	// ErrConflict: the resource exists already or is in a state that does not allow the change
+	ErrConflict = errors.New("conflict")
+	// ErrRateLimited: too many requests or a saturated write path; retry after a back-off
+	ErrRateLimited = errors.New("rate limited")
+	// ErrAIUnavailable: no model is configured or the model provider failed; retry later
+	ErrAIUnavailable = errors.New("AI service unavailable")
+	// ErrDBUnavailable: the database cannot be reached or refuses connections; retry later
+	ErrDBUnavailable = errors.New("database unavailable")
+)
+
+// kinds are the sentinels Kind looks for, most specific first
+var kinds = []error{ErrValidation, ErrNotFound, ErrConflict, ErrRateLimited, ErrAIUnavailable, ErrDBUnavailable}
+
+// marked is an error with a kind added
+type marked struct {
+	err  error
+	kind error
+}
+
+func (m *marked) Error() string   { return m.err.Error() }
+func (m *marked) Unwrap() []error { return []error{m.err, m.kind} }
+
+// Mark adds a kind to err, keeping its message and what it wraps; a nil err stays nil
+func Mark(err, kind error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &marked{err: err, kind: kind}
+}
+
+// Kind returns the sentinel err belongs to, or nil for an unexpected error
+// Database connection failures are ErrDBUnavailable even when no package marked them
+func Kind(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range kinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	if dbUnavailable(err) {
+		return ErrDBUnavailable
+	}
+	return nil
+}
+
+// HTTPStatus is the status code answering an error of err's kind
+func HTTPStatus(err error) int {
+	switch Kind(err) {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrValidation:
+		return http.StatusBadRequest
+	case ErrConflict:
+		return http.StatusConflict
+	case ErrRateLimited:
+		return http.StatusTooManyRequests
+	case ErrAIUnavailable:
+		return http.StatusBadGateway
+	case ErrDBUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// Retryable reports whether the same request may succeed later
+func Retryable(err error) bool {
+	switch Kind(err) {
+	case ErrRateLimited, ErrAIUnavailable, ErrDBUnavailable:
+		return true
+	}
+	return false
+}
+
+// dbUnavailable recognizes the errors of a database that is down, restarting or out of connections
+func dbUnavailable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08: connection exceptions; 53300: too many connections; 57P01-57P03: shutting down or starting up
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "53300" ||
+			pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
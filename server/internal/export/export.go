@@ -0,0 +1,209 @@
+// Package export writes time ranges of sensor_readings to Parquet files for offline analytics,
+// in a local directory or an S3 bucket, so notebooks read columnar files instead of querying the
+// production database
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/parquet"
+	"edge-insights/internal/types"
+)
+
+// Destinations of an export
+const (
+	DestinationLocal = "local"
+	DestinationS3    = "s3"
+)
+
+// Request selects the readings of an export and where it goes
+type Request struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"` // default now
+	DeviceID    string    `json:"device_id,omitempty"`
+	DeviceType  string    `json:"device_type,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Destination string    `json:"destination,omitempty"` // local (default) or s3
+}
+
+// Result is where an export was written
+type Result struct {
+	Destination string `json:"destination"`
+	Location    string `json:"location"` // file path, or s3://bucket/key
+	Rows        int64  `json:"rows"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// columns are the Parquet schema of an export; empty locations, units and metadata are nulls
+var columns = []parquet.Column{
+	{Name: "time", Kind: parquet.Timestamp},
+	{Name: "device_id", Kind: parquet.String},
+	{Name: "device_type", Kind: parquet.String},
+	{Name: "location", Kind: parquet.String, Optional: true},
+	{Name: "raw_value", Kind: parquet.Double, Optional: true},
+	{Name: "unit", Kind: parquet.String, Optional: true},
+	{Name: "log_type", Kind: parquet.String},
+	{Name: "message", Kind: parquet.String},
+	{Name: "ingested_at", Kind: parquet.Timestamp, Optional: true},
+	{Name: "metadata", Kind: parquet.JSON, Optional: true},
+}
+
+// Exporter writes exports to EXPORT_DIR or the bucket in EXPORT_S3_BUCKET
+type Exporter struct {
+	db  *sql.DB
+	dir string
+	s3  *s3Client // nil without EXPORT_S3_BUCKET
+}
+
+// NewExporter creates an exporter from EXPORT_DIR (default "exports") and the EXPORT_S3_*
+// environment variables
+func NewExporter(database *sql.DB) *Exporter {
+	return &Exporter{
+		db:  database,
+		dir: getEnv("EXPORT_DIR", "exports"),
+		s3:  loadS3Client(),
+	}
+}
+
+// Validate checks a request and fills in its defaults
+func (e *Exporter) Validate(req *Request) error {
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+	if req.Start.IsZero() || !req.Start.Before(req.End) {
+		return fmt.Errorf("start (RFC3339) is required and must be before end")
+	}
+	switch req.Destination {
+	case "":
+		req.Destination = DestinationLocal
+	case DestinationLocal:
+	case DestinationS3:
+		if e.s3 == nil {
+			return fmt.Errorf("destination s3 needs EXPORT_S3_BUCKET")
+		}
+	default:
+		return fmt.Errorf("destination must be %q or %q", DestinationLocal, DestinationS3)
+	}
+	return nil
+}
+
+// Run writes the readings of req to a new Parquet file, oldest first. The file is written under
+// a temporary name and only appears at its final name (or in the bucket) once complete
+func (e *Exporter) Run(ctx context.Context, req Request) (*Result, error) {
+	if err := e.Validate(&req); err != nil {
+		return nil, err
+	}
+	name, err := fileName(req)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := e.dir
+	if req.Destination == DestinationS3 {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	tmp := file.Name()
+	defer os.Remove(tmp) // a no-op once renamed
+
+	rows, err := writeReadings(ctx, e.db, file, req)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Destination: req.Destination, Rows: rows, Bytes: info.Size()}
+
+	if req.Destination == DestinationS3 {
+		if result.Location, err = e.s3.upload(ctx, tmp, name); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	if result.Location, err = filepath.Abs(path); err != nil {
+		result.Location = path
+	}
+	return result, nil
+}
+
+// writeReadings streams the readings of req into a Parquet file on w and reports how many it wrote
+func writeReadings(ctx context.Context, database *sql.DB, w *os.File, req Request) (int64, error) {
+	pw, err := parquet.NewWriter(w, columns)
+	if err != nil {
+		return 0, err
+	}
+	var rows int64
+	filter := db.ReadingFilter{DeviceID: req.DeviceID, DeviceType: req.DeviceType, Location: req.Location}
+	err = db.EachReadingBetween(ctx, database, filter, req.Start, req.End, func(r types.LogMessage) error {
+		row := []interface{}{r.Time, r.DeviceID, r.DeviceType, nullable(r.Location), nil, nullable(r.Unit), r.LogType, r.Message, nil, nil}
+		if r.RawValue != nil {
+			row[4] = *r.RawValue
+		}
+		if r.IngestedAt != nil {
+			row[8] = *r.IngestedAt
+		}
+		if len(r.Metadata) > 0 {
+			metadata, err := json.Marshal(r.Metadata)
+			if err != nil {
+				return err
+			}
+			row[9] = metadata
+		}
+		rows++
+		return pw.Write(row)
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, pw.Close()
+}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// fileName names an export after its range, with a random suffix so exports of the same range
+// do not overwrite each other
+func fileName(req Request) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	const layout = "20060102T150405Z"
+	return fmt.Sprintf("sensor_readings_%s_%s_%s.parquet",
+		req.Start.UTC().Format(layout), req.End.UTC().Format(layout), hex.EncodeToString(b)), nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,159 @@
+package export
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// s3Client uploads exports with a single SigV4-signed PUT, which S3 accepts up to 5 GB; larger
+// exports should be split into shorter ranges
+type s3Client struct {
+	bucket       string
+	prefix       string
+	region       string
+	endpoint     string // custom endpoint (MinIO, R2...) addressed path-style; empty for AWS
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// loadS3Client reads EXPORT_S3_BUCKET, EXPORT_S3_PREFIX, EXPORT_S3_REGION (default AWS_REGION,
+// then us-east-1), EXPORT_S3_ENDPOINT and the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN credentials; it returns nil without a bucket
+func loadS3Client() *s3Client {
+	bucket := os.Getenv("EXPORT_S3_BUCKET")
+	if bucket == "" {
+		return nil
+	}
+	return &s3Client{
+		bucket:       bucket,
+		prefix:       strings.Trim(os.Getenv("EXPORT_S3_PREFIX"), "/"),
+		region:       getEnv("EXPORT_S3_REGION", getEnv("AWS_REGION", "us-east-1")),
+		endpoint:     strings.TrimSuffix(os.Getenv("EXPORT_S3_ENDPOINT"), "/"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 30 * time.Minute},
+	}
+}
+
+// upload puts file under name in the bucket and returns its s3:// location
+func (c *s3Client) upload(ctx context.Context, file, name string) (string, error) {
+	key := name
+	if c.prefix != "" {
+		key = c.prefix + "/" + name
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	target := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", c.bucket, c.region, escapePath(key))
+	if c.endpoint != "" {
+		target = fmt.Sprintf("%s/%s/%s", c.endpoint, c.bucket, escapePath(key))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/vnd.apache.parquet")
+	c.sign(req, hex.EncodeToString(hash.Sum(nil)), time.Now().UTC())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("S3 upload failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return "s3://" + c.bucket + "/" + key, nil
+}
+
+// sign adds the AWS Signature Version 4 headers of a request with the given payload hash
+func (c *s3Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	// Signed headers are lower-cased and sorted; these are already in order
+	names := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if c.sessionToken != "" {
+		names = append(names, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+// escapePath escapes each segment of an object key as SigV4 expects
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(s), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
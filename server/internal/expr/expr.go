@@ -0,0 +1,407 @@
+// small arithmetic expression language used for user-defined formulas
+// e.g. "dew_point(t, rh)" or "(a - b) * 1.8"
+
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Func is a function callable from an expression
+type Func func(args ...float64) (float64, error)
+
+// Env supplies variable values and extra functions when evaluating an expression
+type Env struct {
+	Vars  map[string]float64
+	Funcs map[string]Func
+}
+
+// Expr is a compiled expression
+type Expr struct {
+	source string
+	root   node
+}
+
+// String returns the source the expression was compiled from
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Vars returns the variable names referenced by the expression
+func (e *Expr) Vars() []string {
+	seen := make(map[string]bool)
+	var names []string
+	e.root.walk(func(n node) {
+		if v, ok := n.(varNode); ok && !seen[string(v)] {
+			seen[string(v)] = true
+			names = append(names, string(v))
+		}
+	})
+	return names
+}
+
+// Eval evaluates the expression against the environment
+func (e *Expr) Eval(env Env) (float64, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("expression %q produced a non-finite value", e.source)
+	}
+	return v, nil
+}
+
+// builtins are available to every expression
+var builtins = map[string]Func{
+	"abs":   fixed(1, func(a []float64) float64 { return math.Abs(a[0]) }),
+	"sqrt":  fixed(1, func(a []float64) float64 { return math.Sqrt(a[0]) }),
+	"ln":    fixed(1, func(a []float64) float64 { return math.Log(a[0]) }),
+	"log10": fixed(1, func(a []float64) float64 { return math.Log10(a[0]) }),
+	"exp":   fixed(1, func(a []float64) float64 { return math.Exp(a[0]) }),
+	"round": fixed(1, func(a []float64) float64 { return math.Round(a[0]) }),
+	"pow":   fixed(2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }),
+	"min": func(args ...float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("min expects at least 1 argument")
+		}
+		m := args[0]
+		for _, v := range args[1:] {
+			m = math.Min(m, v)
+		}
+		return m, nil
+	},
+	"max": func(args ...float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("max expects at least 1 argument")
+		}
+		m := args[0]
+		for _, v := range args[1:] {
+			m = math.Max(m, v)
+		}
+		return m, nil
+	},
+	// dew_point(temperature_celsius, relative_humidity_percent) using the Magnus formula
+	"dew_point": fixed(2, func(a []float64) float64 {
+		const b, c = 17.62, 243.12
+		gamma := math.Log(a[1]/100) + b*a[0]/(c+a[0])
+		return c * gamma / (b - gamma)
+	}),
+}
+
+func fixed(n int, fn func([]float64) float64) Func {
+	return func(args ...float64) (float64, error) {
+		if len(args) != n {
+			return 0, fmt.Errorf("expected %d argument(s), got %d", n, len(args))
+		}
+		return fn(args), nil
+	}
+}
+
+// Compile parses an expression
+func Compile(source string) (*Expr, error) {
+	p := &parser{tokens: tokenize(source)}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid expression %q: unexpected %q", source, p.tokens[p.pos])
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// --- AST ---
+
+type node interface {
+	eval(env Env) (float64, error)
+	walk(fn func(node))
+}
+
+type numNode float64
+
+func (n numNode) eval(Env) (float64, error) { return float64(n), nil }
+func (n numNode) walk(fn func(node))        { fn(n) }
+
+type varNode string
+
+func (n varNode) eval(env Env) (float64, error) {
+	v, ok := env.Vars[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("unknown variable %q", string(n))
+	}
+	return v, nil
+}
+func (n varNode) walk(fn func(node)) { fn(n) }
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n unaryNode) eval(env Env) (float64, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case "-":
+		return -v, nil
+	case "~":
+		return float64(^int64(v)), nil
+	}
+	return v, nil
+}
+func (n unaryNode) walk(fn func(node)) { fn(n); n.operand.walk(fn) }
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n binaryNode) eval(env Env) (float64, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	case "^":
+		return math.Pow(l, r), nil
+	case "&":
+		return float64(int64(l) & int64(r)), nil
+	case "|":
+		return float64(int64(l) | int64(r)), nil
+	case "<<":
+		return float64(int64(l) << uint(r)), nil
+	case ">>":
+		return float64(int64(l) >> uint(r)), nil
+	}
+	return 0, fmt.Errorf("unknown operator %q", n.op)
+}
+func (n binaryNode) walk(fn func(node)) { fn(n); n.left.walk(fn); n.right.walk(fn) }
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n callNode) eval(env Env) (float64, error) {
+	fn, ok := env.Funcs[n.name]
+	if !ok {
+		fn, ok = builtins[n.name]
+	}
+	if !ok {
+		return 0, fmt.Errorf("unknown function %q", n.name)
+	}
+
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+
+	v, err := fn(args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return v, nil
+}
+func (n callNode) walk(fn func(node)) {
+	fn(n)
+	for _, a := range n.args {
+		a.walk(fn)
+	}
+}
+
+// --- parser (precedence climbing) ---
+
+var precedence = map[string]int{
+	"|": 1, "&": 2,
+	"<<": 3, ">>": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+	"^": 7,
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) parseExpr(minPrec int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek()
+		prec, ok := precedence[op]
+		if !ok || prec < minPrec {
+			return left, nil
+		}
+		p.next()
+
+		// ^ is right-associative, everything else is left-associative
+		nextMin := prec + 1
+		if op == "^" {
+			nextMin = prec
+		}
+		right, err := p.parseExpr(nextMin)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch p.peek() {
+	case "-", "~":
+		op := p.next()
+		operand, err := p.parseExpr(6)
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: op, operand: operand}, nil
+	case "+":
+		p.next()
+		return p.parseExpr(6)
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		inner, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return inner, nil
+	case isNumber(tok):
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			// allow hex literals such as 0xFF for byte manipulation
+			i, ierr := strconv.ParseInt(tok, 0, 64)
+			if ierr != nil {
+				return nil, fmt.Errorf("invalid number %q", tok)
+			}
+			v = float64(i)
+		}
+		return numNode(v), nil
+	case isIdent(tok):
+		if p.peek() != "(" {
+			return varNode(tok), nil
+		}
+		p.next()
+		call := callNode{name: tok}
+		if p.peek() == ")" {
+			p.next()
+			return call, nil
+		}
+		for {
+			arg, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			switch p.next() {
+			case ",":
+				continue
+			case ")":
+				return call, nil
+			default:
+				return nil, fmt.Errorf("expected , or ) in call to %s", tok)
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+func tokenize(source string) []string {
+	var tokens []string
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case (r == '<' || r == '>') && i+1 < len(runes) && runes[i+1] == r:
+			tokens = append(tokens, string(runes[i:i+2]))
+			i += 2
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+func isNumber(tok string) bool {
+	return tok != "" && (unicode.IsDigit(rune(tok[0])) || tok[0] == '.')
+}
+
+func isIdent(tok string) bool {
+	return tok != "" && (unicode.IsLetter(rune(tok[0])) || tok[0] == '_') && !strings.ContainsAny(tok, " ")
+}
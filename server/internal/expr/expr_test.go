@@ -0,0 +1,72 @@
+package expr
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	env := Env{
+		Vars:  map[string]float64{"a": 10, "b": 4, "t": 20, "rh": 50},
+		Funcs: map[string]Func{"double": fixed(1, func(a []float64) float64 { return 2 * a[0] })},
+	}
+	tests := []struct {
+		source string
+		want   float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"(a - b) * 1.8", 10.8},
+		{"-a + b", -6},
+		{"max(a, b, 12)", 12},
+		{"pow(2, 10)", 1024},
+		{"double(b)", 8},
+		{"round(dew_point(t, rh))", 9},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.source)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.source, err)
+		}
+		got, err := e.Eval(env)
+		if err != nil {
+			t.Fatalf("Eval(%q): %v", tt.source, err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Eval(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, source := range []string{"missing + 1", "sqrt(-1)", "1 / 0", "abs(1, 2)", "nope(1)"} {
+		e, err := Compile(source)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", source, err)
+		}
+		if v, err := e.Eval(Env{}); err == nil {
+			t.Errorf("Eval(%q) = %v, want an error", source, v)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, source := range []string{"", "1 +", "(1 + 2", "1 2", "max(1,"} {
+		if _, err := Compile(source); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", source)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	e, err := Compile("a * b + a - max(c, 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := e.Vars()
+	slices.Sort(vars)
+	if !slices.Equal(vars, []string{"a", "b", "c"}) {
+		t.Errorf("Vars() = %v, want [a b c]", vars)
+	}
+}
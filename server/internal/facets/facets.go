@@ -0,0 +1,310 @@
+// Package facets keeps the distinct device types, locations, units, log types and devices of the
+// stored readings with their counts, for filter dropdowns. Stored readings are counted per device
+// and day in memory and flushed to device_facets_daily, so listing the values reads that small
+// table instead of running SELECT DISTINCT over the sensor_readings hypertable
+package facets
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// Count is how many readings carried a value
+type Count struct {
+	Value    string    `json:"value"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Device is a device that stored readings, with the type and location of its latest one
+type Device struct {
+	ID         string    `json:"id"`
+	DeviceType string    `json:"device_type"`
+	Location   string    `json:"location"`
+	Count      int64     `json:"count"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// Values are the distinct values over a range of days, most frequent first
+type Values struct {
+	Start       string   `json:"start"` // first UTC day
+	End         string   `json:"end"`   // last UTC day, inclusive
+	DeviceTypes []Count  `json:"device_types"`
+	Locations   []Count  `json:"locations"`
+	Units       []Count  `json:"units"`
+	LogTypes    []Count  `json:"log_types"`
+	Devices     []Device `json:"devices"`
+}
+
+type key struct {
+	day        string
+	deviceID   string
+	deviceType string
+	location   string
+	unit       string
+	logType    string
+}
+
+type count struct {
+	n        int64
+	lastSeen time.Time
+}
+
+// Catalog counts stored readings per device, day and value combination in memory until the next
+// flush, and caches the values it has read until a flush changes them. Counts not yet flushed are
+// lost on a crash
+type Catalog struct {
+	db      *sql.DB
+	started time.Time // readings ingested before this are counted by Backfill, not Observe
+
+	mu      sync.Mutex
+	pending map[key]*count
+	cache   map[[2]string]*Values
+	flushes int // bumped when the cache is dropped, so values read across a flush are not cached
+}
+
+// NewCatalog creates a catalog over device_facets_daily
+func NewCatalog(db *sql.DB) *Catalog {
+	return &Catalog{
+		db:      db,
+		started: time.Now(),
+		pending: make(map[key]*count),
+		cache:   make(map[[2]string]*Values),
+	}
+}
+
+// Observe counts a stored reading
+func (c *Catalog) Observe(msg types.LogMessage) {
+	at := msg.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	k := key{
+		day:        at.UTC().Format(time.DateOnly),
+		deviceID:   msg.DeviceID,
+		deviceType: msg.DeviceType,
+		location:   msg.Location,
+		unit:       msg.Unit,
+		logType:    msg.LogType,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, ok := c.pending[k]
+	if !ok {
+		n = &count{lastSeen: at}
+		c.pending[k] = n
+	}
+	n.n++
+	if at.After(n.lastSeen) {
+		n.lastSeen = at
+	}
+}
+
+// Start flushes the counts every interval
+func (c *Catalog) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := c.Flush(); err != nil {
+				slog.Error("Failed to write device facets", "error", err)
+			}
+		}
+	}()
+}
+
+// Flush adds the counts observed since the last flush to device_facets_daily in one statement and
+// drops the cached values. On failure the counts are kept for the next flush
+func (c *Catalog) Flush() error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[key]*count)
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var (
+		days, deviceIDs, deviceTypes, locations, units, logTypes []string
+		counts                                                   []int64
+		lastSeen                                                 []time.Time
+	)
+	for k, n := range pending {
+		days = append(days, k.day)
+		deviceIDs = append(deviceIDs, k.deviceID)
+		deviceTypes = append(deviceTypes, k.deviceType)
+		locations = append(locations, k.location)
+		units = append(units, k.unit)
+		logTypes = append(logTypes, k.logType)
+		counts = append(counts, n.n)
+		lastSeen = append(lastSeen, n.lastSeen)
+	}
+
+	_, err := c.db.Exec(`
+        INSERT INTO device_facets_daily (day, device_id, device_type, location, unit, log_type, count, last_seen)
+        SELECT t.day::date, t.device_id, t.device_type, t.location, t.unit, t.log_type, t.count, t.last_seen
+        FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::text[], $7::int8[], $8::timestamptz[])
+            AS t(day, device_id, device_type, location, unit, log_type, count, last_seen)
+        ON CONFLICT (day, device_id, device_type, location, unit, log_type) DO UPDATE SET
+            count = device_facets_daily.count + EXCLUDED.count,
+            last_seen = GREATEST(device_facets_daily.last_seen, EXCLUDED.last_seen)
+    `, days, deviceIDs, deviceTypes, locations, units, logTypes, counts, lastSeen)
+	if err != nil {
+		c.restore(pending)
+		return err
+	}
+
+	c.dropCache()
+	return nil
+}
+
+// restore merges counts that failed to flush back into the pending ones
+func (c *Catalog) restore(pending map[key]*count) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, n := range pending {
+		current, ok := c.pending[k]
+		if !ok {
+			c.pending[k] = n
+			continue
+		}
+		current.n += n.n
+		if n.lastSeen.After(current.lastSeen) {
+			current.lastSeen = n.lastSeen
+		}
+	}
+}
+
+// Backfill counts the readings of the last days days that were ingested before the catalog was
+// created, when device_facets_daily is still empty (the first start with this table); readings
+// ingested since are counted by Observe. It reports how many rows it wrote
+func (c *Catalog) Backfill(ctx context.Context, days int) (int64, error) {
+	var exists bool
+	if err := c.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM device_facets_daily)`).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, nil
+	}
+
+	result, err := c.db.ExecContext(ctx, `
+        INSERT INTO device_facets_daily (day, device_id, device_type, location, unit, log_type, count, last_seen)
+        SELECT (time AT TIME ZONE 'UTC')::date, device_id, device_type, COALESCE(location, ''), COALESCE(unit, ''), log_type,
+               count(*), max(time)
+        FROM sensor_readings
+        WHERE time >= (NOW() AT TIME ZONE 'UTC')::date - $1::int
+          AND COALESCE(ingested_at, time) < $2
+        GROUP BY 1, 2, 3, 4, 5, 6
+        ON CONFLICT (day, device_id, device_type, location, unit, log_type) DO UPDATE SET
+            count = device_facets_daily.count + EXCLUDED.count,
+            last_seen = GREATEST(device_facets_daily.last_seen, EXCLUDED.last_seen)
+    `, days, c.started)
+	if err != nil {
+		return 0, err
+	}
+
+	c.dropCache()
+	return result.RowsAffected()
+}
+
+// Values returns the distinct values of the UTC days start to end (both inclusive), from the
+// cache when nothing was flushed since they were last read
+func (c *Catalog) Values(ctx context.Context, start, end time.Time) (*Values, error) {
+	v := &Values{Start: start.UTC().Format(time.DateOnly), End: end.UTC().Format(time.DateOnly)}
+	cacheKey := [2]string{v.Start, v.End}
+	c.mu.Lock()
+	cached, ok := c.cache[cacheKey]
+	flushes := c.flushes
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	var err error
+	for _, column := range []struct {
+		name   string
+		target *[]Count
+	}{
+		{"device_type", &v.DeviceTypes},
+		{"location", &v.Locations},
+		{"unit", &v.Units},
+		{"log_type", &v.LogTypes},
+	} {
+		if *column.target, err = c.counts(ctx, column.name, v.Start, v.End); err != nil {
+			return nil, err
+		}
+	}
+	if v.Devices, err = c.devices(ctx, v.Start, v.End); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.flushes == flushes {
+		c.cache[cacheKey] = v
+	}
+	c.mu.Unlock()
+	return v, nil
+}
+
+func (c *Catalog) dropCache() {
+	c.mu.Lock()
+	clear(c.cache)
+	c.flushes++
+	c.mu.Unlock()
+}
+
+// counts sums one column's values; column is one of the fixed names passed by Values
+func (c *Catalog) counts(ctx context.Context, column, start, end string) ([]Count, error) {
+	rows, err := c.db.QueryContext(ctx, `
+        SELECT `+column+`, sum(count), max(last_seen)
+        FROM device_facets_daily
+        WHERE day BETWEEN $1::date AND $2::date AND `+column+` <> ''
+        GROUP BY 1
+        ORDER BY 2 DESC, 1
+    `, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []Count{}
+	for rows.Next() {
+		var n Count
+		if err := rows.Scan(&n.Value, &n.Count, &n.LastSeen); err != nil {
+			return nil, err
+		}
+		counts = append(counts, n)
+	}
+	return counts, rows.Err()
+}
+
+func (c *Catalog) devices(ctx context.Context, start, end string) ([]Device, error) {
+	rows, err := c.db.QueryContext(ctx, `
+        SELECT device_id, (array_agg(device_type ORDER BY last_seen DESC))[1], (array_agg(location ORDER BY last_seen DESC))[1],
+               sum(count), max(last_seen)
+        FROM device_facets_daily
+        WHERE day BETWEEN $1::date AND $2::date
+        GROUP BY device_id
+        ORDER BY 4 DESC, device_id
+    `, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		var d Device
+		if err := rows.Scan(&d.ID, &d.DeviceType, &d.Location, &d.Count, &d.LastSeen); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
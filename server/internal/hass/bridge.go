@@ -0,0 +1,188 @@
+package hass
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/mqttclient"
+	"edge-insights/internal/types"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Sink receives readings converted from Home Assistant states
+type Sink func(types.LogMessage) error
+
+// Bridge keeps Home Assistant in sync with Edge Insights devices
+type Bridge struct {
+	db              *sql.DB
+	client          mqtt.Client
+	sink            Sink
+	discoveryPrefix string        // HASS_DISCOVERY_PREFIX, Home Assistant's default is "homeassistant"
+	statePrefix     string        // HASS_STATE_PREFIX for our state topics
+	stateStream     string        // HASS_STATESTREAM_TOPIC, e.g. "homeassistant_statestream/#"; empty disables ingestion
+	interval        time.Duration // how often discovery configs are republished
+	mu              sync.Mutex
+	announced       map[string]bool // device ids with a published discovery config
+}
+
+// NewBridge connects to the configured MQTT broker
+func NewBridge(database *sql.DB, sink Sink) (*Bridge, error) {
+	b := &Bridge{
+		db:              database,
+		sink:            sink,
+		discoveryPrefix: getEnv("HASS_DISCOVERY_PREFIX", "homeassistant"),
+		statePrefix:     getEnv("HASS_STATE_PREFIX", "edge-insights"),
+		stateStream:     os.Getenv("HASS_STATESTREAM_TOPIC"),
+		interval:        10 * time.Minute,
+		announced:       make(map[string]bool),
+	}
+	if d, err := time.ParseDuration(os.Getenv("HASS_DISCOVERY_INTERVAL")); err == nil && d > 0 {
+		b.interval = d
+	}
+
+	client, err := mqttclient.Connect("edge-insights-hass", b.onConnect)
+	if err != nil {
+		return nil, err
+	}
+	b.client = client
+	return b, nil
+}
+
+// Start republishes discovery configs periodically so Home Assistant picks up new devices after restarts
+func (b *Bridge) Start() {
+	go func() {
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			b.announceAll()
+		}
+	}()
+}
+
+// onConnect subscribes to Home Assistant's state stream and announces devices on every (re)connection
+func (b *Bridge) onConnect(client mqtt.Client) {
+	if b.stateStream != "" {
+		client.Subscribe(b.stateStream, 0, b.handleState)
+	}
+	// Home Assistant announces itself on <prefix>/status when it restarts; republish then
+	client.Subscribe(b.discoveryPrefix+"/status", 0, func(_ mqtt.Client, m mqtt.Message) {
+		if string(m.Payload()) == "online" {
+			go b.announceAll()
+		}
+	})
+	go b.announceAll()
+}
+
+// announceAll publishes discovery configs for every device seen in the last day
+func (b *Bridge) announceAll() {
+	devices, err := db.GetKnownDevices(b.db, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		log.Printf("Home Assistant discovery: failed to list devices: %v", err)
+		return
+	}
+	for _, device := range devices {
+		b.announce(device)
+	}
+}
+
+func (b *Bridge) announce(device types.LogMessage) {
+	payload, err := json.Marshal(discoveryConfig(b.statePrefix, device))
+	if err != nil {
+		return
+	}
+	b.client.Publish(discoveryTopic(b.discoveryPrefix, device), 1, true, payload)
+
+	b.mu.Lock()
+	b.announced[device.DeviceID] = true
+	b.mu.Unlock()
+}
+
+// Publish sends a stored reading to its state topic, announcing the device first if it is new
+func (b *Bridge) Publish(msg types.LogMessage) {
+	// Readings that came from Home Assistant are already visible there
+	if strings.HasPrefix(msg.DeviceID, DevicePrefix) {
+		return
+	}
+
+	b.mu.Lock()
+	known := b.announced[msg.DeviceID]
+	b.mu.Unlock()
+	if !known {
+		b.announce(msg)
+	}
+
+	payload, err := json.Marshal(statePayload(msg))
+	if err != nil {
+		return
+	}
+	b.client.Publish(stateTopic(b.statePrefix, msg.DeviceID), 0, true, payload)
+}
+
+// Close disconnects from the broker
+func (b *Bridge) Close() {
+	b.client.Disconnect(250)
+}
+
+// handleState ingests mqtt_statestream messages: <base>/<domain>/<object_id>/state
+func (b *Bridge) handleState(_ mqtt.Client, m mqtt.Message) {
+	parts := strings.Split(m.Topic(), "/")
+	if len(parts) < 4 || parts[len(parts)-1] != "state" {
+		return
+	}
+	domain, object := parts[len(parts)-3], parts[len(parts)-2]
+	if strings.HasPrefix(object, ObjectPrefix) {
+		return
+	}
+
+	msg, ok := stateToLogMessage(domain, object, strings.Trim(string(m.Payload()), `"`))
+	if !ok {
+		return
+	}
+	if err := b.sink(msg); err != nil {
+		log.Printf("Home Assistant state %s.%s not stored: %v", domain, object, err)
+	}
+}
+
+// stateToLogMessage converts an entity state; unavailable/unknown states are skipped
+func stateToLogMessage(domain, object, state string) (types.LogMessage, bool) {
+	msg := types.LogMessage{
+		Time:       time.Now().UTC(),
+		DeviceID:   DevicePrefix + domain + "." + object,
+		DeviceType: domain,
+		LogType:    "INFO",
+		Message:    "Home Assistant state " + domain + "." + object + " = " + state,
+	}
+
+	switch strings.ToLower(state) {
+	case "", "unavailable", "unknown", "none":
+		return msg, false
+	case "on", "open", "home", "detected":
+		value := 1.0
+		msg.RawValue = &value
+		msg.Unit = "boolean"
+	case "off", "closed", "not_home", "clear":
+		value := 0.0
+		msg.RawValue = &value
+		msg.Unit = "boolean"
+	default:
+		if value, err := strconv.ParseFloat(state, 64); err == nil {
+			msg.RawValue = &value
+		}
+	}
+	return msg, true
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,118 @@
+// Home Assistant compatibility over MQTT:
+// publishes discovery configs and state topics for Edge Insights devices, and
+// ingests Home Assistant entity states (mqtt_statestream) as readings
+
+package hass
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"edge-insights/internal/types"
+)
+
+// ObjectPrefix prefixes every entity we publish so our own states are never ingested back
+const ObjectPrefix = "edge_insights_"
+
+// DevicePrefix marks readings ingested from Home Assistant entities
+const DevicePrefix = "hass:"
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// deviceClasses maps platform units onto Home Assistant sensor device classes
+var deviceClasses = map[string]string{
+	"celsius": "temperature",
+	"percent": "humidity",
+	"lux":     "illuminance",
+	"hpa":     "pressure",
+	"volt":    "voltage",
+	"ampere":  "current",
+	"watt":    "power",
+	"kwh":     "energy",
+	"ppm":     "carbon_dioxide",
+}
+
+// unitSymbols maps platform units onto the symbols Home Assistant expects
+var unitSymbols = map[string]string{
+	"celsius": "°C",
+	"percent": "%",
+	"lux":     "lx",
+	"hpa":     "hPa",
+	"volt":    "V",
+	"ampere":  "A",
+	"watt":    "W",
+	"kwh":     "kWh",
+	"ppm":     "ppm",
+}
+
+// objectID turns a device id into a Home Assistant object id
+func objectID(deviceID string) string {
+	return ObjectPrefix + strings.ToLower(unsafeChars.ReplaceAllString(deviceID, "_"))
+}
+
+// component picks the Home Assistant platform for a device
+func component(device types.LogMessage) string {
+	if device.Unit == "boolean" {
+		return "binary_sensor"
+	}
+	return "sensor"
+}
+
+// discoveryTopic is <prefix>/<component>/<object_id>/config
+func discoveryTopic(prefix string, device types.LogMessage) string {
+	return fmt.Sprintf("%s/%s/%s/config", prefix, component(device), objectID(device.DeviceID))
+}
+
+// stateTopic is <state prefix>/<device_id>/state
+func stateTopic(prefix, deviceID string) string {
+	return fmt.Sprintf("%s/%s/state", prefix, unsafeChars.ReplaceAllString(deviceID, "_"))
+}
+
+// discoveryConfig builds the retained discovery payload for a device
+func discoveryConfig(statePrefix string, device types.LogMessage) map[string]interface{} {
+	id := objectID(device.DeviceID)
+	config := map[string]interface{}{
+		"name":                  device.DeviceType,
+		"unique_id":             id,
+		"object_id":             id,
+		"state_topic":           stateTopic(statePrefix, device.DeviceID),
+		"json_attributes_topic": stateTopic(statePrefix, device.DeviceID),
+		"device": map[string]interface{}{
+			"identifiers":    []string{id},
+			"name":           device.DeviceID,
+			"model":          device.DeviceType,
+			"manufacturer":   "Edge Insights",
+			"suggested_area": device.Location,
+		},
+	}
+
+	if component(device) == "binary_sensor" {
+		config["value_template"] = "{{ 'ON' if value_json.value else 'OFF' }}"
+		return config
+	}
+
+	config["value_template"] = "{{ value_json.value }}"
+	config["state_class"] = "measurement"
+	if class, ok := deviceClasses[device.Unit]; ok {
+		config["device_class"] = class
+	}
+	if symbol, ok := unitSymbols[device.Unit]; ok {
+		config["unit_of_measurement"] = symbol
+	} else if device.Unit != "" {
+		config["unit_of_measurement"] = device.Unit
+	}
+	return config
+}
+
+// statePayload is published on the state topic for every stored reading
+func statePayload(msg types.LogMessage) map[string]interface{} {
+	return map[string]interface{}{
+		"value":    msg.RawValue,
+		"unit":     msg.Unit,
+		"log_type": msg.LogType,
+		"message":  msg.Message,
+		"location": msg.Location,
+		"time":     msg.Time,
+	}
+}
@@ -0,0 +1,251 @@
+// outgoing webhooks: every alert raised by a threshold rule and every newly detected anomaly is
+// POSTed as JSON to the configured URLs, signed and retried by the notify webhook notifier
+
+package hooks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+)
+
+// Hook is one outgoing webhook
+type Hook struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"` // signs requests with HMAC-SHA256; optional
+	Events []string `json:"events,omitempty"` // alert and/or anomaly; empty receives both
+	// Severity is the lowest severity delivered: info (default), warning or critical
+	Severity  string    `json:"severity,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate checks the hook and fills in defaults
+func (h *Hook) Validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if _, err := notify.New(h.config()); err != nil {
+		return err
+	}
+	for _, event := range h.Events {
+		if event != notify.EventAlert && event != notify.EventAnomaly {
+			return fmt.Errorf("events must be %s or %s", notify.EventAlert, notify.EventAnomaly)
+		}
+	}
+	switch h.Severity {
+	case "":
+		h.Severity = notify.SeverityInfo
+	case notify.SeverityInfo, notify.SeverityWarning, notify.SeverityCritical:
+	default:
+		return fmt.Errorf("severity must be info, warning or critical")
+	}
+	return nil
+}
+
+func (h *Hook) config() notify.Config {
+	return notify.Config{Type: "webhook", URL: h.URL, Secret: h.Secret}
+}
+
+// wants reports whether the hook receives a notification
+func (h *Hook) wants(n notify.Notification) bool {
+	if severityRank(n.Severity) < severityRank(h.Severity) {
+		return false
+	}
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, event := range h.Events {
+		if event == n.Event {
+			return true
+		}
+	}
+	return false
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case notify.SeverityCritical:
+		return 3
+	case notify.SeverityWarning:
+		return 2
+	}
+	return 1
+}
+
+// Store keeps outgoing webhooks in the outgoing_webhooks table with an in-memory copy
+type Store struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	hooks map[string]*Hook
+}
+
+// NewStore creates a store and loads the existing hooks
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, hooks: make(map[string]*Hook)}
+	return s, s.Load()
+}
+
+// Load (re)reads all hooks from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`SELECT name, settings, updated_at FROM outgoing_webhooks`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	hooks := make(map[string]*Hook)
+	for rows.Next() {
+		var hook Hook
+		var name string
+		var settings []byte
+		if err := rows.Scan(&name, &settings, &hook.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(settings, &hook); err != nil {
+			return fmt.Errorf("invalid settings for %s: %w", name, err)
+		}
+		hook.Name = name
+		if err := hook.Validate(); err != nil {
+			return fmt.Errorf("webhook %s: %w", name, err)
+		}
+		hooks[name] = &hook
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.hooks = hooks
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns every hook sorted by name
+func (s *Store) List() []Hook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Hook, 0, len(s.hooks))
+	for _, hook := range s.hooks {
+		list = append(list, *hook)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Save validates and creates or replaces a hook
+func (s *Store) Save(hook Hook) (*Hook, error) {
+	if err := hook.Validate(); err != nil {
+		return nil, err
+	}
+
+	settings, err := json.Marshal(hook)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO outgoing_webhooks (name, settings, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (name) DO UPDATE SET
+            settings = EXCLUDED.settings,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := s.db.QueryRow(query, hook.Name, settings).Scan(&hook.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save webhook: %w", err)
+	}
+
+	s.mu.Lock()
+	s.hooks[hook.Name] = &hook
+	s.mu.Unlock()
+	return &hook, nil
+}
+
+// Delete removes a hook; it reports false if it did not exist
+func (s *Store) Delete(name string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM outgoing_webhooks WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	s.mu.Lock()
+	delete(s.hooks, name)
+	s.mu.Unlock()
+	return n > 0, nil
+}
+
+// Import saves a batch of hooks (used by configuration bundles)
+func (s *Store) Import(hooks []Hook) (int, error) {
+	for i, hook := range hooks {
+		if _, err := s.Save(hook); err != nil {
+			return i, fmt.Errorf("%s: %w", hook.Name, err)
+		}
+	}
+	return len(hooks), nil
+}
+
+// Dispatch posts a notification to every hook that wants it, in the background
+func (s *Store) Dispatch(n notify.Notification) {
+	if n.Event == "" {
+		n.Event = notify.EventAlert
+	}
+
+	s.mu.RLock()
+	var targets []Hook
+	for _, hook := range s.hooks {
+		if hook.wants(n) {
+			targets = append(targets, *hook)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, hook := range targets {
+		notifier, err := notify.New(hook.config())
+		if err != nil {
+			slog.Error("Invalid webhook", "webhook", hook.Name, "error", err)
+			continue
+		}
+		go func(name string) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := notifier.Notify(ctx, n); err != nil {
+				slog.Error("Failed to deliver webhook", "webhook", name, "event", n.Event, "error", err)
+			}
+		}(hook.Name)
+	}
+}
+
+// AnomalyNotification describes a detected anomaly; device type and location come from the registry
+func AnomalyNotification(a types.Anomaly, deviceType, location string) notify.Notification {
+	severity := notify.SeverityWarning
+	switch a.Severity {
+	case "High":
+		severity = notify.SeverityCritical
+	case "Low":
+		severity = notify.SeverityInfo
+	}
+	return notify.Notification{
+		Event:      notify.EventAnomaly,
+		Title:      fmt.Sprintf("%s anomaly on %s", a.Type, a.DeviceID),
+		Message:    a.Message,
+		Severity:   severity,
+		Source:     "anomaly",
+		DedupKey:   fmt.Sprintf("anomaly:%s:%s:%s", a.DeviceID, a.Type, a.Time.UTC().Format(time.RFC3339Nano)),
+		DeviceID:   a.DeviceID,
+		DeviceType: deviceType,
+		Location:   location,
+		Time:       a.Time,
+		Context:    a.Context,
+	}
+}
@@ -0,0 +1,531 @@
+package incidents
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "edge-insights/internal/errors"
+)
+
+// ErrNotFound is returned for unknown incident IDs
+var ErrNotFound = fmt.Errorf("incident %w", apperrors.ErrNotFound)
+
+// Describer writes an incident's title and summary, e.g. with a language model
+type Describer func(ctx context.Context, incident Incident) (title, summary string, err error)
+
+// Correlator files signals into incidents stored in the incidents and incident_signals tables
+// Active (open and investigating) incidents are kept in memory for matching
+type Correlator struct {
+	db        *sql.DB
+	window    time.Duration
+	mu        sync.Mutex
+	active    map[string]*Incident
+	keys      map[string]string // signal key -> incident ID, for active incidents
+	describe  Describer
+	listeners []func(Incident)
+}
+
+// Filter narrows List; empty fields match everything
+type Filter struct {
+	Status   Status
+	DeviceID string
+	Location string
+	Limit    int
+}
+
+// SignalFilter narrows Signals; empty fields match everything
+type SignalFilter struct {
+	Kind     string
+	Location string
+	Since    time.Time
+	Limit    int // default 100
+}
+
+// Update changes an incident's status, title or note; nil fields are left alone
+type Update struct {
+	Status *Status `json:"status,omitempty"`
+	Title  *string `json:"title,omitempty"`
+	Note   *string `json:"note,omitempty"`
+}
+
+// Validate checks the fields being changed
+func (u Update) Validate() error {
+	if u.Status != nil && !u.Status.Valid() {
+		return fmt.Errorf("status must be open, investigating or resolved")
+	}
+	if u.Title != nil && strings.TrimSpace(*u.Title) == "" {
+		return fmt.Errorf("title cannot be empty")
+	}
+	return nil
+}
+
+// NewCorrelator creates a correlator that groups signals less than window apart and loads the active incidents
+func NewCorrelator(db *sql.DB, window time.Duration) (*Correlator, error) {
+	c := &Correlator{
+		db:     db,
+		window: window,
+		active: make(map[string]*Incident),
+		keys:   make(map[string]string),
+	}
+	return c, c.Load()
+}
+
+// SetDescriber sets what writes incident titles and summaries; without one incidents keep a generated title
+func (c *Correlator) SetDescriber(d Describer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.describe = d
+}
+
+// OnChange registers fn to be called with every created or changed incident
+func (c *Correlator) OnChange(fn func(Incident)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+// Load (re)reads the active incidents and the keys of their signals
+func (c *Correlator) Load() error {
+	rows, err := c.db.Query(incidentColumns + ` WHERE status IN ('open', 'investigating')`)
+	if err != nil {
+		return err
+	}
+	active := make(map[string]*Incident)
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		active[incident.ID] = incident
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	keyRows, err := c.db.Query(`
+        SELECT s.key, s.incident_id
+        FROM incident_signals s JOIN incidents i ON i.id = s.incident_id
+        WHERE i.status IN ('open', 'investigating')
+    `)
+	if err != nil {
+		return err
+	}
+	defer keyRows.Close()
+	keys := make(map[string]string)
+	for keyRows.Next() {
+		var key, id string
+		if err := keyRows.Scan(&key, &id); err != nil {
+			return err
+		}
+		keys[key] = id
+	}
+	if err := keyRows.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.active = active
+	c.keys = keys
+	c.mu.Unlock()
+	return nil
+}
+
+// Record files a signal into the related active incident, or opens a new one
+// A signal already recorded only updates its resolution; it returns nil then
+func (c *Correlator) Record(s Signal) (*Incident, error) {
+	c.mu.Lock()
+
+	var exists bool
+	if err := c.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM incident_signals WHERE key = $1)`, s.Key).Scan(&exists); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	if exists {
+		var err error
+		if s.ResolvedAt != nil {
+			_, err = c.db.Exec(`UPDATE incident_signals SET resolved_at = $2 WHERE key = $1`, s.Key, s.ResolvedAt)
+		}
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	// Join the related incident seen most recently
+	var incident *Incident
+	for _, candidate := range c.active {
+		if candidate.related(s, c.window) && (incident == nil || candidate.LastSeen.After(incident.LastSeen)) {
+			incident = candidate
+		}
+	}
+
+	created := incident == nil
+	var updated Incident
+	if created {
+		id, err := newID()
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		updated = Incident{ID: id, Status: StatusOpen, DeviceIDs: []string{}, Locations: []string{}}
+	} else {
+		updated = incident.clone()
+	}
+	autoTitle := updated.Title == "" || updated.Title == updated.defaultTitle()
+	updated.add(s)
+	if autoTitle {
+		updated.Title = updated.defaultTitle()
+	}
+
+	if err := c.save(&updated, &s); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.active[updated.ID] = &updated
+	c.keys[s.Key] = updated.ID
+	describe := c.describe != nil && isPowerOfTwo(updated.SignalCount)
+	c.mu.Unlock()
+
+	c.notify(updated)
+	// Titles are refreshed as the incident grows (1, 2, 4, 8... signals), not on every signal
+	if describe {
+		go func(id string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if _, err := c.Describe(ctx, id); err != nil {
+				slog.Error("Failed to describe incident", "incident_id", id, "error", err)
+			}
+		}(updated.ID)
+	}
+	return &updated, nil
+}
+
+// save writes the incident and its new signal in one transaction
+func (c *Correlator) save(incident *Incident, s *Signal) error {
+	deviceIDs, err := json.Marshal(incident.DeviceIDs)
+	if err != nil {
+		return err
+	}
+	locations, err := json.Marshal(incident.Locations)
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+        INSERT INTO incidents (id, title, status, severity, device_ids, locations, signal_count, first_seen, last_seen)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (id) DO UPDATE SET
+            title = EXCLUDED.title,
+            severity = EXCLUDED.severity,
+            device_ids = EXCLUDED.device_ids,
+            locations = EXCLUDED.locations,
+            signal_count = EXCLUDED.signal_count,
+            first_seen = EXCLUDED.first_seen,
+            last_seen = EXCLUDED.last_seen,
+            updated_at = NOW()
+        RETURNING created_at, updated_at
+    `, incident.ID, incident.Title, incident.Status, incident.Severity, deviceIDs, locations,
+		incident.SignalCount, incident.FirstSeen, incident.LastSeen).Scan(&incident.CreatedAt, &incident.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save incident: %w", err)
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO incident_signals (key, incident_id, kind, source, type, severity, device_id, device_type, location, message, time, resolved_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+    `, s.Key, incident.ID, s.Kind, s.Source, s.Type, s.Severity, s.DeviceID, s.DeviceType, s.Location,
+		s.Message, s.Time, s.ResolvedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save incident signal: %w", err)
+	}
+	return tx.Commit()
+}
+
+// List returns incidents, most recently active first
+func (c *Correlator) List(f Filter) ([]Incident, error) {
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	rows, err := c.db.Query(incidentColumns+`
+        WHERE ($1 = '' OR status = $1)
+          AND ($2 = '' OR device_ids @> jsonb_build_array($2::text))
+          AND ($3 = '' OR locations @> jsonb_build_array($3::text))
+        ORDER BY last_seen DESC
+        LIMIT $4
+    `, string(f.Status), f.DeviceID, f.Location, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *incident)
+	}
+	return list, rows.Err()
+}
+
+// Signals returns recorded signals matching f, most recent first
+func (c *Correlator) Signals(ctx context.Context, f SignalFilter) ([]Signal, error) {
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	rows, err := c.db.QueryContext(ctx, `
+        SELECT key, kind, source, type, severity, device_id, device_type, location, message, time, resolved_at
+        FROM incident_signals
+        WHERE ($1 = '' OR kind = $1)
+          AND ($2 = '' OR location = $2)
+          AND time >= $3
+        ORDER BY time DESC
+        LIMIT $4
+    `, f.Kind, f.Location, f.Since, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Signal{}
+	for rows.Next() {
+		var s Signal
+		if err := rows.Scan(&s.Key, &s.Kind, &s.Source, &s.Type, &s.Severity, &s.DeviceID, &s.DeviceType,
+			&s.Location, &s.Message, &s.Time, &s.ResolvedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// Get returns an incident with its signals
+func (c *Correlator) Get(id string) (*Incident, error) {
+	incident, err := scanIncident(c.db.QueryRow(incidentColumns+` WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(`
+        SELECT key, kind, source, type, severity, device_id, device_type, location, message, time, resolved_at
+        FROM incident_signals
+        WHERE incident_id = $1
+        ORDER BY time
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incident.Signals = []Signal{}
+	for rows.Next() {
+		var s Signal
+		if err := rows.Scan(&s.Key, &s.Kind, &s.Source, &s.Type, &s.Severity, &s.DeviceID, &s.DeviceType,
+			&s.Location, &s.Message, &s.Time, &s.ResolvedAt); err != nil {
+			return nil, err
+		}
+		incident.Signals = append(incident.Signals, s)
+	}
+	return incident, rows.Err()
+}
+
+// ForSignal returns the incident a signal was filed into, with its signals
+func (c *Correlator) ForSignal(key string) (*Incident, error) {
+	var id string
+	err := c.db.QueryRow(`SELECT incident_id FROM incident_signals WHERE key = $1`, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(id)
+}
+
+// Apply changes an incident's status, title or note
+// Resolving stops new signals from joining it; reopening a resolved incident lets them join again
+func (c *Correlator) Apply(id string, u Update) (*Incident, error) {
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+
+	var status *string
+	if u.Status != nil {
+		s := string(*u.Status)
+		status = &s
+	}
+
+	c.mu.Lock()
+	incident, err := scanIncident(c.db.QueryRow(`
+        UPDATE incidents SET
+            status = COALESCE($2, status),
+            title = COALESCE($3, title),
+            note = COALESCE($4, note),
+            resolved_at = CASE
+                WHEN $2 = 'resolved' AND status <> 'resolved' THEN NOW()
+                WHEN $2 IN ('open', 'investigating') THEN NULL
+                ELSE resolved_at END,
+            updated_at = NOW()
+        WHERE id = $1
+        RETURNING `+incidentFields, id, status, u.Title, u.Note))
+	if err == sql.ErrNoRows {
+		c.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	_, wasActive := c.active[id]
+	switch {
+	case incident.Status.Active() && !wasActive:
+		c.active[id] = incident
+		if err := c.loadKeysLocked(id); err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+	case incident.Status.Active():
+		c.active[id] = incident
+	case wasActive:
+		delete(c.active, id)
+		for key, owner := range c.keys {
+			if owner == id {
+				delete(c.keys, key)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	c.notify(*incident)
+	return incident, nil
+}
+
+// Describe has the describer write the incident's title and summary from its signals
+func (c *Correlator) Describe(ctx context.Context, id string) (*Incident, error) {
+	c.mu.Lock()
+	describe := c.describe
+	c.mu.Unlock()
+	if describe == nil {
+		return nil, fmt.Errorf("no incident describer configured")
+	}
+
+	incident, err := c.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	title, summary, err := describe(ctx, *incident)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" {
+		title = incident.Title
+	}
+
+	c.mu.Lock()
+	updated, err := scanIncident(c.db.QueryRowContext(ctx, `
+        UPDATE incidents SET title = $2, summary = $3, updated_at = NOW()
+        WHERE id = $1
+        RETURNING `+incidentFields, id, title, summary))
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	if _, ok := c.active[id]; ok {
+		c.active[id] = updated
+	}
+	c.mu.Unlock()
+
+	c.notify(*updated)
+	updated.Signals = incident.Signals
+	return updated, nil
+}
+
+func (c *Correlator) loadKeysLocked(id string) error {
+	rows, err := c.db.Query(`SELECT key FROM incident_signals WHERE incident_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return err
+		}
+		c.keys[key] = id
+	}
+	return rows.Err()
+}
+
+func (c *Correlator) notify(incident Incident) {
+	c.mu.Lock()
+	listeners := c.listeners
+	c.mu.Unlock()
+	for _, fn := range listeners {
+		fn(incident)
+	}
+}
+
+// clone copies an incident so the active one is only replaced once the change is saved
+func (i *Incident) clone() Incident {
+	copied := *i
+	copied.DeviceIDs = append([]string(nil), i.DeviceIDs...)
+	copied.Locations = append([]string(nil), i.Locations...)
+	return copied
+}
+
+const incidentFields = `id, title, summary, status, severity, device_ids, locations, signal_count,
+        first_seen, last_seen, note, created_at, updated_at, resolved_at`
+
+const incidentColumns = `SELECT ` + incidentFields + ` FROM incidents`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIncident(row scanner) (*Incident, error) {
+	var incident Incident
+	var deviceIDs, locations []byte
+	if err := row.Scan(&incident.ID, &incident.Title, &incident.Summary, &incident.Status, &incident.Severity,
+		&deviceIDs, &locations, &incident.SignalCount, &incident.FirstSeen, &incident.LastSeen, &incident.Note,
+		&incident.CreatedAt, &incident.UpdatedAt, &incident.ResolvedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(deviceIDs, &incident.DeviceIDs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(locations, &incident.Locations); err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+func newID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,205 @@
+// groups alerts and anomalies that happen close together in time and space into incidents,
+// so operators work through a few incidents instead of every alert behind them
+// an incident moves from open to investigating to resolved; a signal never joins a resolved incident
+
+package incidents
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+)
+
+// Status is an incident's lifecycle state
+type Status string
+
+const (
+	StatusOpen          Status = "open"
+	StatusInvestigating Status = "investigating"
+	StatusResolved      Status = "resolved"
+)
+
+// Valid reports whether s is a known status
+func (s Status) Valid() bool {
+	return s == StatusOpen || s == StatusInvestigating || s == StatusResolved
+}
+
+// Active reports whether new signals can still join an incident in this state
+func (s Status) Active() bool {
+	return s == StatusOpen || s == StatusInvestigating
+}
+
+// Signal kinds
+const (
+	KindAlert   = "alert"
+	KindAnomaly = "anomaly"
+)
+
+// Signal is one alert or anomaly in an incident
+type Signal struct {
+	Key        string     `json:"key"` // identifies the signal so repeats are recorded once
+	Kind       string     `json:"kind"`
+	Source     string     `json:"source,omitempty"` // subsystem of an alert, e.g. "vitals"
+	Type       string     `json:"type"`             // alert kind or anomaly type
+	Severity   string     `json:"severity"`         // info, warning or critical
+	DeviceID   string     `json:"device_id"`
+	DeviceType string     `json:"device_type,omitempty"`
+	Location   string     `json:"location,omitempty"`
+	Message    string     `json:"message"`
+	Time       time.Time  `json:"time"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// AlertSignal converts an alert event; its key is stable across the alert firing and resolving
+func AlertSignal(a types.AlertEvent) Signal {
+	return Signal{
+		Key:        fmt.Sprintf("alert:%s:%s:%s:%s", a.Source, a.Rule, a.DeviceID, a.Since.UTC().Format(time.RFC3339Nano)),
+		Kind:       KindAlert,
+		Source:     a.Source,
+		Type:       a.Kind,
+		Severity:   normalizeSeverity(a.Severity),
+		DeviceID:   a.DeviceID,
+		DeviceType: a.DeviceType,
+		Location:   a.Location,
+		Message:    a.Message,
+		Time:       a.Since,
+		ResolvedAt: a.ResolvedAt,
+	}
+}
+
+// AnomalySignal converts a detected anomaly; device type and location come from the registry
+func AnomalySignal(a types.Anomaly, deviceType, location string) Signal {
+	return Signal{
+		Key:        fmt.Sprintf("anomaly:%s:%s:%s", a.DeviceID, a.Type, a.Time.UTC().Format(time.RFC3339Nano)),
+		Kind:       KindAnomaly,
+		Type:       a.Type,
+		Severity:   normalizeSeverity(a.Severity),
+		DeviceID:   a.DeviceID,
+		DeviceType: deviceType,
+		Location:   location,
+		Message:    a.Message,
+		Time:       a.Time,
+	}
+}
+
+// Incident is a group of related signals
+type Incident struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Summary     string     `json:"summary"`
+	Status      Status     `json:"status"`
+	Severity    string     `json:"severity"` // highest severity of its signals
+	DeviceIDs   []string   `json:"device_ids"`
+	Locations   []string   `json:"locations"`
+	SignalCount int        `json:"signal_count"`
+	FirstSeen   time.Time  `json:"first_seen"`
+	LastSeen    time.Time  `json:"last_seen"`
+	Note        string     `json:"note,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	// Signals is only filled by Correlator.Get
+	Signals []Signal `json:"signals,omitempty"`
+}
+
+// related reports whether a signal is close enough to the incident to join it:
+// within window of its last signal and on one of its devices or at one of its locations
+func (i *Incident) related(s Signal, window time.Duration) bool {
+	if s.Time.Before(i.FirstSeen.Add(-window)) || s.Time.After(i.LastSeen.Add(window)) {
+		return false
+	}
+	return contains(i.DeviceIDs, s.DeviceID) || (s.Location != "" && contains(i.Locations, s.Location))
+}
+
+// add folds a signal into the incident's devices, locations, severity and time span
+func (i *Incident) add(s Signal) {
+	if !contains(i.DeviceIDs, s.DeviceID) {
+		i.DeviceIDs = append(i.DeviceIDs, s.DeviceID)
+		sort.Strings(i.DeviceIDs)
+	}
+	if s.Location != "" && !contains(i.Locations, s.Location) {
+		i.Locations = append(i.Locations, s.Location)
+		sort.Strings(i.Locations)
+	}
+	if severityRank(s.Severity) > severityRank(i.Severity) {
+		i.Severity = s.Severity
+	}
+	if i.FirstSeen.IsZero() || s.Time.Before(i.FirstSeen) {
+		i.FirstSeen = s.Time
+	}
+	if s.Time.After(i.LastSeen) {
+		i.LastSeen = s.Time
+	}
+	i.SignalCount++
+}
+
+// defaultTitle names an incident until (or unless) an AI title is generated
+// e.g. "3 signals on 2 devices in freezer-room"
+func (i *Incident) defaultTitle() string {
+	where := strings.Join(i.Locations, ", ")
+	if where == "" {
+		where = strings.Join(i.DeviceIDs, ", ")
+	}
+	signals := "signals"
+	if i.SignalCount == 1 {
+		signals = "signal"
+	}
+	devices := "devices"
+	if len(i.DeviceIDs) == 1 {
+		devices = "device"
+	}
+	return fmt.Sprintf("%d %s on %d %s in %s", i.SignalCount, signals, len(i.DeviceIDs), devices, where)
+}
+
+// normalizeSeverity maps anomaly severities (Low/Medium/High) onto the alert scale
+func normalizeSeverity(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical", "high":
+		return notify.SeverityCritical
+	case "info", "low":
+		return notify.SeverityInfo
+	default:
+		return notify.SeverityWarning
+	}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case notify.SeverityCritical:
+		return 3
+	case notify.SeverityWarning:
+		return 2
+	case notify.SeverityInfo:
+		return 1
+	}
+	return 0
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the live-feed payload for the incident
+func (i Incident) Event() types.IncidentEvent {
+	return types.IncidentEvent{
+		ID:          i.ID,
+		Title:       i.Title,
+		Status:      string(i.Status),
+		Severity:    i.Severity,
+		DeviceIDs:   i.DeviceIDs,
+		Locations:   i.Locations,
+		SignalCount: i.SignalCount,
+		FirstSeen:   i.FirstSeen,
+		LastSeen:    i.LastSeen,
+		ResolvedAt:  i.ResolvedAt,
+	}
+}
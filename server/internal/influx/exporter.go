@@ -0,0 +1,212 @@
+package influx
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"edge-insights/internal/db"
+)
+
+// maxDatagram keeps UDP packets under a typical MTU
+const maxDatagram = 1400
+
+// Exporter periodically writes completed aggregate buckets to an Influx-compatible endpoint
+type Exporter struct {
+	db          *sql.DB
+	endpoint    *url.URL
+	token       string          // INFLUX_EXPORT_TOKEN, sent as "Authorization: Token ..." over HTTP
+	view        string          // INFLUX_EXPORT_VIEW (five_min, hourly, daily)
+	measurement string          // INFLUX_EXPORT_MEASUREMENT
+	deviceTypes map[string]bool // INFLUX_EXPORT_DEVICE_TYPES; empty exports everything
+	interval    time.Duration   // INFLUX_EXPORT_INTERVAL
+	settle      time.Duration   // wait for continuous aggregate refreshes before exporting a bucket
+	watermark   time.Time       // buckets starting before this have been exported
+	client      *http.Client
+}
+
+// NewExporter creates an exporter from INFLUX_EXPORT_* environment variables
+// The URL is http(s)://host:8086/api/v2/write?org=..&bucket=.. for InfluxDB, or
+// tcp://host:8094 / udp://host:8094 for a Telegraf socket_listener
+func NewExporter(database *sql.DB) (*Exporter, error) {
+	endpoint, err := url.Parse(os.Getenv("INFLUX_EXPORT_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid INFLUX_EXPORT_URL: %w", err)
+	}
+	switch endpoint.Scheme {
+	case "http", "https", "tcp", "udp":
+	default:
+		return nil, fmt.Errorf("INFLUX_EXPORT_URL must use http, https, tcp or udp")
+	}
+
+	e := &Exporter{
+		db:          database,
+		endpoint:    endpoint,
+		token:       os.Getenv("INFLUX_EXPORT_TOKEN"),
+		view:        getEnv("INFLUX_EXPORT_VIEW", "five_min"),
+		measurement: getEnv("INFLUX_EXPORT_MEASUREMENT", "sensor_aggregates"),
+		deviceTypes: make(map[string]bool),
+		interval:    time.Minute,
+		settle:      2 * time.Minute,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	if _, ok := db.AggregateBucketWidth(e.view); !ok {
+		return nil, fmt.Errorf("unknown INFLUX_EXPORT_VIEW %q", e.view)
+	}
+	if d, err := time.ParseDuration(os.Getenv("INFLUX_EXPORT_INTERVAL")); err == nil && d > 0 {
+		e.interval = d
+	}
+	for _, t := range strings.Split(os.Getenv("INFLUX_EXPORT_DEVICE_TYPES"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			e.deviceTypes[t] = true
+		}
+	}
+
+	// Re-export the last day after a restart; Influx overwrites identical points, so this is idempotent
+	width, _ := db.AggregateBucketWidth(e.view)
+	lookback := 24 * time.Hour
+	if width > lookback {
+		lookback = width
+	}
+	e.watermark = time.Now().Add(-lookback).Truncate(width)
+	return e, nil
+}
+
+// Start runs the export loop in the background
+func (e *Exporter) Start() {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			if err := e.ExportOnce(); err != nil {
+				log.Printf("Influx export failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// ExportOnce writes every bucket completed since the last successful export
+func (e *Exporter) ExportOnce() error {
+	width, _ := db.AggregateBucketWidth(e.view)
+
+	// Only buckets that have closed and had time to be materialized
+	end := time.Now().Add(-e.settle).Truncate(width)
+	if !end.After(e.watermark) {
+		return nil
+	}
+
+	buckets, err := db.GetAggregatesBetween(e.db, e.view, e.watermark, end)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, b := range buckets {
+		if len(e.deviceTypes) > 0 && !e.deviceTypes[b.DeviceType] {
+			continue
+		}
+		lines = append(lines, Line(e.measurement, b))
+	}
+
+	if len(lines) > 0 {
+		if err := e.write(lines); err != nil {
+			return err
+		}
+		log.Printf("Exported %d %s aggregate(s) to Influx", len(lines), e.view)
+	}
+	e.watermark = end
+	return nil
+}
+
+func (e *Exporter) write(lines []string) error {
+	switch e.endpoint.Scheme {
+	case "tcp":
+		return e.writeTCP(lines)
+	case "udp":
+		return e.writeUDP(lines)
+	}
+	return e.writeHTTP(lines)
+}
+
+func (e *Exporter) writeHTTP(lines []string) error {
+	endpoint := *e.endpoint
+	query := endpoint.Query()
+	if query.Get("precision") == "" {
+		query.Set("precision", "ns")
+	}
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.String(), strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influx write returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+func (e *Exporter) writeTCP(lines []string) error {
+	conn, err := net.DialTimeout("tcp", e.endpoint.Host, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	_, err = io.WriteString(conn, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+func (e *Exporter) writeUDP(lines []string) error {
+	conn, err := net.Dial("udp", e.endpoint.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Pack as many whole lines as fit in each datagram
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > maxDatagram {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		packet.WriteString(line)
+		packet.WriteByte('\n')
+	}
+	if packet.Len() > 0 {
+		_, err = conn.Write(packet.Bytes())
+	}
+	return err
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
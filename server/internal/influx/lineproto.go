@@ -0,0 +1,41 @@
+// pushes aggregate buckets to InfluxDB or a Telegraf socket_listener in line protocol,
+// so an existing Influx/Telegraf stack keeps receiving data during migration
+
+package influx
+
+import (
+	"strconv"
+	"strings"
+
+	"edge-insights/internal/db"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// Line formats one aggregate bucket:
+// <measurement>,device_type=..,location=.. avg=..,min=..,max=..,count=..i <unix ns>
+func Line(measurement string, b db.AggregateBucket) string {
+	var sb strings.Builder
+	sb.WriteString(measurementEscaper.Replace(measurement))
+	sb.WriteString(",device_type=")
+	sb.WriteString(tagEscaper.Replace(b.DeviceType))
+	// Influx rejects empty tag values, so the tag is omitted instead
+	if b.Location != "" {
+		sb.WriteString(",location=")
+		sb.WriteString(tagEscaper.Replace(b.Location))
+	}
+	sb.WriteString(" avg=")
+	sb.WriteString(strconv.FormatFloat(b.AvgValue, 'f', -1, 64))
+	sb.WriteString(",min=")
+	sb.WriteString(strconv.FormatFloat(b.MinValue, 'f', -1, 64))
+	sb.WriteString(",max=")
+	sb.WriteString(strconv.FormatFloat(b.MaxValue, 'f', -1, 64))
+	sb.WriteString(",count=")
+	sb.WriteString(strconv.FormatInt(b.ReadingCount, 10))
+	sb.WriteString("i ")
+	sb.WriteString(strconv.FormatInt(b.Bucket.UnixNano(), 10))
+	return sb.String()
+}
@@ -0,0 +1,106 @@
+package decoder
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// lppType describes one Cayenne Low Power Payload data type
+type lppType struct {
+	name   string
+	size   int     // bytes per value
+	scale  float64 // value = raw / scale
+	signed bool
+	unit   string
+	axes   []string // multi-value types (accelerometer, gyrometer)
+}
+
+// lppTypes follows the Cayenne LPP specification (including the commonly used extended types)
+var lppTypes = map[byte]lppType{
+	0:   {name: "digital_input", size: 1, scale: 1, unit: "boolean"},
+	1:   {name: "digital_output", size: 1, scale: 1, unit: "boolean"},
+	2:   {name: "analog_input", size: 2, scale: 100, signed: true},
+	3:   {name: "analog_output", size: 2, scale: 100, signed: true},
+	100: {name: "generic", size: 4, scale: 1},
+	101: {name: "illuminance", size: 2, scale: 1, unit: "lux"},
+	102: {name: "presence", size: 1, scale: 1, unit: "boolean"},
+	103: {name: "temperature", size: 2, scale: 10, signed: true, unit: "celsius"},
+	104: {name: "humidity", size: 1, scale: 2, unit: "percent"},
+	113: {name: "accelerometer", size: 2, scale: 1000, signed: true, unit: "g", axes: []string{"x", "y", "z"}},
+	115: {name: "barometer", size: 2, scale: 10, unit: "hpa"},
+	116: {name: "voltage", size: 2, scale: 100, unit: "volt"},
+	117: {name: "current", size: 2, scale: 1000, unit: "ampere"},
+	118: {name: "frequency", size: 4, scale: 1, unit: "hertz"},
+	120: {name: "percentage", size: 1, scale: 1, unit: "percent"},
+	121: {name: "altitude", size: 2, scale: 1, signed: true, unit: "meter"},
+	125: {name: "concentration", size: 2, scale: 1, unit: "ppm"},
+	128: {name: "power", size: 2, scale: 1, unit: "watt"},
+	130: {name: "distance", size: 4, scale: 1000, unit: "meter"},
+	131: {name: "energy", size: 4, scale: 1000, unit: "kwh"},
+	132: {name: "direction", size: 2, scale: 1, unit: "degree"},
+	133: {name: "unix_time", size: 4, scale: 1, unit: "seconds"},
+	134: {name: "gyrometer", size: 2, scale: 100, signed: true, unit: "degree_per_second", axes: []string{"x", "y", "z"}},
+	136: {name: "gps", size: 3}, // handled separately: latitude, longitude, altitude
+}
+
+// DecodeCayenneLPP decodes a Cayenne LPP payload; values are named <type>_<channel>, e.g. temperature_1
+func DecodeCayenneLPP(payload []byte, _ int) ([]Value, error) {
+	var values []Value
+	for i := 0; i < len(payload); {
+		if i+2 > len(payload) {
+			return nil, fmt.Errorf("truncated header at byte %d", i)
+		}
+		channel := strconv.Itoa(int(payload[i]))
+		code := payload[i+1]
+		i += 2
+
+		t, ok := lppTypes[code]
+		if !ok {
+			return nil, fmt.Errorf("unknown LPP type %d on channel %s", code, channel)
+		}
+
+		// GPS packs three 3-byte signed fields with different scales
+		if code == 136 {
+			if i+9 > len(payload) {
+				return nil, fmt.Errorf("truncated gps value on channel %s", channel)
+			}
+			values = append(values,
+				Value{Name: "latitude_" + channel, Value: float64(readInt(payload[i:i+3], true)) / 10000, Unit: "degree"},
+				Value{Name: "longitude_" + channel, Value: float64(readInt(payload[i+3:i+6], true)) / 10000, Unit: "degree"},
+				Value{Name: "gps_altitude_" + channel, Value: float64(readInt(payload[i+6:i+9], true)) / 100, Unit: "meter"},
+			)
+			i += 9
+			continue
+		}
+
+		axes := t.axes
+		if axes == nil {
+			axes = []string{""}
+		}
+		if i+t.size*len(axes) > len(payload) {
+			return nil, fmt.Errorf("truncated %s value on channel %s", t.name, channel)
+		}
+		for _, axis := range axes {
+			name := t.name + "_" + channel
+			if axis != "" {
+				name = t.name + "_" + axis + "_" + channel
+			}
+			raw := readInt(payload[i:i+t.size], t.signed)
+			values = append(values, Value{Name: name, Value: float64(raw) / t.scale, Unit: t.unit})
+			i += t.size
+		}
+	}
+	return values, nil
+}
+
+// readInt reads a big-endian integer, sign-extending it when signed is set
+func readInt(b []byte, signed bool) int64 {
+	var v int64
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	if signed && len(b) > 0 && b[0]&0x80 != 0 {
+		v -= 1 << (8 * uint(len(b)))
+	}
+	return v
+}
@@ -0,0 +1,100 @@
+// turns binary LoRaWAN uplink payloads into named sensor values
+// decoders are looked up by device profile during webhook ingestion
+
+package decoder
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Value is one measurement extracted from a payload
+type Value struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// Decoder converts a raw uplink payload (and its LoRaWAN FPort) into values
+type Decoder interface {
+	Decode(payload []byte, fPort int) ([]Value, error)
+}
+
+// DecoderFunc adapts a function to the Decoder interface
+type DecoderFunc func(payload []byte, fPort int) ([]Value, error)
+
+// Decode calls f
+func (f DecoderFunc) Decode(payload []byte, fPort int) ([]Value, error) {
+	return f(payload, fPort)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Decoder{
+		"cayenne_lpp": DecoderFunc(DecodeCayenneLPP),
+	}
+)
+
+// Register adds a built-in decoder under name, replacing any existing one
+func Register(name string, d Decoder) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = d
+}
+
+// Lookup returns the built-in decoder registered under name
+func Lookup(name string) (Decoder, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	d, ok := registry[name]
+	return d, ok
+}
+
+// Builtins returns the names of the registered decoders
+func Builtins() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Payload encodings used by network servers
+const (
+	EncodingBase64 = "base64" // TTN, ChirpStack
+	EncodingHex    = "hex"
+)
+
+// ValidEncoding reports whether encoding is a payload encoding; empty means base64
+func ValidEncoding(encoding string) bool {
+	return encoding == "" || encoding == EncodingBase64 || encoding == EncodingHex
+}
+
+// DecodePayload parses a payload in the given encoding (empty means base64). The encoding is not
+// guessed, since many hex strings are valid base64 too
+func DecodePayload(encoded, encoding string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	switch encoding {
+	case "", EncodingBase64:
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("payload is not base64: %w", err)
+		}
+		return data, nil
+	case EncodingHex:
+		data, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(encoded), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("payload is not hex: %w", err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown payload encoding %q", encoding)
+}
@@ -0,0 +1,122 @@
+package decoder
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestDecodePayload(t *testing.T) {
+	want := []byte{0x03, 0x67, 0x01, 0x10}
+	tests := []struct {
+		encoded, encoding string
+	}{
+		{"A2cBEA==", ""},
+		{"A2cBEA==", EncodingBase64},
+		{"03670110", EncodingHex},
+		{"0x03670110", EncodingHex},
+		{" 03670110 ", EncodingHex},
+	}
+	for _, tt := range tests {
+		got, err := DecodePayload(tt.encoded, tt.encoding)
+		if err != nil {
+			t.Fatalf("DecodePayload(%q, %q): %v", tt.encoded, tt.encoding, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("DecodePayload(%q, %q) = % x, want % x", tt.encoded, tt.encoding, got, want)
+		}
+	}
+}
+
+func TestDecodePayloadErrors(t *testing.T) {
+	tests := []struct {
+		encoded, encoding string
+	}{
+		{"not base64!", EncodingBase64},
+		{"A2cBEA==", EncodingHex},
+		{"036", EncodingHex},
+		{"03670110", "base32"},
+	}
+	for _, tt := range tests {
+		if got, err := DecodePayload(tt.encoded, tt.encoding); err == nil {
+			t.Errorf("DecodePayload(%q, %q) = % x, want an error", tt.encoded, tt.encoding, got)
+		}
+	}
+}
+
+func TestDecodeCayenneLPP(t *testing.T) {
+	// Two temperatures, then a GPS fix (the examples of the Cayenne LPP documentation)
+	payload := []byte{
+		0x03, 0x67, 0x01, 0x10,
+		0x05, 0x67, 0x00, 0xFF,
+		0x01, 0x88, 0x06, 0x76, 0x5F, 0xF2, 0x96, 0x0A, 0x00, 0x03, 0xE8,
+	}
+	values, err := DecodeCayenneLPP(payload, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Value{
+		{Name: "temperature_3", Value: 27.2, Unit: "celsius"},
+		{Name: "temperature_5", Value: 25.5, Unit: "celsius"},
+		{Name: "latitude_1", Value: 42.3519, Unit: "degree"},
+		{Name: "longitude_1", Value: -87.9094, Unit: "degree"},
+		{Name: "gps_altitude_1", Value: 10, Unit: "meter"},
+	}
+	if len(values) != len(want) {
+		t.Fatalf("got %d values, want %d: %v", len(values), len(want), values)
+	}
+	for i, v := range values {
+		if v.Name != want[i].Name || v.Unit != want[i].Unit || math.Abs(v.Value-want[i].Value) > 1e-9 {
+			t.Errorf("value %d = %+v, want %+v", i, v, want[i])
+		}
+	}
+}
+
+func TestDecodeCayenneLPPErrors(t *testing.T) {
+	for _, payload := range [][]byte{{0x03}, {0x03, 0x67, 0x01}, {0x01, 0xFE, 0x00}} {
+		if values, err := DecodeCayenneLPP(payload, 1); err == nil {
+			t.Errorf("DecodeCayenneLPP(% x) = %v, want an error", payload, values)
+		}
+	}
+}
+
+func TestExpressionProfile(t *testing.T) {
+	p := Profile{
+		Name:    "th-sensor",
+		Decoder: ExpressionDecoder,
+		Fields: map[string]Field{
+			"temperature": {Expression: "s16(2) / 100", Unit: "celsius"},
+			"battery":     {Expression: "(u16(0) & 0x3FFF) / 1000", Unit: "volt"},
+		},
+		Value: "temperature",
+	}
+	if err := p.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	values, err := p.Decode([]byte{0x0C, 0xE4, 0xF8, 0x30}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values[0].Name != "temperature" || values[0].Value != -20 {
+		t.Errorf("Decode = %v, want temperature -20", values)
+	}
+
+	if _, err := p.Decode([]byte{0x0C}, 2); err == nil {
+		t.Error("Decode of a short payload succeeded, want an error")
+	}
+}
+
+func TestProfileCompileErrors(t *testing.T) {
+	tests := []Profile{
+		{Name: "bad name", Decoder: "cayenne_lpp"},
+		{Name: "unknown", Decoder: "nope"},
+		{Name: "empty", Decoder: ExpressionDecoder},
+		{Name: "vars", Decoder: ExpressionDecoder, Fields: map[string]Field{"t": {Expression: "u8(0) + offset"}}},
+		{Name: "value", Decoder: ExpressionDecoder, Fields: map[string]Field{"t": {Expression: "u8(0)"}}, Value: "h"},
+	}
+	for _, p := range tests {
+		if err := p.Compile(); err == nil {
+			t.Errorf("Compile(%s) succeeded, want an error", p.Name)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package decoder
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"edge-insights/internal/expr"
+)
+
+// ExpressionDecoder is the decoder name for profiles that define their own field expressions
+const ExpressionDecoder = "expression"
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Field is a user-supplied decoding expression, e.g. "s16(0) / 100"
+//
+// Expressions can use the byte helpers u8, s8, u16, s16, u24, s24, u32, s32 (big-endian),
+// u16le, s16le, u32le, s32le (little-endian) and bits(offset, shift, width),
+// and the variables size (payload length) and fport
+type Field struct {
+	Expression string `json:"expression"`
+	Unit       string `json:"unit"`
+
+	compiled *expr.Expr
+}
+
+// Profile maps a device profile to a decoder
+type Profile struct {
+	Name string `json:"name"`
+	// Decoder is a built-in decoder name (see Builtins) or "expression"
+	Decoder string `json:"decoder"`
+	// Fields are the expressions of an "expression" profile, keyed by value name
+	Fields map[string]Field `json:"fields,omitempty"`
+	// Value optionally selects the single decoded value stored as raw_value;
+	// when empty every decoded value becomes its own reading
+	Value     string    `json:"value,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	builtin Decoder
+}
+
+// Compile validates the profile and prepares its decoder
+func (p *Profile) Compile() error {
+	if !namePattern.MatchString(p.Name) {
+		return fmt.Errorf("name must be letters, digits, '_', '.' or '-'")
+	}
+
+	if p.Decoder != ExpressionDecoder {
+		d, ok := Lookup(p.Decoder)
+		if !ok {
+			return fmt.Errorf("unknown decoder %q", p.Decoder)
+		}
+		p.builtin = d
+		return nil
+	}
+
+	if len(p.Fields) == 0 {
+		return fmt.Errorf("expression profiles need at least one field")
+	}
+	for name, f := range p.Fields {
+		compiled, err := expr.Compile(f.Expression)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+		for _, v := range compiled.Vars() {
+			if v != "size" && v != "fport" {
+				return fmt.Errorf("field %s: unknown variable %q", name, v)
+			}
+		}
+		f.compiled = compiled
+		p.Fields[name] = f
+	}
+	if p.Value != "" {
+		if _, ok := p.Fields[p.Value]; !ok {
+			return fmt.Errorf("value %q is not one of the fields", p.Value)
+		}
+	}
+	return nil
+}
+
+// Decode runs the profile's decoder and applies the value selection
+func (p *Profile) Decode(payload []byte, fPort int) ([]Value, error) {
+	var values []Value
+	var err error
+	if p.builtin != nil {
+		values, err = p.builtin.Decode(payload, fPort)
+	} else {
+		values, err = p.decodeExpressions(payload, fPort)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+
+	if p.Value == "" {
+		return values, nil
+	}
+	for _, v := range values {
+		if v.Name == p.Value {
+			return []Value{v}, nil
+		}
+	}
+	return nil, fmt.Errorf("profile %s: payload has no %q value", p.Name, p.Value)
+}
+
+func (p *Profile) decodeExpressions(payload []byte, fPort int) ([]Value, error) {
+	env := expr.Env{
+		Vars:  map[string]float64{"size": float64(len(payload)), "fport": float64(fPort)},
+		Funcs: byteFuncs(payload),
+	}
+
+	names := make([]string, 0, len(p.Fields))
+	for name := range p.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]Value, 0, len(names))
+	for _, name := range names {
+		f := p.Fields[name]
+		v, err := f.compiled.Eval(env)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		values = append(values, Value{Name: name, Value: v, Unit: f.Unit})
+	}
+	return values, nil
+}
+
+// byteFuncs exposes the payload to expressions through offset-based readers
+func byteFuncs(payload []byte) map[string]expr.Func {
+	read := func(size int, signed, littleEndian bool) expr.Func {
+		return func(args ...float64) (float64, error) {
+			if len(args) != 1 {
+				return 0, fmt.Errorf("expected 1 argument, got %d", len(args))
+			}
+			offset := int(args[0])
+			if offset < 0 || offset+size > len(payload) {
+				return 0, fmt.Errorf("offset %d out of range for %d-byte payload", offset, len(payload))
+			}
+			b := make([]byte, size)
+			copy(b, payload[offset:offset+size])
+			if littleEndian {
+				for i, j := 0, size-1; i < j; i, j = i+1, j-1 {
+					b[i], b[j] = b[j], b[i]
+				}
+			}
+			return float64(readInt(b, signed)), nil
+		}
+	}
+
+	return map[string]expr.Func{
+		"u8":    read(1, false, false),
+		"s8":    read(1, true, false),
+		"u16":   read(2, false, false),
+		"s16":   read(2, true, false),
+		"u24":   read(3, false, false),
+		"s24":   read(3, true, false),
+		"u32":   read(4, false, false),
+		"s32":   read(4, true, false),
+		"u16le": read(2, false, true),
+		"s16le": read(2, true, true),
+		"u32le": read(4, false, true),
+		"s32le": read(4, true, true),
+		// bits(offset, shift, width) extracts width bits starting shift bits from the LSB of the byte at offset
+		"bits": func(args ...float64) (float64, error) {
+			if len(args) != 3 {
+				return 0, fmt.Errorf("expected 3 arguments, got %d", len(args))
+			}
+			offset := int(args[0])
+			if offset < 0 || offset >= len(payload) {
+				return 0, fmt.Errorf("offset %d out of range for %d-byte payload", offset, len(payload))
+			}
+			shift, width := uint(args[1]), uint(args[2])
+			return float64((uint64(payload[offset]) >> shift) & (uint64(1)<<width - 1)), nil
+		},
+	}
+}
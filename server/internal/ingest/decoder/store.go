@@ -0,0 +1,138 @@
+package decoder
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store keeps device profiles in the decoder_profiles table with an in-memory copy for the hot path
+type Store struct {
+	db       *sql.DB
+	mu       sync.RWMutex
+	profiles map[string]*Profile
+}
+
+// NewStore creates a store and loads the existing profiles
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, profiles: make(map[string]*Profile)}
+	return s, s.Load()
+}
+
+// Load (re)reads all profiles from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`SELECT name, decoder, fields, value, updated_at FROM decoder_profiles`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	profiles := make(map[string]*Profile)
+	for rows.Next() {
+		var p Profile
+		var fields []byte
+		if err := rows.Scan(&p.Name, &p.Decoder, &fields, &p.Value, &p.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(fields, &p.Fields); err != nil {
+			return fmt.Errorf("invalid fields for %s: %w", p.Name, err)
+		}
+		if err := p.Compile(); err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		profiles[p.Name] = &p
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.profiles = profiles
+	s.mu.Unlock()
+	return nil
+}
+
+// Resolve returns the profile with the given name; a built-in decoder name works as an implicit profile
+func (s *Store) Resolve(name string) (*Profile, bool) {
+	s.mu.RLock()
+	p, ok := s.profiles[name]
+	s.mu.RUnlock()
+	if ok {
+		return p, true
+	}
+
+	if d, ok := Lookup(name); ok {
+		return &Profile{Name: name, Decoder: name, builtin: d}, true
+	}
+	return nil, false
+}
+
+// List returns every stored profile sorted by name
+func (s *Store) List() []Profile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Profile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Save validates and creates or replaces a profile
+func (s *Store) Save(p Profile) (*Profile, error) {
+	if err := p.Compile(); err != nil {
+		return nil, err
+	}
+
+	fields, err := json.Marshal(p.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO decoder_profiles (name, decoder, fields, value, updated_at)
+        VALUES ($1, $2, $3, $4, NOW())
+        ON CONFLICT (name) DO UPDATE SET
+            decoder = EXCLUDED.decoder,
+            fields = EXCLUDED.fields,
+            value = EXCLUDED.value,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := s.db.QueryRow(query, p.Name, p.Decoder, fields, p.Value).Scan(&p.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save decoder profile: %w", err)
+	}
+
+	s.mu.Lock()
+	s.profiles[p.Name] = &p
+	s.mu.Unlock()
+	return &p, nil
+}
+
+// Delete removes a profile; it reports false if it did not exist
+func (s *Store) Delete(name string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM decoder_profiles WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	s.mu.Lock()
+	delete(s.profiles, name)
+	s.mu.Unlock()
+	return n > 0, nil
+}
+
+// Import saves a batch of profiles (used by configuration bundles)
+func (s *Store) Import(profiles []Profile) (int, error) {
+	for i, p := range profiles {
+		if _, err := s.Save(p); err != nil {
+			return i, fmt.Errorf("%s: %w", p.Name, err)
+		}
+	}
+	return len(profiles), nil
+}
@@ -0,0 +1,161 @@
+// turns alarm emails from legacy equipment into ERROR/CRITICAL log entries
+// emails arrive through an inbound-email webhook (SendGrid, Mailgun, Postmark or a raw MIME relay)
+
+package email
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// maxEmailSize bounds inbound email payloads (attachments are ignored)
+const maxEmailSize = 10 << 20
+
+// Email is the provider-neutral part of an inbound message rules match against
+type Email struct {
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Date    time.Time `json:"date"`
+}
+
+// FromRequest extracts an email from an inbound webhook request:
+//   - multipart/form-data or urlencoded forms (SendGrid: from/subject/text, Mailgun: sender/subject/body-plain)
+//   - application/json (Postmark: From/Subject/TextBody)
+//   - message/rfc822 or text/plain raw MIME messages
+func FromRequest(r *http.Request) (Email, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := http.MaxBytesReader(nil, r.Body, maxEmailSize)
+
+	switch mediaType {
+	case "multipart/form-data", "application/x-www-form-urlencoded":
+		r.Body = body
+		if mediaType == "multipart/form-data" {
+			if err := r.ParseMultipartForm(maxEmailSize); err != nil {
+				return Email{}, fmt.Errorf("invalid multipart form: %w", err)
+			}
+		} else if err := r.ParseForm(); err != nil {
+			return Email{}, fmt.Errorf("invalid form: %w", err)
+		}
+		// SendGrid can forward the full MIME message instead of parsed fields
+		if raw := r.FormValue("email"); raw != "" {
+			return FromMIME(strings.NewReader(raw))
+		}
+		return Email{
+			From:    first(r.FormValue("from"), r.FormValue("sender")),
+			To:      first(r.FormValue("to"), r.FormValue("recipient")),
+			Subject: r.FormValue("subject"),
+			Body:    first(r.FormValue("text"), r.FormValue("body-plain"), r.FormValue("stripped-text")),
+			Date:    time.Now().UTC(),
+		}, nil
+
+	case "application/json":
+		var postmark struct {
+			From     string
+			To       string
+			Subject  string
+			TextBody string
+			Date     string
+		}
+		if err := json.NewDecoder(body).Decode(&postmark); err != nil {
+			return Email{}, fmt.Errorf("invalid JSON: %w", err)
+		}
+		e := Email{From: postmark.From, To: postmark.To, Subject: postmark.Subject, Body: postmark.TextBody, Date: time.Now().UTC()}
+		if t, err := mail.ParseDate(postmark.Date); err == nil {
+			e.Date = t
+		}
+		return e, nil
+	}
+
+	return FromMIME(body)
+}
+
+// FromMIME parses a raw RFC 5322 message, using its first text/plain part as the body
+func FromMIME(r io.Reader) (Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return Email{}, fmt.Errorf("invalid email: %w", err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	e := Email{
+		From:    msg.Header.Get("From"),
+		To:      msg.Header.Get("To"),
+		Subject: subject,
+		Date:    time.Now().UTC(),
+	}
+	if t, err := msg.Header.Date(); err == nil {
+		e.Date = t
+	}
+
+	text, err := plainText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return Email{}, err
+	}
+	e.Body = text
+	return e, nil
+}
+
+// plainText walks multipart bodies looking for the first text/plain part
+func plainText(contentType, transferEncoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", fmt.Errorf("invalid multipart email: %w", err)
+			}
+			text, err := plainText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil && text != "" {
+				return text, nil
+			}
+		}
+	}
+
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+	switch strings.ToLower(transferEncoding) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxEmailSize))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package email
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+var groupPlaceholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Rule recognises one vendor's alarm format and maps it onto a device
+//
+// Named groups captured by subject_pattern and body_pattern (e.g. (?P<unit>\w+)) can be used
+// as {{unit}} in device_id, device_type, location and message, and a "value" group fills raw_value
+type Rule struct {
+	Name           string `json:"name"`
+	Priority       int    `json:"priority"`     // lower runs first; the first matching rule wins
+	FromPattern    string `json:"from_pattern"` // regex matched against the From header
+	SubjectPattern string `json:"subject_pattern"`
+	BodyPattern    string `json:"body_pattern,omitempty"`
+	DeviceID       string `json:"device_id"`
+	DeviceType     string `json:"device_type,omitempty"`
+	Location       string `json:"location,omitempty"`
+	Unit           string `json:"unit,omitempty"`
+	// LogType is ERROR or CRITICAL; Severities can override it from a "severity" group, e.g. {"minor": "WARN"}
+	LogType    string            `json:"log_type,omitempty"`
+	Severities map[string]string `json:"severities,omitempty"`
+	Message    string            `json:"message,omitempty"` // defaults to the subject
+	UpdatedAt  time.Time         `json:"updated_at"`
+
+	from, subject, body *regexp.Regexp
+}
+
+// Compile validates the rule and prepares its patterns
+func (r *Rule) Compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.DeviceID == "" {
+		return fmt.Errorf("device_id is required")
+	}
+	if r.FromPattern == "" && r.SubjectPattern == "" && r.BodyPattern == "" {
+		return fmt.Errorf("at least one of from_pattern, subject_pattern or body_pattern is required")
+	}
+
+	r.LogType = strings.ToUpper(r.LogType)
+	if r.LogType == "" {
+		r.LogType = "ERROR"
+	}
+	for key, logType := range r.Severities {
+		r.Severities[key] = strings.ToUpper(logType)
+	}
+
+	var err error
+	if r.from, err = compileOptional(r.FromPattern); err != nil {
+		return fmt.Errorf("from_pattern: %w", err)
+	}
+	if r.subject, err = compileOptional(r.SubjectPattern); err != nil {
+		return fmt.Errorf("subject_pattern: %w", err)
+	}
+	if r.body, err = compileOptional(r.BodyPattern); err != nil {
+		return fmt.Errorf("body_pattern: %w", err)
+	}
+	return nil
+}
+
+func compileOptional(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	// Alarm text is matched case-insensitively and across lines
+	return regexp.Compile("(?is)" + pattern)
+}
+
+// Match reports whether the email matches and returns the named groups it captured
+func (r *Rule) Match(e Email) (map[string]string, bool) {
+	groups := make(map[string]string)
+	for _, m := range []struct {
+		re   *regexp.Regexp
+		text string
+	}{{r.from, e.From}, {r.subject, e.Subject}, {r.body, e.Body}} {
+		if m.re == nil {
+			continue
+		}
+		match := m.re.FindStringSubmatch(m.text)
+		if match == nil {
+			return nil, false
+		}
+		for i, name := range m.re.SubexpNames() {
+			if name != "" && match[i] != "" {
+				groups[name] = strings.TrimSpace(match[i])
+			}
+		}
+	}
+	return groups, true
+}
+
+// ToLogMessage builds the log entry for a matched email
+func (r *Rule) ToLogMessage(e Email, groups map[string]string) types.LogMessage {
+	expand := func(template string) string {
+		return groupPlaceholder.ReplaceAllStringFunc(template, func(p string) string {
+			return groups[groupPlaceholder.FindStringSubmatch(p)[1]]
+		})
+	}
+
+	msg := types.LogMessage{
+		Time:       e.Date,
+		DeviceID:   expand(r.DeviceID),
+		DeviceType: expand(r.DeviceType),
+		Location:   expand(r.Location),
+		Unit:       r.Unit,
+		LogType:    r.LogType,
+		Message:    expand(r.Message),
+	}
+	if msg.DeviceType == "" {
+		msg.DeviceType = "email_alarm"
+	}
+	if msg.Message == "" {
+		msg.Message = strings.TrimSpace(e.Subject)
+	}
+	if logType, ok := r.Severities[strings.ToLower(groups["severity"])]; ok {
+		msg.LogType = logType
+	}
+	if v, err := strconv.ParseFloat(groups["value"], 64); err == nil {
+		msg.RawValue = &v
+	}
+	return msg
+}
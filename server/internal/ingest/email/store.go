@@ -0,0 +1,157 @@
+package email
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store keeps alarm rules in the email_rules table with an in-memory copy ordered by priority
+type Store struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	rules []*Rule
+}
+
+// NewStore creates a store and loads the existing rules
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db}
+	return s, s.Load()
+}
+
+// Load (re)reads all rules from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`SELECT name, settings, updated_at FROM email_rules`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var rules []*Rule
+	for rows.Next() {
+		var rule Rule
+		var name string
+		var settings []byte
+		if err := rows.Scan(&name, &settings, &rule.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(settings, &rule); err != nil {
+			return fmt.Errorf("invalid settings for %s: %w", name, err)
+		}
+		rule.Name = name
+		if err := rule.Compile(); err != nil {
+			return fmt.Errorf("rule %s: %w", name, err)
+		}
+		rules = append(rules, &rule)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.sortLocked()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) sortLocked() {
+	sort.SliceStable(s.rules, func(i, j int) bool {
+		if s.rules[i].Priority != s.rules[j].Priority {
+			return s.rules[i].Priority < s.rules[j].Priority
+		}
+		return s.rules[i].Name < s.rules[j].Name
+	})
+}
+
+// Match returns the first rule matching the email and its captured groups
+func (s *Store) Match(e Email) (*Rule, map[string]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rule := range s.rules {
+		if groups, ok := rule.Match(e); ok {
+			return rule, groups, true
+		}
+	}
+	return nil, nil, false
+}
+
+// List returns every rule in evaluation order
+func (s *Store) List() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Rule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		list = append(list, *rule)
+	}
+	return list
+}
+
+// Save validates and creates or replaces a rule
+func (s *Store) Save(rule Rule) (*Rule, error) {
+	if err := rule.Compile(); err != nil {
+		return nil, err
+	}
+
+	settings, err := json.Marshal(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO email_rules (name, settings, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (name) DO UPDATE SET
+            settings = EXCLUDED.settings,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := s.db.QueryRow(query, rule.Name, settings).Scan(&rule.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save email rule: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.rules {
+		if existing.Name == rule.Name {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			break
+		}
+	}
+	s.rules = append(s.rules, &rule)
+	s.sortLocked()
+	return &rule, nil
+}
+
+// Delete removes a rule; it reports false if it did not exist
+func (s *Store) Delete(name string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM email_rules WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.rules {
+		if existing.Name == name {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			break
+		}
+	}
+	return n > 0, nil
+}
+
+// Import saves a batch of rules (used by configuration bundles)
+func (s *Store) Import(rules []Rule) (int, error) {
+	for i, rule := range rules {
+		if _, err := s.Save(rule); err != nil {
+			return i, fmt.Errorf("%s: %w", rule.Name, err)
+		}
+	}
+	return len(rules), nil
+}
@@ -0,0 +1,205 @@
+// subscribes to MQTT topics and ingests their payloads as device readings
+
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-insights/internal/ingest/webhook"
+	"edge-insights/internal/mqttclient"
+	"edge-insights/internal/types"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Sink receives each converted reading (normally the WebSocket handler's ingestion path)
+type Sink func(types.LogMessage) error
+
+// MappingResolver looks up the webhook mapping a subscription translates payloads with
+type MappingResolver func(name string) (*webhook.Mapping, bool)
+
+// SubscriptionStatus reports traffic on one subscription
+type SubscriptionStatus struct {
+	Subscription
+	Received      int64      `json:"received"`
+	Stored        int64      `json:"stored"`
+	Failed        int64      `json:"failed"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// Bridge subscribes to the configured topics on the shared MQTT broker
+type Bridge struct {
+	client   paho.Client
+	sink     Sink
+	mappings MappingResolver
+	profiles webhook.ProfileResolver
+	qos      byte
+	mu       sync.Mutex
+	status   []SubscriptionStatus
+}
+
+// NewBridge connects to the configured broker and subscribes on every (re)connection
+func NewBridge(clientID string, subs []Subscription, qos byte, sink Sink, mappings MappingResolver, profiles webhook.ProfileResolver) (*Bridge, error) {
+	b := &Bridge{sink: sink, mappings: mappings, profiles: profiles, qos: qos}
+	for _, sub := range subs {
+		b.status = append(b.status, SubscriptionStatus{Subscription: sub})
+	}
+
+	client, err := mqttclient.Connect(clientID, b.onConnect)
+	if err != nil {
+		return nil, err
+	}
+	b.client = client
+	return b, nil
+}
+
+// Status returns per-subscription counters
+func (b *Bridge) Status() []SubscriptionStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]SubscriptionStatus(nil), b.status...)
+}
+
+// Close disconnects from the broker
+func (b *Bridge) Close() {
+	b.client.Disconnect(250)
+}
+
+func (b *Bridge) onConnect(client paho.Client) {
+	for i := range b.status {
+		i := i
+		sub := b.status[i].Subscription
+		token := client.Subscribe(sub.Filter, b.qos, func(_ paho.Client, m paho.Message) {
+			b.handle(i, m.Topic(), m.Payload())
+		})
+		if token.Wait() && token.Error() != nil {
+			log.Printf("MQTT subscribe to %s failed: %v", sub.Filter, token.Error())
+			continue
+		}
+		log.Printf("MQTT ingestion subscribed to %s", sub.Filter)
+	}
+}
+
+// handle converts and stores one message, recording the outcome against its subscription
+func (b *Bridge) handle(i int, topic string, payload []byte) {
+	b.mu.Lock()
+	sub := b.status[i].Subscription
+	b.status[i].Received++
+	now := time.Now()
+	b.status[i].LastMessageAt = &now
+	b.mu.Unlock()
+
+	messages, err := b.convert(sub, topic, payload)
+	stored := 0
+	if err == nil {
+		for _, msg := range messages {
+			if err = b.sink(msg); err != nil {
+				break
+			}
+			stored++
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status[i].Stored += int64(stored)
+	if err != nil {
+		b.status[i].Failed++
+		b.status[i].LastError = err.Error()
+		log.Printf("MQTT message on %s not ingested: %v", topic, err)
+	}
+}
+
+// convert maps a payload onto log messages
+// Without a mapping the payload can be a LogMessage object, an array of them, a bare number,
+// a boolean/on/off state or plain text; topic placeholders fill any fields left empty
+func (b *Bridge) convert(sub Subscription, topic string, payload []byte) ([]types.LogMessage, error) {
+	var messages []types.LogMessage
+
+	if sub.Mapping != "" {
+		mapping, ok := b.mappings(sub.Mapping)
+		if !ok {
+			return nil, fmt.Errorf("unknown mapping %q", sub.Mapping)
+		}
+		msgs, err := mapping.Apply(payload, b.profiles)
+		if err != nil {
+			return nil, err
+		}
+		messages = msgs
+	} else {
+		msgs, err := decodePayload(payload)
+		if err != nil {
+			return nil, err
+		}
+		messages = msgs
+	}
+
+	vars := sub.Vars(topic)
+	for i := range messages {
+		msg := &messages[i]
+		if msg.DeviceID == "" {
+			msg.DeviceID = vars["device_id"]
+		}
+		if msg.DeviceID == "" {
+			return nil, fmt.Errorf("no device_id in payload or topic")
+		}
+		if msg.DeviceType == "" {
+			msg.DeviceType = vars["device_type"]
+		}
+		if msg.DeviceType == "" {
+			msg.DeviceType = "mqtt"
+		}
+		if msg.Location == "" {
+			msg.Location = vars["location"]
+		}
+		if msg.LogType == "" {
+			msg.LogType = "INFO"
+		}
+		if msg.Message == "" {
+			msg.Message = fmt.Sprintf("MQTT reading on %s", topic)
+		}
+	}
+	return messages, nil
+}
+
+func decodePayload(payload []byte) ([]types.LogMessage, error) {
+	text := strings.TrimSpace(string(payload))
+	if text == "" {
+		return nil, fmt.Errorf("empty payload")
+	}
+
+	switch text[0] {
+	case '{':
+		var msg types.LogMessage
+		if err := json.Unmarshal([]byte(text), &msg); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+		return []types.LogMessage{msg}, nil
+	case '[':
+		var msgs []types.LogMessage
+		if err := json.Unmarshal([]byte(text), &msgs); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+		return msgs, nil
+	}
+
+	if v, err := strconv.ParseFloat(text, 64); err == nil {
+		return []types.LogMessage{{RawValue: &v}}, nil
+	}
+	switch strings.ToLower(text) {
+	case "true", "on", "open", "detected":
+		v := 1.0
+		return []types.LogMessage{{RawValue: &v, Unit: "boolean"}}, nil
+	case "false", "off", "closed", "clear":
+		v := 0.0
+		return []types.LogMessage{{RawValue: &v, Unit: "boolean"}}, nil
+	}
+	return []types.LogMessage{{Message: text}}, nil
+}
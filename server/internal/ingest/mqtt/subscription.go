@@ -0,0 +1,98 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// topicVars are the placeholders a subscription topic can capture into LogMessage fields
+var topicVars = map[string]bool{"device_id": true, "device_type": true, "location": true}
+
+// Subscription is one topic the bridge subscribes to
+//
+// Topic levels can be placeholders that fill fields the payload leaves empty, e.g.
+// "sites/{location}/{device_id}/telemetry" subscribes to "sites/+/+/telemetry".
+// Mapping optionally names a webhook mapping used to translate JSON payloads
+type Subscription struct {
+	Topic   string   `json:"topic"`
+	Filter  string   `json:"filter"`
+	Mapping string   `json:"mapping,omitempty"`
+	vars    []string // placeholder per topic level after any $share/<group>/ prefix, "" for other levels
+}
+
+// ParseSubscriptions parses MQTT_INGEST_TOPICS: comma-separated topics, each optionally
+// followed by =<mapping>, e.g. "devices/{device_id}/telemetry,ttn/#=ttn"
+func ParseSubscriptions(spec string) ([]Subscription, error) {
+	var subs []Subscription
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		topic, mapping, _ := strings.Cut(entry, "=")
+		sub, err := NewSubscription(strings.TrimSpace(topic), strings.TrimSpace(mapping))
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	if len(subs) == 0 {
+		return nil, fmt.Errorf("no topics configured")
+	}
+	return subs, nil
+}
+
+// NewSubscription validates a topic template and derives its MQTT filter
+func NewSubscription(topic, mapping string) (Subscription, error) {
+	if topic == "" {
+		return Subscription{}, fmt.Errorf("empty topic")
+	}
+	sub := Subscription{Topic: topic, Mapping: mapping}
+
+	levels := strings.Split(topic, "/")
+	prefix := 0
+	// Shared subscriptions ($share/<group>/<filter>) let several servers split one topic's traffic
+	if levels[0] == "$share" {
+		if len(levels) < 3 {
+			return Subscription{}, fmt.Errorf("topic %q: $share needs a group and a filter", topic)
+		}
+		prefix = 2
+	}
+
+	filter := make([]string, len(levels))
+	copy(filter, levels)
+	for i := prefix; i < len(levels); i++ {
+		level := levels[i]
+		switch {
+		case strings.HasPrefix(level, "{") && strings.HasSuffix(level, "}"):
+			name := level[1 : len(level)-1]
+			if !topicVars[name] {
+				return Subscription{}, fmt.Errorf("topic %q: unknown placeholder {%s}", topic, name)
+			}
+			filter[i] = "+"
+			sub.vars = append(sub.vars, name)
+		case strings.ContainsAny(level, "{}"):
+			return Subscription{}, fmt.Errorf("topic %q: placeholders must span a whole level", topic)
+		case level == "#" && i != len(levels)-1:
+			return Subscription{}, fmt.Errorf("topic %q: # must be the last level", topic)
+		case level != "#" && level != "+" && strings.ContainsAny(level, "#+"):
+			return Subscription{}, fmt.Errorf("topic %q: wildcards must span a whole level", topic)
+		default:
+			sub.vars = append(sub.vars, "")
+		}
+	}
+	sub.Filter = strings.Join(filter, "/")
+	return sub, nil
+}
+
+// Vars extracts the placeholder values from a topic the subscription received
+func (s Subscription) Vars(topic string) map[string]string {
+	vars := make(map[string]string)
+	levels := strings.Split(topic, "/")
+	for i, name := range s.vars {
+		if name != "" && i < len(levels) {
+			vars[name] = levels[i]
+		}
+	}
+	return vars
+}
@@ -0,0 +1,170 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"edge-insights/internal/types"
+)
+
+// maxMessageSize bounds a single syslog message (RFC 5424 receivers must accept at least 480, should accept 2048)
+const maxMessageSize = 64 * 1024
+
+// Sink receives each converted message (normally the WebSocket handler's ingestion path)
+type Sink func(types.LogMessage) error
+
+// Listener accepts syslog over UDP and/or TCP
+type Listener struct {
+	sources *Store
+	sink    Sink
+	udp     net.PacketConn
+	tcp     net.Listener
+}
+
+// NewListener creates a listener that resolves overrides from sources
+func NewListener(sources *Store, sink Sink) *Listener {
+	return &Listener{sources: sources, sink: sink}
+}
+
+// ListenUDP starts receiving one message per datagram on addr
+func (l *Listener) ListenUDP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	l.udp = conn
+	log.Printf("Syslog UDP listener on %s", conn.LocalAddr())
+
+	go func() {
+		buf := make([]byte, maxMessageSize)
+		for {
+			n, remote, err := conn.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Printf("Syslog UDP read error: %v", err)
+				continue
+			}
+			l.handle(string(buf[:n]), hostOf(remote))
+		}
+	}()
+	return nil
+}
+
+// ListenTCP starts accepting connections framed with octet counting or newlines (RFC 6587)
+func (l *Listener) ListenTCP(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	l.tcp = ln
+	log.Printf("Syslog TCP listener on %s", ln.Addr())
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Printf("Syslog TCP accept error: %v", err)
+				continue
+			}
+			go l.serveConn(conn)
+		}
+	}()
+	return nil
+}
+
+// Close stops both listeners
+func (l *Listener) Close() {
+	if l.udp != nil {
+		l.udp.Close()
+	}
+	if l.tcp != nil {
+		l.tcp.Close()
+	}
+}
+
+func (l *Listener) serveConn(conn net.Conn) {
+	defer conn.Close()
+	source := hostOf(conn.RemoteAddr())
+	reader := bufio.NewReaderSize(conn, maxMessageSize)
+
+	for {
+		raw, err := readFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Syslog TCP read error from %s: %v", source, err)
+			}
+			return
+		}
+		l.handle(raw, source)
+	}
+}
+
+// readFrame reads one message: "LEN SP MSG" when the frame starts with a digit, otherwise up to the next newline
+func readFrame(r *bufio.Reader) (string, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if first[0] >= '0' && first[0] <= '9' {
+		prefix, err := r.ReadString(' ')
+		if err != nil {
+			return "", err
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(prefix))
+		if err != nil || length <= 0 || length > maxMessageSize {
+			return "", errors.New("invalid octet count")
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return "", err
+		}
+		return string(frame), nil
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return line, nil
+}
+
+// handle parses a message, applies source overrides and hands it to the sink
+func (l *Listener) handle(raw, sourceIP string) {
+	if strings.TrimSpace(raw) == "" {
+		return
+	}
+
+	m, err := Parse(raw)
+	if err != nil {
+		log.Printf("Syslog message from %s rejected: %v", sourceIP, err)
+		return
+	}
+
+	src, ok := l.sources.Get(m.Hostname)
+	if !ok {
+		src, _ = l.sources.Get(sourceIP)
+	}
+
+	if err := l.sink(ToLogMessage(m, sourceIP, src)); err != nil {
+		log.Printf("Syslog message from %s not stored: %v", sourceIP, err)
+	}
+}
+
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
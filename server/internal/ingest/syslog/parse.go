@@ -0,0 +1,147 @@
+// receives syslog from edge appliances that cannot speak WebSocket or HTTP
+// and converts RFC 5424 messages into LogMessage rows
+
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nilValue is the RFC 5424 placeholder for an absent header field
+const nilValue = "-"
+
+// severityNames index RFC 5424 severities 0-7
+var severityNames = []string{"emergency", "alert", "critical", "error", "warning", "notice", "informational", "debug"}
+
+// Message is a parsed RFC 5424 syslog message
+type Message struct {
+	Facility       int
+	Severity       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData string
+	Text           string
+}
+
+// SeverityName returns the RFC 5424 name of the message severity
+func (m Message) SeverityName() string {
+	return severityNames[m.Severity]
+}
+
+// LogType maps the syslog severity onto the platform's log types
+func (m Message) LogType() string {
+	switch {
+	case m.Severity <= 3:
+		return "ERROR"
+	case m.Severity == 4:
+		return "WARN"
+	case m.Severity == 7:
+		return "DEBUG"
+	}
+	return "INFO"
+}
+
+// Parse parses one RFC 5424 message:
+// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func Parse(raw string) (Message, error) {
+	var m Message
+	raw = strings.TrimRight(raw, "\r\n\x00")
+
+	// Step 1: PRI
+	if !strings.HasPrefix(raw, "<") {
+		return m, fmt.Errorf("missing PRI")
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return m, fmt.Errorf("invalid PRI")
+	}
+	pri, err := strconv.Atoi(raw[1:end])
+	if err != nil || pri > 191 {
+		return m, fmt.Errorf("invalid PRI %q", raw[1:end])
+	}
+	m.Facility, m.Severity = pri/8, pri%8
+	rest := raw[end+1:]
+
+	// Step 2: VERSION must be 1
+	version, rest := nextField(rest)
+	if version != "1" {
+		return m, fmt.Errorf("unsupported syslog version %q (expected RFC 5424)", version)
+	}
+
+	// Step 3: header fields
+	var timestamp string
+	timestamp, rest = nextField(rest)
+	m.Hostname, rest = nextField(rest)
+	m.AppName, rest = nextField(rest)
+	m.ProcID, rest = nextField(rest)
+	m.MsgID, rest = nextField(rest)
+
+	if timestamp != nilValue {
+		m.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return m, fmt.Errorf("invalid timestamp %q", timestamp)
+		}
+	}
+	for _, f := range []*string{&m.Hostname, &m.AppName, &m.ProcID, &m.MsgID} {
+		if *f == nilValue {
+			*f = ""
+		}
+	}
+
+	// Step 4: STRUCTURED-DATA is "-" or one or more [id param="value" ...] elements
+	if strings.HasPrefix(rest, nilValue) {
+		rest = rest[1:]
+	} else if strings.HasPrefix(rest, "[") {
+		n, err := structuredDataLength(rest)
+		if err != nil {
+			return m, err
+		}
+		m.StructuredData, rest = rest[:n], rest[n:]
+	} else {
+		return m, fmt.Errorf("missing structured data")
+	}
+
+	// Step 5: MSG (optionally prefixed with a UTF-8 BOM)
+	m.Text = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	return m, nil
+}
+
+// nextField splits off the next space-delimited header field
+func nextField(s string) (string, string) {
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// structuredDataLength returns the length of the SD elements at the start of s, honouring escapes in values
+func structuredDataLength(s string) (int, error) {
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		inQuotes := false
+		for i++; i < len(s); i++ {
+			c := s[i]
+			if inQuotes && c == '\\' {
+				i++
+				continue
+			}
+			if c == '"' {
+				inQuotes = !inQuotes
+			}
+			if c == ']' && !inQuotes {
+				break
+			}
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("unterminated structured data")
+		}
+		i++
+	}
+	return i, nil
+}
@@ -0,0 +1,141 @@
+package syslog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// Source holds per-source parsing overrides, matched on the syslog HOSTNAME or the sender's IP
+type Source struct {
+	Source string `json:"source"`
+	// DeviceID fixes the device id; otherwise it comes from DeviceIDFrom (hostname, app_name or source_ip)
+	DeviceID     string `json:"device_id,omitempty"`
+	DeviceIDFrom string `json:"device_id_from,omitempty"`
+	DeviceType   string `json:"device_type,omitempty"`
+	Location     string `json:"location,omitempty"`
+	// ValuePattern extracts raw_value from the message text using its "value" group (or first group)
+	ValuePattern string `json:"value_pattern,omitempty"`
+	Unit         string `json:"unit,omitempty"`
+	// LogTypes overrides the log type per severity name, e.g. {"notice": "WARN"}
+	LogTypes  map[string]string `json:"log_types,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+
+	pattern *regexp.Regexp
+}
+
+// Compile validates the overrides and prepares the value pattern
+func (s *Source) Compile() error {
+	if s.Source == "" {
+		return fmt.Errorf("source is required")
+	}
+	switch s.DeviceIDFrom {
+	case "", "hostname", "app_name", "source_ip":
+	default:
+		return fmt.Errorf("device_id_from must be hostname, app_name or source_ip")
+	}
+	for severity, logType := range s.LogTypes {
+		if !validSeverity(severity) {
+			return fmt.Errorf("unknown severity %q", severity)
+		}
+		s.LogTypes[severity] = strings.ToUpper(logType)
+	}
+
+	s.pattern = nil
+	if s.ValuePattern != "" {
+		pattern, err := regexp.Compile(s.ValuePattern)
+		if err != nil {
+			return fmt.Errorf("invalid value_pattern: %w", err)
+		}
+		if pattern.NumSubexp() == 0 {
+			return fmt.Errorf("value_pattern needs a capture group")
+		}
+		s.pattern = pattern
+	}
+	return nil
+}
+
+func validSeverity(name string) bool {
+	for _, n := range severityNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ToLogMessage converts a parsed message from sourceIP, applying the overrides in src (which may be nil)
+func ToLogMessage(m Message, sourceIP string, src *Source) types.LogMessage {
+	if src == nil {
+		src = &Source{}
+	}
+
+	msg := types.LogMessage{
+		Time:       m.Timestamp,
+		DeviceID:   src.DeviceID,
+		DeviceType: src.DeviceType,
+		Location:   src.Location,
+		Unit:       src.Unit,
+		LogType:    m.LogType(),
+		Message:    m.Text,
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now().UTC()
+	}
+
+	// hostname → device_id unless overridden
+	if msg.DeviceID == "" {
+		switch src.DeviceIDFrom {
+		case "app_name":
+			msg.DeviceID = m.AppName
+		case "source_ip":
+			msg.DeviceID = sourceIP
+		default:
+			msg.DeviceID = m.Hostname
+		}
+	}
+	if msg.DeviceID == "" {
+		msg.DeviceID = sourceIP
+	}
+	if msg.DeviceType == "" {
+		msg.DeviceType = "syslog"
+	}
+
+	if logType, ok := src.LogTypes[m.SeverityName()]; ok {
+		msg.LogType = logType
+	}
+
+	if m.AppName != "" {
+		msg.Message = fmt.Sprintf("[%s] %s", m.AppName, m.Text)
+	}
+	if strings.TrimSpace(m.Text) == "" {
+		msg.Message = fmt.Sprintf("Syslog %s message from %s", m.SeverityName(), msg.DeviceID)
+	}
+
+	if src.pattern != nil {
+		if value, ok := extractValue(src.pattern, m.Text); ok {
+			msg.RawValue = &value
+		}
+	}
+	return msg
+}
+
+func extractValue(pattern *regexp.Regexp, text string) (float64, bool) {
+	match := pattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, false
+	}
+	group := 1
+	if i := pattern.SubexpIndex("value"); i > 0 {
+		group = i
+	}
+	value, err := strconv.ParseFloat(match[group], 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
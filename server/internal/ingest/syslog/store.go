@@ -0,0 +1,131 @@
+package syslog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store keeps per-source overrides in the syslog_sources table with an in-memory copy for the hot path
+type Store struct {
+	db      *sql.DB
+	mu      sync.RWMutex
+	sources map[string]*Source
+}
+
+// NewStore creates a store and loads the existing overrides
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, sources: make(map[string]*Source)}
+	return s, s.Load()
+}
+
+// Load (re)reads all overrides from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`SELECT source, settings, updated_at FROM syslog_sources`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sources := make(map[string]*Source)
+	for rows.Next() {
+		var src Source
+		var name string
+		var settings []byte
+		if err := rows.Scan(&name, &settings, &src.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(settings, &src); err != nil {
+			return fmt.Errorf("invalid settings for %s: %w", name, err)
+		}
+		src.Source = name
+		if err := src.Compile(); err != nil {
+			return fmt.Errorf("source %s: %w", name, err)
+		}
+		sources[name] = &src
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.sources = sources
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns the overrides for a hostname or IP
+func (s *Store) Get(source string) (*Source, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	src, ok := s.sources[source]
+	return src, ok
+}
+
+// List returns every override sorted by source
+func (s *Store) List() []Source {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Source, 0, len(s.sources))
+	for _, src := range s.sources {
+		list = append(list, *src)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Source < list[j].Source })
+	return list
+}
+
+// Save validates and creates or replaces an override
+func (s *Store) Save(src Source) (*Source, error) {
+	if err := src.Compile(); err != nil {
+		return nil, err
+	}
+
+	settings, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO syslog_sources (source, settings, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (source) DO UPDATE SET
+            settings = EXCLUDED.settings,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := s.db.QueryRow(query, src.Source, settings).Scan(&src.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save syslog source: %w", err)
+	}
+
+	s.mu.Lock()
+	s.sources[src.Source] = &src
+	s.mu.Unlock()
+	return &src, nil
+}
+
+// Delete removes an override; it reports false if it did not exist
+func (s *Store) Delete(source string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM syslog_sources WHERE source = $1`, source)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	s.mu.Lock()
+	delete(s.sources, source)
+	s.mu.Unlock()
+	return n > 0, nil
+}
+
+// Import saves a batch of overrides (used by configuration bundles)
+func (s *Store) Import(sources []Source) (int, error) {
+	for i, src := range sources {
+		if _, err := s.Save(src); err != nil {
+			return i, fmt.Errorf("%s: %w", src.Source, err)
+		}
+	}
+	return len(sources), nil
+}
@@ -0,0 +1,292 @@
+// translates third-party webhook payloads (TTN/LoRaWAN network servers, vendor clouds)
+// into LogMessage rows using per-source mapping templates
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-insights/internal/ingest/decoder"
+	"edge-insights/internal/types"
+)
+
+// Mapping describes how one webhook source maps onto LogMessage fields
+//
+// Each field value is a template:
+//   - "$.path" or "@.path" extracts a value (keeping its JSON type)
+//   - "text {{$.path}} text" interpolates one or more values into a string
+//   - anything else is used literally (e.g. "temperature_sensor")
+//
+// LoRaWAN sources can also set "payload" (the uplink bytes, in Encoding), "profile"
+// (the device profile whose decoder fills raw_value/unit) and "f_port"
+type Mapping struct {
+	Source string `json:"source"`
+	// Records optionally points at an array in the payload; each element becomes one reading
+	// and can be referenced with @ in field templates
+	Records string            `json:"records,omitempty"`
+	Fields  map[string]string `json:"fields"`
+	// Encoding is how the payload field is encoded: base64 (default; TTN, ChirpStack) or hex
+	Encoding string `json:"encoding,omitempty"`
+	// Token, when set, must be presented in the X-Webhook-Token header (or ?token=)
+	Token     string    `json:"token,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// supportedFields are the LogMessage fields a mapping can populate
+var supportedFields = map[string]bool{
+	"time": true, "device_id": true, "device_type": true, "location": true,
+	"raw_value": true, "unit": true, "log_type": true, "message": true,
+	"payload": true, "profile": true, "f_port": true,
+}
+
+// ProfileResolver looks up the device profile used to decode uplink payloads
+type ProfileResolver func(name string) (*decoder.Profile, bool)
+
+var placeholder = regexp.MustCompile(`\{\{\s*([^}]+?)\s*\}\}`)
+
+// Validate checks the mapping's fields and templates
+func (m *Mapping) Validate() error {
+	if m.Source == "" {
+		return fmt.Errorf("source is required")
+	}
+	if m.Fields["device_id"] == "" {
+		return fmt.Errorf("fields.device_id is required")
+	}
+	if (m.Fields["payload"] == "") != (m.Fields["profile"] == "") {
+		return fmt.Errorf("fields.payload and fields.profile must be set together")
+	}
+	if !decoder.ValidEncoding(m.Encoding) {
+		return fmt.Errorf("encoding must be %s or %s", decoder.EncodingBase64, decoder.EncodingHex)
+	}
+	for name, template := range m.Fields {
+		if !supportedFields[name] {
+			return fmt.Errorf("unsupported field %q", name)
+		}
+		// Resolve against empty documents to surface syntax errors early
+		if _, err := resolve(template, map[string]interface{}{}, map[string]interface{}{}); err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Apply converts a raw webhook payload into one or more log messages, decoding uplink payloads with profiles
+func (m *Mapping) Apply(payload []byte, profiles ProfileResolver) ([]types.LogMessage, error) {
+	var root interface{}
+	if err := json.Unmarshal(payload, &root); err != nil {
+		return nil, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+
+	records := []interface{}{root}
+	if m.Records != "" {
+		value, err := lookup(root, root, m.Records)
+		if err != nil {
+			return nil, err
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("records path %q is not an array", m.Records)
+		}
+		records = list
+	}
+
+	messages := make([]types.LogMessage, 0, len(records))
+	for i, record := range records {
+		msgs, err := m.toLogMessages(root, record, profiles)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		messages = append(messages, msgs...)
+	}
+	return messages, nil
+}
+
+func (m *Mapping) toLogMessages(root, record interface{}, profiles ProfileResolver) ([]types.LogMessage, error) {
+	msg := types.LogMessage{LogType: "INFO"}
+	var uplink, profile string
+	fPort := 0
+
+	for name, template := range m.Fields {
+		value, err := resolve(template, root, record)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		if value == nil {
+			continue
+		}
+
+		switch name {
+		case "time":
+			t, err := toTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("field time: %w", err)
+			}
+			msg.Time = t
+		case "raw_value":
+			v, err := toFloat(value)
+			if err != nil {
+				return nil, fmt.Errorf("field raw_value: %w", err)
+			}
+			msg.RawValue = &v
+		case "device_id":
+			msg.DeviceID = toString(value)
+		case "device_type":
+			msg.DeviceType = toString(value)
+		case "location":
+			msg.Location = toString(value)
+		case "unit":
+			msg.Unit = toString(value)
+		case "log_type":
+			msg.LogType = strings.ToUpper(toString(value))
+		case "message":
+			msg.Message = toString(value)
+		case "payload":
+			uplink = toString(value)
+		case "profile":
+			profile = toString(value)
+		case "f_port":
+			v, err := toFloat(value)
+			if err != nil {
+				return nil, fmt.Errorf("field f_port: %w", err)
+			}
+			fPort = int(v)
+		}
+	}
+
+	if msg.DeviceType == "" {
+		msg.DeviceType = "webhook:" + m.Source
+	}
+	if msg.Message == "" {
+		msg.Message = fmt.Sprintf("Webhook reading from %s", m.Source)
+	}
+
+	if uplink == "" {
+		return []types.LogMessage{msg}, nil
+	}
+	return m.decode(msg, uplink, profile, fPort, profiles)
+}
+
+// decode expands an uplink into one reading per decoded value
+func (m *Mapping) decode(msg types.LogMessage, uplink, profile string, fPort int, profiles ProfileResolver) ([]types.LogMessage, error) {
+	if profiles == nil {
+		return nil, fmt.Errorf("no decoders available for profile %q", profile)
+	}
+	p, ok := profiles(profile)
+	if !ok {
+		return nil, fmt.Errorf("unknown device profile %q", profile)
+	}
+
+	data, err := decoder.DecodePayload(uplink, m.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("field payload: %w", err)
+	}
+	values, err := p.Decode(data, fPort)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]types.LogMessage, 0, len(values))
+	for _, v := range values {
+		reading := msg
+		value := v.Value
+		reading.RawValue = &value
+		if reading.Unit == "" || len(values) > 1 {
+			reading.Unit = v.Unit
+		}
+		// sensor_readings is keyed on (time, device_id), so multi-value uplinks get one device_id per value
+		if len(values) > 1 {
+			reading.DeviceID = msg.DeviceID + ":" + v.Name
+		}
+		if len(values) > 1 || m.Fields["device_type"] == "" {
+			reading.DeviceType = v.Name
+		}
+		messages = append(messages, reading)
+	}
+	return messages, nil
+}
+
+// resolve evaluates one field template against the payload root and current record
+func resolve(template string, root, record interface{}) (interface{}, error) {
+	trimmed := strings.TrimSpace(template)
+
+	// Whole-value extraction keeps numbers as numbers
+	if (strings.HasPrefix(trimmed, "$") || strings.HasPrefix(trimmed, "@")) && !strings.Contains(trimmed, "{{") {
+		return lookup(root, record, trimmed)
+	}
+
+	if !strings.Contains(template, "{{") {
+		return template, nil
+	}
+
+	var firstErr error
+	result := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		path := placeholder.FindStringSubmatch(match)[1]
+		value, err := lookup(root, record, path)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if value == nil {
+			return ""
+		}
+		return toString(value)
+	})
+	return result, firstErr
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to a number", value)
+}
+
+// toTime accepts RFC3339 strings or unix timestamps in seconds or milliseconds
+func toTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, nil
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return unixTime(f), nil
+		}
+		return time.Time{}, fmt.Errorf("unrecognized time %q", v)
+	case float64:
+		return unixTime(v), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to a time", value)
+}
+
+func unixTime(f float64) time.Time {
+	if f > 1e12 {
+		return time.UnixMilli(int64(f)).UTC()
+	}
+	return time.Unix(int64(f), 0).UTC()
+}
@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookup resolves a JSONPath-style expression against a decoded payload
+// Supported syntax: $ (payload root), @ (current record), .field, ['field'] and [index]
+// e.g. "$.end_device_ids.device_id" or "@.measurements[0].value"
+func lookup(root, current interface{}, path string) (interface{}, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var node interface{}
+	switch path[0] {
+	case '$':
+		node = root
+	case '@':
+		node = current
+	default:
+		return nil, fmt.Errorf("path %q must start with $ or @", path)
+	}
+
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			rest = rest[end+1:]
+			node = field(node, key)
+
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ['...'] in %q", path)
+			}
+			node = field(node, rest[2:end])
+			rest = rest[end+2:]
+
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [...] in %q", path)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q in %q", rest[1:end], path)
+			}
+			rest = rest[end+1:]
+			list, ok := node.([]interface{})
+			if !ok || idx < 0 || idx >= len(list) {
+				node = nil
+			} else {
+				node = list[idx]
+			}
+
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", rest, path)
+		}
+
+		if node == nil {
+			return nil, nil
+		}
+	}
+	return node, nil
+}
+
+func field(node interface{}, key string) interface{} {
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return obj[key]
+}
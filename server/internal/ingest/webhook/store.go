@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store keeps webhook mappings in the webhook_mappings table with an in-memory copy for the hot path
+type Store struct {
+	db       *sql.DB
+	mu       sync.RWMutex
+	mappings map[string]*Mapping
+}
+
+// NewStore creates a store and loads the existing mappings
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, mappings: make(map[string]*Mapping)}
+	return s, s.Load()
+}
+
+// Load (re)reads all mappings from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`SELECT source, records, fields, payload_encoding, token, updated_at FROM webhook_mappings`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	mappings := make(map[string]*Mapping)
+	for rows.Next() {
+		var m Mapping
+		var fields []byte
+		if err := rows.Scan(&m.Source, &m.Records, &fields, &m.Encoding, &m.Token, &m.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(fields, &m.Fields); err != nil {
+			return fmt.Errorf("invalid fields for %s: %w", m.Source, err)
+		}
+		mappings[m.Source] = &m
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.mappings = mappings
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns the mapping for a source
+func (s *Store) Get(source string) (*Mapping, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.mappings[source]
+	return m, ok
+}
+
+// List returns every mapping sorted by source
+func (s *Store) List() []Mapping {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Mapping, 0, len(s.mappings))
+	for _, m := range s.mappings {
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Source < list[j].Source })
+	return list
+}
+
+// Save validates and creates or replaces a mapping
+func (s *Store) Save(m Mapping) (*Mapping, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	fields, err := json.Marshal(m.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO webhook_mappings (source, records, fields, payload_encoding, token, updated_at)
+        VALUES ($1, $2, $3, $4, $5, NOW())
+        ON CONFLICT (source) DO UPDATE SET
+            records = EXCLUDED.records,
+            fields = EXCLUDED.fields,
+            payload_encoding = EXCLUDED.payload_encoding,
+            token = EXCLUDED.token,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := s.db.QueryRow(query, m.Source, m.Records, fields, m.Encoding, m.Token).Scan(&m.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save webhook mapping: %w", err)
+	}
+
+	s.mu.Lock()
+	s.mappings[m.Source] = &m
+	s.mu.Unlock()
+	return &m, nil
+}
+
+// Delete removes a mapping; it reports false if it did not exist
+func (s *Store) Delete(source string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM webhook_mappings WHERE source = $1`, source)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	s.mu.Lock()
+	delete(s.mappings, source)
+	s.mu.Unlock()
+	return n > 0, nil
+}
+
+// Import saves a batch of mappings (used by configuration bundles)
+func (s *Store) Import(mappings []Mapping) (int, error) {
+	for i, m := range mappings {
+		if _, err := s.Save(m); err != nil {
+			return i, fmt.Errorf("%s: %w", m.Source, err)
+		}
+	}
+	return len(mappings), nil
+}
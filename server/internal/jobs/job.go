@@ -0,0 +1,44 @@
+// persistent background jobs for analytical queries too slow for a synchronous request
+// jobs and their results live in the query_jobs table, so status survives reconnects;
+// jobs interrupted by a restart are marked failed when the manager starts
+
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Status is a job's lifecycle state
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished reports whether the job has reached a terminal state
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+// Job is one submitted query; Result is only loaded by Manager.Result
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Params     json.RawMessage `json:"params"`
+	Role       string          `json:"role"`
+	Status     Status          `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	RowCount   int             `json:"row_count"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Runner executes one kind of job and returns its rows; it must stop when ctx is cancelled
+type Runner func(ctx context.Context, params json.RawMessage) (rows []interface{}, err error)
@@ -0,0 +1,282 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	apperrors "edge-insights/internal/errors"
+)
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = fmt.Errorf("job %w", apperrors.ErrNotFound)
+
+// Manager runs submitted jobs on a bounded worker pool and records them in query_jobs
+type Manager struct {
+	db        *sql.DB
+	runners   map[string]Runner
+	slots     chan struct{}
+	timeout   time.Duration
+	retention time.Duration
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// NewManager creates a manager running at most workers jobs at once, each limited to timeout,
+// and marks jobs left unfinished by a previous process as failed
+func NewManager(db *sql.DB, workers int, timeout, retention time.Duration) (*Manager, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	m := &Manager{
+		db:        db,
+		runners:   make(map[string]Runner),
+		slots:     make(chan struct{}, workers),
+		timeout:   timeout,
+		retention: retention,
+		cancels:   make(map[string]context.CancelFunc),
+	}
+
+	_, err := db.Exec(`
+        UPDATE query_jobs
+        SET status = 'failed', error = 'interrupted by server restart', finished_at = NOW()
+        WHERE status IN ('queued', 'running')
+    `)
+	return m, err
+}
+
+// Register adds a job kind; it must be called before jobs are submitted
+func (m *Manager) Register(kind string, runner Runner) {
+	m.runners[kind] = runner
+}
+
+// Known reports whether a job kind is registered
+func (m *Manager) Known(kind string) bool {
+	_, ok := m.runners[kind]
+	return ok
+}
+
+// Submit records a new job and starts it in the background
+func (m *Manager) Submit(kind string, params json.RawMessage, role string) (*Job, error) {
+	runner, ok := m.runners[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown job kind %q", kind)
+	}
+	if len(params) == 0 {
+		params = json.RawMessage(`{}`)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{ID: id, Kind: kind, Params: params, Role: role, Status: StatusQueued}
+	query := `
+        INSERT INTO query_jobs (id, kind, params, role, status)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING created_at
+    `
+	if err := m.db.QueryRow(query, job.ID, kind, []byte(params), role, job.Status).Scan(&job.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	m.mu.Lock()
+	m.cancels[job.ID] = cancel
+	m.mu.Unlock()
+
+	go m.run(ctx, cancel, job.ID, runner, params)
+	m.prune()
+	return job, nil
+}
+
+// run waits for a worker slot, executes the job and stores its outcome
+func (m *Manager) run(ctx context.Context, cancel context.CancelFunc, id string, runner Runner, params json.RawMessage) {
+	defer func() {
+		cancel()
+		m.mu.Lock()
+		delete(m.cancels, id)
+		m.mu.Unlock()
+	}()
+
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-ctx.Done():
+		m.finish(id, nil, ctx.Err())
+		return
+	}
+
+	if _, err := m.db.Exec(`UPDATE query_jobs SET status = 'running', started_at = NOW() WHERE id = $1 AND status = 'queued'`, id); err != nil {
+		log.Printf("Failed to mark job %s running: %v", id, err)
+	}
+
+	rows, err := runner(ctx, params)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	m.finish(id, rows, err)
+}
+
+// finish stores a job's result or error; a cancelled job keeps its cancelled status
+func (m *Manager) finish(id string, rows []interface{}, err error) {
+	status, message := StatusSucceeded, ""
+	switch {
+	case errors.Is(err, context.Canceled):
+		status, message = StatusCancelled, "cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		status, message = StatusFailed, fmt.Sprintf("timed out after %s", m.timeout)
+	case err != nil:
+		status, message = StatusFailed, err.Error()
+	}
+
+	var result []byte
+	if status == StatusSucceeded {
+		if rows == nil {
+			rows = []interface{}{}
+		}
+		var marshalErr error
+		if result, marshalErr = json.Marshal(rows); marshalErr != nil {
+			status, message = StatusFailed, "failed to encode result: "+marshalErr.Error()
+			result = nil
+		}
+	}
+
+	_, dbErr := m.db.Exec(`
+        UPDATE query_jobs
+        SET status = $2, error = NULLIF($3, ''), result = $4, row_count = $5, finished_at = NOW()
+        WHERE id = $1 AND status <> 'cancelled'
+    `, id, status, message, result, len(rows))
+	if dbErr != nil {
+		log.Printf("Failed to store result of job %s: %v", id, dbErr)
+	}
+}
+
+// Get returns a job's status without its result
+func (m *Manager) Get(id string) (*Job, error) {
+	var job Job
+	var params []byte
+	var message sql.NullString
+	err := m.db.QueryRow(`
+        SELECT id, kind, params, role, status, error, row_count, created_at, started_at, finished_at
+        FROM query_jobs WHERE id = $1
+    `, id).Scan(&job.ID, &job.Kind, &params, &job.Role, &job.Status, &message, &job.RowCount,
+		&job.CreatedAt, &job.StartedAt, &job.FinishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.Params = params
+	job.Error = message.String
+	return &job, nil
+}
+
+// List returns the most recent jobs, newest first
+func (m *Manager) List(limit int) ([]Job, error) {
+	return m.ListKind("", limit)
+}
+
+// ListKind returns the most recent jobs of one kind (every kind when empty), newest first
+func (m *Manager) ListKind(kind string, limit int) ([]Job, error) {
+	rows, err := m.db.Query(`
+        SELECT id, kind, params, role, status, error, row_count, created_at, started_at, finished_at
+        FROM query_jobs
+        WHERE $1 = '' OR kind = $1
+        ORDER BY created_at DESC LIMIT $2
+    `, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var job Job
+		var params []byte
+		var message sql.NullString
+		if err := rows.Scan(&job.ID, &job.Kind, &params, &job.Role, &job.Status, &message, &job.RowCount,
+			&job.CreatedAt, &job.StartedAt, &job.FinishedAt); err != nil {
+			return nil, err
+		}
+		job.Params = params
+		job.Error = message.String
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// Result returns the stored rows of a succeeded job
+func (m *Manager) Result(id string) ([]interface{}, error) {
+	job, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != StatusSucceeded {
+		return nil, fmt.Errorf("job is %s", job.Status)
+	}
+
+	var raw []byte
+	if err := m.db.QueryRow(`SELECT result FROM query_jobs WHERE id = $1`, id).Scan(&raw); err != nil {
+		return nil, err
+	}
+	var rows []interface{}
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return nil, fmt.Errorf("invalid stored result: %w", err)
+	}
+	return rows, nil
+}
+
+// Cancel stops a queued or running job; it reports false if the job had already finished
+func (m *Manager) Cancel(id string) (bool, error) {
+	result, err := m.db.Exec(`
+        UPDATE query_jobs SET status = 'cancelled', error = 'cancelled', finished_at = NOW()
+        WHERE id = $1 AND status IN ('queued', 'running')
+    `, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	if n == 0 {
+		if _, err := m.Get(id); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	m.mu.Lock()
+	if cancel, ok := m.cancels[id]; ok {
+		cancel()
+	}
+	m.mu.Unlock()
+	return true, nil
+}
+
+// prune deletes finished jobs older than the retention period
+func (m *Manager) prune() {
+	interval := fmt.Sprintf("%d seconds", int64(m.retention.Seconds()))
+	if _, err := m.db.Exec(`
+        DELETE FROM query_jobs
+        WHERE status IN ('succeeded', 'failed', 'cancelled') AND finished_at < NOW() - $1::interval
+    `, interval); err != nil {
+		log.Printf("Failed to prune query jobs: %v", err)
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,92 @@
+// configures the process-wide structured logger and carries correlation IDs
+// (HTTP request and WebSocket connection) through contexts into every log record
+
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup installs a slog default logger configured from the environment:
+// LOG_LEVEL (debug, info, warn, error; default info) and LOG_FORMAT (json, default, or text).
+// Output from the standard log package is routed through it at info level
+func Setup() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	connIDKey
+)
+
+// NewID returns a random 16-character hex ID
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns ctx carrying an HTTP request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithConnID returns ctx carrying a WebSocket connection ID
+func WithConnID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, connIDKey, id)
+}
+
+// ConnID returns the connection ID carried by ctx, or ""
+func ConnID(ctx context.Context) string {
+	id, _ := ctx.Value(connIDKey).(string)
+	return id
+}
+
+// contextHandler adds request_id and conn_id from the record's context, so any
+// slog.*Context call made while serving a request or connection is correlated
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id := ConnID(ctx); id != "" {
+		r.AddAttrs(slog.String("conn_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,299 @@
+package logtemplate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+const (
+	// maxTemplatesPerDay bounds the templates kept for one device and day; a device logging ever
+	// new text has the rest counted under OtherTemplate instead of growing the table
+	maxTemplatesPerDay = 200
+	// OtherTemplate counts the messages of a device and day beyond maxTemplatesPerDay templates
+	OtherTemplate = "<other>"
+)
+
+// TemplateCount is how often a template was logged
+type TemplateCount struct {
+	LogType   string    `json:"log_type"`
+	Template  string    `json:"template"`
+	Count     int64     `json:"count"`
+	Example   string    `json:"example"` // the latest message with this template
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// DeviceDay is the most frequent templates of one device on one (UTC) day
+type DeviceDay struct {
+	Day       string          `json:"day"`
+	DeviceID  string          `json:"device_id"`
+	Templates []TemplateCount `json:"templates"`
+}
+
+// Recurring is a template of one device counted over several days
+type Recurring struct {
+	DeviceID string `json:"device_id"`
+	TemplateCount
+}
+
+type key struct {
+	day      string
+	deviceID string
+	logType  string
+	template string
+}
+
+type deviceDay struct {
+	day      string
+	deviceID string
+}
+
+// Rollup counts the templates of stored readings per device and day, in memory until the next
+// flush to message_templates_daily. Counts not yet flushed are lost on a crash
+type Rollup struct {
+	db      *sql.DB
+	mu      sync.Mutex
+	pending map[key]*TemplateCount
+	seen    map[deviceDay]map[string]bool // templates of each device and day, to apply maxTemplatesPerDay
+}
+
+// NewRollup creates a rollup and loads the templates already stored for today and yesterday
+func NewRollup(db *sql.DB) (*Rollup, error) {
+	r := &Rollup{
+		db:      db,
+		pending: make(map[key]*TemplateCount),
+		seen:    make(map[deviceDay]map[string]bool),
+	}
+	rows, err := db.Query(`
+        SELECT to_char(day, 'YYYY-MM-DD'), device_id, template
+        FROM message_templates_daily
+        WHERE day >= (NOW() AT TIME ZONE 'UTC')::date - 1
+    `)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dd deviceDay
+		var template string
+		if err := rows.Scan(&dd.day, &dd.deviceID, &template); err != nil {
+			return r, err
+		}
+		r.markSeen(dd, template)
+	}
+	return r, rows.Err()
+}
+
+func (r *Rollup) markSeen(dd deviceDay, template string) {
+	templates, ok := r.seen[dd]
+	if !ok {
+		templates = make(map[string]bool)
+		r.seen[dd] = templates
+	}
+	templates[template] = true
+}
+
+// Observe counts the template of a stored reading's message; readings without one are ignored
+func (r *Rollup) Observe(msg types.LogMessage) {
+	if msg.Message == "" {
+		return
+	}
+	at := msg.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	dd := deviceDay{day: at.UTC().Format(time.DateOnly), deviceID: msg.DeviceID}
+	template := Template(msg.Message)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.seen[dd][template] && len(r.seen[dd]) >= maxTemplatesPerDay {
+		template = OtherTemplate
+	}
+	r.markSeen(dd, template)
+
+	k := key{day: dd.day, deviceID: dd.deviceID, logType: msg.LogType, template: template}
+	count, ok := r.pending[k]
+	if !ok {
+		count = &TemplateCount{LogType: msg.LogType, Template: template, FirstSeen: at, LastSeen: at}
+		r.pending[k] = count
+	}
+	count.Count++
+	if at.Before(count.FirstSeen) {
+		count.FirstSeen = at
+	}
+	if !at.Before(count.LastSeen) {
+		count.LastSeen, count.Example = at, msg.Message
+	} else if count.Example == "" {
+		count.Example = msg.Message
+	}
+}
+
+// Start flushes the counts every interval
+func (r *Rollup) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := r.Flush(); err != nil {
+				slog.Error("Failed to write message templates", "error", err)
+			}
+		}
+	}()
+}
+
+// Flush adds the counts observed since the last flush to message_templates_daily in one statement
+// On failure they are kept for the next flush
+func (r *Rollup) Flush() error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[key]*TemplateCount)
+	// Only today and yesterday still receive readings (late ones land in yesterday at most)
+	oldest := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	for dd := range r.seen {
+		if dd.day < oldest {
+			delete(r.seen, dd)
+		}
+	}
+	r.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var (
+		days, deviceIDs, logTypes, templates, examples []string
+		counts                                         []int64
+		firstSeen, lastSeen                            []time.Time
+	)
+	for k, c := range pending {
+		days = append(days, k.day)
+		deviceIDs = append(deviceIDs, k.deviceID)
+		logTypes = append(logTypes, k.logType)
+		templates = append(templates, k.template)
+		counts = append(counts, c.Count)
+		examples = append(examples, c.Example)
+		firstSeen = append(firstSeen, c.FirstSeen)
+		lastSeen = append(lastSeen, c.LastSeen)
+	}
+
+	_, err := r.db.Exec(`
+        INSERT INTO message_templates_daily (day, device_id, log_type, template, count, example, first_seen, last_seen)
+        SELECT t.day::date, t.device_id, t.log_type, t.template, t.count, t.example, t.first_seen, t.last_seen
+        FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::int8[], $6::text[], $7::timestamptz[], $8::timestamptz[])
+            AS t(day, device_id, log_type, template, count, example, first_seen, last_seen)
+        ON CONFLICT (day, device_id, log_type, template) DO UPDATE SET
+            count = message_templates_daily.count + EXCLUDED.count,
+            example = CASE WHEN EXCLUDED.last_seen >= message_templates_daily.last_seen
+                           THEN EXCLUDED.example ELSE message_templates_daily.example END,
+            first_seen = LEAST(message_templates_daily.first_seen, EXCLUDED.first_seen),
+            last_seen = GREATEST(message_templates_daily.last_seen, EXCLUDED.last_seen)
+    `, days, deviceIDs, logTypes, templates, counts, examples, firstSeen, lastSeen)
+	if err != nil {
+		r.restore(pending)
+		return err
+	}
+	return nil
+}
+
+// restore merges counts that failed to flush back into the pending ones
+func (r *Rollup) restore(pending map[key]*TemplateCount) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, c := range pending {
+		current, ok := r.pending[k]
+		if !ok {
+			r.pending[k] = c
+			continue
+		}
+		current.Count += c.Count
+		if c.FirstSeen.Before(current.FirstSeen) {
+			current.FirstSeen = c.FirstSeen
+		}
+		if c.LastSeen.After(current.LastSeen) {
+			current.LastSeen, current.Example = c.LastSeen, c.Example
+		}
+	}
+}
+
+// Filter selects the rollup rows read by Top
+type Filter struct {
+	DeviceID string
+	LogTypes []string  // empty for every log type
+	Start    time.Time // first day, inclusive
+	End      time.Time // last day, inclusive
+}
+
+// Top returns the k most frequent templates of every device and day matching f, newest day first
+func Top(ctx context.Context, db *sql.DB, f Filter, k int) ([]DeviceDay, error) {
+	var logTypes interface{}
+	if len(f.LogTypes) > 0 {
+		logTypes = f.LogTypes
+	}
+	rows, err := db.QueryContext(ctx, `
+        SELECT to_char(day, 'YYYY-MM-DD'), device_id, log_type, template, count, example, first_seen, last_seen
+        FROM (
+            SELECT *, row_number() OVER (PARTITION BY day, device_id ORDER BY count DESC, template) AS rank
+            FROM message_templates_daily
+            WHERE day BETWEEN $1::date AND $2::date
+              AND ($3 = '' OR device_id = $3)
+              AND ($4::text[] IS NULL OR log_type = ANY($4::text[]))
+        ) ranked
+        WHERE rank <= $5
+        ORDER BY day DESC, device_id, rank
+    `, f.Start.UTC().Format(time.DateOnly), f.End.UTC().Format(time.DateOnly), f.DeviceID, logTypes, k)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DeviceDay{}
+	for rows.Next() {
+		var day, deviceID string
+		var c TemplateCount
+		if err := rows.Scan(&day, &deviceID, &c.LogType, &c.Template, &c.Count, &c.Example, &c.FirstSeen, &c.LastSeen); err != nil {
+			return nil, err
+		}
+		if n := len(days); n == 0 || days[n-1].Day != day || days[n-1].DeviceID != deviceID {
+			days = append(days, DeviceDay{Day: day, DeviceID: deviceID})
+		}
+		days[len(days)-1].Templates = append(days[len(days)-1].Templates, c)
+	}
+	return days, rows.Err()
+}
+
+// RecurringBetween returns the most frequent templates of the given log types summed over the days
+// the range start (inclusive) to end (exclusive) touches, whole UTC days, up to limit across devices
+func RecurringBetween(ctx context.Context, db *sql.DB, start, end time.Time, logTypes []string, limit int) ([]Recurring, error) {
+	if len(logTypes) == 0 {
+		return nil, fmt.Errorf("log types are required")
+	}
+	rows, err := db.QueryContext(ctx, `
+        SELECT device_id, log_type, template, sum(count),
+               (array_agg(example ORDER BY last_seen DESC))[1], min(first_seen), max(last_seen)
+        FROM message_templates_daily
+        WHERE day BETWEEN $1::date AND $2::date AND log_type = ANY($3::text[])
+        GROUP BY device_id, log_type, template
+        ORDER BY 4 DESC, max(last_seen) DESC
+        LIMIT $4
+    `, start.UTC().Format(time.DateOnly), end.Add(-time.Nanosecond).UTC().Format(time.DateOnly), logTypes, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recurring := []Recurring{}
+	for rows.Next() {
+		var r Recurring
+		if err := rows.Scan(&r.DeviceID, &r.LogType, &r.Template, &r.Count, &r.Example, &r.FirstSeen, &r.LastSeen); err != nil {
+			return nil, err
+		}
+		recurring = append(recurring, r)
+	}
+	return recurring, rows.Err()
+}
@@ -0,0 +1,54 @@
+// Package logtemplate reduces log messages to templates — the message with its variable parts
+// (numbers, IDs, addresses, quoted values) masked — and keeps a daily rollup of how often each
+// device sent each template, so recurring messages can be counted without scanning raw readings
+package logtemplate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxTemplateLength bounds a stored template; longer messages are cut
+const maxTemplateLength = 300
+
+// masks are applied in order, most specific first, so e.g. an IP address is not read as numbers
+var masks = []struct {
+	re          *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`(?i)\b([0-9a-f]{2}[:-]){5}[0-9a-f]{2}\b`), "<mac>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]*[a-f][0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`(\B[-+])?\d+(\.\d+)?`), "<num>"},
+}
+
+// Template returns the template of a message, e.g. "Temperature 85.2C above limit 80 on 10.0.0.7"
+// becomes "Temperature <num>C above limit <num> on <ip>"
+func Template(message string) string {
+	t := strings.Join(strings.Fields(message), " ")
+	for _, m := range masks {
+		t = m.re.ReplaceAllStringFunc(t, func(match string) string {
+			if m.placeholder == "<hex>" && !isHexID(match) {
+				return match
+			}
+			return m.placeholder
+		})
+	}
+	if runes := []rune(t); len(runes) > maxTemplateLength {
+		t = string(runes[:maxTemplateLength])
+	}
+	return t
+}
+
+// isHexID reports whether a hex-looking word is an ID: 0x-prefixed, or at least 8 characters with
+// both digits and letters, so words such as "facade" and units such as "85C" are kept
+func isHexID(word string) bool {
+	if strings.HasPrefix(strings.ToLower(word), "0x") {
+		return true
+	}
+	return len(word) >= 8 && strings.ContainsAny(word, "0123456789") &&
+		strings.ContainsAny(strings.ToLower(word), "abcdef")
+}
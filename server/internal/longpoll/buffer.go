@@ -0,0 +1,149 @@
+// Package longpoll keeps the most recent stored readings in memory, numbered in the order they
+// were stored, so HTTP clients that can use neither WebSocket nor SSE can follow the live feed by
+// polling with a cursor: a request returns the readings after its cursor, or waits for the next
+// ones when it is caught up
+package longpoll
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// Buffer is a ring of the last Size readings, numbered from 0
+type Buffer struct {
+	epoch string // distinguishes the cursors of this process from those of a previous one
+
+	mu      sync.Mutex
+	entries []types.LogMessage // reading n is at n % Size
+	next    uint64             // sequence number of the next reading; entries hold next-len..next-1
+	wake    chan struct{}      // closed and replaced on every Publish
+}
+
+// NewBuffer creates a buffer of the last size readings
+func NewBuffer(size int) *Buffer {
+	if size < 1 {
+		size = 1
+	}
+	return &Buffer{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		entries: make([]types.LogMessage, 0, size),
+		wake:    make(chan struct{}),
+	}
+}
+
+// Publish adds a stored reading and wakes the waiting polls; it never blocks on them
+func (b *Buffer) Publish(msg types.LogMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) < cap(b.entries) {
+		b.entries = append(b.entries, msg)
+	} else {
+		b.entries[b.next%uint64(cap(b.entries))] = msg // the oldest
+	}
+	b.next++
+	close(b.wake)
+	b.wake = make(chan struct{})
+}
+
+// Page is the answer to a poll
+type Page struct {
+	Readings []types.LogMessage
+	Cursor   string // pass back to get the readings after these
+	// Reset is set when the cursor was unknown (another server process) or older than the buffer:
+	// readings may have been missed, and the page starts at the oldest one still held
+	Reset bool
+}
+
+// Cursor is a cursor at the newest reading, for polls that only want what comes next
+func (b *Buffer) Cursor() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cursor(b.next)
+}
+
+func (b *Buffer) cursor(seq uint64) string {
+	return fmt.Sprintf("%s.%d", b.epoch, seq)
+}
+
+// parse returns the sequence number a cursor resumes from; ok is false for cursors of another process
+func (b *Buffer) parse(cursor string) (seq uint64, ok bool) {
+	epoch, n, found := strings.Cut(cursor, ".")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(n, 10, 64)
+	return seq, err == nil
+}
+
+// ValidCursor reports whether cursor has the form of a cursor, from this process or another
+func ValidCursor(cursor string) bool {
+	_, n, found := strings.Cut(cursor, ".")
+	_, err := strconv.ParseUint(n, 10, 64)
+	return found && err == nil
+}
+
+// Poll returns up to limit readings after cursor that pass match (nil: all), waiting until maxWait
+// for one to arrive when there are none yet. An empty cursor starts at the newest reading. The
+// returned cursor moves past the readings that did not match too, so they are not scanned again
+func (b *Buffer) Poll(ctx context.Context, cursor string, match func(types.LogMessage) bool, limit int, maxWait time.Duration) Page {
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	b.mu.Lock()
+	from, reset := b.next, false
+	if cursor != "" {
+		var ok bool
+		if from, ok = b.parse(cursor); !ok || from > b.next {
+			from, reset = b.oldest(), true
+		}
+	}
+	b.mu.Unlock()
+
+	for {
+		page, wake := b.collect(from, match, limit)
+		page.Reset = page.Reset || reset
+		if len(page.Readings) > 0 {
+			return page
+		}
+		select {
+		case <-wake:
+			from, _ = b.parse(page.Cursor)
+		case <-timer.C:
+			return page
+		case <-ctx.Done():
+			return page
+		}
+	}
+}
+
+// collect reads the matching readings from sequence number from on; with none, it returns the
+// channel closed by the next Publish
+func (b *Buffer) collect(from uint64, match func(types.LogMessage) bool, limit int) (Page, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var page Page
+	if oldest := b.oldest(); from < oldest {
+		from, page.Reset = oldest, true
+	}
+	size := uint64(cap(b.entries))
+	for ; from < b.next && len(page.Readings) < limit; from++ {
+		msg := b.entries[from%size]
+		if match == nil || match(msg) {
+			page.Readings = append(page.Readings, msg)
+		}
+	}
+	page.Cursor = b.cursor(from)
+	return page, b.wake
+}
+
+// oldest is the sequence number of the oldest reading held
+func (b *Buffer) oldest() uint64 {
+	return b.next - uint64(len(b.entries))
+}
@@ -0,0 +1,213 @@
+// predictive maintenance: devices are ranked by how likely they are to fail soon, from their
+// error-rate level and trend, anomaly frequency, drift away from their learned baseline and age
+
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"edge-insights/internal/anomaly"
+)
+
+// Each factor is scaled to 0..1 and weighted; the weights add up to 1 so scores run from 0 to 100
+const (
+	weightErrorRate  = 0.25
+	weightErrorTrend = 0.20
+	weightAnomalies  = 0.25
+	weightDrift      = 0.20
+	weightAge        = 0.10
+
+	// A factor reaches 1 at these levels
+	fullErrorRate     = 0.20 // a fifth of recent readings are errors
+	fullErrorTrend    = 0.10 // the error rate rose by 10 percentage points
+	fullAnomaliesDay  = 1.0  // one anomaly a day over the window
+	fullDriftDeviance = 3.0  // the recent mean is 3 standard deviations from the baseline mean
+)
+
+// Options narrows and tunes a scoring run
+type Options struct {
+	DeviceType string
+	Location   string
+	// Window is the history scored; its last Recent is compared with the rest for the error trend
+	Window time.Duration
+	Recent time.Duration
+	// Lifetime is the service life a device reaches age factor 1 at; registered devices only
+	Lifetime time.Duration
+}
+
+// Factors are a device's raw measurements and the 0..1 factors derived from them
+type Factors struct {
+	Readings         int64    `json:"readings"`
+	RecentErrorRate  float64  `json:"recent_error_rate"`
+	PriorErrorRate   *float64 `json:"prior_error_rate"` // nil without readings before the recent period
+	Anomalies        int64    `json:"anomalies"`
+	Drift            *float64 `json:"drift"`    // standard deviations from the baseline mean; nil without a baseline
+	AgeDays          *float64 `json:"age_days"` // nil for unregistered devices
+	ErrorRateFactor  float64  `json:"error_rate_factor"`
+	ErrorTrendFactor float64  `json:"error_trend_factor"`
+	AnomalyFactor    float64  `json:"anomaly_factor"`
+	DriftFactor      float64  `json:"drift_factor"`
+	AgeFactor        float64  `json:"age_factor"`
+}
+
+// Score is a device's maintenance priority
+type Score struct {
+	DeviceID   string    `json:"device_id"`
+	DeviceType string    `json:"device_type"`
+	Location   string    `json:"location"`
+	Score      float64   `json:"score"` // 0 (healthy) to 100 (most likely to fail)
+	Factors    Factors   `json:"factors"`
+	Reasons    []string  `json:"reasons"` // the factors that raised the score, largest first
+	LastSeen   time.Time `json:"last_seen"`
+	Rationale  string    `json:"rationale,omitempty"`
+}
+
+// Rank scores every device with readings in the window and returns them highest score first
+// Baselines are the learned anomaly baselines by device ID, used for drift
+func Rank(ctx context.Context, db *sql.DB, baselines map[string]anomaly.Baseline, opts Options) ([]Score, error) {
+	if opts.Window <= 0 || opts.Recent <= 0 || opts.Recent >= opts.Window {
+		return nil, fmt.Errorf("recent must be positive and shorter than the window")
+	}
+	end := time.Now()
+	start := end.Add(-opts.Window)
+	recent := end.Add(-opts.Recent)
+
+	rows, err := db.QueryContext(ctx, `
+        WITH readings AS (
+            SELECT device_id,
+                   MAX(device_type) AS device_type,
+                   MAX(COALESCE(location, '')) AS location,
+                   COUNT(*) FILTER (WHERE time >= $3) AS recent_total,
+                   COUNT(*) FILTER (WHERE time >= $3 AND log_type = 'ERROR') AS recent_errors,
+                   COUNT(*) FILTER (WHERE time < $3) AS prior_total,
+                   COUNT(*) FILTER (WHERE time < $3 AND log_type = 'ERROR') AS prior_errors,
+                   AVG(raw_value) FILTER (WHERE time >= $3) AS recent_mean,
+                   MAX(time) AS last_seen
+            FROM sensor_readings
+            WHERE time >= $1 AND time < $2
+              AND ($4 = '' OR device_type = $4)
+              AND ($5 = '' OR location = $5)
+            GROUP BY device_id
+        ),
+        anomalies AS (
+            SELECT device_id, COUNT(*) AS anomalies
+            FROM incident_signals
+            WHERE kind = 'anomaly' AND time >= $1 AND time < $2
+            GROUP BY device_id
+        )
+        SELECT r.device_id, r.device_type, r.location, r.recent_total, r.recent_errors,
+               r.prior_total, r.prior_errors, r.recent_mean::float8, r.last_seen,
+               COALESCE(a.anomalies, 0), d.created_at
+        FROM readings r
+        LEFT JOIN anomalies a ON a.device_id = r.device_id
+        LEFT JOIN devices d ON d.id = r.device_id
+    `, start, end, recent, opts.DeviceType, opts.Location)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := opts.Window.Hours() / 24
+	var scores []Score
+	for rows.Next() {
+		var s Score
+		var recentTotal, recentErrors, priorTotal, priorErrors int64
+		var recentMean sql.NullFloat64
+		var createdAt sql.NullTime
+		if err := rows.Scan(&s.DeviceID, &s.DeviceType, &s.Location, &recentTotal, &recentErrors,
+			&priorTotal, &priorErrors, &recentMean, &s.LastSeen, &s.Factors.Anomalies, &createdAt); err != nil {
+			return nil, err
+		}
+
+		f := &s.Factors
+		f.Readings = recentTotal + priorTotal
+		if recentTotal > 0 {
+			f.RecentErrorRate = float64(recentErrors) / float64(recentTotal)
+			f.ErrorRateFactor = scale(f.RecentErrorRate, fullErrorRate)
+		}
+		if priorTotal > 0 {
+			prior := float64(priorErrors) / float64(priorTotal)
+			f.PriorErrorRate = &prior
+			if recentTotal > 0 {
+				f.ErrorTrendFactor = scale(f.RecentErrorRate-prior, fullErrorTrend)
+			}
+		}
+		f.AnomalyFactor = scale(float64(f.Anomalies)/days, fullAnomaliesDay)
+		if b, ok := baselines[s.DeviceID]; ok && recentMean.Valid && b.Variance > 0 {
+			drift := math.Abs(recentMean.Float64-b.Mean) / math.Sqrt(b.Variance)
+			f.Drift = &drift
+			f.DriftFactor = scale(drift, fullDriftDeviance)
+		}
+		if createdAt.Valid && opts.Lifetime > 0 {
+			age := end.Sub(createdAt.Time)
+			ageDays := age.Hours() / 24
+			f.AgeDays = &ageDays
+			f.AgeFactor = scale(age.Hours(), opts.Lifetime.Hours())
+		}
+
+		s.Score = math.Round(1000*(weightErrorRate*f.ErrorRateFactor+
+			weightErrorTrend*f.ErrorTrendFactor+
+			weightAnomalies*f.AnomalyFactor+
+			weightDrift*f.DriftFactor+
+			weightAge*f.AgeFactor)) / 10
+		s.Reasons = reasons(s.Factors, days)
+		scores = append(scores, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].DeviceID < scores[j].DeviceID
+	})
+	return scores, nil
+}
+
+// scale maps v onto 0..1, reaching 1 at full
+func scale(v, full float64) float64 {
+	return math.Max(0, math.Min(1, v/full))
+}
+
+// reasons describes the factors that contributed, largest weighted contribution first
+func reasons(f Factors, days float64) []string {
+	type reason struct {
+		weight float64
+		text   string
+	}
+	var found []reason
+	if f.ErrorRateFactor > 0 {
+		found = append(found, reason{weightErrorRate * f.ErrorRateFactor,
+			fmt.Sprintf("%.1f%% of recent readings are errors", 100*f.RecentErrorRate)})
+	}
+	if f.ErrorTrendFactor > 0 && f.PriorErrorRate != nil {
+		found = append(found, reason{weightErrorTrend * f.ErrorTrendFactor,
+			fmt.Sprintf("error rate rose from %.1f%% to %.1f%%", 100*(*f.PriorErrorRate), 100*f.RecentErrorRate)})
+	}
+	if f.AnomalyFactor > 0 {
+		found = append(found, reason{weightAnomalies * f.AnomalyFactor,
+			fmt.Sprintf("%d anomalies in %.0f days", f.Anomalies, days)})
+	}
+	if f.DriftFactor > 0 && f.Drift != nil {
+		found = append(found, reason{weightDrift * f.DriftFactor,
+			fmt.Sprintf("recent values drifted %.1f standard deviations from the baseline", *f.Drift)})
+	}
+	if f.AgeFactor > 0 && f.AgeDays != nil {
+		found = append(found, reason{weightAge * f.AgeFactor,
+			fmt.Sprintf("in service for %.0f days", *f.AgeDays)})
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].weight > found[j].weight })
+
+	texts := make([]string, len(found))
+	for i, r := range found {
+		texts[i] = r.text
+	}
+	return texts
+}
@@ -0,0 +1,49 @@
+// shared MQTT broker connection settings (MQTT_BROKER_URL, MQTT_USERNAME, MQTT_PASSWORD)
+
+package mqttclient
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Configured reports whether an MQTT broker has been configured
+func Configured() bool {
+	return os.Getenv("MQTT_BROKER_URL") != ""
+}
+
+// Connect opens an auto-reconnecting client to the configured broker
+// onConnect runs after every (re)connection, which is where subscriptions belong
+func Connect(clientID string, onConnect func(mqtt.Client)) (mqtt.Client, error) {
+	broker := os.Getenv("MQTT_BROKER_URL")
+	if broker == "" {
+		return nil, fmt.Errorf("MQTT_BROKER_URL is not set")
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(os.Getenv("MQTT_USERNAME")).
+		SetPassword(os.Getenv("MQTT_PASSWORD")).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetOrderMatters(false)
+	if onConnect != nil {
+		opts.SetOnConnectHandler(onConnect)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		// ConnectRetry keeps trying in the background
+		return client, nil
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDigestLines bounds how many notifications a digest lists; the rest are counted
+const maxDigestLines = 50
+
+// Digest batches a channel's low-severity notifications into one summary per interval
+// Critical notifications are always sent immediately
+type Digest struct {
+	Interval string `json:"interval"`           // e.g. "1h", at least 1m
+	Severity string `json:"severity,omitempty"` // highest severity batched: info (default) or warning
+}
+
+// Validate checks the digest and returns its interval
+func (d Digest) Validate() (time.Duration, error) {
+	interval, err := time.ParseDuration(d.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid digest interval: %w", err)
+	}
+	if interval < time.Minute {
+		return 0, fmt.Errorf("digest interval must be at least 1m")
+	}
+	switch d.Severity {
+	case "", SeverityInfo, SeverityWarning:
+	default:
+		return 0, fmt.Errorf("digest severity must be info or warning")
+	}
+	return interval, nil
+}
+
+// batches reports whether a notification of this severity waits for the digest
+func (d Digest) batches(severity string) bool {
+	if severity == SeverityCritical {
+		return false
+	}
+	return severity == SeverityInfo || d.Severity == SeverityWarning
+}
+
+// Channel returns the notifier for an alert rule's notify entry: the destination itself, or a
+// digest in front of it that is shared by every rule using the same configuration
+// Pending digests are kept in memory and lost on restart
+func Channel(config Config) (Notifier, error) {
+	notifier, err := New(config)
+	if err != nil || config.Digest == nil {
+		return notifier, err
+	}
+
+	interval, err := config.Digest.Validate()
+	if err != nil {
+		return nil, err
+	}
+	key, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	digestsMu.Lock()
+	defer digestsMu.Unlock()
+	d, ok := digests[string(key)]
+	if !ok {
+		d = &digestNotifier{config: *config.Digest, interval: interval, next: notifier, channel: config.Type}
+		digests[string(key)] = d
+	}
+	return d, nil
+}
+
+var (
+	digestsMu sync.Mutex
+	digests   = make(map[string]*digestNotifier) // by channel configuration
+)
+
+// digestNotifier queues batched notifications and sends them as one summary when the interval ends
+type digestNotifier struct {
+	config   Digest
+	interval time.Duration
+	next     Notifier
+	channel  string
+
+	mu      sync.Mutex
+	pending []Notification
+	started time.Time
+}
+
+// Notify sends critical (and, unless batched, warning) notifications and queues the rest
+func (d *digestNotifier) Notify(ctx context.Context, n Notification) error {
+	if !d.config.batches(n.Severity) {
+		return d.next.Notify(ctx, n)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending) == 0 {
+		d.started = time.Now()
+		time.AfterFunc(d.interval, d.flush)
+	}
+	d.pending = append(d.pending, n)
+	return nil
+}
+
+// flush sends the queued notifications as one summary
+func (d *digestNotifier) flush() {
+	d.mu.Lock()
+	pending, started := d.pending, d.started
+	d.pending = nil
+	d.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.next.Notify(ctx, summarize(pending, started)); err != nil {
+		slog.Error("Failed to send notification digest", "channel", d.channel, "alerts", len(pending), "error", err)
+	}
+}
+
+// summarize folds notifications into one, listing each as "[severity] title: message"
+func summarize(list []Notification, since time.Time) Notification {
+	severity := SeverityInfo
+	var lines strings.Builder
+	for i, n := range list {
+		if n.Severity == SeverityWarning {
+			severity = SeverityWarning
+		}
+		if i == maxDigestLines {
+			fmt.Fprintf(&lines, "... and %d more\n", len(list)-maxDigestLines)
+			continue
+		}
+		if i > maxDigestLines {
+			continue
+		}
+		title := n.Title
+		if n.Resolved {
+			title = "Resolved: " + title
+		}
+		fmt.Fprintf(&lines, "- [%s] %s: %s\n", n.Severity, title, n.Message)
+	}
+
+	alerts := "alerts"
+	if len(list) == 1 {
+		alerts = "alert"
+	}
+	now := time.Now()
+	return Notification{
+		Title:    fmt.Sprintf("Digest: %d %s since %s", len(list), alerts, since.UTC().Format(time.RFC3339)),
+		Message:  strings.TrimSuffix(lines.String(), "\n"),
+		Severity: severity,
+		Source:   "digest",
+		DedupKey: fmt.Sprintf("digest:%d", now.UnixNano()),
+		Time:     now,
+	}
+}
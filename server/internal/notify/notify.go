@@ -0,0 +1,206 @@
+// outgoing alert notifications with first-class formatting per destination
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"edge-insights/internal/devicetypes"
+	"edge-insights/internal/types"
+)
+
+// Severity levels carried by notifications
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Notification events; webhooks send them in X-Edge-Insights-Event
+const (
+	EventAlert   = "alert"
+	EventAnomaly = "anomaly"
+)
+
+// Notification is a destination-neutral alert event
+type Notification struct {
+	Event      string              `json:"event,omitempty"` // alert (default) or anomaly
+	Title      string              `json:"title"`
+	Message    string              `json:"message"`
+	Severity   string              `json:"severity"`
+	Source     string              `json:"source"`    // alert rule or detector that raised it
+	DedupKey   string              `json:"dedup_key"` // identifies the alert across fire/resolve
+	Resolved   bool                `json:"resolved"`
+	DeviceID   string              `json:"device_id,omitempty"`
+	DeviceType string              `json:"device_type,omitempty"`
+	Location   string              `json:"location,omitempty"`
+	Value      *float64            `json:"value,omitempty"`
+	Unit       string              `json:"unit,omitempty"`
+	Time       time.Time           `json:"time"`
+	URL        string              `json:"url,omitempty"`
+	Context    *types.AlertContext `json:"context,omitempty"`
+	// Runbook and RunbookLinks come from the alert rule; Remediation is a suggested fix
+	Runbook      string   `json:"runbook,omitempty"`
+	RunbookLinks []string `json:"runbook_links,omitempty"`
+	Remediation  string   `json:"remediation,omitempty"`
+}
+
+// Notifier delivers notifications to one destination
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Config selects and configures a notifier; alert rules carry a list of these
+type Config struct {
+	Type string `json:"type"` // "teams", "opsgenie" or "webhook"
+	// URL is the Teams incoming webhook / workflow URL, or where a webhook posts
+	URL string `json:"url,omitempty"`
+	// Secret signs webhook requests (HMAC-SHA256); optional
+	Secret string `json:"secret,omitempty"`
+	// APIKey and Region ("us" or "eu") configure Opsgenie
+	APIKey     string   `json:"api_key,omitempty"`
+	Region     string   `json:"region,omitempty"`
+	Responders []string `json:"responders,omitempty"` // Opsgenie team names
+	Tags       []string `json:"tags,omitempty"`
+	// Digest batches low-severity notifications to this destination into periodic summaries
+	Digest *Digest `json:"digest,omitempty"`
+}
+
+// MaskedValue stands for a URL, secret or API key in the configs returned by Masked
+const MaskedValue = "********"
+
+// Masked returns a copy of configs with the URLs, secrets and API keys replaced by MaskedValue,
+// for listing to callers that may not see the credentials
+func Masked(configs []Config) []Config {
+	if configs == nil {
+		return nil
+	}
+	masked := make([]Config, len(configs))
+	for i, config := range configs {
+		for _, field := range []*string{&config.URL, &config.Secret, &config.APIKey} {
+			if *field != "" {
+				*field = MaskedValue
+			}
+		}
+		masked[i] = config
+	}
+	return masked
+}
+
+// Unmasked undoes Masked for configs sent back on an update: a field still holding MaskedValue
+// keeps the value of the stored config at the same position, which must be of the same type
+func Unmasked(configs, stored []Config) ([]Config, error) {
+	if configs == nil {
+		return nil, nil
+	}
+	unmasked := make([]Config, len(configs))
+	for i, config := range configs {
+		for f, field := range []*string{&config.URL, &config.Secret, &config.APIKey} {
+			if *field != MaskedValue {
+				continue
+			}
+			if i >= len(stored) || stored[i].Type != config.Type {
+				return nil, fmt.Errorf("notify[%d] is masked but no %s notifier is stored at its position", i, config.Type)
+			}
+			*field = []string{stored[i].URL, stored[i].Secret, stored[i].APIKey}[f]
+		}
+		unmasked[i] = config
+	}
+	return unmasked, nil
+}
+
+// New builds the notifier described by config
+func New(config Config) (Notifier, error) {
+	if config.Digest != nil {
+		if _, err := config.Digest.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	switch config.Type {
+	case "teams":
+		if config.URL == "" {
+			return nil, fmt.Errorf("teams notifier needs a url")
+		}
+		return &Teams{url: config.URL, client: httpClient}, nil
+	case "opsgenie":
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("opsgenie notifier needs an api_key")
+		}
+		base := "https://api.opsgenie.com"
+		switch config.Region {
+		case "", "us":
+		case "eu":
+			base = "https://api.eu.opsgenie.com"
+		default:
+			return nil, fmt.Errorf("opsgenie region must be us or eu")
+		}
+		return &Opsgenie{baseURL: base, apiKey: config.APIKey, responders: config.Responders, tags: config.Tags, client: httpClient}, nil
+	case "webhook":
+		u, err := url.Parse(config.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook notifier needs an absolute http(s) url")
+		}
+		return &Webhook{url: config.URL, secret: config.Secret, client: httpClient, backoff: webhookBackoff}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q", config.Type)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON sends body and treats any non-2xx response as an error
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}, header http.Header) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+// facts lists the notification details shared by every formatter, in display order
+func facts(n Notification) [][2]string {
+	var list [][2]string
+	add := func(name, value string) {
+		if value != "" {
+			list = append(list, [2]string{name, value})
+		}
+	}
+	add("Severity", n.Severity)
+	add("Device", n.DeviceID)
+	add("Type", n.DeviceType)
+	add("Location", n.Location)
+	if n.Value != nil {
+		add("Value", devicetypes.FormatValue(n.DeviceType, *n.Value, n.Unit))
+	}
+	add("Source", n.Source)
+	if !n.Time.IsZero() {
+		add("Time", n.Time.UTC().Format(time.RFC3339))
+	}
+	return list
+}
@@ -0,0 +1,38 @@
+package notify
+
+import "testing"
+
+func TestUnmasked(t *testing.T) {
+	stored := []Config{
+		{Type: "webhook", URL: "https://hooks.example.com/a", Secret: "s3cret"},
+		{Type: "opsgenie", APIKey: "key-1", Region: "eu"},
+	}
+
+	// A listing sent back unchanged keeps every credential
+	got, err := Unmasked(Masked(stored), stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].URL != stored[0].URL || got[0].Secret != "s3cret" || got[1].APIKey != "key-1" {
+		t.Errorf("got %+v, want %+v", got, stored)
+	}
+
+	// New values replace the stored ones
+	got, err = Unmasked([]Config{{Type: "webhook", URL: "https://hooks.example.com/b", Secret: MaskedValue}}, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].URL != "https://hooks.example.com/b" || got[0].Secret != "s3cret" {
+		t.Errorf("got %+v", got[0])
+	}
+
+	// A masked field needs a stored notifier of the same type at its position
+	for _, configs := range [][]Config{
+		{{Type: "teams", URL: MaskedValue}},
+		{stored[0], stored[1], {Type: "webhook", Secret: MaskedValue}},
+	} {
+		if _, err := Unmasked(configs, stored); err == nil {
+			t.Errorf("%+v: want an error", configs)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Opsgenie creates and closes alerts through the Opsgenie Alert API v2
+type Opsgenie struct {
+	baseURL    string
+	apiKey     string
+	responders []string
+	tags       []string
+	client     *http.Client
+}
+
+// opsgeniePriorities maps notification severities onto Opsgenie priorities
+var opsgeniePriorities = map[string]string{
+	SeverityCritical: "P1",
+	SeverityWarning:  "P3",
+	SeverityInfo:     "P5",
+}
+
+// Notify opens an alert, or closes it when the notification is a resolution
+// The dedup key is used as the Opsgenie alias so repeats update the same alert
+func (o *Opsgenie) Notify(ctx context.Context, n Notification) error {
+	header := http.Header{"Authorization": []string{"GenieKey " + o.apiKey}}
+
+	if n.Resolved {
+		endpoint := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", o.baseURL, url.PathEscape(n.DedupKey))
+		return postJSON(ctx, o.client, endpoint, map[string]string{
+			"source": "edge-insights",
+			"note":   n.Message,
+		}, header)
+	}
+
+	return postJSON(ctx, o.client, o.baseURL+"/v2/alerts", o.alert(n), header)
+}
+
+// alert builds the create-alert request body
+func (o *Opsgenie) alert(n Notification) map[string]interface{} {
+	priority, ok := opsgeniePriorities[n.Severity]
+	if !ok {
+		priority = "P3"
+	}
+
+	// Opsgenie truncates messages at 130 characters
+	message := n.Title
+	if runes := []rune(message); len(runes) > 130 {
+		message = string(runes[:127]) + "..."
+	}
+
+	details := map[string]string{}
+	for _, f := range facts(n) {
+		details[f[0]] = f[1]
+	}
+	if n.URL != "" {
+		details["Link"] = n.URL
+	}
+
+	description := n.Message
+	if n.Context != nil && len(n.Context.RelatedLogs) > 0 {
+		description += "\n\nRelated logs:"
+		for _, l := range n.Context.RelatedLogs {
+			description += fmt.Sprintf("\n[%s] %s: %s", l.LogType, l.DeviceID, l.Message)
+		}
+	}
+
+	if n.Runbook != "" {
+		description += "\n\nRunbook:\n" + n.Runbook
+	}
+	for i, link := range n.RunbookLinks {
+		details[fmt.Sprintf("Runbook %d", i+1)] = link
+	}
+	if n.Remediation != "" {
+		description += "\n\nSuggested remediation:\n" + n.Remediation
+	}
+
+	alert := map[string]interface{}{
+		"message":     message,
+		"alias":       n.DedupKey,
+		"description": description,
+		"priority":    priority,
+		"source":      "edge-insights",
+		"entity":      n.DeviceID,
+		"details":     details,
+		"tags":        append([]string{n.Severity}, o.tags...),
+	}
+	if len(o.responders) > 0 {
+		var responders []map[string]string
+		for _, team := range o.responders {
+			responders = append(responders, map[string]string{"type": "team", "name": team})
+		}
+		alert["responders"] = responders
+	}
+	return alert
+}
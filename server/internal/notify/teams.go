@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Teams posts Adaptive Cards to a Microsoft Teams incoming webhook or Workflows URL
+type Teams struct {
+	url    string
+	client *http.Client
+}
+
+// Notify sends the notification as an Adaptive Card
+func (t *Teams) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, t.client, t.url, teamsCard(n), nil)
+}
+
+// teamsCard renders the message envelope Teams expects around an Adaptive Card
+func teamsCard(n Notification) map[string]interface{} {
+	color := map[string]string{
+		SeverityCritical: "Attention",
+		SeverityWarning:  "Warning",
+	}[n.Severity]
+	title := n.Title
+	if n.Resolved {
+		title = "Resolved: " + title
+		color = "Good"
+	}
+	if color == "" {
+		color = "Default"
+	}
+
+	var factSet []map[string]string
+	for _, f := range facts(n) {
+		factSet = append(factSet, map[string]string{"title": f[0], "value": f[1]})
+	}
+
+	body := []interface{}{
+		map[string]interface{}{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+		map[string]interface{}{"type": "TextBlock", "text": n.Message, "wrap": true},
+		map[string]interface{}{"type": "FactSet", "facts": factSet},
+	}
+
+	// Recent related logs give responders context without leaving Teams
+	if n.Context != nil && len(n.Context.RelatedLogs) > 0 {
+		lines := ""
+		for i, l := range n.Context.RelatedLogs {
+			if i == 5 {
+				break
+			}
+			lines += fmt.Sprintf("- **%s** %s: %s\n", l.LogType, l.DeviceID, l.Message)
+		}
+		body = append(body,
+			map[string]interface{}{"type": "TextBlock", "text": "Related logs", "weight": "Bolder", "spacing": "Medium"},
+			map[string]interface{}{"type": "TextBlock", "text": lines, "wrap": true},
+		)
+	}
+
+	if n.Runbook != "" {
+		body = append(body,
+			map[string]interface{}{"type": "TextBlock", "text": "Runbook", "weight": "Bolder", "spacing": "Medium"},
+			map[string]interface{}{"type": "TextBlock", "text": n.Runbook, "wrap": true},
+		)
+	}
+	if n.Remediation != "" {
+		body = append(body,
+			map[string]interface{}{"type": "TextBlock", "text": "Suggested remediation", "weight": "Bolder", "spacing": "Medium"},
+			map[string]interface{}{"type": "TextBlock", "text": n.Remediation, "wrap": true},
+		)
+	}
+
+	var actions []interface{}
+	if n.URL != "" {
+		actions = append(actions, map[string]interface{}{"type": "Action.OpenUrl", "title": "Open in Edge Insights", "url": n.URL})
+	}
+	for i, link := range n.RunbookLinks {
+		title := "Runbook"
+		if len(n.RunbookLinks) > 1 {
+			title = fmt.Sprintf("Runbook %d", i+1)
+		}
+		actions = append(actions, map[string]interface{}{"type": "Action.OpenUrl", "title": title, "url": link})
+	}
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if len(actions) > 0 {
+		card["actions"] = actions
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     card,
+			},
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// webhookAttempts is how many times a delivery is tried; waits double from webhookBackoff between tries
+const (
+	webhookAttempts = 4
+	webhookBackoff  = time.Second
+)
+
+// Webhook posts the notification as JSON to any URL, for Slack workflows, PagerDuty Events
+// integrations or internal incident tooling
+// With a secret, each request carries X-Edge-Insights-Signature: sha256=<hex HMAC-SHA256 of
+// "<X-Edge-Insights-Timestamp>.<body>">, so receivers can verify the sender and reject replays
+type Webhook struct {
+	url     string
+	secret  string
+	client  *http.Client
+	backoff time.Duration
+}
+
+// Notify delivers the notification, retrying network errors, 429 and 5xx responses with backoff
+func (wh *Webhook) Notify(ctx context.Context, n Notification) error {
+	if n.Event == "" {
+		n.Event = EventAlert
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	wait := wh.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := wh.post(ctx, n, payload)
+		if err == nil || !retry || attempt == webhookAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (after %d attempts: %v)", ctx.Err(), attempt, err)
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying
+func (wh *Webhook) post(ctx context.Context, n Notification, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "edge-insights")
+	req.Header.Set("X-Edge-Insights-Event", n.Event)
+	req.Header.Set("X-Edge-Insights-Delivery", n.DedupKey)
+	req.Header.Set("X-Edge-Insights-Timestamp", timestamp)
+	if wh.secret != "" {
+		req.Header.Set("X-Edge-Insights-Signature", "sha256="+Sign(wh.secret, timestamp, payload))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("%s returned %d: %s", wh.url, resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return false, nil
+}
+
+// Sign returns the hex HMAC-SHA256 receivers compare with X-Edge-Insights-Signature
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
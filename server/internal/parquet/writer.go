@@ -0,0 +1,365 @@
+// Package parquet writes flat Parquet files: one row group per RowGroupSize rows, one
+// Snappy-compressed PLAIN data page per column and row group, and optional columns with their
+// definition levels. It covers what exports of readings need (64-bit integers and timestamps,
+// doubles and strings), not the whole format
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// Physical types
+const (
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+)
+
+// Kind is what a column holds
+type Kind int
+
+const (
+	Int64     Kind = iota // int64
+	Double                // float64
+	String                // string, UTF-8
+	JSON                  // string or []byte holding a JSON document
+	Timestamp             // time.Time, stored as microseconds since the epoch in UTC
+)
+
+// Column describes one column of the file
+type Column struct {
+	Name     string
+	Kind     Kind
+	Optional bool // nil values are nulls; required columns reject them
+}
+
+// DefaultRowGroupSize is how many rows a row group holds unless Writer.RowGroupSize is set
+const DefaultRowGroupSize = 65536
+
+const (
+	magic   = "PAR1"
+	version = 1
+	// encodings, repetition and codec codes of the Parquet format
+	encodingPlain  = 0
+	encodingRLE    = 3
+	required       = 0
+	optional       = 1
+	codecSnappy    = 1
+	pageData       = 0
+	convertedUTF8  = 0
+	convertedMicro = 10
+	convertedJSON  = 19
+)
+
+// Writer writes rows to a Parquet file; Close writes the footer
+type Writer struct {
+	// RowGroupSize is how many rows are buffered before they are written as a row group
+	RowGroupSize int
+
+	w         io.Writer
+	offset    int64
+	columns   []Column
+	buffers   []columnBuffer
+	rows      int // rows in the buffered row group
+	numRows   int64
+	rowGroups []rowGroup
+	closed    bool
+}
+
+type columnBuffer struct {
+	values  bytes.Buffer
+	defined []bool // per row, for optional columns
+}
+
+type rowGroup struct {
+	columns   []columnChunk
+	numRows   int64
+	totalSize int64
+}
+
+type columnChunk struct {
+	offset       int64
+	numValues    int64
+	uncompressed int64
+	compressed   int64
+}
+
+// NewWriter starts a Parquet file with the given columns on w
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("parquet: no columns")
+	}
+	pw := &Writer{
+		RowGroupSize: DefaultRowGroupSize,
+		w:            w,
+		columns:      columns,
+		buffers:      make([]columnBuffer, len(columns)),
+	}
+	if err := pw.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	return err
+}
+
+// Write appends a row with one value per column, in column order
+func (w *Writer) Write(row []interface{}) error {
+	if w.closed {
+		return fmt.Errorf("parquet: write after close")
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(w.columns))
+	}
+	for i, v := range row {
+		if err := w.buffers[i].append(w.columns[i], v); err != nil {
+			return err
+		}
+	}
+	w.rows++
+	if w.rows >= w.RowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (b *columnBuffer) append(c Column, v interface{}) error {
+	if v == nil {
+		if !c.Optional {
+			return fmt.Errorf("parquet: null in required column %s", c.Name)
+		}
+		b.defined = append(b.defined, false)
+		return nil
+	}
+	if c.Optional {
+		b.defined = append(b.defined, true)
+	}
+
+	var scratch [8]byte
+	switch c.Kind {
+	case Int64:
+		n, ok := v.(int64)
+		if !ok {
+			return fmt.Errorf("parquet: column %s wants int64, got %T", c.Name, v)
+		}
+		binary.LittleEndian.PutUint64(scratch[:], uint64(n))
+		b.values.Write(scratch[:])
+	case Timestamp:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("parquet: column %s wants time.Time, got %T", c.Name, v)
+		}
+		binary.LittleEndian.PutUint64(scratch[:], uint64(t.UnixMicro()))
+		b.values.Write(scratch[:])
+	case Double:
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("parquet: column %s wants float64, got %T", c.Name, v)
+		}
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(f))
+		b.values.Write(scratch[:])
+	case String, JSON:
+		var data []byte
+		switch s := v.(type) {
+		case string:
+			data = []byte(s)
+		case []byte:
+			data = s
+		default:
+			return fmt.Errorf("parquet: column %s wants a string, got %T", c.Name, v)
+		}
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(data)))
+		b.values.Write(scratch[:4])
+		b.values.Write(data)
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group
+func (w *Writer) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	group := rowGroup{numRows: int64(w.rows)}
+	for i := range w.columns {
+		chunk, err := w.writeColumn(w.columns[i], &w.buffers[i])
+		if err != nil {
+			return err
+		}
+		group.columns = append(group.columns, chunk)
+		group.totalSize += chunk.uncompressed
+		w.buffers[i] = columnBuffer{}
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.numRows += int64(w.rows)
+	w.rows = 0
+	return nil
+}
+
+// writeColumn writes one column of the buffered rows as a single data page
+func (w *Writer) writeColumn(c Column, b *columnBuffer) (columnChunk, error) {
+	var page bytes.Buffer
+	if c.Optional {
+		levels := definitionLevels(b.defined)
+		var size [4]byte
+		binary.LittleEndian.PutUint32(size[:], uint32(len(levels)))
+		page.Write(size[:])
+		page.Write(levels)
+	}
+	page.Write(b.values.Bytes())
+	compressed := snappy.Encode(nil, page.Bytes())
+
+	header := newThriftWriter()
+	header.i32(1, pageData)
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(len(compressed)))
+	header.begin(5) // DataPageHeader
+	header.i32(1, int32(w.rows))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.end()
+	header.buf.WriteByte(0)
+
+	chunk := columnChunk{
+		offset:       w.offset,
+		numValues:    int64(w.rows),
+		uncompressed: int64(header.buf.Len() + page.Len()),
+		compressed:   int64(header.buf.Len() + len(compressed)),
+	}
+	if err := w.write(header.buf.Bytes()); err != nil {
+		return chunk, err
+	}
+	return chunk, w.write(compressed)
+}
+
+// definitionLevels encodes 0/1 levels with the RLE/bit-packing hybrid as a single bit-packed run
+// of bit width 1; the last group of 8 is padded with zeros
+func definitionLevels(defined []bool) []byte {
+	groups := (len(defined) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups)
+	for i, d := range defined {
+		if d {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return append(out, packed...)
+}
+
+// Close writes the remaining rows and the footer; it does not close the underlying writer
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	w.closed = true
+
+	meta := newThriftWriter()
+	meta.i32(1, version)
+	meta.list(2, thriftStruct, len(w.columns)+1)
+	meta.begin(0)
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(w.columns)))
+	meta.end()
+	for _, c := range w.columns {
+		writeSchemaElement(meta, c)
+	}
+	meta.i64(3, w.numRows)
+	meta.list(4, thriftStruct, len(w.rowGroups))
+	for _, g := range w.rowGroups {
+		meta.begin(0)
+		meta.list(1, thriftStruct, len(g.columns))
+		for i, chunk := range g.columns {
+			meta.begin(0)
+			meta.i64(2, chunk.offset)
+			meta.begin(3) // ColumnMetaData
+			meta.i32(1, physicalType(w.columns[i].Kind))
+			meta.listI32(2, []int32{encodingPlain, encodingRLE})
+			meta.listString(3, []string{w.columns[i].Name})
+			meta.i32(4, codecSnappy)
+			meta.i64(5, chunk.numValues)
+			meta.i64(6, chunk.uncompressed)
+			meta.i64(7, chunk.compressed)
+			meta.i64(9, chunk.offset)
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, g.totalSize)
+		meta.i64(3, g.numRows)
+		meta.end()
+	}
+	meta.string(6, "edge-insights")
+	meta.buf.WriteByte(0)
+
+	if err := w.write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(meta.buf.Len()))
+	if err := w.write(size[:]); err != nil {
+		return err
+	}
+	return w.write([]byte(magic))
+}
+
+func physicalType(k Kind) int32 {
+	switch k {
+	case Int64, Timestamp:
+		return typeInt64
+	case Double:
+		return typeDouble
+	}
+	return typeByteArray
+}
+
+// writeSchemaElement writes a leaf of the flat schema with its converted and logical type
+func writeSchemaElement(t *thriftWriter, c Column) {
+	t.begin(0)
+	t.i32(1, physicalType(c.Kind))
+	if c.Optional {
+		t.i32(3, optional)
+	} else {
+		t.i32(3, required)
+	}
+	t.string(4, c.Name)
+	switch c.Kind {
+	case String:
+		t.i32(6, convertedUTF8)
+		t.begin(10) // LogicalType
+		t.begin(1)  // STRING
+		t.end()
+		t.end()
+	case JSON:
+		t.i32(6, convertedJSON)
+		t.begin(10)
+		t.begin(12) // JSON
+		t.end()
+		t.end()
+	case Timestamp:
+		t.i32(6, convertedMicro)
+		t.begin(10)
+		t.begin(8) // TIMESTAMP
+		t.bool(1, true)
+		t.begin(2) // unit
+		t.begin(2) // MICROS
+		t.end()
+		t.end()
+		t.end()
+		t.end()
+	}
+	t.end()
+}
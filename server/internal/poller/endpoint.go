@@ -0,0 +1,128 @@
+// gateway mode: polls industrial equipment that cannot push data (Modbus TCP, OPC-UA)
+// and writes the values as sensor_readings through the normal ingestion path
+
+package poller
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Supported protocols
+const (
+	ProtocolModbus = "modbus"
+	ProtocolOPCUA  = "opcua"
+)
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Endpoint is one device or PLC polled on a fixed interval
+type Endpoint struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	// Address is host:port for Modbus TCP or an opc.tcp:// URL for OPC-UA
+	Address   string    `json:"address"`
+	Interval  string    `json:"interval"` // e.g. "30s"
+	Location  string    `json:"location"` // default location for tags that do not set one
+	Tags      []Tag     `json:"tags"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	interval time.Duration
+}
+
+// Tag maps one register or node onto a device
+type Tag struct {
+	DeviceID   string `json:"device_id"`
+	DeviceType string `json:"device_type"`
+	Location   string `json:"location,omitempty"`
+	Unit       string `json:"unit,omitempty"`
+
+	// Modbus: register table (holding, input, coil, discrete), 0-based address and data type
+	// (uint16, int16, uint32, int32, float32, bool); word_order "little" swaps 32-bit words
+	UnitID    int    `json:"unit_id,omitempty"`
+	Table     string `json:"table,omitempty"`
+	Address   int    `json:"address,omitempty"`
+	DataType  string `json:"data_type,omitempty"`
+	WordOrder string `json:"word_order,omitempty"`
+
+	// OPC-UA: node id, e.g. "ns=2;s=Boiler1.Temperature"
+	NodeID string `json:"node_id,omitempty"`
+
+	// value = raw * scale + offset
+	Scale  float64 `json:"scale,omitempty"`
+	Offset float64 `json:"offset,omitempty"`
+}
+
+// Validate checks the endpoint and fills in defaults
+func (e *Endpoint) Validate() error {
+	if !namePattern.MatchString(e.Name) {
+		return fmt.Errorf("name must be letters, digits, '_', '.' or '-'")
+	}
+	if _, ok := dialers[e.Protocol]; !ok {
+		return fmt.Errorf("unsupported protocol %q", e.Protocol)
+	}
+	if e.Address == "" {
+		return fmt.Errorf("address is required")
+	}
+
+	if e.Interval == "" {
+		e.Interval = "30s"
+	}
+	interval, err := time.ParseDuration(e.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid interval: %w", err)
+	}
+	if interval < time.Second {
+		return fmt.Errorf("interval must be at least 1s")
+	}
+	e.interval = interval
+
+	if len(e.Tags) == 0 {
+		return fmt.Errorf("at least one tag is required")
+	}
+	for i := range e.Tags {
+		if err := e.Tags[i].validate(e.Protocol); err != nil {
+			return fmt.Errorf("tag %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (t *Tag) validate(protocol string) error {
+	if t.DeviceID == "" || t.DeviceType == "" {
+		return fmt.Errorf("device_id and device_type are required")
+	}
+	if t.Scale == 0 {
+		t.Scale = 1
+	}
+
+	switch protocol {
+	case ProtocolModbus:
+		if t.Table == "" {
+			t.Table = "holding"
+		}
+		if t.DataType == "" {
+			t.DataType = "uint16"
+		}
+		if _, ok := modbusTables[t.Table]; !ok {
+			return fmt.Errorf("unknown register table %q", t.Table)
+		}
+		words, ok := modbusWords[t.DataType]
+		if !ok {
+			return fmt.Errorf("unknown data type %q", t.DataType)
+		}
+		if (t.Table == "coil" || t.Table == "discrete") != (words == 0) {
+			return fmt.Errorf("data type %q does not fit table %q", t.DataType, t.Table)
+		}
+		if t.Address < 0 || t.Address > 0xFFFF {
+			return fmt.Errorf("address out of range")
+		}
+	case ProtocolOPCUA:
+		if t.NodeID == "" {
+			return fmt.Errorf("node_id is required")
+		}
+	}
+	return nil
+}
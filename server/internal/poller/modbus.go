@@ -0,0 +1,152 @@
+package poller
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// modbusTables maps register tables to their read function codes
+var modbusTables = map[string]byte{
+	"coil":     0x01,
+	"discrete": 0x02,
+	"holding":  0x03,
+	"input":    0x04,
+}
+
+// modbusWords is the number of 16-bit registers each data type spans (0 for single bits)
+var modbusWords = map[string]int{
+	"bool":    0,
+	"uint16":  1,
+	"int16":   1,
+	"uint32":  2,
+	"int32":   2,
+	"float32": 2,
+}
+
+// modbusClient is a minimal Modbus TCP client supporting the four read functions
+type modbusClient struct {
+	mu          sync.Mutex
+	conn        net.Conn
+	transaction uint16
+	timeout     time.Duration
+}
+
+func dialModbus(ctx context.Context, address string) (Reader, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &modbusClient{conn: conn, timeout: 5 * time.Second}, nil
+}
+
+// ReadTag reads a tag's register(s) and converts them to a float
+func (c *modbusClient) ReadTag(ctx context.Context, tag Tag) (float64, error) {
+	function := modbusTables[tag.Table]
+	words := modbusWords[tag.DataType]
+
+	quantity := uint16(words)
+	if words == 0 {
+		quantity = 1
+	}
+
+	data, err := c.request(ctx, byte(tag.UnitID), function, uint16(tag.Address), quantity)
+	if err != nil {
+		return 0, err
+	}
+
+	if words == 0 {
+		if len(data) < 1 {
+			return 0, fmt.Errorf("short response")
+		}
+		return float64(data[0] & 0x01), nil
+	}
+	if len(data) < words*2 {
+		return 0, fmt.Errorf("short response")
+	}
+
+	var raw uint32
+	if words == 1 {
+		raw = uint32(binary.BigEndian.Uint16(data))
+	} else {
+		hi, lo := binary.BigEndian.Uint16(data[0:2]), binary.BigEndian.Uint16(data[2:4])
+		if tag.WordOrder == "little" {
+			hi, lo = lo, hi
+		}
+		raw = uint32(hi)<<16 | uint32(lo)
+	}
+
+	switch tag.DataType {
+	case "int16":
+		return float64(int16(raw)), nil
+	case "int32":
+		return float64(int32(raw)), nil
+	case "float32":
+		return float64(math.Float32frombits(raw)), nil
+	}
+	return float64(raw), nil
+}
+
+// request sends one read request and returns the response data bytes
+func (c *modbusClient) request(ctx context.Context, unitID, function byte, address, quantity uint16) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+
+	// MBAP header (transaction, protocol 0, length, unit) followed by the PDU
+	c.transaction++
+	frame := make([]byte, 12)
+	binary.BigEndian.PutUint16(frame[0:2], c.transaction)
+	binary.BigEndian.PutUint16(frame[2:4], 0)
+	binary.BigEndian.PutUint16(frame[4:6], 6)
+	frame[6] = unitID
+	frame[7] = function
+	binary.BigEndian.PutUint16(frame[8:10], address)
+	binary.BigEndian.PutUint16(frame[10:12], quantity)
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint16(header[0:2]) != c.transaction {
+		return nil, fmt.Errorf("transaction id mismatch")
+	}
+	length := int(binary.BigEndian.Uint16(header[4:6]))
+	if length < 2 || length > 256 {
+		return nil, fmt.Errorf("invalid response length %d", length)
+	}
+
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(c.conn, pdu); err != nil {
+		return nil, err
+	}
+	if len(pdu) < 2 {
+		return nil, fmt.Errorf("malformed response")
+	}
+	if pdu[0] == function|0x80 {
+		return nil, fmt.Errorf("modbus exception %d", pdu[1])
+	}
+	if pdu[0] != function || int(pdu[1]) != len(pdu)-2 {
+		return nil, fmt.Errorf("malformed response")
+	}
+	return pdu[2:], nil
+}
+
+// Close closes the TCP connection
+func (c *modbusClient) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,101 @@
+package poller
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeModbus answers one request on conn with the PDU built by respond, checking the request frame
+// The transaction id of the reply is the request's plus skew
+func fakeModbus(t *testing.T, conn net.Conn, wantRequest []byte, skew uint16, respond func(function byte) []byte) {
+	t.Helper()
+	go func() {
+		defer conn.Close()
+		request := make([]byte, 12)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		if !bytes.Equal(request[2:], wantRequest) {
+			t.Errorf("request = % x, want % x", request[2:], wantRequest)
+		}
+		pdu := respond(request[7])
+		reply := make([]byte, 7, 7+len(pdu))
+		binary.BigEndian.PutUint16(reply[0:2], binary.BigEndian.Uint16(request[0:2])+skew)
+		binary.BigEndian.PutUint16(reply[4:6], uint16(len(pdu)+1))
+		reply[6] = request[6]
+		conn.Write(append(reply, pdu...))
+	}()
+}
+
+func TestModbusReadTag(t *testing.T) {
+	float := make([]byte, 4)
+	binary.BigEndian.PutUint32(float, math.Float32bits(21.5))
+	tests := []struct {
+		name    string
+		tag     Tag
+		request []byte // protocol, length, unit, function, address, quantity
+		data    []byte
+		want    float64
+	}{
+		{"uint16", Tag{UnitID: 1, Table: "holding", Address: 10, DataType: "uint16"},
+			[]byte{0, 0, 0, 6, 1, 0x03, 0, 10, 0, 1}, []byte{0xFF, 0xFE}, 65534},
+		{"int16", Tag{UnitID: 2, Table: "input", Address: 0, DataType: "int16"},
+			[]byte{0, 0, 0, 6, 2, 0x04, 0, 0, 0, 1}, []byte{0xFF, 0xFE}, -2},
+		{"float32", Tag{UnitID: 1, Table: "holding", Address: 256, DataType: "float32"},
+			[]byte{0, 0, 0, 6, 1, 0x03, 1, 0, 0, 2}, float, 21.5},
+		{"float32 little word order", Tag{UnitID: 1, Table: "holding", Address: 0, DataType: "float32", WordOrder: "little"},
+			[]byte{0, 0, 0, 6, 1, 0x03, 0, 0, 0, 2}, append(append([]byte{}, float[2:]...), float[:2]...), 21.5},
+		{"coil", Tag{UnitID: 1, Table: "coil", Address: 3, DataType: "bool"},
+			[]byte{0, 0, 0, 6, 1, 0x01, 0, 3, 0, 1}, []byte{0x01}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			fakeModbus(t, server, tt.request, 0, func(function byte) []byte {
+				return append([]byte{function, byte(len(tt.data))}, tt.data...)
+			})
+
+			c := &modbusClient{conn: client, timeout: time.Second}
+			got, err := c.ReadTag(context.Background(), tt.tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ReadTag = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModbusResponseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		skew    uint16
+		respond func(function byte) []byte
+	}{
+		{"exception", 0, func(function byte) []byte { return []byte{function | 0x80, 0x02} }},
+		{"exception without a code", 0, func(function byte) []byte { return []byte{function | 0x80} }},
+		{"wrong function", 0, func(function byte) []byte { return []byte{function + 1, 2, 0, 1} }},
+		{"wrong byte count", 0, func(function byte) []byte { return []byte{function, 4, 0, 1} }},
+		{"transaction mismatch", 1, func(function byte) []byte { return []byte{function, 2, 0, 1} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			fakeModbus(t, server, []byte{0, 0, 0, 6, 1, 0x03, 0, 0, 0, 1}, tt.skew, tt.respond)
+
+			c := &modbusClient{conn: client, timeout: time.Second}
+			if v, err := c.ReadTag(context.Background(), Tag{UnitID: 1, Table: "holding", DataType: "uint16"}); err == nil {
+				t.Errorf("ReadTag = %v, want an error", v)
+			}
+		})
+	}
+}
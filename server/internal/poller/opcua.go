@@ -0,0 +1,85 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// opcuaClient reads node values over an unsecured OPC-UA session
+type opcuaClient struct {
+	client *opcua.Client
+}
+
+func dialOPCUA(ctx context.Context, address string) (Reader, error) {
+	client, err := opcua.NewClient(address, opcua.SecurityMode(ua.MessageSecurityModeNone), opcua.AutoReconnect(false))
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return &opcuaClient{client: client}, nil
+}
+
+// ReadTag reads a node's current value and converts it to a float
+func (c *opcuaClient) ReadTag(ctx context.Context, tag Tag) (float64, error) {
+	id, err := ua.ParseNodeID(tag.NodeID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid node id %q: %w", tag.NodeID, err)
+	}
+
+	resp, err := c.client.Read(ctx, &ua.ReadRequest{
+		NodesToRead:        []*ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}},
+		TimestampsToReturn: ua.TimestampsToReturnNeither,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Results) == 0 {
+		return 0, fmt.Errorf("no result for %s", tag.NodeID)
+	}
+	result := resp.Results[0]
+	if result.Status != ua.StatusOK {
+		return 0, fmt.Errorf("read %s: %v", tag.NodeID, result.Status)
+	}
+	if result.Value == nil {
+		return 0, fmt.Errorf("read %s: empty value", tag.NodeID)
+	}
+
+	switch v := result.Value.Value().(type) {
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case int8:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("node %s has non-numeric type %T", tag.NodeID, result.Value.Value())
+}
+
+// Close ends the OPC-UA session
+func (c *opcuaClient) Close() error {
+	return c.client.Close(context.Background())
+}
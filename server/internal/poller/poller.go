@@ -0,0 +1,204 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// Reader reads tag values from a connected endpoint
+type Reader interface {
+	ReadTag(ctx context.Context, tag Tag) (float64, error)
+	Close() error
+}
+
+// dialers connect to an endpoint for each supported protocol
+var dialers = map[string]func(ctx context.Context, address string) (Reader, error){
+	ProtocolModbus: dialModbus,
+	ProtocolOPCUA:  dialOPCUA,
+}
+
+// Sink receives each polled reading (normally the WebSocket handler's ingestion path)
+type Sink func(types.LogMessage) error
+
+// Status reports the health of one endpoint's polling loop
+type Status struct {
+	LastPoll  time.Time `json:"last_poll,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Readings  int64     `json:"readings"`
+	Failures  int64     `json:"failures"`
+}
+
+// Poller runs one polling loop per enabled endpoint
+type Poller struct {
+	store  *Store
+	sink   Sink
+	reload sync.Mutex // serializes Reload
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	status map[string]*Status
+}
+
+// New creates a poller over the endpoints in store
+func New(store *Store, sink Sink) *Poller {
+	return &Poller{store: store, sink: sink, status: make(map[string]*Status)}
+}
+
+// Start launches the polling loops; call Reload after endpoints change
+func (p *Poller) Start() {
+	p.Reload()
+}
+
+// Reload stops every loop and restarts them from the current endpoint configuration
+func (p *Poller) Reload() {
+	p.reload.Lock()
+	defer p.reload.Unlock()
+
+	p.Stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	status := make(map[string]*Status)
+	for _, endpoint := range p.store.List() {
+		if !endpoint.Enabled {
+			continue
+		}
+		// Keep counters across reloads
+		st, ok := p.status[endpoint.Name]
+		if !ok {
+			st = &Status{}
+		}
+		status[endpoint.Name] = st
+
+		p.wg.Add(1)
+		go p.run(ctx, endpoint, st)
+	}
+	p.status = status
+	log.Printf("Poller running %d endpoint(s)", len(status))
+}
+
+// Stop stops all polling loops and waits for them to exit
+func (p *Poller) Stop() {
+	p.mu.Lock()
+	cancel := p.cancel
+	p.cancel = nil
+	p.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		p.wg.Wait()
+	}
+}
+
+// Status returns a copy of the per-endpoint status
+func (p *Poller) Status() map[string]Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make(map[string]Status, len(p.status))
+	for name, st := range p.status {
+		result[name] = *st
+	}
+	return result
+}
+
+// run polls one endpoint until ctx is cancelled, reconnecting after failures
+func (p *Poller) run(ctx context.Context, endpoint Endpoint, st *Status) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(endpoint.interval)
+	defer ticker.Stop()
+
+	var reader Reader
+	defer func() {
+		if reader != nil {
+			reader.Close()
+		}
+	}()
+
+	for {
+		if reader == nil {
+			r, err := dialers[endpoint.Protocol](ctx, endpoint.Address)
+			if err != nil {
+				p.recordError(st, fmt.Errorf("connect: %w", err))
+			} else {
+				reader = r
+			}
+		}
+
+		if reader != nil {
+			if err := p.poll(ctx, reader, endpoint, st); err != nil {
+				// Drop the connection so the next tick reconnects
+				p.recordError(st, err)
+				reader.Close()
+				reader = nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads every tag once and hands the values to the sink
+func (p *Poller) poll(ctx context.Context, reader Reader, endpoint Endpoint, st *Status) error {
+	now := time.Now().UTC()
+	readCtx, cancel := context.WithTimeout(ctx, endpoint.interval)
+	defer cancel()
+
+	for _, tag := range endpoint.Tags {
+		raw, err := reader.ReadTag(readCtx, tag)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tag.DeviceID, err)
+		}
+		value := raw*tag.Scale + tag.Offset
+
+		location := tag.Location
+		if location == "" {
+			location = endpoint.Location
+		}
+		msg := types.LogMessage{
+			Time:       now,
+			DeviceID:   tag.DeviceID,
+			DeviceType: tag.DeviceType,
+			Location:   location,
+			RawValue:   &value,
+			Unit:       tag.Unit,
+			LogType:    "INFO",
+			Message:    fmt.Sprintf("Polled %s from %s", tag.DeviceType, endpoint.Name),
+		}
+		if err := p.sink(msg); err != nil {
+			log.Printf("Poller %s: failed to store %s: %v", endpoint.Name, tag.DeviceID, err)
+			continue
+		}
+
+		p.mu.Lock()
+		st.Readings++
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	st.LastPoll = now
+	st.LastError = ""
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *Poller) recordError(st *Status, err error) {
+	p.mu.Lock()
+	st.Failures++
+	st.LastError = err.Error()
+	p.mu.Unlock()
+}
@@ -0,0 +1,126 @@
+package poller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store keeps polled endpoints in the poller_endpoints table with an in-memory copy
+type Store struct {
+	db        *sql.DB
+	mu        sync.RWMutex
+	endpoints map[string]*Endpoint
+}
+
+// NewStore creates a store and loads the existing endpoints
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, endpoints: make(map[string]*Endpoint)}
+	return s, s.Load()
+}
+
+// Load (re)reads all endpoints from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`SELECT name, protocol, address, poll_interval, location, tags, enabled, updated_at FROM poller_endpoints`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	endpoints := make(map[string]*Endpoint)
+	for rows.Next() {
+		var e Endpoint
+		var tags []byte
+		if err := rows.Scan(&e.Name, &e.Protocol, &e.Address, &e.Interval, &e.Location, &tags, &e.Enabled, &e.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(tags, &e.Tags); err != nil {
+			return fmt.Errorf("invalid tags for %s: %w", e.Name, err)
+		}
+		if err := e.Validate(); err != nil {
+			return fmt.Errorf("endpoint %s: %w", e.Name, err)
+		}
+		endpoints[e.Name] = &e
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.endpoints = endpoints
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns every endpoint sorted by name
+func (s *Store) List() []Endpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Endpoint, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Save validates and creates or replaces an endpoint
+func (s *Store) Save(e Endpoint) (*Endpoint, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	tags, err := json.Marshal(e.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO poller_endpoints (name, protocol, address, poll_interval, location, tags, enabled, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+        ON CONFLICT (name) DO UPDATE SET
+            protocol = EXCLUDED.protocol,
+            address = EXCLUDED.address,
+            poll_interval = EXCLUDED.poll_interval,
+            location = EXCLUDED.location,
+            tags = EXCLUDED.tags,
+            enabled = EXCLUDED.enabled,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := s.db.QueryRow(query, e.Name, e.Protocol, e.Address, e.Interval, e.Location, tags, e.Enabled).Scan(&e.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save poller endpoint: %w", err)
+	}
+
+	s.mu.Lock()
+	s.endpoints[e.Name] = &e
+	s.mu.Unlock()
+	return &e, nil
+}
+
+// Delete removes an endpoint; it reports false if it did not exist
+func (s *Store) Delete(name string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM poller_endpoints WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	s.mu.Lock()
+	delete(s.endpoints, name)
+	s.mu.Unlock()
+	return n > 0, nil
+}
+
+// Import saves a batch of endpoints (used by configuration bundles)
+func (s *Store) Import(endpoints []Endpoint) (int, error) {
+	for i, e := range endpoints {
+		if _, err := s.Save(e); err != nil {
+			return i, fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	return len(endpoints), nil
+}
@@ -0,0 +1,172 @@
+// data quality: how far each device's series can be trusted, from the readings it failed to send,
+// values outside the plausible range for its type or unit, duplicated timestamps and clock skew
+
+package quality
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRanges are the plausible values of the units the simulator and common sensors report
+const DefaultRanges = "celsius:-50:150,fahrenheit:-58:302,percent:0:100,boolean:0:1"
+
+// Each rate is weighted; the weights add up to 1 so scores run from 0 to 100
+const (
+	weightMissing    = 0.35
+	weightOutOfRange = 0.25
+	weightDuplicates = 0.20
+	weightSkew       = 0.20
+)
+
+// Range is the plausible interval of values for a device type or unit
+type Range struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// LoadRanges reads QUALITY_RANGES, comma-separated key:min:max entries where key is a device type or
+// a unit; a device type's range wins over its unit's
+func LoadRanges() map[string]Range {
+	spec := os.Getenv("QUALITY_RANGES")
+	if spec == "" {
+		spec = DefaultRanges
+	}
+
+	ranges, err := ParseRanges(spec)
+	if err != nil {
+		slog.Warn("Invalid QUALITY_RANGES, falling back to defaults", "error", err)
+		ranges, _ = ParseRanges(DefaultRanges)
+	}
+	return ranges
+}
+
+// ParseRanges parses a comma-separated range specification
+func ParseRanges(spec string) (map[string]Range, error) {
+	ranges := make(map[string]Range)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("range %q must be key:min:max", entry)
+		}
+		key, minText, maxText := parts[0], parts[1], parts[2]
+		lo, err := strconv.ParseFloat(minText, 64)
+		if err != nil {
+			return nil, fmt.Errorf("range %q: invalid min", entry)
+		}
+		hi, err := strconv.ParseFloat(maxText, 64)
+		if err != nil {
+			return nil, fmt.Errorf("range %q: invalid max", entry)
+		}
+		if lo >= hi {
+			return nil, fmt.Errorf("range %q: min must be below max", entry)
+		}
+		ranges[key] = Range{Min: lo, Max: hi}
+	}
+	return ranges, nil
+}
+
+// Options narrows and tunes a report
+type Options struct {
+	DeviceID   string
+	DeviceType string
+	Location   string
+	Window     time.Duration
+	Ranges     map[string]Range
+	// MaxSkew is how far the device clock may be from the server's receive time
+	MaxSkew time.Duration
+	// GapFactor is how many expected intervals a gap must span before readings count as missing
+	GapFactor float64
+	// TrustScore is the score a series needs to be marked trusted
+	TrustScore float64
+}
+
+// Metrics are a device's measurements over the window
+type Metrics struct {
+	Readings int64 `json:"readings"`
+	// ExpectedInterval is the device's median reporting interval in seconds; nil below two readings
+	ExpectedInterval *float64 `json:"expected_interval_seconds"`
+	MissingIntervals int64    `json:"missing_intervals"` // readings that should have arrived and did not
+	Gaps             int64    `json:"gaps"`              // stretches with missing readings, including a silent tail
+	MissingRate      float64  `json:"missing_rate"`
+	// Out-of-range readings are counted among those with a value and a known range; the rate is nil
+	// when none could be checked
+	OutOfRange     int64    `json:"out_of_range"`
+	OutOfRangeRate *float64 `json:"out_of_range_rate"`
+	Duplicates     int64    `json:"duplicates"` // readings repeating an earlier timestamp
+	DuplicateRate  float64  `json:"duplicate_rate"`
+	// Skew is receive time minus device time in seconds; nil when no reading in the window has a receive time
+	MeanSkew *float64 `json:"mean_skew_seconds"`
+	MaxSkew  *float64 `json:"max_skew_seconds"` // largest absolute skew
+	Skewed   int64    `json:"skewed"`
+	SkewRate *float64 `json:"skew_rate"`
+}
+
+// Report is a device's data quality over the window
+type Report struct {
+	DeviceID   string    `json:"device_id"`
+	DeviceType string    `json:"device_type"`
+	Location   string    `json:"location"`
+	Range      *Range    `json:"range,omitempty"` // the range values were checked against
+	Score      float64   `json:"score"`           // 100 for a complete, clean series
+	Trusted    bool      `json:"trusted"`
+	Metrics    Metrics   `json:"metrics"`
+	Issues     []string  `json:"issues"` // the problems that lowered the score, largest first
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// score combines the rates and lists the issues behind the deductions
+func (r *Report) score(opts Options) {
+	m := &r.Metrics
+	type issue struct {
+		weight float64
+		text   string
+	}
+	var found []issue
+	deduct := 0.0
+	add := func(weight, rate float64, text string) {
+		if rate <= 0 {
+			return
+		}
+		deduct += weight * rate
+		found = append(found, issue{weight * rate, text})
+	}
+
+	if m.ExpectedInterval != nil {
+		add(weightMissing, m.MissingRate, fmt.Sprintf("%d readings missing across %d gaps (expected every %s)",
+			m.MissingIntervals, m.Gaps, seconds(*m.ExpectedInterval)))
+	}
+	if m.OutOfRangeRate != nil && r.Range != nil {
+		add(weightOutOfRange, *m.OutOfRangeRate, fmt.Sprintf("%.1f%% of values outside %g..%g",
+			100*(*m.OutOfRangeRate), r.Range.Min, r.Range.Max))
+	}
+	add(weightDuplicates, m.DuplicateRate, fmt.Sprintf("%.1f%% of readings repeat a timestamp", 100*m.DuplicateRate))
+	if m.SkewRate != nil {
+		add(weightSkew, *m.SkewRate, fmt.Sprintf("%.1f%% of readings more than %s off the server clock",
+			100*(*m.SkewRate), opts.MaxSkew))
+	}
+
+	r.Score = math.Round(1000*(1-deduct)) / 10
+	r.Trusted = r.Score >= opts.TrustScore
+	sort.SliceStable(found, func(i, j int) bool { return found[i].weight > found[j].weight })
+	r.Issues = make([]string, len(found))
+	for i, f := range found {
+		r.Issues[i] = f.text
+	}
+}
+
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(time.Millisecond).String()
+}
@@ -0,0 +1,143 @@
+package quality
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Build reports the data quality of every device with readings in the window, least trustworthy first
+func Build(ctx context.Context, db *sql.DB, opts Options) ([]Report, error) {
+	if opts.Window <= 0 {
+		return nil, fmt.Errorf("window must be positive")
+	}
+	if opts.GapFactor < 1 {
+		return nil, fmt.Errorf("gap factor must be at least 1")
+	}
+	end := time.Now()
+	start := end.Add(-opts.Window)
+
+	keys := make([]string, 0, len(opts.Ranges))
+	lows := make([]float64, 0, len(opts.Ranges))
+	highs := make([]float64, 0, len(opts.Ranges))
+	for key, r := range opts.Ranges {
+		keys = append(keys, key)
+		lows = append(lows, r.Min)
+		highs = append(highs, r.Max)
+	}
+
+	// Gaps are measured between consecutive readings of a device; a zero gap is a duplicate timestamp
+	rows, err := db.QueryContext(ctx, `
+        WITH ranges AS (
+            SELECT * FROM unnest($6::text[], $7::float8[], $8::float8[]) AS r(key, lo, hi)
+        ),
+        readings AS (
+            SELECT s.device_id, s.device_type, COALESCE(s.location, '') AS location, s.unit, s.time, s.raw_value,
+                   EXTRACT(EPOCH FROM s.ingested_at - s.time)::float8 AS skew,
+                   EXTRACT(EPOCH FROM s.time - LAG(s.time) OVER (PARTITION BY s.device_id ORDER BY s.time))::float8 AS gap,
+                   COALESCE(tr.lo, ur.lo) AS lo,
+                   COALESCE(tr.hi, ur.hi) AS hi
+            FROM sensor_readings s
+            LEFT JOIN ranges tr ON tr.key = s.device_type
+            LEFT JOIN ranges ur ON ur.key = s.unit
+            WHERE s.time >= $1 AND s.time < $2
+              AND ($3 = '' OR s.device_id = $3)
+              AND ($4 = '' OR s.device_type = $4)
+              AND ($5 = '' OR s.location = $5)
+        ),
+        stats AS (
+            SELECT device_id,
+                   MAX(device_type) AS device_type,
+                   MAX(location) AS location,
+                   COALESCE(MAX(unit), '') AS unit,
+                   COUNT(*) AS total,
+                   COUNT(*) FILTER (WHERE gap = 0) AS duplicates,
+                   COUNT(raw_value) FILTER (WHERE lo IS NOT NULL) AS checked,
+                   COUNT(*) FILTER (WHERE raw_value < lo OR raw_value > hi) AS out_of_range,
+                   percentile_cont(0.5) WITHIN GROUP (ORDER BY gap) FILTER (WHERE gap > 0) AS expected,
+                   COUNT(skew) AS timed,
+                   AVG(skew) AS mean_skew,
+                   MAX(ABS(skew)) AS max_skew,
+                   COUNT(*) FILTER (WHERE ABS(skew) > $9) AS skewed,
+                   MIN(time) AS first_seen,
+                   MAX(time) AS last_seen
+            FROM readings
+            GROUP BY device_id
+        ),
+        missing AS (
+            SELECT r.device_id, COUNT(*) AS gaps, SUM(FLOOR(r.gap / s.expected) - 1) AS missed
+            FROM readings r
+            JOIN stats s ON s.device_id = r.device_id
+            WHERE s.expected > 0 AND r.gap >= $10 * s.expected
+            GROUP BY r.device_id
+        )
+        SELECT s.device_id, s.device_type, s.location, s.unit, s.total, s.duplicates, s.checked, s.out_of_range,
+               s.expected, s.timed, s.mean_skew, s.max_skew, s.skewed, s.first_seen, s.last_seen,
+               COALESCE(m.gaps, 0), COALESCE(m.missed, 0)::bigint
+        FROM stats s
+        LEFT JOIN missing m ON m.device_id = s.device_id
+    `, start, end, opts.DeviceID, opts.DeviceType, opts.Location, keys, lows, highs,
+		opts.MaxSkew.Seconds(), opts.GapFactor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		var r Report
+		var unit string
+		var checked, timed int64
+		var expected, meanSkew, maxSkew sql.NullFloat64
+		m := &r.Metrics
+		if err := rows.Scan(&r.DeviceID, &r.DeviceType, &r.Location, &unit, &m.Readings, &m.Duplicates, &checked,
+			&m.OutOfRange, &expected, &timed, &meanSkew, &maxSkew, &m.Skewed, &r.FirstSeen, &r.LastSeen,
+			&m.Gaps, &m.MissingIntervals); err != nil {
+			return nil, err
+		}
+
+		if expected.Valid {
+			m.ExpectedInterval = &expected.Float64
+			// A device that went quiet before the end of the window is missing its tail too
+			if tail := end.Sub(r.LastSeen).Seconds(); tail >= opts.GapFactor*expected.Float64 {
+				m.Gaps++
+				m.MissingIntervals += int64(math.Floor(tail/expected.Float64)) - 1
+			}
+			distinct := m.Readings - m.Duplicates
+			m.MissingRate = float64(m.MissingIntervals) / float64(distinct+m.MissingIntervals)
+		}
+		if rng, ok := opts.Ranges[r.DeviceType]; ok {
+			r.Range = &rng
+		} else if rng, ok := opts.Ranges[unit]; ok {
+			r.Range = &rng
+		}
+		if checked > 0 {
+			rate := float64(m.OutOfRange) / float64(checked)
+			m.OutOfRangeRate = &rate
+		}
+		m.DuplicateRate = float64(m.Duplicates) / float64(m.Readings)
+		if timed > 0 {
+			m.MeanSkew = &meanSkew.Float64
+			m.MaxSkew = &maxSkew.Float64
+			rate := float64(m.Skewed) / float64(timed)
+			m.SkewRate = &rate
+		}
+
+		r.score(opts)
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Score != reports[j].Score {
+			return reports[i].Score < reports[j].Score
+		}
+		return reports[i].DeviceID < reports[j].DeviceID
+	})
+	return reports, nil
+}
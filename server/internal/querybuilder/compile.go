@@ -0,0 +1,243 @@
+package querybuilder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// source is a table a spec can be answered from
+type source struct {
+	name   string
+	bucket string        // time column
+	width  time.Duration // bucket width of an aggregate; 0 for raw readings
+	// settle is how long after a bucket ends the refresh policy has materialized it
+	settle time.Duration
+	// metrics and dims map the spec's names to SQL over the table
+	metrics map[string]string
+	dims    map[string]string
+}
+
+// sources are tried coarsest first; sensor_readings answers anything
+var sources = []source{
+	{
+		name: "daily_sensor_averages", bucket: "day", width: 24 * time.Hour, settle: 25 * time.Hour,
+		metrics: extremaMetrics, dims: aggregateDims,
+	},
+	{
+		name: "daily_device_activity", bucket: "day", width: 24 * time.Hour, settle: 25 * time.Hour,
+		metrics: map[string]string{
+			MetricReadings: "sum(total_readings)",
+			MetricErrors:   "sum(error_count)",
+		},
+		dims: aggregateDims,
+	},
+	{
+		name: "hourly_sensor_averages", bucket: "hour", width: time.Hour, settle: time.Hour + 5*time.Minute,
+		metrics: extremaMetrics, dims: aggregateDims,
+	},
+	{
+		name: "five_min_sensor_averages", bucket: "five_min_bucket", width: 5 * time.Minute, settle: 2 * time.Minute,
+		metrics: extremaMetrics, dims: aggregateDims,
+	},
+	{
+		name: "sensor_readings", bucket: "time",
+		metrics: map[string]string{
+			MetricAvg:      "avg(raw_value)",
+			MetricMin:      "min(raw_value)",
+			MetricMax:      "max(raw_value)",
+			MetricCount:    "count(raw_value)",
+			MetricReadings: "count(*)",
+			MetricErrors:   "count(*) FILTER (WHERE log_type IN ('ERROR', 'CRITICAL'))",
+		},
+		dims: map[string]string{
+			DimDeviceType: "device_type",
+			DimLocation:   "COALESCE(location, '')",
+			DimDeviceID:   "device_id",
+			DimLogType:    "log_type",
+		},
+	},
+}
+
+// extremaMetrics roll up the sensor-average aggregates. Their reading_count is count(*) of the rows
+// the view admits rather than count(raw_value), so count and the mean weighted by it are read
+// from sensor_readings
+var extremaMetrics = map[string]string{
+	MetricMin: "min(min_value)",
+	MetricMax: "max(max_value)",
+}
+
+var aggregateDims = map[string]string{
+	DimDeviceType: "device_type",
+	DimLocation:   "COALESCE(location, '')",
+}
+
+// countMetrics are returned as integers
+var countMetrics = map[string]bool{MetricCount: true, MetricReadings: true, MetricErrors: true}
+
+// answers reports whether src holds everything spec asks for: its metrics and dimensions, buckets
+// that fit its resolution and range, and a range the refresh policy has already materialized
+func (src source) answers(spec *Spec, now time.Time) bool {
+	for _, m := range spec.Metrics {
+		if _, ok := src.metrics[m]; !ok {
+			return false
+		}
+	}
+	for _, d := range spec.GroupBy {
+		if _, ok := src.dims[d]; !ok {
+			return false
+		}
+	}
+	for d := range spec.Filters.byDimension() {
+		if _, ok := src.dims[d]; !ok {
+			return false
+		}
+	}
+	if src.width == 0 {
+		return true
+	}
+	if spec.resolution%src.width != 0 {
+		return false
+	}
+	if !spec.Start.Equal(spec.Start.Truncate(src.width)) || !spec.End.Equal(spec.End.Truncate(src.width)) {
+		return false
+	}
+	return !spec.End.After(now.Add(-src.settle))
+}
+
+// Query is a compiled spec
+type Query struct {
+	Source  string // table the query reads
+	SQL     string
+	Args    []interface{}
+	columns []string // result keys in select order
+	spec    *Spec
+}
+
+// Compile validates spec and translates it into SQL over the coarsest source that answers it
+func Compile(spec *Spec, now time.Time) (*Query, error) {
+	if spec.End.IsZero() {
+		spec.End = now
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	var src source
+	for _, candidate := range sources {
+		if candidate.answers(spec, now) {
+			src = candidate
+			break
+		}
+	}
+
+	q := &Query{Source: src.name, spec: spec}
+	var selects, where []string
+	bind := func(arg interface{}) string {
+		q.Args = append(q.Args, arg)
+		return fmt.Sprintf("$%d", len(q.Args))
+	}
+
+	if spec.resolution > 0 {
+		interval := fmt.Sprintf("%d seconds", int64(spec.resolution.Seconds()))
+		selects = append(selects, fmt.Sprintf("time_bucket(%s::interval, %s)", bind(interval), src.bucket))
+		q.columns = append(q.columns, "bucket")
+	}
+	for _, d := range spec.GroupBy {
+		selects = append(selects, src.dims[d])
+		q.columns = append(q.columns, d)
+	}
+	groups := len(selects)
+	for _, m := range spec.Metrics {
+		selects = append(selects, src.metrics[m])
+		q.columns = append(q.columns, m)
+	}
+
+	where = append(where, fmt.Sprintf("%s >= %s", src.bucket, bind(spec.Start)), fmt.Sprintf("%s < %s", src.bucket, bind(spec.End)))
+	filters := spec.Filters.byDimension()
+	for _, d := range allDimensions {
+		if values, ok := filters[d]; ok {
+			where = append(where, fmt.Sprintf("%s = ANY(%s::text[])", src.dims[d], bind(values)))
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT " + strings.Join(selects, ", "))
+	sb.WriteString(" FROM " + src.name)
+	sb.WriteString(" WHERE " + strings.Join(where, " AND "))
+	if groups > 0 {
+		positions := make([]string, groups)
+		for i := range positions {
+			positions[i] = fmt.Sprint(i + 1)
+		}
+		sb.WriteString(" GROUP BY " + strings.Join(positions, ", "))
+		sb.WriteString(" ORDER BY " + strings.Join(positions, ", "))
+	}
+	// One row more than the limit tells a truncated result from one that fits exactly
+	sb.WriteString(" LIMIT " + bind(spec.Limit+1))
+	q.SQL = sb.String()
+	return q, nil
+}
+
+// Result is what a query returned
+type Result struct {
+	Source     string                   `json:"source"`
+	Resolution string                   `json:"resolution,omitempty"`
+	Rows       []map[string]interface{} `json:"rows"`      // keyed bucket, then the group_by dimensions and metrics
+	Truncated  bool                     `json:"truncated"` // more rows than the limit matched
+}
+
+// Run executes a compiled query
+func (q *Query) Run(ctx context.Context, db *sql.DB) (*Result, error) {
+	rows, err := db.QueryContext(ctx, q.SQL, q.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &Result{Source: q.Source, Resolution: q.spec.Resolution, Rows: []map[string]interface{}{}}
+	for rows.Next() {
+		if len(result.Rows) == q.spec.Limit {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(q.columns))
+		for i, c := range q.columns {
+			switch {
+			case c == "bucket":
+				values[i] = new(time.Time)
+			case countMetrics[c]:
+				values[i] = new(sql.NullInt64)
+			case slices.Contains(allDimensions, c):
+				values[i] = new(string)
+			default:
+				values[i] = new(sql.NullFloat64)
+			}
+		}
+		if err := rows.Scan(values...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(q.columns))
+		for i, c := range q.columns {
+			switch v := values[i].(type) {
+			case *time.Time:
+				row[c] = v.UTC()
+			case *string:
+				row[c] = *v
+			case *sql.NullInt64:
+				row[c] = v.Int64
+			case *sql.NullFloat64:
+				if v.Valid {
+					row[c] = v.Float64
+				} else {
+					row[c] = nil
+				}
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,149 @@
+// Package querybuilder compiles structured query specs (metrics, filters, group-bys, a time range
+// and a resolution) into SQL over sensor_readings or the continuous aggregate that can answer
+// them, so integrators get deterministic queries without natural language or raw SQL
+// Every table and column comes from the fixed sources in this package; values are bound parameters
+package querybuilder
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLimit is the row limit of a spec without one
+	DefaultLimit = 1000
+	// MaxLimit bounds the rows of one query
+	MaxLimit = 10000
+	// MaxBuckets bounds how many buckets the range is split into
+	MaxBuckets = 10000
+	// MinResolution is the finest bucket width
+	MinResolution = time.Minute
+)
+
+// Metrics a spec can ask for
+const (
+	MetricAvg      = "avg"      // mean of the numeric values
+	MetricMin      = "min"      // smallest numeric value
+	MetricMax      = "max"      // largest numeric value
+	MetricCount    = "count"    // readings with a numeric value
+	MetricReadings = "readings" // all readings, numeric or not
+	MetricErrors   = "errors"   // readings logged as ERROR or CRITICAL
+)
+
+// Dimensions a spec can filter and group by
+const (
+	DimDeviceType = "device_type"
+	DimLocation   = "location"
+	DimDeviceID   = "device_id"
+	DimLogType    = "log_type"
+)
+
+var (
+	allMetrics    = []string{MetricAvg, MetricMin, MetricMax, MetricCount, MetricReadings, MetricErrors}
+	allDimensions = []string{DimDeviceType, DimLocation, DimDeviceID, DimLogType}
+)
+
+// Spec is a structured query:
+// {"metrics": ["avg", "max"], "filters": {"device_type": ["temperature"]}, "group_by": ["location"],
+// "start": "...", "end": "...", "resolution": "1h"}
+type Spec struct {
+	Metrics []string  `json:"metrics"`
+	Filters Filters   `json:"filters"`
+	GroupBy []string  `json:"group_by"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"` // default now
+	// Resolution is the bucket width, a duration like 5m or 1h, or days like 1d; without one each
+	// group is a single row over the whole range
+	Resolution string `json:"resolution,omitempty"`
+	Limit      int    `json:"limit,omitempty"` // default DefaultLimit, at most MaxLimit
+
+	resolution time.Duration
+}
+
+// Filters keeps readings matching any of the values given for each dimension; empty lists match all
+type Filters struct {
+	DeviceType []string `json:"device_type,omitempty"`
+	Location   []string `json:"location,omitempty"`
+	DeviceID   []string `json:"device_id,omitempty"`
+	LogType    []string `json:"log_type,omitempty"`
+}
+
+// byDimension returns the filter values keyed by dimension, leaving out empty ones
+func (f Filters) byDimension() map[string][]string {
+	all := map[string][]string{
+		DimDeviceType: f.DeviceType,
+		DimLocation:   f.Location,
+		DimDeviceID:   f.DeviceID,
+		DimLogType:    f.LogType,
+	}
+	for dim, values := range all {
+		if len(values) == 0 {
+			delete(all, dim)
+		}
+	}
+	return all
+}
+
+// Validate checks a spec and fills in its defaults
+func (s *Spec) Validate() error {
+	if len(s.Metrics) == 0 {
+		return fmt.Errorf("metrics is required (%s)", strings.Join(allMetrics, ", "))
+	}
+	for i, m := range s.Metrics {
+		if !slices.Contains(allMetrics, m) {
+			return fmt.Errorf("unknown metric %q (want %s)", m, strings.Join(allMetrics, ", "))
+		}
+		if slices.Contains(s.Metrics[:i], m) {
+			return fmt.Errorf("metric %q is listed twice", m)
+		}
+	}
+	for i, d := range s.GroupBy {
+		if !slices.Contains(allDimensions, d) {
+			return fmt.Errorf("unknown group_by %q (want %s)", d, strings.Join(allDimensions, ", "))
+		}
+		if slices.Contains(s.GroupBy[:i], d) {
+			return fmt.Errorf("group_by %q is listed twice", d)
+		}
+	}
+
+	if s.End.IsZero() {
+		s.End = time.Now()
+	}
+	if s.Start.IsZero() || !s.Start.Before(s.End) {
+		return fmt.Errorf("start (RFC3339) is required and must be before end")
+	}
+
+	if s.Resolution != "" {
+		d, err := parseResolution(s.Resolution)
+		if err != nil || d < MinResolution {
+			return fmt.Errorf("resolution must be a duration of at least %s like 5m, 1h or 1d", MinResolution)
+		}
+		if s.End.Sub(s.Start)/d > MaxBuckets {
+			return fmt.Errorf("resolution %s splits the range into more than %d buckets", s.Resolution, MaxBuckets)
+		}
+		s.resolution = d
+	}
+
+	if s.Limit == 0 {
+		s.Limit = DefaultLimit
+	}
+	if s.Limit < 0 || s.Limit > MaxLimit {
+		return fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	}
+	return nil
+}
+
+// parseResolution accepts Go durations and whole days ("7d")
+func parseResolution(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid days %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(v)
+}
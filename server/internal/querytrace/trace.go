@@ -0,0 +1,103 @@
+// query tracing: records the SQL statements run while serving a request so a response can show
+// exactly which queries, parameters and tables produced it
+
+package querytrace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Query is one statement run under a traced context
+type Query struct {
+	SQL        string        `json:"sql"`
+	Args       []interface{} `json:"args"`
+	Rows       int64         `json:"rows"`
+	DurationMs float64       `json:"duration_ms"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Trace collects the queries of one request; it is safe for concurrent use
+type Trace struct {
+	mu      sync.Mutex
+	queries []Query
+}
+
+// Queries returns the recorded queries in the order they finished
+func (t *Trace) Queries() []Query {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Query(nil), t.queries...)
+}
+
+func (t *Trace) add(q Query) {
+	t.mu.Lock()
+	t.queries = append(t.queries, q)
+	t.mu.Unlock()
+}
+
+type traceKey struct{}
+
+type startKey struct{}
+
+// started is what TraceQueryStart hands to TraceQueryEnd through the query's context
+type started struct {
+	sql  string
+	args []interface{}
+	at   time.Time
+}
+
+// Start returns a copy of ctx whose queries are recorded on the returned trace
+func Start(ctx context.Context) (context.Context, *Trace) {
+	t := &Trace{}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// FromContext returns the trace started on ctx, if any
+func FromContext(ctx context.Context) (*Trace, bool) {
+	t, ok := ctx.Value(traceKey{}).(*Trace)
+	return t, ok
+}
+
+// Tracer is a pgx.QueryTracer that records queries whose context carries a trace
+// Queries run without one (background work, context-free helpers) cost a context lookup
+type Tracer struct{}
+
+var _ pgx.QueryTracer = Tracer{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (Tracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if _, ok := FromContext(ctx); !ok {
+		return ctx
+	}
+	args := append([]interface{}(nil), data.Args...)
+	return context.WithValue(ctx, startKey{}, started{sql: data.SQL, args: args, at: time.Now()})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (Tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	s, ok := ctx.Value(startKey{}).(started)
+	if !ok {
+		return
+	}
+	q := Query{
+		SQL:        s.sql,
+		Args:       s.args,
+		Rows:       data.CommandTag.RowsAffected(),
+		DurationMs: float64(time.Since(s.at).Microseconds()) / 1000,
+	}
+	if q.Args == nil {
+		q.Args = []interface{}{}
+	}
+	if data.Err != nil {
+		q.Error = data.Err.Error()
+	}
+	t.add(q)
+}
@@ -0,0 +1,86 @@
+// Package ratelimit limits how often each client may call the API with a token bucket per key
+// (usually the client's IP address)
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// idleAfter is how long a full bucket is kept before it is forgotten
+const idleAfter = 10 * time.Minute
+
+// Limit is a rate: PerMinute requests a minute on average, with bursts of up to Burst
+type Limit struct {
+	PerMinute int
+	Burst     int
+}
+
+// Limiter keeps a token bucket per key, refilled at a default Limit or at the one passed to AllowLimit
+type Limiter struct {
+	limit Limit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// New creates a limiter allowing perMinute requests a minute per key with bursts of up to burst;
+// burst below 1 is raised to 1
+func New(perMinute, burst int) *Limiter {
+	return &Limiter{
+		limit:   Limit{PerMinute: perMinute, Burst: burst},
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token for key at now; when none is left it returns false and how long until one is
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	return l.AllowLimit(key, l.limit, now)
+}
+
+// AllowLimit is Allow with a limit of its own for key, e.g. one configured per API key
+// A key should always be given the same limit
+func (l *Limiter) AllowLimit(key string, limit Limit, now time.Time) (bool, time.Duration) {
+	perMinute := float64(limit.PerMinute)
+	burst := float64(max(limit.Burst, 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweepLocked(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, at: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.at).Minutes()*perMinute)
+	b.at = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if perMinute <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / perMinute * float64(time.Minute))
+	return false, wait
+}
+
+// sweepLocked forgets the buckets of clients that have been idle long enough to be full again
+func (l *Limiter) sweepLocked(now time.Time) {
+	if now.Sub(l.swept) < idleAfter {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if now.Sub(b.at) >= idleAfter {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// keeps short sliding windows of sensor values in memory so dashboards can get
+// sub-5-minute resolution without scanning the raw sensor_readings hypertable
+
+package realtime
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// Bucket holds the statistics for one resolution-sized slice of the window
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+	Avg   float64   `json:"avg"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	sum   float64
+}
+
+// Series is the windowed view for one device_type/location pair
+type Series struct {
+	DeviceType string   `json:"device_type"`
+	Location   string   `json:"location"`
+	Buckets    []Bucket `json:"buckets"`
+}
+
+// Filter narrows a snapshot to matching series (empty fields match everything)
+type Filter struct {
+	DeviceType string
+	Location   string
+}
+
+type seriesKey struct {
+	deviceType string
+	location   string
+}
+
+// Aggregator maintains per device_type/location buckets for the most recent window
+type Aggregator struct {
+	mu         sync.Mutex
+	window     time.Duration
+	resolution time.Duration
+	series     map[seriesKey]map[int64]*Bucket
+	lastPrune  time.Time
+}
+
+// NewAggregator creates an aggregator keeping `window` worth of `resolution`-sized buckets
+func NewAggregator(window, resolution time.Duration) *Aggregator {
+	if resolution <= 0 {
+		resolution = 10 * time.Second
+	}
+	if window < resolution {
+		window = resolution
+	}
+	return &Aggregator{
+		window:     window,
+		resolution: resolution,
+		series:     make(map[seriesKey]map[int64]*Bucket),
+	}
+}
+
+// Resolution returns the bucket width
+func (a *Aggregator) Resolution() time.Duration {
+	return a.resolution
+}
+
+// Record adds a reading to its bucket; readings without a value or outside the window are ignored
+func (a *Aggregator) Record(msg types.LogMessage) {
+	if msg.RawValue == nil {
+		return
+	}
+
+	ts := msg.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	now := time.Now()
+	if ts.Before(now.Add(-a.window)) {
+		return
+	}
+
+	key := seriesKey{deviceType: msg.DeviceType, location: msg.Location}
+	start := ts.Truncate(a.resolution).Unix()
+	value := *msg.RawValue
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	buckets, ok := a.series[key]
+	if !ok {
+		buckets = make(map[int64]*Bucket)
+		a.series[key] = buckets
+	}
+
+	bucket, ok := buckets[start]
+	if !ok {
+		bucket = &Bucket{Start: time.Unix(start, 0).UTC(), Min: value, Max: value}
+		buckets[start] = bucket
+	}
+
+	bucket.Count++
+	bucket.sum += value
+	bucket.Avg = bucket.sum / float64(bucket.Count)
+	if value < bucket.Min {
+		bucket.Min = value
+	}
+	if value > bucket.Max {
+		bucket.Max = value
+	}
+
+	if now.Sub(a.lastPrune) >= a.resolution {
+		a.pruneLocked(now)
+	}
+}
+
+// Snapshot returns every series matching the filter with buckets in chronological order
+func (a *Aggregator) Snapshot(filter Filter) []Series {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pruneLocked(time.Now())
+
+	var result []Series
+	for key, buckets := range a.series {
+		if filter.DeviceType != "" && filter.DeviceType != key.deviceType {
+			continue
+		}
+		if filter.Location != "" && filter.Location != key.location {
+			continue
+		}
+
+		series := Series{DeviceType: key.deviceType, Location: key.location}
+		for _, bucket := range buckets {
+			series.Buckets = append(series.Buckets, *bucket)
+		}
+		sort.Slice(series.Buckets, func(i, j int) bool {
+			return series.Buckets[i].Start.Before(series.Buckets[j].Start)
+		})
+		result = append(result, series)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DeviceType != result[j].DeviceType {
+			return result[i].DeviceType < result[j].DeviceType
+		}
+		return result[i].Location < result[j].Location
+	})
+	return result
+}
+
+// Latest returns the most recently completed bucket of every series, used for live feed updates
+func (a *Aggregator) Latest() []Series {
+	completed := time.Now().Truncate(a.resolution).Add(-a.resolution)
+
+	var result []Series
+	for _, series := range a.Snapshot(Filter{}) {
+		for _, bucket := range series.Buckets {
+			if bucket.Start.Equal(completed) {
+				series.Buckets = []Bucket{bucket}
+				result = append(result, series)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// pruneLocked drops buckets that have slid out of the window; caller must hold a.mu
+func (a *Aggregator) pruneLocked(now time.Time) {
+	a.lastPrune = now
+	cutoff := now.Add(-a.window).Truncate(a.resolution).Unix()
+	for key, buckets := range a.series {
+		for start := range buckets {
+			if start < cutoff {
+				delete(buckets, start)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(a.series, key)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// applies column-level redaction to API responses so every endpoint hides the same fields
+// rules are configured once (REDACTION_RULES) instead of being hard-coded per query path
+
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"edge-insights/internal/roles"
+	"edge-insights/internal/types"
+)
+
+// Action describes what happens to a redacted column
+type Action string
+
+const (
+	Strip Action = "strip" // remove the column from the row entirely
+	Mask  Action = "mask"  // keep the column but replace its value
+)
+
+// MaskedValue replaces the value of masked columns
+const MaskedValue = "[redacted]"
+
+// DefaultRules always strips embeddings and masks log messages for viewers
+const DefaultRules = "embedding:strip,message:mask:viewer"
+
+// aliases maps response field names onto the column they are derived from
+// e.g. search results expose the log message as "chunk", and message templates and their examples
+// are derived from it
+var aliases = map[string]string{
+	"chunk":    "message",
+	"template": "message",
+	"example":  "message",
+}
+
+// Rule redacts one column, optionally only for a subset of roles
+type Rule struct {
+	Column string
+	Action Action
+	Roles  []roles.Role // empty means the rule applies to every role
+}
+
+// Policy holds the redaction rules applied to API responses
+type Policy struct {
+	rules []Rule
+}
+
+// NewPolicy creates a policy from an explicit list of rules
+func NewPolicy(rules []Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// LoadPolicy builds the policy from the REDACTION_RULES environment variable
+// Format: column:action[:role|role], comma separated (e.g. "embedding:strip,message:mask:viewer")
+func LoadPolicy() *Policy {
+	spec := os.Getenv("REDACTION_RULES")
+	if spec == "" {
+		spec = DefaultRules
+	}
+
+	rules, err := ParseRules(spec)
+	if err != nil {
+		log.Printf("Invalid REDACTION_RULES (%v), falling back to defaults", err)
+		rules, _ = ParseRules(DefaultRules)
+	}
+	return NewPolicy(rules)
+}
+
+// ParseRules parses a comma-separated rule specification
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("rule %q must be column:action[:roles]", entry)
+		}
+
+		rule := Rule{
+			Column: strings.ToLower(strings.TrimSpace(parts[0])),
+			Action: Action(strings.ToLower(strings.TrimSpace(parts[1]))),
+		}
+		if rule.Action != Strip && rule.Action != Mask {
+			return nil, fmt.Errorf("rule %q has unknown action %q", entry, rule.Action)
+		}
+
+		if len(parts) == 3 {
+			for _, name := range strings.Split(parts[2], "|") {
+				role, ok := roles.Parse(name)
+				if !ok {
+					return nil, fmt.Errorf("rule %q has unknown role %q", entry, name)
+				}
+				rule.Roles = append(rule.Roles, role)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ruleFor returns the first rule matching the column for the given role
+func (p *Policy) ruleFor(role roles.Role, column string) (Rule, bool) {
+	column = strings.ToLower(column)
+	if canonical, ok := aliases[column]; ok {
+		column = canonical
+	}
+
+	for _, rule := range p.rules {
+		if rule.Column != column {
+			continue
+		}
+		if len(rule.Roles) == 0 {
+			return rule, true
+		}
+		for _, r := range rule.Roles {
+			if r == role {
+				return rule, true
+			}
+		}
+	}
+	return Rule{}, false
+}
+
+// ApplyRow redacts a single result row in place
+func (p *Policy) ApplyRow(role roles.Role, row map[string]interface{}) {
+	for column := range row {
+		rule, ok := p.ruleFor(role, column)
+		if !ok {
+			continue
+		}
+		switch rule.Action {
+		case Strip:
+			delete(row, column)
+		case Mask:
+			if row[column] != nil {
+				row[column] = MaskedValue
+			}
+		}
+	}
+}
+
+// ApplyRows redacts every map row in a result set in place
+func (p *Policy) ApplyRows(role roles.Role, rows []interface{}) {
+	for _, row := range rows {
+		if m, ok := row.(map[string]interface{}); ok {
+			p.ApplyRow(role, m)
+		}
+	}
+}
+
+// ApplyStructs converts a slice of structs into rows keyed by their JSON names and redacts them
+func (p *Policy) ApplyStructs(role roles.Role, v interface{}) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rows: %w", err)
+	}
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode rows: %w", err)
+	}
+
+	for _, row := range rows {
+		p.ApplyRow(role, row)
+	}
+	return rows, nil
+}
+
+// Text applies the rule for column to a text value in place: stripping empties it and masking
+// replaces it with MaskedValue
+func (p *Policy) Text(role roles.Role, column string, value *string) {
+	rule, ok := p.ruleFor(role, column)
+	if !ok {
+		return
+	}
+	switch rule.Action {
+	case Strip:
+		*value = ""
+	case Mask:
+		*value = MaskedValue
+	}
+}
+
+// Reading returns a copy of reading redacted for role, like ApplyRow on its JSON row but without
+// encoding it. Raw values, ingestion times and metadata cannot hold the mask, so any rule drops
+// them; the device time is always kept
+func (p *Policy) Reading(role roles.Role, reading types.LogMessage) types.LogMessage {
+	p.Text(role, "device_id", &reading.DeviceID)
+	p.Text(role, "device_type", &reading.DeviceType)
+	p.Text(role, "location", &reading.Location)
+	p.Text(role, "unit", &reading.Unit)
+	p.Text(role, "log_type", &reading.LogType)
+	p.Text(role, "message", &reading.Message)
+	if _, ok := p.ruleFor(role, "raw_value"); ok {
+		reading.RawValue = nil
+	}
+	if _, ok := p.ruleFor(role, "ingested_at"); ok {
+		reading.IngestedAt = nil
+	}
+	if _, ok := p.ruleFor(role, "metadata"); ok {
+		reading.Metadata = nil
+	}
+	return reading
+}
+
+// Readings returns copies of readings redacted for role (see Reading)
+func (p *Policy) Readings(role roles.Role, readings []types.LogMessage) []types.LogMessage {
+	if readings == nil {
+		return nil
+	}
+	redacted := make([]types.LogMessage, len(readings))
+	for i, reading := range readings {
+		redacted[i] = p.Reading(role, reading)
+	}
+	return redacted
+}
@@ -0,0 +1,42 @@
+package redact
+
+import (
+	"testing"
+
+	"edge-insights/internal/roles"
+	"edge-insights/internal/types"
+)
+
+func TestReading(t *testing.T) {
+	rules, err := ParseRules("message:mask:viewer,location:strip,metadata:strip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewPolicy(rules)
+	value := 21.5
+	reading := types.LogMessage{
+		DeviceID: "sensor-1", Location: "plant-a", RawValue: &value, Message: "door code 1234",
+		Metadata: map[string]interface{}{"rssi": -70},
+	}
+
+	tests := []struct {
+		role     roles.Role
+		message  string
+		location string
+	}{
+		{roles.Viewer, MaskedValue, ""},
+		{roles.Admin, "door code 1234", ""},
+	}
+	for _, tt := range tests {
+		got := policy.Reading(tt.role, reading)
+		if got.Message != tt.message || got.Location != tt.location {
+			t.Errorf("%s: message %q, location %q, want %q, %q", tt.role, got.Message, got.Location, tt.message, tt.location)
+		}
+		if got.Metadata != nil || got.RawValue == nil || got.DeviceID != "sensor-1" {
+			t.Errorf("%s: got %+v", tt.role, got)
+		}
+	}
+	if reading.Message != "door code 1234" || reading.Location != "plant-a" {
+		t.Error("Reading changed its argument")
+	}
+}
@@ -0,0 +1,49 @@
+package roles
+
+import (
+	"context"
+	"strings"
+)
+
+// Role identifies what an API caller is allowed to see and do
+type Role string
+
+const (
+	Viewer   Role = "viewer"
+	Operator Role = "operator"
+	Admin    Role = "admin"
+)
+
+type contextKey struct{}
+
+// WithRole returns a copy of ctx that carries the caller's role
+func WithRole(ctx context.Context, role Role) context.Context {
+	return context.WithValue(ctx, contextKey{}, role)
+}
+
+// FromContext returns the caller's role stored in ctx, if any
+func FromContext(ctx context.Context) (Role, bool) {
+	role, ok := ctx.Value(contextKey{}).(Role)
+	return role, ok
+}
+
+// Parse converts a role name (case-insensitive) into a known Role
+func Parse(name string) (Role, bool) {
+	switch Role(strings.ToLower(strings.TrimSpace(name))) {
+	case Viewer:
+		return Viewer, true
+	case Operator:
+		return Operator, true
+	case Admin:
+		return Admin, true
+	}
+	return "", false
+}
+
+// rank orders the roles; each one can do everything the roles below it can
+var rank = map[Role]int{Viewer: 1, Operator: 2, Admin: 3}
+
+// AtLeast reports whether r includes min
+func (r Role) AtLeast(min Role) bool {
+	return rank[r] >= rank[min]
+}
@@ -0,0 +1,123 @@
+// tokenized, expiring read-only links to a dashboard view or query result
+// only a hash of the token is stored, so the URL is shown once when the link is created
+
+package share
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Kind decides what a link exposes
+type Kind string
+
+const (
+	// KindAggregates is a live view of one aggregate series over a trailing window
+	KindAggregates Kind = "aggregates"
+	// KindDeviceLogs is a live view of a device's latest readings
+	KindDeviceLogs Kind = "device_logs"
+	// KindQuery is the result of a natural-language query, captured when the link is created
+	KindQuery Kind = "query"
+)
+
+// Params selects the data behind a link; which fields apply depends on the kind
+type Params struct {
+	View       string `json:"view,omitempty"` // aggregates: five_min, hourly, daily
+	DeviceType string `json:"device_type,omitempty"`
+	Location   string `json:"location,omitempty"`
+	Window     string `json:"window,omitempty"` // aggregates: trailing window, e.g. 24h
+	DeviceID   string `json:"device_id,omitempty"`
+	Limit      int    `json:"limit,omitempty"` // device_logs
+	Query      string `json:"query,omitempty"` // query
+}
+
+// Link is a shared view; Token is only set on the value returned by Create
+type Link struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Kind      Kind            `json:"kind"`
+	Params    Params          `json:"params"`
+	Snapshot  json.RawMessage `json:"snapshot,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Token     string          `json:"token,omitempty"`
+
+	tokenHash string
+}
+
+// Validate checks the kind and the parameters it needs
+func (l *Link) Validate() error {
+	switch l.Kind {
+	case KindAggregates:
+		if l.Params.DeviceType == "" {
+			return fmt.Errorf("device_type is required")
+		}
+		if l.Params.View == "" {
+			l.Params.View = "five_min"
+		}
+		if l.Params.Window != "" {
+			if _, err := l.WindowDuration(); err != nil {
+				return err
+			}
+		}
+	case KindDeviceLogs:
+		if l.Params.DeviceID == "" {
+			return fmt.Errorf("device_id is required")
+		}
+		if l.Params.Limit <= 0 || l.Params.Limit > 500 {
+			l.Params.Limit = 50
+		}
+	case KindQuery:
+		if l.Params.Query == "" {
+			return fmt.Errorf("query is required")
+		}
+	default:
+		return fmt.Errorf("kind must be %q, %q or %q", KindAggregates, KindDeviceLogs, KindQuery)
+	}
+	return nil
+}
+
+// WindowDuration returns the trailing window of an aggregates link (0 means the handler default)
+func (l *Link) WindowDuration() (time.Duration, error) {
+	if l.Params.Window == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(l.Params.Window)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("window must be a positive duration like 24h")
+	}
+	return d, nil
+}
+
+// Expired reports whether the link can no longer be opened
+func (l *Link) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// newToken returns a random URL-safe token and the hash stored in its place
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,183 @@
+package share
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps share links in the share_links table with an in-memory index by token hash
+type Store struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	links map[string]*Link // token hash -> link
+}
+
+// NewStore creates a store and loads the links that have not expired
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, links: make(map[string]*Link)}
+	return s, s.Load()
+}
+
+// Load (re)reads all unexpired links from the database
+func (s *Store) Load() error {
+	rows, err := s.db.Query(`
+        SELECT id, token_hash, name, kind, params, snapshot, created_at, expires_at
+        FROM share_links
+        WHERE expires_at > NOW()
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	links := make(map[string]*Link)
+	for rows.Next() {
+		var link Link
+		var params, snapshot []byte
+		if err := rows.Scan(&link.ID, &link.tokenHash, &link.Name, &link.Kind, &params, &snapshot,
+			&link.CreatedAt, &link.ExpiresAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(params, &link.Params); err != nil {
+			return fmt.Errorf("invalid params for share %s: %w", link.ID, err)
+		}
+		if len(snapshot) > 0 {
+			link.Snapshot = snapshot
+		}
+		links[link.tokenHash] = &link
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.links = links
+	s.mu.Unlock()
+	return nil
+}
+
+// Resolve returns the link a token opens, if it exists and has not expired
+func (s *Store) Resolve(token string) (*Link, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	link, ok := s.links[hashToken(token)]
+	if !ok || link.Expired(time.Now()) {
+		return nil, false
+	}
+	found := *link
+	return &found, true
+}
+
+// List returns the unexpired links, newest first, without their tokens
+func (s *Store) List() []Link {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	list := make([]Link, 0, len(s.links))
+	for _, link := range s.links {
+		if !link.Expired(now) {
+			found := *link
+			found.Snapshot = nil
+			list = append(list, found)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Create stores a new link valid for ttl and returns it with its token set
+func (s *Store) Create(link Link, ttl time.Duration) (*Link, error) {
+	if err := link.Validate(); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("expiry must be in the future")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	params, err := json.Marshal(link.Params)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot []byte
+	if len(link.Snapshot) > 0 {
+		snapshot = link.Snapshot
+	}
+
+	link.ID = id
+	link.tokenHash = tokenHash
+	if link.Name == "" {
+		link.Name = string(link.Kind)
+	}
+
+	query := `
+        INSERT INTO share_links (id, token_hash, name, kind, params, snapshot, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW() + $7::interval)
+        RETURNING created_at, expires_at
+    `
+	interval := fmt.Sprintf("%d seconds", int64(ttl.Seconds()))
+	if err := s.db.QueryRow(query, link.ID, tokenHash, link.Name, link.Kind, params, snapshot, interval).
+		Scan(&link.CreatedAt, &link.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to save share link: %w", err)
+	}
+
+	s.mu.Lock()
+	stored := link
+	s.links[tokenHash] = &stored
+	s.mu.Unlock()
+
+	link.Token = token
+	return &link, nil
+}
+
+// Revoke deletes a link by ID; it reports false if it did not exist
+func (s *Store) Revoke(id string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM share_links WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	s.mu.Lock()
+	for tokenHash, link := range s.links {
+		if link.ID == id {
+			delete(s.links, tokenHash)
+		}
+	}
+	s.mu.Unlock()
+
+	return n > 0, nil
+}
+
+// Prune drops expired links from the database and memory
+func (s *Store) Prune() (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM share_links WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+
+	now := time.Now()
+	s.mu.Lock()
+	for tokenHash, link := range s.links {
+		if link.Expired(now) {
+			delete(s.links, tokenHash)
+		}
+	}
+	s.mu.Unlock()
+
+	return n, nil
+}
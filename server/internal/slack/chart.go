@@ -0,0 +1,286 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Point is one sample of a charted series
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series is a named line on a chart
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+// timeColumns are the column names text-to-SQL uses for timestamps and buckets
+var timeColumns = []string{"time", "bucket", "five_min_bucket", "hour", "day", "timestamp"}
+
+// valueColumns are preferred, in order, as the charted value
+var valueColumns = []string{"avg_value", "value", "raw_value", "average", "avg", "max_value", "min_value", "count", "reading_count"}
+
+// TimeSeries extracts chartable series from SQL result rows: a time column, a numeric value
+// column and optionally a text column (device_id, device_type or location) to split lines by
+func TimeSeries(rows []map[string]interface{}) ([]Series, string, bool) {
+	if len(rows) < 2 {
+		return nil, "", false
+	}
+
+	timeCol := firstColumn(rows[0], timeColumns, func(v interface{}) bool {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	})
+	valueCol := firstColumn(rows[0], valueColumns, func(v interface{}) bool {
+		_, ok := v.(float64)
+		return ok
+	})
+	if valueCol == "" {
+		// Fall back to any numeric column
+		for col, v := range rows[0] {
+			if _, ok := v.(float64); ok {
+				valueCol = col
+				break
+			}
+		}
+	}
+	if timeCol == "" || valueCol == "" {
+		return nil, "", false
+	}
+	groupCol := firstColumn(rows[0], []string{"device_id", "device_type", "location"}, func(v interface{}) bool {
+		_, ok := v.(string)
+		return ok
+	})
+
+	byName := make(map[string]*Series)
+	for _, row := range rows {
+		ts, err := time.Parse(time.RFC3339, asString(row[timeCol]))
+		if err != nil {
+			continue
+		}
+		value, ok := row[valueCol].(float64)
+		if !ok {
+			continue
+		}
+		name := valueCol
+		if groupCol != "" {
+			name = asString(row[groupCol])
+		}
+		s, ok := byName[name]
+		if !ok {
+			s = &Series{Name: name}
+			byName[name] = s
+		}
+		s.Points = append(s.Points, Point{Time: ts, Value: value})
+	}
+
+	var series []Series
+	for _, s := range byName {
+		sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].Time.Before(s.Points[j].Time) })
+		series = append(series, *s)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Name < series[j].Name })
+	if len(series) > len(palette) {
+		series = series[:len(palette)]
+	}
+
+	for _, s := range series {
+		if len(s.Points) >= 2 {
+			return series, valueCol, true
+		}
+	}
+	return nil, "", false
+}
+
+func firstColumn(row map[string]interface{}, candidates []string, accept func(interface{}) bool) string {
+	for _, col := range candidates {
+		if v, ok := row[col]; ok && accept(v) {
+			return col
+		}
+	}
+	return ""
+}
+
+func asString(v interface{}) string {
+	s, _ := v.(string)
+	return strings.TrimSpace(s)
+}
+
+// palette colours lines in legend order (see PaletteNames)
+var palette = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0xff, 0x7f, 0x0e, 0xff},
+	{0x2c, 0xa0, 0x2c, 0xff},
+	{0xd6, 0x27, 0x28, 0xff},
+	{0x94, 0x67, 0xbd, 0xff},
+	{0x8c, 0x56, 0x4b, 0xff},
+}
+
+// PaletteNames describes the palette for legends, since charts carry no text
+var PaletteNames = []string{"blue", "orange", "green", "red", "purple", "brown"}
+
+// RenderPNG draws the series as a simple line chart with a light grid
+func RenderPNG(series []Series, width, height int) ([]byte, error) {
+	const margin = 20
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill(img, color.RGBA{0xff, 0xff, 0xff, 0xff})
+
+	// Step 1: Scale to the data range across all series
+	minT, maxT := series[0].Points[0].Time, series[0].Points[0].Time
+	minV, maxV := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, p := range s.Points {
+			if p.Time.Before(minT) {
+				minT = p.Time
+			}
+			if p.Time.After(maxT) {
+				maxT = p.Time
+			}
+			minV = math.Min(minV, p.Value)
+			maxV = math.Max(maxV, p.Value)
+		}
+	}
+	if maxV == minV {
+		maxV, minV = maxV+1, minV-1
+	}
+	span := maxT.Sub(minT).Seconds()
+	if span == 0 {
+		span = 1
+	}
+	x := func(t time.Time) int {
+		return margin + int(t.Sub(minT).Seconds()/span*float64(width-2*margin))
+	}
+	y := func(v float64) int {
+		return height - margin - int((v-minV)/(maxV-minV)*float64(height-2*margin))
+	}
+
+	// Step 2: Grid and axes
+	grid := color.RGBA{0xe5, 0xe5, 0xe5, 0xff}
+	for i := 0; i <= 4; i++ {
+		gy := margin + i*(height-2*margin)/4
+		line(img, margin, gy, width-margin, gy, grid)
+	}
+	axis := color.RGBA{0x66, 0x66, 0x66, 0xff}
+	line(img, margin, height-margin, width-margin, height-margin, axis)
+	line(img, margin, margin, margin, height-margin, axis)
+
+	// Step 3: One polyline per series, drawn twice for a 2px stroke
+	for i, s := range series {
+		c := palette[i%len(palette)]
+		for j := 1; j < len(s.Points); j++ {
+			x0, y0 := x(s.Points[j-1].Time), y(s.Points[j-1].Value)
+			x1, y1 := x(s.Points[j].Time), y(s.Points[j].Value)
+			line(img, x0, y0, x1, y1, c)
+			line(img, x0, y0+1, x1, y1+1, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func fill(img *image.RGBA, c color.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+}
+
+// line draws with Bresenham's algorithm
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// ChartStore keeps rendered charts briefly so Slack can fetch them by URL
+type ChartStore struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	charts map[string]chart
+}
+
+type chart struct {
+	png     []byte
+	expires time.Time
+}
+
+// NewChartStore creates a store whose charts expire after ttl
+func NewChartStore(ttl time.Duration) *ChartStore {
+	return &ChartStore{ttl: ttl, charts: make(map[string]chart)}
+}
+
+// Put stores a chart and returns its unguessable id
+func (s *ChartStore) Put(data []byte) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, c := range s.charts {
+		if now.After(c.expires) {
+			delete(s.charts, key)
+		}
+	}
+	s.charts[id] = chart{png: data, expires: now.Add(s.ttl)}
+	return id
+}
+
+// Get returns a chart that has not expired
+func (s *ChartStore) Get(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.charts[id]
+	if !ok || time.Now().After(c.expires) {
+		return nil, false
+	}
+	return c.png, true
+}
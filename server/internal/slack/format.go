@@ -0,0 +1,194 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxTableRows keeps posted tables readable; the full result stays available in the web UI
+const maxTableRows = 15
+
+// Message is a Slack response_url payload
+type Message struct {
+	ResponseType string                   `json:"response_type"`
+	Text         string                   `json:"text"`
+	Blocks       []map[string]interface{} `json:"blocks,omitempty"`
+}
+
+// Ephemeral is a short reply only the requesting user sees
+func Ephemeral(text string) Message {
+	return Message{ResponseType: "ephemeral", Text: text}
+}
+
+// Answer formats an AI response (text-to-SQL, semantic search or summary) for the channel
+// The result is normalised through JSON so redacted and typed payloads format the same way
+// A non-empty notice (role-limited answers) is shown under the answer
+func Answer(question string, result interface{}, chartURL, legend, notice string) (Message, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return Message{}, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Message{}, err
+	}
+
+	blocks := []map[string]interface{}{
+		section(fmt.Sprintf("*%s*", escape(question))),
+	}
+
+	switch {
+	case fields["requires_approval"] == true || fields["requires_confirmation"] == true || fields["error"] != nil:
+		if explanation, _ := fields["explanation"].(string); explanation != "" {
+			blocks = append(blocks, section(escape(explanation)))
+		}
+		if reason, _ := fields["error"].(string); reason != "" {
+			blocks = append(blocks, section("_"+escape(reason)+"_"))
+		}
+		blocks = append(blocks, section("```"+escape(fmt.Sprint(fields["sql"]))+"```"))
+
+	case fields["sql"] != nil:
+		if explanation, _ := fields["explanation"].(string); explanation != "" {
+			blocks = append(blocks, section(escape(explanation)))
+		}
+		rows, _ := fields["result"].([]interface{})
+		blocks = append(blocks, section(table(rows)))
+		blocks = append(blocks, context(fmt.Sprintf("%v row(s) · `%s`", fields["row_count"], escape(oneLine(fmt.Sprint(fields["sql"]))))))
+
+	case fields["summary"] != nil:
+		blocks = append(blocks, section(escape(fmt.Sprint(fields["summary"]))))
+		if insights, ok := fields["key_insights"].([]interface{}); ok && len(insights) > 0 {
+			var lines []string
+			for _, insight := range insights {
+				lines = append(lines, "• "+escape(fmt.Sprint(insight)))
+			}
+			blocks = append(blocks, section(strings.Join(lines, "\n")))
+		}
+		blocks = append(blocks, context(fmt.Sprintf("%v log(s) over %v", fields["log_count"], fields["time_range"])))
+
+	default:
+		if answer, _ := fields["answer"].(string); answer != "" {
+			blocks = append(blocks, section(escape(answer)))
+		}
+		if logs, ok := fields["relevant_logs"].([]interface{}); ok && len(logs) > 0 {
+			var lines []string
+			for i, l := range logs {
+				if i == 5 {
+					break
+				}
+				entry, _ := l.(map[string]interface{})
+				lines = append(lines, fmt.Sprintf("• `%v` *%v* %v", entry["device_id"], entry["log_type"], escape(fmt.Sprint(entry["chunk"]))))
+			}
+			blocks = append(blocks, section(strings.Join(lines, "\n")))
+		}
+	}
+
+	if notice != "" {
+		blocks = append(blocks, context("_"+escape(notice)+"_"))
+	}
+
+	if chartURL != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type":      "image",
+			"image_url": chartURL,
+			"alt_text":  "Time series chart",
+		})
+		if legend != "" {
+			blocks = append(blocks, context(legend))
+		}
+	}
+
+	return Message{ResponseType: "in_channel", Text: question, Blocks: blocks}, nil
+}
+
+// table renders rows as a monospace table
+func table(rows []interface{}) string {
+	if len(rows) == 0 {
+		return "_No rows returned._"
+	}
+
+	first, _ := rows[0].(map[string]interface{})
+	columns := make([]string, 0, len(first))
+	for col := range first {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	widths := make([]int, len(columns))
+	cells := [][]string{columns}
+	for i, r := range rows {
+		if i == maxTableRows {
+			break
+		}
+		row, _ := r.(map[string]interface{})
+		line := make([]string, len(columns))
+		for j, col := range columns {
+			line[j] = cell(row[col])
+		}
+		cells = append(cells, line)
+	}
+	for _, line := range cells {
+		for j, v := range line {
+			if len(v) > widths[j] {
+				widths[j] = len(v)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("```\n")
+	for _, line := range cells {
+		for j, v := range line {
+			sb.WriteString(v + strings.Repeat(" ", widths[j]-len(v)+2))
+		}
+		sb.WriteString("\n")
+	}
+	if len(rows) > maxTableRows {
+		sb.WriteString(fmt.Sprintf("… %d more row(s)\n", len(rows)-maxTableRows))
+	}
+	sb.WriteString("```")
+	return sb.String()
+}
+
+func cell(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "-"
+	case float64:
+		return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", val), "0"), ".")
+	}
+	s := []rune(oneLine(fmt.Sprint(v)))
+	if len(s) > 40 {
+		return string(s[:37]) + "..."
+	}
+	return string(s)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func section(text string) map[string]interface{} {
+	// Slack limits section text to 3000 characters
+	if len(text) > 2900 {
+		text = text[:2900] + "…"
+	}
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": text},
+	}
+}
+
+func context(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "context",
+		"elements": []map[string]string{{"type": "mrkdwn", "text": text}},
+	}
+}
+
+// escape applies Slack's required mrkdwn escaping
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,218 @@
+// service level objectives for device fleets: the share of readings that must be delivered on time
+// or without errors over a rolling window, and how fast the allowed remainder (the error budget) burns
+
+package slo
+
+import (
+	"fmt"
+	"time"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+)
+
+// Kind selects what an SLO counts as a bad reading
+type Kind string
+
+const (
+	KindDelivery Kind = "delivery" // received more than Within after its device time
+	KindErrors   Kind = "errors"   // logged with log_type ERROR
+)
+
+// SLO is an objective over the readings of one location and/or device type, e.g.
+// 99% of readings in warehouse-3 delivered within 60s, or fewer than 0.5% error logs (target 99.5)
+type SLO struct {
+	Name       string `json:"name"`
+	Kind       Kind   `json:"kind"`
+	Location   string `json:"location,omitempty"` // empty covers every location
+	DeviceType string `json:"device_type,omitempty"`
+	// Target is the percentage of readings that must be good, e.g. 99 or 99.5
+	Target float64 `json:"target"`
+	Within string  `json:"within,omitempty"` // delivery deadline for delivery SLOs, e.g. "60s"
+	Window string  `json:"window,omitempty"` // rolling window, default "720h" (30 days)
+	// BurnRate alerts when the budget burns this many times faster than it can sustain over the
+	// last hour (default 14.4, which spends 2% of a 30-day budget in one hour)
+	BurnRate  float64         `json:"burn_rate,omitempty"`
+	Severity  string          `json:"severity,omitempty"` // info, warning (default) or critical
+	Notify    []notify.Config `json:"notify,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+
+	within time.Duration
+	window time.Duration
+}
+
+// Validate checks the SLO and fills in defaults
+func (s *SLO) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.Target <= 0 || s.Target >= 100 {
+		return fmt.Errorf("target must be a percentage between 0 and 100, e.g. 99.5")
+	}
+	switch s.Kind {
+	case KindDelivery:
+		within, err := time.ParseDuration(s.Within)
+		if err != nil || within <= 0 {
+			return fmt.Errorf("delivery SLOs need a positive within, e.g. \"60s\"")
+		}
+		s.within = within
+	case KindErrors:
+		s.Within, s.within = "", 0
+	default:
+		return fmt.Errorf("kind must be %s or %s", KindDelivery, KindErrors)
+	}
+	if s.Window == "" {
+		s.Window = "720h"
+	}
+	window, err := time.ParseDuration(s.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window: %w", err)
+	}
+	if window < time.Hour {
+		return fmt.Errorf("window must be at least 1h")
+	}
+	s.window = window
+	if s.BurnRate < 0 {
+		return fmt.Errorf("burn_rate cannot be negative")
+	}
+	if s.BurnRate == 0 {
+		s.BurnRate = 14.4
+	}
+	switch s.Severity {
+	case "":
+		s.Severity = notify.SeverityWarning
+	case notify.SeverityInfo, notify.SeverityWarning, notify.SeverityCritical:
+	default:
+		return fmt.Errorf("severity must be info, warning or critical")
+	}
+	for i, config := range s.Notify {
+		if _, err := notify.New(config); err != nil {
+			return fmt.Errorf("notify[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// budget is the fraction of readings allowed to be bad
+func (s *SLO) budget() float64 {
+	return 1 - s.Target/100
+}
+
+// Status is an SLO's standing over its window, computed from the readings received in it
+type Status struct {
+	SLO         string   `json:"slo"`
+	Total       int64    `json:"total"`        // readings received in the window
+	Bad         int64    `json:"bad"`          // late or error readings
+	Compliance  *float64 `json:"compliance"`   // percentage of good readings; nil without readings
+	BudgetTotal float64  `json:"budget_total"` // bad readings the target allows so far
+	// BudgetRemaining is the fraction of the budget left; it goes below 0 once the SLO is breached
+	BudgetRemaining float64 `json:"budget_remaining"`
+	// BurnRate is how many times faster than sustainable the budget burned over the last hour
+	BurnRate   float64   `json:"burn_rate"`
+	Exhausted  bool      `json:"exhausted"`
+	FastBurn   bool      `json:"fast_burn"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// breached reports whether the SLO should be alerting
+func (st Status) breached() bool {
+	return st.Exhausted || st.FastBurn
+}
+
+// status derives the budget figures from the window and last-hour counts
+func (s *SLO) status(total, bad, recentTotal, recentBad int64, start, end time.Time) Status {
+	st := Status{SLO: s.Name, Total: total, Bad: bad, BudgetRemaining: 1, Start: start, End: end, ComputedAt: time.Now()}
+	if total > 0 {
+		compliance := 100 * float64(total-bad) / float64(total)
+		st.Compliance = &compliance
+		st.BudgetTotal = s.budget() * float64(total)
+		st.BudgetRemaining = 1 - float64(bad)/st.BudgetTotal
+		st.Exhausted = st.BudgetRemaining <= 0
+	}
+	if recentTotal > 0 {
+		st.BurnRate = (float64(recentBad) / float64(recentTotal)) / s.budget()
+		st.FastBurn = st.BurnRate >= s.BurnRate
+	}
+	return st
+}
+
+// Alert is an SLO whose budget is exhausted or burning fast
+type Alert struct {
+	SLO        string     `json:"slo"`
+	Severity   string     `json:"severity"`
+	Location   string     `json:"location,omitempty"`
+	DeviceType string     `json:"device_type,omitempty"`
+	Status     Status     `json:"status"`
+	Since      time.Time  `json:"since"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// describe returns a title and message for the alert
+func (a Alert) describe() (string, string) {
+	scope := a.Location
+	if scope == "" {
+		scope = "all locations"
+	}
+	title := fmt.Sprintf("SLO %s burning fast in %s", a.SLO, scope)
+	if a.Status.Exhausted {
+		title = fmt.Sprintf("SLO %s error budget exhausted in %s", a.SLO, scope)
+	}
+	if a.ResolvedAt != nil {
+		title = fmt.Sprintf("SLO %s back within budget in %s", a.SLO, scope)
+	}
+	compliance := 100.0
+	if a.Status.Compliance != nil {
+		compliance = *a.Status.Compliance
+	}
+	message := fmt.Sprintf("%.3f%% good over the window, %.0f%% of the error budget left, burning %.1fx over the last hour",
+		compliance, 100*a.Status.BudgetRemaining, a.Status.BurnRate)
+	return title, message
+}
+
+// Event converts the alert into the live-feed alert payload
+func (a Alert) Event() types.AlertEvent {
+	_, message := a.describe()
+	remaining := a.Status.BudgetRemaining
+	kind := "fast_burn"
+	if a.Status.Exhausted {
+		kind = "budget_exhausted"
+	}
+	return types.AlertEvent{
+		Source:     "slo",
+		Rule:       a.SLO,
+		Kind:       kind,
+		Severity:   a.Severity,
+		DeviceType: a.DeviceType,
+		Location:   a.Location,
+		Message:    message,
+		Value:      &remaining,
+		Since:      a.Since,
+		ResolvedAt: a.ResolvedAt,
+	}
+}
+
+// Notification describes the alert for notifiers
+func (a Alert) Notification() notify.Notification {
+	title, message := a.describe()
+	at := a.Since
+	if a.ResolvedAt != nil {
+		at = *a.ResolvedAt
+	}
+
+	remaining := 100 * a.Status.BudgetRemaining
+	return notify.Notification{
+		Title:      title,
+		Message:    message,
+		Severity:   a.Severity,
+		Source:     a.SLO,
+		DedupKey:   "slo:" + a.SLO,
+		Resolved:   a.ResolvedAt != nil,
+		DeviceType: a.DeviceType,
+		Location:   a.Location,
+		Value:      &remaining,
+		Unit:       "percent of budget",
+		Time:       at,
+	}
+}
@@ -0,0 +1,316 @@
+package slo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"edge-insights/internal/notify"
+)
+
+// burnWindow is the recent window the burn rate is measured over
+const burnWindow = time.Hour
+
+// Tracker keeps the SLOs in the slos table, their latest status and the alerts currently firing
+// Statuses are recomputed every interval; firing alerts live in memory and re-fire after a restart
+type Tracker struct {
+	db        *sql.DB
+	mu        sync.RWMutex
+	slos      []*SLO
+	statuses  map[string]Status
+	active    map[string]*Alert
+	listeners []func(Alert)
+}
+
+// NewTracker creates a tracker and loads the stored SLOs
+func NewTracker(db *sql.DB) (*Tracker, error) {
+	t := &Tracker{
+		db:       db,
+		statuses: make(map[string]Status),
+		active:   make(map[string]*Alert),
+	}
+	return t, t.Load()
+}
+
+// Load (re)reads the SLOs from the database
+func (t *Tracker) Load() error {
+	rows, err := t.db.Query(`SELECT name, settings, updated_at FROM slos ORDER BY name`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var slos []*SLO
+	for rows.Next() {
+		var s SLO
+		var name string
+		var settings []byte
+		if err := rows.Scan(&name, &settings, &s.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(settings, &s); err != nil {
+			return fmt.Errorf("invalid settings for %s: %w", name, err)
+		}
+		s.Name = name
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("slo %s: %w", name, err)
+		}
+		slos = append(slos, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.slos = slos
+	t.mu.Unlock()
+	return nil
+}
+
+// OnAlert registers fn to be called whenever an SLO alert fires or resolves
+// Listeners must be registered before Start and must not block
+func (t *Tracker) OnAlert(fn func(Alert)) {
+	t.listeners = append(t.listeners, fn)
+}
+
+// List returns every SLO sorted by name
+func (t *Tracker) List() []SLO {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := make([]SLO, 0, len(t.slos))
+	for _, s := range t.slos {
+		list = append(list, *s)
+	}
+	return list
+}
+
+// Get returns an SLO
+func (t *Tracker) Get(name string) (*SLO, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s, ok := t.findLocked(name)
+	if !ok {
+		return nil, false
+	}
+	found := *s
+	return &found, true
+}
+
+// Status returns the latest computed status of an SLO; false until the first evaluation
+func (t *Tracker) Status(name string) (Status, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	st, ok := t.statuses[name]
+	return st, ok
+}
+
+// Alerts returns the SLO alerts currently firing, oldest first
+func (t *Tracker) Alerts() []Alert {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := make([]Alert, 0, len(t.active))
+	for _, a := range t.active {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Since.Before(list[j].Since) })
+	return list
+}
+
+// Save validates and creates or replaces an SLO; its status and alert are dropped until the next evaluation
+func (t *Tracker) Save(s SLO) (*SLO, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	settings, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO slos (name, settings, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (name) DO UPDATE SET
+            settings = EXCLUDED.settings,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := t.db.QueryRow(query, s.Name, settings).Scan(&s.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save slo: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(s.Name)
+	t.slos = append(t.slos, &s)
+	sort.Slice(t.slos, func(i, j int) bool { return t.slos[i].Name < t.slos[j].Name })
+	return &s, nil
+}
+
+// Delete removes an SLO and its alert; it reports false if it did not exist
+func (t *Tracker) Delete(name string) (bool, error) {
+	result, err := t.db.Exec(`DELETE FROM slos WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(name)
+	return n > 0, nil
+}
+
+func (t *Tracker) removeLocked(name string) {
+	for i, existing := range t.slos {
+		if existing.Name == name {
+			t.slos = append(t.slos[:i], t.slos[i+1:]...)
+			break
+		}
+	}
+	delete(t.statuses, name)
+	delete(t.active, name)
+}
+
+// Import saves a batch of SLOs (used by configuration bundles)
+func (t *Tracker) Import(slos []SLO) (int, error) {
+	for i, s := range slos {
+		if _, err := t.Save(s); err != nil {
+			return i, fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+	return len(slos), nil
+}
+
+// Start evaluates every SLO now and then every interval
+func (t *Tracker) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := t.Evaluate(ctx); err != nil {
+				slog.Error("Failed to evaluate SLOs", "error", err)
+			}
+			cancel()
+			<-ticker.C
+		}
+	}()
+}
+
+// Evaluate recomputes every SLO's status and fires or resolves its alert
+func (t *Tracker) Evaluate(ctx context.Context) error {
+	var firstErr error
+	for _, s := range t.List() {
+		st, err := t.Compute(ctx, s)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", s.Name, err)
+			}
+			continue
+		}
+
+		var changed *Alert
+		t.mu.Lock()
+		if current, ok := t.findLocked(s.Name); !ok || !current.UpdatedAt.Equal(s.UpdatedAt) {
+			// Deleted or replaced while it was being computed
+			t.mu.Unlock()
+			continue
+		}
+		t.statuses[s.Name] = st
+		alert, firing := t.active[s.Name]
+		switch {
+		case !firing && st.breached():
+			alert = &Alert{SLO: s.Name, Severity: s.Severity, Location: s.Location, DeviceType: s.DeviceType, Status: st, Since: st.ComputedAt}
+			t.active[s.Name] = alert
+			fired := *alert
+			changed = &fired
+		case firing && !st.breached():
+			delete(t.active, s.Name)
+			alert.Status = st
+			alert.ResolvedAt = &st.ComputedAt
+			resolved := *alert
+			changed = &resolved
+		case firing:
+			alert.Status = st
+		}
+		t.mu.Unlock()
+
+		if changed != nil {
+			t.dispatch(*changed, s.Notify)
+		}
+	}
+	return firstErr
+}
+
+func (t *Tracker) findLocked(name string) (*SLO, bool) {
+	for _, s := range t.slos {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Compute counts the SLO's good and bad readings received over its window and the last hour
+func (t *Tracker) Compute(ctx context.Context, s SLO) (Status, error) {
+	end := time.Now()
+	start := end.Add(-s.window)
+	recent := end.Add(-burnWindow)
+
+	bad := `log_type = 'ERROR'`
+	args := []interface{}{start, end, s.Location, s.DeviceType, recent}
+	if s.Kind == KindDelivery {
+		bad = `ingested_at - time > make_interval(secs => $6)`
+		args = append(args, s.within.Seconds())
+	}
+
+	var total, badCount, recentTotal, recentBad int64
+	err := t.db.QueryRowContext(ctx, `
+        SELECT COUNT(*),
+               COUNT(*) FILTER (WHERE `+bad+`),
+               COUNT(*) FILTER (WHERE ingested_at >= $5),
+               COUNT(*) FILTER (WHERE ingested_at >= $5 AND `+bad+`)
+        FROM sensor_readings
+        WHERE ingested_at >= $1 AND ingested_at < $2
+          AND ($3 = '' OR location = $3)
+          AND ($4 = '' OR device_type = $4)
+    `, args...).Scan(&total, &badCount, &recentTotal, &recentBad)
+	if err != nil {
+		return Status{}, err
+	}
+	return s.status(total, badCount, recentTotal, recentBad, start, end), nil
+}
+
+// dispatch tells listeners about an alert change and sends it to the SLO's notifiers
+func (t *Tracker) dispatch(a Alert, configs []notify.Config) {
+	for _, fn := range t.listeners {
+		fn(a)
+	}
+	if len(configs) == 0 {
+		return
+	}
+
+	n := a.Notification()
+	for _, config := range configs {
+		notifier, err := notify.Channel(config)
+		if err != nil {
+			slog.Error("Invalid notifier on SLO", "slo", a.SLO, "error", err)
+			continue
+		}
+		go func(config notify.Config) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := notifier.Notify(ctx, n); err != nil {
+				slog.Error("Failed to send SLO notification", "channel", config.Type, "slo", a.SLO, "error", err)
+			}
+		}(config)
+	}
+}
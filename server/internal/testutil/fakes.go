@@ -0,0 +1,108 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// FakeChat is a scripted chat-completion client; it returns Responses in order
+// and records every request it receives
+type FakeChat struct {
+	mu        sync.Mutex
+	Responses []string
+	Err       error
+	Requests  []openai.ChatCompletionRequest
+}
+
+// NewFakeChat creates a fake that answers with the given responses in order
+func NewFakeChat(responses ...string) *FakeChat {
+	return &FakeChat{Responses: responses}
+}
+
+// CreateChatCompletion implements ai.ChatClient
+func (f *FakeChat) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Requests = append(f.Requests, request)
+	if f.Err != nil {
+		return openai.ChatCompletionResponse{}, f.Err
+	}
+	if len(f.Responses) == 0 {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("fake chat: no scripted response left")
+	}
+
+	content := f.Responses[0]
+	f.Responses = f.Responses[1:]
+	return openai.ChatCompletionResponse{
+		Model: request.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}},
+		},
+	}, nil
+}
+
+// FakeEmbedder returns deterministic embeddings derived from a hash of the input text,
+// so identical texts always map to identical vectors
+type FakeEmbedder struct {
+	mu         sync.Mutex
+	Dimensions int
+	Err        error
+	Inputs     []string
+}
+
+// NewFakeEmbedder creates a fake producing vectors of the given size (1536 matches the schema)
+func NewFakeEmbedder(dimensions int) *FakeEmbedder {
+	return &FakeEmbedder{Dimensions: dimensions}
+}
+
+// CreateEmbeddings implements ai.EmbeddingClient
+func (f *FakeEmbedder) CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return openai.EmbeddingResponse{}, f.Err
+	}
+
+	var inputs []string
+	switch in := conv.Convert().Input.(type) {
+	case string:
+		inputs = []string{in}
+	case []string:
+		inputs = in
+	default:
+		return openai.EmbeddingResponse{}, fmt.Errorf("fake embedder: unsupported input %T", in)
+	}
+	f.Inputs = append(f.Inputs, inputs...)
+
+	resp := openai.EmbeddingResponse{Model: openai.SmallEmbedding3}
+	for i, text := range inputs {
+		resp.Data = append(resp.Data, openai.Embedding{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: f.vector(text),
+		})
+	}
+	return resp, nil
+}
+
+func (f *FakeEmbedder) vector(text string) []float32 {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	seed := h.Sum64()
+
+	vec := make([]float32, f.Dimensions)
+	for i := range vec {
+		// xorshift keeps the sequence deterministic per input
+		seed ^= seed << 13
+		seed ^= seed >> 7
+		seed ^= seed << 17
+		vec[i] = float32(seed%2000)/1000 - 1
+	}
+	return vec
+}
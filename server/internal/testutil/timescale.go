@@ -0,0 +1,110 @@
+// shared helpers for tests: a throwaway TimescaleDB container with migrations applied
+// and fake OpenAI clients so db, ws and ai behaviour can be tested without network access
+
+package testutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"edge-insights/internal/db"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// TimescaleImage includes TimescaleDB, pgvector and the toolkit extension
+const TimescaleImage = "timescale/timescaledb-ha:pg16"
+
+// TimescaleDB is a running TimescaleDB container with the schema migrated
+type TimescaleDB struct {
+	DB        *sql.DB
+	DSN       string
+	container *postgres.PostgresContainer
+}
+
+// StartTimescaleDB starts a container, connects to it and runs every migration
+func StartTimescaleDB(ctx context.Context) (*TimescaleDB, error) {
+	container, err := postgres.Run(ctx, TimescaleImage,
+		postgres.WithDatabase("edge_insights"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("postgres"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(2*time.Minute),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start timescaledb container: %w", err)
+	}
+
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, fmt.Errorf("failed to get connection string: %w", err)
+	}
+
+	database, err := sql.Open("pgx", dsn)
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// The embeddings migration needs pgvector; the image ships it but it must be enabled
+	for _, ext := range []string{"timescaledb", "vector"} {
+		if _, err := database.ExecContext(ctx, "CREATE EXTENSION IF NOT EXISTS "+ext); err != nil {
+			database.Close()
+			container.Terminate(ctx)
+			return nil, fmt.Errorf("failed to enable extension %s: %w", ext, err)
+		}
+	}
+
+	if err := db.RunMigrationsFrom(database, MigrationsDir()); err != nil {
+		database.Close()
+		container.Terminate(ctx)
+		return nil, err
+	}
+
+	return &TimescaleDB{DB: database, DSN: dsn, container: container}, nil
+}
+
+// Close closes the connection and removes the container
+func (t *TimescaleDB) Close(ctx context.Context) error {
+	t.DB.Close()
+	return t.container.Terminate(ctx)
+}
+
+// NewTimescaleDB starts a migrated database for a test and removes it when the test ends
+// The test is skipped (not failed) when Docker is unavailable or -short is set
+func NewTimescaleDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	if testing.Short() {
+		tb.Skip("skipping TimescaleDB container in -short mode")
+	}
+
+	ctx := context.Background()
+	tsdb, err := StartTimescaleDB(ctx)
+	if err != nil {
+		tb.Skipf("TimescaleDB container unavailable: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := tsdb.Close(ctx); err != nil {
+			tb.Logf("failed to stop TimescaleDB container: %v", err)
+		}
+	})
+	return tsdb.DB
+}
+
+// MigrationsDir returns the absolute path of server/migrations regardless of the test's working directory
+func MigrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "migrations")
+}
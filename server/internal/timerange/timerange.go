@@ -0,0 +1,145 @@
+// timerange parses the ranges API callers ask for: a window ending now ("1h", "24h", "7d",
+// "P1DT12H") or an explicit ISO 8601 interval ("2024-05-01T00:00:00Z/2024-05-02T00:00:00Z",
+// "2024-05-01T00:00:00Z/PT6H", "PT6H/2024-05-02T00:00:00Z")
+
+package timerange
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Range is a parsed time range, start inclusive and end exclusive
+type Range struct {
+	Start time.Time
+	End   time.Time
+	// Relative is set for ranges that end now (durations), unset for explicit intervals
+	Relative bool
+	spec     string
+}
+
+// Duration returns the length of the range
+func (r Range) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// String describes the range for people, e.g. "the last 24h" or "2024-05-01T00:00:00Z to 2024-05-02T00:00:00Z"
+func (r Range) String() string {
+	if r.Relative {
+		return "the last " + r.spec
+	}
+	return r.Start.Format(time.RFC3339) + " to " + r.End.Format(time.RFC3339)
+}
+
+// Parse parses spec relative to now
+func Parse(spec string, now time.Time) (Range, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Range{}, fmt.Errorf("range is required")
+	}
+
+	if first, second, ok := strings.Cut(spec, "/"); ok {
+		return interval(first, second)
+	}
+
+	start, err := back(spec, now)
+	if err != nil {
+		return Range{}, err
+	}
+	return Range{Start: start, End: now, Relative: true, spec: spec}, nil
+}
+
+// interval parses the two halves of an ISO 8601 interval: start/end, start/duration or duration/end
+func interval(first, second string) (Range, error) {
+	start, startErr := time.Parse(time.RFC3339, first)
+	end, endErr := time.Parse(time.RFC3339, second)
+	switch {
+	case startErr == nil && endErr == nil:
+	case startErr == nil:
+		var err error
+		if end, err = forward(second, start); err != nil {
+			return Range{}, err
+		}
+	case endErr == nil:
+		var err error
+		if start, err = back(first, end); err != nil {
+			return Range{}, err
+		}
+	default:
+		return Range{}, fmt.Errorf("an interval needs an RFC 3339 start or end")
+	}
+	if !start.Before(end) {
+		return Range{}, fmt.Errorf("start must be before end")
+	}
+	return Range{Start: start, End: end}, nil
+}
+
+// back returns the time a duration before t
+func back(spec string, t time.Time) (time.Time, error) {
+	return shift(spec, t, -1)
+}
+
+// forward returns the time a duration after t
+func forward(spec string, t time.Time) (time.Time, error) {
+	return shift(spec, t, 1)
+}
+
+// shift moves t by a duration in either direction; calendar units (years, months, weeks and
+// days) are applied to the calendar, so "1d" across a daylight saving change stays a day
+func shift(spec string, t time.Time, sign int) (time.Time, error) {
+	if strings.HasPrefix(strings.ToUpper(spec), "P") {
+		return shiftISO(spec, t, sign)
+	}
+
+	// Days and weeks in front of a Go duration, e.g. 7d, 2w or 1d12h
+	days := 0
+	rest := spec
+	if m := calendarPrefix.FindStringSubmatch(spec); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if m[2] == "w" {
+			n *= 7
+		}
+		days, rest = n, m[3]
+	}
+	var d time.Duration
+	if rest != "" {
+		var err error
+		if d, err = time.ParseDuration(rest); err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a duration such as 1h, 24h or 7d", spec)
+		}
+	}
+	if d < 0 || (days == 0 && d == 0) {
+		return time.Time{}, fmt.Errorf("duration must be positive")
+	}
+	return t.AddDate(0, 0, sign*days).Add(time.Duration(sign) * d), nil
+}
+
+var (
+	calendarPrefix = regexp.MustCompile(`^(\d+)([dw])(.*)$`)
+	isoDuration    = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// shiftISO moves t by an ISO 8601 duration such as P7D, PT6H or P1M
+func shiftISO(spec string, t time.Time, sign int) (time.Time, error) {
+	m := isoDuration.FindStringSubmatch(strings.ToUpper(spec))
+	if m == nil || strings.HasSuffix(strings.ToUpper(spec), "T") {
+		return time.Time{}, fmt.Errorf("%q is not an ISO 8601 duration such as P7D or PT6H", spec)
+	}
+	n := func(i int) int {
+		v, _ := strconv.Atoi(m[i])
+		return v
+	}
+	years, months, days := n(1), n(2), 7*n(3)+n(4)
+	clock := time.Duration(n(5))*time.Hour + time.Duration(n(6))*time.Minute
+	if m[7] != "" {
+		seconds, _ := strconv.ParseFloat(m[7], 64)
+		clock += time.Duration(seconds * float64(time.Second))
+	}
+	if years == 0 && months == 0 && days == 0 && clock == 0 {
+		return time.Time{}, fmt.Errorf("duration must be positive")
+	}
+	return t.AddDate(sign*years, sign*months, sign*days).Add(time.Duration(sign) * clock), nil
+}
@@ -0,0 +1,53 @@
+package timerange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec       string
+		start, end time.Time
+		relative   bool
+	}{
+		{"1h", now.Add(-time.Hour), now, true},
+		{"7d", now.AddDate(0, 0, -7), now, true},
+		{"1d12h", now.AddDate(0, 0, -1).Add(-12 * time.Hour), now, true},
+		{"P1DT12H", now.AddDate(0, 0, -1).Add(-12 * time.Hour), now, true},
+		{"2024-05-01T00:00:00Z/2024-05-02T00:00:00Z", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), false},
+		{"2024-05-01T00:00:00Z/PT6H", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC), false},
+		{"PT6H/2024-05-02T00:00:00Z", time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC), time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.spec, now)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if !r.Start.Equal(tt.start) || !r.End.Equal(tt.end) || r.Relative != tt.relative {
+			t.Errorf("Parse(%q) = %v to %v (relative %v), want %v to %v (relative %v)",
+				tt.spec, r.Start, r.End, r.Relative, tt.start, tt.end, tt.relative)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	now := time.Now()
+	for _, spec := range []string{"", "soon", "PT6H/PT1H", "2024-05-02T00:00:00Z/2024-05-01T00:00:00Z"} {
+		if r, err := Parse(spec, now); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", spec, r)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	r, err := Parse("24h", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.String(); got != "the last 24h" {
+		t.Errorf("String() = %q, want %q", got, "the last 24h")
+	}
+}
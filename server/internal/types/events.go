@@ -0,0 +1,135 @@
+package types
+
+import (
+	"time"
+)
+
+// EventVersion is the version of the live-feed envelope and payloads
+// Fields may be added within a version; it is bumped only when a field is removed or changes meaning
+const EventVersion = 1
+
+// EventType identifies the payload carried by an Event
+type EventType string
+
+const (
+	EventLogEntry        EventType = "log_entry"        // Data is a LogMessage
+	EventRealtimeMetrics EventType = "realtime_metrics" // Data is the latest completed realtime bucket of every series
+	EventAnomaly         EventType = "anomaly"          // Data is an Anomaly
+	EventAlert           EventType = "alert"            // Data is an AlertEvent
+	EventDeviceStatus    EventType = "device_status"    // Data is a DeviceStatusEvent
+	EventHeartbeat       EventType = "heartbeat"        // Data is a HeartbeatEvent
+	EventIncident        EventType = "incident"         // Data is an IncidentEvent
+	EventSubscribed      EventType = "subscribed"       // Data is the Subscription now in effect, or null
+	EventCommand         EventType = "command"          // Data is a CommandEvent; sent only to the device it is for
+	EventLogRollup       EventType = "log_rollup"       // Data is a LogRollup; stands in for log entries while the feed is sampled
+)
+
+// EventPayloads maps each event type to the type of its Data (nil: not described here),
+// for clients and the TypeScript SDK generator (cmd/tsgen)
+var EventPayloads = map[EventType]interface{}{
+	EventLogEntry:        LogMessage{},
+	EventRealtimeMetrics: nil,
+	EventAnomaly:         Anomaly{},
+	EventAlert:           AlertEvent{},
+	EventDeviceStatus:    DeviceStatusEvent{},
+	EventHeartbeat:       HeartbeatEvent{},
+	EventIncident:        IncidentEvent{},
+	EventSubscribed:      (*Subscription)(nil),
+	EventCommand:         CommandEvent{},
+	EventLogRollup:       LogRollup{},
+}
+
+// Event is the envelope of everything pushed on the live feed; consumers switch on Type
+// and should ignore types they do not know
+type Event struct {
+	Type    EventType   `json:"type"`
+	Version int         `json:"version"`
+	Time    time.Time   `json:"time"` // when the server emitted the event
+	Data    interface{} `json:"data"`
+}
+
+// NewEvent wraps a payload in the current envelope version
+func NewEvent(eventType EventType, data interface{}) Event {
+	return Event{Type: eventType, Version: EventVersion, Time: time.Now().UTC(), Data: data}
+}
+
+// AlertEvent reports an alert rule firing or resolving for a device
+type AlertEvent struct {
+	Source     string     `json:"source"` // subsystem that raised it, e.g. "vitals"
+	Rule       string     `json:"rule"`
+	Kind       string     `json:"kind"` // rule type within the source, e.g. "low_battery"
+	Severity   string     `json:"severity"`
+	DeviceID   string     `json:"device_id"`
+	DeviceType string     `json:"device_type,omitempty"`
+	Location   string     `json:"location,omitempty"`
+	Message    string     `json:"message"`
+	Value      *float64   `json:"value,omitempty"`
+	Threshold  *float64   `json:"threshold,omitempty"`
+	Since      time.Time  `json:"since"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"` // set when the alert resolved
+}
+
+// CommandEvent delivers a command to the device connection it is for
+// The device answers with {"type": "command_status", "device_id": ..., "id": ..., "status": ...}:
+// "acknowledged" on receipt, then "succeeded" or "failed" with an optional result or error
+type CommandEvent struct {
+	ID        string                 `json:"id"`
+	DeviceID  string                 `json:"device_id"`
+	Command   string                 `json:"command"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	ExpiresAt time.Time              `json:"expires_at"`
+}
+
+// DeviceStatus values carried by DeviceStatusEvent
+const (
+	DeviceRegistered     = "registered"
+	DeviceUpdated        = "updated"
+	DeviceDecommissioned = "decommissioned"
+)
+
+// DeviceStatusEvent reports a change to a device's registration
+type DeviceStatusEvent struct {
+	DeviceID   string     `json:"device_id"`
+	DeviceType string     `json:"device_type,omitempty"`
+	Location   string     `json:"location,omitempty"`
+	Status     string     `json:"status"`
+	LastSeen   *time.Time `json:"last_seen,omitempty"`
+}
+
+// HeartbeatEvent is sent periodically so clients can detect a stalled connection
+type HeartbeatEvent struct {
+	ServerTime time.Time `json:"server_time"`
+	Clients    int       `json:"clients"`            // connected live-feed clients
+	Sampling   string    `json:"sampling,omitempty"` // "sample" or "rollup" while log entries are being thinned
+}
+
+// LogRollup summarizes one second of a device's log entries of one type that the live feed did
+// not forward one by one because it was busier than FEED_SAMPLE_THRESHOLD
+type LogRollup struct {
+	DeviceID   string    `json:"device_id"`
+	DeviceType string    `json:"device_type"`
+	Location   string    `json:"location"`
+	LogType    string    `json:"log_type"`
+	Unit       string    `json:"unit,omitempty"`
+	Count      int       `json:"count"`
+	Min        *float64  `json:"min,omitempty"` // over the entries with a raw_value
+	Max        *float64  `json:"max,omitempty"`
+	Avg        *float64  `json:"avg,omitempty"`
+	Start      time.Time `json:"start"` // time of the first and the last entry
+	End        time.Time `json:"end"`
+	Message    string    `json:"message"` // of the last entry
+}
+
+// IncidentEvent reports an incident being opened or changed (a new signal, a status or a title)
+type IncidentEvent struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Status      string     `json:"status"` // open, investigating or resolved
+	Severity    string     `json:"severity"`
+	DeviceIDs   []string   `json:"device_ids"`
+	Locations   []string   `json:"locations"`
+	SignalCount int        `json:"signal_count"`
+	FirstSeen   time.Time  `json:"first_seen"`
+	LastSeen    time.Time  `json:"last_seen"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
@@ -1,3 +1,5 @@
+//go:generate go run ../../cmd/tsgen -types . -out ../../../sdk/src/types.ts
+
 package types
 
 import (
@@ -15,13 +17,118 @@ type LogMessage struct {
 	Unit       string    `json:"unit,omitempty"`
 	LogType    string    `json:"log_type"`
 	Message    string    `json:"message"`
+	// IngestedAt is when the server received the reading (Time is the device-reported time)
+	// It is set by the server; values sent by devices are ignored
+	IngestedAt *time.Time `json:"ingested_at,omitempty"`
+	// Metadata holds device-specific extras (battery %, RSSI, firmware build) stored as JSONB
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // LogResponse represents the response after processing a log
+// Code classifies failures; RetryAfterMs is set when the server is saturated and clients should
+// wait that long before resending. Queued logs were accepted while the database was failing and
+// are stored from the dead-letter queue later; they must not be resent. MsgID echoes the msg_id of
+// the log acknowledged, and Duplicate marks a resent msg_id that was not stored again
 type LogResponse struct {
-	Success bool   `json:"success"`
+	Success      bool         `json:"success"`
+	MsgID        string       `json:"msg_id,omitempty"`
+	Duplicate    bool         `json:"duplicate,omitempty"`
+	Queued       bool         `json:"queued,omitempty"`
+	Message      string       `json:"message"`
+	Error        string       `json:"error,omitempty"`
+	Code         ErrorCode    `json:"code,omitempty"`
+	Details      []FieldError `json:"details,omitempty"` // every field problem when Code is VALIDATION_FAILED
+	RetryAfterMs int64        `json:"retry_after_ms,omitempty"`
+}
+
+// FieldError is one problem with one field of a log message
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"` // "required" or "invalid"
 	Message string `json:"message"`
-	Error   string `json:"error,omitempty"`
+}
+
+// IngestResult is the outcome of one reading in a POST /api/ingest batch, in request order
+type IngestResult struct {
+	Index    int          `json:"index"`
+	DeviceID string       `json:"device_id,omitempty"`
+	Success  bool         `json:"success"`
+	Queued   bool         `json:"queued,omitempty"` // accepted into the dead-letter queue, stored later
+	Error    string       `json:"error,omitempty"`
+	Code     ErrorCode    `json:"code,omitempty"`
+	Details  []FieldError `json:"details,omitempty"` // every field problem when Code is VALIDATION_FAILED
+}
+
+// IngestResponse reports a POST /api/ingest batch; the accepted readings were stored together
+// (or, when Queued is set, queued together in the dead-letter queue to be stored later)
+// RetryAfterMs is set when the server was saturated and nothing was stored
+type IngestResponse struct {
+	Accepted     int            `json:"accepted"`
+	Rejected     int            `json:"rejected"`
+	Queued       int            `json:"queued,omitempty"`
+	Results      []IngestResult `json:"results"`
+	RetryAfterMs int64          `json:"retry_after_ms,omitempty"`
+}
+
+// ErrorCode tells device firmware why a log was not stored without parsing the error text
+type ErrorCode string
+
+const (
+	CodeInvalidJSON      ErrorCode = "INVALID_JSON"      // frame is not valid JSON; do not resend unchanged
+	CodeValidationFailed ErrorCode = "VALIDATION_FAILED" // required fields missing or invalid; do not resend unchanged
+	CodeRateLimited      ErrorCode = "RATE_LIMITED"      // server busy; resend after retry_after_ms
+	CodeUnauthorized     ErrorCode = "UNAUTHORIZED"      // API key missing, invalid, revoked or not valid for the device
+	CodeDeviceRejected   ErrorCode = "DEVICE_REJECTED"   // device unregistered or decommissioned
+	CodeStoreFailed      ErrorCode = "STORE_FAILED"      // storage error; resend with back-off
+	CodeUnsupported      ErrorCode = "UNSUPPORTED"       // frame not accepted on this endpoint (e.g. a log sent to /ws/subscribe)
+	CodeUnknownCommand   ErrorCode = "UNKNOWN_COMMAND"   // command_status for a command the device was not sent
+)
+
+// WebSocket close codes sent before the server closes a device connection (4000-4999 are application-defined)
+const (
+	CloseUnauthorized = 4001 // follows an UNAUTHORIZED response; reconnect only with a valid key
+)
+
+// APIError is the body of every failed HTTP API request. Code is a stable snake_case identifier
+// to branch on (validation_failed, not_found, ai_unavailable...), Message is meant for people,
+// Details carries structured context such as the field problems of a validation failure, and
+// RequestID is the X-Request-ID of the request, to quote when reporting a problem
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// Subscription narrows the live feed a dashboard connection receives
+// Each list matches any of its values; empty lists match everything
+type Subscription struct {
+	DeviceIDs   []string `json:"device_id,omitempty"`
+	DeviceTypes []string `json:"device_type,omitempty"`
+	Locations   []string `json:"location,omitempty"`
+	LogTypes    []string `json:"log_type,omitempty"`
+}
+
+// Matches reports whether a log entry passes the subscription
+func (s Subscription) Matches(msg LogMessage) bool {
+	return s.MatchesDevice(msg.DeviceID, msg.DeviceType, msg.Location) && matchesAny(s.LogTypes, msg.LogType)
+}
+
+// MatchesDevice reports whether events about a device (alerts, status) pass the subscription; log types are not checked
+func (s Subscription) MatchesDevice(deviceID, deviceType, location string) bool {
+	return matchesAny(s.DeviceIDs, deviceID) && matchesAny(s.DeviceTypes, deviceType) && matchesAny(s.Locations, location)
+}
+
+func matchesAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
 }
 
 // QueryRequest represents a natural language query request
@@ -34,6 +141,7 @@ type QueryResponse struct {
 	Success bool        `json:"success"`
 	Result  interface{} `json:"result"`
 	Error   string      `json:"error,omitempty"`
+	Notice  string      `json:"notice,omitempty"` // set when the answer was limited by the caller's role
 	Query   string      `json:"query"`
 	Time    time.Time   `json:"time"`
 }
@@ -48,15 +156,31 @@ type SearchResult struct {
 	LogType       string   `json:"log_type"`
 	ChunkSeq      int      `json:"chunk_seq"`
 	Chunk         string   `json:"chunk"`
-	Distance      float64  `json:"distance"`
+	Distance      float64  `json:"distance"`      // cosine distance of the embeddings
+	KeywordScore  float64  `json:"keyword_score"` // how well the message matches the search text's keywords, 0 to 1
+	Score         float64  `json:"score"`         // the blend both are ranked by, SEARCH_KEYWORD_WEIGHT of it keywords
 	RawValue      *float64 `json:"raw_value,omitempty"`
 	Unit          string   `json:"unit,omitempty"`
 }
 
 type SearchResponse struct {
-	Results []SearchResult `json:"results"`
-	Count   int            `json:"count"`
-	Query   string         `json:"query"`
+	Results   []SearchResult    `json:"results"`
+	Count     int               `json:"count"`
+	Query     string            `json:"query"`
+	Knowledge []KnowledgeResult `json:"knowledge"` // earlier conclusions similar to the query
+}
+
+// KnowledgeResult is an earlier conclusion found by semantic search: a scheduled summary, an
+// incident's narrative and note, an anomaly explanation or a suggested remediation
+type KnowledgeResult struct {
+	Kind      string   `json:"kind"`      // summary, incident, anomaly or remediation
+	SourceID  string   `json:"source_id"` // the summary, incident, incident signal or alert it came from
+	Time      string   `json:"time"`
+	DeviceIDs []string `json:"device_ids"`
+	Locations []string `json:"locations"`
+	Title     string   `json:"title,omitempty"`
+	Content   string   `json:"content"`
+	Distance  float64  `json:"distance"`
 }
 
 type SummaryResponse struct {
@@ -75,10 +199,28 @@ type AnomalyResponse struct {
 
 // Anomaly represents a single detected anomaly
 type Anomaly struct {
-	Time       time.Time `json:"time"`
-	DeviceID   string    `json:"device_id"`
-	Type       string    `json:"type"`
-	Severity   string    `json:"severity"`
-	Message    string    `json:"message"`
-	Confidence float64   `json:"confidence"`
+	Time       time.Time     `json:"time"`
+	DeviceID   string        `json:"device_id"`
+	Type       string        `json:"type"`
+	Severity   string        `json:"severity"`
+	Message    string        `json:"message"`
+	Confidence float64       `json:"confidence"`
+	Context    *AlertContext `json:"context,omitempty"`
+}
+
+// AlertContext is recent surrounding data attached to an alert or anomaly so responders can triage without querying
+type AlertContext struct {
+	RecentReadings  []LogMessage    `json:"recent_readings"`
+	RelatedLogs     []LogMessage    `json:"related_logs"`
+	AggregateWindow AggregateWindow `json:"aggregate_window"`
+}
+
+// AggregateWindow points at the continuous-aggregate bucket covering an event
+type AggregateWindow struct {
+	View       string    `json:"view"`
+	DeviceType string    `json:"device_type"`
+	Location   string    `json:"location"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	URL        string    `json:"url"`
 }
@@ -0,0 +1,170 @@
+package vitals
+
+import (
+	"fmt"
+	"time"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+)
+
+// RuleType selects the vital a rule watches
+type RuleType string
+
+const (
+	RuleLowBattery RuleType = "low_battery" // battery percent below the threshold
+	RuleWeakSignal RuleType = "weak_signal" // RSSI dBm below the threshold
+)
+
+// Rule raises an alert for every matching device whose vital drops below Threshold and resolves it
+// once the vital recovers to Threshold + Hysteresis, so a value hovering at the limit does not flap
+type Rule struct {
+	Name       string          `json:"name"`
+	Type       RuleType        `json:"type"`
+	Threshold  float64         `json:"threshold"`            // default 20 (%) for low_battery, -90 (dBm) for weak_signal
+	Hysteresis float64         `json:"hysteresis,omitempty"` // default 5
+	DeviceType string          `json:"device_type,omitempty"`
+	Location   string          `json:"location,omitempty"`
+	Severity   string          `json:"severity,omitempty"` // info, warning (default) or critical
+	Notify     []notify.Config `json:"notify,omitempty"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// Validate checks the rule and fills in defaults
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch r.Type {
+	case RuleLowBattery:
+		if r.Threshold == 0 {
+			r.Threshold = 20
+		}
+		if r.Threshold < 0 || r.Threshold > 100 {
+			return fmt.Errorf("low_battery threshold must be a percentage")
+		}
+	case RuleWeakSignal:
+		if r.Threshold == 0 {
+			r.Threshold = -90
+		}
+	default:
+		return fmt.Errorf("type must be %s or %s", RuleLowBattery, RuleWeakSignal)
+	}
+	if r.Hysteresis < 0 {
+		return fmt.Errorf("hysteresis cannot be negative")
+	}
+	if r.Hysteresis == 0 {
+		r.Hysteresis = 5
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = notify.SeverityWarning
+	case notify.SeverityInfo, notify.SeverityWarning, notify.SeverityCritical:
+	default:
+		return fmt.Errorf("severity must be info, warning or critical")
+	}
+	for i, config := range r.Notify {
+		if _, err := notify.New(config); err != nil {
+			return fmt.Errorf("notify[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the rule applies to a device
+func (r *Rule) Matches(v Vitals) bool {
+	return (r.DeviceType == "" || r.DeviceType == v.DeviceType) && (r.Location == "" || r.Location == v.Location)
+}
+
+// value returns the vital the rule watches, or false if the device has not reported it
+func (r *Rule) value(v Vitals) (float64, bool) {
+	p := v.Battery
+	if r.Type == RuleWeakSignal {
+		p = v.RSSI
+	}
+	if p == nil {
+		return 0, false
+	}
+	return *p, true
+}
+
+// unit is the unit of the watched vital
+func (r *Rule) unit() string {
+	if r.Type == RuleWeakSignal {
+		return "dBm"
+	}
+	return "percent"
+}
+
+// Alert is a rule firing for one device
+type Alert struct {
+	Rule       string     `json:"rule"`
+	Type       RuleType   `json:"type"`
+	Severity   string     `json:"severity"`
+	DeviceID   string     `json:"device_id"`
+	DeviceType string     `json:"device_type"`
+	Location   string     `json:"location"`
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold"`
+	Since      time.Time  `json:"since"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// describe returns a title and message for the alert
+func (a Alert) describe() (string, string) {
+	title := fmt.Sprintf("Low battery on %s", a.DeviceID)
+	message := fmt.Sprintf("Battery at %.0f%% (threshold %.0f%%)", a.Value, a.Threshold)
+	if a.Type == RuleWeakSignal {
+		title = fmt.Sprintf("Weak signal on %s", a.DeviceID)
+		message = fmt.Sprintf("RSSI at %.0f dBm (threshold %.0f dBm)", a.Value, a.Threshold)
+	}
+	if a.ResolvedAt != nil {
+		title += " resolved"
+	}
+	return title, message
+}
+
+// Event converts the alert into the live-feed alert payload
+func (a Alert) Event() types.AlertEvent {
+	_, message := a.describe()
+	value, threshold := a.Value, a.Threshold
+	return types.AlertEvent{
+		Source:     "vitals",
+		Rule:       a.Rule,
+		Kind:       string(a.Type),
+		Severity:   a.Severity,
+		DeviceID:   a.DeviceID,
+		DeviceType: a.DeviceType,
+		Location:   a.Location,
+		Message:    message,
+		Value:      &value,
+		Threshold:  &threshold,
+		Since:      a.Since,
+		ResolvedAt: a.ResolvedAt,
+	}
+}
+
+// notification describes the alert for notifiers
+func (a Alert) notification(unit string) notify.Notification {
+	title, message := a.describe()
+	at := a.Since
+	if a.ResolvedAt != nil {
+		at = *a.ResolvedAt
+	}
+
+	value := a.Value
+	return notify.Notification{
+		Title:      title,
+		Message:    message,
+		Severity:   a.Severity,
+		Source:     a.Rule,
+		DedupKey:   fmt.Sprintf("vitals:%s:%s", a.Rule, a.DeviceID),
+		Resolved:   a.ResolvedAt != nil,
+		DeviceID:   a.DeviceID,
+		DeviceType: a.DeviceType,
+		Location:   a.Location,
+		Value:      &value,
+		Unit:       unit,
+		Time:       at,
+	}
+}
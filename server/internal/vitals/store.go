@@ -0,0 +1,457 @@
+package vitals
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+)
+
+// Tracker keeps the latest vitals of every device (flushed to device_vitals periodically),
+// the alert rules in vitals_rules, and the alerts currently firing
+// Firing alerts live in memory only; after a restart they fire again on the next low reading
+type Tracker struct {
+	db        *sql.DB
+	mu        sync.RWMutex
+	vitals    map[string]*Vitals
+	dirty     map[string]bool // devices whose vitals changed since the last flush
+	rules     []*Rule
+	active    map[alertKey]*Alert
+	listeners []func(Alert)
+}
+
+type alertKey struct {
+	rule   string
+	device string
+}
+
+// event is an alert change with what is needed to notify about it
+type event struct {
+	alert  Alert
+	notify []notify.Config
+	unit   string
+}
+
+// NewTracker creates a tracker and loads the stored vitals and rules
+func NewTracker(db *sql.DB) (*Tracker, error) {
+	t := &Tracker{
+		db:     db,
+		vitals: make(map[string]*Vitals),
+		dirty:  make(map[string]bool),
+		active: make(map[alertKey]*Alert),
+	}
+	return t, t.Load()
+}
+
+// Load (re)reads the latest vitals and the rules from the database
+func (t *Tracker) Load() error {
+	rows, err := t.db.Query(`
+        SELECT device_id, device_type, location, battery, battery_at, rssi, rssi_at
+        FROM device_vitals
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	vitals := make(map[string]*Vitals)
+	for rows.Next() {
+		var v Vitals
+		if err := rows.Scan(&v.DeviceID, &v.DeviceType, &v.Location, &v.Battery, &v.BatteryAt, &v.RSSI, &v.RSSIAt); err != nil {
+			return err
+		}
+		vitals[v.DeviceID] = &v
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rules, err := t.loadRules()
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.vitals = vitals
+	t.rules = rules
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *Tracker) loadRules() ([]*Rule, error) {
+	rows, err := t.db.Query(`SELECT name, settings, updated_at FROM vitals_rules ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*Rule
+	for rows.Next() {
+		var rule Rule
+		var name string
+		var settings []byte
+		if err := rows.Scan(&name, &settings, &rule.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(settings, &rule); err != nil {
+			return nil, fmt.Errorf("invalid settings for %s: %w", name, err)
+		}
+		rule.Name = name
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		rules = append(rules, &rule)
+	}
+	return rules, rows.Err()
+}
+
+// OnAlert registers fn to be called whenever an alert fires or resolves
+// Listeners must be registered before readings are observed and must not block
+func (t *Tracker) OnAlert(fn func(Alert)) {
+	t.listeners = append(t.listeners, fn)
+}
+
+// Observe records the battery and RSSI carried in a stored reading's metadata and evaluates
+// the rules for its device; readings without either are ignored
+func (t *Tracker) Observe(msg types.LogMessage) {
+	battery, rssi := Extract(msg.Metadata)
+	if battery == nil && rssi == nil {
+		return
+	}
+	at := msg.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	t.mu.Lock()
+	v, ok := t.vitals[msg.DeviceID]
+	if !ok {
+		v = &Vitals{DeviceID: msg.DeviceID}
+		t.vitals[msg.DeviceID] = v
+	}
+	if msg.DeviceType != "" {
+		v.DeviceType = msg.DeviceType
+	}
+	if msg.Location != "" {
+		v.Location = msg.Location
+	}
+	// Late readings do not overwrite newer values
+	if battery != nil && (v.BatteryAt == nil || !at.Before(*v.BatteryAt)) {
+		v.Battery, v.BatteryAt = battery, &at
+	}
+	if rssi != nil && (v.RSSIAt == nil || !at.Before(*v.RSSIAt)) {
+		v.RSSI, v.RSSIAt = rssi, &at
+	}
+	t.dirty[v.DeviceID] = true
+	events := t.evaluateLocked(*v, at)
+	t.mu.Unlock()
+
+	for _, e := range events {
+		t.dispatch(e)
+	}
+}
+
+// evaluateLocked fires and resolves the alerts of one device
+func (t *Tracker) evaluateLocked(v Vitals, at time.Time) []event {
+	var events []event
+	for _, rule := range t.rules {
+		if !rule.Matches(v) {
+			continue
+		}
+		value, ok := rule.value(v)
+		if !ok {
+			continue
+		}
+
+		key := alertKey{rule: rule.Name, device: v.DeviceID}
+		alert, firing := t.active[key]
+		switch {
+		case !firing && value < rule.Threshold:
+			alert = &Alert{
+				Rule:       rule.Name,
+				Type:       rule.Type,
+				Severity:   rule.Severity,
+				DeviceID:   v.DeviceID,
+				DeviceType: v.DeviceType,
+				Location:   v.Location,
+				Value:      value,
+				Threshold:  rule.Threshold,
+				Since:      at,
+			}
+			t.active[key] = alert
+			events = append(events, event{alert: *alert, notify: rule.Notify, unit: rule.unit()})
+		case firing && value >= rule.Threshold+rule.Hysteresis:
+			delete(t.active, key)
+			alert.Value = value
+			alert.ResolvedAt = &at
+			events = append(events, event{alert: *alert, notify: rule.Notify, unit: rule.unit()})
+		case firing:
+			alert.Value = value
+		}
+	}
+	return events
+}
+
+// dispatch tells listeners about an alert change and sends it to the rule's notifiers
+func (t *Tracker) dispatch(e event) {
+	for _, fn := range t.listeners {
+		fn(e.alert)
+	}
+	if len(e.notify) == 0 {
+		return
+	}
+
+	n := e.alert.notification(e.unit)
+	for _, config := range e.notify {
+		notifier, err := notify.Channel(config)
+		if err != nil {
+			log.Printf("Invalid notifier on vitals rule %s: %v", e.alert.Rule, err)
+			continue
+		}
+		go func(config notify.Config) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := notifier.Notify(ctx, n); err != nil {
+				log.Printf("Failed to send %s notification for vitals rule %s: %v", config.Type, e.alert.Rule, err)
+			}
+		}(config)
+	}
+}
+
+// Filter narrows List; nil thresholds match every device
+type Filter struct {
+	DeviceType   string
+	Location     string
+	BatteryBelow *float64 // only devices reporting a battery percent below this
+	RSSIBelow    *float64 // only devices reporting an RSSI below this
+}
+
+// List returns the latest vitals of the devices matching f, sorted by device ID
+func (t *Tracker) List(f Filter) []Vitals {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := make([]Vitals, 0, len(t.vitals))
+	for _, v := range t.vitals {
+		if (f.DeviceType != "" && v.DeviceType != f.DeviceType) || (f.Location != "" && v.Location != f.Location) {
+			continue
+		}
+		if f.BatteryBelow != nil && (v.Battery == nil || *v.Battery >= *f.BatteryBelow) {
+			continue
+		}
+		if f.RSSIBelow != nil && (v.RSSI == nil || *v.RSSI >= *f.RSSIBelow) {
+			continue
+		}
+		list = append(list, *v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// Get returns the latest vitals of a device
+func (t *Tracker) Get(deviceID string) (*Vitals, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	v, ok := t.vitals[deviceID]
+	if !ok {
+		return nil, false
+	}
+	found := *v
+	return &found, true
+}
+
+// Alerts returns the alerts currently firing, oldest first
+func (t *Tracker) Alerts() []Alert {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := make([]Alert, 0, len(t.active))
+	for _, a := range t.active {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Since.Equal(list[j].Since) {
+			return list[i].Since.Before(list[j].Since)
+		}
+		return list[i].DeviceID < list[j].DeviceID
+	})
+	return list
+}
+
+// History reads a device's battery and RSSI from the metadata of its readings in [start, end), oldest first
+func (t *Tracker) History(ctx context.Context, deviceID string, start, end time.Time, limit int) ([]Sample, error) {
+	rows, err := t.db.QueryContext(ctx, `
+        SELECT time, metadata
+        FROM sensor_readings
+        WHERE device_id = $1 AND time >= $2 AND time < $3 AND metadata IS NOT NULL
+        ORDER BY time ASC
+        LIMIT $4
+    `, deviceID, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []Sample
+	for rows.Next() {
+		var at time.Time
+		var raw []byte
+		if err := rows.Scan(&at, &raw); err != nil {
+			return nil, err
+		}
+		var metadata map[string]interface{}
+		if err := json.Unmarshal(raw, &metadata); err != nil {
+			continue
+		}
+		battery, rssi := Extract(metadata)
+		if battery == nil && rssi == nil {
+			continue
+		}
+		samples = append(samples, Sample{Time: at, Battery: battery, RSSI: rssi})
+	}
+	return samples, rows.Err()
+}
+
+// Rules returns every alert rule sorted by name
+func (t *Tracker) Rules() []Rule {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := make([]Rule, 0, len(t.rules))
+	for _, rule := range t.rules {
+		list = append(list, *rule)
+	}
+	return list
+}
+
+// SaveRule validates and creates or replaces a rule; alerts it was firing are dropped and
+// re-evaluated against the new rule on each device's next reading
+func (t *Tracker) SaveRule(rule Rule) (*Rule, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	settings, err := json.Marshal(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO vitals_rules (name, settings, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (name) DO UPDATE SET
+            settings = EXCLUDED.settings,
+            updated_at = NOW()
+        RETURNING updated_at
+    `
+	if err := t.db.QueryRow(query, rule.Name, settings).Scan(&rule.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to save vitals rule: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeRuleLocked(rule.Name)
+	t.rules = append(t.rules, &rule)
+	sort.Slice(t.rules, func(i, j int) bool { return t.rules[i].Name < t.rules[j].Name })
+	return &rule, nil
+}
+
+// DeleteRule removes a rule and its firing alerts; it reports false if it did not exist
+func (t *Tracker) DeleteRule(name string) (bool, error) {
+	result, err := t.db.Exec(`DELETE FROM vitals_rules WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeRuleLocked(name)
+	return n > 0, nil
+}
+
+func (t *Tracker) removeRuleLocked(name string) {
+	for i, existing := range t.rules {
+		if existing.Name == name {
+			t.rules = append(t.rules[:i], t.rules[i+1:]...)
+			break
+		}
+	}
+	for key := range t.active {
+		if key.rule == name {
+			delete(t.active, key)
+		}
+	}
+}
+
+// ImportRules saves a batch of rules (used by configuration bundles)
+func (t *Tracker) ImportRules(rules []Rule) (int, error) {
+	for i, rule := range rules {
+		if _, err := t.SaveRule(rule); err != nil {
+			return i, fmt.Errorf("%s: %w", rule.Name, err)
+		}
+	}
+	return len(rules), nil
+}
+
+// Start writes changed vitals every interval
+func (t *Tracker) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := t.Flush(); err != nil {
+				log.Printf("Failed to write device vitals: %v", err)
+			}
+		}
+	}()
+}
+
+// Flush writes the vitals changed since the last flush in one statement
+func (t *Tracker) Flush() error {
+	t.mu.Lock()
+	if len(t.dirty) == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	var (
+		ids, deviceTypes, locations []string
+		batteries, rssis            []*float64
+		batteryTimes, rssiTimes     []*time.Time
+	)
+	for id := range t.dirty {
+		v := t.vitals[id]
+		ids = append(ids, id)
+		deviceTypes = append(deviceTypes, v.DeviceType)
+		locations = append(locations, v.Location)
+		batteries = append(batteries, v.Battery)
+		batteryTimes = append(batteryTimes, v.BatteryAt)
+		rssis = append(rssis, v.RSSI)
+		rssiTimes = append(rssiTimes, v.RSSIAt)
+	}
+	t.dirty = make(map[string]bool)
+	t.mu.Unlock()
+
+	_, err := t.db.Exec(`
+        INSERT INTO device_vitals (device_id, device_type, location, battery, battery_at, rssi, rssi_at, updated_at)
+        SELECT v.*, NOW()
+        FROM unnest($1::text[], $2::text[], $3::text[], $4::float8[], $5::timestamptz[], $6::float8[], $7::timestamptz[])
+            AS v(device_id, device_type, location, battery, battery_at, rssi, rssi_at)
+        ON CONFLICT (device_id) DO UPDATE SET
+            device_type = EXCLUDED.device_type,
+            location = EXCLUDED.location,
+            battery = EXCLUDED.battery,
+            battery_at = EXCLUDED.battery_at,
+            rssi = EXCLUDED.rssi,
+            rssi_at = EXCLUDED.rssi_at,
+            updated_at = NOW()
+    `, ids, deviceTypes, locations, batteries, batteryTimes, rssis, rssiTimes)
+	return err
+}
@@ -0,0 +1,67 @@
+// Package vitals tracks the operational health devices report in reading metadata — battery level
+// and signal strength — and raises low-battery and weak-signal alerts from rules
+package vitals
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata keys read from readings; the first key present wins
+var (
+	batteryKeys = []string{"battery", "battery_pct", "battery_level"}
+	rssiKeys    = []string{"rssi", "rssi_dbm", "signal_strength"}
+)
+
+// Vitals is the latest battery and signal strength reported by a device
+type Vitals struct {
+	DeviceID   string     `json:"device_id"`
+	DeviceType string     `json:"device_type"`
+	Location   string     `json:"location"`
+	Battery    *float64   `json:"battery,omitempty"` // percent
+	BatteryAt  *time.Time `json:"battery_at,omitempty"`
+	RSSI       *float64   `json:"rssi,omitempty"` // dBm
+	RSSIAt     *time.Time `json:"rssi_at,omitempty"`
+}
+
+// Sample is one point of a device's vitals history
+type Sample struct {
+	Time    time.Time `json:"time"`
+	Battery *float64  `json:"battery,omitempty"`
+	RSSI    *float64  `json:"rssi,omitempty"`
+}
+
+// Extract reads battery (percent) and RSSI (dBm) from reading metadata; either may be nil
+func Extract(metadata map[string]interface{}) (battery, rssi *float64) {
+	return lookup(metadata, batteryKeys), lookup(metadata, rssiKeys)
+}
+
+func lookup(metadata map[string]interface{}, keys []string) *float64 {
+	for _, key := range keys {
+		v, ok := metadata[key]
+		if !ok {
+			continue
+		}
+		if f, ok := number(v); ok {
+			return &f
+		}
+	}
+	return nil
+}
+
+// number accepts JSON numbers and numeric strings such as "87" or "87%"
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(n, "%")), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
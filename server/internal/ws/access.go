@@ -0,0 +1,104 @@
+package ws
+
+import (
+	"net/http"
+	"strings"
+
+	"edge-insights/internal/roles"
+)
+
+// accessRule sets the least role allowed to call the API paths under prefix with methods
+type accessRule struct {
+	prefix  string
+	methods string // space-separated, e.g. "PUT DELETE"; empty for every method
+	min     roles.Role
+	action  string // what is refused, e.g. "Managing device API keys"
+}
+
+// accessRules is the API's access policy, first match wins. Viewers read logs and metrics and
+// get summaries; operators also use the AI endpoints and acknowledge incidents; admins configure
+// the platform: devices, keys, rules, ingestion sources, integrations and prompts
+// Paths no rule matches are open to viewers for GET and HEAD and need the admin role otherwise
+var accessRules = []accessRule{
+	// Admin: devices and their credentials
+	{prefix: "/api/device-keys", min: roles.Admin, action: "Managing device API keys"},
+	{prefix: "/api/devices", methods: "POST PUT PATCH DELETE", min: roles.Admin, action: "Managing devices"},
+	{prefix: "/api/admin", min: roles.Admin, action: "Exporting and importing configuration"},
+	{prefix: "/api/export", min: roles.Admin, action: "Exporting readings to files"},
+	{prefix: "/api/notify", min: roles.Admin, action: "Managing notifications and outgoing webhooks"},
+
+	// AI: viewers get summaries and anomaly reports (ai.CapabilitySummary), operators the rest,
+	// admins the prompts, shadow runs and baselines
+	{prefix: "/api/ai/capabilities", min: roles.Viewer},
+	{prefix: "/api/ai/summarize", min: roles.Viewer},
+	{prefix: "/api/ai/summaries", min: roles.Viewer},
+	{prefix: "/api/ai/anomalies/baselines/recompute", min: roles.Admin, action: "Recomputing baselines"},
+	{prefix: "/api/ai/anomalies", methods: "GET HEAD", min: roles.Viewer},
+	{prefix: "/api/ai/prompts", min: roles.Admin, action: "Managing prompt templates"},
+	{prefix: "/api/ai/shadow", min: roles.Admin, action: "Reviewing shadow runs"},
+	{prefix: "/api/ai", min: roles.Operator, action: "Using the AI endpoints"},
+
+	// Operator: incident acknowledgement and descriptions, share links
+	{prefix: "/api/incidents", methods: "PATCH POST", min: roles.Operator, action: "Updating incidents"},
+	{prefix: "/api/shares", methods: "POST DELETE", min: roles.Operator, action: "Managing share links"},
+
+	// Viewer: reading data through jobs and cancelling one's own requests
+	// (query job kinds that need more are checked by the handler)
+	{prefix: "/api/query", methods: "POST", min: roles.Viewer},
+	{prefix: "/api/queries", min: roles.Viewer},
+	{prefix: "/api/requests", methods: "POST", min: roles.Viewer},
+}
+
+// authorize enforces accessRules on /api/* with the caller's role (see roleFromRequest)
+// Routes that authenticate their callers themselves are left to do so
+func authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || publicAPI(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		min, action := requiredRole(r.Method, r.URL.Path)
+		if !roleFromRequest(r).AtLeast(min) {
+			writeAPIError(w, r, http.StatusForbidden, "insufficient_role", action+" requires "+roleRequirement(min), nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredRole returns the least role allowed to call method on path and what it is for
+func requiredRole(method, path string) (roles.Role, string) {
+	for _, rule := range accessRules {
+		if path != rule.prefix && !strings.HasPrefix(path, rule.prefix+"/") {
+			continue
+		}
+		if rule.methods != "" && !containsField(rule.methods, method) {
+			continue
+		}
+		return rule.min, rule.action
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return roles.Viewer, ""
+	}
+	return roles.Admin, "Changing configuration"
+}
+
+func containsField(list, field string) bool {
+	for _, f := range strings.Fields(list) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// roleRequirement names the roles that include min, for error messages
+func roleRequirement(min roles.Role) string {
+	switch min {
+	case roles.Operator:
+		return "the operator or admin role"
+	case roles.Admin:
+		return "the admin role"
+	}
+	return "a role"
+}
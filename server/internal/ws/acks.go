@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// maxMsgIDLength bounds the client-supplied msg_id of a log frame
+const maxMsgIDLength = 128
+
+// ackState is what the server knows about a msg_id it has seen from a device
+type ackState int
+
+const (
+	ackNew     ackState = iota // not seen within the window: store the log
+	ackPending                 // being stored on another connection: ask the device to retry
+	ackStored                  // acknowledged as stored: acknowledge again without storing
+	ackQueued                  // acknowledged as dead-lettered: acknowledge again without storing
+)
+
+type ackKey struct {
+	deviceID, msgID string
+}
+
+type ackEntry struct {
+	state ackState
+	at    time.Time
+	elem  *list.Element // the entry's key in ackCache.order
+}
+
+// ackCache remembers the msg_ids acknowledged per device for a window, so a device that resends a
+// log after losing its acknowledgement (a dropped connection, a timeout) does not store it twice
+// It is held in memory: a resend that reaches another replica or crosses a restart is stored again
+type ackCache struct {
+	window     time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[ackKey]*ackEntry
+	order   *list.List // of ackKey, oldest first, to expire entries
+}
+
+func newAckCache(window time.Duration, maxEntries int) *ackCache {
+	return &ackCache{window: window, maxEntries: maxEntries, entries: make(map[ackKey]*ackEntry), order: list.New()}
+}
+
+// begin looks up a msg_id and, when it is new, marks it pending until finish or abort
+func (c *ackCache) begin(deviceID, msgID string) ackState {
+	now := time.Now()
+	key := ackKey{deviceID, msgID}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		if now.Sub(entry.at) < c.window {
+			return entry.state
+		}
+		c.order.Remove(entry.elem)
+	}
+	c.entries[key] = &ackEntry{state: ackPending, at: now, elem: c.order.PushBack(key)}
+	c.expire(now)
+	return ackNew
+}
+
+// finish records that a pending msg_id was acknowledged as stored or queued
+func (c *ackCache) finish(deviceID, msgID string, queued bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[ackKey{deviceID, msgID}]; ok {
+		entry.state = ackStored
+		if queued {
+			entry.state = ackQueued
+		}
+	}
+}
+
+// abort forgets a pending msg_id whose log was not stored, so the device's resend is stored
+func (c *ackCache) abort(deviceID, msgID string) {
+	key := ackKey{deviceID, msgID}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		c.order.Remove(entry.elem)
+		delete(c.entries, key)
+	}
+}
+
+// finishAck and abortAck settle the msg_id of a log that was stored or failed; logs sent without
+// one are not tracked
+func (h *Handler) finishAck(deviceID, msgID string, queued bool) {
+	if msgID != "" {
+		h.acks.finish(deviceID, msgID, queued)
+	}
+}
+
+func (h *Handler) abortAck(deviceID, msgID string) {
+	if msgID != "" {
+		h.acks.abort(deviceID, msgID)
+	}
+}
+
+// duplicateResponse acknowledges a resent log as the first copy was acknowledged
+func duplicateResponse(queued bool) types.LogResponse {
+	response := successResponse("Log already stored")
+	if queued {
+		response = queuedResponse()
+	}
+	response.Duplicate = true
+	return response
+}
+
+// expire drops entries older than the window, then the oldest while there are more than
+// maxEntries, so the cache never outgrows maxEntries. A pending entry is dropped like any other:
+// a log still being stored after the window, or pushed out by newer ones, may be stored twice
+func (c *ackCache) expire(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		key := elem.Value.(ackKey)
+		if now.Sub(c.entries[key].at) < c.window && len(c.entries) <= c.maxEntries {
+			break
+		}
+		delete(c.entries, key)
+		c.order.Remove(elem)
+	}
+}
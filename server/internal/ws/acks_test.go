@@ -0,0 +1,49 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAckCacheEviction(t *testing.T) {
+	c := newAckCache(time.Minute, 2)
+
+	// An aborted msg_id leaves no slot behind to evict a newer entry
+	c.begin("d1", "a")
+	c.abort("d1", "a")
+	c.begin("d1", "b")
+	c.finish("d1", "b", false)
+	c.begin("d1", "c")
+	c.finish("d1", "c", false)
+	if got := c.begin("d1", "b"); got != ackStored {
+		t.Errorf("b: got %v, want stored", got)
+	}
+	if got := c.begin("d1", "c"); got != ackStored {
+		t.Errorf("c: got %v, want stored", got)
+	}
+
+	// Over maxEntries the oldest entry goes
+	if got := c.begin("d1", "d"); got != ackNew {
+		t.Errorf("d: got %v, want new", got)
+	}
+	if len(c.entries) != 2 || c.order.Len() != 2 {
+		t.Errorf("%d entries, %d in order, want 2", len(c.entries), c.order.Len())
+	}
+	if _, ok := c.entries[ackKey{"d1", "b"}]; ok {
+		t.Error("b was kept, want it evicted as the oldest")
+	}
+}
+
+func TestAckCacheRebegin(t *testing.T) {
+	c := newAckCache(time.Minute, 10)
+	c.begin("d1", "a")
+	c.entries[ackKey{"d1", "a"}].at = time.Now().Add(-2 * time.Minute)
+
+	// A msg_id seen again after the window is new, and keeps one slot
+	if got := c.begin("d1", "a"); got != ackNew {
+		t.Errorf("got %v, want new", got)
+	}
+	if c.order.Len() != 1 {
+		t.Errorf("%d slots in order, want 1", c.order.Len())
+	}
+}
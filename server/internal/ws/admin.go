@@ -0,0 +1,234 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"edge-insights/internal/alerts"
+	"edge-insights/internal/archive"
+	"edge-insights/internal/derived"
+	"edge-insights/internal/devices"
+	"edge-insights/internal/hooks"
+	"edge-insights/internal/ingest/decoder"
+	"edge-insights/internal/ingest/email"
+	"edge-insights/internal/ingest/syslog"
+	"edge-insights/internal/ingest/webhook"
+	"edge-insights/internal/poller"
+	"edge-insights/internal/slo"
+	"edge-insights/internal/vitals"
+)
+
+// registerConfigSections wires every configurable subsystem into the export/import registry
+func (s *Server) registerConfigSections() {
+	s.config.Register(archive.Section{
+		Name: "derived_metrics",
+		Export: func() (interface{}, error) {
+			return s.handler.derived.List(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var definitions []derived.Definition
+			if err := json.Unmarshal(data, &definitions); err != nil {
+				return 0, err
+			}
+			return s.handler.derived.Import(definitions)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "devices",
+		Export: func() (interface{}, error) {
+			return s.registry.List(devices.Filter{}), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var list []devices.Device
+			if err := json.Unmarshal(data, &list); err != nil {
+				return 0, err
+			}
+			return s.registry.Import(list)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "vitals_rules",
+		Export: func() (interface{}, error) {
+			return s.vitals.Rules(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var rules []vitals.Rule
+			if err := json.Unmarshal(data, &rules); err != nil {
+				return 0, err
+			}
+			return s.vitals.ImportRules(rules)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "alert_rules",
+		Export: func() (interface{}, error) {
+			return s.alerts.Rules(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var rules []alerts.Rule
+			if err := json.Unmarshal(data, &rules); err != nil {
+				return 0, err
+			}
+			return s.alerts.ImportRules(rules)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "outgoing_webhooks",
+		Export: func() (interface{}, error) {
+			return s.hooks.List(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var list []hooks.Hook
+			if err := json.Unmarshal(data, &list); err != nil {
+				return 0, err
+			}
+			return s.hooks.Import(list)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "slos",
+		Export: func() (interface{}, error) {
+			return s.slos.List(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var list []slo.SLO
+			if err := json.Unmarshal(data, &list); err != nil {
+				return 0, err
+			}
+			return s.slos.Import(list)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "webhook_mappings",
+		Export: func() (interface{}, error) {
+			return s.webhooks.List(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var mappings []webhook.Mapping
+			if err := json.Unmarshal(data, &mappings); err != nil {
+				return 0, err
+			}
+			return s.webhooks.Import(mappings)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "decoder_profiles",
+		Export: func() (interface{}, error) {
+			return s.decoders.List(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var profiles []decoder.Profile
+			if err := json.Unmarshal(data, &profiles); err != nil {
+				return 0, err
+			}
+			return s.decoders.Import(profiles)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "poller_endpoints",
+		Export: func() (interface{}, error) {
+			return s.endpoints.List(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var endpoints []poller.Endpoint
+			if err := json.Unmarshal(data, &endpoints); err != nil {
+				return 0, err
+			}
+			n, err := s.endpoints.Import(endpoints)
+			s.reloadPoller()
+			return n, err
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "syslog_sources",
+		Export: func() (interface{}, error) {
+			return s.syslog.List(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var sources []syslog.Source
+			if err := json.Unmarshal(data, &sources); err != nil {
+				return 0, err
+			}
+			return s.syslog.Import(sources)
+		},
+	})
+
+	s.config.Register(archive.Section{
+		Name: "email_rules",
+		Export: func() (interface{}, error) {
+			return s.email.List(), nil
+		},
+		Import: func(data json.RawMessage) (int, error) {
+			var rules []email.Rule
+			if err := json.Unmarshal(data, &rules); err != nil {
+				return 0, err
+			}
+			return s.email.Import(rules)
+		},
+	})
+}
+
+// sectionsParam parses the optional comma-separated ?sections= filter
+func sectionsParam(r *http.Request) []string {
+	var names []string
+	for _, name := range strings.Split(r.URL.Query().Get("sections"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// configExportHandler returns the platform configuration as a downloadable JSON bundle
+func (s *Server) configExportHandler(w http.ResponseWriter, r *http.Request) {
+	bundle, err := s.config.Export(sectionsParam(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Config export error", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("edge-insights-config-%s.json", bundle.ExportedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(bundle)
+}
+
+// configImportHandler applies a previously exported bundle
+func (s *Server) configImportHandler(w http.ResponseWriter, r *http.Request) {
+	var bundle archive.Bundle
+	if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	applied, err := s.config.Import(&bundle, sectionsParam(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Config import error", "error", err)
+		writeAPIError(w, r, http.StatusUnprocessableEntity, codeValidationFailed, err.Error(),
+			map[string]interface{}{"applied": applied})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"applied":     applied,
+		"imported_at": time.Now().UTC(),
+	})
+}
@@ -0,0 +1,150 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/alerts"
+	"edge-insights/internal/incidents"
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// startAlerts evaluates threshold rules on stored readings, pushes alert changes on the live feed
+// and files them into incidents; rules with suggest_remediation get AI-suggested steps
+// unless ALERT_AI_REMEDIATION=false
+func (s *Server) startAlerts() {
+	if getEnv("ALERT_AI_REMEDIATION", "true") != "false" {
+		s.alerts.SetAdvisor(s.suggestRemediation)
+	}
+	s.handler.OnStored(s.alerts.Observe)
+	s.alerts.OnAlert(func(alert alerts.Alert) {
+		event := alert.Event()
+		s.handler.broadcastMatching(types.NewEvent(types.EventAlert, event), func(sub types.Subscription) bool {
+			return sub.MatchesDevice(alert.DeviceID, alert.DeviceType, alert.Location)
+		})
+		s.recordSignal(incidents.AlertSignal(event))
+		s.hooks.Dispatch(alert.Notification())
+	})
+}
+
+// suggestRemediation has the AI suggest steps for a firing alert from its rule's runbook and the
+// timeline of the incident the alert was filed into; the steps are kept for /api/ai/search
+func (s *Server) suggestRemediation(ctx context.Context, alert alerts.Alert, runbook *alerts.Runbook) (string, error) {
+	incident, err := s.incidents.ForSignal(incidents.AlertSignal(alert.Event()).Key)
+	if err != nil {
+		return "", fmt.Errorf("incident for alert %s: %w", alert.ID, err)
+	}
+	steps, err := s.ai.SuggestRemediation(ctx, *incident, runbook.String())
+	if err != nil {
+		return "", err
+	}
+	s.ai.Remember(ai.KnowledgeEntry{
+		Kind:      ai.KnowledgeRemediation,
+		SourceID:  alert.ID,
+		Time:      alert.FiredAt,
+		DeviceIDs: []string{alert.DeviceID},
+		Locations: nonEmpty(alert.Location),
+		Title:     fmt.Sprintf("Remediation for %s on %s", alert.Rule, alert.DeviceID),
+		Content:   steps,
+	})
+	return steps, nil
+}
+
+// alertsHandler lists alerts raised by threshold rules, most recently fired first (GET)
+// Accepts rule, device_id, location, severity, firing=true and limit
+func (s *Server) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := alerts.Filter{
+		Rule:     q.Get("rule"),
+		DeviceID: q.Get("device_id"),
+		Location: q.Get("location"),
+		Severity: q.Get("severity"),
+		Firing:   q.Get("firing") == "true",
+	}
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		filter.Limit = l
+	}
+
+	list, err := s.alerts.Alerts(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, "Failed to list alerts", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alerts": list,
+		"count":  len(list),
+	})
+}
+
+// alertRulesHandler lists the threshold alert rules (GET)
+func (s *Server) alertRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules := s.alerts.Rules()
+	for i := range rules {
+		rules[i].Notify = notify.Masked(rules[i].Notify)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": rules,
+		"count": len(rules),
+	})
+}
+
+// saveAlertRuleHandler creates or replaces /api/alert-rules/{name} (PUT)
+func (s *Server) saveAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var rule alerts.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	rule.Name = chi.URLParam(r, "name")
+
+	// Credentials left masked from a listing keep their stored values
+	var stored []notify.Config
+	for _, existing := range s.alerts.Rules() {
+		if existing.Name == rule.Name {
+			stored = existing.Notify
+		}
+	}
+	var err error
+	if rule.Notify, err = notify.Unmasked(rule.Notify, stored); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := s.alerts.SaveRule(rule)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving alert rule", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := *saved
+	response.Notify = notify.Masked(saved.Notify)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// deleteAlertRuleHandler removes /api/alert-rules/{name} (DELETE)
+func (s *Server) deleteAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.alerts.DeleteRule(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, "Error deleting alert rule", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Alert rule not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
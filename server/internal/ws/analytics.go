@@ -0,0 +1,199 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"edge-insights/internal/db"
+)
+
+// analyticsQuery holds the parameters shared by the /api/analytics endpoints
+type analyticsQuery struct {
+	filter db.ReadingFilter
+	width  time.Duration
+	maxGap time.Duration // readings stop counting after this long without a newer one
+	start  time.Time
+	end    time.Time
+}
+
+// parseAnalyticsQuery reads device_id/device_type/location, bucket width, max_gap (default one bucket),
+// start/end (RFC3339, default the last 24 hours) and axis (time or ingested_at) from the query string
+func parseAnalyticsQuery(r *http.Request) (*analyticsQuery, error) {
+	q := r.URL.Query()
+	aq := &analyticsQuery{
+		filter: db.ReadingFilter{
+			DeviceID:   q.Get("device_id"),
+			DeviceType: q.Get("device_type"),
+			Location:   q.Get("location"),
+		},
+		width: time.Hour,
+		end:   time.Now(),
+	}
+	if aq.filter.DeviceID == "" && aq.filter.DeviceType == "" {
+		return nil, fmt.Errorf("device_id or device_type is required")
+	}
+	axis, ok := db.ParseTimeAxis(q.Get("axis"))
+	if !ok {
+		return nil, fmt.Errorf("axis must be time or ingested_at")
+	}
+	aq.filter.Axis = axis
+
+	if v := q.Get("width"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("width must be a duration of at least 1m")
+		}
+		aq.width = d
+	}
+	aq.maxGap = aq.width
+	if v := q.Get("max_gap"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("max_gap must be a positive duration")
+		}
+		aq.maxGap = d
+	}
+	if v := q.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("end must be RFC3339")
+		}
+		aq.end = t
+	}
+	aq.start = aq.end.Add(-24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("start must be RFC3339")
+		}
+		aq.start = t
+	}
+	if !aq.start.Before(aq.end) {
+		return nil, fmt.Errorf("start must be before end")
+	}
+	return aq, nil
+}
+
+// timeWeightedHandler serves GET /api/analytics/time-weighted: time-weighted averages per bucket,
+// for devices that report at irregular intervals
+func (s *Server) timeWeightedHandler(w http.ResponseWriter, r *http.Request) {
+	aq, err := parseAnalyticsQuery(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := db.GetTimeWeightedBuckets(r.Context(), s.db, aq.filter, aq.width, aq.maxGap, aq.start, aq.end)
+	if err != nil {
+		writeError(w, r, "Error computing time-weighted averages", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"axis":    aq.filter.Axis,
+		"width":   aq.width.String(),
+		"max_gap": aq.maxGap.String(),
+		"buckets": buckets,
+		"count":   len(buckets),
+	})
+}
+
+// counterHandler serves GET /api/analytics/counter: increase and rate per bucket of a cumulative
+// metric, with counter resets detected instead of producing negative deltas
+func (s *Server) counterHandler(w http.ResponseWriter, r *http.Request) {
+	aq, err := parseAnalyticsQuery(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := db.GetCounterBuckets(r.Context(), s.db, aq.filter, aq.width, aq.start, aq.end)
+	if err != nil {
+		writeError(w, r, "Error computing counter increases", err)
+		return
+	}
+
+	var total float64
+	var resets int64
+	for _, b := range buckets {
+		total += b.Increase
+		resets += b.Resets
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"axis":           aq.filter.Axis,
+		"width":          aq.width.String(),
+		"buckets":        buckets,
+		"count":          len(buckets),
+		"total_increase": total,
+		"resets":         resets,
+	})
+}
+
+// stateHandler serves GET /api/analytics/state: on/off durations, occupancy percentage and
+// transitions per bucket for boolean series such as motion detectors and door contacts
+func (s *Server) stateHandler(w http.ResponseWriter, r *http.Request) {
+	aq, err := parseAnalyticsQuery(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := db.GetStateBuckets(r.Context(), s.db, aq.filter, aq.width, aq.maxGap, aq.start, aq.end)
+	if err != nil {
+		writeError(w, r, "Error computing state analytics", err)
+		return
+	}
+
+	var on, off float64
+	var transitions int64
+	for _, b := range buckets {
+		on += b.OnSeconds
+		off += b.OffSeconds
+		transitions += b.Transitions
+	}
+	summary := map[string]interface{}{
+		"on_seconds":  on,
+		"off_seconds": off,
+		"transitions": transitions,
+	}
+	if on+off > 0 {
+		summary["occupancy_pct"] = 100 * on / (on + off)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"axis":    aq.filter.Axis,
+		"width":   aq.width.String(),
+		"max_gap": aq.maxGap.String(),
+		"buckets": buckets,
+		"count":   len(buckets),
+		"summary": summary,
+	})
+}
+
+// ingestDelayHandler serves GET /api/analytics/ingest-delay: per-device delay between the
+// device-reported time and the server receive time for readings received in the window
+func (s *Server) ingestDelayHandler(w http.ResponseWriter, r *http.Request) {
+	aq, err := parseAnalyticsQuery(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	delays, err := db.GetIngestDelays(r.Context(), s.db, aq.filter, aq.start, aq.end)
+	if err != nil {
+		writeError(w, r, "Error computing ingest delays", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"devices": delays,
+		"count":   len(delays),
+	})
+}
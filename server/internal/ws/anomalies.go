@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"edge-insights/internal/anomaly"
+	"edge-insights/internal/db"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// aiBacktestHandler runs the anomaly detector over a past range and reports what it would have found
+// The body's config overrides fields of the running configuration, so sensitivity can be tuned
+// against known incidents before the ANOMALY_* variables are changed
+func (s *Server) aiBacktestHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		jobRange
+		db.ReadingFilter
+		Config    json.RawMessage    `json:"config"`
+		Incidents []anomaly.Incident `json:"incidents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config := s.ai.AnomalyConfig()
+	if len(req.Config) > 0 {
+		if err := json.Unmarshal(req.Config, &config); err != nil {
+			httpError(w, r, "Invalid config: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := config.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, incident := range req.Incidents {
+		if err := incident.Validate(); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// One reading past the cap tells us the range was cut short
+	maxReadings := anomaly.MaxReadings()
+	readings, err := db.GetReadingsBetween(r.Context(), s.db, req.ReadingFilter, req.Start, req.End, maxReadings+1)
+	if err != nil {
+		writeError(w, r, "Anomaly backtest failed", err)
+		return
+	}
+	// A cut-short range ends at its last reading, so devices past it are not taken for silent
+	end := req.End
+	truncated := len(readings) > maxReadings
+	if truncated {
+		readings = readings[:maxReadings]
+		end = readings[len(readings)-1].Time
+	}
+
+	// Baselines are learned from the history before the range, as live detection would have had them
+	var baselines map[string]anomaly.Baseline
+	if config.Baselines {
+		learner := s.ai.Baselines()
+		baselines, err = learner.Compute(r.Context(), req.Start.Add(-learner.Window()), req.Start)
+		if err != nil {
+			writeError(w, r, "Anomaly backtest failed", err)
+			return
+		}
+	}
+
+	report := anomaly.Backtest(config, baselines, readings, end, req.Incidents)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start":     req.Start,
+		"end":       req.End,
+		"truncated": truncated,
+		"report":    report,
+	})
+}
+
+// anomalyBaselinesHandler lists the learned per-device baselines, optionally narrowed by device_type and location
+func (s *Server) anomalyBaselinesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	baselines := []anomaly.Baseline{}
+	for _, b := range s.ai.Baselines().List() {
+		if deviceType := q.Get("device_type"); deviceType != "" && b.DeviceType != deviceType {
+			continue
+		}
+		if location := q.Get("location"); location != "" && b.Location != location {
+			continue
+		}
+		baselines = append(baselines, b)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"baselines": baselines,
+		"count":     len(baselines),
+		"window":    s.ai.Baselines().Window().String(),
+	})
+}
+
+// anomalyBaselineHandler returns one device's baseline (GET /api/ai/anomalies/baselines/{device_id})
+func (s *Server) anomalyBaselineHandler(w http.ResponseWriter, r *http.Request) {
+	baseline, ok := s.ai.Baselines().Get(chi.URLParam(r, "device_id"))
+	if !ok {
+		httpError(w, r, "No baseline learned for this device", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(baseline)
+}
+
+// recomputeBaselinesHandler relearns every baseline now (POST /api/ai/anomalies/baselines/recompute, admin)
+func (s *Server) recomputeBaselinesHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := s.ai.Baselines().Recompute(r.Context())
+	if err != nil {
+		writeError(w, r, "Failed to recompute baselines", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"devices": n,
+	})
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"edge-insights/internal/auth"
+	"edge-insights/internal/roles"
+)
+
+// authenticate requires a valid bearer token (JWT) on /api/* when AUTH_JWT_SECRET or
+// AUTH_JWT_PUBLIC_KEY_FILE is set, and puts the token's role on the request context
+// Routes that authenticate callers their own way (device keys, webhook and email tokens, Slack
+// signatures, share tokens) are left to do so. Without either setting every caller gets DEFAULT_ROLE
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.authErr == nil && s.verifier == nil || !strings.HasPrefix(r.URL.Path, "/api/") || publicAPI(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.authErr != nil {
+			writeAPIError(w, r, http.StatusServiceUnavailable, "auth_unavailable", "Authentication is misconfigured on the server", nil)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="edge-insights"`)
+			writeAPIError(w, r, http.StatusUnauthorized, "missing_token", "A bearer token is required", nil)
+			return
+		}
+		claims, err := s.verifier.Verify(strings.TrimSpace(token), time.Now())
+		if err != nil {
+			code := "invalid_token"
+			var authErr *auth.Error
+			if errors.As(err, &authErr) {
+				code = authErr.Code
+			}
+			slog.InfoContext(r.Context(), "Rejected bearer token", "path", r.URL.Path, "error", err)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="edge-insights", error=%q, error_description=%q`, code, err.Error()))
+			writeAPIError(w, r, http.StatusUnauthorized, code, err.Error(), nil)
+			return
+		}
+
+		ctx := roles.WithRole(auth.WithSubject(r.Context(), claims.Subject), claims.Role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateFeed authenticates the live-feed WebSocket routes before the upgrade, which the
+// /api middleware does not cover, and puts the caller's role on the request context. Browsers
+// cannot set headers on an upgrade, so the token may also be sent as ?access_token=
+// Without AUTH_JWT_SECRET or AUTH_JWT_PUBLIC_KEY_FILE every caller gets DEFAULT_ROLE
+// Devices (/ws) may connect without a token: such connections send logs but get no live feed,
+// and a bearer that is not a valid token is taken for a device API key (checked by the handler)
+func (s *Server) authenticateFeed(devices bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.authErr != nil {
+				httpError(w, r, "Authentication is misconfigured on the server", http.StatusServiceUnavailable)
+				return
+			}
+			if s.verifier == nil {
+				next.ServeHTTP(w, r.WithContext(roles.WithRole(r.Context(), roleFromRequest(r))))
+				return
+			}
+
+			token := r.URL.Query().Get("access_token")
+			if token == "" {
+				token, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			}
+			token = strings.TrimSpace(token)
+			if token == "" {
+				if devices {
+					next.ServeHTTP(w, r)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer realm="edge-insights"`)
+				httpError(w, r, "A bearer token is required", http.StatusUnauthorized)
+				return
+			}
+			claims, err := s.verifier.Verify(token, time.Now())
+			if err != nil {
+				if devices && apiKeyFromRequest(r) != "" {
+					next.ServeHTTP(w, r)
+					return
+				}
+				slog.InfoContext(r.Context(), "Rejected live feed token", "path", r.URL.Path, "error", err)
+				httpError(w, r, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			ctx := roles.WithRole(auth.WithSubject(r.Context(), claims.Subject), claims.Role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// publicAPI reports whether an /api route authenticates its callers itself
+func publicAPI(r *http.Request) bool {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/api/shared/"), strings.HasPrefix(path, "/api/slack/"):
+		return true
+	case r.Method != http.MethodPost:
+		return false
+	}
+	return path == "/api/ingest" || path == "/api/ingest/" || path == "/api/ingest/email" ||
+		strings.HasPrefix(path, "/api/ingest/webhook/")
+}
@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"edge-insights/internal/auth"
+	"edge-insights/internal/roles"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// statusClientClosedRequest is reported when a query was cancelled before it finished (nginx's 499)
+const statusClientClosedRequest = 499
+
+// inflightRequests tracks synchronous queries that carry an X-Request-ID so they can be cancelled explicitly
+type inflightRequests struct {
+	mu      sync.Mutex
+	cancels map[string]inflightRequest
+}
+
+// inflightRequest is a running request and who sent it
+type inflightRequest struct {
+	cancel  context.CancelFunc
+	subject string // the caller's token subject; empty when it presented none
+}
+
+func newInflightRequests() *inflightRequests {
+	return &inflightRequests{cancels: make(map[string]inflightRequest)}
+}
+
+// cancellable binds the request context to an X-Request-ID chosen by the client (use a random UUID)
+// Client disconnects already cancel r.Context(); the ID adds POST /api/requests/{id}/cancel
+// for clients that cannot abort the HTTP request itself. Database queries run under this
+// context, so pgx sends a cancel request to Postgres (pg_cancel_backend) when it is cancelled
+func (s *Server) cancellable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		s.inflight.mu.Lock()
+		if _, exists := s.inflight.cancels[id]; exists {
+			s.inflight.mu.Unlock()
+			httpError(w, r, "A request with this X-Request-ID is already running", http.StatusConflict)
+			return
+		}
+		subject, _ := auth.SubjectFromContext(r.Context())
+		s.inflight.cancels[id] = inflightRequest{cancel: cancel, subject: subject}
+		s.inflight.mu.Unlock()
+
+		defer func() {
+			s.inflight.mu.Lock()
+			delete(s.inflight.cancels, id)
+			s.inflight.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// cancelRequestHandler cancels a running request by its X-Request-ID (POST /api/requests/{id}/cancel)
+// Requests sent with a token can only be cancelled by the same subject or an admin; others'
+// requests are not found
+func (s *Server) cancelRequestHandler(w http.ResponseWriter, r *http.Request) {
+	s.inflight.mu.Lock()
+	running, ok := s.inflight.cancels[chi.URLParam(r, "id")]
+	s.inflight.mu.Unlock()
+	if ok && running.subject != "" && !roleFromRequest(r).AtLeast(roles.Admin) {
+		subject, _ := auth.SubjectFromContext(r.Context())
+		ok = subject == running.subject
+	}
+	if !ok {
+		httpError(w, r, "No running request with this ID", http.StatusNotFound)
+		return
+	}
+
+	running.cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
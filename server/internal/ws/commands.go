@@ -0,0 +1,208 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/auth"
+	"edge-insights/internal/commands"
+	"edge-insights/internal/devicekeys"
+	"edge-insights/internal/types"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// UseCommands makes /ws deliver the commands queued in store to their devices and record the
+// devices' status reports
+func (h *Handler) UseCommands(store *commands.Store) {
+	h.commands = store
+}
+
+// deliverCommands writes the commands queued for deviceID to the connection it just sent a
+// reading on. A command is marked delivered once written; devices should ignore an id they have
+// already seen, since a command can be written again if its delivery could not be recorded
+func (h *Handler) deliverCommands(ctx context.Context, conn jsonWriter, deviceID string) {
+	if h.commands == nil || !h.commands.HasPending(deviceID) {
+		return
+	}
+	queued, err := h.commands.Pending(ctx, deviceID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading queued commands", "device_id", deviceID, "error", err)
+		return
+	}
+	for _, c := range queued {
+		event := types.NewEvent(types.EventCommand, types.CommandEvent{
+			ID:        c.ID,
+			DeviceID:  c.DeviceID,
+			Command:   c.Command,
+			Params:    c.Params,
+			ExpiresAt: c.ExpiresAt,
+		})
+		if err := conn.WriteJSON(event); err != nil {
+			slog.WarnContext(ctx, "Error delivering command", "device_id", deviceID, "command_id", c.ID, "error", err)
+			return
+		}
+		if _, err := h.commands.Delivered(ctx, c); err != nil {
+			slog.ErrorContext(ctx, "Error recording command delivery", "device_id", deviceID, "command_id", c.ID, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Command delivered", "device_id", deviceID, "command_id", c.ID, "command", c.Command)
+	}
+}
+
+// commandStatusFrame is a device's report on a command delivered to it (see commands.Report)
+type commandStatusFrame struct {
+	Type string `json:"type"`
+	commands.Report
+}
+
+// handleCommandFrame records a {"type": "command_status", ...} frame; it reports false for any
+// other frame. The connection's key must be valid for the command's device, as for its readings
+func (h *Handler) handleCommandFrame(ctx context.Context, conn jsonWriter, key *devicekeys.Key, message []byte) bool {
+	if h.commands == nil {
+		return false
+	}
+	var frame commandStatusFrame
+	if err := json.Unmarshal(message, &frame); err != nil || frame.Type != "command_status" {
+		return false
+	}
+
+	if err := frame.Report.Validate(); err != nil {
+		sendError(ctx, conn, types.CodeValidationFailed, err.Error())
+		return true
+	}
+	if reason, _ := h.authorizeLog(key, types.LogMessage{DeviceID: frame.DeviceID}); reason != "" {
+		sendError(ctx, conn, types.CodeUnauthorized, reason)
+		return true
+	}
+
+	c, err := h.commands.Report(ctx, frame.Report)
+	switch {
+	case errors.Is(err, commands.ErrNotFound):
+		sendError(ctx, conn, types.CodeUnknownCommand, "Unknown command "+frame.ID+" for device "+frame.DeviceID)
+	case errors.Is(err, commands.ErrTransition):
+		sendError(ctx, conn, types.CodeValidationFailed, err.Error())
+	case err != nil:
+		slog.ErrorContext(ctx, "Error recording command status", "device_id", frame.DeviceID, "command_id", frame.ID, "error", err)
+		sendError(ctx, conn, types.CodeStoreFailed, "Failed to record command status")
+	default:
+		slog.InfoContext(ctx, "Command status reported", "device_id", c.DeviceID, "command_id", c.ID, "command", c.Command, "status", c.Status)
+		sendSuccess(ctx, conn, "Command status recorded")
+	}
+	return true
+}
+
+// deviceCommandsHandler lists the commands sent to /api/devices/{id}, newest first (GET)
+// Accepts status and limit (default 50, max 500)
+func (s *Server) deviceCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var status commands.Status
+	if v := q.Get("status"); v != "" {
+		parsed, ok := commands.ParseStatus(v)
+		if !ok {
+			httpError(w, r, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		status = parsed
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			httpError(w, r, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	list, err := s.commands.List(r.Context(), chi.URLParam(r, "id"), status, limit)
+	if err != nil {
+		writeError(w, r, "Error listing device commands", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"commands": list,
+		"count":    len(list),
+	})
+}
+
+// deviceCommandHandler returns /api/devices/{id}/commands/{command_id} (GET)
+func (s *Server) deviceCommandHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := s.commands.Get(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "command_id"))
+	if err != nil {
+		writeError(w, r, "Error fetching device command", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// commandIssuer names who issues a command: the caller's token subject ("anonymous" without
+// authentication) and role
+func commandIssuer(r *http.Request) (string, string) {
+	subject, ok := auth.SubjectFromContext(r.Context())
+	if !ok {
+		subject = "anonymous"
+	}
+	return subject, string(roleFromRequest(r))
+}
+
+// issueCommandRequest is the body of POST /api/devices/{id}/commands
+type issueCommandRequest struct {
+	Command string                 `json:"command"`
+	Params  map[string]interface{} `json:"params"`
+	TTL     string                 `json:"ttl"` // how long to wait for the device, e.g. 1h (default 24h, max 168h)
+}
+
+// issueCommandHandler queues a command for /api/devices/{id} (POST; admin)
+// The command is delivered when the device next sends a reading over /ws; its issuer is the
+// caller's token subject and role
+func (s *Server) issueCommandHandler(w http.ResponseWriter, r *http.Request) {
+	var req issueCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			httpError(w, r, "ttl must be a positive duration like 1h", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	deviceID := chi.URLParam(r, "id")
+	if d, ok := s.registry.Get(deviceID); ok && !d.Active() {
+		httpError(w, r, "Device "+deviceID+" is decommissioned", http.StatusConflict)
+		return
+	}
+
+	issuedBy, role := commandIssuer(r)
+	issued, err := s.commands.Issue(r.Context(), commands.Command{
+		DeviceID:   deviceID,
+		Command:    req.Command,
+		Params:     req.Params,
+		IssuedBy:   issuedBy,
+		IssuerRole: role,
+	}, ttl)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error issuing device command", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	slog.InfoContext(r.Context(), "Command issued", "device_id", deviceID, "command_id", issued.ID,
+		"command", issued.Command, "issued_by", issuedBy, "role", issued.IssuerRole)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(issued)
+}
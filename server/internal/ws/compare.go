@@ -0,0 +1,195 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/timerange"
+)
+
+// maxCompareBuckets bounds the buckets a comparison returns; a narrower width is rejected
+const maxCompareBuckets = 2000
+
+// CompareSide is one device's bucket in a comparison
+type CompareSide struct {
+	AvgValue     float64 `json:"avg_value"`
+	MinValue     float64 `json:"min_value"`
+	MaxValue     float64 `json:"max_value"`
+	ReadingCount int64   `json:"reading_count"`
+}
+
+// CompareBucket lines up both devices' averages for one time bucket; a side is null when its
+// device did not report in the bucket
+type CompareBucket struct {
+	Bucket     time.Time    `json:"bucket"`
+	A          *CompareSide `json:"a"`
+	B          *CompareSide `json:"b"`
+	Difference *float64     `json:"difference"` // a - b, when both reported
+}
+
+// compareHandler serves GET /api/compare: two devices' readings averaged into the same buckets,
+// their difference per bucket and the correlation of their averages, to check whether a suspect
+// sensor diverges from its neighbor
+// Accepts device_a and device_b (required), range (default 24h) and width (default range / 120, at least 1m)
+func (s *Server) compareHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	deviceA, deviceB := q.Get("device_a"), q.Get("device_b")
+	if deviceA == "" || deviceB == "" {
+		httpError(w, r, "device_a and device_b are required", http.StatusBadRequest)
+		return
+	}
+	spec := q.Get("range")
+	if spec == "" {
+		spec = "24h"
+	}
+	tr, err := timerange.Parse(spec, time.Now())
+	if err != nil {
+		httpError(w, r, "Invalid range: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	width := (tr.Duration() / 120).Round(time.Minute)
+	if width < time.Minute {
+		width = time.Minute
+	}
+	if v := q.Get("width"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			httpError(w, r, "width must be a duration of at least 1m", http.StatusBadRequest)
+			return
+		}
+		width = d
+	}
+	if tr.Duration()/width > maxCompareBuckets {
+		httpError(w, r, fmt.Sprintf("width too small: the range would have more than %d buckets", maxCompareBuckets), http.StatusBadRequest)
+		return
+	}
+
+	bucketsA, err := db.GetDeviceBucketsContext(r.Context(), s.db, deviceA, width, tr.Start, tr.End)
+	if err != nil {
+		writeError(w, r, "Error loading device readings", err)
+		return
+	}
+	bucketsB, err := db.GetDeviceBucketsContext(r.Context(), s.db, deviceB, width, tr.Start, tr.End)
+	if err != nil {
+		writeError(w, r, "Error loading device readings", err)
+		return
+	}
+
+	buckets := alignBuckets(bucketsA, bucketsB)
+	var as, bs []float64
+	var sumDiff, maxDiff float64
+	for _, b := range buckets {
+		if b.Difference == nil {
+			continue
+		}
+		as, bs = append(as, b.A.AvgValue), append(bs, b.B.AvgValue)
+		sumDiff += *b.Difference
+		maxDiff = math.Max(maxDiff, math.Abs(*b.Difference))
+	}
+
+	response := map[string]interface{}{
+		"device_a":           describeCompared(deviceA, bucketsA),
+		"device_b":           describeCompared(deviceB, bucketsB),
+		"start":              tr.Start,
+		"end":                tr.End,
+		"width":              width.String(),
+		"buckets":            buckets,
+		"count":              len(buckets),
+		"aligned":            len(as), // buckets where both devices reported
+		"correlation":        correlation(as, bs),
+		"mean_difference":    nil,
+		"max_abs_difference": nil,
+	}
+	if len(as) > 0 {
+		response["mean_difference"] = sumDiff / float64(len(as))
+		response["max_abs_difference"] = maxDiff
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// alignBuckets merges two devices' buckets by time; both are ordered by bucket. A device that
+// changed type or location within a bucket has several rows for it, which are combined
+func alignBuckets(a, b []db.AggregateBucket) []CompareBucket {
+	index := make(map[time.Time]int)
+	var buckets []CompareBucket
+	add := func(src []db.AggregateBucket, side func(*CompareBucket) **CompareSide) {
+		for _, ab := range src {
+			i, ok := index[ab.Bucket]
+			if !ok {
+				i = len(buckets)
+				index[ab.Bucket] = i
+				buckets = append(buckets, CompareBucket{Bucket: ab.Bucket})
+			}
+			p := side(&buckets[i])
+			*p = mergeSide(*p, ab)
+		}
+	}
+	add(a, func(c *CompareBucket) **CompareSide { return &c.A })
+	add(b, func(c *CompareBucket) **CompareSide { return &c.B })
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Bucket.Before(buckets[j].Bucket) })
+	for i := range buckets {
+		if buckets[i].A != nil && buckets[i].B != nil {
+			d := buckets[i].A.AvgValue - buckets[i].B.AvgValue
+			buckets[i].Difference = &d
+		}
+	}
+	return buckets
+}
+
+func mergeSide(side *CompareSide, b db.AggregateBucket) *CompareSide {
+	if side == nil {
+		return &CompareSide{AvgValue: b.AvgValue, MinValue: b.MinValue, MaxValue: b.MaxValue, ReadingCount: b.ReadingCount}
+	}
+	total := side.ReadingCount + b.ReadingCount
+	side.AvgValue = (side.AvgValue*float64(side.ReadingCount) + b.AvgValue*float64(b.ReadingCount)) / float64(total)
+	side.MinValue = math.Min(side.MinValue, b.MinValue)
+	side.MaxValue = math.Max(side.MaxValue, b.MaxValue)
+	side.ReadingCount = total
+	return side
+}
+
+// describeCompared names a compared device with the type and location of its latest bucket
+func describeCompared(deviceID string, buckets []db.AggregateBucket) map[string]interface{} {
+	device := map[string]interface{}{"device_id": deviceID, "buckets": len(buckets)}
+	if len(buckets) > 0 {
+		last := buckets[len(buckets)-1]
+		device["device_type"] = last.DeviceType
+		device["location"] = last.Location
+	}
+	return device
+}
+
+// correlation is the Pearson correlation of two equally long series; nil when there are fewer
+// than three points or a series is constant
+func correlation(a, b []float64) *float64 {
+	n := float64(len(a))
+	if len(a) < 3 {
+		return nil
+	}
+	var meanA, meanB float64
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= n
+	meanB /= n
+	var cov, varA, varB float64
+	for i := range a {
+		devA, devB := a[i]-meanA, b[i]-meanB
+		cov += devA * devB
+		varA += devA * devA
+		varB += devB * devB
+	}
+	if varA == 0 || varB == 0 {
+		return nil
+	}
+	r := cov / math.Sqrt(varA*varB)
+	return &r
+}
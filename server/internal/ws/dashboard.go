@@ -0,0 +1,189 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"edge-insights/internal/alerts"
+	"edge-insights/internal/db"
+	"edge-insights/internal/devices"
+	"edge-insights/internal/incidents"
+	"edge-insights/internal/types"
+	"edge-insights/internal/vitals"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Status of a device on the location dashboard
+const (
+	deviceOnline    = "online"     // reported within DASHBOARD_OFFLINE_AFTER
+	deviceOffline   = "offline"    // reported before that
+	deviceNeverSeen = "never_seen" // registered but never reported
+)
+
+// Sparklines cover the last hour in one-minute buckets
+const (
+	sparklineWindow = time.Hour
+	sparklineWidth  = time.Minute
+)
+
+// DashboardDevice is one device of a location dashboard
+type DashboardDevice struct {
+	ID         string                 `json:"id"`
+	DeviceType string                 `json:"device_type"`
+	Registered bool                   `json:"registered"`
+	Status     string                 `json:"status"`
+	Alerting   bool                   `json:"alerting"` // a rule or vitals alert is firing on the device
+	LastSeen   *time.Time             `json:"last_seen"`
+	Latest     map[string]interface{} `json:"latest"` // redacted; nil when it did not report within DASHBOARD_LATEST_WINDOW
+	Sparkline  []db.AggregateBucket   `json:"sparkline"`
+}
+
+// DashboardCounts are the devices of a location dashboard by status
+type DashboardCounts struct {
+	Total          int `json:"total"` // devices listed, i.e. not decommissioned
+	Online         int `json:"online"`
+	Offline        int `json:"offline"`
+	NeverSeen      int `json:"never_seen"`
+	Alerting       int `json:"alerting"`
+	Decommissioned int `json:"decommissioned"`
+}
+
+// locationDashboardHandler returns everything a location's dashboard shows in one response: the
+// latest reading and last-hour sparkline of each device, the firing alerts, the recent anomalies
+// and the devices by status (GET /api/locations/{location}/dashboard)
+// The queries run concurrently; devices count as offline after DASHBOARD_OFFLINE_AFTER (default
+// 15m) without a reading, latest readings are looked up over DASHBOARD_LATEST_WINDOW (default 24h)
+// and anomalies over DASHBOARD_ANOMALY_WINDOW (default 24h, at most 50)
+func (s *Server) locationDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	location := chi.URLParam(r, "location")
+	ctx := r.Context()
+	now := time.Now()
+
+	var (
+		wg                   sync.WaitGroup
+		latest               []types.LogMessage
+		series               map[string][]db.AggregateBucket
+		ruleAlerts           []alerts.Alert
+		anomalies            []incidents.Signal
+		latestErr, seriesErr error
+		alertsErr, signalErr error
+	)
+	wg.Go(func() {
+		latest, latestErr = db.GetLatestByLocationContext(ctx, s.db, location,
+			now.Add(-getDurationEnv("DASHBOARD_LATEST_WINDOW", 24*time.Hour)))
+	})
+	wg.Go(func() {
+		series, seriesErr = db.GetLocationBucketsContext(ctx, s.db, location, sparklineWidth,
+			now.Add(-sparklineWindow).Truncate(sparklineWidth), now)
+	})
+	wg.Go(func() {
+		ruleAlerts, alertsErr = s.alerts.Alerts(ctx, alerts.Filter{Location: location, Firing: true})
+	})
+	wg.Go(func() {
+		anomalies, signalErr = s.incidents.Signals(ctx, incidents.SignalFilter{
+			Kind:     incidents.KindAnomaly,
+			Location: location,
+			Since:    now.Add(-getDurationEnv("DASHBOARD_ANOMALY_WINDOW", 24*time.Hour)),
+			Limit:    50,
+		})
+	})
+	registered := s.registry.List(devices.Filter{Location: location, IncludeDecommissioned: true})
+	vitalsAlerts := []vitals.Alert{}
+	for _, a := range s.vitals.Alerts() {
+		if a.Location == location {
+			vitalsAlerts = append(vitalsAlerts, a)
+		}
+	}
+	wg.Wait()
+
+	for _, err := range []error{latestErr, seriesErr, alertsErr, signalErr} {
+		if err != nil {
+			writeError(w, r, "Error loading location dashboard", err, "location", location)
+			return
+		}
+	}
+
+	rows, err := s.redaction.ApplyStructs(roleFromRequest(r), latest)
+	if err != nil {
+		writeError(w, r, "Error redacting latest readings", err)
+		return
+	}
+
+	alerting := make(map[string]bool)
+	for _, a := range ruleAlerts {
+		alerting[a.DeviceID] = true
+	}
+	for _, a := range vitalsAlerts {
+		alerting[a.DeviceID] = true
+	}
+
+	var counts DashboardCounts
+	byID := make(map[string]*DashboardDevice)
+	for _, d := range registered {
+		if !d.Active() {
+			counts.Decommissioned++
+			continue
+		}
+		byID[d.ID] = &DashboardDevice{ID: d.ID, DeviceType: d.Type, Registered: true, LastSeen: d.LastSeen}
+	}
+	for i := range latest {
+		reading := &latest[i]
+		device, ok := byID[reading.DeviceID]
+		if !ok {
+			// Readings of unregistered devices are stored under UNKNOWN_DEVICE_POLICY=allow; a
+			// registered device missing here was decommissioned or moved to another location
+			if _, known := s.registry.Get(reading.DeviceID); known {
+				continue
+			}
+			device = &DashboardDevice{ID: reading.DeviceID, DeviceType: reading.DeviceType}
+			byID[reading.DeviceID] = device
+		}
+		device.Latest = rows[i]
+		if device.LastSeen == nil || reading.Time.After(*device.LastSeen) {
+			t := reading.Time
+			device.LastSeen = &t
+		}
+	}
+
+	offlineAfter := getDurationEnv("DASHBOARD_OFFLINE_AFTER", 15*time.Minute)
+	list := make([]DashboardDevice, 0, len(byID))
+	for id, device := range byID {
+		switch {
+		case device.LastSeen == nil:
+			device.Status = deviceNeverSeen
+			counts.NeverSeen++
+		case now.Sub(*device.LastSeen) > offlineAfter:
+			device.Status = deviceOffline
+			counts.Offline++
+		default:
+			device.Status = deviceOnline
+			counts.Online++
+		}
+		if device.Alerting = alerting[id]; device.Alerting {
+			counts.Alerting++
+		}
+		device.Sparkline = series[id]
+		if device.Sparkline == nil {
+			device.Sparkline = []db.AggregateBucket{}
+		}
+		list = append(list, *device)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	counts.Total = len(list)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"location":        location,
+		"generated_at":    now,
+		"sparkline_width": sparklineWidth.String(),
+		"devices":         list,
+		"status_counts":   counts,
+		"alerts":          ruleAlerts,
+		"vitals_alerts":   vitalsAlerts,
+		"anomalies":       anomalies,
+	})
+}
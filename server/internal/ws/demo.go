@@ -0,0 +1,172 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/ratelimit"
+	"edge-insights/pkg/simdevice"
+)
+
+// demoMode reports whether DEMO_MODE=true: the server runs a public demo on simulated readings
+func demoMode() bool {
+	return getEnv("DEMO_MODE", "false") == "true"
+}
+
+// demoConfig is the state of a public demo (DEMO_MODE=true)
+type demoConfig struct {
+	rateLimit   int                // requests per minute and client
+	aiRateLimit int                // /api/ai/* requests per minute and client, on top of rateLimit
+	limiter     *ratelimit.Limiter // every request
+	aiLimiter   *ratelimit.Limiter // /api/ai/*
+	trustProxy  bool               // take the client IP from X-Forwarded-For
+	perDevice   int                // simulated devices per profile
+	backfill    time.Duration      // history simulated at startup
+}
+
+func loadDemoConfig() *demoConfig {
+	d := &demoConfig{
+		rateLimit:   getIntEnv("DEMO_RATE_LIMIT", 60),
+		aiRateLimit: getIntEnv("DEMO_AI_RATE_LIMIT", 6),
+		trustProxy:  getEnv("DEMO_TRUST_PROXY", "false") == "true",
+		perDevice:   getIntEnv("DEMO_DEVICES_PER_TYPE", 3),
+		backfill:    getDurationEnv("DEMO_BACKFILL", 24*time.Hour),
+	}
+	d.limiter = ratelimit.New(d.rateLimit, getIntEnv("DEMO_RATE_BURST", 20))
+	d.aiLimiter = ratelimit.New(d.aiRateLimit, getIntEnv("DEMO_AI_RATE_BURST", 3))
+	return d
+}
+
+// demoWritable lists the POST endpoints a demo still serves: they only read
+var demoWritable = map[string]bool{
+	"/api/ai/query":      true,
+	"/api/ai/summarize":  true,
+	"/api/ai/search":     true,
+	"/api/ai/sql/stream": true,
+	"/api/query":         true,
+}
+
+// demoGuard rate-limits every request per client and keeps a demo read-only: only GET, HEAD and
+// OPTIONS reach the API, besides the questions and queries in demoWritable and request cancellation
+func (s *Server) demoGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.demo == nil || r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := clientIP(r, s.demo.trustProxy)
+		now := time.Now()
+		ok, wait := s.demo.limiter.Allow(client, now)
+		if ok && strings.HasPrefix(r.URL.Path, "/api/ai/") {
+			ok, wait = s.demo.aiLimiter.Allow(client, now)
+		}
+		if !ok {
+			writeRateLimited(w, r, wait, "Too many requests to the demo")
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+		case r.Method == http.MethodPost && (demoWritable[r.URL.Path] || isCancelRequest(r.URL.Path)):
+		default:
+			writeAPIError(w, r, http.StatusForbidden, "demo_read_only", "The demo is read-only", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isCancelRequest matches /api/requests/{id}/cancel
+func isCancelRequest(path string) bool {
+	id, ok := strings.CutPrefix(path, "/api/requests/")
+	return ok && strings.HasSuffix(id, "/cancel") && !strings.Contains(strings.TrimSuffix(id, "/cancel"), "/")
+}
+
+// runDemoFleet feeds the demo with simulated readings: the history missing from the last
+// DEMO_BACKFILL first, then live readings, with a fault now and then so anomalies and alerts show
+func (s *Server) runDemoFleet() {
+	ctx := context.Background()
+	fleet := simdevice.CreateFleet(simdevice.FleetConfig{PerProfile: s.demo.perDevice})
+	sink := simdevice.SinkFunc(s.ingestWithRetry)
+
+	// Only the gap since the last stored reading is simulated, so restarts do not pile up history
+	now := time.Now()
+	start := now.Add(-s.demo.backfill)
+	var last *time.Time
+	if err := s.db.QueryRowContext(ctx, `SELECT max(time) FROM sensor_readings`).Scan(&last); err != nil {
+		slog.Error("Failed to find the latest demo reading", "error", err)
+	} else if last != nil && last.After(start) {
+		start = *last
+	}
+	if gap := now.Sub(start); gap > time.Minute {
+		stats, err := fleet.RunScenario(ctx, simdevice.Scenario{
+			Start:    start,
+			Duration: gap,
+			Interval: time.Minute,
+			Faults:   demoFaults(gap),
+		}, sink)
+		if err != nil {
+			slog.Error("Demo backfill stopped", "error", err)
+			return
+		}
+		slog.Info("Demo history simulated", "since", start, "sent", stats.Sent, "failed", stats.Failed)
+	}
+
+	for ctx.Err() == nil {
+		stats, err := fleet.RunScenario(ctx, simdevice.Scenario{
+			Duration: time.Hour,
+			Interval: 10 * time.Second,
+			Realtime: true,
+			Faults:   demoFaults(time.Hour),
+		}, sink)
+		if err != nil {
+			slog.Error("Demo fleet stopped", "error", err)
+			return
+		}
+		if stats.Failed > 0 {
+			slog.Warn("Demo readings failed", "failed", stats.Failed, "error", stats.LastErr)
+		}
+	}
+}
+
+// demoFaults schedules a temperature spike and an error storm within a run of the given length
+func demoFaults(length time.Duration) []simdevice.ScheduledFault {
+	return []simdevice.ScheduledFault{
+		{DeviceID: "temperature_sensor_001", At: length / 3, Fault: simdevice.Fault{Kind: simdevice.FaultSpike, Magnitude: 25, Duration: length / 12}},
+		{DeviceID: "controller_002", At: 2 * length / 3, Fault: simdevice.Fault{Kind: simdevice.FaultErrorStorm, Duration: length / 24}},
+	}
+}
+
+// demoHandler describes the demo (GET /api/demo): whether it is on, its rate limits and the
+// questions the AI query endpoint answers
+func (s *Server) demoHandler(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{"demo": s.demo != nil}
+	if s.demo != nil {
+		response["questions"] = s.ai.DemoQuestions()
+		response["rate_limit_per_minute"] = s.demo.rateLimit
+		response["ai_rate_limit_per_minute"] = s.demo.aiRateLimit
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeDemoError answers the demo's refusals of AI requests and reports whether err was one
+func (s *Server) writeDemoError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, ai.ErrDemoQuestion):
+		writeAPIError(w, r, http.StatusForbidden, "demo_question", "The demo only answers its example questions",
+			map[string]interface{}{"questions": s.ai.DemoQuestions()})
+		return true
+	case errors.Is(err, ai.ErrDemoUnavailable):
+		writeAPIError(w, r, http.StatusForbidden, "demo_unavailable", "This feature is not available in the demo", nil)
+		return true
+	}
+	return false
+}
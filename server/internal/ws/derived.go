@@ -0,0 +1,116 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"edge-insights/internal/derived"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// derivedMetricsHandler lists derived metric definitions (GET)
+func (s *Server) derivedMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	definitions := s.handler.derived.List()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"metrics": definitions,
+		"count":   len(definitions),
+	})
+}
+
+// saveDerivedMetricHandler creates or replaces a derived metric definition (POST)
+func (s *Server) saveDerivedMetricHandler(w http.ResponseWriter, r *http.Request) {
+	var def derived.Definition
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := s.handler.derived.Save(def)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving derived metric", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
+
+// derivedMetricHandler returns /api/metrics/derived/{name} (GET)
+func (s *Server) derivedMetricHandler(w http.ResponseWriter, r *http.Request) {
+	def, ok := s.handler.derived.Get(chi.URLParam(r, "name"))
+	if !ok {
+		httpError(w, r, "Derived metric not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(def)
+}
+
+// deleteDerivedMetricHandler removes /api/metrics/derived/{name} (DELETE)
+func (s *Server) deleteDerivedMetricHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.handler.derived.Delete(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, "Error deleting derived metric", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Derived metric not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// derivedValuesHandler evaluates /api/metrics/derived/{name} over aggregate buckets (GET)
+func (s *Server) derivedValuesHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	q := r.URL.Query()
+	view := q.Get("view")
+	if view == "" {
+		view = "hourly"
+	}
+
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, r, "start must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		start = t
+	}
+	if v := q.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, r, "end must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		end = t
+	}
+
+	if _, ok := s.handler.derived.Get(name); !ok {
+		httpError(w, r, "Derived metric not found", http.StatusNotFound)
+		return
+	}
+
+	points, err := s.handler.derived.Evaluate(name, view, start, end)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error evaluating derived metric", "metric", name, "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"metric": name,
+		"view":   view,
+		"points": points,
+		"count":  len(points),
+	})
+}
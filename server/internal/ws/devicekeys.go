@@ -0,0 +1,149 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"edge-insights/internal/devicekeys"
+	"edge-insights/internal/types"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+// RequireAPIKeys makes /ws accept logs only from connections authenticated with a key from keys
+// Connections without a key can still receive the live feed when they have a role (see Server.authenticateFeed)
+func (h *Handler) RequireAPIKeys(keys *devicekeys.Store) {
+	h.keys = keys
+}
+
+// apiKeyFromRequest reads a device key from X-API-Key, a bearer token or ?api_key=
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// authFrame is the first-frame handshake for clients that cannot set headers: {"type": "auth", "api_key": "..."}
+type authFrame struct {
+	Type   string `json:"type"`
+	APIKey string `json:"api_key"`
+}
+
+// parseAuthFrame returns the key of an auth frame
+func parseAuthFrame(message []byte) (string, bool) {
+	var frame authFrame
+	if err := json.Unmarshal(message, &frame); err != nil || frame.Type != "auth" {
+		return "", false
+	}
+	return frame.APIKey, true
+}
+
+// authorizeLog checks that a connection's key may store logMsg
+// It returns an error message and whether the connection should be closed
+func (h *Handler) authorizeLog(key *devicekeys.Key, logMsg types.LogMessage) (string, bool) {
+	switch {
+	case h.keys == nil:
+		return "", false
+	case key == nil:
+		return "API key required", true
+	case !h.keys.Active(key):
+		return "API key revoked", true
+	case !key.Allows(logMsg.DeviceID):
+		return "API key is not valid for device " + logMsg.DeviceID, false
+	}
+	return "", false
+}
+
+// closeWithCode closes a connection with one of the types.Close* codes and a reason the client can log
+func closeWithCode(ctx context.Context, conn *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		slog.WarnContext(ctx, "Error sending close frame", "error", err)
+	}
+}
+
+// deviceKeysHandler lists device API keys (GET; admin only)
+func (s *Server) deviceKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys := s.deviceKeys.List()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys":     keys,
+		"count":    len(keys),
+		"required": s.handler.keys != nil,
+	})
+}
+
+// createDeviceKeyHandler issues a device API key (POST; admin only)
+func (s *Server) createDeviceKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string `json:"name"`
+		DeviceID  string `json:"device_id"`
+		RateLimit int    `json:"rate_limit"`
+		RateBurst int    `json:"rate_burst"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.deviceKeys.Create(req.Name, req.DeviceID, req.RateLimit, req.RateBurst)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating device API key", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// updateDeviceKeyHandler sets the ingest rate limit of /api/device-keys/{id} (PATCH; admin only)
+// Body: {"rate_limit": requests a minute, "rate_burst": n}; 0 returns to the server default
+func (s *Server) updateDeviceKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RateLimit int `json:"rate_limit"`
+		RateBurst int `json:"rate_burst"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	key, found, err := s.deviceKeys.SetRateLimit(chi.URLParam(r, "id"), req.RateLimit, req.RateBurst)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error updating device API key", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !found {
+		httpError(w, r, "API key not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// revokeDeviceKeyHandler revokes /api/device-keys/{id} (DELETE; admin only)
+func (s *Server) revokeDeviceKeyHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.deviceKeys.Revoke(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "Error revoking device API key", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "API key not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
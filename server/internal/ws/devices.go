@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"edge-insights/internal/devices"
+	"edge-insights/internal/types"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// UseDeviceRegistry makes ingestion consult registry for readings from unregistered or
+// decommissioned devices (see devices.Policy) and keeps last_seen up to date
+func (h *Handler) UseDeviceRegistry(registry *devices.Store, policy devices.Policy) {
+	h.registry = registry
+	h.devicePolicy = policy
+	h.OnStored(registry.Touch)
+}
+
+// admitDevice applies the unknown-device policy to a reading
+func (h *Handler) admitDevice(logMsg types.LogMessage) error {
+	if h.registry == nil {
+		return nil
+	}
+	return h.registry.Admit(logMsg, h.devicePolicy)
+}
+
+// devicesHandler lists devices (GET)
+// Accepts device_type, location and include_decommissioned=true
+func (s *Server) devicesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	list := s.registry.List(devices.Filter{
+		Type:                  q.Get("device_type"),
+		Location:              q.Get("location"),
+		IncludeDecommissioned: q.Get("include_decommissioned") == "true",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"devices": list,
+		"count":   len(list),
+	})
+}
+
+// registerDeviceHandler registers a device (POST)
+func (s *Server) registerDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	var d devices.Device
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	registered, err := s.registry.Register(d)
+	if errors.Is(err, devices.ErrExists) {
+		httpError(w, r, "Device "+d.ID+" is already registered", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error registering device", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.publishDeviceStatus(*registered, types.DeviceRegistered)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(registered)
+}
+
+// deviceHandler returns /api/devices/{id} (GET)
+func (s *Server) deviceHandler(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.registry.Get(chi.URLParam(r, "id"))
+	if !ok {
+		httpError(w, r, "Device not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// replaceDeviceHandler replaces /api/devices/{id} (PUT)
+func (s *Server) replaceDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	var d devices.Device
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	s.saveDevice(w, r, d)
+}
+
+// updateDeviceHandler changes only the fields present in the body of /api/devices/{id} (PATCH)
+// and merges metadata keys (a null value removes a key)
+func (s *Server) updateDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	existing, ok := s.registry.Get(chi.URLParam(r, "id"))
+	if !ok {
+		httpError(w, r, "Device not found", http.StatusNotFound)
+		return
+	}
+	d := *existing
+	metadata := d.Metadata
+	d.Metadata = nil
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	d.Metadata = mergeMetadata(metadata, d.Metadata)
+	s.saveDevice(w, r, d)
+}
+
+// saveDevice stores a replaced or updated device under the ID in the path
+func (s *Server) saveDevice(w http.ResponseWriter, r *http.Request, d devices.Device) {
+	d.ID = chi.URLParam(r, "id")
+
+	saved, err := s.registry.Save(d)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving device", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.publishDeviceStatus(*saved, types.DeviceUpdated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// decommissionDeviceHandler decommissions /api/devices/{id} (DELETE)
+func (s *Server) decommissionDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	found, err := s.registry.Decommission(id)
+	if err != nil {
+		writeError(w, r, "Error decommissioning device", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Device not found", http.StatusNotFound)
+		return
+	}
+	if d, ok := s.registry.Get(id); ok {
+		s.publishDeviceStatus(*d, types.DeviceDecommissioned)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishDeviceStatus pushes a registration change on the live feed
+func (s *Server) publishDeviceStatus(d devices.Device, status string) {
+	event := types.DeviceStatusEvent{
+		DeviceID:   d.ID,
+		DeviceType: d.Type,
+		Location:   d.Location,
+		Status:     status,
+		LastSeen:   d.LastSeen,
+	}
+	s.handler.broadcastMatching(types.NewEvent(types.EventDeviceStatus, event), func(sub types.Subscription) bool {
+		return sub.MatchesDevice(d.ID, d.Type, d.Location)
+	})
+}
+
+// mergeMetadata applies a PATCH's metadata keys onto the existing metadata
+func mergeMetadata(existing, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(existing)+len(patch))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// publishAnomaly pushes a detected anomaly on the live feed without its context; subscriptions
+// are matched on the registered type and location of its device
+func (s *Server) publishAnomaly(anomaly types.Anomaly, deviceType, location string) {
+	anomaly.Context = nil
+	s.handler.broadcastMatching(types.NewEvent(types.EventAnomaly, anomaly), func(sub types.Subscription) bool {
+		return sub.MatchesDevice(anomaly.DeviceID, deviceType, location)
+	})
+}
@@ -0,0 +1,19 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"edge-insights/internal/devicetypes"
+)
+
+// deviceTypesHandler lists the registered device types with their units, valid ranges, reporting
+// intervals and display formatting (GET /api/meta/device-types)
+func (s *Server) deviceTypesHandler(w http.ResponseWriter, r *http.Request) {
+	list := devicetypes.All()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_types": list,
+		"count":        len(list),
+	})
+}
@@ -0,0 +1,217 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/dlq"
+	"edge-insights/internal/types"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Where a dead-lettered reading came from
+const (
+	sourceWebSocket = "websocket"
+	sourceIngest    = "ingest" // Ingest: webhooks, listeners, pollers
+	sourceBatch     = "batch"  // POST /api/ingest
+	sourceDerived   = "derived"
+)
+
+// UseDeadLetters queues readings the database fails to store in q instead of dropping them
+func (h *Handler) UseDeadLetters(q *dlq.Queue) {
+	h.deadLetters = q
+}
+
+// storeOrQueue stores a reading, or dead-letters it when the store fails; queued reports the
+// latter. The error is the store's when the reading could not be queued either
+func (h *Handler) storeOrQueue(logMsg types.LogMessage, source string) (queued bool, err error) {
+	err = h.storeLog(logMsg)
+	if err == nil || h.deadLetters == nil {
+		return false, err
+	}
+	if _, qerr := h.deadLetters.Add(logMsg, source, err); qerr != nil {
+		slog.Error("Failed to dead-letter reading", "device_id", logMsg.DeviceID, "store_error", err, "error", qerr)
+		return false, err
+	}
+	slog.Warn("Reading dead-lettered", "device_id", logMsg.DeviceID, "source", source, "error", err)
+	return true, nil
+}
+
+// queueBatch dead-letters the readings of a batch the database failed to store. It is all or
+// nothing like the COPY: when one reading cannot be queued the others are removed again
+func (h *Handler) queueBatch(batch []types.LogMessage, cause error) bool {
+	if h.deadLetters == nil {
+		return false
+	}
+	ids := make([]string, 0, len(batch))
+	for _, logMsg := range batch {
+		entry, err := h.deadLetters.Add(logMsg, sourceBatch, cause)
+		if err != nil {
+			slog.Error("Failed to dead-letter ingest batch", "readings", len(batch), "error", err)
+			for _, id := range ids {
+				h.deadLetters.Delete(id)
+			}
+			return false
+		}
+		ids = append(ids, entry.ID)
+	}
+	slog.Warn("Ingest batch dead-lettered", "readings", len(batch), "error", cause)
+	return true
+}
+
+// replayDeadLetter stores a dead-lettered reading and runs the post-ingestion steps it missed
+// A reading that is already stored (a unique violation, e.g. a write that failed after committing)
+// counts as replayed
+func (h *Handler) replayDeadLetter(entry dlq.Entry) error {
+	retryAfter, ok := h.acquireWriteSlot()
+	if !ok {
+		return &SaturatedError{RetryAfter: retryAfter}
+	}
+	err := h.storeLog(entry.Reading)
+	h.releaseWriteSlot()
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		slog.Info("Dead-lettered reading was already stored", "id", entry.ID, "device_id", entry.Reading.DeviceID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Source == sourceDerived {
+		h.publishDerived(entry.Reading)
+	} else {
+		h.afterStore(entry.Reading)
+	}
+	return nil
+}
+
+// queuedResponse tells the client its log was accepted into the dead-letter queue and will be stored
+func queuedResponse() types.LogResponse {
+	return types.LogResponse{
+		Success: true,
+		Queued:  true,
+		Message: "Log queued; it is stored once the database accepts writes again",
+	}
+}
+
+// startDeadLetters retries the dead-letter queue every DLQ_RETRY_INTERVAL (default 30s)
+func (s *Server) startDeadLetters() {
+	if s.deadQueue == nil {
+		return
+	}
+	if n := s.deadQueue.Len(); n > 0 {
+		slog.Warn("Dead-lettered readings waiting to be stored", "readings", n)
+	}
+	s.deadQueue.Start(getDurationEnv("DLQ_RETRY_INTERVAL", 30*time.Second),
+		getIntEnv("DLQ_MAX_ATTEMPTS", 20), s.handler.replayDeadLetter)
+}
+
+// deadLettersHandler lists the oldest dead-lettered readings (GET /api/admin/dlq)
+// Accepts limit (default 100)
+func (s *Server) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireDeadLetters(w, r) {
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	entries, err := s.deadQueue.List(limit)
+	if err != nil {
+		writeError(w, r, "Error listing dead letters", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+		"total":   s.deadQueue.Len(),
+	})
+}
+
+// deadLetterHandler returns one dead-lettered reading (GET /api/admin/dlq/{id})
+func (s *Server) deadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireDeadLetters(w, r) {
+		return
+	}
+	entry, err := s.deadQueue.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "Dead-letter queue error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// replayDeadLettersHandler stores dead-lettered readings now, including those the retry worker
+// gave up on (POST /api/admin/dlq/replay). Accepts {"ids": [...]}; no body or no IDs replays all
+func (s *Server) replayDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireDeadLetters(w, r) {
+		return
+	}
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	s.writeReplayResult(w, r, s.deadQueue.Replay(req.IDs, s.handler.replayDeadLetter))
+}
+
+// replayDeadLetterHandler stores one dead-lettered reading now (POST /api/admin/dlq/{id}/replay)
+func (s *Server) replayDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireDeadLetters(w, r) {
+		return
+	}
+	result := s.deadQueue.Replay([]string{chi.URLParam(r, "id")}, s.handler.replayDeadLetter)
+	if len(result.Missing) > 0 {
+		writeError(w, r, "Dead-letter queue error", dlq.ErrNotFound)
+		return
+	}
+	s.writeReplayResult(w, r, result)
+}
+
+func (s *Server) writeReplayResult(w http.ResponseWriter, r *http.Request, result dlq.ReplayResult) {
+	slog.InfoContext(r.Context(), "Dead letters replayed", "replayed", result.Replayed, "failed", result.Failed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"replayed":  result.Replayed,
+		"failed":    result.Failed,
+		"missing":   result.Missing,
+		"remaining": s.deadQueue.Len(),
+	})
+}
+
+// deleteDeadLetterHandler discards a dead-lettered reading (DELETE /api/admin/dlq/{id})
+func (s *Server) deleteDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireDeadLetters(w, r) {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if err := s.deadQueue.Delete(id); err != nil {
+		writeError(w, r, "Dead-letter queue error", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Dead letter discarded", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireDeadLetters answers 404 when the queue is disabled (DLQ_ENABLED=false)
+func (s *Server) requireDeadLetters(w http.ResponseWriter, r *http.Request) bool {
+	if s.deadQueue == nil {
+		httpError(w, r, "The dead-letter queue is disabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"edge-insights/internal/ingest/email"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// emailIngestHandler accepts POST /api/ingest/email from an inbound-mail provider
+// (SendGrid/Mailgun forms, Postmark JSON or a raw RFC 822 message) and stores matched alarms
+func (s *Server) emailIngestHandler(w http.ResponseWriter, r *http.Request) {
+	// The provider's inbound route should carry the shared token
+	if expected := getEnv("EMAIL_INGEST_TOKEN", ""); expected != "" {
+		token := r.Header.Get("X-Email-Token")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			httpError(w, r, "Invalid email token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	msg, err := email.FromRequest(r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error parsing inbound email", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Unrecognised mail is acknowledged so the provider does not keep retrying it
+	rule, groups, ok := s.email.Match(msg)
+	if !ok {
+		slog.InfoContext(r.Context(), "Inbound email did not match any alarm rule", "from", msg.From, "subject", msg.Subject)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"matched": false,
+		})
+		return
+	}
+
+	logMsg := rule.ToLogMessage(msg, groups)
+	if err := s.handler.Ingest(logMsg); err != nil {
+		var saturated *SaturatedError
+		if errors.As(err, &saturated) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(saturated.RetryAfter.Seconds()+0.999)))
+			httpError(w, r, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Error storing email alarm", "device_id", logMsg.DeviceID, "error", err)
+		httpError(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"matched":   true,
+		"rule":      rule.Name,
+		"device_id": logMsg.DeviceID,
+		"log_type":  logMsg.LogType,
+	})
+}
+
+// emailRulesHandler lists (GET) alarm email rules in evaluation order
+func (s *Server) emailRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules := s.email.List()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": rules,
+		"count": len(rules),
+	})
+}
+
+// saveEmailRuleHandler creates or replaces /api/ingest/email/rules/{name} (PUT)
+func (s *Server) saveEmailRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var rule email.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	rule.Name = chi.URLParam(r, "name")
+
+	saved, err := s.email.Save(rule)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving email rule", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// deleteEmailRuleHandler removes /api/ingest/email/rules/{name} (DELETE)
+func (s *Server) deleteEmailRuleHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.email.Delete(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, "Error deleting email rule", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Email rule not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/incidents"
+)
+
+// startEmbeddingPipeline embeds stored readings for semantic search (EMBEDDING_PIPELINE, default true)
+// It needs OPENAI_API_KEY; without it search has nothing to read and the pipeline stays off
+func (s *Server) startEmbeddingPipeline() {
+	writer := s.ai.EmbeddingWriter()
+	if writer == nil || getEnv("EMBEDDING_PIPELINE", "true") == "false" {
+		return
+	}
+	s.handler.OnStored(writer.Enqueue)
+	writer.Start(getDurationEnv("EMBEDDING_BACKFILL", 24*time.Hour))
+}
+
+// startKnowledge embeds conclusions for semantic search (KNOWLEDGE_EMBEDDINGS, default true), so
+// /api/ai/search also finds what was concluded the last time something similar happened: scheduled
+// summaries (queued by the scheduler), incident narratives and notes, anomaly explanations and
+// suggested remediations. Entries of the last KNOWLEDGE_BACKFILL (default 7d) missing one are embedded at startup
+func (s *Server) startKnowledge() {
+	writer := s.ai.KnowledgeWriter()
+	if writer == nil {
+		return
+	}
+	s.incidents.OnChange(func(incident incidents.Incident) {
+		s.ai.Remember(ai.IncidentKnowledge(incident.ID, incident.Title, incident.Summary, incident.Note,
+			incident.DeviceIDs, incident.Locations, incident.UpdatedAt))
+	})
+	writer.Start(getDurationEnv("KNOWLEDGE_BACKFILL", 7*24*time.Hour))
+}
+
+// embeddingStatsHandler reports the embedding pipeline's, the knowledge writer's and the query embedding cache's counters (GET)
+func (s *Server) embeddingStatsHandler(w http.ResponseWriter, r *http.Request) {
+	writer := s.ai.EmbeddingWriter()
+	response := map[string]interface{}{
+		"enabled": writer != nil && getEnv("EMBEDDING_PIPELINE", "true") != "false",
+		"cache":   s.ai.EmbeddingCache().Stats(),
+	}
+	if writer != nil {
+		response["stats"] = writer.Stats()
+	}
+	if knowledge := s.ai.KnowledgeWriter(); knowledge != nil {
+		response["knowledge"] = knowledge.Stats()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
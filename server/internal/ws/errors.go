@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	apperrors "edge-insights/internal/errors"
+	"edge-insights/internal/logging"
+	"edge-insights/internal/types"
+)
+
+// Codes of the JSON error envelope (types.APIError); refusals by the auth, role and demo
+// middleware use more specific ones (missing_token, insufficient_role, demo_read_only...)
+const (
+	codeValidationFailed = "validation_failed"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeGone             = "gone"
+	codeRateLimited      = "rate_limited"
+	codeCancelled        = "cancelled"
+	codeAIUnavailable    = "ai_unavailable"
+	codeDBUnavailable    = "db_unavailable"
+	codeUpstreamFailed   = "upstream_failed"
+	codeUnavailable      = "unavailable"
+	codeInternal         = "internal_error"
+)
+
+// kindCodes are the envelope codes of the apperrors kinds
+var kindCodes = map[error]string{
+	apperrors.ErrValidation:    codeValidationFailed,
+	apperrors.ErrNotFound:      codeNotFound,
+	apperrors.ErrConflict:      codeConflict,
+	apperrors.ErrRateLimited:   codeRateLimited,
+	apperrors.ErrAIUnavailable: codeAIUnavailable,
+	apperrors.ErrDBUnavailable: codeDBUnavailable,
+}
+
+// statusCode is the envelope code of a status answered without an error to classify
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return codeValidationFailed
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusGone:
+		return codeGone
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case statusClientClosedRequest:
+		return codeCancelled
+	case http.StatusBadGateway:
+		return codeUpstreamFailed
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	}
+	if status < 500 {
+		return codeValidationFailed
+	}
+	return codeInternal
+}
+
+// errorCode is the envelope code of err's kind; internal_error for an unexpected error
+func errorCode(err error) string {
+	if code, ok := kindCodes[apperrors.Kind(err)]; ok {
+		return code
+	}
+	return codeInternal
+}
+
+// writeAPIError answers a failed request with the JSON error envelope, carrying the request's
+// X-Request-ID so a report can be matched with the server's log
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(types.APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: logging.RequestID(r.Context()),
+	})
+}
+
+// httpError is http.Error with the JSON error envelope, its code chosen by the status
+func httpError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	writeAPIError(w, r, status, statusCode(status), message, nil)
+}
+
+// writeError answers a failed request with the status code of the error's kind
+// (apperrors.HTTPStatus): a cancelled request gets 499, a validation, not-found or conflict error
+// its own message, and anything else the generic message, so internals are not leaked. Only
+// unexpected errors are logged at ERROR; args are added to the log record
+func writeError(w http.ResponseWriter, r *http.Request, message string, err error, args ...any) {
+	ctx := r.Context()
+	if ctx.Err() != nil {
+		slog.InfoContext(ctx, message, "cancelled", true, "reason", ctx.Err())
+		httpError(w, r, "Request cancelled", statusClientClosedRequest)
+		return
+	}
+
+	args = append(args, "error", err)
+	status := apperrors.HTTPStatus(err)
+	switch kind := apperrors.Kind(err); kind {
+	case apperrors.ErrValidation, apperrors.ErrNotFound, apperrors.ErrConflict:
+		slog.InfoContext(ctx, message, args...)
+		var details interface{}
+		var validation *ValidationError
+		if errors.As(err, &validation) {
+			details = validation.Fields
+		}
+		writeAPIError(w, r, status, errorCode(err), err.Error(), details)
+	case nil:
+		slog.ErrorContext(ctx, message, args...)
+		writeAPIError(w, r, status, codeInternal, message, nil)
+	default:
+		// Unavailable or rate limited: the code tells the client a retry may succeed
+		slog.WarnContext(ctx, message, args...)
+		writeAPIError(w, r, status, errorCode(err), message+": "+kind.Error(), nil)
+	}
+}
+
+// notFound and methodNotAllowed answer unmatched routes with the envelope too
+func notFound(w http.ResponseWriter, r *http.Request) {
+	httpError(w, r, "Not found", http.StatusNotFound)
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method "+r.Method+" is not allowed", nil)
+}
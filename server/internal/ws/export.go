@@ -0,0 +1,210 @@
+package ws
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/types"
+)
+
+// exportColumns are the fields of an exported reading, in CSV column order
+var exportColumns = []string{"time", "device_id", "device_type", "location", "raw_value", "unit", "log_type", "message", "ingested_at", "metadata"}
+
+// exportFlushRows is how many rows are written between flushes
+const exportFlushRows = 1000
+
+// exportLogsHandler streams every reading in a time range as CSV or NDJSON (GET /api/logs/export)
+// Accepts format (csv or ndjson, required), start (RFC3339, required), end (default now),
+// device_id, device_type, location, log_type (repeated or comma-separated) and metadata as for
+// /api/logs. Rows are read a page at a time and flushed as they are written, so a range of any
+// length is neither limited nor held in memory; they are redacted for the caller's role, and
+// stripped columns are left out of the CSV header. A failure after the first row aborts the
+// response, so a cut-off export is not mistaken for a complete one
+func (s *Server) exportLogsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format != "csv" && format != "ndjson" {
+		httpError(w, r, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, q.Get("start"))
+	if err != nil {
+		httpError(w, r, "start (RFC3339) is required", http.StatusBadRequest)
+		return
+	}
+	end := time.Now()
+	if v := q.Get("end"); v != "" {
+		if end, err = time.Parse(time.RFC3339, v); err != nil {
+			httpError(w, r, "end must be RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if !end.After(start) {
+		httpError(w, r, "end must be after start", http.StatusBadRequest)
+		return
+	}
+
+	filter := db.ReadingFilter{
+		DeviceID:   q.Get("device_id"),
+		DeviceType: q.Get("device_type"),
+		Location:   q.Get("location"),
+	}
+	if raw := q.Get("metadata"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &filter.Metadata); err != nil {
+			httpError(w, r, "metadata must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	}
+	logTypes := queryList(q, "log_type")
+
+	role := roleFromRequest(r)
+	header := exportRow(types.LogMessage{})
+	s.redaction.ApplyRow(role, header)
+	var columns []string
+	for _, c := range exportColumns {
+		if _, ok := header[c]; ok {
+			columns = append(columns, c)
+		}
+	}
+
+	filename := fmt.Sprintf("logs-%s-%s.%s", start.UTC().Format("20060102T150405Z"), end.UTC().Format("20060102T150405Z"), format)
+	rc := http.NewResponseController(w)
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+	rows := 0
+
+	// Headers are sent with the first row, so an error before it still gets a status
+	writeHeader := func() error {
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if format == "csv" {
+			return csvWriter.Write(columns)
+		}
+		return nil
+	}
+	flush := func() error {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+		// Writers that cannot flush (e.g. debug=true buffering) deliver the export at the end
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	err = db.EachReadingBetween(r.Context(), s.db, filter, start, end, func(reading types.LogMessage) error {
+		if len(logTypes) > 0 && !slices.Contains(logTypes, reading.LogType) {
+			return nil
+		}
+		if rows == 0 {
+			if err := writeHeader(); err != nil {
+				return err
+			}
+		}
+		row := exportRow(reading)
+		s.redaction.ApplyRow(role, row)
+		var err error
+		if format == "csv" {
+			record := make([]string, len(columns))
+			for i, c := range columns {
+				record[i] = exportCell(row[c])
+			}
+			err = csvWriter.Write(record)
+		} else {
+			err = encoder.Encode(row)
+		}
+		if err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil && rows == 0 {
+		writeError(w, r, "Error exporting logs", err)
+		return
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			slog.InfoContext(r.Context(), "Log export cancelled", "rows", rows, "reason", r.Context().Err())
+		} else {
+			slog.ErrorContext(r.Context(), "Log export failed", "rows", rows, "error", err)
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if rows == 0 {
+		if err := writeHeader(); err != nil {
+			slog.ErrorContext(r.Context(), "Error writing log export", "error", err)
+			return
+		}
+	}
+	if err := flush(); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing log export", "error", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Logs exported", "format", format, "rows", rows, "start", start, "end", end)
+}
+
+// exportRow is a reading keyed by its JSON field names, with every field present so that redaction
+// and the CSV columns see the same keys on each row
+func exportRow(reading types.LogMessage) map[string]interface{} {
+	row := map[string]interface{}{
+		"time":        reading.Time,
+		"device_id":   reading.DeviceID,
+		"device_type": reading.DeviceType,
+		"location":    reading.Location,
+		"raw_value":   nil,
+		"unit":        reading.Unit,
+		"log_type":    reading.LogType,
+		"message":     reading.Message,
+		"ingested_at": nil,
+		"metadata":    nil,
+	}
+	if reading.RawValue != nil {
+		row["raw_value"] = *reading.RawValue
+	}
+	if reading.IngestedAt != nil {
+		row["ingested_at"] = *reading.IngestedAt
+	}
+	if len(reading.Metadata) > 0 {
+		row["metadata"] = reading.Metadata
+	}
+	return row
+}
+
+// exportCell formats a field for CSV: times as RFC3339, metadata as JSON and null as empty
+func exportCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
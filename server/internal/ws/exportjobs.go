@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"edge-insights/internal/export"
+	"edge-insights/internal/jobs"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// parquetExportKind is the query job kind of /api/export/jobs
+const parquetExportKind = "parquet_export"
+
+// registerExportJobs wires Parquet exports into the query job manager, so they share its workers,
+// QUERY_JOB_TIMEOUT, cancellation and retention; a job's only row is the export.Result
+func (s *Server) registerExportJobs() {
+	s.jobs.Register(parquetExportKind, func(ctx context.Context, params json.RawMessage) ([]interface{}, error) {
+		var req export.Request
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+		result, err := s.exporter.Run(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return jobRows([]*export.Result{result})
+	})
+}
+
+// exportJobsHandler lists recent Parquet exports (GET /api/export/jobs)
+func (s *Server) exportJobsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	list, err := s.jobs.ListKind(parquetExportKind, limit)
+	if err != nil {
+		writeError(w, r, "Export job error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":  list,
+		"count": len(list),
+	})
+}
+
+// submitExportJobHandler starts writing a time range of sensor_readings to a Parquet file
+// (POST /api/export/jobs). Accepts start (RFC3339, required), end (default now), device_id,
+// device_type, location and destination (local, the default, writes to EXPORT_DIR; s3 uploads to
+// EXPORT_S3_BUCKET). Answers 202 with the job; poll /api/export/jobs/{id} for its file
+func (s *Server) submitExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	var req export.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	// The end defaults to the time of submission, not of the run
+	if err := s.exporter.Validate(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params, err := json.Marshal(req)
+	if err != nil {
+		httpError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	job, err := s.jobs.Submit(parquetExportKind, params, string(roleFromRequest(r)))
+	if err != nil {
+		writeError(w, r, "Export job error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/export/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// exportJobHandler returns the status of an export, with its file once it has succeeded
+// (GET /api/export/jobs/{id})
+func (s *Server) exportJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.exportJob(w, r)
+	if !ok {
+		return
+	}
+	response := map[string]interface{}{"job": job}
+	if job.Status == jobs.StatusSucceeded {
+		rows, err := s.jobs.Result(job.ID)
+		if err != nil {
+			writeError(w, r, "Export job error", err)
+			return
+		}
+		if len(rows) == 1 {
+			response["result"] = rows[0]
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// cancelExportJobHandler cancels a queued or running export (POST /api/export/jobs/{id}/cancel)
+func (s *Server) cancelExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.exportJob(w, r)
+	if !ok {
+		return
+	}
+	cancelled, err := s.jobs.Cancel(job.ID)
+	if err != nil {
+		writeError(w, r, "Export job error", err)
+		return
+	}
+	if !cancelled {
+		httpError(w, r, "Job has already finished", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exportJob looks up the export of the request's {id}; other job kinds are not found here
+func (s *Server) exportJob(w http.ResponseWriter, r *http.Request) (*jobs.Job, bool) {
+	job, err := s.jobs.Get(chi.URLParam(r, "id"))
+	if err == nil && job.Kind != parquetExportKind {
+		err = jobs.ErrNotFound
+	}
+	if err != nil {
+		writeError(w, r, "Export job error", err)
+		return nil, false
+	}
+	return job, true
+}
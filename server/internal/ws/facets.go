@@ -0,0 +1,60 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// metaValuesHandler lists the distinct device types, locations, units, log types and devices
+// stored over a range, each with its reading count, most frequent first (GET /api/meta/values)
+// Accepts start and end (YYYY-MM-DD, UTC days, both inclusive, default the last 7 days). The values
+// come from the daily facet counts, which trail ingestion by up to DEVICE_FACETS_FLUSH
+func (s *Server) metaValuesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	start := end.AddDate(0, 0, -6)
+	for _, p := range []struct {
+		name   string
+		target *time.Time
+	}{{"start", &start}, {"end", &end}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				httpError(w, r, p.name+" must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+				return
+			}
+			*p.target = t
+		}
+	}
+	if end.Before(start) {
+		httpError(w, r, "end must not be before start", http.StatusBadRequest)
+		return
+	}
+
+	values, err := s.facets.Values(r.Context(), start, end)
+	if err != nil {
+		writeError(w, r, "Error fetching filter values", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(values)
+}
+
+// startFacets counts the readings stored before the first start with device_facets_daily, then
+// flushes the live counts every DEVICE_FACETS_FLUSH
+func (s *Server) startFacets() {
+	go func() {
+		days := getIntEnv("DEVICE_FACETS_BACKFILL_DAYS", 30)
+		if days > 0 {
+			if rows, err := s.facets.Backfill(context.Background(), days); err != nil {
+				slog.Error("Failed to backfill device facets", "error", err)
+			} else if rows > 0 {
+				slog.Info("Device facets backfilled", "days", days, "rows", rows)
+			}
+		}
+		s.facets.Start(getDurationEnv("DEVICE_FACETS_FLUSH", 30*time.Second))
+	}()
+}
@@ -4,17 +4,32 @@
 package ws
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	apperrors "edge-insights/internal/errors"
 	"edge-insights/internal/types"
 
+	"edge-insights/internal/commands"
 	"edge-insights/internal/db"
+	"edge-insights/internal/derived"
+	"edge-insights/internal/devicekeys"
+	"edge-insights/internal/devices"
+	"edge-insights/internal/devicetypes"
+	"edge-insights/internal/dlq"
+	"edge-insights/internal/logging"
+	"edge-insights/internal/realtime"
+	"edge-insights/internal/redact"
+	"edge-insights/internal/roles"
 
 	"github.com/gorilla/websocket"
 )
@@ -30,41 +45,161 @@ var upgrader = websocket.Upgrader{
 // Handler manages WebSocket connections and processes IoT log messages
 type Handler struct {
 	db           *sql.DB
-	clients      map[*websocket.Conn]bool
+	clients      map[*websocket.Conn]*feedClient
 	clientsMutex sync.RWMutex
+	realtime     *realtime.Aggregator
+	derived      *derived.Service
+	writeSlots   chan struct{} // bounds readings waiting to be stored across all connections
+	writer       *db.BatchWriter
+	keys         *devicekeys.Store // set by RequireAPIKeys; nil leaves /ws open
+	redaction    *redact.Policy    // set by UseRedaction; applied to broadcasts per client role
+	registry     *devices.Store    // set by UseDeviceRegistry
+	commands     *commands.Store   // set by UseCommands
+	deadLetters  *dlq.Queue        // set by UseDeadLetters; nil drops readings that fail to store
+	acks         *ackCache         // msg_ids acknowledged recently, per device
+	broadcasts   broadcastStats
+	sampler      *feedSampler  // thins log entries on the live feed while ingestion is busy
+	sendQueue    int           // broadcasts queued per live-feed client before the oldest are dropped
+	writeTimeout time.Duration // bounds each write to a client
+	devicePolicy devices.Policy
+	retryAfter   time.Duration // base back-off suggested to clients when saturated
+	listeners    []func(types.LogMessage)
 }
 
 // NewHandler creates a new WebSocket handler with database connection
-func NewHandler(db *sql.DB) *Handler {
+func NewHandler(database *sql.DB) *Handler {
 	return &Handler{
-		db:      db,
-		clients: make(map[*websocket.Conn]bool),
+		db:      database,
+		clients: make(map[*websocket.Conn]*feedClient),
+		realtime: realtime.NewAggregator(
+			getDurationEnv("REALTIME_WINDOW", 5*time.Minute),
+			getDurationEnv("REALTIME_RESOLUTION", 10*time.Second),
+		),
+		derived:      derived.NewService(database, getDurationEnv("DERIVED_METRIC_STALENESS", 5*time.Minute)),
+		writeSlots:   make(chan struct{}, getIntEnv("MAX_INFLIGHT_WRITES", 2048)),
+		retryAfter:   getDurationEnv("WRITE_RETRY_AFTER", 500*time.Millisecond),
+		acks:         newAckCache(getDurationEnv("ACK_DEDUPE_WINDOW", 10*time.Minute), getIntEnv("ACK_DEDUPE_MAX", 100000)),
+		sendQueue:    getIntEnv("WS_SEND_QUEUE", 256),
+		writeTimeout: getDurationEnv("WS_WRITE_TIMEOUT", 10*time.Second),
+		sampler:      newFeedSampler(),
+		writer: db.NewBatchWriter(database, db.BatchConfig{
+			Size:     getIntEnv("BATCH_SIZE", 500),
+			Interval: getDurationEnv("BATCH_FLUSH_INTERVAL", 20*time.Millisecond),
+			Workers:  getIntEnv("BATCH_WORKERS", 4),
+		}),
 	}
 }
 
-// broadcastToClients sends a message to all connected clients
-func (h *Handler) broadcastToClients(message interface{}) {
+// acquireWriteSlot reserves capacity for one insert without blocking
+// When the write path or the DB pool is saturated it returns how long the client should back off
+func (h *Handler) acquireWriteSlot() (time.Duration, bool) {
+	stats := h.db.Stats()
+	if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+		return 2 * h.retryAfter, false
+	}
+
+	select {
+	case h.writeSlots <- struct{}{}:
+		return 0, true
+	default:
+		return h.retryAfter, false
+	}
+}
+
+// releaseWriteSlot frees capacity reserved by acquireWriteSlot
+func (h *Handler) releaseWriteSlot() {
+	<-h.writeSlots
+}
+
+// broadcastToClients sends an event to every live-feed client
+func (h *Handler) broadcastToClients(event types.Event) {
+	h.broadcastMatching(event, nil)
+}
+
+// broadcastMatching sends an event to the live-feed clients whose subscription passes match
+// (nil: every subscriber). It only queues the event for each client's writer, so a slow client
+// never holds up ingestion or the other clients
+func (h *Handler) broadcastMatching(event types.Event, match func(types.Subscription) bool) {
+	// Each role gets its own redacted copy, encoded once
+	frames := make(map[roles.Role][]byte)
 	h.clientsMutex.RLock()
+	defer h.clientsMutex.RUnlock()
+	for _, feed := range h.clients {
+		if !feed.wants(match) {
+			continue
+		}
+		frame, ok := frames[feed.role]
+		if !ok {
+			var err error
+			if frame, err = json.Marshal(h.redactEvent(feed.role, event)); err != nil {
+				slog.Error("Error encoding broadcast", "type", event.Type, "error", err)
+				frame = nil
+			}
+			frames[feed.role] = frame
+		}
+		if frame != nil {
+			h.enqueue(feed, event.Type, frame)
+		}
+	}
+}
 
-	// Collect clients to remove
-	var clientsToRemove []*websocket.Conn
+// UseRedaction applies policy to the broadcasts of each live-feed client for its role
+func (h *Handler) UseRedaction(policy *redact.Policy) {
+	h.redaction = policy
+}
 
-	for client := range h.clients {
-		if err := client.WriteJSON(message); err != nil {
-			log.Printf("Error broadcasting to client: %v", err)
-			clientsToRemove = append(clientsToRemove, client)
+// redactEvent applies the redaction policy for role to the device logs an event carries: a log
+// entry, or the rollup standing in for log entries. Alerts, anomalies and the other events are
+// written by the server or by operators, so they are sent as they are
+func (h *Handler) redactEvent(role roles.Role, event types.Event) types.Event {
+	if h.redaction == nil {
+		return event
+	}
+	switch data := event.Data.(type) {
+	case types.LogMessage:
+		event.Data = h.redaction.Reading(role, data)
+	case types.LogRollup:
+		for column, field := range map[string]*string{
+			"device_id": &data.DeviceID, "device_type": &data.DeviceType, "location": &data.Location,
+			"log_type": &data.LogType, "unit": &data.Unit, "message": &data.Message,
+		} {
+			h.redaction.Text(role, column, field)
 		}
+		event.Data = data
 	}
+	return event
+}
 
-	h.clientsMutex.RUnlock()
+// publishRealtimeMetrics pushes the latest completed realtime bucket of every series
+// to connected clients once per resolution interval
+func (h *Handler) publishRealtimeMetrics() {
+	ticker := time.NewTicker(h.realtime.Resolution())
+	defer ticker.Stop()
 
-	// Remove failed clients
-	if len(clientsToRemove) > 0 {
-		h.clientsMutex.Lock()
-		for _, client := range clientsToRemove {
-			delete(h.clients, client)
+	for range ticker.C {
+		latest := h.realtime.Latest()
+		if len(latest) == 0 {
+			continue
 		}
-		h.clientsMutex.Unlock()
+		h.broadcastToClients(types.NewEvent(types.EventRealtimeMetrics, latest))
+	}
+}
+
+// publishHeartbeats sends a heartbeat event to every live-feed client once per interval
+func (h *Handler) publishHeartbeats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.clientsMutex.RLock()
+		clients := len(h.clients)
+		h.clientsMutex.RUnlock()
+
+		h.broadcastToClients(types.NewEvent(types.EventHeartbeat, types.HeartbeatEvent{
+			ServerTime: now.UTC(),
+			Clients:    clients,
+			Sampling:   h.sampler.current(),
+		}))
 	}
 }
 
@@ -74,27 +209,33 @@ func (h *Handler) broadcastToClients(message interface{}) {
 // 3. Validates and stores logs in database
 // 4. Sends responses back to client
 func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Devices authenticate with an API key on the upgrade request or in a first {"type": "auth"} frame
+	var key *devicekeys.Key
+	if h.keys != nil {
+		if secret := apiKeyFromRequest(r); secret != "" {
+			k, ok := h.keys.Authenticate(secret)
+			if !ok {
+				httpError(w, r, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			key = k
+		}
+	}
+
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		slog.ErrorContext(r.Context(), "Failed to upgrade connection", "error", err)
 		return
 	}
 
-	// Add client to the list of connected clients
-	h.clientsMutex.Lock()
-	h.clients[conn] = true
-	h.clientsMutex.Unlock()
-
-	// Remove client when connection closes
-	defer func() {
-		h.clientsMutex.Lock()
-		delete(h.clients, conn)
-		h.clientsMutex.Unlock()
-		conn.Close()
-	}()
+	// Add client to the list of connected clients and remove it when the connection closes
+	feed := h.newFeedClient(conn, r)
+	ctx := logging.WithConnID(r.Context(), feed.id)
+	clients := h.addClient(conn, feed)
+	defer h.removeClient(conn)
 
-	log.Printf("New WebSocket connection established. Total clients: %d", len(h.clients))
+	slog.InfoContext(ctx, "New WebSocket connection established", "remote_addr", r.RemoteAddr, "clients", clients)
 
 	// Main message processing loop
 	for {
@@ -103,90 +244,357 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		// message: the actual message content
 		_, message, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
+			slog.DebugContext(ctx, "Connection closed", "error", err)
 			break // Exit loop if connection is closed or error occurs
 		}
 
+		if h.keys != nil {
+			if secret, ok := parseAuthFrame(message); ok {
+				k, valid := h.keys.Authenticate(secret)
+				if !valid {
+					sendError(ctx, feed, types.CodeUnauthorized, "Invalid API key")
+					closeWithCode(ctx, conn, types.CloseUnauthorized, "invalid API key")
+					break
+				}
+				key = k
+				sendSuccess(ctx, feed, "Authenticated")
+				continue
+			}
+		}
+
+		// Dashboards narrow the live feed with {"type": "subscribe", ...}
+		if handleSubscriptionFrame(ctx, feed, message) {
+			continue
+		}
+		feed.markDevice()
+
+		// Devices report on the commands delivered to them with {"type": "command_status", ...}
+		if h.handleCommandFrame(ctx, feed, key, message) {
+			continue
+		}
+
 		// Parse JSON message into LogMessage struct (this is from types.go)
-		var logMsg types.LogMessage
-		if err := json.Unmarshal(message, &logMsg); err != nil {
-			log.Printf("Error parsing JSON: %v", err)
-			sendError(conn, "Invalid JSON format")
+		// Devices that retry may add a msg_id, which every response to the log carries back
+		var frame struct {
+			types.LogMessage
+			MsgID string `json:"msg_id"`
+		}
+		if err := json.Unmarshal(message, &frame); err != nil {
+			slog.WarnContext(ctx, "Error parsing JSON", "error", err)
+			sendError(ctx, feed, types.CodeInvalidJSON, "Invalid JSON format")
 			continue // Continue to next message instead of breaking
 		}
+		logMsg, msgID := frame.LogMessage, frame.MsgID
+		reply := func(response types.LogResponse) {
+			response.MsgID = msgID
+			sendResponse(ctx, feed, response)
+		}
+		received := time.Now()
+		logMsg.IngestedAt = &received
 
 		// Validate the log message (check required fields)
-		if err := validateLogMessage(logMsg); err != nil {
-			log.Printf("Validation error: %v", err)
-			sendError(conn, err.Error())
+		err = validateLogMessage(&logMsg)
+		if len(msgID) > maxMsgIDLength {
+			err = withFieldError(err, types.FieldError{Field: "msg_id", Code: "invalid", Message: fmt.Sprintf("msg_id must be at most %d characters", maxMsgIDLength)})
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Validation error", "device_id", logMsg.DeviceID, "error", err)
+			reply(validationErrorResponse(err))
+			continue
+		}
+
+		if reason, closeConn := h.authorizeLog(key, logMsg); reason != "" {
+			reply(errorResponse(types.CodeUnauthorized, reason))
+			if closeConn {
+				closeWithCode(ctx, conn, types.CloseUnauthorized, reason)
+				break
+			}
+			continue
+		}
+
+		if err := h.admitDevice(logMsg); err != nil {
+			reply(errorResponse(types.CodeDeviceRejected, err.Error()))
+			continue
+		}
+
+		// A resent msg_id is acknowledged again without storing the log twice
+		if msgID != "" {
+			switch state := h.acks.begin(logMsg.DeviceID, msgID); state {
+			case ackStored, ackQueued:
+				slog.DebugContext(ctx, "Duplicate log acknowledged", "device_id", logMsg.DeviceID, "msg_id", msgID)
+				reply(duplicateResponse(state == ackQueued))
+				continue
+			case ackPending:
+				reply(retryAfterResponse(h.retryAfter))
+				continue
+			}
+		}
+
+		// Reject with a retry hint instead of piling more work onto a saturated write path
+		retryAfter, ok := h.acquireWriteSlot()
+		if !ok {
+			slog.WarnContext(ctx, "Write path saturated, asking device to retry", "device_id", logMsg.DeviceID, "retry_after", retryAfter.String())
+			h.abortAck(logMsg.DeviceID, msgID)
+			reply(retryAfterResponse(retryAfter))
 			continue
 		}
 
-		// Store the validated log in TimescaleDB
-		if err := h.storeLog(logMsg); err != nil {
-			log.Printf("Error storing log: %v", err)
-			sendError(conn, "Failed to store log")
+		// Store the validated log in TimescaleDB, or queue it to be stored when the database recovers
+		queued, err := h.storeOrQueue(logMsg, sourceWebSocket)
+		h.releaseWriteSlot()
+		if err != nil {
+			h.abortAck(logMsg.DeviceID, msgID)
+			// A database that is down or out of connections will take the reading again later
+			if apperrors.Retryable(err) {
+				slog.WarnContext(ctx, "Database unavailable, asking device to retry", "device_id", logMsg.DeviceID, "error", err)
+				reply(retryAfterResponse(h.retryAfter))
+				continue
+			}
+			slog.ErrorContext(ctx, "Error storing log", "device_id", logMsg.DeviceID, "error", err)
+			reply(errorResponse(types.CodeStoreFailed, "Failed to store log"))
 			continue
 		}
+		h.finishAck(logMsg.DeviceID, msgID, queued)
 
 		// Send success response back to the sender
-		sendSuccess(conn, "Log stored successfully")
+		if queued {
+			reply(queuedResponse())
+		} else {
+			reply(successResponse("Log stored successfully"))
+			h.afterStore(logMsg)
+		}
+
+		// Commands wait for their device to be connected and are delivered after its reading
+		h.deliverCommands(ctx, feed, logMsg.DeviceID)
+	}
+}
+
+// SaturatedError is returned by Ingest when the write path is full
+type SaturatedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SaturatedError) Error() string {
+	return fmt.Sprintf("write path saturated, retry after %s", e.RetryAfter)
+}
+
+// Is makes every SaturatedError an apperrors.ErrRateLimited
+func (e *SaturatedError) Is(target error) bool { return target == apperrors.ErrRateLimited }
+
+// Ingest validates, stores and publishes a log that arrived outside the WebSocket
+// (webhooks, listeners, pollers). It is safe for concurrent use.
+func (h *Handler) Ingest(logMsg types.LogMessage) error {
+	received := time.Now()
+	logMsg.IngestedAt = &received
+	if err := validateLogMessage(&logMsg); err != nil {
+		return err
+	}
+	if err := h.admitDevice(logMsg); err != nil {
+		return err
+	}
 
-		// Broadcast the log data to all connected clients for live feed
-		h.broadcastToClients(map[string]interface{}{
-			"type": "log_entry",
-			"data": logMsg,
-		})
+	retryAfter, ok := h.acquireWriteSlot()
+	if !ok {
+		return &SaturatedError{RetryAfter: retryAfter}
 	}
+
+	queued, err := h.storeOrQueue(logMsg, sourceIngest)
+	h.releaseWriteSlot()
+	if err != nil {
+		return fmt.Errorf("failed to store log: %w", err)
+	}
+
+	// A queued reading runs the post-ingestion steps when it is stored
+	if !queued {
+		h.afterStore(logMsg)
+	}
+	return nil
+}
+
+// OnStored registers fn to be called with every stored reading (including derived ones)
+// Listeners must be registered before the server starts and must not block
+func (h *Handler) OnStored(fn func(types.LogMessage)) {
+	h.listeners = append(h.listeners, fn)
+}
+
+// afterStore runs the post-ingestion steps for a stored reading:
+// realtime aggregation, derived metric evaluation, the live feed broadcast and stored-reading listeners
+func (h *Handler) afterStore(logMsg types.LogMessage) {
+	// Update the in-memory sub-5-minute aggregates
+	h.realtime.Record(logMsg)
+
+	// Broadcast the log data to the live feed clients subscribed to it
+	h.broadcastLog(logMsg)
+	h.notifyListeners(logMsg)
+
+	// Evaluate ingest-time derived metrics completed by this reading and store them like native readings
+	for _, derivedMsg := range h.derived.Observe(logMsg) {
+		queued, err := h.storeOrQueue(derivedMsg, sourceDerived)
+		if err != nil {
+			slog.Error("Error storing derived metric", "metric", derivedMsg.DeviceType, "error", err)
+			continue
+		}
+		if !queued {
+			h.publishDerived(derivedMsg)
+		}
+	}
+}
+
+// publishDerived runs the post-ingestion steps of a stored derived reading; derived readings are
+// not evaluated for derived metrics themselves
+func (h *Handler) publishDerived(derivedMsg types.LogMessage) {
+	h.realtime.Record(derivedMsg)
+	h.broadcastLog(derivedMsg)
+	h.notifyListeners(derivedMsg)
+}
+
+// broadcastLog publishes a stored reading as a log_entry, unless the feed sampler holds it back
+func (h *Handler) broadcastLog(logMsg types.LogMessage) {
+	if !h.sampler.admit(logMsg, time.Now()) {
+		return
+	}
+	h.broadcastMatching(types.NewEvent(types.EventLogEntry, logMsg), func(sub types.Subscription) bool {
+		return sub.Matches(logMsg)
+	})
+}
+
+func (h *Handler) notifyListeners(logMsg types.LogMessage) {
+	for _, fn := range h.listeners {
+		fn(logMsg)
+	}
+}
+
+// maxMetadataBytes bounds the encoded metadata of one reading, so extras stay extras
+const maxMetadataBytes = 4096
+
+// ValidationError lists every problem found in a log message
+type ValidationError struct {
+	Fields []types.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Message
+	}
+	return strings.Join(messages, "; ")
 }
 
-// validateLogMessage checks if all required fields are present and valid
-func validateLogMessage(log types.LogMessage) error {
-	if log.DeviceID == "" {
-		return fmt.Errorf("device_id is required")
+// Is makes every ValidationError an apperrors.ErrValidation
+func (e *ValidationError) Is(target error) bool { return target == apperrors.ErrValidation }
+
+// withFieldError adds a field problem to the *ValidationError of validateLogMessage, or starts one
+func withFieldError(err error, problem types.FieldError) error {
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		validation.Fields = append(validation.Fields, problem)
+		return validation
+	}
+	return &ValidationError{Fields: []types.FieldError{problem}}
+}
+
+// validateLogMessage checks every field, returning a *ValidationError with all problems found,
+// and defaults a missing time to now. Readings of registered device types must carry the type's
+// unit, which is filled in when missing, and a value in its range
+func validateLogMessage(log *types.LogMessage) error {
+	var problems []types.FieldError
+	if strings.TrimSpace(log.DeviceID) == "" {
+		problems = append(problems, types.FieldError{Field: "device_id", Code: "required", Message: "device_id is required"})
 	}
-	if log.LogType == "" {
-		return fmt.Errorf("log_type is required")
+	if strings.TrimSpace(log.LogType) == "" {
+		problems = append(problems, types.FieldError{Field: "log_type", Code: "required", Message: "log_type is required"})
 	}
-	if log.LogType == "" {
-		return fmt.Errorf("LogType is required")
+	if log.RawValue != nil && (math.IsNaN(*log.RawValue) || math.IsInf(*log.RawValue, 0)) {
+		problems = append(problems, types.FieldError{Field: "raw_value", Code: "invalid", Message: "raw_value must be a finite number"})
 	}
-	// If time is not provided, use current time
+	if len(log.Metadata) > 0 {
+		if data, err := json.Marshal(log.Metadata); err != nil || len(data) > maxMetadataBytes {
+			problems = append(problems, types.FieldError{Field: "metadata", Code: "invalid",
+				Message: fmt.Sprintf("metadata must be a JSON object of at most %d bytes", maxMetadataBytes)})
+		}
+	}
+	problems = append(problems, devicetypes.Check(log)...)
+	if len(problems) > 0 {
+		return &ValidationError{Fields: problems}
+	}
+
+	// If time is not provided, use the receive time
 	if log.Time.IsZero() {
-		log.Time = time.Now()
+		if log.IngestedAt != nil {
+			log.Time = *log.IngestedAt
+		} else {
+			log.Time = time.Now()
+		}
 	}
 	return nil
 }
 
-// storeLog inserts a log message into the TimescaleDB device_logs table
+// storeLog inserts a log message into the TimescaleDB sensor_readings table
+// Concurrent callers share batched COPY round trips; it returns once this reading is stored
 func (h *Handler) storeLog(log types.LogMessage) error {
-	return db.StoreSensorReading(h.db, log)
+	return h.writer.Write(log)
 }
 
 // sendSuccess sends a success response to the WebSocket client
 // log response is from types.go
-func sendSuccess(conn *websocket.Conn, message string) {
-	response := types.LogResponse{
+func sendSuccess(ctx context.Context, conn jsonWriter, message string) {
+	sendResponse(ctx, conn, successResponse(message))
+}
+
+// sendError sends an error response with its machine-readable code to the WebSocket client
+func sendError(ctx context.Context, conn jsonWriter, code types.ErrorCode, errorMsg string) {
+	sendResponse(ctx, conn, errorResponse(code, errorMsg))
+}
+
+// jsonWriter is where responses are written: a *feedClient, which serializes them with its broadcasts
+type jsonWriter interface {
+	WriteJSON(v interface{}) error
+}
+
+// sendResponse writes a response to the WebSocket client
+func sendResponse(ctx context.Context, conn jsonWriter, response types.LogResponse) {
+	// Convert response struct to JSON and send
+	if err := conn.WriteJSON(response); err != nil {
+		slog.WarnContext(ctx, "Error sending response", "success", response.Success, "code", response.Code, "error", err)
+	}
+}
+
+func successResponse(message string) types.LogResponse {
+	return types.LogResponse{
 		Success: true,
 		Message: message,
 	}
+}
 
-	// Convert response struct to JSON and send
-	if err := conn.WriteJSON(response); err != nil {
-		log.Printf("Error sending success response: %v", err)
+func retryAfterResponse(retryAfter time.Duration) types.LogResponse {
+	return types.LogResponse{
+		Success:      false,
+		Message:      "Server busy, retry later",
+		Error:        "write buffer full",
+		Code:         types.CodeRateLimited,
+		RetryAfterMs: retryAfter.Milliseconds(),
 	}
 }
 
-// sendError sends an error response to the WebSocket client
-func sendError(conn *websocket.Conn, errorMsg string) {
+func validationErrorResponse(err error) types.LogResponse {
 	response := types.LogResponse{
 		Success: false,
 		Message: "Error processing log",
-		Error:   errorMsg,
+		Error:   err.Error(),
+		Code:    types.CodeValidationFailed,
+	}
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		response.Details = validation.Fields
 	}
+	return response
+}
 
-	// Convert response struct to JSON and send
-	if err := conn.WriteJSON(response); err != nil {
-		log.Printf("Error sending error response: %v", err)
+func errorResponse(code types.ErrorCode, errorMsg string) types.LogResponse {
+	return types.LogResponse{
+		Success: false,
+		Message: "Error processing log",
+		Error:   errorMsg,
+		Code:    code,
 	}
 }
@@ -0,0 +1,28 @@
+package ws
+
+import (
+	"log/slog"
+
+	"edge-insights/internal/hass"
+	"edge-insights/internal/mqttclient"
+)
+
+// startHomeAssistant mirrors devices to Home Assistant over MQTT when HASS_ENABLED=true
+func (s *Server) startHomeAssistant() {
+	if getEnv("HASS_ENABLED", "false") != "true" {
+		return
+	}
+	if !mqttclient.Configured() {
+		slog.Warn("HASS_ENABLED is set but MQTT_BROKER_URL is not; Home Assistant bridge disabled")
+		return
+	}
+
+	bridge, err := hass.NewBridge(s.db, s.handler.Ingest)
+	if err != nil {
+		slog.Error("Failed to start Home Assistant bridge", "error", err)
+		return
+	}
+	s.handler.OnStored(bridge.Publish)
+	bridge.Start()
+	slog.Info("Home Assistant bridge connected")
+}
@@ -0,0 +1,168 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/hooks"
+	"edge-insights/internal/incidents"
+	"edge-insights/internal/types"
+	"edge-insights/internal/vitals"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// startIncidents files alerts into incidents, has the AI title them (INCIDENT_AI_TITLES, default true)
+// and pushes incident changes on the live feed
+func (s *Server) startIncidents() {
+	if getEnv("INCIDENT_AI_TITLES", "true") != "false" {
+		s.incidents.SetDescriber(s.ai.DescribeIncident)
+	}
+	s.vitals.OnAlert(func(alert vitals.Alert) {
+		s.recordSignal(incidents.AlertSignal(alert.Event()))
+	})
+	s.incidents.OnChange(s.publishIncident)
+}
+
+// recordAnomalies files detected anomalies into incidents, and posts and publishes on the live feed
+// the ones not seen before, so detecting them again does not repeat them
+// to the outgoing webhooks and the knowledge searched by /api/ai/search
+func (s *Server) recordAnomalies(anomalies []types.Anomaly) {
+	for _, anomaly := range anomalies {
+		var deviceType, location string
+		if d, ok := s.registry.Get(anomaly.DeviceID); ok {
+			deviceType, location = d.Type, d.Location
+		}
+		signal := incidents.AnomalySignal(anomaly, deviceType, location)
+		if s.recordSignal(signal) {
+			s.publishAnomaly(anomaly, deviceType, location)
+			s.hooks.Dispatch(hooks.AnomalyNotification(anomaly, deviceType, location))
+			s.ai.Remember(ai.KnowledgeEntry{
+				Kind:      ai.KnowledgeAnomaly,
+				SourceID:  signal.Key,
+				Time:      anomaly.Time,
+				DeviceIDs: []string{anomaly.DeviceID},
+				Locations: nonEmpty(location),
+				Title:     fmt.Sprintf("%s %s anomaly", anomaly.Severity, anomaly.Type),
+				Content:   anomaly.Message,
+			})
+		}
+	}
+}
+
+// nonEmpty is a list of the value, or an empty list when it is empty
+func nonEmpty(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return []string{value}
+}
+
+// recordSignal files a signal into incidents and reports whether it was new
+// A signal that could not be recorded counts as new so it is not silently dropped
+func (s *Server) recordSignal(signal incidents.Signal) bool {
+	incident, err := s.incidents.Record(signal)
+	if err != nil {
+		slog.Error("Failed to record incident signal", "key", signal.Key, "error", err)
+		return true
+	}
+	return incident != nil
+}
+
+// publishIncident sends an incident change to the subscribers of any of its devices
+func (s *Server) publishIncident(incident incidents.Incident) {
+	event := types.NewEvent(types.EventIncident, incident.Event())
+	s.handler.broadcastMatching(event, func(sub types.Subscription) bool {
+		for _, id := range incident.DeviceIDs {
+			var deviceType, location string
+			if d, ok := s.registry.Get(id); ok {
+				deviceType, location = d.Type, d.Location
+			}
+			if sub.MatchesDevice(id, deviceType, location) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// incidentsHandler lists incidents, most recently active first (GET)
+// Accepts status, device_id, location and limit
+func (s *Server) incidentsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := incidents.Filter{
+		Status:   incidents.Status(q.Get("status")),
+		DeviceID: q.Get("device_id"),
+		Location: q.Get("location"),
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		httpError(w, r, "status must be open, investigating or resolved", http.StatusBadRequest)
+		return
+	}
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		filter.Limit = l
+	}
+
+	list, err := s.incidents.List(filter)
+	if err != nil {
+		writeError(w, r, "Error listing incidents", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"incidents": list,
+		"count":     len(list),
+	})
+}
+
+// incidentHandler returns /api/incidents/{id} with its signals (GET)
+func (s *Server) incidentHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	incident, err := s.incidents.Get(id)
+	if err != nil {
+		writeError(w, r, "Error getting incident", err, "incident_id", id)
+		return
+	}
+	writeIncident(w, incident)
+}
+
+// updateIncidentHandler changes the status, title or note of /api/incidents/{id} (PATCH; operator or admin)
+func (s *Server) updateIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var update incidents.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := update.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	incident, err := s.incidents.Apply(id, update)
+	if err != nil {
+		writeError(w, r, "Error updating incident", err, "incident_id", id)
+		return
+	}
+	writeIncident(w, incident)
+}
+
+// describeIncidentHandler regenerates the AI title and summary of /api/incidents/{id}/describe
+// (POST; operator or admin)
+func (s *Server) describeIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	incident, err := s.incidents.Describe(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "Failed to describe incident", err)
+		return
+	}
+	writeIncident(w, incident)
+}
+
+func writeIncident(w http.ResponseWriter, incident *incidents.Incident) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incident)
+}
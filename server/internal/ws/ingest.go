@@ -0,0 +1,173 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/devicekeys"
+	apperrors "edge-insights/internal/errors"
+	"edge-insights/internal/types"
+)
+
+// maxIngestBody caps POST /api/ingest payloads
+const maxIngestBody = 16 << 20
+
+// IngestBatch validates every reading, stores the valid ones with one COPY and publishes them
+// The COPY is all-or-nothing, so either every accepted reading is stored or none is; the results
+// say which readings were rejected and why, in request order
+func (h *Handler) IngestBatch(ctx context.Context, key *devicekeys.Key, batch []types.LogMessage) types.IngestResponse {
+	response := types.IngestResponse{Results: make([]types.IngestResult, len(batch))}
+	received := time.Now()
+
+	var valid []types.LogMessage
+	var indexes []int
+	for i := range batch {
+		msg := batch[i]
+		msg.IngestedAt = &received
+		result := &response.Results[i]
+		*result = types.IngestResult{Index: i, DeviceID: msg.DeviceID}
+
+		if err := validateLogMessage(&msg); err != nil {
+			result.Error, result.Code = err.Error(), types.CodeValidationFailed
+			var validation *ValidationError
+			if errors.As(err, &validation) {
+				result.Details = validation.Fields
+			}
+			continue
+		}
+		if reason, _ := h.authorizeLog(key, msg); reason != "" {
+			result.Error, result.Code = reason, types.CodeUnauthorized
+			continue
+		}
+		if err := h.admitDevice(msg); err != nil {
+			result.Error, result.Code = err.Error(), types.CodeDeviceRejected
+			continue
+		}
+		valid = append(valid, msg)
+		indexes = append(indexes, i)
+	}
+	response.Rejected = len(batch) - len(valid)
+	if len(valid) == 0 {
+		return response
+	}
+
+	// The batch takes one write slot; it is a single COPY rather than a reading per slot
+	fail := func(code types.ErrorCode, message string) types.IngestResponse {
+		for _, i := range indexes {
+			response.Results[i].Error, response.Results[i].Code = message, code
+		}
+		response.Rejected = len(batch)
+		return response
+	}
+	retryAfter, ok := h.acquireWriteSlot()
+	if !ok {
+		response.RetryAfterMs = retryAfter.Milliseconds()
+		return fail(types.CodeRateLimited, "Server busy, retry later")
+	}
+	err := db.CopySensorReadings(ctx, h.db, valid)
+	h.releaseWriteSlot()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error storing ingest batch", "readings", len(valid), "error", err)
+		if !h.queueBatch(valid, err) {
+			if apperrors.Retryable(err) {
+				response.RetryAfterMs = h.retryAfter.Milliseconds()
+				return fail(types.CodeRateLimited, "Database unavailable, retry later")
+			}
+			return fail(types.CodeStoreFailed, "Failed to store batch")
+		}
+		// Queued readings run the post-ingestion steps when they are stored
+		for _, i := range indexes {
+			response.Results[i].Success = true
+			response.Results[i].Queued = true
+		}
+		response.Accepted = len(valid)
+		response.Queued = len(valid)
+		return response
+	}
+
+	for n, i := range indexes {
+		response.Results[i].Success = true
+		h.afterStore(valid[n])
+	}
+	response.Accepted = len(valid)
+	return response
+}
+
+// ingestHandler stores a JSON array of readings sent in one request (POST /api/ingest), for devices
+// that buffer readings offline and upload them in batches instead of holding a WebSocket open
+// Devices authenticate with an API key as on /ws when keys are required
+// Responds 200 with per-reading results, 429 with Retry-After over the key's rate limit, 503 with
+// Retry-After when the server is saturated and 500 when the batch could be neither stored nor
+// dead-lettered; nothing is stored in any failure case
+func (s *Server) ingestHandler(w http.ResponseWriter, r *http.Request) {
+	var key *devicekeys.Key
+	if s.handler.keys != nil {
+		if secret := apiKeyFromRequest(r); secret != "" {
+			k, ok := s.handler.keys.Authenticate(secret)
+			if !ok {
+				httpError(w, r, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			key = k
+		}
+		if key == nil {
+			httpError(w, r, "API key required", http.StatusUnauthorized)
+			return
+		}
+	}
+	if ok, wait := s.limits.allowIngest(r, key); !ok {
+		writeRateLimited(w, r, wait, "Too many uploads")
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxIngestBody+1))
+	if err != nil {
+		httpError(w, r, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(payload) > maxIngestBody {
+		httpError(w, r, "Batch too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var batch []types.LogMessage
+	if err := json.Unmarshal(payload, &batch); err != nil {
+		httpError(w, r, "Body must be a JSON array of log messages", http.StatusBadRequest)
+		return
+	}
+	if len(batch) == 0 {
+		httpError(w, r, "Batch is empty", http.StatusBadRequest)
+		return
+	}
+	if max := getIntEnv("INGEST_BATCH_MAX", 5000); len(batch) > max {
+		httpError(w, r, "Batch exceeds "+strconv.Itoa(max)+" readings", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	response := s.handler.IngestBatch(r.Context(), key, batch)
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case response.RetryAfterMs > 0:
+		w.Header().Set("Retry-After", strconv.Itoa(int((response.RetryAfterMs+999)/1000)))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case response.Accepted == 0 && hasCode(response.Results, types.CodeStoreFailed):
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func hasCode(results []types.IngestResult, code types.ErrorCode) bool {
+	for _, result := range results {
+		if result.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package ws
+
+import (
+	"net/http"
+
+	"edge-insights/internal/ai"
+)
+
+// aiLanguage picks the language AI summaries, explanations and rationales are written in: the
+// lang parameter, else the caller's Accept-Language, else AI_LANGUAGE
+func aiLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag, ok, err := ai.ParseLanguage(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			r = r.WithContext(ai.WithLanguage(r.Context(), tag))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/maintenance"
+)
+
+// maxMaintenanceDevices caps how many ranked devices are returned and explained
+const maxMaintenanceDevices = 50
+
+// maintenanceHandler lists the devices most likely to fail soon, highest maintenance score first (GET)
+// Accepts device_type, location, window (default MAINTENANCE_WINDOW), limit (default 10) and
+// rationale=false to skip the AI explanation of each device
+func (s *Server) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := maintenance.Options{
+		DeviceType: q.Get("device_type"),
+		Location:   q.Get("location"),
+		Window:     getDurationEnv("MAINTENANCE_WINDOW", 7*24*time.Hour),
+		Recent:     getDurationEnv("MAINTENANCE_RECENT", 24*time.Hour),
+		Lifetime:   getDurationEnv("DEVICE_SERVICE_LIFE", 5*365*24*time.Hour),
+	}
+	if window := q.Get("window"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= opts.Recent {
+			httpError(w, r, "window must be a duration longer than "+opts.Recent.String(), http.StatusBadRequest)
+			return
+		}
+		opts.Window = d
+	}
+	limit := 10
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxMaintenanceDevices)
+	}
+
+	scores, err := maintenance.Rank(r.Context(), s.db, s.ai.Baselines().Baselines(), opts)
+	if err != nil {
+		writeError(w, r, "Failed to score devices", err)
+		return
+	}
+	total := len(scores)
+	if len(scores) > limit {
+		scores = scores[:limit]
+	}
+
+	// The scores stand on their own, so a failed explanation only drops the rationales
+	explained := false
+	if q.Get("rationale") != "false" && len(scores) > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		rationales, err := s.ai.ExplainMaintenance(ctx, scores)
+		cancel()
+		if err != nil {
+			slog.WarnContext(r.Context(), "Failed to explain maintenance scores", "error", err)
+		} else {
+			for i := range scores {
+				scores[i].Rationale = rationales[scores[i].DeviceID]
+			}
+			explained = true
+		}
+	}
+	if scores == nil {
+		scores = []maintenance.Score{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"devices":   scores,
+		"count":     len(scores),
+		"scored":    total,
+		"window":    opts.Window.String(),
+		"explained": explained,
+	})
+}
@@ -0,0 +1,80 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/logtemplate"
+)
+
+// messageTemplatesHandler lists the most frequent message templates of each device per day (GET)
+// Accepts device_id, log_type (repeated or comma-separated), start and end (YYYY-MM-DD, UTC days,
+// both inclusive, default the last 7 days) and k (templates per device and day, default 10, max 100)
+func (s *Server) messageTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	filter := logtemplate.Filter{
+		DeviceID: q.Get("device_id"),
+		LogTypes: queryList(q, "log_type"),
+		Start:    today.AddDate(0, 0, -6),
+		End:      today,
+	}
+	for _, p := range []struct {
+		name   string
+		target *time.Time
+	}{{"start", &filter.Start}, {"end", &filter.End}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				httpError(w, r, p.name+" must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+				return
+			}
+			*p.target = t
+		}
+	}
+	if filter.End.Before(filter.Start) {
+		httpError(w, r, "end must not be before start", http.StatusBadRequest)
+		return
+	}
+	k := 10
+	if v := q.Get("k"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			httpError(w, r, "k must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		k = n
+	}
+
+	days, err := logtemplate.Top(r.Context(), s.db, filter, k)
+	if err != nil {
+		writeError(w, r, "Error fetching message templates", err)
+		return
+	}
+
+	// Templates and examples are log messages, redacted like them
+	role := roleFromRequest(r)
+	results := make([]map[string]interface{}, 0, len(days))
+	for _, day := range days {
+		templates, err := s.redaction.ApplyStructs(role, day.Templates)
+		if err != nil {
+			writeError(w, r, "Error redacting message templates", err)
+			return
+		}
+		results = append(results, map[string]interface{}{
+			"day":       day.Day,
+			"device_id": day.DeviceID,
+			"templates": templates,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":  results,
+		"count": len(results),
+		"start": filter.Start.Format(time.DateOnly),
+		"end":   filter.End.Format(time.DateOnly),
+	})
+}
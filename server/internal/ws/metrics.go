@@ -0,0 +1,134 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"edge-insights/internal/db"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UsePool exposes the database connection pool's stats on /metrics
+func (s *Server) UsePool(pool *pgxpool.Pool) {
+	s.pool = pool
+}
+
+// metricsHandler serves the connection pool stats, the write latency histograms and the live-feed
+// send queues in the Prometheus text format (GET /metrics)
+// Counters are cumulative since startup; pool stats are left out when the server was built without a pool
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if s.pool != nil {
+		writePoolMetrics(w, s.pool)
+	}
+	writeWriteMetrics(w, db.GetWriteStats())
+	writeFeedMetrics(w, s.handler.FeedStats())
+}
+
+func writePoolMetrics(w io.Writer, pool *pgxpool.Pool) {
+	stat := pool.Stat()
+
+	metrics := []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"db_pool_max_conns", "gauge", "Maximum size of the pool", float64(stat.MaxConns())},
+		{"db_pool_total_conns", "gauge", "Connections currently in the pool", float64(stat.TotalConns())},
+		{"db_pool_acquired_conns", "gauge", "Connections currently in use", float64(stat.AcquiredConns())},
+		{"db_pool_idle_conns", "gauge", "Connections currently idle", float64(stat.IdleConns())},
+		{"db_pool_constructing_conns", "gauge", "Connections being established", float64(stat.ConstructingConns())},
+		{"db_pool_acquire_total", "counter", "Successful connection acquires", float64(stat.AcquireCount())},
+		{"db_pool_acquire_duration_seconds_total", "counter", "Time spent acquiring connections", stat.AcquireDuration().Seconds()},
+		{"db_pool_empty_acquire_total", "counter", "Acquires that had to wait because the pool was empty", float64(stat.EmptyAcquireCount())},
+		{"db_pool_empty_acquire_wait_seconds_total", "counter", "Time spent waiting on an empty pool", stat.EmptyAcquireWaitTime().Seconds()},
+		{"db_pool_canceled_acquire_total", "counter", "Acquires canceled by their context while waiting", float64(stat.CanceledAcquireCount())},
+		{"db_pool_new_conns_total", "counter", "Connections opened", float64(stat.NewConnsCount())},
+		{"db_pool_max_lifetime_destroy_total", "counter", "Connections closed for reaching DB_POOL_MAX_CONN_LIFETIME", float64(stat.MaxLifetimeDestroyCount())},
+		{"db_pool_max_idle_destroy_total", "counter", "Connections closed for reaching DB_POOL_MAX_CONN_IDLE_TIME", float64(stat.MaxIdleDestroyCount())},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP edge_insights_%s %s\n# TYPE edge_insights_%s %s\nedge_insights_%s %g\n",
+			m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
+
+// writeWriteMetrics writes the latency histogram, error and row counters of the writes to each
+// table, labelled with the table and the operation (insert or copy)
+func writeWriteMetrics(w io.Writer, stats []db.WriteStats) {
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprint(w, "# HELP edge_insights_db_write_duration_seconds Latency of write statements, from acquiring a connection to the result\n"+
+		"# TYPE edge_insights_db_write_duration_seconds histogram\n")
+	for _, st := range stats {
+		labels := fmt.Sprintf(`table="%s",operation="%s"`, st.Table, st.Operation)
+		for _, b := range st.Buckets {
+			fmt.Fprintf(w, "edge_insights_db_write_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(b.LE, 'g', -1, 64), b.Count)
+		}
+		fmt.Fprintf(w, "edge_insights_db_write_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, st.Count)
+		fmt.Fprintf(w, "edge_insights_db_write_duration_seconds_sum{%s} %g\n", labels, st.SumSeconds)
+		fmt.Fprintf(w, "edge_insights_db_write_duration_seconds_count{%s} %d\n", labels, st.Count)
+	}
+
+	for _, m := range []struct {
+		name, help string
+		value      func(db.WriteStats) int64
+	}{
+		{"db_write_errors_total", "Failed write statements", func(st db.WriteStats) int64 { return st.Errors }},
+		{"db_write_rows_total", "Rows written by successful statements", func(st db.WriteStats) int64 { return st.Rows }},
+	} {
+		fmt.Fprintf(w, "# HELP edge_insights_%s %s\n# TYPE edge_insights_%s counter\n", m.name, m.help, m.name)
+		for _, st := range stats {
+			fmt.Fprintf(w, "edge_insights_%s{table=\"%s\",operation=\"%s\"} %d\n", m.name, st.Table, st.Operation, m.value(st))
+		}
+	}
+}
+
+// writeFeedMetrics writes the live-feed clients, their queued broadcasts and what became of them
+func writeFeedMetrics(w io.Writer, stats FeedStats) {
+	sampling := 0.0
+	if stats.Sampling.Active {
+		sampling = 1
+	}
+	metrics := []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"ws_clients", "gauge", "Connected live-feed clients", float64(stats.Clients)},
+		{"ws_send_queue_frames", "gauge", "Broadcast frames waiting to be written to clients", float64(stats.Queued)},
+		{"ws_broadcast_frames_total", "counter", "Broadcast frames queued to clients", float64(stats.Broadcast)},
+		{"ws_broadcast_sent_total", "counter", "Broadcast frames written to clients", float64(stats.Sent)},
+		{"ws_broadcast_dropped_total", "counter", "Broadcast frames dropped because a client's send queue was full", float64(stats.Dropped)},
+		{"ws_broadcast_coalesced_total", "counter", "Broadcast frames replaced by a newer frame of the same type before being written", float64(stats.Coalesced)},
+		{"ws_sampling_active", "gauge", "Whether log entries on the live feed are being sampled", sampling},
+		{"ws_sampled_log_entries_total", "counter", "Log entries not broadcast one by one because the live feed was sampled", float64(stats.Sampling.Sampled)},
+		{"ws_log_rollups_total", "counter", "log_rollup events broadcast in place of sampled log entries", float64(stats.Sampling.Rollups)},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP edge_insights_%s %s\n# TYPE edge_insights_%s %s\nedge_insights_%s %g\n",
+			m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
+
+// statsHandler reports the writes to each table since startup with their latency percentiles and
+// latest error, the connection pool's usage and the live-feed send queues (GET /api/stats)
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{"writes": db.GetWriteStats(), "live_feed": s.handler.FeedStats()}
+	if s.pool != nil {
+		stat := s.pool.Stat()
+		response["pool"] = map[string]interface{}{
+			"max_conns":           stat.MaxConns(),
+			"total_conns":         stat.TotalConns(),
+			"acquired_conns":      stat.AcquiredConns(),
+			"idle_conns":          stat.IdleConns(),
+			"empty_acquire_total": stat.EmptyAcquireCount(),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	mqttingest "edge-insights/internal/ingest/mqtt"
+	"edge-insights/internal/mqttclient"
+	"edge-insights/internal/types"
+)
+
+// startMQTTIngest subscribes to MQTT_INGEST_TOPICS on the shared broker (off by default)
+func (s *Server) startMQTTIngest() error {
+	spec := getEnv("MQTT_INGEST_TOPICS", "")
+	if spec == "" {
+		return nil
+	}
+	if !mqttclient.Configured() {
+		slog.Warn("MQTT_INGEST_TOPICS is set but MQTT_BROKER_URL is not; MQTT ingestion disabled")
+		return nil
+	}
+
+	subs, err := mqttingest.ParseSubscriptions(spec)
+	if err != nil {
+		return err
+	}
+	qos, err := strconv.Atoi(getEnv("MQTT_INGEST_QOS", "1"))
+	if err != nil || qos < 0 || qos > 2 {
+		slog.Warn("Invalid MQTT_INGEST_QOS, using 1")
+		qos = 1
+	}
+
+	bridge, err := mqttingest.NewBridge(getEnv("MQTT_INGEST_CLIENT_ID", "edge-insights-ingest"), subs, byte(qos),
+		s.ingestWithRetry, s.webhooks.Get, s.decoders.Resolve)
+	if err != nil {
+		return err
+	}
+	s.mqtt = bridge
+	slog.Info("MQTT ingestion started", "subscriptions", len(subs))
+	return nil
+}
+
+// ingestWithRetry stores a reading, waiting out write-path saturation a few times
+// Brokers cannot be told to retry later the way WebSocket clients can, so the subscriber waits instead
+func (s *Server) ingestWithRetry(msg types.LogMessage) error {
+	for attempt := 0; ; attempt++ {
+		err := s.handler.Ingest(msg)
+		var saturated *SaturatedError
+		if !errors.As(err, &saturated) || attempt >= 3 {
+			return err
+		}
+		time.Sleep(saturated.RetryAfter)
+	}
+}
+
+// mqttIngestHandler reports (GET) MQTT subscriptions and their message counts
+func (s *Server) mqttIngestHandler(w http.ResponseWriter, r *http.Request) {
+	subscriptions := []mqttingest.SubscriptionStatus{}
+	if s.mqtt != nil {
+		subscriptions = s.mqtt.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":       s.mqtt != nil,
+		"subscriptions": subscriptions,
+		"count":         len(subscriptions),
+	})
+}
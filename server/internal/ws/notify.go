@@ -0,0 +1,98 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"edge-insights/internal/hooks"
+	"edge-insights/internal/notify"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// notifyTestHandler sends a sample notification (POST) to the notifier config in the body
+// so a Teams/Opsgenie/webhook destination can be checked before it is attached to an alert rule
+func (s *Server) notifyTestHandler(w http.ResponseWriter, r *http.Request) {
+	var config notify.Config
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	notifier, err := notify.New(config)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value := 42.0
+	err = notifier.Notify(r.Context(), notify.Notification{
+		Title:      "Edge Insights test notification",
+		Message:    "This is a test alert sent from the notifier configuration endpoint.",
+		Severity:   notify.SeverityInfo,
+		Source:     "notify-test",
+		DedupKey:   "edge-insights-test",
+		DeviceID:   "test_device",
+		DeviceType: "temperature_sensor",
+		Value:      &value,
+		Unit:       "celsius",
+		Time:       time.Now(),
+	})
+	if err != nil {
+		httpError(w, r, "Notification failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "sent",
+		"type":   config.Type,
+	})
+}
+
+// outgoingWebhooksHandler lists the outgoing webhooks (GET; admin only, as they carry signing secrets)
+func (s *Server) outgoingWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	list := s.hooks.List()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": list,
+		"count":    len(list),
+	})
+}
+
+// saveOutgoingWebhookHandler creates or replaces /api/notify/webhooks/{name} (PUT; admin only)
+func (s *Server) saveOutgoingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var hook hooks.Hook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hook.Name = chi.URLParam(r, "name")
+
+	saved, err := s.hooks.Save(hook)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving outgoing webhook", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// deleteOutgoingWebhookHandler removes /api/notify/webhooks/{name} (DELETE; admin only)
+func (s *Server) deleteOutgoingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.hooks.Delete(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, "Error deleting outgoing webhook", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/longpoll"
+	"edge-insights/internal/types"
+)
+
+// pollLogsHandler is the live feed for clients behind proxies that strip both WebSocket upgrades
+// and SSE (GET /api/logs/poll). It answers with the readings stored after cursor, or holds the
+// request until one arrives or max_wait elapses (default 25s, at most LONGPOLL_MAX_WAIT), then
+// answers with the cursor to poll next. Accepts cursor (omit it on the first poll to start at the
+// newest reading), max_wait (a duration like 25s), limit (default 100, at most 1000) and the
+// device_id, device_type, location and log_type filters of /ws/subscribe. The feed is the last
+// LONGPOLL_BUFFER readings held in memory; reset is true when the cursor fell out of it or came
+// from before a restart, and the page then starts at the oldest reading held
+func (s *Server) pollLogsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cursor := q.Get("cursor")
+	if cursor != "" && !longpoll.ValidCursor(cursor) {
+		httpError(w, r, "cursor must be a cursor returned by an earlier poll", http.StatusBadRequest)
+		return
+	}
+
+	maxWait := getDurationEnv("LONGPOLL_MAX_WAIT", 30*time.Second)
+	wait := min(25*time.Second, maxWait)
+	if v := q.Get("max_wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			httpError(w, r, "max_wait must be a duration like 25s", http.StatusBadRequest)
+			return
+		}
+		wait = min(d, maxWait)
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		limit = min(l, 1000)
+	}
+
+	sub := subscriptionFromQuery(r)
+	page := s.poll.Poll(r.Context(), cursor, sub.Matches, limit, wait)
+	if r.Context().Err() != nil {
+		return // the client is gone
+	}
+
+	readings := page.Readings
+	if readings == nil {
+		readings = []types.LogMessage{}
+	}
+	rows, err := s.redaction.ApplyStructs(roleFromRequest(r), readings)
+	if err != nil {
+		writeError(w, r, "Error redacting polled logs", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"logs":   rows,
+		"count":  len(rows),
+		"cursor": page.Cursor,
+		"reset":  page.Reset,
+	})
+}
@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"edge-insights/internal/poller"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// pollerEndpointsHandler lists (GET) polled endpoints with their polling status
+func (s *Server) pollerEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	endpoints := s.endpoints.List()
+	status := map[string]poller.Status{}
+	if s.poller != nil {
+		status = s.poller.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"endpoints": endpoints,
+		"status":    status,
+		"count":     len(endpoints),
+		"running":   s.poller != nil,
+	})
+}
+
+// savePollerEndpointHandler creates or replaces /api/poller/endpoints/{name} (PUT)
+func (s *Server) savePollerEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	var endpoint poller.Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&endpoint); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	endpoint.Name = chi.URLParam(r, "name")
+
+	saved, err := s.endpoints.Save(endpoint)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving poller endpoint", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.reloadPoller()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// deletePollerEndpointHandler removes /api/poller/endpoints/{name} (DELETE)
+func (s *Server) deletePollerEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.endpoints.Delete(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, "Error deleting poller endpoint", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Poller endpoint not found", http.StatusNotFound)
+		return
+	}
+	s.reloadPoller()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reloadPoller restarts the polling loops after endpoint changes (no-op outside gateway mode)
+func (s *Server) reloadPoller() {
+	if s.poller != nil {
+		go s.poller.Reload()
+	}
+}
@@ -0,0 +1,178 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/ai"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// promptsHandler lists the version of every system prompt the AI endpoints use (GET; admin only)
+func (s *Server) promptsHandler(w http.ResponseWriter, r *http.Request) {
+	prompts, err := s.ai.Prompts().List(r.Context())
+	if err != nil {
+		writeError(w, r, "Error listing prompt templates", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"prompts": prompts,
+		"count":   len(prompts),
+	})
+}
+
+// promptVersionsHandler lists every version of /api/ai/prompts/{name}, built-in first (GET; admin only)
+func (s *Server) promptVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+	versions, err := s.ai.Prompts().Versions(r.Context(), name)
+	if err != nil {
+		writeError(w, r, "Error listing prompt versions", err, "name", name)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":     name,
+		"versions": versions,
+		"active":   s.ai.Prompts().ActiveVersion(name),
+	})
+}
+
+// createPromptHandler stores a new version of /api/ai/prompts/{name} (POST; admin only)
+// Body: {"content": "...", "note": "...", "activate": false}; new versions are active unless activate is false
+func (s *Server) createPromptHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Content  string `json:"content"`
+		Note     string `json:"note"`
+		Activate *bool  `json:"activate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	created, err := s.ai.Prompts().Create(r.Context(), name, req.Content, req.Note, req.Activate == nil || *req.Activate)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving prompt template", "name", name, "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// activatePromptHandler switches /api/ai/prompts/{name} to a version, 0 being the built-in prompt
+// (POST {"version": n}; admin only)
+func (s *Server) activatePromptHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Version *int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version == nil {
+		httpError(w, r, "version is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.ai.Prompts().Activate(r.Context(), name, *req.Version)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error activating prompt template", "name", name, "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !found {
+		httpError(w, r, "Prompt version not found", http.StatusNotFound)
+		return
+	}
+	writePromptActive(w, name, *req.Version)
+}
+
+// rollbackPromptHandler goes back to the version of /api/ai/prompts/{name} before the active one (POST; admin only)
+func (s *Server) rollbackPromptHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+	version, err := s.ai.Prompts().Rollback(r.Context(), name)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error rolling back prompt template", "name", name, "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writePromptActive(w, name, version)
+}
+
+// promptName reads {name}, answering 404 for prompts that are not templates
+func promptName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := chi.URLParam(r, "name")
+	if !ai.KnownPrompt(name) {
+		httpError(w, r, "Unknown prompt "+strconv.Quote(name), http.StatusNotFound)
+		return "", false
+	}
+	return name, true
+}
+
+func writePromptActive(w http.ResponseWriter, name string, version int) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":   name,
+		"active": version,
+	})
+}
+
+// shadowRunsHandler lists recorded comparisons of the live and candidate text-to-SQL runs, newest
+// first, with a summary (GET; admin only). Accepts since (a duration, default 24h) and limit (default 50)
+func (s *Server) shadowRunsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	since := 24 * time.Hour
+	if v := q.Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			httpError(w, r, "since must be a positive duration like 24h", http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			httpError(w, r, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	shadow := s.ai.Shadow()
+	results, summary, err := shadow.Results(r.Context(), time.Now().Add(-since), limit)
+	if err != nil {
+		writeError(w, r, "Failed to load shadow runs", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"config":  shadow.Config(),
+		"summary": summary,
+		"runs":    results,
+		"count":   len(results),
+		"since":   since.String(),
+	})
+}
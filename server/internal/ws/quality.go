@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/quality"
+)
+
+// qualityHandler reports each device's data quality over a window, least trustworthy first (GET)
+// Accepts device_id, device_type, location, window (default QUALITY_WINDOW) and untrusted=true to
+// list only the series scoring below QUALITY_TRUST_SCORE
+func (s *Server) qualityHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := quality.Options{
+		DeviceID:   q.Get("device_id"),
+		DeviceType: q.Get("device_type"),
+		Location:   q.Get("location"),
+		Window:     getDurationEnv("QUALITY_WINDOW", 24*time.Hour),
+		Ranges:     quality.LoadRanges(),
+		MaxSkew:    getDurationEnv("QUALITY_MAX_SKEW", 5*time.Minute),
+		GapFactor:  2,
+		TrustScore: 90,
+	}
+	if f, err := strconv.ParseFloat(getEnv("QUALITY_GAP_FACTOR", ""), 64); err == nil && f >= 1 {
+		opts.GapFactor = f
+	}
+	if f, err := strconv.ParseFloat(getEnv("QUALITY_TRUST_SCORE", ""), 64); err == nil {
+		opts.TrustScore = f
+	}
+	if window := q.Get("window"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			httpError(w, r, "window must be a positive duration like 24h", http.StatusBadRequest)
+			return
+		}
+		opts.Window = d
+	}
+
+	reports, err := quality.Build(r.Context(), s.db, opts)
+	if err != nil {
+		writeError(w, r, "Failed to build data quality report", err)
+		return
+	}
+
+	trusted := 0
+	listed := make([]quality.Report, 0, len(reports))
+	for _, report := range reports {
+		if report.Trusted {
+			trusted++
+			if q.Get("untrusted") == "true" {
+				continue
+			}
+		}
+		listed = append(listed, report)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"devices":     listed,
+		"count":       len(listed),
+		"scored":      len(reports),
+		"trusted":     trusted,
+		"untrusted":   len(reports) - trusted,
+		"window":      opts.Window.String(),
+		"trust_score": opts.TrustScore,
+	})
+}
@@ -0,0 +1,312 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/db"
+	"edge-insights/internal/jobs"
+	"edge-insights/internal/roles"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// jobRange is the time range shared by the range-based job kinds
+type jobRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (r *jobRange) validate() error {
+	if r.End.IsZero() {
+		r.End = time.Now()
+	}
+	if r.Start.IsZero() || !r.Start.Before(r.End) {
+		return fmt.Errorf("start (RFC3339) is required and must be before end")
+	}
+	return nil
+}
+
+// registerQueryJobs wires the job kinds accepted by POST /api/queries
+func (s *Server) registerQueryJobs() {
+	maxRows := getIntEnv("QUERY_JOB_MAX_ROWS", 100000)
+
+	// Raw readings over a long range (exports)
+	s.jobs.Register("readings", func(ctx context.Context, params json.RawMessage) ([]interface{}, error) {
+		var p struct {
+			jobRange
+			db.ReadingFilter
+			Limit int `json:"limit"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if p.Limit <= 0 || p.Limit > maxRows {
+			p.Limit = maxRows
+		}
+		readings, err := db.GetReadingsBetween(ctx, s.db, p.ReadingFilter, p.Start, p.End, p.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return jobRows(readings)
+	})
+
+	// Aggregate buckets over ranges too long for /api/aggregates
+	s.jobs.Register("aggregates", func(ctx context.Context, params json.RawMessage) ([]interface{}, error) {
+		var p struct {
+			jobRange
+			View       string `json:"view"`
+			DeviceType string `json:"device_type"`
+			Location   string `json:"location"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if p.DeviceType == "" {
+			return nil, fmt.Errorf("device_type is required")
+		}
+		if p.View == "" {
+			p.View = "hourly"
+		}
+		buckets, err := db.GetAggregateWindowContext(ctx, s.db, p.View, p.DeviceType, p.Location, p.Start, p.End)
+		if err != nil {
+			return nil, err
+		}
+		return jobRows(buckets)
+	})
+
+	// Reviewed SQL (see /api/ai/sql/execute); the role is checked when the job is submitted
+	s.jobs.Register("sql", func(ctx context.Context, params json.RawMessage) ([]interface{}, error) {
+		var p struct {
+			Query   string `json:"query"`
+			SQL     string `json:"sql"`
+			Confirm bool   `json:"confirm"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		response, err := s.ai.ExecuteApprovedSQL(ctx, p.Query, p.SQL, p.Confirm)
+		if err != nil {
+			return nil, err
+		}
+		result, _ := response.Result.(ai.SQLQueryResponse)
+		if result.RequiresConfirmation || !response.Success {
+			return nil, errors.New(result.Error)
+		}
+		return result.Result, nil
+	})
+
+	// Continuous-aggregate buckets left stale by late or backfilled readings; the rows are the
+	// repaired ranges, so past runs double as the repair report
+	s.jobs.Register("aggregate_repair", func(ctx context.Context, params json.RawMessage) ([]interface{}, error) {
+		p := struct {
+			Lookback string `json:"lookback"`
+			DryRun   bool   `json:"dry_run"`
+		}{Lookback: getDurationEnv("AGGREGATE_REPAIR_LOOKBACK", 7*24*time.Hour).String()}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		lookback, err := time.ParseDuration(p.Lookback)
+		if err != nil || lookback <= 0 {
+			return nil, fmt.Errorf("lookback must be a positive duration like 168h")
+		}
+		repairs, err := db.RepairAggregates(ctx, s.db, lookback, p.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		return jobRows(repairs)
+	})
+
+	// History of the legacy device_logs table copied into sensor_readings, where ingestion and the AI
+	// read; the rows are the copied windows, and rows already copied are skipped on a rerun
+	s.jobs.Register("device_logs_backfill", func(ctx context.Context, params json.RawMessage) ([]interface{}, error) {
+		p := struct {
+			Window string `json:"window"`
+			DryRun bool   `json:"dry_run"`
+		}{Window: "24h"}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		window, err := time.ParseDuration(p.Window)
+		if err != nil || window < time.Minute {
+			return nil, fmt.Errorf("window must be a duration of at least 1m like 24h")
+		}
+		backfills, err := db.BackfillDeviceLogs(ctx, s.db, window, p.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		return jobRows(backfills)
+	})
+}
+
+// backfillDeviceLogs submits a device_logs_backfill job if device_logs has rows that are not in
+// sensor_readings yet
+func (s *Server) backfillDeviceLogs() {
+	pending, err := db.PendingDeviceLogs(context.Background(), s.db)
+	if err != nil {
+		slog.Error("Failed to count legacy device logs", "error", err)
+		return
+	}
+	if pending == 0 {
+		return
+	}
+	job, err := s.jobs.Submit("device_logs_backfill", nil, string(roles.Admin))
+	if err != nil {
+		slog.Error("Failed to submit device logs backfill", "error", err)
+		return
+	}
+	slog.Info("Copying legacy device logs into sensor_readings", "rows", pending, "job_id", job.ID)
+}
+
+// repairAggregatesEvery submits an aggregate_repair job every interval
+func (s *Server) repairAggregatesEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := s.jobs.Submit("aggregate_repair", nil, string(roles.Admin)); err != nil {
+			slog.Error("Failed to submit aggregate repair", "error", err)
+		}
+	}
+}
+
+// jobRows converts typed results into the generic rows stored with a job
+func jobRows(v interface{}) ([]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	rows := []interface{}{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// queriesHandler lists recent query jobs (GET)
+func (s *Server) queriesHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	list, err := s.jobs.List(limit)
+	if err != nil {
+		writeError(w, r, "Error listing query jobs", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":  list,
+		"count": len(list),
+	})
+}
+
+// submitQueryHandler submits an asynchronous query job (POST)
+func (s *Server) submitQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Kind   string          `json:"kind"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !s.jobs.Known(req.Kind) || req.Kind == parquetExportKind {
+		httpError(w, r, "kind must be one of readings, aggregates, sql, aggregate_repair, device_logs_backfill", http.StatusBadRequest)
+		return
+	}
+
+	role := roleFromRequest(r)
+	if req.Kind == "sql" && !ai.Allowed(role, ai.CapabilitySQL) {
+		writeAPIError(w, r, http.StatusForbidden, "insufficient_role", "SQL execution is not available to the "+string(role)+" role", nil)
+		return
+	}
+	if req.Kind == "aggregate_repair" && !role.AtLeast(roles.Operator) {
+		writeAPIError(w, r, http.StatusForbidden, "insufficient_role", "Aggregate repair requires the operator or admin role", nil)
+		return
+	}
+
+	if req.Kind == "device_logs_backfill" && !role.AtLeast(roles.Admin) {
+		writeAPIError(w, r, http.StatusForbidden, "insufficient_role", "Copying device_logs requires the admin role", nil)
+		return
+	}
+
+	job, err := s.jobs.Submit(req.Kind, req.Params, string(role))
+	if err != nil {
+		writeError(w, r, "Error submitting query job", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/queries/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// queryJobHandler returns the status of /api/queries/{id} (GET)
+func (s *Server) queryJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "Query job error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// queryJobResultHandler returns the rows of a finished job, /api/queries/{id}/result (GET)
+func (s *Server) queryJobResultHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	job, err := s.jobs.Get(id)
+	if err != nil {
+		writeError(w, r, "Query job error", err)
+		return
+	}
+	if job.Status != jobs.StatusSucceeded {
+		httpError(w, r, "Job is "+string(job.Status), http.StatusConflict)
+		return
+	}
+	rows, err := s.jobs.Result(id)
+	if err != nil {
+		writeError(w, r, "Query job error", err)
+		return
+	}
+
+	// Results are stored unredacted and masked for whoever fetches them
+	s.redaction.ApplyRows(roleFromRequest(r), rows)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":    id,
+		"kind":  job.Kind,
+		"rows":  rows,
+		"count": len(rows),
+	})
+}
+
+// cancelQueryJobHandler cancels a queued or running job, /api/queries/{id}/cancel (POST)
+func (s *Server) cancelQueryJobHandler(w http.ResponseWriter, r *http.Request) {
+	cancelled, err := s.jobs.Cancel(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "Query job error", err)
+		return
+	}
+	if !cancelled {
+		httpError(w, r, "Job has already finished", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,41 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"edge-insights/internal/querybuilder"
+)
+
+// structuredQueryHandler answers a structured query (POST /api/query): metrics, filters,
+// group_by, start/end and resolution (see querybuilder.Spec). The spec is compiled into SQL over
+// the coarsest continuous aggregate that holds what it asks for, or the raw readings otherwise;
+// the answer names that source. Rows are redacted for the caller's role
+func (s *Server) structuredQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var spec querybuilder.Spec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	query, err := querybuilder.Compile(&spec, time.Now())
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := query.Run(r.Context(), s.db)
+	if err != nil {
+		writeError(w, r, "Error running structured query", err)
+		return
+	}
+	role := roleFromRequest(r)
+	for _, row := range result.Rows {
+		s.redaction.ApplyRow(role, row)
+	}
+	slog.DebugContext(r.Context(), "Structured query", "source", result.Source, "rows", len(result.Rows), "truncated", result.Truncated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/querytrace"
+)
+
+// debugQuery is a traced statement as shown in a response's meta
+type debugQuery struct {
+	querytrace.Query
+	Tables []string `json:"tables"`
+}
+
+// queryDebug adds the SQL behind a JSON object response to its "meta" when the request has
+// debug=true: every statement run with the request's context, in order, with its parameters, the
+// tables it read, its row count and duration. QUERY_DEBUG=false turns the flag off
+func queryDebug(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("debug") != "true" || getEnv("QUERY_DEBUG", "true") != "true" || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, trace := querytrace.Start(r.Context())
+		buffered := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buffered, r.WithContext(ctx))
+
+		body := buffered.body.Bytes()
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			body = withQueryMeta(body, trace.Queries())
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(buffered.status)
+		w.Write(body)
+	})
+}
+
+// withQueryMeta adds the queries to a JSON object's meta; other bodies are returned unchanged
+func withQueryMeta(body []byte, queries []querytrace.Query) []byte {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil || object == nil {
+		return body
+	}
+
+	shown := make([]debugQuery, len(queries))
+	for i, q := range queries {
+		shown[i] = debugQuery{Query: q, Tables: ai.QueryTables(q.SQL)}
+	}
+
+	meta := map[string]interface{}{}
+	if existing, ok := object["meta"]; ok {
+		if err := json.Unmarshal(existing, &meta); err != nil || meta == nil {
+			return body
+		}
+	}
+	meta["queries"] = shown
+	encodedMeta, err := json.Marshal(meta)
+	if err != nil {
+		return body
+	}
+
+	if _, ok := object["meta"]; ok {
+		object["meta"] = encodedMeta
+		merged, err := json.Marshal(object)
+		if err != nil {
+			return body
+		}
+		return append(merged, '\n')
+	}
+	// Splice meta in before the closing brace so the other fields keep their order
+	trimmed := bytes.TrimRight(body, " \r\n\t")
+	trimmed = trimmed[:len(trimmed)-1]
+	if len(object) > 0 {
+		trimmed = append(trimmed, ',')
+	}
+	return append(append(append(trimmed, `"meta":`...), encodedMeta...), "}\n"...)
+}
+
+// bufferedResponse holds a response back so it can be amended before it is sent
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
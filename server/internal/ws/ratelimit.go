@@ -0,0 +1,100 @@
+package ws
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-insights/internal/auth"
+	"edge-insights/internal/devicekeys"
+	"edge-insights/internal/ratelimit"
+)
+
+// rateLimits throttles the most expensive requests per client: /api/ai/* per caller, since each
+// request may reach OpenAI, and POST /api/ingest per device key
+type rateLimits struct {
+	ai            *ratelimit.Limiter // nil when AI_RATE_LIMIT=0
+	ingest        *ratelimit.Limiter
+	ingestDefault ratelimit.Limit // for requests without a key or with a key without its own limit
+	trustProxy    bool            // take the client IP from X-Forwarded-For
+}
+
+func loadRateLimits() *rateLimits {
+	l := &rateLimits{
+		ingest: ratelimit.New(0, 0),
+		ingestDefault: ratelimit.Limit{
+			PerMinute: getIntEnv("INGEST_RATE_LIMIT", 600),
+			Burst:     getIntEnv("INGEST_RATE_BURST", 60),
+		},
+		trustProxy: getEnv("TRUST_PROXY", "false") == "true",
+	}
+	if perMinute := getIntEnv("AI_RATE_LIMIT", 20); perMinute > 0 {
+		l.ai = ratelimit.New(perMinute, getIntEnv("AI_RATE_BURST", 5))
+	}
+	return l
+}
+
+// limitAI refuses callers over AI_RATE_LIMIT requests a minute with 429 and Retry-After
+// Callers are told apart by their token subject, or by IP address without authentication
+func (s *Server) limitAI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.limits.ai == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := "ip:" + clientIP(r, s.limits.trustProxy)
+		if subject, ok := auth.SubjectFromContext(r.Context()); ok {
+			client = "sub:" + subject
+		}
+		if ok, wait := s.limits.ai.Allow(client, time.Now()); !ok {
+			writeRateLimited(w, r, wait, "Too many AI requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowIngest takes a token for an upload from the key's bucket, at the key's own limit when it
+// has one, or from the client IP's bucket without a key; INGEST_RATE_LIMIT=0 only leaves keys
+// with their own limit throttled
+func (l *rateLimits) allowIngest(r *http.Request, key *devicekeys.Key) (bool, time.Duration) {
+	client, limit := "ip:"+clientIP(r, l.trustProxy), l.ingestDefault
+	if key != nil {
+		client = "key:" + key.ID
+		if key.RateLimit > 0 {
+			limit = ratelimit.Limit{PerMinute: key.RateLimit, Burst: key.RateBurst}
+			if limit.Burst == 0 {
+				limit.Burst = l.ingestDefault.Burst
+			}
+		}
+	}
+	if limit.PerMinute <= 0 {
+		return true, 0
+	}
+	return l.ingest.AllowLimit(client, limit, time.Now())
+}
+
+// writeRateLimited answers 429 with Retry-After in whole seconds
+func writeRateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeAPIError(w, r, http.StatusTooManyRequests, "rate_limited", message+"; retry after "+wait.Round(time.Second).String(), nil)
+}
+
+// clientIP is the remote address of a request, or the first X-Forwarded-For entry behind a
+// trusted proxy
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
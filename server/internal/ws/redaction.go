@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"log/slog"
+	"net/http"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/roles"
+	"edge-insights/internal/types"
+)
+
+// roleFromRequest returns the caller's role, falling back to DEFAULT_ROLE when
+// no upstream middleware has attached one to the request context
+func roleFromRequest(r *http.Request) roles.Role {
+	if role, ok := roles.FromContext(r.Context()); ok {
+		return role
+	}
+	if role, ok := roles.Parse(getEnv("DEFAULT_ROLE", string(roles.Admin))); ok {
+		return role
+	}
+	return roles.Viewer
+}
+
+// redactQueryResponse applies the redaction policy to every row-shaped payload an AI response can carry
+func (s *Server) redactQueryResponse(role roles.Role, response *types.QueryResponse) {
+	switch result := response.Result.(type) {
+	case ai.SQLQueryResponse:
+		s.redaction.ApplyRows(role, result.Result)
+		response.Result = result
+	case types.SearchResponse:
+		rows, err := s.redaction.ApplyStructs(role, result.Results)
+		if err != nil {
+			slog.Error("Error redacting search results", "error", err)
+			return
+		}
+		knowledge, err := s.redaction.ApplyStructs(role, result.Knowledge)
+		if err != nil {
+			slog.Error("Error redacting knowledge results", "error", err)
+			return
+		}
+		response.Result = map[string]interface{}{
+			"results":   rows,
+			"count":     result.Count,
+			"query":     result.Query,
+			"knowledge": knowledge,
+		}
+	case types.AnomalyResponse:
+		anomalies := make([]types.Anomaly, len(result.Anomalies))
+		for i, anomaly := range result.Anomalies {
+			if anomaly.Context != nil {
+				alertContext := *anomaly.Context
+				alertContext.RecentReadings = s.redaction.Readings(role, alertContext.RecentReadings)
+				alertContext.RelatedLogs = s.redaction.Readings(role, alertContext.RelatedLogs)
+				anomaly.Context = &alertContext
+			}
+			anomalies[i] = anomaly
+		}
+		result.Anomalies = anomalies
+		response.Result = result
+	case map[string]interface{}:
+		if logs, ok := result["relevant_logs"]; ok {
+			rows, err := s.redaction.ApplyStructs(role, logs)
+			if err != nil {
+				slog.Error("Error redacting relevant logs", "error", err)
+				return
+			}
+			result["relevant_logs"] = rows
+		}
+		if knowledge, ok := result["related_knowledge"]; ok {
+			rows, err := s.redaction.ApplyStructs(role, knowledge)
+			if err != nil {
+				slog.Error("Error redacting related knowledge", "error", err)
+				return
+			}
+			result["related_knowledge"] = rows
+		}
+	}
+}
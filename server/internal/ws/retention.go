@@ -0,0 +1,114 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-insights/internal/db"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// retentionPoliciesHandler lists the retention and compression policies of every hypertable and
+// continuous aggregate (GET /api/admin/retention)
+func (s *Server) retentionPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	policies, err := db.GetRetentionPolicies(r.Context(), s.db)
+	if err != nil {
+		writeError(w, r, "Error listing retention policies", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"policies": policies,
+		"count":    len(policies),
+	})
+}
+
+// setRetentionPolicyHandler changes the policies of a table (PUT /api/admin/retention/{table})
+// Accepts {"retention": "30d", "compress_after": "7d"}: durations in days (30d) or as Go
+// durations (36h); "off" removes the policy and an omitted field leaves it as it is
+func (s *Server) setRetentionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Retention     *string `json:"retention"`
+		CompressAfter *string `json:"compress_after"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var change db.RetentionChange
+	for _, p := range []struct {
+		name   string
+		value  *string
+		target **time.Duration
+	}{{"retention", req.Retention, &change.Retention}, {"compress_after", req.CompressAfter, &change.CompressAfter}} {
+		if p.value == nil {
+			continue
+		}
+		d, err := parsePolicyInterval(*p.value)
+		if err != nil {
+			httpError(w, r, p.name+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		*p.target = &d
+	}
+	if change.Retention == nil && change.CompressAfter == nil {
+		httpError(w, r, "retention or compress_after is required", http.StatusBadRequest)
+		return
+	}
+
+	table := chi.URLParam(r, "table")
+	if err := db.ValidateRetentionChange(table, change); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	policy, ok, err := db.GetRetentionPolicy(r.Context(), s.db, table)
+	if err != nil {
+		writeError(w, r, "Error reading retention policy", err, "table", table)
+		return
+	}
+	if !ok {
+		httpError(w, r, "No hypertable or continuous aggregate named "+table, http.StatusNotFound)
+		return
+	}
+
+	if err := db.SetRetentionPolicy(r.Context(), s.db, policy, change); err != nil {
+		// TimescaleDB refuses policies it cannot apply (e.g. compression on an old version)
+		slog.ErrorContext(r.Context(), "Error setting retention policy", "table", table, "error", err)
+		httpError(w, r, "Failed to set the policies: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	policy, _, err = db.GetRetentionPolicy(r.Context(), s.db, table)
+	if err != nil {
+		writeError(w, r, "Error reading retention policy", err, "table", table)
+		return
+	}
+	slog.InfoContext(r.Context(), "Retention policy changed", "table", table,
+		"retention", policy.Retention, "compress_after", policy.CompressAfter)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// parsePolicyInterval reads a policy interval: "off" (0), days such as 30d, or a Go duration
+func parsePolicyInterval(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if v == "off" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("must be a positive duration like 30d or 36h, or off")
+}
@@ -0,0 +1,192 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"edge-insights/internal/commands"
+	"edge-insights/internal/devices"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// rolloutsHandler lists command rollouts, newest first (GET)
+// Accepts status (running, paused, completed, cancelled) and limit (default 50, max 500)
+func (s *Server) rolloutsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := commands.RolloutStatus(q.Get("status"))
+	switch status {
+	case "", commands.RolloutRunning, commands.RolloutPaused, commands.RolloutCompleted, commands.RolloutCancelled:
+	default:
+		httpError(w, r, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			httpError(w, r, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	list, err := s.rollouts.List(r.Context(), status, limit)
+	if err != nil {
+		writeError(w, r, "Error listing command rollouts", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rollouts": list,
+		"count":    len(list),
+	})
+}
+
+// createRolloutRequest is the body of POST /api/commands/rollouts
+type createRolloutRequest struct {
+	Command          string                 `json:"command"`
+	Params           map[string]interface{} `json:"params"`
+	Target           commands.Target        `json:"target"`
+	Stages           []int                  `json:"stages"`            // default [10, 50, 100]
+	FailureThreshold *float64               `json:"failure_threshold"` // default 0.1
+	StageTimeout     string                 `json:"stage_timeout"`     // default 1h
+}
+
+// createRolloutHandler starts sending a command to a group of devices in stages (POST; admin)
+// The group is target.device_ids, or the active registered devices matching target.device_type
+// and/or target.location; it is fixed when the rollout starts
+func (s *Server) createRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	var req createRolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	group, err := s.rolloutDevices(req.Target)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	threshold := commands.DefaultFailureThreshold
+	if req.FailureThreshold != nil {
+		threshold = *req.FailureThreshold
+	}
+	issuedBy, role := commandIssuer(r)
+
+	rollout, err := s.rollouts.Create(r.Context(), commands.Rollout{
+		Command:          req.Command,
+		Params:           req.Params,
+		Target:           req.Target,
+		Devices:          group,
+		Stages:           req.Stages,
+		FailureThreshold: threshold,
+		StageTimeout:     req.StageTimeout,
+		IssuedBy:         issuedBy,
+		IssuerRole:       role,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating command rollout", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	slog.InfoContext(r.Context(), "Command rollout started", "rollout_id", rollout.ID, "command", rollout.Command,
+		"devices", len(rollout.Devices), "stages", rollout.Stages, "issued_by", issuedBy, "role", role)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rollout)
+}
+
+// rolloutDevices resolves a rollout target to device IDs
+func (s *Server) rolloutDevices(target commands.Target) ([]string, error) {
+	if len(target.DeviceIDs) > 0 {
+		if target.DeviceType != "" || target.Location != "" {
+			return nil, errors.New("target takes device_ids or device_type/location, not both")
+		}
+		seen := make(map[string]bool, len(target.DeviceIDs))
+		var ids []string
+		for _, id := range target.DeviceIDs {
+			if id == "" || seen[id] {
+				continue
+			}
+			if d, ok := s.registry.Get(id); ok && !d.Active() {
+				return nil, errors.New("device " + id + " is decommissioned")
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+	if target.DeviceType == "" && target.Location == "" {
+		return nil, errors.New("target needs device_ids, device_type or location")
+	}
+
+	var ids []string
+	for _, d := range s.registry.List(devices.Filter{Type: target.DeviceType, Location: target.Location}) {
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
+}
+
+// rolloutHandler returns /api/commands/rollouts/{id} with the progress of each stage (GET)
+func (s *Server) rolloutHandler(w http.ResponseWriter, r *http.Request) {
+	rollout, err := s.rollouts.Get(r.Context(), chi.URLParam(r, "id"))
+	s.writeRollout(w, r, rollout, err)
+}
+
+// pauseRolloutHandler stops /api/commands/rollouts/{id} from issuing further stages (POST; admin)
+// Accepts an optional {"reason": "..."}
+func (s *Server) pauseRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "paused by " + rolloutActor(r)
+	}
+	rollout, err := s.rollouts.Pause(r.Context(), chi.URLParam(r, "id"), req.Reason)
+	s.writeRollout(w, r, rollout, err)
+}
+
+// resumeRolloutHandler runs a paused rollout again, accepting the failures of its current stage (POST; admin)
+func (s *Server) resumeRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	rollout, err := s.rollouts.Resume(r.Context(), chi.URLParam(r, "id"))
+	if err == nil {
+		slog.InfoContext(r.Context(), "Command rollout resumed", "rollout_id", rollout.ID, "stage", rollout.Stage, "by", rolloutActor(r))
+	}
+	s.writeRollout(w, r, rollout, err)
+}
+
+// cancelRolloutHandler stops a rollout and withdraws its undelivered commands (POST; admin)
+func (s *Server) cancelRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	rollout, err := s.rollouts.Cancel(r.Context(), chi.URLParam(r, "id"))
+	if err == nil {
+		slog.InfoContext(r.Context(), "Command rollout cancelled", "rollout_id", rollout.ID, "stage", rollout.Stage, "by", rolloutActor(r))
+	}
+	s.writeRollout(w, r, rollout, err)
+}
+
+func rolloutActor(r *http.Request) string {
+	subject, role := commandIssuer(r)
+	return subject + " (" + role + ")"
+}
+
+// writeRollout answers with a rollout, or with the status of err's kind
+func (s *Server) writeRollout(w http.ResponseWriter, r *http.Request, rollout *commands.Rollout, err error) {
+	if err != nil {
+		writeError(w, r, "Error updating command rollout", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rollout)
+}
@@ -0,0 +1,225 @@
+package ws
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"edge-insights/internal/types"
+)
+
+// Sampling modes of the live feed
+const (
+	sampleOneInN = "sample" // forward one log entry in every FEED_SAMPLE_EVERY per device
+	sampleRollup = "rollup" // replace log entries by one log_rollup per device, log type and second
+)
+
+// feedSampler thins the log entries broadcast to live-feed clients while ingestion is busier
+// than a browser can render. Entries are counted per second; while the last second had more than
+// the threshold, entries of the always-forwarded log types still go out one by one and the rest
+// are sampled or rolled up. It decides for all clients at once, before the entries are encoded
+type feedSampler struct {
+	mode      string
+	threshold int64           // log entries per second that turn sampling on; 0 disables it
+	every     int64           // sample mode: one entry in every per device is forwarded
+	always    map[string]bool // log types never sampled, upper case
+
+	mu      sync.Mutex
+	second  int64 // unix second being counted
+	count   int64 // log entries counted in it
+	rate    int64 // log entries in the last complete second
+	active  bool
+	seen    map[string]int64      // sample mode: entries per device since sampling began
+	pending map[string]*rollupAcc // rollup mode: entries of the current second
+
+	sampled atomic.Int64 // entries not forwarded one by one
+	rollups atomic.Int64 // log_rollup events published
+}
+
+// rollupAcc accumulates a LogRollup
+type rollupAcc struct {
+	types.LogRollup
+	sum    float64
+	values int
+}
+
+// SamplingStats is the state of live-feed sampling
+type SamplingStats struct {
+	Mode      string `json:"mode"`
+	Threshold int64  `json:"threshold"` // 0: sampling is disabled
+	Active    bool   `json:"active"`
+	Rate      int64  `json:"rate"`    // log entries in the last complete second
+	Sampled   int64  `json:"sampled"` // log entries not forwarded one by one since startup
+	Rollups   int64  `json:"rollups"` // log_rollup events published since startup
+}
+
+// newFeedSampler reads FEED_SAMPLE_THRESHOLD (default 500 log entries per second, 0 disables
+// sampling), FEED_SAMPLE_MODE (sample or rollup, default sample), FEED_SAMPLE_EVERY (default 10)
+// and FEED_SAMPLE_ALWAYS (log types never sampled, default ERROR,CRITICAL)
+func newFeedSampler() *feedSampler {
+	f := &feedSampler{
+		mode:      getEnv("FEED_SAMPLE_MODE", sampleOneInN),
+		threshold: int64(getIntEnv("FEED_SAMPLE_THRESHOLD", 500)),
+		every:     int64(getIntEnv("FEED_SAMPLE_EVERY", 10)),
+		always:    make(map[string]bool),
+		seen:      make(map[string]int64),
+		pending:   make(map[string]*rollupAcc),
+	}
+	if f.mode != sampleOneInN && f.mode != sampleRollup {
+		slog.Warn("Unknown FEED_SAMPLE_MODE, sampling one in N", "mode", f.mode)
+		f.mode = sampleOneInN
+	}
+	if f.every < 1 {
+		f.every = 1
+	}
+	for _, logType := range strings.Split(getEnv("FEED_SAMPLE_ALWAYS", "ERROR,CRITICAL"), ",") {
+		if logType = strings.TrimSpace(logType); logType != "" {
+			f.always[strings.ToUpper(logType)] = true
+		}
+	}
+	return f
+}
+
+// admit counts a log entry and reports whether it is broadcast on its own
+func (f *feedSampler) admit(msg types.LogMessage, now time.Time) bool {
+	if f.threshold <= 0 {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advance(now.Unix())
+	f.count++
+	if !f.active || f.always[strings.ToUpper(msg.LogType)] {
+		return true
+	}
+
+	if f.mode == sampleRollup {
+		f.addRollup(msg)
+		f.sampled.Add(1)
+		return false
+	}
+	n := f.seen[msg.DeviceID]
+	f.seen[msg.DeviceID] = n + 1
+	if n%f.every == 0 {
+		return true
+	}
+	f.sampled.Add(1)
+	return false
+}
+
+// advance moves the count to second; sampling in it follows the rate of the one before, and a
+// gap means the feed was quiet
+func (f *feedSampler) advance(second int64) {
+	if second == f.second {
+		return
+	}
+	f.rate = 0
+	if second == f.second+1 {
+		f.rate = f.count
+	}
+	wasActive := f.active
+	f.active = f.rate > f.threshold
+	if f.active != wasActive {
+		slog.Info("Live feed sampling changed", "active", f.active, "mode", f.mode, "rate", f.rate, "threshold", f.threshold)
+	}
+	if !f.active {
+		clear(f.seen)
+	}
+	f.second, f.count = second, 0
+}
+
+func (f *feedSampler) addRollup(msg types.LogMessage) {
+	key := msg.DeviceID + "\x00" + msg.LogType
+	acc, ok := f.pending[key]
+	if !ok {
+		acc = &rollupAcc{LogRollup: types.LogRollup{
+			DeviceID:   msg.DeviceID,
+			DeviceType: msg.DeviceType,
+			Location:   msg.Location,
+			LogType:    msg.LogType,
+			Start:      msg.Time,
+		}}
+		f.pending[key] = acc
+	}
+	acc.Count++
+	acc.End, acc.Message = msg.Time, msg.Message
+	if msg.Unit != "" {
+		acc.Unit = msg.Unit
+	}
+	if msg.RawValue != nil {
+		v := *msg.RawValue
+		if acc.values == 0 || v < *acc.Min {
+			acc.Min = &v
+		}
+		if acc.values == 0 || v > *acc.Max {
+			acc.Max = &v
+		}
+		acc.sum += v
+		acc.values++
+	}
+}
+
+// flush returns the rollups accumulated since the last flush
+func (f *feedSampler) flush() []types.LogRollup {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rollups := make([]types.LogRollup, 0, len(f.pending))
+	for key, acc := range f.pending {
+		if acc.values > 0 {
+			avg := acc.sum / float64(acc.values)
+			acc.Avg = &avg
+		}
+		rollups = append(rollups, acc.LogRollup)
+		delete(f.pending, key)
+	}
+	return rollups
+}
+
+// current is the sampling in effect, "" when log entries are forwarded one by one
+func (f *feedSampler) current() string {
+	if f.threshold <= 0 {
+		return ""
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advance(time.Now().Unix())
+	if !f.active {
+		return ""
+	}
+	return f.mode
+}
+
+func (f *feedSampler) stats() SamplingStats {
+	stats := SamplingStats{
+		Mode:      f.mode,
+		Threshold: f.threshold,
+		Sampled:   f.sampled.Load(),
+		Rollups:   f.rollups.Load(),
+	}
+	if f.threshold > 0 {
+		f.mu.Lock()
+		f.advance(time.Now().Unix())
+		stats.Active, stats.Rate = f.active, f.rate
+		f.mu.Unlock()
+	}
+	return stats
+}
+
+// publishRollups broadcasts the rolled-up log entries once per second, filtered like the
+// entries they stand for
+func (h *Handler) publishRollups() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, rollup := range h.sampler.flush() {
+			msg := types.LogMessage{DeviceID: rollup.DeviceID, DeviceType: rollup.DeviceType, Location: rollup.Location, LogType: rollup.LogType}
+			h.broadcastMatching(types.NewEvent(types.EventLogRollup, rollup), func(sub types.Subscription) bool {
+				return sub.Matches(msg)
+			})
+			h.sampler.rollups.Add(1)
+		}
+	}
+}
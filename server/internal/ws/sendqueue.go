@@ -0,0 +1,201 @@
+package ws
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"edge-insights/internal/types"
+
+	"github.com/gorilla/websocket"
+)
+
+// coalescedEvents only matter in their latest version: a queued one is replaced by the next
+var coalescedEvents = map[types.EventType]bool{
+	types.EventRealtimeMetrics: true,
+	types.EventHeartbeat:       true,
+}
+
+// frame is one encoded event waiting to be written to a client
+type frame struct {
+	kind types.EventType
+	data []byte
+}
+
+// sendQueue holds the broadcasts a live-feed client has not been written yet. Broadcasts only
+// append to it, so a slow client delays nobody but itself: when the queue is full its oldest
+// log_entry is dropped (its oldest frame when it holds none)
+type sendQueue struct {
+	mu      sync.Mutex
+	frames  []frame
+	max     int
+	wake    chan struct{} // signalled when frames are added
+	done    chan struct{} // closed when the client is removed
+	dropped atomic.Int64
+	warned  bool // the first drop is logged
+}
+
+func newSendQueue(max int) *sendQueue {
+	return &sendQueue{max: max, wake: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// broadcastStats counts what happened to broadcast frames since startup
+type broadcastStats struct {
+	queued    atomic.Int64
+	sent      atomic.Int64
+	dropped   atomic.Int64
+	coalesced atomic.Int64
+}
+
+// FeedStats is the state of the live-feed send queues
+type FeedStats struct {
+	Clients   int           `json:"clients"`
+	Queued    int           `json:"queued"`    // frames waiting in all queues
+	Broadcast int64         `json:"broadcast"` // frames queued to clients since startup
+	Sent      int64         `json:"sent"`      // frames written since startup
+	Dropped   int64         `json:"dropped"`   // frames dropped for slow clients since startup
+	Coalesced int64         `json:"coalesced"` // frames replaced by a newer one of the same type since startup
+	Lagging   []ClientQueue `json:"lagging"`   // clients with frames waiting or dropped
+	Sampling  SamplingStats `json:"sampling"`
+}
+
+// ClientQueue is the send queue of one client
+type ClientQueue struct {
+	ConnID  string `json:"conn_id"`
+	Queued  int    `json:"queued"`
+	Dropped int64  `json:"dropped"`
+}
+
+// enqueue adds an encoded event to the client's queue without blocking
+func (h *Handler) enqueue(c *feedClient, kind types.EventType, data []byte) {
+	q := c.queue
+	q.mu.Lock()
+	coalesced, dropped := false, false
+	if coalescedEvents[kind] {
+		for i := range q.frames {
+			if q.frames[i].kind == kind {
+				q.frames[i].data = data
+				coalesced = true
+				break
+			}
+		}
+	}
+	if !coalesced {
+		if len(q.frames) >= q.max {
+			q.dropOldest()
+			dropped = true
+		}
+		q.frames = append(q.frames, frame{kind: kind, data: data})
+	}
+	warn := dropped && !q.warned
+	if warn {
+		q.warned = true
+	}
+	q.mu.Unlock()
+
+	h.broadcasts.queued.Add(1)
+	switch {
+	case coalesced:
+		h.broadcasts.coalesced.Add(1)
+	case dropped:
+		q.dropped.Add(1)
+		h.broadcasts.dropped.Add(1)
+	}
+	if warn {
+		slog.Warn("Live feed client too slow, dropping broadcasts", "conn_id", c.id, "queue", q.max)
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dropOldest removes the oldest log_entry, or the oldest frame when none is queued
+func (q *sendQueue) dropOldest() {
+	i := 0
+	for j, f := range q.frames {
+		if f.kind == types.EventLogEntry {
+			i = j
+			break
+		}
+	}
+	q.frames = append(q.frames[:i], q.frames[i+1:]...)
+}
+
+func (q *sendQueue) take() []frame {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	frames := q.frames
+	q.frames = nil
+	return frames
+}
+
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.frames)
+}
+
+// writeBroadcasts writes a client's queued broadcasts until it is removed. A write that fails or
+// exceeds WS_WRITE_TIMEOUT closes the connection, which ends its read loop and removes it
+func (h *Handler) writeBroadcasts(c *feedClient) {
+	for {
+		select {
+		case <-c.queue.done:
+			return
+		case <-c.queue.wake:
+		}
+		for _, f := range c.queue.take() {
+			if err := c.write(func(conn *websocket.Conn) error {
+				return conn.WriteMessage(websocket.TextMessage, f.data)
+			}); err != nil {
+				slog.Error("Error broadcasting to client", "conn_id", c.id, "error", err)
+				c.conn.Close()
+				return
+			}
+			h.broadcasts.sent.Add(1)
+		}
+	}
+}
+
+// write runs fn with the client's connection as its only writer, within the write timeout
+func (c *feedClient) write(fn func(*websocket.Conn) error) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	return fn(c.conn)
+}
+
+// WriteJSON writes a response to the client, serialized with its broadcasts
+func (c *feedClient) WriteJSON(v interface{}) error {
+	return c.write(func(conn *websocket.Conn) error {
+		return conn.WriteJSON(v)
+	})
+}
+
+// FeedStats reports the live-feed send queues
+func (h *Handler) FeedStats() FeedStats {
+	h.clientsMutex.RLock()
+	defer h.clientsMutex.RUnlock()
+
+	stats := FeedStats{
+		Clients:   len(h.clients),
+		Broadcast: h.broadcasts.queued.Load(),
+		Sent:      h.broadcasts.sent.Load(),
+		Dropped:   h.broadcasts.dropped.Load(),
+		Coalesced: h.broadcasts.coalesced.Load(),
+		Lagging:   []ClientQueue{},
+		Sampling:  h.sampler.stats(),
+	}
+	for _, c := range h.clients {
+		queued, dropped := c.queue.len(), c.queue.dropped.Load()
+		stats.Queued += queued
+		if queued > 0 || dropped > 0 {
+			stats.Lagging = append(stats.Lagging, ClientQueue{ConnID: c.id, Queued: queued, Dropped: dropped})
+		}
+	}
+	return stats
+}
@@ -3,111 +3,629 @@ package ws
 import (
 	"database/sql"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"edge-insights/internal/ai"
+	"edge-insights/internal/alerts"
+	"edge-insights/internal/archive"
+	"edge-insights/internal/auth"
+	"edge-insights/internal/commands"
 	"edge-insights/internal/db"
+	"edge-insights/internal/devicekeys"
+	"edge-insights/internal/devices"
+	"edge-insights/internal/dlq"
+	"edge-insights/internal/export"
+	"edge-insights/internal/facets"
+	"edge-insights/internal/hooks"
+	"edge-insights/internal/incidents"
+	"edge-insights/internal/influx"
+	"edge-insights/internal/ingest/decoder"
+	"edge-insights/internal/ingest/email"
+	mqttingest "edge-insights/internal/ingest/mqtt"
+	"edge-insights/internal/ingest/syslog"
+	"edge-insights/internal/ingest/webhook"
+	"edge-insights/internal/jobs"
+	"edge-insights/internal/logtemplate"
+	"edge-insights/internal/longpoll"
+	"edge-insights/internal/poller"
+	"edge-insights/internal/realtime"
+	"edge-insights/internal/redact"
+	"edge-insights/internal/share"
+	"edge-insights/internal/slack"
+	"edge-insights/internal/slo"
+	"edge-insights/internal/timerange"
 	"edge-insights/internal/types"
+	"edge-insights/internal/vitals"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Server struct {
-	db      *sql.DB
-	port    string
-	handler *Handler
-	ai      *ai.AIService
+	db         *sql.DB
+	pool       *pgxpool.Pool
+	port       string
+	handler    *Handler
+	ai         *ai.AIService
+	redaction  *redact.Policy
+	config     *archive.Registry
+	webhooks   *webhook.Store
+	decoders   *decoder.Store
+	endpoints  *poller.Store
+	poller     *poller.Poller
+	syslog     *syslog.Store
+	mqtt       *mqttingest.Bridge
+	email      *email.Store
+	shares     *share.Store
+	deviceKeys *devicekeys.Store
+	registry   *devices.Store
+	commands   *commands.Store
+	deadQueue  *dlq.Queue
+	rollouts   *commands.Rollouts
+	vitals     *vitals.Tracker
+	templates  *logtemplate.Rollup
+	facets     *facets.Catalog
+	poll       *longpoll.Buffer
+	incidents  *incidents.Correlator
+	hooks      *hooks.Store
+	slos       *slo.Tracker
+	alerts     *alerts.Engine
+	jobs       *jobs.Manager
+	exporter   *export.Exporter
+	inflight   *inflightRequests
+	charts     *slack.ChartStore
+	summaries  *ai.SummaryScheduler
+	verifier   *auth.Verifier // nil when /api is not authenticated
+	authErr    error          // invalid token settings; /api then refuses every request
+	limits     *rateLimits
+	demo       *demoConfig // nil unless DEMO_MODE=true
 }
 
 func NewServer(db *sql.DB) *Server {
-	port := getEnv("SERVER_PORT", "8080")
-	return &Server{
-		db:      db,
-		port:    port,
-		handler: NewHandler(db),
-		ai:      ai.NewAIService(db),
+	if demoMode() {
+		// A public demo never calls OpenAI: data questions are answered from prepared SQL
+		answers, err := ai.LoadDemoAnswers()
+		if err != nil {
+			slog.Error("Failed to load demo answers, using the built-in ones", "error", err)
+			answers = ai.DefaultDemoAnswers
+		}
+		return NewServerWithAI(db, ai.NewDemoAIService(db, answers))
 	}
+	return NewServerWithAI(db, ai.NewAIService(db))
 }
 
+// NewServerWithAI creates a server around an existing AI service
+// Tests use it to inject a service built on fake LLM/embedding clients
+func NewServerWithAI(db *sql.DB, aiService *ai.AIService) *Server {
+	port := getEnv("SERVER_PORT", "8080")
+	s := &Server{
+		db:        db,
+		port:      port,
+		handler:   NewHandler(db),
+		ai:        aiService,
+		redaction: redact.LoadPolicy(),
+		config:    archive.NewRegistry(),
+		charts:    slack.NewChartStore(time.Hour),
+		inflight:  newInflightRequests(),
+	}
+
+	// Bearer tokens on /api/* (AUTH_JWT_SECRET or AUTH_JWT_PUBLIC_KEY_FILE)
+	authConfig, err := auth.LoadConfig()
+	switch {
+	case err != nil:
+		slog.Error("Invalid JWT settings, refusing API requests", "error", err)
+		s.authErr = err
+	case authConfig.Enabled():
+		s.verifier = auth.NewVerifier(authConfig)
+	default:
+		slog.Warn("AUTH_JWT_SECRET and AUTH_JWT_PUBLIC_KEY_FILE are not set; the API is not authenticated")
+	}
+
+	webhooks, err := webhook.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load webhook mappings", "error", err)
+	}
+	s.webhooks = webhooks
+
+	decoders, err := decoder.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load decoder profiles", "error", err)
+	}
+	s.decoders = decoders
+
+	endpoints, err := poller.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load poller endpoints", "error", err)
+	}
+	s.endpoints = endpoints
+
+	syslogSources, err := syslog.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load syslog sources", "error", err)
+	}
+	s.syslog = syslogSources
+
+	emailRules, err := email.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load email rules", "error", err)
+	}
+	s.email = emailRules
+
+	shares, err := share.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load share links", "error", err)
+	}
+	s.shares = shares
+
+	deviceKeys, err := devicekeys.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load device API keys", "error", err)
+	}
+	s.deviceKeys = deviceKeys
+	// Devices must authenticate before their logs are accepted on /ws
+	// A demo only stores its simulated readings, so no key is accepted there (keys cannot be created)
+	if getEnv("DEVICE_AUTH_REQUIRED", "false") == "true" || demoMode() {
+		s.handler.RequireAPIKeys(deviceKeys)
+	}
+	s.handler.UseRedaction(s.redaction)
+	s.limits = loadRateLimits()
+	if demoMode() {
+		s.demo = loadDemoConfig()
+		slog.Warn("Demo mode: serving simulated readings read-only with rate limits")
+	}
+
+	registry, err := devices.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load device registry", "error", err)
+	}
+	s.registry = registry
+	// Readings from unregistered devices are stored (allow), auto-registered (register) or refused (reject)
+	policy, ok := devices.ParsePolicy(getEnv("UNKNOWN_DEVICE_POLICY", string(devices.PolicyAllow)))
+	if !ok {
+		slog.Warn("Invalid UNKNOWN_DEVICE_POLICY", "using", devices.PolicyAllow)
+		policy = devices.PolicyAllow
+	}
+	s.handler.UseDeviceRegistry(registry, policy)
+
+	deviceCommands, err := commands.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load device commands", "error", err)
+	}
+	s.commands = deviceCommands
+	s.handler.UseCommands(deviceCommands)
+	s.rollouts = commands.NewRollouts(db, deviceCommands)
+
+	// Readings the database fails to store are kept on disk and retried instead of dropped
+	if getEnv("DLQ_ENABLED", "true") != "false" {
+		deadLetters, err := dlq.Open(getEnv("DLQ_DIR", "dlq"), getIntEnv("DLQ_MAX_ENTRIES", 100000))
+		if err != nil {
+			slog.Error("Failed to open the dead-letter queue", "error", err)
+		} else {
+			s.deadQueue = deadLetters
+			s.handler.UseDeadLetters(deadLetters)
+		}
+	}
+
+	vitalsTracker, err := vitals.NewTracker(db)
+	if err != nil {
+		slog.Error("Failed to load device vitals", "error", err)
+	}
+	s.vitals = vitalsTracker
+	s.startVitals()
+
+	// Daily counts of each device's message templates, for dashboards and log summaries
+	templates, err := logtemplate.NewRollup(db)
+	if err != nil {
+		slog.Error("Failed to load message templates", "error", err)
+	}
+	s.templates = templates
+	s.handler.OnStored(templates.Observe)
+
+	// Distinct values and counts behind the dashboard's filter dropdowns
+	s.facets = facets.NewCatalog(db)
+	s.handler.OnStored(s.facets.Observe)
+
+	// Recent readings for clients that follow the live feed by long polling
+	s.poll = longpoll.NewBuffer(getIntEnv("LONGPOLL_BUFFER", 10000))
+	s.handler.OnStored(s.poll.Publish)
+
+	// Related alerts and anomalies are grouped into incidents
+	correlator, err := incidents.NewCorrelator(db, getDurationEnv("INCIDENT_WINDOW", 15*time.Minute))
+	if err != nil {
+		slog.Error("Failed to load incidents", "error", err)
+	}
+	s.incidents = correlator
+	s.startIncidents()
+
+	// Rule alerts and new anomalies are posted to the outgoing webhooks
+	outgoing, err := hooks.NewStore(db)
+	if err != nil {
+		slog.Error("Failed to load outgoing webhooks", "error", err)
+	}
+	s.hooks = outgoing
+
+	// Threshold rules evaluated on every stored reading
+	alertEngine, err := alerts.NewEngine(db)
+	if err != nil {
+		slog.Error("Failed to load alert rules", "error", err)
+	}
+	s.alerts = alertEngine
+	s.startAlerts()
+
+	// Error budgets of the fleet's delivery and error-log objectives
+	sloTracker, err := slo.NewTracker(db)
+	if err != nil {
+		slog.Error("Failed to load SLOs", "error", err)
+	}
+	s.slos = sloTracker
+	s.startSLOs()
+
+	// System prompts are versioned templates editable through /api/ai/prompts
+	prompts, err := ai.NewPromptStore(db)
+	if err != nil {
+		slog.Error("Failed to load prompt templates", "error", err)
+	}
+	aiService.UsePrompts(prompts)
+	// Log summaries written on AI_SUMMARY_SCHEDULES
+	s.summaries = ai.NewSummaryScheduler(aiService, db)
+
+	queryJobs, err := jobs.NewManager(db,
+		getIntEnv("QUERY_JOB_WORKERS", 2),
+		getDurationEnv("QUERY_JOB_TIMEOUT", 30*time.Minute),
+		getDurationEnv("QUERY_JOB_RETENTION", 24*time.Hour))
+	if err != nil {
+		slog.Error("Failed to recover query jobs", "error", err)
+	}
+	s.jobs = queryJobs
+	s.registerQueryJobs()
+	// Parquet exports of readings for offline analytics, run as query jobs
+	s.exporter = export.NewExporter(db)
+	s.registerExportJobs()
+
+	// Gateway mode polls Modbus/OPC-UA equipment that cannot push readings itself
+	if getEnv("POLLER_ENABLED", "false") == "true" {
+		s.poller = poller.New(endpoints, s.handler.Ingest)
+	}
+
+	s.registerConfigSections()
+	return s
+}
 
 func enableCORS(w http.ResponseWriter, r *http.Request) {
-    // Get allowed origins from environment variable
-    allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
-    
-    if allowedOrigins == "" {
-        // Default to localhost for development
-        allowedOrigins = "http://localhost:3000,http://localhost:3001"
-    }
-    
-    // Parse the origins string (comma-separated)
-    origins := strings.Split(allowedOrigins, ",")
-    
-    // Get the requesting origin
-    origin := r.Header.Get("Origin")
-    
-    // Check if the requesting origin is in our allowed list
-    for _, allowedOrigin := range origins {
-        if strings.TrimSpace(allowedOrigin) == origin {
-            w.Header().Set("Access-Control-Allow-Origin", origin)
-            break
-        }
-    }
-    
-    w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-    w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-    w.Header().Set("Access-Control-Allow-Credentials", "true")
+	// Get allowed origins from environment variable
+	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
+
+	if allowedOrigins == "" {
+		// Default to localhost for development
+		allowedOrigins = "http://localhost:3000,http://localhost:3001"
+	}
+
+	// Parse the origins string (comma-separated)
+	origins := strings.Split(allowedOrigins, ",")
+
+	// Get the requesting origin
+	origin := r.Header.Get("Origin")
+
+	// Check if the requesting origin is in our allowed list
+	for _, allowedOrigin := range origins {
+		if strings.TrimSpace(allowedOrigin) == origin {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			break
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, X-API-Key")
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
 }
 
-//CORS middleware wrapper - handles all requests
-func corsMiddleware(handler func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
-    return func(w http.ResponseWriter, r *http.Request) {
-        // Handle preflight OPTIONS request
-        if r.Method == "OPTIONS" {
-            enableCORS(w, r)
-            w.WriteHeader(http.StatusOK)
-            return
-        }
-
-        // Enable CORS for all requests (GET, POST, etc.)
-        enableCORS(w, r)
-        
-        // Call the actual handler
-        handler(w, r)
-    }
+// cors adds the CORS headers to every response and answers preflight OPTIONS requests itself
+// It runs before routing, so preflights never reach the per-route method checks
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enableCORS(w, r)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
+// Routes builds the HTTP handler with every endpoint registered
+// Start serves it on the configured port; tests can mount it on an httptest.Server
+// Each route accepts only its methods (others get 405) and path parameters such as {id}
+// are read with chi.URLParam; debug=true on any request adds the SQL it ran to the response meta
+func (s *Server) Routes() http.Handler {
+	r := chi.NewRouter()
+	r.Use(requestLog, cors, s.demoGuard, s.authenticate, authorize, queryDebug, aiLanguage)
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed)
+
+	// WebSocket endpoints: ingestion plus live feed, and the read-only filtered feed for dashboards
+	r.With(s.authenticateFeed(true)).Get("/ws", s.handler.HandleWebSocket)
+	r.With(s.authenticateFeed(false)).Get("/ws/subscribe", s.handler.HandleSubscribe)
+
+	// Health check endpoint
+	r.Get("/health", s.healthHandler)
+	// Whether this is a public demo, its rate limits and example questions
+	r.Get("/api/demo", s.demoHandler)
+	// Connection pool stats and write latency histograms for Prometheus
+	r.Get("/metrics", s.metricsHandler)
+	// Write latency and errors per table, and pool usage, as JSON
+	r.Get("/api/stats", s.statsHandler)
+
+	// Log viewing endpoints
+	r.Get("/api/logs", s.logsHandler)
+	r.Get("/api/logs/device/{id}", s.deviceLogsHandler)
+	r.With(s.cancellable).Get("/api/logs/export", s.exportLogsHandler)
+	r.Get("/api/logs/poll", s.pollLogsHandler)
+	r.With(s.cancellable).Get("/api/logs/templates", s.messageTemplatesHandler)
+	r.With(s.cancellable).Get("/api/meta/values", s.metaValuesHandler)
+	r.Get("/api/meta/device-types", s.deviceTypesHandler)
+
+	// Sub-5-minute metrics served from the in-memory aggregator
+	r.Get("/api/metrics/realtime", s.realtimeMetricsHandler)
+	r.With(s.cancellable).Get("/api/aggregates", s.aggregatesHandler)
+	r.With(s.cancellable).Post("/api/query", s.structuredQueryHandler)
+	// Irregular-sampling-aware analytics over raw readings
+	r.Route("/api/analytics", func(r chi.Router) {
+		r.Use(s.cancellable)
+		r.Get("/time-weighted", s.timeWeightedHandler)
+		r.Get("/counter", s.counterHandler)
+		r.Get("/state", s.stateHandler)
+		r.Get("/ingest-delay", s.ingestDelayHandler)
+	})
+	// Two devices' readings side by side, to check a suspect sensor against its neighbor
+	r.With(s.cancellable).Get("/api/compare", s.compareHandler)
+	// Everything a location's dashboard shows, queried concurrently
+	r.With(s.cancellable).Get("/api/locations/{location}/dashboard", s.locationDashboardHandler)
+	// Per-device data quality: missing readings, out-of-range values, duplicates and clock skew
+	r.With(s.cancellable).Get("/api/quality", s.qualityHandler)
+	r.Route("/api/metrics/derived", func(r chi.Router) {
+		r.Get("/", s.derivedMetricsHandler)
+		r.Post("/", s.saveDerivedMetricHandler)
+		r.Get("/{name}", s.derivedMetricHandler)
+		r.Delete("/{name}", s.deleteDerivedMetricHandler)
+		r.Get("/{name}/values", s.derivedValuesHandler)
+	})
 
-func (s *Server) Start() error {
-	// WebSocket endpoint
-	http.HandleFunc("/ws", s.handler.HandleWebSocket)
+	r.Route("/api/ingest", func(r chi.Router) {
+		// Batch upload of buffered readings, stored with one COPY
+		r.Post("/", s.ingestHandler)
+
+		// Third-party webhook ingestion with per-source mapping templates
+		r.Post("/webhook/{source}", s.webhookIngestHandler)
+		r.Get("/webhooks", s.webhookMappingsHandler)
+		r.Put("/webhooks/{source}", s.saveWebhookMappingHandler)
+		r.Delete("/webhooks/{source}", s.deleteWebhookMappingHandler)
+		r.Get("/decoders", s.decoderProfilesHandler)
+		r.Put("/decoders/{name}", s.saveDecoderProfileHandler)
+		r.Delete("/decoders/{name}", s.deleteDecoderProfileHandler)
+
+		r.Get("/syslog/sources", s.syslogSourcesHandler)
+		r.Put("/syslog/sources/{source}", s.saveSyslogSourceHandler)
+		r.Delete("/syslog/sources/{source}", s.deleteSyslogSourceHandler)
+		r.Get("/mqtt", s.mqttIngestHandler)
+
+		// Inbound email webhook for equipment that only sends alarm emails
+		r.Post("/email", s.emailIngestHandler)
+		r.Get("/email/rules", s.emailRulesHandler)
+		r.Put("/email/rules/{name}", s.saveEmailRuleHandler)
+		r.Delete("/email/rules/{name}", s.deleteEmailRuleHandler)
+	})
 
-	 // Health check endpoint
-	 http.HandleFunc("/health", corsMiddleware(s.healthHandler))
+	// Modbus/OPC-UA polling (gateway mode)
+	r.Get("/api/poller/endpoints", s.pollerEndpointsHandler)
+	r.Put("/api/poller/endpoints/{name}", s.savePollerEndpointHandler)
+	r.Delete("/api/poller/endpoints/{name}", s.deletePollerEndpointHandler)
+
+	// Notifier configuration check (Teams, Opsgenie, webhook) and outgoing webhooks (admin only)
+	r.Post("/api/notify/test", s.notifyTestHandler)
+	r.Route("/api/notify/webhooks", func(r chi.Router) {
+		r.Get("/", s.outgoingWebhooksHandler)
+		r.Put("/{name}", s.saveOutgoingWebhookHandler)
+		r.Delete("/{name}", s.deleteOutgoingWebhookHandler)
+	})
 
+	// Asynchronous analytical query jobs (status polling, cancellation, result retrieval)
+	r.Route("/api/queries", func(r chi.Router) {
+		r.Get("/", s.queriesHandler)
+		r.Post("/", s.submitQueryHandler)
+		r.Get("/{id}", s.queryJobHandler)
+		r.Get("/{id}/result", s.queryJobResultHandler)
+		r.Post("/{id}/cancel", s.cancelQueryJobHandler)
+	})
 
- // Log viewing endpoints (GET requests)
- http.HandleFunc("/api/logs", corsMiddleware(s.logsHandler))
- http.HandleFunc("/api/logs/device/", corsMiddleware(s.deviceLogsHandler))
+	// Parquet exports of readings (asynchronous, admin only)
+	r.Route("/api/export/jobs", func(r chi.Router) {
+		r.Get("/", s.exportJobsHandler)
+		r.Post("/", s.submitExportJobHandler)
+		r.Get("/{id}", s.exportJobHandler)
+		r.Post("/{id}/cancel", s.cancelExportJobHandler)
+	})
 
+	// Device registry
+	r.Route("/api/devices", func(r chi.Router) {
+		r.Get("/", s.devicesHandler)
+		r.Post("/", s.registerDeviceHandler)
+		r.Get("/{id}", s.deviceHandler)
+		r.Put("/{id}", s.replaceDeviceHandler)
+		r.Patch("/{id}", s.updateDeviceHandler)
+		r.Delete("/{id}", s.decommissionDeviceHandler)
+		r.Get("/{id}/commands", s.deviceCommandsHandler)
+		r.Post("/{id}/commands", s.issueCommandHandler)
+		r.Get("/{id}/commands/{command_id}", s.deviceCommandHandler)
+	})
 
-	log.Printf("Starting WebSocket server on port %s", s.port)
-	log.Printf("WebSocket endpoint: ws://localhost:%s/ws", s.port)
-	log.Printf("Health check: http://localhost:%s/health", s.port)
-	log.Printf("View logs: http://localhost:%s/api/logs", s.port)
+	// Staged rollouts of one command to a group of devices
+	r.Route("/api/commands/rollouts", func(r chi.Router) {
+		r.Get("/", s.rolloutsHandler)
+		r.Post("/", s.createRolloutHandler)
+		r.Get("/{id}", s.rolloutHandler)
+		r.Post("/{id}/pause", s.pauseRolloutHandler)
+		r.Post("/{id}/resume", s.resumeRolloutHandler)
+		r.Post("/{id}/cancel", s.cancelRolloutHandler)
+	})
 
-	http.HandleFunc("/api/ai/query", corsMiddleware(s.aiQueryHandler))
-    http.HandleFunc("/api/ai/summarize", corsMiddleware(s.aiSummarizeHandler))
-    http.HandleFunc("/api/ai/anomalies", corsMiddleware(s.aiAnomaliesHandler))
-    http.HandleFunc("/api/ai/search", corsMiddleware(s.aiSearchHandler))
-	log.Printf("Starting WebSocket server on port %s", s.port)
-	log.Printf("WebSocket endpoint: ws://localhost:%s/ws", s.port)
-	log.Printf("Health check: http://localhost:%s/health", s.port)
-	log.Printf("View logs: http://localhost:%s/api/logs", s.port)
-	log.Printf("AI Query: http://localhost:%s/api/ai/query", s.port)
+	// Battery and signal strength from reading metadata, with low-battery/weak-signal alerting
+	r.Route("/api/fleet", func(r chi.Router) {
+		r.Get("/vitals", s.fleetVitalsHandler)
+		r.With(s.cancellable).Get("/vitals/{device_id}", s.deviceVitalsHandler)
+		r.Get("/alerts", s.fleetAlertsHandler)
+		r.Get("/alert-rules", s.fleetAlertRulesHandler)
+		r.Put("/alert-rules/{name}", s.saveFleetAlertRuleHandler)
+		r.Delete("/alert-rules/{name}", s.deleteFleetAlertRuleHandler)
+	})
+
+	r.Route("/api/incidents", func(r chi.Router) {
+		r.Get("/", s.incidentsHandler)
+		r.With(s.cancellable).Get("/{id}", s.incidentHandler)
+		r.Patch("/{id}", s.updateIncidentHandler)
+		r.With(s.limitAI, s.cancellable).Post("/{id}/describe", s.describeIncidentHandler)
+	})
+
+	// Threshold alert rules on reading values and the alerts they raised
+	r.With(s.cancellable).Get("/api/alerts", s.alertsHandler)
+	r.Get("/api/alert-rules", s.alertRulesHandler)
+	r.Put("/api/alert-rules/{name}", s.saveAlertRuleHandler)
+	r.Delete("/api/alert-rules/{name}", s.deleteAlertRuleHandler)
+
+	// Service level objectives and their error budgets
+	r.Route("/api/slos", func(r chi.Router) {
+		r.Get("/", s.slosHandler)
+		r.With(s.cancellable).Get("/{name}", s.sloHandler)
+		r.Put("/{name}", s.saveSLOHandler)
+		r.Delete("/{name}", s.deleteSLOHandler)
+	})
+
+	// API keys devices present on /ws (admin only)
+	r.Route("/api/device-keys", func(r chi.Router) {
+		r.Get("/", s.deviceKeysHandler)
+		r.Post("/", s.createDeviceKeyHandler)
+		r.Patch("/{id}", s.updateDeviceKeyHandler)
+		r.Delete("/{id}", s.revokeDeviceKeyHandler)
+	})
+
+	// Read-only share links; /api/shared/{token} is public and needs no credentials
+	r.Get("/api/shares", s.sharesHandler)
+	r.Post("/api/shares", s.createShareHandler)
+	r.Delete("/api/shares/{id}", s.revokeShareHandler)
+	r.Get("/api/shared/{token}", s.sharedViewHandler)
+
+	// Configuration export/import (JSON bundle)
+	r.Get("/api/admin/config/export", s.configExportHandler)
+	r.Post("/api/admin/config/import", s.configImportHandler)
+	// TimescaleDB retention and compression policies per hypertable and continuous aggregate
+	r.Get("/api/admin/retention", s.retentionPoliciesHandler)
+	r.Put("/api/admin/retention/{table}", s.setRetentionPolicyHandler)
+	// Readings that failed to store, waiting for the database
+	r.Get("/api/admin/dlq", s.deadLettersHandler)
+	r.Post("/api/admin/dlq/replay", s.replayDeadLettersHandler)
+	r.Get("/api/admin/dlq/{id}", s.deadLetterHandler)
+	r.Post("/api/admin/dlq/{id}/replay", s.replayDeadLetterHandler)
+	r.Delete("/api/admin/dlq/{id}", s.deleteDeadLetterHandler)
+
+	// AI endpoints
+	r.Route("/api/ai", func(r chi.Router) {
+		r.Use(s.limitAI)
+		r.With(s.cancellable).Post("/query", s.aiQueryHandler)
+		r.With(s.cancellable).Post("/summarize", s.aiSummarizeHandler)
+		r.With(s.cancellable).Get("/summaries", s.aiSummariesHandler)
+		r.With(s.cancellable).Get("/anomalies", s.aiAnomaliesHandler)
+		r.With(s.cancellable).Post("/anomalies/backtest", s.aiBacktestHandler)
+		r.Get("/anomalies/baselines", s.anomalyBaselinesHandler)
+		r.With(s.cancellable).Post("/anomalies/baselines/recompute", s.recomputeBaselinesHandler)
+		r.With(s.cancellable).Get("/anomalies/baselines/{device_id}", s.anomalyBaselineHandler)
+		r.With(s.cancellable).Get("/maintenance", s.maintenanceHandler)
+		r.With(s.cancellable).Post("/search", s.aiSearchHandler)
+		r.Get("/embeddings", s.embeddingStatsHandler)
+		r.With(s.cancellable).Post("/sql/execute", s.aiExecuteSQLHandler)
+		r.With(s.cancellable).Post("/sql/stream", s.aiStreamSQLHandler)
+		r.Get("/capabilities", s.aiCapabilitiesHandler)
+		// Versioned system prompt templates (admin only)
+		r.Route("/prompts", func(r chi.Router) {
+			r.Get("/", s.promptsHandler)
+			r.Get("/{name}", s.promptVersionsHandler)
+			r.Post("/{name}", s.createPromptHandler)
+			r.Post("/{name}/activate", s.activatePromptHandler)
+			r.Post("/{name}/rollback", s.rollbackPromptHandler)
+		})
+		// Shadow comparisons of the live text-to-SQL prompt/model with a candidate (admin only)
+		r.With(s.cancellable).Get("/shadow", s.shadowRunsHandler)
+	})
+
+	// Explicit cancellation of requests sent with an X-Request-ID header
+	r.Post("/api/requests/{id}/cancel", s.cancelRequestHandler)
+
+	// Slack slash command and the chart images it links to
+	r.Post("/api/slack/command", s.slackCommandHandler)
+	r.Get("/api/slack/charts/{id}.png", s.slackChartHandler)
+
+	return r
+}
+
+func (s *Server) Start() error {
+	go s.handler.publishRealtimeMetrics()
+	if s.handler.sampler.mode == sampleRollup && s.handler.sampler.threshold > 0 {
+		go s.handler.publishRollups()
+	}
+	if interval := getDurationEnv("WS_HEARTBEAT_INTERVAL", 30*time.Second); interval > 0 {
+		go s.handler.publishHeartbeats(interval)
+	}
+	s.registry.Start(getDurationEnv("DEVICE_LAST_SEEN_FLUSH", 30*time.Second))
+	s.vitals.Start(getDurationEnv("DEVICE_VITALS_FLUSH", 30*time.Second))
+	s.templates.Start(getDurationEnv("MESSAGE_TEMPLATES_FLUSH", 30*time.Second))
+	s.startFacets()
+	s.rollouts.Start(getDurationEnv("COMMAND_ROLLOUT_INTERVAL", 15*time.Second))
+	s.startDeadLetters()
+	s.slos.Start(getDurationEnv("SLO_EVAL_INTERVAL", 5*time.Minute))
+	if interval := getDurationEnv("AGGREGATE_REPAIR_INTERVAL", 6*time.Hour); interval > 0 {
+		go s.repairAggregatesEvery(interval)
+	}
+	if getEnv("DEVICE_LOGS_BACKFILL", "true") != "false" {
+		go s.backfillDeviceLogs()
+	}
+	s.summaries.Start()
+	if s.ai.AnomalyConfig().Baselines {
+		s.ai.Baselines().Start(getDurationEnv("ANOMALY_BASELINE_INTERVAL", time.Hour))
+	}
+	// Listeners are registered before any ingestion source starts
+	s.startHomeAssistant()
+	s.startEmbeddingPipeline()
+	s.startKnowledge()
+	if s.poller != nil {
+		s.poller.Start()
+	}
+	if err := s.startSyslog(); err != nil {
+		return err
+	}
+	if err := s.startMQTTIngest(); err != nil {
+		return err
+	}
+	if getEnv("INFLUX_EXPORT_URL", "") != "" {
+		exporter, err := influx.NewExporter(s.db)
+		if err != nil {
+			return err
+		}
+		exporter.Start()
+	}
+	if s.demo != nil {
+		go s.runDemoFleet()
+	}
+
+	slog.Info("Starting WebSocket server",
+		"port", s.port,
+		"websocket", "ws://localhost:"+s.port+"/ws",
+		"health", "http://localhost:"+s.port+"/health",
+	)
 
-	return http.ListenAndServe(":"+s.port, nil)
+	return http.ListenAndServe(":"+s.port, s.Routes())
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -116,14 +634,9 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"status": "healthy", "service": "edge-insights"}`))
 }
 
-
-
+// logsHandler lists recent readings, newest first, filtered by time range, log type, device type,
+// location and metadata (GET)
 func (s *Server) logsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	limit := 50 // Default limit
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
@@ -131,32 +644,61 @@ func (s *Server) logsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	logs, err := db.GetRecentSensorReadings(s.db, limit)
+	q := r.URL.Query()
+	filter := db.LogFilter{
+		LogTypes:   queryList(q, "log_type"),
+		DeviceType: q.Get("device_type"),
+		Location:   q.Get("location"),
+	}
+
+	// start and end (RFC3339) bound the device time: start <= time < end
+	for _, p := range []struct {
+		name   string
+		target **time.Time
+	}{{"start", &filter.Start}, {"end", &filter.End}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				httpError(w, r, p.name+" must be RFC3339", http.StatusBadRequest)
+				return
+			}
+			*p.target = &t
+		}
+	}
+	if filter.Start != nil && filter.End != nil && !filter.End.After(*filter.Start) {
+		httpError(w, r, "end must be after start", http.StatusBadRequest)
+		return
+	}
+
+	// metadata={"firmware":"1.4.2"} keeps readings whose metadata contains every key/value given
+	if raw := q.Get("metadata"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &filter.Metadata); err != nil {
+			httpError(w, r, "metadata must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	}
+
+	logs, err := db.GetRecentSensorReadingsMatching(r.Context(), s.db, filter, limit)
 	if err != nil {
-		log.Printf("Error fetching logs: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Error fetching logs", err)
+		return
+	}
+
+	rows, err := s.redaction.ApplyStructs(roleFromRequest(r), logs)
+	if err != nil {
+		writeError(w, r, "Error redacting logs", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"logs":  logs,
-		"count": len(logs),
+		"logs":  rows,
+		"count": len(rows),
 	})
 }
 
 func (s *Server) deviceLogsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Extract device ID from URL path
-	deviceID := r.URL.Path[len("/api/logs/device/"):]
-	if deviceID == "" {
-		http.Error(w, "Device ID required", http.StatusBadRequest)
-		return
-	}
+	deviceID := chi.URLParam(r, "id")
 
 	limit := 20 // Default limit for device logs
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
@@ -167,67 +709,138 @@ func (s *Server) deviceLogsHandler(w http.ResponseWriter, r *http.Request) {
 
 	logs, err := db.GetLogsByDevice(s.db, deviceID, limit)
 	if err != nil {
-		log.Printf("Error fetching device logs: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Error fetching device logs", err)
+		return
+	}
+
+	rows, err := s.redaction.ApplyStructs(roleFromRequest(r), logs)
+	if err != nil {
+		writeError(w, r, "Error redacting device logs", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"device_id": deviceID,
-		"logs":      logs,
-		"count":     len(logs),
+		"logs":      rows,
+		"count":     len(rows),
 	})
 }
 
-func (s *Server) aiQueryHandler(w http.ResponseWriter, r *http.Request) {
-	// Validate HTTP method
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (s *Server) realtimeMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	series := s.handler.realtime.Snapshot(realtime.Filter{
+		DeviceType: r.URL.Query().Get("device_type"),
+		Location:   r.URL.Query().Get("location"),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resolution": s.handler.realtime.Resolution().String(),
+		"series":     series,
+		"count":      len(series),
+	})
+}
+
+func (s *Server) aggregatesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	view := q.Get("view")
+	if view == "" {
+		view = "five_min"
+	}
+	width, ok := db.AggregateBucketWidth(view)
+	if !ok {
+		httpError(w, r, "view must be one of five_min, hourly, daily", http.StatusBadRequest)
+		return
+	}
+
+	deviceType := q.Get("device_type")
+	if deviceType == "" {
+		httpError(w, r, "device_type is required", http.StatusBadRequest)
+		return
+	}
+
+	// Default to the last 12 buckets of the selected view
+	end := time.Now()
+	start := end.Add(-12 * width)
+	if v := q.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, r, "start must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		start = t
+	}
+	if v := q.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, r, "end must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		end = t
+	}
+
+	buckets, err := db.GetAggregateWindowContext(r.Context(), s.db, view, deviceType, q.Get("location"), start, end)
+	if err != nil {
+		writeError(w, r, "Error fetching aggregates", err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"view":    view,
+		"buckets": buckets,
+		"count":   len(buckets),
+	})
+}
+
+func (s *Server) aiQueryHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse JSON body into QueryRequest struct
 	var req types.QueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	//  Validate query is not empty
 	if req.Query == "" {
-		http.Error(w, "Query is required", http.StatusBadRequest)
+		httpError(w, r, "Query is required", http.StatusBadRequest)
+		return
+	}
+
+	// Clients accepting text/event-stream get the answer as it is built
+	if acceptsEventStream(r) {
+		s.aiStreamQueryHandler(w, r, req.Query)
 		return
 	}
 
-	// Call AI service (in service.go) with the query
-	response, err := s.ai.QueryLogs(req.Query)
+	// Call AI service (in service.go) with the query; the caller's role limits how it is answered
+	role := roleFromRequest(r)
+	response, err := s.ai.QueryLogs(r.Context(), req.Query, role)
+	if s.writeDemoError(w, r, err) {
+		return
+	}
 	if err != nil {
-		log.Printf("AI query error: %v", err)
-		http.Error(w, "AI query failed", http.StatusInternalServerError)
+		writeError(w, r, "AI query failed", err)
 		return
 	}
 
+	// Strip or mask columns the caller is not allowed to see
+	s.redactQueryResponse(role, response)
+
 	//  Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
 func (s *Server) aiSummarizeHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	timeRange := r.URL.Query().Get("range")
 	if timeRange == "" {
 		timeRange = "1h" // Default to 1 hour
 	}
 
-	response, err := s.ai.SummarizeLogs(timeRange)
+	response, err := s.ai.SummarizeLogsContext(r.Context(), timeRange)
 	if err != nil {
-		log.Printf("AI summary error: %v", err)
-		http.Error(w, "AI summary failed", http.StatusInternalServerError)
+		writeError(w, r, "AI summary failed", err)
 		return
 	}
 
@@ -236,17 +849,20 @@ func (s *Server) aiSummarizeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) aiAnomaliesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	timeRange := r.URL.Query().Get("range")
+	if timeRange == "" {
+		timeRange = "24h"
 	}
 
-	response, err := s.ai.DetectAnomalies()
+	response, err := s.ai.DetectAnomaliesContext(r.Context(), timeRange)
 	if err != nil {
-		log.Printf("AI anomaly detection error: %v", err)
-		http.Error(w, "AI anomaly detection failed", http.StatusInternalServerError)
+		writeError(w, r, "AI anomaly detection failed", err)
 		return
 	}
+	if result, ok := response.Result.(types.AnomalyResponse); ok {
+		s.recordAnomalies(result.Anomalies)
+	}
+	s.redactQueryResponse(roleFromRequest(r), response)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -259,25 +875,94 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getIntEnv reads a positive integer from the environment
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+		slog.Warn("Invalid integer in environment", "key", key, "value", value, "using", defaultValue)
+	}
+	return defaultValue
+}
+
+// getDurationEnv reads a Go duration (e.g. "10s", "5m") from the environment
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		slog.Warn("Invalid duration in environment", "key", key, "value", value, "using", defaultValue.String())
+	}
+	return defaultValue
+}
+
 // ... existing code ...
-func (s *Server) aiSearchHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// aiExecuteSQLHandler runs generated SQL that was returned for approval (admins only)
+func (s *Server) aiExecuteSQLHandler(w http.ResponseWriter, r *http.Request) {
+	role := roleFromRequest(r)
+	if !ai.Allowed(role, ai.CapabilitySQL) {
+		writeAPIError(w, r, http.StatusForbidden, "insufficient_role", "SQL execution is not available to the "+string(role)+" role", nil)
+		return
+	}
+
+	var req struct {
+		Query   string `json:"query"`
+		SQL     string `json:"sql"`
+		Confirm bool   `json:"confirm"` // run even though the plan estimate exceeded the cost guard
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.ai.ExecuteApprovedSQL(r.Context(), req.Query, req.SQL, req.Confirm)
+	if err != nil && r.Context().Err() != nil {
+		writeError(w, r, "Approved SQL failed", err)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Approved SQL error", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	s.redactQueryResponse(role, response)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// aiCapabilitiesHandler reports which AI features the caller's role can use
+func (s *Server) aiCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	role := roleFromRequest(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"role":         role,
+		"capabilities": ai.Capabilities(role),
+	})
+}
+
+// aiSearchHandler serves POST /api/ai/search. Besides search_text and limit the body accepts
+// device_type, location, log_type and range (e.g. "7d" or an ISO 8601 interval) to narrow it
+func (s *Server) aiSearchHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse JSON body
 	var req struct {
 		SearchText string `json:"search_text"`
 		Limit      int    `json:"limit"`
+		DeviceType string `json:"device_type"`
+		Location   string `json:"location"`
+		LogType    string `json:"log_type"`
+		Range      string `json:"range"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	if req.SearchText == "" {
-		http.Error(w, "Search text is required", http.StatusBadRequest)
+		httpError(w, r, "Search text is required", http.StatusBadRequest)
 		return
 	}
 
@@ -285,13 +970,33 @@ func (s *Server) aiSearchHandler(w http.ResponseWriter, r *http.Request) {
 		req.Limit = 10 // Default limit
 	}
 
-	response, err := s.ai.SearchSimilarLogs(req.SearchText, req.Limit)
+	filter := ai.SearchFilter{DeviceType: req.DeviceType, Location: req.Location, LogType: req.LogType}
+	if req.Range != "" {
+		tr, err := timerange.Parse(req.Range, time.Now())
+		if err != nil {
+			httpError(w, r, "Invalid range: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Start, filter.End = &tr.Start, &tr.End
+	}
+
+	role := roleFromRequest(r)
+	if !ai.Allowed(role, ai.CapabilitySearch) {
+		writeAPIError(w, r, http.StatusForbidden, "insufficient_role", "Semantic search is not available to the "+string(role)+" role", nil)
+		return
+	}
+
+	response, err := s.ai.SearchSimilarLogs(r.Context(), req.SearchText, req.Limit, filter)
+	if s.writeDemoError(w, r, err) {
+		return
+	}
 	if err != nil {
-		log.Printf("AI search error: %v", err)
-		http.Error(w, "AI search failed", http.StatusInternalServerError)
+		writeError(w, r, "AI search failed", err)
 		return
 	}
 
+	s.redactQueryResponse(role, response)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
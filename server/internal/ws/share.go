@@ -0,0 +1,177 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"edge-insights/internal/db"
+	"edge-insights/internal/roles"
+	"edge-insights/internal/share"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// sharesHandler lists read-only share links (GET)
+func (s *Server) sharesHandler(w http.ResponseWriter, r *http.Request) {
+	links := s.shares.List()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"shares": links,
+		"count":  len(links),
+	})
+}
+
+// createShareHandler creates a read-only share link (POST)
+func (s *Server) createShareHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		share.Link
+		ExpiresIn string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	ttl := getDurationEnv("SHARE_DEFAULT_TTL", 7*24*time.Hour)
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			httpError(w, r, "expires_in must be a positive duration like 72h", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if maxTTL := getDurationEnv("SHARE_MAX_TTL", 30*24*time.Hour); ttl > maxTTL {
+		httpError(w, r, "expires_in exceeds SHARE_MAX_TTL ("+maxTTL.String()+")", http.StatusBadRequest)
+		return
+	}
+
+	link := req.Link
+	link.Snapshot = nil
+	if err := link.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Query results are captured now rather than re-running the LLM on every view
+	if link.Kind == share.KindQuery {
+		response, err := s.ai.QueryLogs(r.Context(), link.Params.Query, roleFromRequest(r))
+		if err != nil {
+			writeError(w, r, "Share query error", err)
+			return
+		}
+		s.redactQueryResponse(roles.Viewer, response)
+		snapshot, err := json.Marshal(response)
+		if err != nil {
+			writeError(w, r, "Error encoding share snapshot", err)
+			return
+		}
+		link.Snapshot = snapshot
+	}
+
+	if _, err := s.shares.Prune(); err != nil {
+		slog.ErrorContext(r.Context(), "Error pruning expired share links", "error", err)
+	}
+
+	created, err := s.shares.Create(link, ttl)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating share link", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"share": created,
+		"url":   shareURL(created.Token),
+	})
+}
+
+// revokeShareHandler revokes /api/shares/{id} (DELETE)
+func (s *Server) revokeShareHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.shares.Revoke(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "Error revoking share link", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Share link not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sharedViewHandler serves GET /api/shared/{token} without authentication
+// Results are always redacted as the viewer role, whoever created the link
+func (s *Server) sharedViewHandler(w http.ResponseWriter, r *http.Request) {
+	link, ok := s.shares.Resolve(chi.URLParam(r, "token"))
+	if !ok {
+		// Unknown, revoked and expired links look the same to the caller
+		httpError(w, r, "Share link not found or expired", http.StatusNotFound)
+		return
+	}
+
+	response := map[string]interface{}{
+		"name":       link.Name,
+		"kind":       link.Kind,
+		"params":     link.Params,
+		"expires_at": link.ExpiresAt,
+	}
+
+	switch link.Kind {
+	case share.KindAggregates:
+		width, ok := db.AggregateBucketWidth(link.Params.View)
+		if !ok {
+			httpError(w, r, "Shared view is no longer valid", http.StatusGone)
+			return
+		}
+		window, _ := link.WindowDuration()
+		if window == 0 {
+			window = 12 * width
+		}
+		end := time.Now()
+		buckets, err := db.GetAggregateWindow(s.db, link.Params.View, link.Params.DeviceType, link.Params.Location, end.Add(-window), end)
+		if err != nil {
+			writeError(w, r, "Error fetching shared aggregates", err)
+			return
+		}
+		response["buckets"] = buckets
+		response["count"] = len(buckets)
+		response["generated_at"] = end
+
+	case share.KindDeviceLogs:
+		logs, err := db.GetLogsByDevice(s.db, link.Params.DeviceID, link.Params.Limit)
+		if err != nil {
+			writeError(w, r, "Error fetching shared device logs", err)
+			return
+		}
+		rows, err := s.redaction.ApplyStructs(roles.Viewer, logs)
+		if err != nil {
+			writeError(w, r, "Error redacting shared device logs", err)
+			return
+		}
+		response["logs"] = rows
+		response["count"] = len(rows)
+		response["generated_at"] = time.Now()
+
+	case share.KindQuery:
+		response["result"] = link.Snapshot
+		response["generated_at"] = link.CreatedAt
+	}
+
+	// Shared views must not be cached by intermediaries past their expiry
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// shareURL builds the public URL of a share token, relative when PUBLIC_BASE_URL is unset
+func shareURL(token string) string {
+	return strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/") + "/api/shared/" + token
+}
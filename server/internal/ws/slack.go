@@ -0,0 +1,176 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/roles"
+	"edge-insights/internal/slack"
+	"edge-insights/internal/types"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const slackUsage = "Ask a question about your devices, e.g. `/insights average temperature per location today`, or `/insights summary 24h`."
+
+// slackCommandHandler answers the Slack slash command (POST application/x-www-form-urlencoded)
+// Slack expects a reply within 3 seconds, so the request is acknowledged and the answer is
+// posted to response_url once the AI layer is done
+func (s *Server) slackCommandHandler(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("SLACK_SIGNING_SECRET")
+	if secret == "" {
+		httpError(w, r, "Slack integration is not configured", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		httpError(w, r, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	if err := slack.Verify(secret, r.Header, body, time.Now()); err != nil {
+		slog.ErrorContext(r.Context(), "Rejected Slack request", "error", err)
+		httpError(w, r, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		httpError(w, r, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	text := strings.TrimSpace(form.Get("text"))
+	responseURL := form.Get("response_url")
+
+	w.Header().Set("Content-Type", "application/json")
+	if text == "" || text == "help" {
+		json.NewEncoder(w).Encode(slack.Ephemeral(slackUsage))
+		return
+	}
+
+	json.NewEncoder(w).Encode(slack.Ephemeral(fmt.Sprintf("Looking into _%s_…", text)))
+	go s.answerSlack(text, responseURL)
+}
+
+// answerSlack runs the question through the AI layer and posts the formatted answer
+func (s *Server) answerSlack(text, responseURL string) {
+	// Answers are posted to a shared channel, so they use the Slack role (viewer by default)
+	role, ok := roles.Parse(getEnv("SLACK_ROLE", string(roles.Viewer)))
+	if !ok {
+		role = roles.Viewer
+	}
+
+	var response *types.QueryResponse
+	var err error
+	if fields := strings.Fields(text); strings.EqualFold(fields[0], "summary") {
+		timeRange := "1h"
+		if len(fields) > 1 {
+			timeRange = fields[1]
+		}
+		response, err = s.ai.SummarizeLogs(timeRange)
+	} else {
+		response, err = s.ai.QueryLogs(context.Background(), text, role)
+	}
+	if err != nil {
+		slog.Error("Slack query failed", "error", err)
+		postSlack(responseURL, slack.Ephemeral("Sorry, that question could not be answered: "+err.Error()))
+		return
+	}
+
+	s.redactQueryResponse(role, response)
+
+	chartURL, legend := s.slackChart(response)
+	message, err := slack.Answer(text, response.Result, chartURL, legend, response.Notice)
+	if err != nil {
+		slog.Error("Failed to format Slack answer", "error", err)
+		return
+	}
+	postSlack(responseURL, message)
+}
+
+// slackChart renders time-series SQL answers and returns the public chart URL and legend
+// Charts need PUBLIC_BASE_URL so Slack can fetch them
+func (s *Server) slackChart(response *types.QueryResponse) (string, string) {
+	baseURL := os.Getenv("PUBLIC_BASE_URL")
+	result, ok := response.Result.(ai.SQLQueryResponse)
+	if baseURL == "" || !ok {
+		return "", ""
+	}
+
+	rows := make([]map[string]interface{}, 0, len(result.Result))
+	for _, r := range result.Result {
+		if row, ok := r.(map[string]interface{}); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	series, valueCol, ok := slack.TimeSeries(rows)
+	if !ok {
+		return "", ""
+	}
+	png, err := slack.RenderPNG(series, 800, 360)
+	if err != nil {
+		slog.Error("Failed to render Slack chart", "error", err)
+		return "", ""
+	}
+
+	// Charts carry no text, so the legend and value range go in the message
+	var legend []string
+	low, high := series[0].Points[0].Value, series[0].Points[0].Value
+	for i, line := range series {
+		legend = append(legend, fmt.Sprintf("%s: %s", slack.PaletteNames[i], line.Name))
+		for _, p := range line.Points {
+			low, high = math.Min(low, p.Value), math.Max(high, p.Value)
+		}
+	}
+	id := s.charts.Put(png)
+	return fmt.Sprintf("%s/api/slack/charts/%s.png", strings.TrimRight(baseURL, "/"), id),
+		fmt.Sprintf("%s (%.2f – %.2f) — %s", valueCol, low, high, strings.Join(legend, ", "))
+}
+
+// slackChartHandler serves rendered charts (GET /api/slack/charts/{id}.png) until they expire
+func (s *Server) slackChartHandler(w http.ResponseWriter, r *http.Request) {
+	png, ok := s.charts.Get(chi.URLParam(r, "id"))
+	if !ok {
+		httpError(w, r, "Chart not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(png)
+}
+
+// postSlack delivers a message to a slash command's response_url
+func postSlack(responseURL string, message slack.Message) {
+	if !strings.HasPrefix(responseURL, "https://hooks.slack.com/") {
+		slog.Warn("Refusing to post Slack answer", "response_url", responseURL)
+		return
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(responseURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		slog.Error("Failed to post Slack answer", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		slog.Warn("Slack response_url returned an error", "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/slo"
+	"edge-insights/internal/types"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// startSLOs pushes SLO alert changes on the live feed and to the outgoing webhooks
+func (s *Server) startSLOs() {
+	s.slos.OnAlert(func(alert slo.Alert) {
+		s.handler.broadcastMatching(types.NewEvent(types.EventAlert, alert.Event()), func(sub types.Subscription) bool {
+			return len(sub.DeviceIDs) == 0 && sub.MatchesDevice("", alert.DeviceType, alert.Location)
+		})
+		s.hooks.Dispatch(alert.Notification())
+	})
+}
+
+// sloView is an SLO with its latest status; its notification credentials are masked
+type sloView struct {
+	slo.SLO
+	Status *slo.Status `json:"status"` // null until the first evaluation
+}
+
+func (s *Server) sloView(o slo.SLO) sloView {
+	view := sloView{SLO: o}
+	view.Notify = notify.Masked(o.Notify)
+	if st, ok := s.slos.Status(o.Name); ok {
+		view.Status = &st
+	}
+	return view
+}
+
+// slosHandler lists the SLOs with their latest error-budget status and the SLO alerts firing (GET)
+func (s *Server) slosHandler(w http.ResponseWriter, r *http.Request) {
+	list := s.slos.List()
+	views := make([]sloView, len(list))
+	for i, o := range list {
+		views[i] = s.sloView(o)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"slos":   views,
+		"count":  len(views),
+		"alerts": s.slos.Alerts(),
+	})
+}
+
+// sloHandler returns /api/slos/{name} (GET)
+// refresh=true recomputes the status instead of returning the last evaluation
+func (s *Server) sloHandler(w http.ResponseWriter, r *http.Request) {
+	o, ok := s.slos.Get(chi.URLParam(r, "name"))
+	if !ok {
+		httpError(w, r, "SLO not found", http.StatusNotFound)
+		return
+	}
+	view := s.sloView(*o)
+	if r.URL.Query().Get("refresh") == "true" {
+		st, err := s.slos.Compute(r.Context(), *o)
+		if err != nil {
+			writeError(w, r, "Failed to compute SLO status", err)
+			return
+		}
+		view.Status = &st
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// saveSLOHandler creates or replaces /api/slos/{name} (PUT)
+func (s *Server) saveSLOHandler(w http.ResponseWriter, r *http.Request) {
+	var o slo.SLO
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	o.Name = chi.URLParam(r, "name")
+
+	// Credentials left masked from a listing keep their stored values
+	var stored []notify.Config
+	if existing, ok := s.slos.Get(o.Name); ok {
+		stored = existing.Notify
+	}
+	var err error
+	if o.Notify, err = notify.Unmasked(o.Notify, stored); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := s.slos.Save(o)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving SLO", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := *saved
+	response.Notify = notify.Masked(saved.Notify)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// deleteSLOHandler removes /api/slos/{name} (DELETE)
+func (s *Server) deleteSLOHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.slos.Delete(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, "Error deleting SLO", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "SLO not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,125 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"edge-insights/internal/ai"
+	"edge-insights/internal/logging"
+	"edge-insights/internal/types"
+)
+
+// aiStreamSQLHandler drafts the SQL for a data question as Server-Sent Events, so the client can
+// watch the model write it and cancel early (POST /api/ai/sql/stream, body {"query": "..."})
+// Events: "token" {"text"} for each piece of SQL, then "result" with the draft (the same
+// response as a data question answered for approval, nothing executed), "error" (the error
+// envelope, types.APIError) or "cancelled". Closing the connection or cancelling the X-Request-ID
+// stops the generation
+func (s *Server) aiStreamSQLHandler(w http.ResponseWriter, r *http.Request) {
+	role := roleFromRequest(r)
+	if !ai.Allowed(role, ai.CapabilitySearch) {
+		writeAPIError(w, r, http.StatusForbidden, "insufficient_role", "Drafting SQL is not available to the "+string(role)+" role", nil)
+		return
+	}
+
+	var req types.QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Query == "" {
+		httpError(w, r, "Query is required", http.StatusBadRequest)
+		return
+	}
+
+	events := newEventStream(w)
+	response, err := s.ai.StreamSQL(r.Context(), req.Query, role, func(text string) error {
+		return events.send("token", map[string]string{"text": text})
+	})
+	switch {
+	case r.Context().Err() != nil:
+		slog.InfoContext(r.Context(), "SQL stream cancelled", "reason", r.Context().Err())
+		// An explicit cancel leaves the connection open, so the client still hears about it
+		events.send("cancelled", map[string]string{})
+	case err != nil:
+		events.fail(r, "SQL generation failed", err)
+	default:
+		s.redactQueryResponse(role, response)
+		events.send("result", response)
+	}
+}
+
+// aiStreamQueryHandler answers POST /api/ai/query as Server-Sent Events when the client accepts
+// text/event-stream: the progress events of ai.StreamQuery ("route", "token", "sql", "results"),
+// then "result" with the same response the JSON endpoint returns, "error" or "cancelled"
+func (s *Server) aiStreamQueryHandler(w http.ResponseWriter, r *http.Request, query string) {
+	role := roleFromRequest(r)
+	events := newEventStream(w)
+	response, err := s.ai.StreamQuery(r.Context(), query, role, func(event string, data interface{}) error {
+		// Partial results are redacted like the final ones
+		if partial, ok := data.(map[string]interface{}); ok && event == "results" {
+			s.redactQueryResponse(role, &types.QueryResponse{Result: partial})
+		}
+		return events.send(event, data)
+	})
+	switch {
+	case r.Context().Err() != nil:
+		slog.InfoContext(r.Context(), "AI query stream cancelled", "reason", r.Context().Err())
+		events.send("cancelled", map[string]string{})
+	case err != nil:
+		events.fail(r, "AI query failed", err)
+	default:
+		s.redactQueryResponse(role, response)
+		events.send("result", response)
+	}
+}
+
+// acceptsEventStream reports whether the client asked for Server-Sent Events
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// eventStream writes Server-Sent Events, flushing each one
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// newEventStream starts an event-stream response
+func newEventStream(w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep reverse proxies from holding tokens back
+	w.WriteHeader(http.StatusOK)
+	return &eventStream{w: w, rc: http.NewResponseController(w)}
+}
+
+// fail ends the stream with an "error" event carrying the error envelope; the status is already sent
+func (e *eventStream) fail(r *http.Request, message string, err error) {
+	body := types.APIError{Code: errorCode(err), Message: message, RequestID: logging.RequestID(r.Context())}
+	if errors.Is(err, ai.ErrDemoQuestion) {
+		body.Code, body.Message = "demo_question", "The demo only answers its example questions (GET /api/demo)"
+	} else {
+		slog.ErrorContext(r.Context(), message, "error", err)
+	}
+	e.send("error", body)
+}
+
+func (e *eventStream) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	// Writers that cannot flush (e.g. debug=true buffering) deliver the events at the end
+	if err := e.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
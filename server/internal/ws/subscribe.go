@@ -0,0 +1,198 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-insights/internal/logging"
+	"edge-insights/internal/roles"
+	"edge-insights/internal/types"
+
+	"github.com/gorilla/websocket"
+)
+
+// feedClient is the live-feed state of one WebSocket connection
+// Connections that never send logs (dashboards) get the whole feed until they subscribe;
+// connections that send logs (devices) get nothing unless they subscribe, so a device's own
+// readings are not echoed back to it. Connections authenticated only as a device (no role) get
+// no feed at all
+type feedClient struct {
+	id           string // connection ID attached to its log records as conn_id
+	role         roles.Role
+	watcher      bool // the connection has a role, so it may receive the feed (redacted for the role)
+	mu           sync.RWMutex
+	subscription *types.Subscription
+	device       bool
+
+	conn         *websocket.Conn
+	writeMu      sync.Mutex // one writer at a time: the broadcast writer or a response
+	writeTimeout time.Duration
+	queue        *sendQueue
+}
+
+// newFeedClient creates the feed state of a connection upgraded from r, with the role the
+// authentication middleware put on its context
+func (h *Handler) newFeedClient(conn *websocket.Conn, r *http.Request) *feedClient {
+	role, watcher := roles.FromContext(r.Context())
+	return &feedClient{
+		id:           logging.NewID(),
+		role:         role,
+		watcher:      watcher,
+		conn:         conn,
+		writeTimeout: h.writeTimeout,
+		queue:        newSendQueue(h.sendQueue),
+	}
+}
+
+// wants reports whether the client should receive a broadcast; match narrows it by subscription (nil: any)
+func (c *feedClient) wants(match func(types.Subscription) bool) bool {
+	if !c.watcher {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.subscription == nil {
+		return !c.device
+	}
+	return match == nil || match(*c.subscription)
+}
+
+// markDevice records that the connection sends logs
+func (c *feedClient) markDevice() {
+	c.mu.Lock()
+	c.device = true
+	c.mu.Unlock()
+}
+
+func (c *feedClient) subscribe(sub *types.Subscription) {
+	c.mu.Lock()
+	c.subscription = sub
+	c.mu.Unlock()
+}
+
+// subscriptionFrame changes a connection's feed:
+// {"type": "subscribe", "device_id": [...], "device_type": [...], "location": [...], "log_type": [...]} or {"type": "unsubscribe"}
+type subscriptionFrame struct {
+	Type string `json:"type"`
+	types.Subscription
+}
+
+// handleSubscriptionFrame applies a subscribe/unsubscribe frame; it reports false for any other frame
+// Unsubscribing returns a dashboard to the whole feed and a device to no feed
+func handleSubscriptionFrame(ctx context.Context, c *feedClient, message []byte) bool {
+	var frame subscriptionFrame
+	if err := json.Unmarshal(message, &frame); err != nil {
+		return false
+	}
+
+	switch frame.Type {
+	case "subscribe":
+		sub := frame.Subscription
+		c.subscribe(&sub)
+		sendSubscribed(ctx, c, &sub)
+	case "unsubscribe":
+		c.subscribe(nil)
+		sendSubscribed(ctx, c, nil)
+	default:
+		return false
+	}
+	return true
+}
+
+// sendSubscribed acknowledges a subscription change with the filter now in effect (null data: none)
+func sendSubscribed(ctx context.Context, conn jsonWriter, sub *types.Subscription) {
+	if err := conn.WriteJSON(types.NewEvent(types.EventSubscribed, sub)); err != nil {
+		slog.WarnContext(ctx, "Error sending subscription ack", "error", err)
+	}
+}
+
+// subscriptionFromQuery reads device_id, device_type, location and log_type filters from the query string
+// Values can be repeated or comma-separated: ?log_type=ERROR,WARN&location=warehouse_a
+func subscriptionFromQuery(r *http.Request) types.Subscription {
+	q := r.URL.Query()
+	return types.Subscription{
+		DeviceIDs:   queryList(q, "device_id"),
+		DeviceTypes: queryList(q, "device_type"),
+		Locations:   queryList(q, "location"),
+		LogTypes:    queryList(q, "log_type"),
+	}
+}
+
+// queryList returns the values of a repeated or comma-separated query parameter
+func queryList(q url.Values, name string) []string {
+	var values []string
+	for _, v := range q[name] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+// addClient registers a connection for the live feed, starts its broadcast writer and returns
+// the number of connected clients
+func (h *Handler) addClient(conn *websocket.Conn, c *feedClient) int {
+	h.clientsMutex.Lock()
+	defer h.clientsMutex.Unlock()
+	h.clients[conn] = c
+	go h.writeBroadcasts(c)
+	return len(h.clients)
+}
+
+// removeClient unregisters a connection, stops its broadcast writer and closes it
+func (h *Handler) removeClient(conn *websocket.Conn) {
+	h.clientsMutex.Lock()
+	c, ok := h.clients[conn]
+	delete(h.clients, conn)
+	h.clientsMutex.Unlock()
+	if ok {
+		close(c.queue.done)
+		if dropped := c.queue.dropped.Load(); dropped > 0 {
+			slog.Warn("Live feed client disconnected after dropped broadcasts", "conn_id", c.id, "dropped", dropped)
+		}
+	}
+	conn.Close()
+}
+
+// HandleSubscribe serves /ws/subscribe: a read-only live feed for dashboards, filtered from the
+// query string and changeable with subscribe/unsubscribe frames. Logs cannot be sent on it
+// Callers are authenticated before the upgrade (see Server.authenticateFeed)
+func (h *Handler) HandleSubscribe(w http.ResponseWriter, r *http.Request) {
+	if _, ok := roles.FromContext(r.Context()); !ok {
+		httpError(w, r, "A bearer token is required", http.StatusUnauthorized)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to upgrade connection", "error", err)
+		return
+	}
+
+	sub := subscriptionFromQuery(r)
+	c := h.newFeedClient(conn, r)
+	c.subscription = &sub
+	ctx := logging.WithConnID(r.Context(), c.id)
+	clients := h.addClient(conn, c)
+	defer h.removeClient(conn)
+	slog.InfoContext(ctx, "Live feed subscriber connected", "remote_addr", r.RemoteAddr, "clients", clients)
+	sendSubscribed(ctx, c, &sub)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if !handleSubscriptionFrame(ctx, c, message) {
+			sendError(ctx, c, types.CodeUnsupported, "Only subscribe and unsubscribe frames are accepted here; send logs to /ws")
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// aiSummariesHandler lists the summaries written on AI_SUMMARY_SCHEDULES, newest first, with the
+// schedules and their next run (GET). Accepts schedule, since (a duration, default 168h) and
+// limit (default 30, at most 500)
+func (s *Server) aiSummariesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	since := 168 * time.Hour
+	if v := q.Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			httpError(w, r, "since must be a positive duration like 168h", http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+	limit := 30
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 500 {
+			httpError(w, r, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	summaries, err := s.summaries.History(r.Context(), q.Get("schedule"), time.Now().Add(-since), limit)
+	if err != nil {
+		writeError(w, r, "Failed to load summaries", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"summaries": summaries,
+		"count":     len(summaries),
+		"schedules": s.summaries.Schedules(),
+		"since":     since.String(),
+	})
+}
@@ -0,0 +1,81 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"edge-insights/internal/ingest/syslog"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// startSyslog opens the syslog listeners configured by SYSLOG_UDP_ADDR / SYSLOG_TCP_ADDR (both off by default)
+func (s *Server) startSyslog() error {
+	udpAddr := getEnv("SYSLOG_UDP_ADDR", "")
+	tcpAddr := getEnv("SYSLOG_TCP_ADDR", "")
+	if udpAddr == "" && tcpAddr == "" {
+		return nil
+	}
+
+	listener := syslog.NewListener(s.syslog, s.handler.Ingest)
+	if udpAddr != "" {
+		if err := listener.ListenUDP(udpAddr); err != nil {
+			return err
+		}
+	}
+	if tcpAddr != "" {
+		if err := listener.ListenTCP(tcpAddr); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// syslogSourcesHandler lists (GET) per-source syslog parsing overrides
+func (s *Server) syslogSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	sources := s.syslog.List()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sources": sources,
+		"count":   len(sources),
+	})
+}
+
+// saveSyslogSourceHandler creates or replaces /api/ingest/syslog/sources/{source} (PUT)
+func (s *Server) saveSyslogSourceHandler(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "source")
+	var src syslog.Source
+	if err := json.NewDecoder(r.Body).Decode(&src); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	src.Source = source
+
+	saved, err := s.syslog.Save(src)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving syslog source", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// deleteSyslogSourceHandler removes /api/ingest/syslog/sources/{source} (DELETE)
+func (s *Server) deleteSyslogSourceHandler(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "source")
+	found, err := s.syslog.Delete(source)
+	if err != nil {
+		writeError(w, r, "Error deleting syslog source", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Syslog source not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-insights/internal/notify"
+	"edge-insights/internal/types"
+	"edge-insights/internal/vitals"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// startVitals feeds stored readings into the vitals tracker and pushes alert changes on the live feed
+func (s *Server) startVitals() {
+	s.handler.OnStored(s.vitals.Observe)
+	s.vitals.OnAlert(func(alert vitals.Alert) {
+		s.handler.broadcastMatching(types.NewEvent(types.EventAlert, alert.Event()), func(sub types.Subscription) bool {
+			return sub.MatchesDevice(alert.DeviceID, alert.DeviceType, alert.Location)
+		})
+	})
+}
+
+// fleetVitalsHandler lists the latest battery and RSSI of every device (GET)
+// Accepts device_type, location, battery_below and rssi_below
+func (s *Server) fleetVitalsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := vitals.Filter{
+		DeviceType: q.Get("device_type"),
+		Location:   q.Get("location"),
+	}
+	for _, p := range []struct {
+		name   string
+		target **float64
+	}{{"battery_below", &filter.BatteryBelow}, {"rssi_below", &filter.RSSIBelow}} {
+		if v := q.Get(p.name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				httpError(w, r, p.name+" must be a number", http.StatusBadRequest)
+				return
+			}
+			*p.target = &f
+		}
+	}
+
+	list := s.vitals.List(filter)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"vitals": list,
+		"count":  len(list),
+	})
+}
+
+// deviceVitalsHandler returns /api/fleet/vitals/{device_id}: the latest vitals and their history
+// from reading metadata between start and end (RFC3339, default the last 7 days), up to limit samples
+func (s *Server) deviceVitalsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "device_id")
+	latest, ok := s.vitals.Get(deviceID)
+	if !ok {
+		httpError(w, r, "No vitals reported by this device", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	end := time.Now()
+	if v := q.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, r, "end must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		end = t
+	}
+	start := end.Add(-7 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, r, "start must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		start = t
+	}
+	limit := 1000
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	history, err := s.vitals.History(r.Context(), deviceID, start, end, limit)
+	if err != nil {
+		writeError(w, r, "Error fetching vitals history", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"latest":  latest,
+		"history": history,
+		"start":   start,
+		"end":     end,
+	})
+}
+
+// fleetAlertsHandler lists the low-battery and weak-signal alerts currently firing (GET)
+func (s *Server) fleetAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	alerts := s.vitals.Alerts()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// fleetAlertRulesHandler lists the vitals alert rules (GET)
+func (s *Server) fleetAlertRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules := s.vitals.Rules()
+	for i := range rules {
+		rules[i].Notify = notify.Masked(rules[i].Notify)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": rules,
+		"count": len(rules),
+	})
+}
+
+// saveFleetAlertRuleHandler creates or replaces /api/fleet/alert-rules/{name} (PUT)
+func (s *Server) saveFleetAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var rule vitals.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	rule.Name = chi.URLParam(r, "name")
+
+	// Credentials left masked from a listing keep their stored values
+	var stored []notify.Config
+	for _, existing := range s.vitals.Rules() {
+		if existing.Name == rule.Name {
+			stored = existing.Notify
+		}
+	}
+	var err error
+	if rule.Notify, err = notify.Unmasked(rule.Notify, stored); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := s.vitals.SaveRule(rule)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving vitals rule", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := *saved
+	response.Notify = notify.Masked(saved.Notify)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// deleteFleetAlertRuleHandler removes /api/fleet/alert-rules/{name} (DELETE)
+func (s *Server) deleteFleetAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.vitals.DeleteRule(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, "Error deleting vitals rule", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Vitals rule not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package ws
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"edge-insights/internal/ingest/decoder"
+	"edge-insights/internal/ingest/webhook"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxWebhookBody caps inbound webhook payloads
+const maxWebhookBody = 1 << 20
+
+// webhookIngestHandler accepts POST /api/ingest/webhook/{source} and stores the mapped readings
+func (s *Server) webhookIngestHandler(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "source")
+	mapping, ok := s.webhooks.Get(source)
+	if !ok {
+		httpError(w, r, "Unknown webhook source", http.StatusNotFound)
+		return
+	}
+
+	// Vendors that support it should send a shared token with every call
+	if mapping.Token != "" {
+		token := r.Header.Get("X-Webhook-Token")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(mapping.Token)) != 1 {
+			httpError(w, r, "Invalid webhook token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		httpError(w, r, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	messages, err := mapping.Apply(payload, s.decoders.Resolve)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Webhook mapping error", "source", source, "error", err)
+		httpError(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Store each mapped reading and report per-item results
+	var results []map[string]interface{}
+	accepted := 0
+	var saturated *SaturatedError
+	for i, msg := range messages {
+		result := map[string]interface{}{"index": i, "device_id": msg.DeviceID}
+		if err := s.handler.Ingest(msg); err != nil {
+			result["error"] = err.Error()
+			errors.As(err, &saturated)
+		} else {
+			accepted++
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if saturated != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(saturated.RetryAfter.Seconds()+0.999)))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"source":   source,
+		"accepted": accepted,
+		"rejected": len(messages) - accepted,
+		"results":  results,
+	})
+}
+
+// webhookMappingsHandler lists (GET) configured webhook mappings
+func (s *Server) webhookMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	mappings := s.webhooks.List()
+	for i := range mappings {
+		if mappings[i].Token != "" {
+			mappings[i].Token = "********"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mappings": mappings,
+		"count":    len(mappings),
+	})
+}
+
+// saveWebhookMappingHandler creates or replaces the mapping for /api/ingest/webhooks/{source} (PUT)
+func (s *Server) saveWebhookMappingHandler(w http.ResponseWriter, r *http.Request) {
+	var mapping webhook.Mapping
+	if err := json.NewDecoder(r.Body).Decode(&mapping); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	mapping.Source = chi.URLParam(r, "source")
+
+	saved, err := s.webhooks.Save(mapping)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving webhook mapping", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// deleteWebhookMappingHandler removes the mapping for /api/ingest/webhooks/{source} (DELETE)
+func (s *Server) deleteWebhookMappingHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.webhooks.Delete(chi.URLParam(r, "source"))
+	if err != nil {
+		writeError(w, r, "Error deleting webhook mapping", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Webhook mapping not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decoderProfilesHandler lists (GET) device profiles and the built-in decoders they can use
+func (s *Server) decoderProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	profiles := s.decoders.List()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profiles": profiles,
+		"count":    len(profiles),
+		"builtins": append(decoder.Builtins(), decoder.ExpressionDecoder),
+	})
+}
+
+// saveDecoderProfileHandler creates or replaces the profile for /api/ingest/decoders/{name} (PUT)
+func (s *Server) saveDecoderProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var profile decoder.Profile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		httpError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	profile.Name = chi.URLParam(r, "name")
+
+	saved, err := s.decoders.Save(profile)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving decoder profile", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// deleteDecoderProfileHandler removes the profile for /api/ingest/decoders/{name} (DELETE)
+func (s *Server) deleteDecoderProfileHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := s.decoders.Delete(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, "Error deleting decoder profile", err)
+		return
+	}
+	if !found {
+		httpError(w, r, "Decoder profile not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,2 +1,3 @@
+-- migrate: manual
 -- Remove message column from sensor_readings table
 ALTER TABLE sensor_readings DROP COLUMN IF EXISTS message;
\ No newline at end of file
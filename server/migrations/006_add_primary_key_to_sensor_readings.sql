@@ -1,5 +1,15 @@
+-- migrate: manual
 -- Add primary key to sensor_readings table
 -- Since this is a time-series table, we'll use a composite primary key
+-- Readings were stored without the key, so first remove duplicate (time, device_id) rows, keeping
+-- one of each (duplicates share a chunk, so tableoid and ctid pick one row)
+DELETE FROM sensor_readings a
+USING sensor_readings b
+WHERE a.time = b.time
+  AND a.device_id = b.device_id
+  AND a.tableoid = b.tableoid
+  AND a.ctid > b.ctid;
+
 ALTER TABLE sensor_readings ADD CONSTRAINT sensor_readings_pkey 
 PRIMARY KEY (time, device_id);
 
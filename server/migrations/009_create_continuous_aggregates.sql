@@ -1,3 +1,4 @@
+-- migrate: no-transaction
 -- Create hierarchical continuous aggregates for sensor data analytics
 -- This creates a pyramid structure: 5min -> hourly -> daily for optimal performance
 
@@ -64,25 +65,29 @@ GROUP BY day, device_type, location;
 SELECT add_continuous_aggregate_policy('five_min_sensor_averages',
     start_offset => INTERVAL '1 hour',
     end_offset => INTERVAL '1 minute',
-    schedule_interval => INTERVAL '1 minute');
+    schedule_interval => INTERVAL '1 minute',
+    if_not_exists => true);
 
 -- Refresh hourly aggregates every 5 minutes (depends on 5-min level)
 SELECT add_continuous_aggregate_policy('hourly_sensor_averages',
     start_offset => INTERVAL '3 hours',
     end_offset => INTERVAL '1 hour',
-    schedule_interval => INTERVAL '5 minutes');
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => true);
 
 -- Refresh daily aggregates every hour (depends on hourly level)
 SELECT add_continuous_aggregate_policy('daily_sensor_averages',
     start_offset => INTERVAL '3 days',
     end_offset => INTERVAL '1 day',
-    schedule_interval => INTERVAL '1 hour');
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => true);
 
 -- Refresh daily device activity every hour
 SELECT add_continuous_aggregate_policy('daily_device_activity',
     start_offset => INTERVAL '3 days',
     end_offset => INTERVAL '1 day',
-    schedule_interval => INTERVAL '1 hour');
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => true);
 
 -- Create indexes for better query performance
 CREATE INDEX IF NOT EXISTS idx_five_min_sensor_averages_bucket 
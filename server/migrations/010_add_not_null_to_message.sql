@@ -1,2 +1,5 @@
+-- Readings stored without a message get an empty one
+UPDATE sensor_readings SET message = '' WHERE message IS NULL;
+
 ALTER TABLE sensor_readings 
-ALTER COLUMN message SET NOT NULL;
\ No newline at end of file
+ALTER COLUMN message SET NOT NULL;
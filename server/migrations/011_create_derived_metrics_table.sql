@@ -0,0 +1,11 @@
+-- Computed metric definitions (e.g. dew point from temperature + humidity)
+-- inputs maps each expression variable to the readings it is taken from
+CREATE TABLE IF NOT EXISTS derived_metrics (
+    name TEXT PRIMARY KEY,
+    expression TEXT NOT NULL,
+    inputs JSONB NOT NULL,
+    mode TEXT NOT NULL DEFAULT 'query' CHECK (mode IN ('ingest', 'query')),
+    unit TEXT NOT NULL DEFAULT '',
+    location TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
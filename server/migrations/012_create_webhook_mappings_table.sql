@@ -0,0 +1,8 @@
+-- Mapping templates that translate third-party webhook payloads into sensor_readings rows
+CREATE TABLE IF NOT EXISTS webhook_mappings (
+    source TEXT PRIMARY KEY,
+    records TEXT NOT NULL DEFAULT '',
+    fields JSONB NOT NULL,
+    token TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
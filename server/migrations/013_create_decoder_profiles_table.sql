@@ -0,0 +1,8 @@
+-- Device profiles that decode binary LoRaWAN uplink payloads during webhook ingestion
+CREATE TABLE IF NOT EXISTS decoder_profiles (
+    name TEXT PRIMARY KEY,
+    decoder TEXT NOT NULL,
+    fields JSONB NOT NULL DEFAULT '{}',
+    value TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+-- Modbus TCP / OPC-UA endpoints polled in gateway mode
+CREATE TABLE IF NOT EXISTS poller_endpoints (
+    name TEXT PRIMARY KEY,
+    protocol TEXT NOT NULL,
+    address TEXT NOT NULL,
+    poll_interval TEXT NOT NULL DEFAULT '30s',
+    location TEXT NOT NULL DEFAULT '',
+    tags JSONB NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
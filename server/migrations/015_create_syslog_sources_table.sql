@@ -0,0 +1,6 @@
+-- Per-source parsing overrides for the syslog listener (keyed by hostname or sender IP)
+CREATE TABLE IF NOT EXISTS syslog_sources (
+    source TEXT PRIMARY KEY,
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,6 @@
+-- Alarm email formats mapped onto devices by the inbound email webhook
+CREATE TABLE IF NOT EXISTS email_rules (
+    name TEXT PRIMARY KEY,
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
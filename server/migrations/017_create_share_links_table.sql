@@ -0,0 +1,13 @@
+-- Tokenized read-only share links; only the SHA-256 of the token is stored
+CREATE TABLE IF NOT EXISTS share_links (
+    id TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    params JSONB NOT NULL DEFAULT '{}',
+    snapshot JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_expires_at ON share_links (expires_at);
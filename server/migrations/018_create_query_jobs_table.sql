@@ -0,0 +1,16 @@
+-- Asynchronous analytical query jobs and their results
+CREATE TABLE IF NOT EXISTS query_jobs (
+    id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    params JSONB NOT NULL DEFAULT '{}',
+    role TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    error TEXT,
+    result JSONB,
+    row_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_query_jobs_created_at ON query_jobs (created_at DESC);
@@ -0,0 +1,13 @@
+-- Device registry; last_seen is flushed periodically from ingestion rather than on every reading
+CREATE TABLE IF NOT EXISTS devices (
+    id TEXT PRIMARY KEY,
+    device_type TEXT NOT NULL,
+    location TEXT NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen TIMESTAMPTZ,
+    decommissioned_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_type_location ON devices (device_type, location);
@@ -0,0 +1,5 @@
+-- Server receive time alongside the device-reported time; NULL for readings stored before this column existed
+ALTER TABLE sensor_readings ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ;
+ALTER TABLE sensor_readings ALTER COLUMN ingested_at SET DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_sensor_readings_ingested_at ON sensor_readings (ingested_at DESC);
@@ -0,0 +1,5 @@
+-- Free-form device extras (battery %, RSSI, firmware build) without a migration per field
+ALTER TABLE sensor_readings ADD COLUMN IF NOT EXISTS metadata JSONB;
+
+-- jsonb_path_ops serves the @> containment filters of the logs API
+CREATE INDEX IF NOT EXISTS idx_sensor_readings_metadata ON sensor_readings USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,18 @@
+-- Latest battery and signal strength per device, flushed periodically from reading metadata
+CREATE TABLE IF NOT EXISTS device_vitals (
+    device_id TEXT PRIMARY KEY,
+    device_type TEXT NOT NULL DEFAULT '',
+    location TEXT NOT NULL DEFAULT '',
+    battery DOUBLE PRECISION,
+    battery_at TIMESTAMPTZ,
+    rssi DOUBLE PRECISION,
+    rssi_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Low-battery and weak-signal alert rules
+CREATE TABLE IF NOT EXISTS vitals_rules (
+    name TEXT PRIMARY KEY,
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,14 @@
+-- Per-device statistics learned from recent readings; anomaly detection scores values against them
+-- hourly is the seasonal profile: [{"hour", "samples", "mean", "variance"}] for each UTC hour of day seen
+CREATE TABLE IF NOT EXISTS device_baselines (
+    device_id TEXT PRIMARY KEY,
+    device_type TEXT NOT NULL DEFAULT '',
+    location TEXT NOT NULL DEFAULT '',
+    samples BIGINT NOT NULL,
+    mean DOUBLE PRECISION NOT NULL,
+    variance DOUBLE PRECISION NOT NULL,
+    hourly JSONB NOT NULL DEFAULT '[]',
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,18 @@
+-- Embeddings of stored readings for semantic search, written by the embedding pipeline
+-- Keyed like sensor_readings so a reading is embedded once; the reading's fields are copied so search needs no join
+CREATE TABLE IF NOT EXISTS sensor_readings_embeddings (
+    time TIMESTAMPTZ NOT NULL,
+    device_id TEXT NOT NULL,
+    device_type TEXT NOT NULL DEFAULT '',
+    location TEXT NOT NULL DEFAULT '',
+    raw_value NUMERIC,
+    unit TEXT NOT NULL DEFAULT '',
+    log_type TEXT NOT NULL DEFAULT 'INFO',
+    message TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL,
+    embedding vector(1536) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (time, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_readings_embeddings_vector ON sensor_readings_embeddings USING ivfflat (embedding vector_cosine_ops) WITH (lists = 100);
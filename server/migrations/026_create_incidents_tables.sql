@@ -0,0 +1,37 @@
+-- Incidents group related alerts and anomalies; device_ids and locations are JSON arrays
+CREATE TABLE IF NOT EXISTS incidents (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    summary TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open',
+    severity TEXT NOT NULL,
+    device_ids JSONB NOT NULL DEFAULT '[]',
+    locations JSONB NOT NULL DEFAULT '[]',
+    signal_count INTEGER NOT NULL DEFAULT 0,
+    first_seen TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_incidents_status_last_seen ON incidents (status, last_seen DESC);
+
+-- The alerts and anomalies of each incident; key identifies a signal so repeats are recorded once
+CREATE TABLE IF NOT EXISTS incident_signals (
+    key TEXT PRIMARY KEY,
+    incident_id TEXT NOT NULL REFERENCES incidents (id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    type TEXT NOT NULL DEFAULT '',
+    severity TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    device_type TEXT NOT NULL DEFAULT '',
+    location TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    time TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_incident_signals_incident ON incident_signals (incident_id, time);
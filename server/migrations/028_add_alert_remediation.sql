@@ -0,0 +1,2 @@
+-- Remediation suggested for alerts whose rule has suggest_remediation
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS remediation TEXT NOT NULL DEFAULT '';
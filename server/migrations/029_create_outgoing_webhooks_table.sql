@@ -0,0 +1,6 @@
+-- Outgoing webhooks that receive every rule alert and detected anomaly
+CREATE TABLE IF NOT EXISTS outgoing_webhooks (
+    name TEXT PRIMARY KEY,
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
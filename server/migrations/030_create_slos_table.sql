@@ -0,0 +1,6 @@
+-- Service level objectives over reading delivery and error logs
+CREATE TABLE IF NOT EXISTS slos (
+    name TEXT PRIMARY KEY,
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
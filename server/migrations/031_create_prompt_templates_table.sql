@@ -0,0 +1,12 @@
+-- Versioned system prompts for the AI endpoints; at most one version of each prompt is active
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (name, version)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS prompt_templates_active_idx ON prompt_templates (name) WHERE active;
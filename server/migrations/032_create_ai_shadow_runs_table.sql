@@ -0,0 +1,12 @@
+-- AI requests also run against a candidate prompt/model, recorded for offline comparison
+CREATE TABLE IF NOT EXISTS ai_shadow_runs (
+    id BIGSERIAL PRIMARY KEY,
+    time TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    kind TEXT NOT NULL,
+    query TEXT NOT NULL,
+    primary_run JSONB NOT NULL,
+    candidate_run JSONB NOT NULL,
+    same_output BOOLEAN NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ai_shadow_runs_time_idx ON ai_shadow_runs (time DESC);
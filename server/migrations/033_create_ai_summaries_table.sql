@@ -0,0 +1,14 @@
+-- Log summaries written on a schedule, kept as a history of digests
+CREATE TABLE IF NOT EXISTS ai_summaries (
+    id BIGSERIAL PRIMARY KEY,
+    schedule TEXT NOT NULL,
+    time TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    time_range TEXT NOT NULL,
+    language TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    key_insights JSONB NOT NULL DEFAULT '[]',
+    log_count INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ai_summaries_schedule_time_idx ON ai_summaries (schedule, time DESC);
+CREATE INDEX IF NOT EXISTS ai_summaries_time_idx ON ai_summaries (time DESC);
@@ -0,0 +1,15 @@
+-- Daily message template counts per device, flushed periodically from stored readings
+-- (see internal/logtemplate); the most frequent templates are read from here instead of raw readings
+CREATE TABLE IF NOT EXISTS message_templates_daily (
+    day DATE NOT NULL,
+    device_id TEXT NOT NULL,
+    log_type TEXT NOT NULL,
+    template TEXT NOT NULL,
+    count BIGINT NOT NULL,
+    example TEXT NOT NULL,
+    first_seen TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (day, device_id, log_type, template)
+);
+
+CREATE INDEX IF NOT EXISTS message_templates_daily_device_idx ON message_templates_daily (device_id, day DESC);
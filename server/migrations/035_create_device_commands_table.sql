@@ -0,0 +1,20 @@
+-- Commands sent to devices over /ws and what became of them, kept as an audit trail
+CREATE TABLE IF NOT EXISTS device_commands (
+    id TEXT PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    command TEXT NOT NULL,
+    params JSONB,
+    issued_by TEXT NOT NULL,
+    issuer_role TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    issued_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    delivered_at TIMESTAMPTZ,
+    acknowledged_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    result JSONB,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS device_commands_device_time_idx ON device_commands (device_id, issued_at DESC);
+CREATE INDEX IF NOT EXISTS device_commands_queued_idx ON device_commands (device_id) WHERE status = 'queued';
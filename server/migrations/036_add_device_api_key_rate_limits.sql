@@ -0,0 +1,3 @@
+-- Per-key rate limits for POST /api/ingest; NULL uses INGEST_RATE_LIMIT and INGEST_RATE_BURST
+ALTER TABLE device_api_keys ADD COLUMN IF NOT EXISTS rate_limit INTEGER;
+ALTER TABLE device_api_keys ADD COLUMN IF NOT EXISTS rate_burst INTEGER;
@@ -0,0 +1,27 @@
+-- Commands sent to a group of devices in stages, pausing when too many of a stage's commands fail
+CREATE TABLE IF NOT EXISTS command_rollouts (
+    id TEXT PRIMARY KEY,
+    command TEXT NOT NULL,
+    params JSONB,
+    target JSONB NOT NULL,
+    devices JSONB NOT NULL,
+    stages JSONB NOT NULL,
+    failure_threshold DOUBLE PRECISION NOT NULL,
+    stage_timeout TEXT NOT NULL,
+    status TEXT NOT NULL,
+    stage INTEGER NOT NULL DEFAULT 1,
+    stage_started_at TIMESTAMPTZ NOT NULL,
+    waived_stage INTEGER NOT NULL DEFAULT 0,
+    paused_reason TEXT,
+    issued_by TEXT NOT NULL,
+    issuer_role TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS command_rollouts_created_idx ON command_rollouts (created_at DESC);
+
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS rollout_id TEXT;
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS stage INTEGER;
+
+CREATE INDEX IF NOT EXISTS device_commands_rollout_idx ON device_commands (rollout_id, stage) WHERE rollout_id IS NOT NULL;
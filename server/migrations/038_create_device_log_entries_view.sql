@@ -0,0 +1,15 @@
+-- Compatibility for readers of the legacy device_logs table while its history moves to sensor_readings
+-- device_log_entries is sensor_readings in the device_logs shape plus the device_logs rows not copied yet
+-- (the device_logs_backfill query job copies them), so readers see the same logs however far the copy has got
+CREATE INDEX IF NOT EXISTS idx_sensor_readings_device_time ON sensor_readings (device_id, time DESC);
+
+CREATE OR REPLACE VIEW device_log_entries AS
+SELECT time, device_id, log_type, COALESCE(message, '') AS message
+FROM sensor_readings
+UNION ALL
+SELECT l.time, l.device_id, l.log_type, l.message
+FROM device_logs l
+WHERE NOT EXISTS (
+    SELECT 1 FROM sensor_readings r
+    WHERE r.device_id = l.device_id AND r.time = l.time AND r.message IS NOT DISTINCT FROM l.message
+);
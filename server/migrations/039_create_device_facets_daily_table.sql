@@ -0,0 +1,13 @@
+-- Daily reading counts per device and value combination, flushed periodically from stored readings
+-- (see internal/facets); the distinct values behind filter dropdowns are read from here instead of raw readings
+CREATE TABLE IF NOT EXISTS device_facets_daily (
+    day DATE NOT NULL,
+    device_id TEXT NOT NULL,
+    device_type TEXT NOT NULL,
+    location TEXT NOT NULL,
+    unit TEXT NOT NULL,
+    log_type TEXT NOT NULL,
+    count BIGINT NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (day, device_id, device_type, location, unit, log_type)
+);
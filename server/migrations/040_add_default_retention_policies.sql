@@ -0,0 +1,9 @@
+-- migrate: manual
+-- Suggested retention: raw readings are kept 30 days and the continuous aggregates a year
+-- Nothing is dropped unless an operator opts in, by running this file or setting policies
+-- through /api/admin/retention
+SELECT add_retention_policy('sensor_readings', drop_after => INTERVAL '30 days', if_not_exists => true);
+
+SELECT add_retention_policy(format('%I', view_name)::regclass, drop_after => INTERVAL '365 days', if_not_exists => true)
+FROM timescaledb_information.continuous_aggregates
+WHERE view_schema = current_schema();
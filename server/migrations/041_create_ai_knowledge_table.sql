@@ -0,0 +1,19 @@
+-- Embedded conclusions for semantic search: scheduled summaries, incident narratives and notes,
+-- anomaly explanations and suggested remediations (see internal/ai/knowledge.go)
+-- One row per source, rewritten when its text changes
+CREATE TABLE IF NOT EXISTS ai_knowledge (
+    kind TEXT NOT NULL,
+    source_id TEXT NOT NULL,
+    time TIMESTAMPTZ NOT NULL,
+    device_ids JSONB NOT NULL DEFAULT '[]',
+    locations JSONB NOT NULL DEFAULT '[]',
+    title TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    model TEXT NOT NULL,
+    embedding vector(1536) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (kind, source_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_knowledge_vector ON ai_knowledge USING ivfflat (embedding vector_cosine_ops) WITH (lists = 100);
@@ -0,0 +1,7 @@
+-- Hybrid search: a keyword vector of each embedded message, scored alongside the embedding's
+-- distance, and an index for the time range filter of /api/ai/search
+ALTER TABLE sensor_readings_embeddings
+    ADD COLUMN IF NOT EXISTS message_tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', message)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_readings_embeddings_tsv ON sensor_readings_embeddings USING gin (message_tsv);
+CREATE INDEX IF NOT EXISTS idx_readings_embeddings_time ON sensor_readings_embeddings (time DESC);
@@ -0,0 +1,2 @@
+-- How the uplink payload of a webhook source is encoded, base64 or hex (empty means base64)
+ALTER TABLE webhook_mappings ADD COLUMN IF NOT EXISTS payload_encoding TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,195 @@
+package simdevice
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// DefaultLogTypes are the severity weights used when none are configured
+// Mostly INFO with rare errors, so error-rate anomalies have something to stand out from
+var DefaultLogTypes = map[string]float64{"INFO": 0.75, "DEBUG": 0.12, "WARN": 0.09, "ERROR": 0.04}
+
+// DefaultBurstLogTypes are the severity weights during a burst of a bursty arrival pattern
+var DefaultBurstLogTypes = map[string]float64{"INFO": 0.3, "DEBUG": 0.05, "WARN": 0.35, "ERROR": 0.3}
+
+// severityTable picks log types by weight; keys are sorted so a seeded fleet is reproducible
+type severityTable struct {
+	names []string
+	cum   []float64
+}
+
+func newSeverityTable(weights map[string]float64) (severityTable, error) {
+	var t severityTable
+	for name := range weights {
+		t.names = append(t.names, name)
+	}
+	sort.Strings(t.names)
+
+	total := 0.0
+	for _, name := range t.names {
+		w := weights[name]
+		if w < 0 {
+			return severityTable{}, fmt.Errorf("log type %s has negative weight %g", name, w)
+		}
+		total += w
+		t.cum = append(t.cum, total)
+	}
+	if total <= 0 {
+		return severityTable{}, fmt.Errorf("log type weights must sum to more than 0")
+	}
+	for i := range t.cum {
+		t.cum[i] /= total
+	}
+	return t, nil
+}
+
+// mustSeverityTable is newSeverityTable for weights that fall back to defaults when invalid
+func mustSeverityTable(weights, fallback map[string]float64) severityTable {
+	if t, err := newSeverityTable(weights); err == nil {
+		return t
+	}
+	t, _ := newSeverityTable(fallback)
+	return t
+}
+
+func (t severityTable) pick(rng *rand.Rand) string {
+	x := rng.Float64()
+	i := sort.SearchFloat64s(t.cum, x)
+	if i >= len(t.names) {
+		i = len(t.names) - 1
+	}
+	return t.names[i]
+}
+
+// Pattern is how a device's readings are spaced in time
+type Pattern string
+
+const (
+	ArrivalFixed   Pattern = "fixed"   // exactly every Interval
+	ArrivalPoisson Pattern = "poisson" // exponential gaps averaging Interval
+	ArrivalBursty  Pattern = "bursty"  // Poisson, alternating quiet periods and bursts of faster, noisier readings
+)
+
+// Arrival configures the arrival pattern of a scenario
+type Arrival struct {
+	Pattern       Pattern            `json:"pattern"`
+	MeanOn        time.Duration      `json:"mean_on,omitempty"`         // bursty: mean burst length (default 5m)
+	MeanOff       time.Duration      `json:"mean_off,omitempty"`        // bursty: mean quiet length (default 30m)
+	BurstRate     float64            `json:"burst_rate,omitempty"`      // bursty: reading rate multiplier during a burst (default 10)
+	BurstLogTypes map[string]float64 `json:"burst_log_types,omitempty"` // bursty: severity weights during a burst
+}
+
+// Validate checks the pattern name and burst severity weights
+func (a Arrival) Validate() error {
+	switch a.Pattern {
+	case "", ArrivalFixed, ArrivalPoisson, ArrivalBursty:
+	default:
+		return fmt.Errorf("unknown arrival pattern %q", a.Pattern)
+	}
+	if a.MeanOn < 0 || a.MeanOff < 0 || a.BurstRate < 0 {
+		return fmt.Errorf("burst settings must not be negative")
+	}
+	if len(a.BurstLogTypes) > 0 {
+		if _, err := newSeverityTable(a.BurstLogTypes); err != nil {
+			return fmt.Errorf("burst_log_types: %w", err)
+		}
+	}
+	return nil
+}
+
+func (a Arrival) withDefaults() Arrival {
+	if a.Pattern == "" {
+		a.Pattern = ArrivalFixed
+	}
+	if a.MeanOn <= 0 {
+		a.MeanOn = 5 * time.Minute
+	}
+	if a.MeanOff <= 0 {
+		a.MeanOff = 30 * time.Minute
+	}
+	if a.BurstRate <= 0 {
+		a.BurstRate = 10
+	}
+	if len(a.BurstLogTypes) == 0 {
+		a.BurstLogTypes = DefaultBurstLogTypes
+	}
+	return a
+}
+
+// arrivalState is one device's position in its arrival process
+type arrivalState struct {
+	next     time.Time
+	index    int // device order, breaks ties between readings at the same time
+	inBurst  bool
+	phaseEnd time.Time
+}
+
+// exp draws an exponentially distributed duration with the given mean
+func exp(rng *rand.Rand, mean time.Duration) time.Duration {
+	return time.Duration(rng.ExpFloat64() * float64(mean))
+}
+
+// first places a device's first reading at or after start
+func (a Arrival) first(rng *rand.Rand, st *arrivalState, start time.Time, interval time.Duration) {
+	switch a.Pattern {
+	case ArrivalFixed:
+		st.next = start
+	case ArrivalBursty:
+		// Start each device at a random point of a quiet period so bursts are not synchronised
+		st.phaseEnd = start.Add(exp(rng, a.MeanOff))
+		a.advance(rng, st, start, interval)
+	default:
+		st.next = start.Add(exp(rng, interval))
+	}
+}
+
+// advance moves st.next to the reading after t
+func (a Arrival) advance(rng *rand.Rand, st *arrivalState, t time.Time, interval time.Duration) {
+	switch a.Pattern {
+	case ArrivalFixed:
+		st.next = t.Add(interval)
+	case ArrivalPoisson:
+		st.next = t.Add(exp(rng, interval))
+	case ArrivalBursty:
+		for {
+			mean := interval
+			if st.inBurst {
+				mean = time.Duration(float64(interval) / a.BurstRate)
+			}
+			next := t.Add(exp(rng, mean))
+			if next.Before(st.phaseEnd) {
+				st.next = next
+				return
+			}
+			// Exponential gaps are memoryless, so redraw from the phase boundary at the new rate
+			t = st.phaseEnd
+			st.inBurst = !st.inBurst
+			if st.inBurst {
+				st.phaseEnd = t.Add(exp(rng, a.MeanOn))
+			} else {
+				st.phaseEnd = t.Add(exp(rng, a.MeanOff))
+			}
+		}
+	}
+}
+
+// arrivalQueue orders devices by their next reading
+type arrivalQueue []*arrivalState
+
+func (q arrivalQueue) Len() int { return len(q) }
+func (q arrivalQueue) Less(i, j int) bool {
+	if q[i].next.Equal(q[j].next) {
+		return q[i].index < q[j].index
+	}
+	return q[i].next.Before(q[j].next)
+}
+func (q arrivalQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *arrivalQueue) Push(x interface{}) { *q = append(*q, x.(*arrivalState)) }
+func (q *arrivalQueue) Pop() interface{} {
+	old := *q
+	st := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return st
+}
@@ -0,0 +1,94 @@
+package simdevice
+
+import (
+	"fmt"
+	"time"
+)
+
+// FaultKind is a kind of misbehaviour that can be injected into a device
+type FaultKind string
+
+const (
+	FaultSpike      FaultKind = "spike"       // adds Magnitude to every value
+	FaultDrift      FaultKind = "drift"       // adds Magnitude per hour since the fault started
+	FaultStuck      FaultKind = "stuck"       // repeats the value from when the fault started
+	FaultDropout    FaultKind = "dropout"     // stops reporting
+	FaultErrorStorm FaultKind = "error_storm" // every reading is logged as ERROR
+)
+
+// Fault is injected with Fleet.InjectFault; Duration 0 means until cleared
+type Fault struct {
+	Kind      FaultKind     `json:"kind"`
+	Magnitude float64       `json:"magnitude,omitempty"`
+	Start     time.Time     `json:"start,omitempty"` // defaults to the next reading's time
+	Duration  time.Duration `json:"duration,omitempty"`
+}
+
+type activeFault struct {
+	Fault
+	until     time.Time
+	stuck     float64
+	haveStuck bool
+}
+
+// activeAt reports whether the fault applies at t, anchoring a fault without a Start to the first reading
+func (a *activeFault) activeAt(t time.Time) bool {
+	if a.Start.IsZero() {
+		a.Start = t
+		if a.Duration > 0 {
+			a.until = t.Add(a.Duration)
+		}
+	}
+	return !t.Before(a.Start)
+}
+
+func (a *activeFault) apply(value float64, t time.Time) float64 {
+	switch a.Kind {
+	case FaultSpike:
+		return value + a.Magnitude
+	case FaultDrift:
+		return value + a.Magnitude*t.Sub(a.Start).Hours()
+	case FaultStuck:
+		if !a.haveStuck {
+			a.stuck, a.haveStuck = value, true
+		}
+		return a.stuck
+	}
+	return value
+}
+
+// InjectFault makes a device misbehave until the fault's Duration has passed (in simulated time)
+func (f *Fleet) InjectFault(deviceID string, fault Fault) error {
+	switch fault.Kind {
+	case FaultSpike, FaultDrift, FaultStuck, FaultDropout, FaultErrorStorm:
+	default:
+		return fmt.Errorf("unknown fault kind %q", fault.Kind)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("unknown device %q", deviceID)
+	}
+
+	active := &activeFault{Fault: fault, until: farFuture}
+	if !fault.Start.IsZero() && fault.Duration > 0 {
+		active.until = fault.Start.Add(fault.Duration)
+	}
+	d.fault = active
+	return nil
+}
+
+// ClearFault removes any fault from a device
+func (f *Fleet) ClearFault(deviceID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if d, ok := f.devices[deviceID]; ok {
+		d.fault = nil
+	}
+}
+
+var farFuture = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
@@ -0,0 +1,216 @@
+// Package simdevice simulates fleets of IoT devices so tests and tools can drive realistic
+// traffic into the platform in-process, over WebSocket, or into any other Sink
+//
+//	fleet := simdevice.CreateFleet(simdevice.FleetConfig{Seed: 1})
+//	fleet.InjectFault("temperature_sensor_001", simdevice.Fault{Kind: simdevice.FaultSpike, Magnitude: 40})
+//	stats, err := fleet.RunScenario(ctx, simdevice.Scenario{Duration: time.Hour, Interval: 10 * time.Second}, sink)
+package simdevice
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"edge-insights/internal/devicetypes"
+	"edge-insights/internal/types"
+)
+
+// Profile describes how one device type reports
+type Profile struct {
+	Type     string
+	Unit     string
+	Base     float64       // typical value
+	Noise    float64       // standard deviation around Base
+	Boolean  bool          // reports 0/1 instead of a continuous value
+	Silent   bool          // reports log lines without a value (cameras, controllers)
+	Label    string        // used in generated messages, e.g. "Temperature"
+	Interval time.Duration // time between readings when the scenario sets none (default 10s)
+}
+
+// DefaultProfiles returns a profile for every registered device type (see devicetypes), the
+// device types the dashboards and text-to-SQL prompt know about
+func DefaultProfiles() []Profile {
+	var profiles []Profile
+	for _, t := range devicetypes.All() {
+		profiles = append(profiles, ProfileOf(t))
+	}
+	return profiles
+}
+
+// ProfileOf simulates devices of a registered type
+func ProfileOf(t devicetypes.Type) Profile {
+	return Profile{
+		Type:     t.Name,
+		Unit:     t.Unit,
+		Base:     t.Typical,
+		Noise:    t.Noise,
+		Boolean:  t.Boolean,
+		Silent:   t.Silent,
+		Label:    t.Label,
+		Interval: t.Interval(),
+	}
+}
+
+// DefaultLocations are the sites devices are spread across
+var DefaultLocations = []string{"warehouse_a", "warehouse_b", "office_floor_1", "parking_lot", "server_room"}
+
+// FleetConfig controls CreateFleet; zero values fall back to the defaults
+type FleetConfig struct {
+	Profiles   []Profile
+	Locations  []string
+	PerProfile int                // devices per profile (default 3)
+	Seed       int64              // random seed; 0 uses the current time
+	LogTypes   map[string]float64 // severity weights, e.g. {"INFO": 0.9, "ERROR": 0.1}; invalid weights fall back to DefaultLogTypes
+}
+
+// Device is one simulated device
+type Device struct {
+	ID       string
+	Location string
+	Profile  Profile
+
+	last  float64
+	fault *activeFault
+}
+
+// Fleet is a set of simulated devices sharing a random source
+type Fleet struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	devices  map[string]*Device
+	order    []string
+	logTypes severityTable
+}
+
+// CreateFleet builds PerProfile devices of every profile, assigned round-robin to locations
+// Device IDs are <type>_<nnn>, e.g. temperature_sensor_001
+func CreateFleet(cfg FleetConfig) *Fleet {
+	if len(cfg.Profiles) == 0 {
+		cfg.Profiles = DefaultProfiles()
+	}
+	if len(cfg.Locations) == 0 {
+		cfg.Locations = DefaultLocations
+	}
+	if cfg.PerProfile <= 0 {
+		cfg.PerProfile = 3
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	f := &Fleet{
+		rng:      rand.New(rand.NewSource(cfg.Seed)),
+		devices:  make(map[string]*Device),
+		logTypes: mustSeverityTable(cfg.LogTypes, DefaultLogTypes),
+	}
+	n := 0
+	for _, p := range cfg.Profiles {
+		for i := 1; i <= cfg.PerProfile; i++ {
+			d := &Device{
+				ID:       fmt.Sprintf("%s_%03d", p.Type, i),
+				Location: cfg.Locations[n%len(cfg.Locations)],
+				Profile:  p,
+				last:     p.Base,
+			}
+			f.devices[d.ID] = d
+			f.order = append(f.order, d.ID)
+			n++
+		}
+	}
+	sort.Strings(f.order)
+	return f
+}
+
+// Devices returns the fleet's devices sorted by ID
+func (f *Fleet) Devices() []*Device {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	devices := make([]*Device, 0, len(f.order))
+	for _, id := range f.order {
+		devices = append(devices, f.devices[id])
+	}
+	return devices
+}
+
+// Reading generates the next reading of a device at time t, applying any active fault
+// It returns false when the device is silent (a dropout fault)
+func (f *Fleet) Reading(deviceID string, t time.Time) (types.LogMessage, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.devices[deviceID]
+	if !ok {
+		return types.LogMessage{}, false
+	}
+	return f.readingLocked(d, t, f.logTypes)
+}
+
+func (f *Fleet) readingLocked(d *Device, t time.Time, logTypes severityTable) (types.LogMessage, bool) {
+	p := d.Profile
+	msg := types.LogMessage{
+		Time:       t,
+		DeviceID:   d.ID,
+		DeviceType: p.Type,
+		Location:   d.Location,
+		Unit:       p.Unit,
+		LogType:    logTypes.pick(f.rng),
+	}
+
+	fault := d.fault
+	if fault != nil && !fault.activeAt(t) {
+		fault = nil
+	} else if fault != nil && !t.Before(fault.until) {
+		d.fault, fault = nil, nil
+	}
+	if fault != nil && fault.Kind == FaultDropout {
+		return types.LogMessage{}, false
+	}
+
+	if !p.Silent {
+		var value float64
+		switch {
+		case p.Boolean:
+			if f.rng.Float64() < p.Base {
+				value = 1
+			}
+		default:
+			// Random walk around the base value so consecutive readings are correlated
+			value = d.last + 0.3*(p.Base-d.last) + f.rng.NormFloat64()*p.Noise*0.5
+			d.last = value
+		}
+		if fault != nil {
+			value = fault.apply(value, t)
+		}
+		value = math.Round(value*100) / 100
+		msg.RawValue = &value
+	}
+
+	if fault != nil && fault.Kind == FaultErrorStorm {
+		msg.LogType = "ERROR"
+	}
+	msg.Message = message(p, msg)
+	return msg, true
+}
+
+func message(p Profile, msg types.LogMessage) string {
+	if msg.RawValue == nil {
+		switch msg.LogType {
+		case "ERROR":
+			return fmt.Sprintf("%s %s reported a fault", p.Label, msg.DeviceID)
+		case "WARN":
+			return fmt.Sprintf("%s %s degraded performance", p.Label, msg.DeviceID)
+		}
+		return fmt.Sprintf("%s %s status OK", p.Label, msg.DeviceID)
+	}
+	if p.Boolean {
+		if *msg.RawValue > 0.5 {
+			return fmt.Sprintf("%s detected at %s", p.Label, msg.Location)
+		}
+		return fmt.Sprintf("No %s at %s", p.Label, msg.Location)
+	}
+	return fmt.Sprintf("%s reading: %s", p.Label, devicetypes.FormatValue(p.Type, *msg.RawValue, p.Unit))
+}
@@ -0,0 +1,196 @@
+package simdevice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+
+	"github.com/gorilla/websocket"
+)
+
+// LatencyRecorder measures end-to-end latency of readings sent through a wrapped Sink:
+// ack latency (send until the sink confirms the store) and broadcast latency (send until
+// the reading shows up on the live feed)
+//
+//	rec := simdevice.NewLatencyRecorder()
+//	rec.Listen(ctx, "ws://localhost:8080/ws", "")   // or handler.OnStored(rec.ObserveNow) in-process
+//	fleet.RunScenario(ctx, scenario, rec.Wrap(sink))
+//	fmt.Println(rec.Report())
+type LatencyRecorder struct {
+	mu        sync.Mutex
+	sent      map[string]time.Time // reading key -> wall time it was sent
+	ack       []time.Duration
+	broadcast []time.Duration
+}
+
+// NewLatencyRecorder creates an empty recorder
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{sent: make(map[string]time.Time)}
+}
+
+// readingKey identifies a reading on the feed; sensor_readings is keyed on (time, device_id) too
+func readingKey(msg types.LogMessage) string {
+	return msg.DeviceID + "|" + msg.Time.UTC().Format(time.RFC3339Nano)
+}
+
+// Wrap returns a Sink that timestamps every send and records its ack latency
+func (r *LatencyRecorder) Wrap(sink Sink) Sink {
+	return latencySink{recorder: r, sink: sink}
+}
+
+type latencySink struct {
+	recorder *LatencyRecorder
+	sink     Sink
+}
+
+func (s latencySink) Send(ctx context.Context, msg types.LogMessage) error {
+	key := readingKey(msg)
+	start := time.Now()
+
+	s.recorder.mu.Lock()
+	s.recorder.sent[key] = start
+	s.recorder.mu.Unlock()
+
+	err := s.sink.Send(ctx, msg)
+	elapsed := time.Since(start)
+
+	s.recorder.mu.Lock()
+	if err != nil {
+		delete(s.recorder.sent, key)
+	} else {
+		s.recorder.ack = append(s.recorder.ack, elapsed)
+	}
+	s.recorder.mu.Unlock()
+	return err
+}
+
+// Observe records that msg reached the live feed at t; readings not sent through Wrap are ignored
+func (r *LatencyRecorder) Observe(msg types.LogMessage, t time.Time) {
+	key := readingKey(msg)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if start, ok := r.sent[key]; ok {
+		r.broadcast = append(r.broadcast, t.Sub(start))
+		delete(r.sent, key)
+	}
+}
+
+// ObserveNow is Observe at the current time, suitable for Handler.OnStored
+func (r *LatencyRecorder) ObserveNow(msg types.LogMessage) {
+	r.Observe(msg, time.Now())
+}
+
+// Listen subscribes to the server's live feed and observes log_entry broadcasts until ctx is done
+// It returns once connected, so readings sent afterwards are not missed; the channel receives
+// the error that ended the feed (nil when ctx was cancelled)
+func (r *LatencyRecorder) Listen(ctx context.Context, url, apiKey string) (<-chan error, error) {
+	header := http.Header{}
+	if apiKey != "" {
+		header.Set("X-API-Key", apiKey)
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			received := time.Now()
+			if err != nil {
+				if ctx.Err() != nil {
+					err = nil
+				}
+				done <- err
+				return
+			}
+			var event struct {
+				Type types.EventType  `json:"type"`
+				Data types.LogMessage `json:"data"`
+			}
+			if json.Unmarshal(data, &event) == nil && event.Type == types.EventLogEntry {
+				r.Observe(event.Data, received)
+			}
+		}
+	}()
+	return done, nil
+}
+
+// Percentiles summarises a latency distribution
+type Percentiles struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+func (p Percentiles) String() string {
+	return fmt.Sprintf("n=%d mean=%s p50=%s p95=%s p99=%s max=%s",
+		p.Count, p.Mean, p.P50, p.P95, p.P99, p.Max)
+}
+
+// LatencyReport is the latency distribution of a run
+type LatencyReport struct {
+	Ack       Percentiles `json:"ack"`       // send until the store was acknowledged
+	Broadcast Percentiles `json:"broadcast"` // send until the reading appeared on the live feed
+	Pending   int         `json:"pending"`   // acknowledged readings not (yet) seen on the feed
+}
+
+func (r LatencyReport) String() string {
+	return fmt.Sprintf("ack: %s\nbroadcast: %s\npending: %d", r.Ack, r.Broadcast, r.Pending)
+}
+
+// Report computes the distributions recorded so far
+func (r *LatencyRecorder) Report() LatencyReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return LatencyReport{
+		Ack:       percentiles(r.ack),
+		Broadcast: percentiles(r.broadcast),
+		Pending:   len(r.sent),
+	}
+}
+
+// percentiles uses the nearest-rank method
+func percentiles(samples []time.Duration) Percentiles {
+	if len(samples) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	rank := func(p float64) time.Duration {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return Percentiles{
+		Count: len(sorted),
+		Mean:  total / time.Duration(len(sorted)),
+		P50:   rank(0.50),
+		P95:   rank(0.95),
+		P99:   rank(0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
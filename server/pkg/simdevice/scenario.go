@@ -0,0 +1,188 @@
+package simdevice
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"time"
+)
+
+// ScheduledFault injects a fault into a device at an offset from the scenario start
+type ScheduledFault struct {
+	DeviceID string        `json:"device_id"`
+	At       time.Duration `json:"at"`
+	Fault    Fault         `json:"fault"`
+}
+
+// Scenario describes a simulation run
+type Scenario struct {
+	Duration time.Duration // simulated time covered by the run (default one Interval, or 10s)
+	Interval time.Duration // mean time between readings of each device (default its profile's, else 10s)
+	Start    time.Time     // first reading time (default now, or now-Duration for backfills)
+	// Realtime paces readings on the wall clock; otherwise readings are sent as fast as the sink
+	// accepts them with simulated timestamps, which suits backfills and tests
+	Realtime bool
+	Faults   []ScheduledFault
+	LogTypes map[string]float64 // severity weights for this run; empty uses the fleet's
+	Arrival  Arrival            // how readings are spaced (default fixed)
+}
+
+// Validate checks the severity weights and arrival pattern
+func (sc Scenario) Validate() error {
+	if sc.Duration < 0 || sc.Interval < 0 {
+		return fmt.Errorf("duration and interval must not be negative")
+	}
+	if len(sc.LogTypes) > 0 {
+		if _, err := newSeverityTable(sc.LogTypes); err != nil {
+			return fmt.Errorf("log_types: %w", err)
+		}
+	}
+	return sc.Arrival.Validate()
+}
+
+// intervalOf is the mean time between readings of a device in the scenario
+func (sc Scenario) intervalOf(d *Device) time.Duration {
+	if sc.Interval > 0 {
+		return sc.Interval
+	}
+	if d.Profile.Interval > 0 {
+		return d.Profile.Interval
+	}
+	return 10 * time.Second
+}
+
+// Stats summarises a scenario run
+type Stats struct {
+	Sent     int            `json:"sent"`
+	Failed   int            `json:"failed"`
+	Dropped  int            `json:"dropped"` // readings suppressed by dropout faults
+	Bursts   int            `json:"bursts"`  // readings sent during a burst of a bursty arrival pattern
+	ByType   map[string]int `json:"by_log_type"`
+	LastErr  error          `json:"-"`
+	Duration time.Duration  `json:"duration"`
+}
+
+// RunScenario sends readings from every device following the scenario's arrival pattern until
+// Duration of simulated time has passed or ctx is cancelled. Sink errors are counted, not fatal;
+// ctx errors stop the run
+func (f *Fleet) RunScenario(ctx context.Context, sc Scenario, sink Sink) (Stats, error) {
+	if err := sc.Validate(); err != nil {
+		return Stats{}, err
+	}
+	if sc.Duration == 0 {
+		sc.Duration = sc.Interval
+		if sc.Duration == 0 {
+			sc.Duration = 10 * time.Second
+		}
+	}
+	if sc.Start.IsZero() {
+		sc.Start = time.Now()
+		if !sc.Realtime {
+			sc.Start = sc.Start.Add(-sc.Duration)
+		}
+	}
+	arrival := sc.Arrival.withDefaults()
+	end := sc.Start.Add(sc.Duration)
+
+	f.mu.Lock()
+	logTypes := f.logTypes
+	if len(sc.LogTypes) > 0 {
+		logTypes = mustSeverityTable(sc.LogTypes, DefaultLogTypes)
+	}
+	burstLogTypes := mustSeverityTable(arrival.BurstLogTypes, DefaultBurstLogTypes)
+
+	devices := make([]*Device, 0, len(f.order))
+	intervals := make([]time.Duration, 0, len(f.order))
+	queue := make(arrivalQueue, 0, len(f.order))
+	for i, id := range f.order {
+		d := f.devices[id]
+		devices = append(devices, d)
+		intervals = append(intervals, sc.intervalOf(d))
+		st := &arrivalState{index: i}
+		arrival.first(f.rng, st, sc.Start, intervals[i])
+		queue = append(queue, st)
+	}
+	f.mu.Unlock()
+	heap.Init(&queue)
+
+	stats := Stats{ByType: make(map[string]int)}
+	began := time.Now()
+	pending := append([]ScheduledFault(nil), sc.Faults...)
+	var timer *time.Timer
+
+	for queue.Len() > 0 {
+		st := queue[0]
+		t := st.next
+		if !t.Before(end) {
+			break
+		}
+
+		if sc.Realtime {
+			if wait := time.Until(began.Add(t.Sub(sc.Start))); wait > 0 {
+				if timer == nil {
+					timer = time.NewTimer(wait)
+					defer timer.Stop()
+				} else {
+					timer.Reset(wait)
+				}
+				select {
+				case <-ctx.Done():
+					stats.Duration = time.Since(began)
+					return stats, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			stats.Duration = time.Since(began)
+			return stats, ctx.Err()
+		}
+
+		remaining := pending[:0]
+		for _, sf := range pending {
+			if sc.Start.Add(sf.At).After(t) {
+				remaining = append(remaining, sf)
+				continue
+			}
+			fault := sf.Fault
+			fault.Start = sc.Start.Add(sf.At)
+			if err := f.InjectFault(sf.DeviceID, fault); err != nil {
+				stats.LastErr = err
+			}
+		}
+		pending = remaining
+
+		f.mu.Lock()
+		table := logTypes
+		inBurst := st.inBurst
+		if inBurst {
+			table = burstLogTypes
+		}
+		msg, ok := f.readingLocked(devices[st.index], t, table)
+		arrival.advance(f.rng, st, t, intervals[st.index])
+		f.mu.Unlock()
+		heap.Fix(&queue, 0)
+
+		if !ok {
+			stats.Dropped++
+			continue
+		}
+		if err := sink.Send(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				stats.Duration = time.Since(began)
+				return stats, ctx.Err()
+			}
+			stats.Failed++
+			stats.LastErr = err
+			continue
+		}
+		stats.Sent++
+		stats.ByType[msg.LogType]++
+		if inBurst {
+			stats.Bursts++
+		}
+	}
+
+	stats.Duration = time.Since(began)
+	return stats, nil
+}
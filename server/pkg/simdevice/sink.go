@@ -0,0 +1,156 @@
+package simdevice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"edge-insights/internal/types"
+
+	"github.com/gorilla/websocket"
+)
+
+// Sink receives simulated readings
+type Sink interface {
+	Send(ctx context.Context, msg types.LogMessage) error
+}
+
+// SinkFunc adapts a function to a Sink, e.g. ws.Handler.Ingest for in-process tests
+type SinkFunc func(msg types.LogMessage) error
+
+// Send implements Sink
+func (fn SinkFunc) Send(ctx context.Context, msg types.LogMessage) error {
+	return fn(msg)
+}
+
+// Collector is a Sink that keeps every reading in memory
+type Collector struct {
+	mu       sync.Mutex
+	Messages []types.LogMessage
+}
+
+// Send implements Sink
+func (c *Collector) Send(ctx context.Context, msg types.LogMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Messages = append(c.Messages, msg)
+	return nil
+}
+
+// Snapshot returns a copy of the collected readings
+func (c *Collector) Snapshot() []types.LogMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]types.LogMessage(nil), c.Messages...)
+}
+
+// ResponseError is a log the server refused; Code says why (types.CodeValidationFailed, ...)
+type ResponseError struct {
+	Code    types.ErrorCode
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// WebSocketSink sends readings to the server's /ws endpoint and waits for each acknowledgement
+// When the server answers RATE_LIMITED it waits retry_after_ms and resends, up to MaxRetries times
+// Every reading carries a msg_id, so a resend the server already stored is not stored twice
+type WebSocketSink struct {
+	MaxRetries int
+
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	prefix string // unique per sink, so msg_ids of sinks for the same device do not collide
+	seq    uint64
+}
+
+// logFrame is a reading as sent on /ws, with the msg_id its acknowledgement refers to
+type logFrame struct {
+	types.LogMessage
+	MsgID string `json:"msg_id"`
+}
+
+// DialWebSocket connects a WebSocketSink to a URL such as ws://localhost:8080/ws
+// apiKey is sent as X-API-Key when the server requires device authentication; empty sends none
+func DialWebSocket(ctx context.Context, url, apiKey string) (*WebSocketSink, error) {
+	header := http.Header{}
+	if apiKey != "" {
+		header.Set("X-API-Key", apiKey)
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+	return &WebSocketSink{conn: conn, MaxRetries: 5, prefix: strconv.FormatInt(time.Now().UnixNano(), 36)}, nil
+}
+
+// Send implements Sink
+func (s *WebSocketSink) Send(ctx context.Context, msg types.LogMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	frame := logFrame{LogMessage: msg, MsgID: s.prefix + "-" + strconv.FormatUint(s.seq, 10)}
+	for attempt := 0; ; attempt++ {
+		if err := s.conn.WriteJSON(frame); err != nil {
+			return err
+		}
+		response, err := s.readResponse(frame.MsgID)
+		if err != nil {
+			return err
+		}
+		if response.Success {
+			return nil
+		}
+		if response.Code != types.CodeRateLimited || attempt >= s.MaxRetries {
+			return &ResponseError{Code: response.Code, Message: response.Error}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(response.RetryAfterMs) * time.Millisecond):
+		}
+	}
+}
+
+// readResponse returns the acknowledgement of msgID, skipping live-feed broadcasts ({"type": ...})
+// the server sends to every connected client and acknowledgements of earlier readings
+func (s *WebSocketSink) readResponse(msgID string) (types.LogResponse, error) {
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return types.LogResponse{}, err
+		}
+		var envelope struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(data, &envelope) == nil && envelope.Type != "" {
+			continue
+		}
+		var response types.LogResponse
+		if err := json.Unmarshal(data, &response); err != nil {
+			return types.LogResponse{}, err
+		}
+		if response.MsgID != "" && response.MsgID != msgID {
+			continue
+		}
+		return response, nil
+	}
+}
+
+// Close closes the connection
+func (s *WebSocketSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
@@ -0,0 +1,122 @@
+// IoT device simulator: streams readings from a simulated fleet to the server's WebSocket endpoint
+// The simulation itself lives in pkg/simdevice so tests can drive it in-process
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-insights/internal/devicetypes"
+	"edge-insights/pkg/simdevice"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws", "WebSocket endpoint to send readings to")
+	perProfile := flag.Int("per-profile", 3, "devices per device type")
+	interval := flag.Duration("interval", 0, "time between readings of each device (0 uses each device type's reporting interval)")
+	duration := flag.Duration("duration", 0, "how long to run (0 runs until interrupted)")
+	backfill := flag.Duration("backfill", 0, "send this much history with simulated timestamps instead of running live")
+	seed := flag.Int64("seed", 0, "random seed (0 uses the current time)")
+	arrival := flag.String("arrival", "fixed", "arrival pattern: fixed, poisson or bursty")
+	apiKey := flag.String("api-key", os.Getenv("DEVICE_API_KEY"), "device API key, when the server sets DEVICE_AUTH_REQUIRED")
+	latency := flag.Bool("latency", false, "measure ack and live-feed latency and print p50/p95/p99")
+	logTypes := flag.String("log-types", "", "severity weights, e.g. INFO=0.9,WARN=0.07,ERROR=0.03")
+	deviceTypes := flag.String("device-types", os.Getenv("DEVICE_TYPES_FILE"), "JSON file of device types to simulate besides the built-in ones")
+	flag.Parse()
+
+	if err := devicetypes.LoadFile(*deviceTypes); err != nil {
+		log.Fatal(err)
+	}
+
+	weights, err := parseWeights(*logTypes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	sink, err := simdevice.DialWebSocket(ctx, *url, *apiKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sink.Close()
+
+	var sendTo simdevice.Sink = sink
+	var recorder *simdevice.LatencyRecorder
+	var listening <-chan error
+	if *latency {
+		recorder = simdevice.NewLatencyRecorder()
+		sendTo = recorder.Wrap(sink)
+		listenCtx, stopListening := context.WithCancel(context.Background())
+		defer stopListening()
+		listening, err = recorder.Listen(listenCtx, *url, *apiKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fleet := simdevice.CreateFleet(simdevice.FleetConfig{PerProfile: *perProfile, Seed: *seed})
+	log.Printf("Simulating %d devices against %s", len(fleet.Devices()), *url)
+
+	scenario := simdevice.Scenario{
+		Interval: *interval,
+		Duration: *duration,
+		Realtime: true,
+		LogTypes: weights,
+		Arrival:  simdevice.Arrival{Pattern: simdevice.Pattern(*arrival)},
+	}
+	if *backfill > 0 {
+		scenario.Duration, scenario.Realtime = *backfill, false
+	} else if *duration == 0 {
+		scenario.Duration = 100 * 365 * 24 * time.Hour
+	}
+
+	stats, err := fleet.RunScenario(ctx, scenario, sendTo)
+	if err != nil && err != context.Canceled {
+		log.Printf("Simulation stopped: %v", err)
+	}
+	log.Printf("Sent %d readings (%d failed, %d dropped) in %s", stats.Sent, stats.Failed, stats.Dropped, stats.Duration.Round(time.Second))
+	if stats.LastErr != nil {
+		log.Printf("Last error: %v", stats.LastErr)
+	}
+
+	if recorder != nil {
+		// Give the last broadcasts a moment to arrive
+		select {
+		case err := <-listening:
+			if err != nil {
+				log.Printf("Live feed listener stopped: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+		}
+		fmt.Println(recorder.Report())
+	}
+}
+
+// parseWeights parses NAME=weight pairs separated by commas
+func parseWeights(s string) (map[string]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid log type weight %q, want NAME=weight", pair)
+		}
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for %s: %w", name, err)
+		}
+		weights[strings.ToUpper(name)] = w
+	}
+	return weights, nil
+}